@@ -1,6 +1,7 @@
 package addrmgr
 
 import (
+	"bytes"
 	"io/ioutil"
 	"math/rand"
 	"net"
@@ -10,8 +11,8 @@ import (
 	"github.com/babylonchain-io/bbld/wire"
 )
 
-// randAddr generates a *wire.NetAddress backed by a random IPv4/IPv6 address.
-func randAddr(t *testing.T) *wire.NetAddress {
+// randAddr generates a *wire.NetAddressV2 backed by a random IPv4/IPv6 address.
+func randAddr(t *testing.T) *wire.NetAddressV2 {
 	t.Helper()
 
 	ipv4 := rand.Intn(2) == 0
@@ -30,22 +31,61 @@ func randAddr(t *testing.T) *wire.NetAddress {
 		ip = b[:]
 	}
 
-	return &wire.NetAddress{
-		Services: wire.ServiceFlag(rand.Uint64()),
-		IP:       ip,
-		Port:     uint16(rand.Uint32()),
+	return wire.NewNetAddressV2IPPort(ip, uint16(rand.Uint32()),
+		wire.ServiceFlag(rand.Uint64()))
+}
+
+// randAddrV2 generates a *wire.NetAddressV2 backed by a random address of any
+// of the IPv4, IPv6, Tor v3, I2P and CJDNS networks.
+func randAddrV2(t *testing.T) *wire.NetAddressV2 {
+	t.Helper()
+
+	var netID wire.NetworkID
+	var addr []byte
+	switch rand.Intn(4) {
+	case 0:
+		return randAddr(t)
+
+	case 1:
+		netID, addr = wire.NetworkTorV3, make([]byte, 32)
+
+	case 2:
+		netID, addr = wire.NetworkI2P, make([]byte, 32)
+
+	case 3:
+		netID, addr = wire.NetworkCJDNS, make([]byte, 16)
+	}
+	if _, err := rand.Read(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	// CJDNS addresses are always in the fc00::/8 range.
+	if netID == wire.NetworkCJDNS {
+		addr[0] = 0xfc
+	}
+
+	return &wire.NetAddressV2{
+		Services:  wire.ServiceFlag(rand.Uint64()),
+		NetworkID: netID,
+		Addr:      addr,
+		Port:      uint16(rand.Uint32()),
 	}
 }
 
 // assertAddr ensures that the two addresses match. The timestamp is not
 // checked as it does not affect uniquely identifying a specific address.
-func assertAddr(t *testing.T, got, expected *wire.NetAddress) {
+func assertAddr(t *testing.T, got, expected *wire.NetAddressV2) {
 	if got.Services != expected.Services {
 		t.Fatalf("expected address services %v, got %v",
 			expected.Services, got.Services)
 	}
-	if !got.IP.Equal(expected.IP) {
-		t.Fatalf("expected address IP %v, got %v", expected.IP, got.IP)
+	if got.NetworkID != expected.NetworkID {
+		t.Fatalf("expected address network %v, got %v",
+			expected.NetworkID, got.NetworkID)
+	}
+	if !bytes.Equal(got.Addr, expected.Addr) {
+		t.Fatalf("expected address %x, got %x", expected.Addr,
+			got.Addr)
 	}
 	if got.Port != expected.Port {
 		t.Fatalf("expected address port %d, got %d", expected.Port,
@@ -56,7 +96,7 @@ func assertAddr(t *testing.T, got, expected *wire.NetAddress) {
 // assertAddrs ensures that the manager's address cache matches the given
 // expected addresses.
 func assertAddrs(t *testing.T, addrMgr *AddrManager,
-	expectedAddrs map[string]*wire.NetAddress) {
+	expectedAddrs map[string]*wire.NetAddressV2) {
 
 	t.Helper()
 
@@ -96,11 +136,11 @@ func TestAddrManagerSerialization(t *testing.T) {
 	// We'll be adding 5 random addresses to the manager.
 	const numAddrs = 5
 
-	expectedAddrs := make(map[string]*wire.NetAddress, numAddrs)
+	expectedAddrs := make(map[string]*wire.NetAddressV2, numAddrs)
 	for i := 0; i < numAddrs; i++ {
-		addr := randAddr(t)
+		addr := randAddrV2(t)
 		expectedAddrs[NetAddressKey(addr)] = addr
-		addrMgr.AddAddress(addr, randAddr(t))
+		addrMgr.AddAddress(addr, randAddrV2(t))
 	}
 
 	// Now that the addresses have been added, we should be able to retrieve
@@ -141,7 +181,7 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	// each addresses' services will not be stored.
 	const numAddrs = 5
 
-	expectedAddrs := make(map[string]*wire.NetAddress, numAddrs)
+	expectedAddrs := make(map[string]*wire.NetAddressV2, numAddrs)
 	for i := 0; i < numAddrs; i++ {
 		addr := randAddr(t)
 		expectedAddrs[NetAddressKey(addr)] = addr
@@ -178,6 +218,10 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 		}
 
 		addrMgr.SetServices(addr, expectedAddr.Services)
+		if services := addrMgr.Services(addr); services != expectedAddr.Services {
+			t.Fatalf("expected address services to be %v, got %v",
+				expectedAddr.Services, services)
+		}
 	}
 
 	// We'll also bump up the manager's version to v2, which should signal
@@ -192,3 +236,60 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	addrMgr.loadPeers()
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
+
+// TestAddrManagerV2ToV3 ensures that we can properly upgrade the serialized
+// version of the address manager from v2, which doesn't record the network of
+// addresses, to v3.
+func TestAddrManagerV2ToV3(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	addrMgr.version = 2
+
+	// Tor v3 and I2P addresses can be recovered from their host names, so
+	// they survive a v2 serialization just like IP addresses.
+	torV3, err := wire.NewNetAddressV2Host("pg6mmjiyjmcrsslvykfwnntlaru7p5"+
+		"svn6y2ymmju6nubxndf4pscryd.onion", 8333, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("unable to create tor v3 address: %v", err)
+	}
+	i2p, err := wire.NewNetAddressV2Host("ukeu3k5oycgaauneqgtnvselmt4yemvoi"+
+		"lkln7jpvamvfx7dnkdq.b32.i2p", 0, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("unable to create i2p address: %v", err)
+	}
+	expectedAddrs := map[string]*wire.NetAddressV2{
+		NetAddressKey(torV3): torV3,
+		NetAddressKey(i2p):   i2p,
+	}
+	for _, addr := range expectedAddrs {
+		addrMgr.AddAddress(addr, randAddr(t))
+	}
+
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+
+	// Once upgraded to v3 the network is persisted, which allows CJDNS
+	// addresses to be told apart from IPv6 addresses.
+	cjdns := &wire.NetAddressV2{
+		Services:  wire.SFNodeNetwork,
+		NetworkID: wire.NetworkCJDNS,
+		Addr:      net.ParseIP("fc00::1"),
+		Port:      8333,
+	}
+	expectedAddrs[NetAddressKey(cjdns)] = cjdns
+	addrMgr.AddAddress(cjdns, randAddr(t))
+
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+}
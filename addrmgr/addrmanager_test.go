@@ -19,7 +19,7 @@ import (
 // naTest is used to describe a test to be performed against the NetAddressKey
 // method.
 type naTest struct {
-	in   wire.NetAddress
+	in   wire.NetAddressV2
 	want string
 }
 
@@ -89,12 +89,24 @@ func addNaTests() {
 	addNaTest("fed1::2:2", 8334, "[fed1::2:2]:8334")
 	addNaTest("fee2::3:3", 8335, "[fee2::3:3]:8335")
 	addNaTest("fef3::4:4", 8336, "[fef3::4:4]:8336")
+
+	// Tor
+	addNaTest("fd87:d87e:eb43:f1f2:f3f4:f5f6:f7f8:f9fa", 8333,
+		"6hzph5hv6337r6p2.onion:8333")
+	addNaTest("pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion",
+		8333, "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion:8333")
+
+	// I2P
+	addNaTest("ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+		0, "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p:0")
 }
 
-func addNaTest(ip string, port uint16, want string) {
-	nip := net.ParseIP(ip)
-	na := *wire.NewNetAddressIPPort(nip, port, wire.SFNodeNetwork)
-	test := naTest{na, want}
+func addNaTest(host string, port uint16, want string) {
+	na, err := wire.NewNetAddressV2Host(host, port, wire.SFNodeNetwork)
+	if err != nil {
+		panic(err)
+	}
+	test := naTest{*na, want}
 	naTests = append(naTests, test)
 }
 
@@ -157,37 +169,37 @@ func TestAddAddressByIP(t *testing.T) {
 
 func TestAddLocalAddress(t *testing.T) {
 	var tests = []struct {
-		address  wire.NetAddress
+		address  wire.NetAddressV2
 		priority addrmgr.AddressPriority
 		valid    bool
 	}{
 		{
-			wire.NetAddress{IP: net.ParseIP("192.168.0.100")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("192.168.0.100"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("204.124.1.1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.1.1"), 0, 0),
 			addrmgr.InterfacePrio,
 			true,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("204.124.1.1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.1.1"), 0, 0),
 			addrmgr.BoundPrio,
 			true,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("fe80::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fe80::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("2620:100::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2620:100::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			true,
 		},
@@ -197,12 +209,12 @@ func TestAddLocalAddress(t *testing.T) {
 		result := amgr.AddLocalAddress(&test.address, test.priority)
 		if result == nil && !test.valid {
 			t.Errorf("TestAddLocalAddress test #%d failed: %s should have "+
-				"been accepted", x, test.address.IP)
+				"been accepted", x, test.address.Host())
 			continue
 		}
 		if result != nil && test.valid {
 			t.Errorf("TestAddLocalAddress test #%d failed: %s should not have "+
-				"been accepted", x, test.address.IP)
+				"been accepted", x, test.address.Host())
 			continue
 		}
 	}
@@ -257,7 +269,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 	if !b {
 		t.Errorf("Expected that we need more addresses")
 	}
-	addrs := make([]*wire.NetAddress, addrsToAdd)
+	addrs := make([]*wire.NetAddressV2, addrsToAdd)
 
 	var err error
 	for i := 0; i < addrsToAdd; i++ {
@@ -268,7 +280,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 		}
 	}
 
-	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	srcAddr := wire.NewNetAddressV2IPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
 
 	n.AddAddresses(addrs, srcAddr)
 	numAddrs := n.NumAddresses()
@@ -285,7 +297,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 func TestGood(t *testing.T) {
 	n := addrmgr.New("testgood", lookupFunc)
 	addrsToAdd := 64 * 64
-	addrs := make([]*wire.NetAddress, addrsToAdd)
+	addrs := make([]*wire.NetAddressV2, addrsToAdd)
 
 	var err error
 	for i := 0; i < addrsToAdd; i++ {
@@ -296,7 +308,7 @@ func TestGood(t *testing.T) {
 		}
 	}
 
-	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	srcAddr := wire.NewNetAddressV2IPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
 
 	n.AddAddresses(addrs, srcAddr)
 	for _, addr := range addrs {
@@ -331,8 +343,8 @@ func TestGetAddress(t *testing.T) {
 	if ka == nil {
 		t.Fatalf("Did not get an address where there is one in the pool")
 	}
-	if ka.NetAddress().IP.String() != someIP {
-		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	if ka.NetAddress().Host() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().Host(), someIP)
 	}
 
 	// Mark this as a good address and get it
@@ -341,8 +353,8 @@ func TestGetAddress(t *testing.T) {
 	if ka == nil {
 		t.Fatalf("Did not get an address where there is one in the pool")
 	}
-	if ka.NetAddress().IP.String() != someIP {
-		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	if ka.NetAddress().Host() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().Host(), someIP)
 	}
 
 	numAddrs := n.NumAddresses()
@@ -352,51 +364,51 @@ func TestGetAddress(t *testing.T) {
 }
 
 func TestGetBestLocalAddress(t *testing.T) {
-	localAddrs := []wire.NetAddress{
-		{IP: net.ParseIP("192.168.0.100")},
-		{IP: net.ParseIP("::1")},
-		{IP: net.ParseIP("fe80::1")},
-		{IP: net.ParseIP("2001:470::1")},
+	localAddrs := []wire.NetAddressV2{
+		*wire.NewNetAddressV2IPPort(net.ParseIP("192.168.0.100"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("::1"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("fe80::1"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
 	}
 
 	var tests = []struct {
-		remoteAddr wire.NetAddress
-		want0      wire.NetAddress
-		want1      wire.NetAddress
-		want2      wire.NetAddress
-		want3      wire.NetAddress
+		remoteAddr wire.NetAddressV2
+		want0      wire.NetAddressV2
+		want1      wire.NetAddressV2
+		want2      wire.NetAddressV2
+		want3      wire.NetAddressV2
 	}{
 		{
 			// Remote connection from public IPv4
-			wire.NetAddress{IP: net.ParseIP("204.124.8.1")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0),
 		},
 		{
 			// Remote connection from private IPv4
-			wire.NetAddress{IP: net.ParseIP("172.16.0.254")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("172.16.0.254"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
 		},
 		{
 			// Remote connection from public IPv6
-			wire.NetAddress{IP: net.ParseIP("2602:100:abcd::102")},
-			wire.NetAddress{IP: net.IPv6zero},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2602:100:abcd::102"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv6zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
 		},
 		/* XXX
 		{
 			// Remote connection from Tor
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43::100")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43::100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0),
 		},
 		*/
 	}
@@ -406,9 +418,9 @@ func TestGetBestLocalAddress(t *testing.T) {
 	// Test against default when there's no address
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want0.IP.Equal(got.IP) {
+		if test.want0.Host() != got.Host() {
 			t.Errorf("TestGetBestLocalAddress test1 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want1.IP, got.IP)
+				x, test.remoteAddr.Host(), test.want1.Host(), got.Host())
 			continue
 		}
 	}
@@ -420,37 +432,37 @@ func TestGetBestLocalAddress(t *testing.T) {
 	// Test against want1
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want1.IP.Equal(got.IP) {
+		if test.want1.Host() != got.Host() {
 			t.Errorf("TestGetBestLocalAddress test1 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want1.IP, got.IP)
+				x, test.remoteAddr.Host(), test.want1.Host(), got.Host())
 			continue
 		}
 	}
 
 	// Add a public IP to the list of local addresses.
-	localAddr := wire.NetAddress{IP: net.ParseIP("204.124.8.100")}
+	localAddr := *wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0)
 	amgr.AddLocalAddress(&localAddr, addrmgr.InterfacePrio)
 
 	// Test against want2
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want2.IP.Equal(got.IP) {
+		if test.want2.Host() != got.Host() {
 			t.Errorf("TestGetBestLocalAddress test2 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want2.IP, got.IP)
+				x, test.remoteAddr.Host(), test.want2.Host(), got.Host())
 			continue
 		}
 	}
 	/*
 		// Add a Tor generated IP address
-		localAddr = wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")}
+		localAddr = *wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0)
 		amgr.AddLocalAddress(&localAddr, addrmgr.ManualPrio)
 
 		// Test against want3
 		for x, test := range tests {
 			got := amgr.GetBestLocalAddress(&test.remoteAddr)
-			if !test.want3.IP.Equal(got.IP) {
+			if test.want3.Host() != got.Host() {
 				t.Errorf("TestGetBestLocalAddress test3 #%d failed for remote address %s: want %s got %s",
-					x, test.remoteAddr.IP, test.want3.IP, got.IP)
+					x, test.remoteAddr.Host(), test.want3.Host(), got.Host())
 				continue
 			}
 		}
@@ -0,0 +1,364 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"net"
+
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// asmapInstruction is an instruction of the program an asmap consists of.
+type asmapInstruction uint32
+
+const (
+	// asmapReturn returns the AS number which follows it.
+	asmapReturn asmapInstruction = 0
+
+	// asmapJump consumes the next bit of the IP address and skips the
+	// number of bits of the program which follows it when the bit is set.
+	asmapJump asmapInstruction = 1
+
+	// asmapMatch consumes as many bits of the IP address as the bit pattern
+	// which follows it has, and returns the default AS number when they
+	// don't match.
+	asmapMatch asmapInstruction = 2
+
+	// asmapDefault sets the AS number which follows it as the default.
+	asmapDefault asmapInstruction = 3
+)
+
+const (
+	// asmapInvalid is returned when decoding a value runs past the end of
+	// the asmap.
+	asmapInvalid = 0xffffffff
+
+	// asmapIPBits is the number of bits of the IP addresses looked up in an
+	// asmap.  IPv4 addresses are looked up as IPv4-mapped IPv6 addresses.
+	asmapIPBits = 128
+)
+
+var (
+	// The bit sizes of the exponent-Golomb like classes the different
+	// values of the asmap program are encoded with.
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+		17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// ErrInvalidASMap describes an error where the passed data is not a valid
+// asmap.
+var ErrInvalidASMap = errors.New("invalid asmap")
+
+// ASMap maps IP addresses to the number of the autonomous system (AS) they
+// belong to.  It uses the compact encoding of Bitcoin Core, where the map is a
+// program of the instructions above which is interpreted with the bits of the
+// IP address as its input.
+type ASMap struct {
+	data     []byte
+	checksum string
+}
+
+// asmapReader reads the bits of an asmap program, starting with the least
+// significant bit of each byte.
+type asmapReader struct {
+	data []byte
+	pos  uint32
+	end  uint32
+}
+
+// bit returns the next bit of the program.  The caller must ensure the end of
+// the program has not been reached.
+func (r *asmapReader) bit() uint32 {
+	b := uint32(r.data[r.pos/8]>>(r.pos%8)) & 1
+	r.pos++
+	return b
+}
+
+// decodeBits decodes a value encoded with the passed bit size classes.  A set
+// bit for each class but the last means the value is beyond the class, while a
+// cleared bit is followed by the offset of the value within the class.  It
+// returns asmapInvalid when the value runs past the end of the program.
+func (r *asmapReader) decodeBits(minVal uint32, bitSizes []uint8) uint32 {
+	val := minVal
+	for i, size := range bitSizes {
+		var b uint32
+		if i != len(bitSizes)-1 {
+			if r.pos == r.end {
+				break
+			}
+			b = r.bit()
+		}
+		if b == 1 {
+			val += 1 << size
+			continue
+		}
+		for j := uint8(0); j < size; j++ {
+			if r.pos == r.end {
+				return asmapInvalid
+			}
+			val += r.bit() << (size - 1 - j)
+		}
+		return val
+	}
+	return asmapInvalid
+}
+
+func (r *asmapReader) decodeType() asmapInstruction {
+	return asmapInstruction(r.decodeBits(0, asmapTypeBitSizes))
+}
+
+func (r *asmapReader) decodeASN() uint32 {
+	return r.decodeBits(1, asmapASNBitSizes)
+}
+
+func (r *asmapReader) decodeMatch() uint32 {
+	return r.decodeBits(2, asmapMatchBitSizes)
+}
+
+func (r *asmapReader) decodeJump() uint32 {
+	return r.decodeBits(17, asmapJumpBitSizes)
+}
+
+// NewASMap returns the asmap encoded in the passed data.  The program is
+// verified to terminate for every IP address so that lookups never fail.
+func NewASMap(data []byte) (*ASMap, error) {
+	if !sanityCheckASMap(data) {
+		return nil, ErrInvalidASMap
+	}
+
+	checksum := sha256.Sum256(data)
+	return &ASMap{
+		data:     data,
+		checksum: hex.EncodeToString(checksum[:]),
+	}, nil
+}
+
+// LoadASMap reads the asmap from the file at the passed path.
+func LoadASMap(path string) (*ASMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewASMap(data)
+}
+
+// Checksum returns the hex encoded SHA256 hash of the encoded asmap, which
+// identifies the asmap used to bucket addresses.
+func (m *ASMap) Checksum() string {
+	return m.checksum
+}
+
+// Lookup returns the number of the autonomous system the passed address
+// belongs to.  Zero, which is a reserved AS number, is returned for addresses
+// which are not mapped, and for addresses which are neither routable IPv4 nor
+// IPv6 addresses.  IPv6 addresses which embed an IPv4 address are looked up by
+// the IPv4 address.
+func (m *ASMap) Lookup(na *wire.NetAddressV2) uint32 {
+	if !isIP(na) || !IsRoutable(na) || IsOnionCatTor(na) {
+		return 0
+	}
+
+	ip := na.IP()
+	if v4 := linkedIPv4(na); v4 != nil {
+		ip = v4.To16()
+	}
+	return m.interpret(ip)
+}
+
+// interpret runs the asmap program with the bits of the passed 16 byte IP
+// address as its input and returns the resulting AS number.
+func (m *ASMap) interpret(ip net.IP) uint32 {
+	r := asmapReader{data: m.data, end: uint32(len(m.data)) * 8}
+	ipBit := func(i int) uint32 {
+		return uint32(ip[i/8]>>(7-i%8)) & 1
+	}
+
+	remaining := asmapIPBits
+	var defaultASN uint32
+	for r.pos != r.end {
+		switch r.decodeType() {
+		case asmapReturn:
+			return r.decodeASN()
+
+		case asmapJump:
+			jump := r.decodeJump()
+			if ipBit(asmapIPBits-remaining) == 1 {
+				r.pos += jump
+			}
+			remaining--
+
+		case asmapMatch:
+			match := r.decodeMatch()
+			matchLen := bits.Len32(match) - 1
+			for i := 0; i < matchLen; i++ {
+				want := (match >> uint(matchLen-1-i)) & 1
+				if ipBit(asmapIPBits-remaining) != want {
+					return defaultASN
+				}
+				remaining--
+			}
+
+		case asmapDefault:
+			defaultASN = r.decodeASN()
+
+		default:
+			// The program has been verified to always reach a
+			// return instruction.
+			return 0
+		}
+	}
+	return 0
+}
+
+// sanityCheckASMap returns whether the passed data is a valid asmap program:
+// all instructions are complete, jumps land on instructions, no more than the
+// bits of an IP address are consumed, every path ends with a return
+// instruction, and at most 7 bits of zero padding follow the program.
+func sanityCheckASMap(data []byte) bool {
+	r := asmapReader{data: data, end: uint32(len(data)) * 8}
+
+	// jumps holds the positions the program may jump to along with the
+	// number of IP address bits left at them.  Since jumps are forward
+	// only and don't intersect, the nearest position is always last.
+	type jumpTarget struct {
+		pos       uint32
+		remaining int
+	}
+	var jumps []jumpTarget
+
+	remaining := asmapIPBits
+	prevInstruction := asmapJump
+	hadIncompleteMatch := false
+	for r.pos != r.end {
+		if len(jumps) != 0 && r.pos >= jumps[len(jumps)-1].pos {
+			// Jump into the middle of the previous instruction.
+			return false
+		}
+
+		switch r.decodeType() {
+		case asmapReturn:
+			if prevInstruction == asmapDefault {
+				// Default followed by return could be just a
+				// return.
+				return false
+			}
+			if r.decodeASN() == asmapInvalid {
+				return false
+			}
+			if len(jumps) == 0 {
+				// Nothing left to execute, so only padding may
+				// follow.
+				if r.end-r.pos > 7 {
+					return false
+				}
+				for r.pos != r.end {
+					if r.bit() != 0 {
+						return false
+					}
+				}
+				return true
+			}
+
+			// Continue as if the last jump was taken.
+			target := jumps[len(jumps)-1]
+			if r.pos != target.pos {
+				// Unreachable code.
+				return false
+			}
+			remaining = target.remaining
+			jumps = jumps[:len(jumps)-1]
+			prevInstruction = asmapJump
+
+		case asmapJump:
+			jump := r.decodeJump()
+			if jump == asmapInvalid || jump > r.end-r.pos {
+				return false
+			}
+			if remaining == 0 {
+				return false
+			}
+			remaining--
+			target := r.pos + jump
+			if len(jumps) != 0 && target >= jumps[len(jumps)-1].pos {
+				// Intersecting jumps.
+				return false
+			}
+			jumps = append(jumps, jumpTarget{target, remaining})
+			prevInstruction = asmapJump
+
+		case asmapMatch:
+			match := r.decodeMatch()
+			if match == asmapInvalid {
+				return false
+			}
+			matchLen := bits.Len32(match) - 1
+			if prevInstruction != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			if matchLen < 8 && hadIncompleteMatch {
+				// Only the last of a sequence of matches may be
+				// shorter than 8 bits.
+				return false
+			}
+			hadIncompleteMatch = matchLen < 8
+			if remaining < matchLen {
+				return false
+			}
+			remaining -= matchLen
+			prevInstruction = asmapMatch
+
+		case asmapDefault:
+			if prevInstruction == asmapDefault {
+				return false
+			}
+			if r.decodeASN() == asmapInvalid {
+				return false
+			}
+			prevInstruction = asmapDefault
+
+		default:
+			// Instruction runs past the end of the program.
+			return false
+		}
+	}
+
+	// The end was reached without a return instruction.
+	return false
+}
+
+// linkedIPv4 returns the IPv4 address the passed address is or embeds, which
+// is the case for IPv4 addresses and for RFC6145, RFC6052, RFC3964 (6to4) and
+// RFC4380 (Teredo) IPv6 addresses.  It returns nil otherwise.
+func linkedIPv4(na *wire.NetAddressV2) net.IP {
+	ip := na.IP()
+	switch {
+	case IsIPv4(na):
+		return ip.To4()
+
+	case IsRFC6145(na) || IsRFC6052(na):
+		return net.IP(ip[12:16])
+
+	case IsRFC3964(na):
+		return net.IP(ip[2:6])
+
+	case IsRFC4380(na):
+		// Teredo tunnels have the last 4 bytes as the IPv4 address XOR
+		// 0xff.
+		v4 := make(net.IP, 4)
+		for i, b := range ip[12:16] {
+			v4[i] = b ^ 0xff
+		}
+		return v4
+	}
+	return nil
+}
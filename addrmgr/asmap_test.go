@@ -0,0 +1,252 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// asmapWriter encodes asmap programs for the tests.
+type asmapWriter struct {
+	bits []bool
+}
+
+// encodeBits appends the passed value encoded with the passed bit size
+// classes, which is the inverse of asmapReader.decodeBits.
+func (w *asmapWriter) encodeBits(val, minVal uint32, bitSizes []uint8) {
+	val -= minVal
+	for i, size := range bitSizes {
+		last := i == len(bitSizes)-1
+		if !last && val >= 1<<size {
+			w.bits = append(w.bits, true)
+			val -= 1 << size
+			continue
+		}
+		if !last {
+			w.bits = append(w.bits, false)
+		}
+		for j := int(size) - 1; j >= 0; j-- {
+			w.bits = append(w.bits, val>>uint(j)&1 == 1)
+		}
+		return
+	}
+}
+
+func (w *asmapWriter) ret(asn uint32) {
+	w.encodeBits(uint32(asmapReturn), 0, asmapTypeBitSizes)
+	w.encodeBits(asn, 1, asmapASNBitSizes)
+}
+
+func (w *asmapWriter) jump(offset uint32) {
+	w.encodeBits(uint32(asmapJump), 0, asmapTypeBitSizes)
+	w.encodeBits(offset, 17, asmapJumpBitSizes)
+}
+
+// matchByte appends a match instruction for the 8 bits of the passed byte.
+func (w *asmapWriter) matchByte(b byte) {
+	w.encodeBits(uint32(asmapMatch), 0, asmapTypeBitSizes)
+	w.encodeBits(1<<8|uint32(b), 2, asmapMatchBitSizes)
+}
+
+func (w *asmapWriter) def(asn uint32) {
+	w.encodeBits(uint32(asmapDefault), 0, asmapTypeBitSizes)
+	w.encodeBits(asn, 1, asmapASNBitSizes)
+}
+
+// bytes returns the encoded program padded with zero bits to whole bytes.
+func (w *asmapWriter) bytes() []byte {
+	data := make([]byte, (len(w.bits)+7)/8)
+	for i, bit := range w.bits {
+		if bit {
+			data[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return data
+}
+
+// testASMap returns an asmap which maps the IPv4 addresses below 128.0.0.0 to
+// AS 100, the ones above to AS 200 and leaves IPv6 addresses unmapped.
+func testASMap(t *testing.T) *ASMap {
+	t.Helper()
+
+	var w asmapWriter
+	for _, b := range net.IPv4(0, 0, 0, 0)[:12] {
+		w.matchByte(b)
+	}
+	var low asmapWriter
+	low.ret(100)
+	w.jump(uint32(len(low.bits)))
+	w.bits = append(w.bits, low.bits...)
+	w.ret(200)
+
+	asmap, err := NewASMap(w.bytes())
+	if err != nil {
+		t.Fatalf("NewASMap: unexpected error: %v", err)
+	}
+	return asmap
+}
+
+// TestASMapLookup ensures addresses are mapped to the expected AS numbers.
+func TestASMapLookup(t *testing.T) {
+	asmap := testASMap(t)
+
+	torV3, err := wire.NewNetAddressV2Host("pg6mmjiyjmcrsslvykfwnntlaru7p5"+
+		"svn6y2ymmju6nubxndf4pscryd.onion", 8333, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("unable to create tor v3 address: %v", err)
+	}
+	ipAddr := func(ip string) *wire.NetAddressV2 {
+		return wire.NewNetAddressV2IPPort(net.ParseIP(ip), 8333,
+			wire.SFNodeNetwork)
+	}
+
+	tests := []struct {
+		name string
+		na   *wire.NetAddressV2
+		want uint32
+	}{
+		{"low ipv4", ipAddr("1.2.3.4"), 100},
+		{"high ipv4", ipAddr("200.1.2.3"), 200},
+		{"6to4 high ipv4", ipAddr("2002:c801:0203::1"), 200},
+		{"teredo low ipv4", ipAddr("2001:0:4136:e378:8000:63bf:f5fe:fcfb"), 100},
+		{"ipv6", ipAddr("2a00:1450::1"), 0},
+		{"unroutable ipv4", ipAddr("10.0.0.1"), 0},
+		{"tor v3", torV3, 0},
+	}
+
+	for _, test := range tests {
+		if got := asmap.Lookup(test.na); got != test.want {
+			t.Errorf("%s: wrong AS number - got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestASMapSanityCheck ensures malformed asmaps are rejected.
+func TestASMapSanityCheck(t *testing.T) {
+	var noReturn asmapWriter
+	noReturn.def(100)
+
+	var defaultReturn asmapWriter
+	defaultReturn.def(100)
+	defaultReturn.ret(200)
+
+	var overlong asmapWriter
+	for i := 0; i < 17; i++ {
+		overlong.matchByte(0)
+	}
+	overlong.ret(100)
+
+	var valid asmapWriter
+	valid.ret(100)
+	nonZeroPadding := valid.bytes()
+	nonZeroPadding[len(nonZeroPadding)-1] |= 0x80
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no return", noReturn.bytes()},
+		{"default before return", defaultReturn.bytes()},
+		{"more than 128 bits matched", overlong.bytes()},
+		{"nonzero padding", nonZeroPadding},
+		{"excessive padding", append(valid.bytes(), 0)},
+	}
+
+	for _, test := range tests {
+		if _, err := NewASMap(test.data); err != ErrInvalidASMap {
+			t.Errorf("%s: unexpected error - got %v, want %v",
+				test.name, err, ErrInvalidASMap)
+		}
+	}
+
+	if _, err := NewASMap(valid.bytes()); err != nil {
+		t.Errorf("NewASMap: unexpected error for valid asmap: %v", err)
+	}
+}
+
+// TestAddrManagerASMapMigration ensures the addresses persisted without an
+// asmap are bucketed by AS number once an asmap is used.
+func TestAddrManagerASMapMigration(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	const numAddrs = 50
+	expectedAddrs := make(map[string]*wire.NetAddressV2, numAddrs)
+	for i := 0; i < numAddrs; i++ {
+		ip := net.IPv4(byte(i*5+1), byte(i), 1, 1)
+		addr := wire.NewNetAddressV2IPPort(ip, 8333, wire.SFNodeNetwork)
+		expectedAddrs[NetAddressKey(addr)] = addr
+		addrMgr.AddAddress(addr, addr)
+		if i%5 == 0 {
+			addrMgr.Good(addr)
+		}
+	}
+	addrMgr.savePeers()
+
+	asmap := testASMap(t)
+	addrMgr = New(tempDir, nil)
+	addrMgr.SetASMap(asmap)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+
+	// All addresses must be in the buckets of their AS numbers.
+	assertBucketed := func() {
+		t.Helper()
+
+		var numTried, numNew int
+		for i := range addrMgr.addrTried {
+			for e := addrMgr.addrTried[i].Front(); e != nil; e = e.Next() {
+				ka := e.Value.(*KnownAddress)
+				if bucket := addrMgr.getTriedBucket(ka.na); bucket != i {
+					t.Fatalf("tried address %v in bucket %d, "+
+						"want %d", ka.na.Addr, i, bucket)
+				}
+				numTried++
+			}
+		}
+		for i := range addrMgr.addrNew {
+			for _, ka := range addrMgr.addrNew[i] {
+				bucket := addrMgr.getNewBucket(ka.na, ka.srcAddr)
+				if bucket != i {
+					t.Fatalf("new address %v in bucket %d, "+
+						"want %d", ka.na.Addr, i, bucket)
+				}
+				numNew++
+			}
+		}
+		if numTried != addrMgr.nTried || numNew != addrMgr.nNew ||
+			numTried+numNew != numAddrs {
+
+			t.Fatalf("wrong number of bucketed addresses - got "+
+				"%d tried and %d new, want %d in total",
+				numTried, numNew, numAddrs)
+		}
+	}
+	assertBucketed()
+
+	// The checksum of the asmap is persisted so the addresses are loaded
+	// into the same buckets on the next start.
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.SetASMap(asmap)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	assertBucketed()
+	if got := addrMgr.ASMapChecksum(); got != asmap.Checksum() {
+		t.Fatalf("wrong asmap checksum - got %s, want %s", got,
+			asmap.Checksum())
+	}
+}
@@ -28,6 +28,13 @@ generally helps provide greater peer diversity, and perhaps more importantly,
 drastically reduces the chances an attacker is able to coerce your peer into
 only connecting to nodes they control.
 
+By default the groups are the /16 of IPv4 and the /32 of IPv6 addresses, which
+does not capture how many addresses belong to a single hosting provider.  An
+asmap, which maps IP addresses to the number of the autonomous system they
+belong to, can be set with SetASMap to group the addresses by autonomous system
+instead.  The known addresses are redistributed among the buckets when they
+are loaded with a different asmap than the one they were saved with.
+
 The address manager also understands routability and Tor addresses and tries
 hard to only return routable addresses.  In addition, it uses the information
 provided by the caller about connected, known good, and attempted addresses to
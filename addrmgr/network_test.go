@@ -16,7 +16,7 @@ import (
 // address based on RFCs work as intended.
 func TestIPTypes(t *testing.T) {
 	type ipTest struct {
-		in       wire.NetAddress
+		in       wire.NetAddressV2
 		rfc1918  bool
 		rfc2544  bool
 		rfc3849  bool
@@ -39,7 +39,7 @@ func TestIPTypes(t *testing.T) {
 		rfc4193, rfc4380, rfc4843, rfc4862, rfc5737, rfc6052, rfc6145, rfc6598,
 		local, valid, routable bool) ipTest {
 		nip := net.ParseIP(ip)
-		na := *wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
+		na := *wire.NewNetAddressV2IPPort(nip, 8333, wire.SFNodeNetwork)
 		test := ipTest{na, rfc1918, rfc2544, rfc3849, rfc3927, rfc3964, rfc4193, rfc4380,
 			rfc4843, rfc4862, rfc5737, rfc6052, rfc6145, rfc6598, local, valid, routable}
 		return test
@@ -89,55 +89,55 @@ func TestIPTypes(t *testing.T) {
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
 		if rv := addrmgr.IsRFC1918(&test.in); rv != test.rfc1918 {
-			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP, rv, test.rfc1918)
+			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc1918)
 		}
 
 		if rv := addrmgr.IsRFC3849(&test.in); rv != test.rfc3849 {
-			t.Errorf("IsRFC3849 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3849)
+			t.Errorf("IsRFC3849 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc3849)
 		}
 
 		if rv := addrmgr.IsRFC3927(&test.in); rv != test.rfc3927 {
-			t.Errorf("IsRFC3927 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3927)
+			t.Errorf("IsRFC3927 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc3927)
 		}
 
 		if rv := addrmgr.IsRFC3964(&test.in); rv != test.rfc3964 {
-			t.Errorf("IsRFC3964 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3964)
+			t.Errorf("IsRFC3964 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc3964)
 		}
 
 		if rv := addrmgr.IsRFC4193(&test.in); rv != test.rfc4193 {
-			t.Errorf("IsRFC4193 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4193)
+			t.Errorf("IsRFC4193 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc4193)
 		}
 
 		if rv := addrmgr.IsRFC4380(&test.in); rv != test.rfc4380 {
-			t.Errorf("IsRFC4380 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4380)
+			t.Errorf("IsRFC4380 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc4380)
 		}
 
 		if rv := addrmgr.IsRFC4843(&test.in); rv != test.rfc4843 {
-			t.Errorf("IsRFC4843 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4843)
+			t.Errorf("IsRFC4843 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc4843)
 		}
 
 		if rv := addrmgr.IsRFC4862(&test.in); rv != test.rfc4862 {
-			t.Errorf("IsRFC4862 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4862)
+			t.Errorf("IsRFC4862 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc4862)
 		}
 
 		if rv := addrmgr.IsRFC6052(&test.in); rv != test.rfc6052 {
-			t.Errorf("isRFC6052 %s\n got: %v want: %v", test.in.IP, rv, test.rfc6052)
+			t.Errorf("isRFC6052 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc6052)
 		}
 
 		if rv := addrmgr.IsRFC6145(&test.in); rv != test.rfc6145 {
-			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP, rv, test.rfc6145)
+			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.Host(), rv, test.rfc6145)
 		}
 
 		if rv := addrmgr.IsLocal(&test.in); rv != test.local {
-			t.Errorf("IsLocal %s\n got: %v want: %v", test.in.IP, rv, test.local)
+			t.Errorf("IsLocal %s\n got: %v want: %v", test.in.Host(), rv, test.local)
 		}
 
 		if rv := addrmgr.IsValid(&test.in); rv != test.valid {
-			t.Errorf("IsValid %s\n got: %v want: %v", test.in.IP, rv, test.valid)
+			t.Errorf("IsValid %s\n got: %v want: %v", test.in.Host(), rv, test.valid)
 		}
 
 		if rv := addrmgr.IsRoutable(&test.in); rv != test.routable {
-			t.Errorf("IsRoutable %s\n got: %v want: %v", test.in.IP, rv, test.routable)
+			t.Errorf("IsRoutable %s\n got: %v want: %v", test.in.Host(), rv, test.routable)
 		}
 	}
 }
@@ -183,6 +183,12 @@ func TestGroupKey(t *testing.T) {
 		{name: "ipv6 tor onioncat 2", ip: "fd87:d87e:eb43:1245::6789", expected: "tor:2"},
 		{name: "ipv6 tor onioncat 3", ip: "fd87:d87e:eb43:1345::6789", expected: "tor:3"},
 
+		{name: "tor v2", ip: "aaaaaaaaaaaaaaaa.onion", expected: "tor:0"},
+		{name: "tor v3", ip: "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion", expected: "torv3:9"},
+
+		// I2P.
+		{name: "i2p", ip: "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p", expected: "i2p:2"},
+
 		// IPv6 normal.
 		{name: "ipv6 normal", ip: "2602:100::1", expected: "2602:100::"},
 		{name: "ipv6 normal 2", ip: "2602:0100::1234", expected: "2602:100::"},
@@ -191,12 +197,68 @@ func TestGroupKey(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		nip := net.ParseIP(test.ip)
-		na := *wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
-		if key := addrmgr.GroupKey(&na); key != test.expected {
+		na, err := wire.NewNetAddressV2Host(test.ip, 8333, wire.SFNodeNetwork)
+		if err != nil {
+			t.Errorf("TestGroupKey #%d (%s): unexpected error: %v", i,
+				test.name, err)
+			continue
+		}
+		if key := addrmgr.GroupKey(na); key != test.expected {
 			t.Errorf("TestGroupKey #%d (%s): unexpected group key "+
 				"- got '%s', want '%s'", i, test.name,
 				key, test.expected)
 		}
 	}
 }
+
+// TestNetworkTypes ensures the functions which determine the network of an
+// address work as intended for networks that aren't IPv4 or IPv6.
+func TestNetworkTypes(t *testing.T) {
+	cjdns := &wire.NetAddressV2{
+		NetworkID: wire.NetworkCJDNS,
+		Addr:      net.ParseIP("fc00::1"),
+		Port:      8333,
+	}
+	torV3, _ := wire.NewNetAddressV2Host("pg6mmjiyjmcrsslvykfwnntlaru7p5"+
+		"svn6y2ymmju6nubxndf4pscryd.onion", 8333, 0)
+	i2p, _ := wire.NewNetAddressV2Host("ukeu3k5oycgaauneqgtnvselmt4yemvoi"+
+		"lkln7jpvamvfx7dnkdq.b32.i2p", 0, 0)
+	ipv4 := wire.NewNetAddressV2IPPort(net.ParseIP("12.1.2.3"), 8333, 0)
+	ipv6 := wire.NewNetAddressV2IPPort(net.ParseIP("2602:100::1"), 8333, 0)
+
+	tests := []struct {
+		name     string
+		in       *wire.NetAddressV2
+		network  string
+		tor      bool
+		routable bool
+		groupKey string
+	}{
+		{"ipv4", ipv4, "ipv4", false, true, "12.1.0.0"},
+		{"ipv6", ipv6, "ipv6", false, true, "2602:100::"},
+		{"tor v3", torV3, "onion", true, true, "torv3:9"},
+		{"i2p", i2p, "i2p", false, true, "i2p:2"},
+		{"cjdns", cjdns, "cjdns", false, true, "cjdns:12"},
+		{"empty tor v3", &wire.NetAddressV2{NetworkID: wire.NetworkTorV3},
+			"onion", true, false, "unroutable"},
+	}
+
+	for _, test := range tests {
+		if rv := addrmgr.NetworkName(test.in); rv != test.network {
+			t.Errorf("%s: mismatched network -- got %v, want %v",
+				test.name, rv, test.network)
+		}
+		if rv := addrmgr.IsTor(test.in); rv != test.tor {
+			t.Errorf("%s: mismatched tor -- got %v, want %v",
+				test.name, rv, test.tor)
+		}
+		if rv := addrmgr.IsRoutable(test.in); rv != test.routable {
+			t.Errorf("%s: mismatched routable -- got %v, want %v",
+				test.name, rv, test.routable)
+		}
+		if rv := addrmgr.GroupKey(test.in); rv != test.groupKey {
+			t.Errorf("%s: mismatched group key -- got %v, want %v",
+				test.name, rv, test.groupKey)
+		}
+	}
+}
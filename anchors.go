@@ -0,0 +1,61 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// anchorsFilename is the name of the file in the data directory the addresses
+// of the block-relay-only peers are persisted to on shutdown.
+const anchorsFilename = "anchors.json"
+
+// loadAnchors returns the addresses of the block-relay-only peers persisted in
+// the passed data directory by the previous run.  The file is removed so that
+// the same anchors aren't reused after an unclean shutdown, where they would
+// not have been refreshed.  Errors are logged since the anchors are only an
+// optimization.
+func loadAnchors(dataDir string) []string {
+	path := filepath.Join(dataDir, anchorsFilename)
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		srvrLog.Warnf("Error opening file %s: %v", path, err)
+		return nil
+	}
+	var anchors []string
+	err = json.NewDecoder(r).Decode(&anchors)
+	r.Close()
+	if err != nil {
+		srvrLog.Warnf("Failed to decode file %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		srvrLog.Warnf("Failed to remove file %s: %v", path, err)
+	}
+
+	srvrLog.Infof("Loaded %d anchors from file '%s'", len(anchors), path)
+	return anchors
+}
+
+// saveAnchors persists the passed addresses of the block-relay-only peers to
+// the passed data directory so they are connected to first on the next start.
+func saveAnchors(dataDir string, anchors []string) {
+	path := filepath.Join(dataDir, anchorsFilename)
+	w, err := os.Create(path)
+	if err != nil {
+		srvrLog.Errorf("Error opening file %s: %v", path, err)
+		return
+	}
+	defer w.Close()
+	if err := json.NewEncoder(w).Encode(anchors); err != nil {
+		srvrLog.Errorf("Failed to encode file %s: %v", path, err)
+		return
+	}
+	srvrLog.Infof("Saved %d anchors to file '%s'", len(anchors), path)
+}
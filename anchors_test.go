@@ -0,0 +1,50 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestAnchors ensures the anchors are persisted to the data directory and only
+// loaded once.
+func TestAnchors(t *testing.T) {
+	// The log rotator isn't initialized when testing.
+	srvrLog = btclog.Disabled
+
+	dir, err := ioutil.TempDir("", "anchors")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if anchors := loadAnchors(dir); len(anchors) != 0 {
+		t.Fatalf("loadAnchors: unexpected anchors for missing file: %v",
+			anchors)
+	}
+
+	want := []string{"1.2.3.4:8333", "[2001:db8::1]:8333"}
+	saveAnchors(dir, want)
+	if anchors := loadAnchors(dir); !reflect.DeepEqual(anchors, want) {
+		t.Fatalf("loadAnchors: got %v, want %v", anchors, want)
+	}
+
+	// The file is removed once loaded so the anchors aren't reused after an
+	// unclean shutdown.
+	path := filepath.Join(dir, anchorsFilename)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("anchors file not removed after loading: %v", err)
+	}
+	if anchors := loadAnchors(dir); len(anchors) != 0 {
+		t.Fatalf("loadAnchors: unexpected anchors after loading: %v",
+			anchors)
+	}
+}
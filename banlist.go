@@ -0,0 +1,258 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// banListFilename is the name of the file in the data directory the
+	// banned subnets are persisted to.
+	banListFilename = "banlist.json"
+
+	// banReasonMisbehaving is the reason recorded for peers banned due to
+	// their ban score exceeding the threshold.
+	banReasonMisbehaving = "node misbehaving"
+
+	// banReasonManual is the reason recorded for subnets banned through
+	// the setban RPC.
+	banReasonManual = "manually added"
+)
+
+// banEntry describes a banned subnet along with when and why it was banned.
+type banEntry struct {
+	subnet  *net.IPNet
+	created time.Time
+	until   time.Time
+	reason  string
+}
+
+// serializedBanEntry is the representation of a banEntry in the ban list
+// file.
+type serializedBanEntry struct {
+	Subnet  string `json:"subnet"`
+	Created int64  `json:"created"`
+	Until   int64  `json:"until"`
+	Reason  string `json:"reason"`
+}
+
+// banList maintains the banned subnets and persists them to the data
+// directory so they survive restarts.
+//
+// All methods are safe for concurrent access.
+type banList struct {
+	mtx     sync.Mutex
+	path    string
+	entries map[string]*banEntry
+}
+
+// newBanList returns a new ban list which is persisted to the ban list file in
+// the passed data directory.  Use load to populate it from the file.
+func newBanList(dataDir string) *banList {
+	return &banList{
+		path:    filepath.Join(dataDir, banListFilename),
+		entries: make(map[string]*banEntry),
+	}
+}
+
+// parseSubnet parses the passed string as either a single IP address or a
+// subnet in CIDR notation.  Single IP addresses are returned as the subnet
+// only containing the address.
+func parseSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, subnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q", s)
+		}
+		return subnet, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	return singleIPSubnet(ip), nil
+}
+
+// singleIPSubnet returns the subnet only containing the passed IP address.
+func singleIPSubnet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// sweep removes the expired bans.  It returns whether any ban was removed.
+//
+// This function MUST be called with the ban list lock held.
+func (bl *banList) sweep(now time.Time) bool {
+	var removed bool
+	for key, entry := range bl.entries {
+		if !now.Before(entry.until) {
+			srvrLog.Infof("Subnet %s is no longer banned", key)
+			delete(bl.entries, key)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// save writes the ban list to its file.  Errors are logged since there is
+// nothing the callers could do about them.
+//
+// This function MUST be called with the ban list lock held.
+func (bl *banList) save() {
+	serialized := make([]serializedBanEntry, 0, len(bl.entries))
+	for key, entry := range bl.entries {
+		serialized = append(serialized, serializedBanEntry{
+			Subnet:  key,
+			Created: entry.created.Unix(),
+			Until:   entry.until.Unix(),
+			Reason:  entry.reason,
+		})
+	}
+	sort.Slice(serialized, func(i, j int) bool {
+		return serialized[i].Subnet < serialized[j].Subnet
+	})
+
+	w, err := os.Create(bl.path)
+	if err != nil {
+		srvrLog.Errorf("Error opening file %s: %v", bl.path, err)
+		return
+	}
+	defer w.Close()
+	if err := json.NewEncoder(w).Encode(serialized); err != nil {
+		srvrLog.Errorf("Failed to encode file %s: %v", bl.path, err)
+	}
+}
+
+// load populates the ban list from its file, if it exists.  Expired bans are
+// dropped.
+func (bl *banList) load() error {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	r, err := os.Open(bl.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s error opening file: %v", bl.path, err)
+	}
+	defer r.Close()
+
+	var serialized []serializedBanEntry
+	if err := json.NewDecoder(r).Decode(&serialized); err != nil {
+		return fmt.Errorf("error reading %s: %v", bl.path, err)
+	}
+
+	for _, s := range serialized {
+		subnet, err := parseSubnet(s.Subnet)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", bl.path, err)
+		}
+		bl.entries[subnet.String()] = &banEntry{
+			subnet:  subnet,
+			created: time.Unix(s.Created, 0),
+			until:   time.Unix(s.Until, 0),
+			reason:  s.Reason,
+		}
+	}
+	if bl.sweep(time.Now()) {
+		bl.save()
+	}
+
+	srvrLog.Infof("Loaded %d banned subnets from file '%s'",
+		len(bl.entries), bl.path)
+	return nil
+}
+
+// add bans the passed subnet until the passed time for the passed reason.  An
+// existing ban of the subnet is replaced.
+func (bl *banList) add(subnet *net.IPNet, until time.Time, reason string) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	bl.entries[subnet.String()] = &banEntry{
+		subnet:  subnet,
+		created: time.Now(),
+		until:   until,
+		reason:  reason,
+	}
+	bl.save()
+}
+
+// remove lifts the ban of the passed subnet.  It returns whether the subnet was
+// banned.
+func (bl *banList) remove(subnet *net.IPNet) bool {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	key := subnet.String()
+	if _, ok := bl.entries[key]; !ok {
+		return false
+	}
+	delete(bl.entries, key)
+	bl.save()
+	return true
+}
+
+// clear lifts all bans.
+func (bl *banList) clear() {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	bl.entries = make(map[string]*banEntry)
+	bl.save()
+}
+
+// isBanned returns whether the passed IP address is part of a banned subnet
+// along with the time the longest matching ban ends.
+func (bl *banList) isBanned(ip net.IP) (time.Time, bool) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if bl.sweep(time.Now()) {
+		bl.save()
+	}
+
+	var until time.Time
+	var banned bool
+	for _, entry := range bl.entries {
+		if entry.subnet.Contains(ip) && entry.until.After(until) {
+			until = entry.until
+			banned = true
+		}
+	}
+	return until, banned
+}
+
+// list returns the bans which are in effect ordered by subnet.
+func (bl *banList) list() []banEntry {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if bl.sweep(time.Now()) {
+		bl.save()
+	}
+
+	entries := make([]banEntry, 0, len(bl.entries))
+	for _, entry := range bl.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].subnet.String() < entries[j].subnet.String()
+	})
+	return entries
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestParseSubnet ensures IP addresses and subnets are parsed as expected.
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1.2.3.4", "1.2.3.4/32"},
+		{"1.2.3.4/24", "1.2.3.0/24"},
+		{"::ffff:1.2.3.4", "1.2.3.4/32"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"1.2.3", ""},
+		{"1.2.3.4/33", ""},
+		{"example.com", ""},
+	}
+
+	for _, test := range tests {
+		subnet, err := parseSubnet(test.in)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("parseSubnet(%q): unexpected success", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSubnet(%q): unexpected error: %v", test.in, err)
+			continue
+		}
+		if subnet.String() != test.want {
+			t.Errorf("parseSubnet(%q): got %v, want %v", test.in,
+				subnet, test.want)
+		}
+	}
+}
+
+// TestBanList ensures bans are matched against IP addresses, persisted to the
+// data directory and expire as expected.
+func TestBanList(t *testing.T) {
+	// The log rotator isn't initialized when testing.
+	srvrLog = btclog.Disabled
+
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	bl := newBanList(dir)
+	if err := bl.load(); err != nil {
+		t.Fatalf("load: unexpected error for missing file: %v", err)
+	}
+
+	subnet, _ := parseSubnet("1.2.3.0/24")
+	host, _ := parseSubnet("5.6.7.8")
+	until := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	bl.add(subnet, until, banReasonManual)
+	bl.add(host, until, banReasonMisbehaving)
+
+	if banEnd, ok := bl.isBanned(net.ParseIP("1.2.3.99")); !ok ||
+		!banEnd.Equal(until) {
+
+		t.Errorf("isBanned: address in banned subnet not banned")
+	}
+	if _, ok := bl.isBanned(net.ParseIP("1.2.4.1")); ok {
+		t.Errorf("isBanned: address outside banned subnet banned")
+	}
+
+	// Ensure the bans survive a restart.
+	bl = newBanList(dir)
+	if err := bl.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	entries := bl.list()
+	if len(entries) != 2 {
+		t.Fatalf("list: wrong number of bans - got %d, want %d",
+			len(entries), 2)
+	}
+	if entries[0].subnet.String() != "1.2.3.0/24" ||
+		entries[0].reason != banReasonManual ||
+		!entries[0].until.Equal(until) {
+
+		t.Errorf("list: wrong ban - got %v", entries[0])
+	}
+	if _, ok := bl.isBanned(net.ParseIP("5.6.7.8")); !ok {
+		t.Errorf("isBanned: banned address not banned after load")
+	}
+
+	// Ensure bans can be lifted.
+	if !bl.remove(host) {
+		t.Errorf("remove: banned subnet not removed")
+	}
+	if bl.remove(host) {
+		t.Errorf("remove: unbanned subnet removed")
+	}
+	if _, ok := bl.isBanned(net.ParseIP("5.6.7.8")); ok {
+		t.Errorf("isBanned: address banned after removal")
+	}
+
+	// Ensure expired bans are dropped.
+	bl.add(host, time.Now().Add(-time.Second), banReasonManual)
+	if _, ok := bl.isBanned(net.ParseIP("5.6.7.8")); ok {
+		t.Errorf("isBanned: address banned after ban expired")
+	}
+
+	bl.clear()
+	bl = newBanList(dir)
+	if err := bl.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	if len(bl.list()) != 0 {
+		t.Errorf("list: bans remain after clear")
+	}
+}
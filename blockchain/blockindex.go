@@ -232,6 +232,12 @@ type blockIndex struct {
 	sync.RWMutex
 	index map[chainhash.Hash]*blockNode
 	dirty map[*blockNode]struct{}
+
+	// tips houses every node in the index that does not have any children,
+	// which is the set of tips of the main chain and all side chains.  It
+	// is rebuilt as the index is loaded from the database, so the side
+	// chains stored there are tracked across restarts.
+	tips map[*blockNode]struct{}
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -243,6 +249,7 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 		chainParams: chainParams,
 		index:       make(map[chainhash.Hash]*blockNode),
 		dirty:       make(map[*blockNode]struct{}),
+		tips:        make(map[*blockNode]struct{}),
 	}
 }
 
@@ -284,6 +291,27 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 // This function is NOT safe for concurrent access.
 func (bi *blockIndex) addNode(node *blockNode) {
 	bi.index[node.hash] = node
+
+	// Every node is added after its parent, so a new node is always a tip
+	// and its parent, if any, no longer is.
+	bi.tips[node] = struct{}{}
+	if node.parent != nil {
+		delete(bi.tips, node.parent)
+	}
+}
+
+// Tips returns the tips of all branches in the block index, including the tip
+// of the main chain.  The order of the returned nodes is unspecified.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) Tips() []*blockNode {
+	bi.RLock()
+	tips := make([]*blockNode, 0, len(bi.tips))
+	for node := range bi.tips {
+		tips = append(tips, node)
+	}
+	bi.RUnlock()
+	return tips
 }
 
 // NodeStatus provides concurrent-safe access to the status field of a node.
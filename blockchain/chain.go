@@ -8,6 +8,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,6 +24,11 @@ const (
 	// maxOrphanBlocks is the maximum number of orphan blocks that can be
 	// queued.
 	maxOrphanBlocks = 100
+
+	// maxApprovedReorgs is the maximum number of blocks that can be
+	// approved via ReconsiderBlock to bypass the maximum reorg depth at the
+	// same time.
+	maxApprovedReorgs = 100
 )
 
 // BlockLocator is used to help locate a specific block.  The algorithm for
@@ -110,6 +116,10 @@ type BlockChain struct {
 	maxRetargetTimespan int64 // target timespan * adjustment factor
 	blocksPerRetarget   int32 // target timespan / target time per block
 
+	// maxReorgDepth is the maximum number of main chain blocks a
+	// reorganization may disconnect.  Zero disables the limit.
+	maxReorgDepth int32
+
 	// chainLock protects concurrent access to the vast majority of the
 	// fields in this struct below this point.
 	chainLock sync.RWMutex
@@ -176,6 +186,11 @@ type BlockChain struct {
 	// activated.
 	unknownRulesWarned bool
 
+	// approvedReorgs houses the hashes of blocks that were approved via
+	// ReconsiderBlock to bypass the maximum reorg depth.  It is protected
+	// by the chain lock.
+	approvedReorgs map[chainhash.Hash]struct{}
+
 	// The notifications field stores a slice of callbacks to be executed on
 	// certain blockchain events.
 	notificationsLock sync.RWMutex
@@ -837,6 +852,43 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 	}
 
+	// Refuse reorganizations that would disconnect more blocks than the
+	// configured maximum reorg depth unless the new branch was approved via
+	// ReconsiderBlock.  Deep reorgs undermine checkpoint finality, so they
+	// are treated as an alarm rather than silently followed.
+	depth := int32(detachNodes.Len())
+	if b.maxReorgDepth > 0 && depth > b.maxReorgDepth &&
+		attachNodes.Len() != 0 && !b.isReorgApproved(attachNodes) {
+
+		forkNode := detachNodes.Back().Value.(*blockNode).parent
+		newTip := attachNodes.Back().Value.(*blockNode)
+		log.Warnf("DEEP REORG: Refusing to reorganize %d blocks (max %d) "+
+			"from %v (height %d) to %v (height %d)", depth,
+			b.maxReorgDepth, &tip.hash, tip.height, &newTip.hash,
+			newTip.height)
+		deepReorg := &DeepReorg{
+			ForkHash:     forkNode.hash,
+			ForkHeight:   forkNode.height,
+			OldTipHash:   tip.hash,
+			OldTipHeight: tip.height,
+			NewTipHash:   newTip.hash,
+			NewTipHeight: newTip.height,
+			Depth:        depth,
+			MaxDepth:     b.maxReorgDepth,
+		}
+
+		// Notify the caller that the reorganization was refused.  The
+		// caller would typically want to alert the operator.
+		b.chainLock.Unlock()
+		b.sendNotification(NTDeepReorg, deepReorg)
+		b.chainLock.Lock()
+
+		str := fmt.Sprintf("reorganize to block %v would disconnect %d "+
+			"blocks which exceeds the max reorg depth of %d", &newTip.hash,
+			depth, b.maxReorgDepth)
+		return ruleError(ErrReorgTooDeep, str)
+	}
+
 	// Track the old and new best chains heads.
 	oldBest := tip
 	newBest := tip
@@ -1054,9 +1106,104 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	log.Infof("REORGANIZE: New best chain head is %v (height %v)",
 		newBest.hash, newBest.height)
 
+	// The approvals for the attached blocks have been consumed now that
+	// they are part of the main chain.
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		delete(b.approvedReorgs, e.Value.(*blockNode).hash)
+	}
+
 	return nil
 }
 
+// isReorgApproved returns whether any of the passed nodes to attach has been
+// approved to bypass the maximum reorg depth via ReconsiderBlock.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isReorgApproved(attachNodes *list.List) bool {
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		if _, ok := b.approvedReorgs[n.hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconsiderBlock approves the branch containing the block with the given hash
+// so it may become the main chain even when doing so requires a reorganization
+// deeper than the configured maximum reorg depth.  When the branch already has
+// more cumulative work than the current best chain, the reorganization is
+// performed immediately.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	if b.index.NodeStatus(node).KnownInvalid() {
+		return fmt.Errorf("block %s is known to be invalid", hash)
+	}
+	if b.bestChain.Contains(node) {
+		return nil
+	}
+
+	// Limit the number of approvals by evicting a random one when needed.
+	// Approvals are only consumed once their branch becomes the main
+	// chain, so approved branches that never do would otherwise accumulate.
+	if _, ok := b.approvedReorgs[node.hash]; !ok &&
+		len(b.approvedReorgs) >= maxApprovedReorgs {
+
+		for hash := range b.approvedReorgs {
+			delete(b.approvedReorgs, hash)
+			break
+		}
+	}
+	b.approvedReorgs[node.hash] = struct{}{}
+
+	// Find the tip with the most cumulative work among the branches that
+	// contain the approved block and have all of their block data.
+	var bestTip *blockNode
+	for _, tip := range b.index.Tips() {
+		if tip.Ancestor(node.height) != node {
+			continue
+		}
+		if bestTip != nil && tip.workSum.Cmp(bestTip.workSum) <= 0 {
+			continue
+		}
+		usable := true
+		for n := tip; n != nil && !b.bestChain.Contains(n); n = n.parent {
+			status := b.index.NodeStatus(n)
+			if !status.HaveData() || status.KnownInvalid() {
+				usable = false
+				break
+			}
+		}
+		if usable {
+			bestTip = tip
+		}
+	}
+
+	// Nothing more to do when the approved branch does not have more work
+	// than the current best chain.  It will be allowed to become the main
+	// chain once it does.
+	if bestTip == nil || bestTip.workSum.Cmp(b.bestChain.Tip().workSum) <= 0 {
+		return nil
+	}
+
+	log.Infof("REORGANIZE: Approved block %v is causing a reorganize.",
+		node.hash)
+	detachNodes, attachNodes := b.getReorganizeNodes(bestTip)
+	err := b.reorganizeChain(detachNodes, attachNodes)
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v", writeErr)
+	}
+	return err
+}
+
 // connectBestChain handles connecting the passed block to the chain while
 // respecting proper chain selection according to the chain with the most
 // proof of work.  In the typical case, the new block simply extends the main
@@ -1267,6 +1414,21 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 	return node.Header(), nil
 }
 
+// MedianTimeByHash returns the median time of the block identified by the
+// given hash and the blocks prior to it, as used for the minimum timestamp of
+// its successor.  Note that this works for blocks on both the main and side
+// chains.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MedianTimeByHash(hash *chainhash.Hash) (time.Time, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return time.Time{}, fmt.Errorf("block %s is not known", hash)
+	}
+
+	return node.CalcPastMedianTime(), nil
+}
+
 // MainChainHasBlock returns whether or not the block with the given hash is in
 // the main chain.
 //
@@ -1276,6 +1438,119 @@ func (b *BlockChain) MainChainHasBlock(hash *chainhash.Hash) bool {
 	return node != nil && b.bestChain.Contains(node)
 }
 
+// TipStatus describes the validation state of the tip of a branch in the block
+// tree as reported by ChainTips.
+type TipStatus int
+
+const (
+	// TipActive indicates the tip is the tip of the main chain.
+	TipActive TipStatus = iota
+
+	// TipValidFork indicates the branch is not part of the main chain, but
+	// all of its blocks have been fully validated.
+	TipValidFork
+
+	// TipValidHeaders indicates the data for all blocks in the branch is
+	// available, but the branch has not been fully validated.
+	TipValidHeaders
+
+	// TipHeadersOnly indicates the data for one or more blocks in the branch
+	// is not available.
+	TipHeadersOnly
+
+	// TipInvalid indicates the branch contains at least one block that is
+	// known to be invalid.
+	TipInvalid
+)
+
+// Map of tip statuses back to their constant names for pretty printing.
+var tipStatusStrings = map[TipStatus]string{
+	TipActive:       "active",
+	TipValidFork:    "valid-fork",
+	TipValidHeaders: "valid-headers",
+	TipHeadersOnly:  "headers-only",
+	TipInvalid:      "invalid",
+}
+
+// String returns the TipStatus as a human-readable name.
+func (s TipStatus) String() string {
+	if str, ok := tipStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown TipStatus (%d)", int(s))
+}
+
+// ChainTip describes the tip of a branch in the block tree.
+type ChainTip struct {
+	// Height is the height of the tip block.
+	Height int32
+
+	// Hash is the hash of the tip block.
+	Hash chainhash.Hash
+
+	// BranchLen is the number of blocks between the tip and the point where
+	// the branch forks from the main chain.  It is zero for the main chain.
+	BranchLen int32
+
+	// Status is the validation state of the branch.
+	Status TipStatus
+}
+
+// ChainTips returns the tips of the main chain and every side chain known to
+// the block index, which includes side chains loaded from the database.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() []ChainTip {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	bestTip := b.bestChain.Tip()
+	tips := b.index.Tips()
+	chainTips := make([]ChainTip, 0, len(tips))
+	for _, tip := range tips {
+		chainTip := ChainTip{
+			Height: tip.height,
+			Hash:   tip.hash,
+			Status: TipActive,
+		}
+		if tip == bestTip {
+			chainTips = append(chainTips, chainTip)
+			continue
+		}
+
+		// Walk the branch back to the main chain to determine its length
+		// and the combined validation state of its blocks.
+		fork := b.bestChain.FindFork(tip)
+		chainTip.BranchLen = tip.height
+		if fork != nil {
+			chainTip.BranchLen -= fork.height
+		}
+		chainTip.Status = TipValidFork
+		for n := tip; n != nil && n != fork; n = n.parent {
+			status := b.index.NodeStatus(n)
+			switch {
+			case status.KnownInvalid():
+				chainTip.Status = TipInvalid
+			case !status.HaveData() && chainTip.Status < TipHeadersOnly:
+				chainTip.Status = TipHeadersOnly
+			case !status.KnownValid() && chainTip.Status < TipValidHeaders:
+				chainTip.Status = TipValidHeaders
+			}
+		}
+		chainTips = append(chainTips, chainTip)
+	}
+
+	// Return the tips ordered by descending height so the main chain and
+	// the most relevant forks come first.
+	sort.Slice(chainTips, func(i, j int) bool {
+		if chainTips[i].Height != chainTips[j].Height {
+			return chainTips[i].Height > chainTips[j].Height
+		}
+		return chainTips[i].Status < chainTips[j].Status
+	})
+	return chainTips
+}
+
 // BlockLocatorFromHash returns a block locator for the passed block hash.
 // See BlockLocator for details on the algorithm used to create a block locator.
 //
@@ -1700,6 +1975,14 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// MaxReorgDepth is the maximum number of main chain blocks that may be
+	// disconnected by a reorganization.  Deeper reorganizations are
+	// refused with ErrReorgTooDeep and reported via an NTDeepReorg
+	// notification until the new branch is approved with ReconsiderBlock.
+	//
+	// A value of zero disables the limit.
+	MaxReorgDepth int32
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1748,11 +2031,13 @@ func New(config *Config) (*BlockChain, error) {
 		minRetargetTimespan: targetTimespan / adjustmentFactor,
 		maxRetargetTimespan: targetTimespan * adjustmentFactor,
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
+		maxReorgDepth:       config.MaxReorgDepth,
 		index:               newBlockIndex(config.DB, params),
 		hashCache:           config.HashCache,
 		bestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
+		approvedReorgs:      make(map[chainhash.Hash]struct{}),
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
 	}
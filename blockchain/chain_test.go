@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/babylonchain-io/bbld/btcutil"
 	"github.com/babylonchain-io/bbld/chaincfg"
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
 	"github.com/babylonchain-io/bbld/wire"
 )
 
@@ -966,3 +968,292 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestChainTips ensures the tips of the main chain and all side chains are
+// reported with the expected branch lengths and statuses.
+func TestChainTips(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3 -> 4 -> 5 -> 6
+	// 	                \-> 3a -> 4a (valid)
+	// 	                     \-> 4b -> 5b (data stored, unvalidated)
+	// 	                           \-> 5c (invalid)
+	// 	                                 \-> 6d (headers only)
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedNodes(chain.bestChain.Genesis(), 6)
+	branch1Nodes := chainedNodes(branch0Nodes[1], 2)
+	branch2Nodes := chainedNodes(branch1Nodes[0], 2)
+	branch3Nodes := chainedNodes(branch2Nodes[0], 1)
+	branch4Nodes := chainedNodes(branch3Nodes[0], 1)
+	for _, node := range branch0Nodes {
+		chain.index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch2Nodes {
+		chain.index.SetStatusFlags(node, statusDataStored)
+		chain.index.AddNode(node)
+	}
+	chain.index.SetStatusFlags(branch3Nodes[0], statusDataStored|
+		statusValidateFailed)
+	chain.index.AddNode(branch3Nodes[0])
+	chain.index.AddNode(branch4Nodes[0])
+	chain.bestChain.SetTip(tstTip(branch0Nodes))
+
+	want := []ChainTip{
+		{Height: 6, Hash: branch0Nodes[5].hash, BranchLen: 0, Status: TipActive},
+		{Height: 6, Hash: branch4Nodes[0].hash, BranchLen: 4, Status: TipInvalid},
+		{Height: 5, Hash: branch2Nodes[1].hash, BranchLen: 3, Status: TipValidHeaders},
+		{Height: 4, Hash: branch1Nodes[1].hash, BranchLen: 2, Status: TipValidFork},
+	}
+	got := chain.ChainTips()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected chain tips -- got %v, want %v", got, want)
+	}
+
+	// Adding a child without data to the valid fork must make it
+	// headers-only and replace the previous tip of that branch.
+	headerNode := chainedNodes(branch1Nodes[1], 1)[0]
+	chain.index.AddNode(headerNode)
+	got = chain.ChainTips()
+	want[3] = ChainTip{Height: 5, Hash: headerNode.hash, BranchLen: 3,
+		Status: TipHeadersOnly}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected number of chain tips -- got %d, want %d",
+			len(got), len(want))
+	}
+	for _, tip := range want {
+		var found bool
+		for _, gotTip := range got {
+			if gotTip == tip {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing chain tip %v in %v", tip, got)
+		}
+	}
+}
+
+// TestReorgDepthGuard ensures reorganizations deeper than the maximum reorg
+// depth are refused and reported until the new branch is approved, at which
+// point the reorganization is performed.
+func TestReorgDepthGuard(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("reorgdepthguard", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.maxReorgDepth = 1
+
+	// Construct the following block structure.
+	// 	genesis -> 1 -> 2 -> 3
+	// 	           \-> 2a -> 3a -> 4a
+	genesis := params.GenesisBlock
+	branch0Blocks := make([]*btcutil.Block, 0, 3)
+	parent := genesis
+	for height := int32(1); height <= 3; height++ {
+		block := newSolvedBlock(&params, parent, height, 0)
+		branch0Blocks = append(branch0Blocks, block)
+		parent = block.MsgBlock()
+	}
+	branch1Blocks := make([]*btcutil.Block, 0, 3)
+	parent = branch0Blocks[0].MsgBlock()
+	for height := int32(2); height <= 4; height++ {
+		block := newSolvedBlock(&params, parent, height, 1)
+		branch1Blocks = append(branch1Blocks, block)
+		parent = block.MsgBlock()
+	}
+
+	// Query the chain from the notification callback to ensure the chain
+	// lock is not held while the notification is sent.
+	var deepReorgs []*DeepReorg
+	chain.Subscribe(func(n *Notification) {
+		if n.Type == NTDeepReorg {
+			deepReorgs = append(deepReorgs, n.Data.(*DeepReorg))
+			chain.ChainTips()
+		}
+	})
+
+	for _, block := range branch0Blocks {
+		_, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+	for _, block := range branch1Blocks[:2] {
+		_, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+	}
+
+	// Reorganizing to the side chain requires disconnecting 2 blocks, so
+	// it must be refused.
+	_, _, err = chain.ProcessBlock(branch1Blocks[2], BFNone)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrReorgTooDeep {
+		t.Fatalf("unexpected error -- got %v, want %v", err,
+			ErrReorgTooDeep)
+	}
+	want := &DeepReorg{
+		ForkHash:     *branch0Blocks[0].Hash(),
+		ForkHeight:   1,
+		OldTipHash:   *branch0Blocks[2].Hash(),
+		OldTipHeight: 3,
+		NewTipHash:   *branch1Blocks[2].Hash(),
+		NewTipHeight: 4,
+		Depth:        2,
+		MaxDepth:     1,
+	}
+	if len(deepReorgs) != 1 || !reflect.DeepEqual(deepReorgs[0], want) {
+		t.Fatalf("unexpected deep reorg notifications -- got %v, want %v",
+			deepReorgs, want)
+	}
+	if best := chain.BestSnapshot(); best.Hash != *branch0Blocks[2].Hash() {
+		t.Fatalf("best chain tip changed after refused reorg -- got %v, "+
+			"want %v", best.Hash, branch0Blocks[2].Hash())
+	}
+
+	// Blocks on the main chain and unknown blocks are not approved.
+	if err := chain.ReconsiderBlock(branch0Blocks[1].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+	}
+	if _, ok := chain.approvedReorgs[*branch0Blocks[1].Hash()]; ok {
+		t.Fatalf("main chain block unexpectedly approved")
+	}
+	if err := chain.ReconsiderBlock(&chainhash.Hash{}); err == nil {
+		t.Fatalf("ReconsiderBlock: expected error for unknown block")
+	}
+
+	// Approving a block on the side chain must perform the reorganization
+	// and consume the approval.
+	if err := chain.ReconsiderBlock(branch1Blocks[1].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != *branch1Blocks[2].Hash() {
+		t.Fatalf("best chain tip not moved to approved branch -- got "+
+			"%v, want %v", best.Hash, branch1Blocks[2].Hash())
+	}
+	if len(deepReorgs) != 1 {
+		t.Fatalf("unexpected deep reorg notifications after approval "+
+			"-- got %d, want 1", len(deepReorgs))
+	}
+	if len(chain.approvedReorgs) != 0 {
+		t.Fatalf("approvals not consumed by the reorganization -- got %d",
+			len(chain.approvedReorgs))
+	}
+}
+
+// TestApprovedReorgsLimit ensures the number of approved reorganizations is
+// limited.
+func TestApprovedReorgsLimit(t *testing.T) {
+	// Construct a synthetic block chain with a side chain that has less
+	// work than the main chain so approving its blocks does not cause a
+	// reorganization.
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedNodes(chain.bestChain.Genesis(),
+		maxApprovedReorgs+2)
+	branch1Nodes := chainedNodes(chain.bestChain.Genesis(),
+		maxApprovedReorgs+1)
+	for _, node := range branch0Nodes {
+		chain.index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.SetStatusFlags(node, statusDataStored)
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tstTip(branch0Nodes))
+
+	for _, node := range branch1Nodes {
+		if err := chain.ReconsiderBlock(&node.hash); err != nil {
+			t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+		}
+		if len(chain.approvedReorgs) > maxApprovedReorgs {
+			t.Fatalf("too many approvals -- got %d, want at most %d",
+				len(chain.approvedReorgs), maxApprovedReorgs)
+		}
+		if _, ok := chain.approvedReorgs[node.hash]; !ok {
+			t.Fatalf("block %v not approved", node.hash)
+		}
+	}
+
+	// Approving an already approved block must not evict another one.
+	tip := tstTip(branch1Nodes)
+	if err := chain.ReconsiderBlock(&tip.hash); err != nil {
+		t.Fatalf("ReconsiderBlock: unexpected error: %v", err)
+	}
+	if len(chain.approvedReorgs) != maxApprovedReorgs {
+		t.Fatalf("unexpected number of approvals -- got %d, want %d",
+			len(chain.approvedReorgs), maxApprovedReorgs)
+	}
+}
+
+// TestForEachUtxo ensures ForEachUtxo iterates every entry of the utxo set and
+// stops at the first error returned by the callback.
+func TestForEachUtxo(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("foreachutxo",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Add the outputs of a couple of transactions to the utxo set.
+	view := NewUtxoViewpoint()
+	want := make(map[wire.OutPoint]int64)
+	for i := 0; i < 2; i++ {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: uint32(i)},
+		})
+		for j := 0; j < 3; j++ {
+			value := int64(1000*i + j + 1)
+			msgTx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+		}
+		for j, txOut := range msgTx.TxOut {
+			outpoint := wire.OutPoint{Hash: msgTx.TxHash(), Index: uint32(j)}
+			want[outpoint] = txOut.Value
+		}
+		view.AddTxOuts(btcutil.NewTx(msgTx), int32(i+1))
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatalf("Failed to store utxos: %v", err)
+	}
+
+	got := make(map[wire.OutPoint]int64)
+	best, err := chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *UtxoEntry) error {
+		got[outpoint] = entry.Amount()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachUtxo: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ForEachUtxo: mismatched utxos -- got %v, want %v",
+			got, want)
+	}
+	if best.Hash != *chaincfg.RegressionNetParams.GenesisHash {
+		t.Fatalf("ForEachUtxo: unexpected best block %v", best.Hash)
+	}
+
+	// Ensure iteration stops at the first error.
+	errStop := errors.New("stop")
+	var visited int
+	_, err = chain.ForEachUtxo(func(wire.OutPoint, *UtxoEntry) error {
+		visited++
+		return errStop
+	})
+	if err != errStop || visited != 1 {
+		t.Fatalf("ForEachUtxo: unexpected stop -- got err %v after %d "+
+			"entries, want %v after 1", err, visited, errStop)
+	}
+}
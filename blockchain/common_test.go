@@ -367,6 +367,7 @@ func newFakeChain(params *chaincfg.Params) *BlockChain {
 		bestChain:           newChainView(node),
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
+		approvedReorgs:      make(map[chainhash.Hash]struct{}),
 	}
 
 	for _, deployment := range params.Deployments {
@@ -396,3 +397,67 @@ func newFakeNode(parent *blockNode, blockVersion int32, bits uint32, timestamp t
 	}
 	return newBlockNode(header, parent)
 }
+
+// newSolvedBlock returns a solved block containing only a coinbase transaction
+// that extends the passed parent block at the passed height.  The extra nonce
+// is included in the coinbase so blocks at the same height on different
+// branches are unique.  Only networks with a trivial proof of work limit such
+// as the regression test network are practical.
+func newSolvedBlock(params *chaincfg.Params, parent *wire.MsgBlock,
+	height int32, extraNonce uint64) *btcutil.Block {
+
+	// Use a timestamp that is one second after the parent unless it is
+	// the genesis block in which case the current time is used.
+	ts := parent.Header.Timestamp.Add(time.Second)
+	if height == 1 {
+		ts = time.Unix(time.Now().Unix(), 0)
+	}
+	return newSolvedBlockAt(params, parent, height, extraNonce, ts,
+		params.PowLimitBits)
+}
+
+// newSolvedBlockAt is like newSolvedBlock except the block has the passed
+// timestamp and difficulty bits.
+func newSolvedBlockAt(params *chaincfg.Params, parent *wire.MsgBlock,
+	height int32, extraNonce uint64, ts time.Time,
+	bits uint32) *btcutil.Block {
+
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(int64(extraNonce)).Script()
+	if err != nil {
+		panic(err)
+	}
+	coinbaseTx := wire.NewMsgTx(wire.TxVersion)
+	coinbaseTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		Sequence:        wire.MaxTxInSequenceNum,
+		SignatureScript: coinbaseScript,
+	})
+	coinbaseTx.AddTxOut(&wire.TxOut{
+		Value:    CalcBlockSubsidy(height, params),
+		PkScript: []byte{txscript.OP_TRUE},
+	})
+
+	block := wire.NewMsgBlock(&wire.BlockHeader{
+		Version:   1,
+		PrevBlock: parent.BlockHash(),
+		Timestamp: ts,
+		Bits:      bits,
+	})
+	block.AddTransaction(coinbaseTx)
+	merkles := BuildMerkleTreeStore(btcutil.NewBlock(block).Transactions(),
+		false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	target := CompactToBig(block.Header.Bits)
+	for {
+		hash := block.Header.BlockHash()
+		if HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		block.Header.Nonce++
+	}
+
+	return btcutil.NewBlock(block)
+}
@@ -224,6 +224,11 @@ const (
 	// ErrMalformedPosCommitment indicates that transaction pos commitment did
 	// not match provided data
 	ErrMalformedPosCommitment
+
+	// ErrReorgTooDeep indicates a block would cause a reorganization that
+	// disconnects more blocks than the configured maximum reorg depth and
+	// the new branch has not been approved via ReconsiderBlock.
+	ErrReorgTooDeep
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -272,6 +277,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
 	ErrMalformedPosCommitment:    "ErrMalformedPosCommitment",
+	ErrReorgTooDeep:              "ErrReorgTooDeep",
 }
 
 // String returns the ErrorCode as a human-readable name.
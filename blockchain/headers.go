@@ -0,0 +1,118 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// HeaderNode is a block header which has passed the checks of CheckBlockHeader
+// without its block having been added to the block chain.  It allows the
+// headers which connect to it to be checked ahead of their blocks, such as
+// during a headers-first sync.
+type HeaderNode struct {
+	node *blockNode
+
+	// depth is the number of ancestors of the node which are only known
+	// to header nodes rather than the block index.
+	depth int32
+}
+
+// Height returns the height of the header.
+func (h *HeaderNode) Height() int32 {
+	return h.node.height
+}
+
+// Hash returns the hash of the header.
+func (h *HeaderNode) Hash() *chainhash.Hash {
+	return &h.node.hash
+}
+
+// headerContextDepth returns the number of ancestors of a header which the
+// checks of the header connecting to it may look at.  The difficulty retarget
+// rules look back the furthest, over a full retarget interval, followed by the
+// median time of the last several blocks.
+func (b *BlockChain) headerContextDepth() int32 {
+	return b.blocksPerRetarget + medianTimeBlocks
+}
+
+// copyHeaderNodes returns a copy of the passed node along with the passed
+// number of its ancestors, of which the oldest has no parent.
+func copyHeaderNodes(node *blockNode, numAncestors int32) *blockNode {
+	nodes := make([]blockNode, numAncestors+1)
+	for i := range nodes {
+		nodes[i] = *node
+		node = node.parent
+	}
+	for i := 0; i < len(nodes)-1; i++ {
+		nodes[i].parent = &nodes[i+1]
+	}
+	nodes[len(nodes)-1].parent = nil
+	return &nodes[0]
+}
+
+// CheckBlockHeader ensures the passed header connects to the passed previous
+// header, or to a block in the block index when it is nil, and passes all of
+// the checks performed on the header when its block is processed.  These are
+// the proof of work, timestamp, difficulty, checkpoint and version checks.  It
+// returns a header node which the headers connecting to the header can be
+// checked against.
+//
+// Header nodes only keep as many of their ancestors as the checks need, so
+// checking a long chain of headers does not hold all of them in memory.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckBlockHeader(header *wire.BlockHeader, prev *HeaderNode) (*HeaderNode, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+		b.timeSource, BFNone)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevNode *blockNode
+	var depth int32
+	switch {
+	case prev == nil:
+		prevHash := &header.PrevBlock
+		prevNode = b.index.LookupNode(prevHash)
+		if prevNode == nil {
+			str := fmt.Sprintf("previous block %s is unknown", prevHash)
+			return nil, ruleError(ErrPreviousBlockUnknown, str)
+		} else if b.index.NodeStatus(prevNode).KnownInvalid() {
+			str := fmt.Sprintf("previous block %s is known to be "+
+				"invalid", prevHash)
+			return nil, ruleError(ErrInvalidAncestorBlock, str)
+		}
+
+	case header.PrevBlock != prev.node.hash:
+		str := fmt.Sprintf("previous block %s is not the previous "+
+			"header %s", header.PrevBlock, prev.node.hash)
+		return nil, ruleError(ErrPreviousBlockUnknown, str)
+
+	default:
+		prevNode = prev.node
+		depth = prev.depth + 1
+	}
+
+	err = b.checkBlockHeaderContext(header, prevNode, BFNone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Continue the ancestors only known to header nodes from a copy of the
+	// ones the checks need once there are twice as many of them, so the
+	// older ones can be garbage collected.
+	if contextDepth := b.headerContextDepth(); depth >= 2*contextDepth {
+		prevNode = copyHeaderNodes(prevNode, contextDepth)
+		depth = contextDepth + 1
+	}
+	return &HeaderNode{node: newBlockNode(header, prevNode), depth: depth}, nil
+}
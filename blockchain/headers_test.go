@@ -0,0 +1,174 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// TestCheckBlockHeader ensures headers are checked ahead of their blocks the
+// same way they are when the blocks are processed, and that the header nodes
+// do not keep all of their ancestors.
+func TestCheckBlockHeader(t *testing.T) {
+	// Use a short retarget interval so the headers cross several
+	// difficulty retargets and the ancestors of the header nodes are
+	// pruned.
+	params := chaincfg.RegressionNetParams
+	params.TargetTimespan = params.TargetTimePerBlock * 10
+	chain, teardownFunc, err := chainSetup("checkblockheader", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Check the headers of a chain of blocks spaced at the target time per
+	// block using the difficulty required by the headers before them.
+	const numBlocks = 100
+	parent := params.GenesisBlock
+	prevNode := chain.bestChain.Tip()
+	var prev *HeaderNode
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	for height := int32(1); height <= numBlocks; height++ {
+		ts := parent.Header.Timestamp.Add(params.TargetTimePerBlock)
+		bits, err := chain.calcNextRequiredDifficulty(prevNode, ts)
+		if err != nil {
+			t.Fatalf("calcNextRequiredDifficulty: %v", err)
+		}
+		block := newSolvedBlockAt(&params, parent, height, 0, ts, bits)
+		prev, err = chain.CheckBlockHeader(&block.MsgBlock().Header, prev)
+		if err != nil {
+			t.Fatalf("header %d: unexpected error: %v", height, err)
+		}
+		if prev.Height() != height || !prev.Hash().IsEqual(block.Hash()) {
+			t.Fatalf("header %d: got height %d and hash %v, want "+
+				"height %d and hash %v", height, prev.Height(),
+				prev.Hash(), height, block.Hash())
+		}
+
+		blocks = append(blocks, block)
+		parent = block.MsgBlock()
+		prevNode = prev.node
+	}
+	if parent.Header.Bits == params.PowLimitBits {
+		t.Fatal("headers did not cross a difficulty retarget")
+	}
+
+	// Only the ancestors needed by the checks are kept.
+	numAncestors := int32(0)
+	for node := prev.node.parent; node != nil; node = node.parent {
+		numAncestors++
+	}
+	if maxAncestors := 2 * chain.headerContextDepth(); numAncestors > maxAncestors {
+		t.Fatalf("header node keeps %d ancestors, want at most %d",
+			numAncestors, maxAncestors)
+	}
+
+	// The blocks of the checked headers are accepted by the chain.
+	for _, block := range blocks {
+		isMainChain, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %d: unexpected error: %v",
+				block.Height(), err)
+		}
+		if !isMainChain {
+			t.Fatalf("block %d is not on the main chain",
+				block.Height())
+		}
+	}
+
+	// newHeader returns a header building on the passed block with the
+	// passed timestamp and difficulty bits which is solved unless
+	// requested otherwise.
+	tip := chain.bestChain.Tip()
+	nextTime := time.Unix(tip.timestamp, 0).Add(params.TargetTimePerBlock)
+	nextBits, err := chain.calcNextRequiredDifficulty(tip, nextTime)
+	if err != nil {
+		t.Fatalf("calcNextRequiredDifficulty: %v", err)
+	}
+	newHeader := func(prevHash chainhash.Hash, ts time.Time, bits uint32,
+		solved bool) *wire.BlockHeader {
+
+		header := &wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prevHash,
+			Timestamp: ts,
+			Bits:      bits,
+		}
+		target := CompactToBig(bits)
+		for {
+			hash := header.BlockHash()
+			if (HashToBig(&hash).Cmp(target) <= 0) == solved {
+				return header
+			}
+			header.Nonce++
+		}
+	}
+
+	tests := []struct {
+		name   string
+		header *wire.BlockHeader
+		prev   *HeaderNode
+		want   ErrorCode
+	}{
+		{
+			name: "unknown previous block",
+			header: newHeader(chainhash.Hash{0x01}, nextTime,
+				nextBits, true),
+			want: ErrPreviousBlockUnknown,
+		},
+		{
+			name: "not the previous header",
+			header: newHeader(*blocks[numBlocks-2].Hash(), nextTime,
+				nextBits, true),
+			prev: prev,
+			want: ErrPreviousBlockUnknown,
+		},
+		{
+			name:   "high hash",
+			header: newHeader(tip.hash, nextTime, nextBits, false),
+			want:   ErrHighHash,
+		},
+		{
+			name: "unexpected difficulty",
+			header: newHeader(tip.hash, nextTime,
+				params.PowLimitBits, true),
+			want: ErrUnexpectedDifficulty,
+		},
+		{
+			name: "timestamp before median time",
+			header: newHeader(tip.hash, tip.CalcPastMedianTime(),
+				nextBits, true),
+			want: ErrTimeTooOld,
+		},
+		{
+			name: "timestamp too far in the future",
+			header: newHeader(tip.hash,
+				time.Unix(time.Now().Unix(), 0).Add(3*time.Hour),
+				nextBits, true),
+			want: ErrTimeTooNew,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := chain.CheckBlockHeader(test.header, test.prev)
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != test.want {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.want)
+		}
+	}
+
+	// A valid header connecting to the tip passes.
+	header := newHeader(tip.hash, nextTime, nextBits, true)
+	if _, err := chain.CheckBlockHeader(header, nil); err != nil {
+		t.Fatalf("valid header: unexpected error: %v", err)
+	}
+}
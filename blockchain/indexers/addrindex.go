@@ -63,6 +63,12 @@ const (
 	// script template, as well as a 32-byte data push.
 	addrKeyTypeWitnessScriptHash = 3
 
+	// addrKeyTypeTaprootPubKey is the address type in an address key which
+	// represents a pay-to-taproot address.  This is required as the
+	// 32-byte output key of a taproot witness program may be the same data
+	// push used in a p2wsh witness program.
+	addrKeyTypeTaprootPubKey = 4
+
 	// Size of a transaction entry.  It consists of 4 bytes block id + 4
 	// bytes offset + 4 bytes length.
 	txEntrySize = 4 + 4 + 4
@@ -573,6 +579,16 @@ func addrToKey(addr btcutil.Address) ([addrKeySize]byte, error) {
 		result[0] = addrKeyTypeWitnessPubKeyHash
 		copy(result[1:], addr.Hash160()[:])
 		return result, nil
+
+	case *btcutil.AddressTaproot:
+		var result [addrKeySize]byte
+		result[0] = addrKeyTypeTaprootPubKey
+
+		// Taproot outputs are actually just the 32-byte public key.
+		// Similar to the P2WSH case, we'll compress the key down to
+		// 20-bytes using the hash160.
+		copy(result[1:], btcutil.Hash160(addr.ScriptAddress()))
+		return result, nil
 	}
 
 	return [addrKeySize]byte{}, errUnsupportedAddressType
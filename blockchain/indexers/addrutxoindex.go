@@ -0,0 +1,713 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// addrUtxoIndexName is the human-readable name for the index.
+	addrUtxoIndexName = "address utxo index"
+
+	// addrUtxoKeySize is the number of bytes an unspent output key
+	// consumes in the index.  It consists of the address key + 32 bytes
+	// transaction hash + 4 bytes output index.
+	addrUtxoKeySize = addrKeySize + chainhash.HashSize + 4
+
+	// addrDeltaKeySize is the number of bytes a delta key consumes in the
+	// index.  It consists of the address key + 4 bytes block height + 4
+	// bytes transaction index + 1 byte direction + 4 bytes input or output
+	// index.
+	addrDeltaKeySize = addrKeySize + 4 + 4 + 1 + 4
+
+	// addrBalanceEntrySize is the size of a serialized balance entry.  It
+	// consists of 8 bytes balance + 8 bytes total received.
+	addrBalanceEntrySize = 8 + 8
+
+	// addrUtxoEntryHeaderSize is the size of a serialized unspent output
+	// entry excluding the public key script.  It consists of 8 bytes amount
+	// + 4 bytes block height + 1 byte flags.
+	addrUtxoEntryHeaderSize = 8 + 4 + 1
+
+	// addrDeltaEntrySize is the size of a serialized delta entry.  It
+	// consists of 32 bytes transaction hash + 8 bytes amount.
+	addrDeltaEntrySize = chainhash.HashSize + 8
+
+	// addrUtxoFlagCoinBase is the flag set in an unspent output entry when
+	// the output was created by a coinbase transaction.
+	addrUtxoFlagCoinBase = 0x01
+)
+
+var (
+	// addrUtxoIndexKey is the key of the address utxo index and the db
+	// bucket used to house it.
+	addrUtxoIndexKey = []byte("utxobyaddridx")
+
+	// addrBalanceBucketName is the name of the sub-bucket which houses the
+	// current balance of each address.
+	addrBalanceBucketName = []byte("balance")
+
+	// addrUtxoBucketName is the name of the sub-bucket which houses the
+	// unspent outputs of each address.
+	addrUtxoBucketName = []byte("utxo")
+
+	// addrDeltaBucketName is the name of the sub-bucket which houses every
+	// change to the balance of each address.
+	addrDeltaBucketName = []byte("delta")
+
+	// keyOrder is the byte order used for numeric fields in keys.  Big
+	// endian is used so cursor iteration visits entries in numeric order.
+	keyOrder = binary.BigEndian
+)
+
+// -----------------------------------------------------------------------------
+// The address utxo index is a companion to the address index which tracks the
+// unspent outputs, current balance, and every change to the balance of each
+// address.  Unlike the address index, it only needs the spend journal to be
+// maintained and thus does not rely on the transaction index.
+//
+// Only outputs whose public key script pays to exactly one address of a type
+// supported by the address index are tracked.  In particular, bare multisig
+// outputs are not attributed to any of their addresses since there is no
+// sensible way to split the value between them.  Pay-to-pubkey outputs are
+// attributed to the associated pubkey hash address as in the address index.
+//
+// The index consists of three sub-buckets.
+//
+// The balance bucket maps each address key to its current balance and the
+// total amount ever received by it:
+//
+//   <addr key> -> <balance><received>
+//
+//   Field           Type      Size
+//   addr key        [21]byte  21 bytes
+//   balance         int64     8 bytes
+//   received        int64     8 bytes
+//
+// The utxo bucket contains an entry for each unspent output:
+//
+//   <addr key><tx hash><output index> -> <amount><height><flags><pk script>
+//
+//   Field           Type      Size
+//   addr key        [21]byte  21 bytes
+//   tx hash         hash      32 bytes
+//   output index    uint32    4 bytes (big endian)
+//   amount          int64     8 bytes
+//   height          int32     4 bytes
+//   flags           uint8     1 byte (bit 0 set for coinbase outputs)
+//   pk script       []byte    variable
+//
+// The delta bucket contains an entry for each output created or spent:
+//
+//   <addr key><height><tx index><direction><index> -> <tx hash><amount>
+//
+//   Field           Type      Size
+//   addr key        [21]byte  21 bytes
+//   height          int32     4 bytes (big endian)
+//   tx index        uint32    4 bytes (big endian)
+//   direction       uint8     1 byte (0 for inputs, 1 for outputs)
+//   index           uint32    4 bytes (big endian)
+//   tx hash         hash      32 bytes
+//   amount          int64     8 bytes
+//
+// The numeric fields of the keys are big endian so the entries for an address
+// are ordered by height and then by position within the block, with the inputs
+// of each transaction before its outputs.
+// -----------------------------------------------------------------------------
+
+// AddrUtxo describes an unspent output paying to an address as tracked by the
+// address utxo index.
+type AddrUtxo struct {
+	OutPoint   wire.OutPoint
+	Amount     int64
+	PkScript   []byte
+	Height     int32
+	IsCoinBase bool
+}
+
+// AddrDelta describes a change to the balance of an address made by either
+// creating an output paying to it or by spending such an output.
+type AddrDelta struct {
+	TxHash     chainhash.Hash
+	Height     int32
+	BlockIndex uint32
+	Index      uint32
+	Spending   bool
+
+	// Amount is the change to the balance of the address, so it is
+	// negative when Spending is set.
+	Amount int64
+}
+
+// addrUtxoKey returns the key for an unspent output in the utxo bucket.
+func addrUtxoKey(addrKey [addrKeySize]byte, outpoint wire.OutPoint) []byte {
+	key := make([]byte, addrUtxoKeySize)
+	copy(key, addrKey[:])
+	copy(key[addrKeySize:], outpoint.Hash[:])
+	keyOrder.PutUint32(key[addrKeySize+chainhash.HashSize:], outpoint.Index)
+	return key
+}
+
+// serializeAddrUtxoEntry serializes the provided unspent output according to
+// the format described in detail above.
+func serializeAddrUtxoEntry(amount int64, height int32, isCoinBase bool,
+	pkScript []byte) []byte {
+
+	serialized := make([]byte, addrUtxoEntryHeaderSize+len(pkScript))
+	byteOrder.PutUint64(serialized, uint64(amount))
+	byteOrder.PutUint32(serialized[8:], uint32(height))
+	if isCoinBase {
+		serialized[12] |= addrUtxoFlagCoinBase
+	}
+	copy(serialized[addrUtxoEntryHeaderSize:], pkScript)
+	return serialized
+}
+
+// deserializeAddrUtxoEntry decodes the passed key and value from the utxo bucket
+// into an unspent output.
+func deserializeAddrUtxoEntry(key, serialized []byte) (*AddrUtxo, error) {
+	if len(key) != addrUtxoKeySize {
+		return nil, errDeserialize("unexpected utxo key length")
+	}
+	if len(serialized) < addrUtxoEntryHeaderSize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	var utxo AddrUtxo
+	copy(utxo.OutPoint.Hash[:], key[addrKeySize:])
+	utxo.OutPoint.Index = keyOrder.Uint32(key[addrKeySize+chainhash.HashSize:])
+	utxo.Amount = int64(byteOrder.Uint64(serialized))
+	utxo.Height = int32(byteOrder.Uint32(serialized[8:]))
+	utxo.IsCoinBase = serialized[12]&addrUtxoFlagCoinBase != 0
+	utxo.PkScript = make([]byte, len(serialized)-addrUtxoEntryHeaderSize)
+	copy(utxo.PkScript, serialized[addrUtxoEntryHeaderSize:])
+	return &utxo, nil
+}
+
+// addrDeltaKey returns the key for a balance change in the delta bucket.
+func addrDeltaKey(addrKey [addrKeySize]byte, height int32, txIdx int,
+	spending bool, index uint32) []byte {
+
+	key := make([]byte, addrDeltaKeySize)
+	copy(key, addrKey[:])
+	keyOrder.PutUint32(key[addrKeySize:], uint32(height))
+	keyOrder.PutUint32(key[addrKeySize+4:], uint32(txIdx))
+	if !spending {
+		key[addrKeySize+8] = 1
+	}
+	keyOrder.PutUint32(key[addrKeySize+9:], index)
+	return key
+}
+
+// serializeAddrDeltaEntry serializes the provided balance change according to
+// the format described in detail above.
+func serializeAddrDeltaEntry(txHash *chainhash.Hash, amount int64) []byte {
+	serialized := make([]byte, addrDeltaEntrySize)
+	copy(serialized, txHash[:])
+	byteOrder.PutUint64(serialized[chainhash.HashSize:], uint64(amount))
+	return serialized
+}
+
+// deserializeAddrDeltaEntry decodes the passed key and value from the delta
+// bucket into a balance change.
+func deserializeAddrDeltaEntry(key, serialized []byte) (*AddrDelta, error) {
+	if len(key) != addrDeltaKeySize {
+		return nil, errDeserialize("unexpected delta key length")
+	}
+	if len(serialized) < addrDeltaEntrySize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	var delta AddrDelta
+	delta.Height = int32(keyOrder.Uint32(key[addrKeySize:]))
+	delta.BlockIndex = keyOrder.Uint32(key[addrKeySize+4:])
+	delta.Spending = key[addrKeySize+8] == 0
+	delta.Index = keyOrder.Uint32(key[addrKeySize+9:])
+	copy(delta.TxHash[:], serialized)
+	delta.Amount = int64(byteOrder.Uint64(serialized[chainhash.HashSize:]))
+	if delta.Spending {
+		delta.Amount = -delta.Amount
+	}
+	return &delta, nil
+}
+
+// addrBalanceChange tracks the net change to the balance of an address made by
+// a block so each balance entry is only updated once per block.
+type addrBalanceChange struct {
+	balance  int64
+	received int64
+}
+
+// dbApplyAddrBalanceChanges adds the provided changes to the balance entries in
+// the passed bucket.  Entries that end up with nothing ever received, which
+// only happens when disconnecting blocks, are removed.
+func dbApplyAddrBalanceChanges(bucket database.Bucket,
+	changes map[[addrKeySize]byte]*addrBalanceChange) error {
+
+	for addrKey, change := range changes {
+		var balance, received int64
+		serialized := bucket.Get(addrKey[:])
+		if serialized != nil {
+			if len(serialized) < addrBalanceEntrySize {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt balance "+
+						"entry for address key %x", addrKey),
+				}
+			}
+			balance = int64(byteOrder.Uint64(serialized))
+			received = int64(byteOrder.Uint64(serialized[8:]))
+		}
+
+		balance += change.balance
+		received += change.received
+		if balance < 0 || received < 0 {
+			return AssertError(fmt.Sprintf("negative balance for "+
+				"address key %x", addrKey))
+		}
+		if received == 0 {
+			if err := bucket.Delete(addrKey[:]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		serialized = make([]byte, addrBalanceEntrySize)
+		byteOrder.PutUint64(serialized, uint64(balance))
+		byteOrder.PutUint64(serialized[8:], uint64(received))
+		if err := bucket.Put(addrKey[:], serialized); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddrUtxoIndex implements an index of the unspent outputs, balance, and balance
+// changes of each address.  It complements the AddrIndex, which only maps
+// addresses to the transactions involving them, so that balances and spendable
+// outputs can be queried without reconstructing them from every transaction.
+//
+// Unconfirmed transactions are not tracked by this index.  Callers are expected
+// to combine its results with the unconfirmed (memory-only) portion of the
+// AddrIndex when mempool data is desired.
+type AddrUtxoIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the AddrUtxoIndex type implements the Indexer interface.
+var _ Indexer = (*AddrUtxoIndex)(nil)
+
+// Ensure the AddrUtxoIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*AddrUtxoIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *AddrUtxoIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Key() []byte {
+	return addrUtxoIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Name() string {
+	return addrUtxoIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the address
+// utxo index along with its balance, utxo, and delta sub-buckets.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Create(dbTx database.Tx) error {
+	bucket, err := dbTx.Metadata().CreateBucket(addrUtxoIndexKey)
+	if err != nil {
+		return err
+	}
+
+	bucketNames := [][]byte{addrBalanceBucketName, addrUtxoBucketName,
+		addrDeltaBucketName}
+	for _, bucketName := range bucketNames {
+		if _, err := bucket.CreateBucket(bucketName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pkScriptAddrKey returns the address key the passed public key script pays to
+// along with whether or not the script is tracked by the index.  Only scripts
+// which pay to exactly one supported address are tracked.
+func (idx *AddrUtxoIndex) pkScriptAddrKey(pkScript []byte) ([addrKeySize]byte, bool) {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		idx.chainParams)
+	if err != nil || len(addrs) != 1 {
+		return [addrKeySize]byte{}, false
+	}
+
+	addrKey, err := addrToKey(addrs[0])
+	if err != nil {
+		return [addrKeySize]byte{}, false
+	}
+	return addrKey, true
+}
+
+// PkScriptPaysToAddr returns whether or not the passed public key script is
+// attributed to the given address by the index.  This allows callers to apply
+// the same rules as the index to transactions which are not yet confirmed.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) PkScriptPaysToAddr(pkScript []byte, addr btcutil.Address) bool {
+	wantKey, err := addrToKey(addr)
+	if err != nil {
+		return false
+	}
+	addrKey, ok := idx.pkScriptAddrKey(pkScript)
+	return ok && addrKey == wantKey
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer removes the outputs spent by the
+// block from the unspent outputs of their addresses, adds the outputs created
+// by it, and records the resulting balance changes.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	utxoBucket := bucket.Bucket(addrUtxoBucketName)
+	deltaBucket := bucket.Bucket(addrDeltaBucketName)
+
+	height := block.Height()
+	changes := make(map[[addrKeySize]byte]*addrBalanceChange)
+	changeFor := func(addrKey [addrKeySize]byte) *addrBalanceChange {
+		change, ok := changes[addrKey]
+		if !ok {
+			change = &addrBalanceChange{}
+			changes[addrKey] = change
+		}
+		return change
+	}
+
+	stxoIndex := 0
+	for txIdx, tx := range block.Transactions() {
+		msgTx := tx.MsgTx()
+
+		// Coinbases do not reference any inputs.  Since the block is
+		// required to have already gone through full validation, it has
+		// already been proven on the first transaction in the block is
+		// a coinbase.
+		if txIdx != 0 {
+			for inIdx, txIn := range msgTx.TxIn {
+				stxo := &stxos[stxoIndex]
+				stxoIndex++
+
+				addrKey, ok := idx.pkScriptAddrKey(stxo.PkScript)
+				if !ok {
+					continue
+				}
+
+				key := addrUtxoKey(addrKey, txIn.PreviousOutPoint)
+				if err := utxoBucket.Delete(key); err != nil {
+					return err
+				}
+				key = addrDeltaKey(addrKey, height, txIdx, true,
+					uint32(inIdx))
+				err := deltaBucket.Put(key, serializeAddrDeltaEntry(
+					tx.Hash(), stxo.Amount))
+				if err != nil {
+					return err
+				}
+				changeFor(addrKey).balance -= stxo.Amount
+			}
+		}
+
+		for outIdx, txOut := range msgTx.TxOut {
+			addrKey, ok := idx.pkScriptAddrKey(txOut.PkScript)
+			if !ok {
+				continue
+			}
+
+			outpoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			err := utxoBucket.Put(addrUtxoKey(addrKey, outpoint),
+				serializeAddrUtxoEntry(txOut.Value, height,
+					txIdx == 0, txOut.PkScript))
+			if err != nil {
+				return err
+			}
+			key := addrDeltaKey(addrKey, height, txIdx, false,
+				uint32(outIdx))
+			err = deltaBucket.Put(key, serializeAddrDeltaEntry(
+				tx.Hash(), txOut.Value))
+			if err != nil {
+				return err
+			}
+			change := changeFor(addrKey)
+			change.balance += txOut.Value
+			change.received += txOut.Value
+		}
+	}
+
+	return dbApplyAddrBalanceChanges(bucket.Bucket(addrBalanceBucketName),
+		changes)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer restores the outputs spent by
+// the block, removes the outputs created by it, and removes the associated
+// balance changes.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	utxoBucket := bucket.Bucket(addrUtxoBucketName)
+	deltaBucket := bucket.Bucket(addrDeltaBucketName)
+
+	height := block.Height()
+	changes := make(map[[addrKeySize]byte]*addrBalanceChange)
+	changeFor := func(addrKey [addrKeySize]byte) *addrBalanceChange {
+		change, ok := changes[addrKey]
+		if !ok {
+			change = &addrBalanceChange{}
+			changes[addrKey] = change
+		}
+		return change
+	}
+
+	// Undo the transactions in reverse order so outputs which are both
+	// created and spent within the block are restored before they are
+	// removed.
+	stxoIndex := len(stxos)
+	transactions := block.Transactions()
+	for txIdx := len(transactions) - 1; txIdx >= 0; txIdx-- {
+		tx := transactions[txIdx]
+		msgTx := tx.MsgTx()
+
+		for outIdx, txOut := range msgTx.TxOut {
+			addrKey, ok := idx.pkScriptAddrKey(txOut.PkScript)
+			if !ok {
+				continue
+			}
+
+			outpoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			err := utxoBucket.Delete(addrUtxoKey(addrKey, outpoint))
+			if err != nil {
+				return err
+			}
+			key := addrDeltaKey(addrKey, height, txIdx, false,
+				uint32(outIdx))
+			if err := deltaBucket.Delete(key); err != nil {
+				return err
+			}
+			change := changeFor(addrKey)
+			change.balance -= txOut.Value
+			change.received -= txOut.Value
+		}
+
+		if txIdx == 0 {
+			continue
+		}
+		for inIdx := len(msgTx.TxIn) - 1; inIdx >= 0; inIdx-- {
+			stxoIndex--
+			stxo := &stxos[stxoIndex]
+
+			addrKey, ok := idx.pkScriptAddrKey(stxo.PkScript)
+			if !ok {
+				continue
+			}
+
+			prevOut := msgTx.TxIn[inIdx].PreviousOutPoint
+			err := utxoBucket.Put(addrUtxoKey(addrKey, prevOut),
+				serializeAddrUtxoEntry(stxo.Amount, stxo.Height,
+					stxo.IsCoinBase, stxo.PkScript))
+			if err != nil {
+				return err
+			}
+			key := addrDeltaKey(addrKey, height, txIdx, true,
+				uint32(inIdx))
+			if err := deltaBucket.Delete(key); err != nil {
+				return err
+			}
+			changeFor(addrKey).balance += stxo.Amount
+		}
+	}
+
+	return dbApplyAddrBalanceChanges(bucket.Bucket(addrBalanceBucketName),
+		changes)
+}
+
+// BalanceForAddress returns the current confirmed balance of the passed address
+// along with the total amount it has ever received.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) BalanceForAddress(addr btcutil.Address) (int64, int64, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var balance, received int64
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrBalanceBucketName)
+		serialized := bucket.Get(addrKey[:])
+		if serialized == nil {
+			return nil
+		}
+		if len(serialized) < addrBalanceEntrySize {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt balance entry "+
+					"for address key %x", addrKey),
+			}
+		}
+		balance = int64(byteOrder.Uint64(serialized))
+		received = int64(byteOrder.Uint64(serialized[8:]))
+		return nil
+	})
+	return balance, received, err
+}
+
+// UtxosForAddress returns all confirmed unspent outputs paying to the passed
+// address ordered by their outpoint.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) UtxosForAddress(addr btcutil.Address) ([]AddrUtxo, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var utxos []AddrUtxo
+	err = idx.db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrUtxoBucketName).Cursor()
+		for ok := cursor.Seek(addrKey[:]); ok; ok = cursor.Next() {
+			key := cursor.Key()
+			if !bytes.HasPrefix(key, addrKey[:]) {
+				break
+			}
+
+			utxo, err := deserializeAddrUtxoEntry(key, cursor.Value())
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("failed to "+
+						"deserialize utxo for address "+
+						"key %x: %v", addrKey, err),
+				}
+			}
+			utxos = append(utxos, *utxo)
+		}
+		return nil
+	})
+	return utxos, err
+}
+
+// DeltasForAddress returns the confirmed changes to the balance of the passed
+// address made by blocks with heights in the inclusive range from startHeight
+// to endHeight.  The results are ordered by height and then by their position
+// within the block.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) DeltasForAddress(addr btcutil.Address, startHeight,
+	endHeight int32) ([]AddrDelta, error) {
+
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	if endHeight < startHeight {
+		return nil, nil
+	}
+
+	var deltas []AddrDelta
+	err = idx.db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrDeltaBucketName).Cursor()
+		seekKey := make([]byte, addrKeySize+4)
+		copy(seekKey, addrKey[:])
+		keyOrder.PutUint32(seekKey[addrKeySize:], uint32(startHeight))
+		for ok := cursor.Seek(seekKey); ok; ok = cursor.Next() {
+			key := cursor.Key()
+			if !bytes.HasPrefix(key, addrKey[:]) {
+				break
+			}
+
+			delta, err := deserializeAddrDeltaEntry(key, cursor.Value())
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("failed to "+
+						"deserialize delta for address "+
+						"key %x: %v", addrKey, err),
+				}
+			}
+			if delta.Height > endHeight {
+				break
+			}
+			deltas = append(deltas, *delta)
+		}
+		return nil
+	})
+	return deltas, err
+}
+
+// NewAddrUtxoIndex returns a new instance of an indexer that is used to track
+// the unspent outputs, balance, and balance changes of all addresses in the
+// blockchain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewAddrUtxoIndex(db database.DB, chainParams *chaincfg.Params) *AddrUtxoIndex {
+	return &AddrUtxoIndex{
+		db:          db,
+		chainParams: chainParams,
+	}
+}
+
+// DropAddrUtxoIndex drops the address utxo index from the provided database if
+// it exists.
+func DropAddrUtxoIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, addrUtxoIndexKey, addrUtxoIndexName, interrupt)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/database"
+	_ "github.com/babylonchain-io/bbld/database/ffldb"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// TestAddrUtxoIndex ensures the address utxo index tracks the unspent outputs,
+// balances, and balance changes of addresses as blocks are connected and
+// disconnected.
+func TestAddrUtxoIndex(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.RegressionNetParams
+	dbPath := filepath.Join(os.TempDir(), "addrutxoindex_test")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	idx := NewAddrUtxoIndex(db, params)
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.Create(dbTx)
+	})
+	if err != nil {
+		t.Fatalf("unable to create index: %v", err)
+	}
+
+	// Create two addresses along with the scripts paying to them.
+	addrA, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	addrB, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	scriptA, _ := txscript.PayToAddrScript(addrA)
+	scriptB, _ := txscript.PayToAddrScript(addrB)
+
+	// The first block pays its coinbase to address A.
+	coinbase1 := wire.NewMsgTx(1)
+	coinbase1.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+	})
+	coinbase1.AddTxOut(wire.NewTxOut(5000, scriptA))
+	block1 := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase1},
+	})
+	block1.SetHeight(1)
+
+	// The second block spends the first coinbase to address B with change
+	// back to address A.
+	coinbase2 := wire.NewMsgTx(1)
+	coinbase2.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x01},
+	})
+	coinbase2.AddTxOut(wire.NewTxOut(5000, scriptB))
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase1.TxHash()},
+	})
+	spend.AddTxOut(wire.NewTxOut(3000, scriptB))
+	spend.AddTxOut(wire.NewTxOut(1900, scriptA))
+	block2 := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase2, spend},
+	})
+	block2.SetHeight(2)
+	stxos2 := []blockchain.SpentTxOut{{
+		Amount:     5000,
+		PkScript:   scriptA,
+		Height:     1,
+		IsCoinBase: true,
+	}}
+
+	connect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: %v", err)
+		}
+	}
+	disconnect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.DisconnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("DisconnectBlock: %v", err)
+		}
+	}
+	checkBalance := func(addr btcutil.Address, wantBalance, wantReceived int64) {
+		t.Helper()
+		balance, received, err := idx.BalanceForAddress(addr)
+		if err != nil {
+			t.Fatalf("BalanceForAddress: %v", err)
+		}
+		if balance != wantBalance || received != wantReceived {
+			t.Fatalf("balance of %v: got %d/%d, want %d/%d", addr,
+				balance, received, wantBalance, wantReceived)
+		}
+	}
+	checkUtxos := func(addr btcutil.Address, want []AddrUtxo) {
+		t.Helper()
+		utxos, err := idx.UtxosForAddress(addr)
+		if err != nil {
+			t.Fatalf("UtxosForAddress: %v", err)
+		}
+		if !reflect.DeepEqual(utxos, want) {
+			t.Fatalf("utxos of %v: got %+v, want %+v", addr, utxos,
+				want)
+		}
+	}
+
+	connect(block1, nil)
+	checkBalance(addrA, 5000, 5000)
+	checkBalance(addrB, 0, 0)
+	coinbase1Utxo := AddrUtxo{
+		OutPoint:   wire.OutPoint{Hash: coinbase1.TxHash()},
+		Amount:     5000,
+		PkScript:   scriptA,
+		Height:     1,
+		IsCoinBase: true,
+	}
+	checkUtxos(addrA, []AddrUtxo{coinbase1Utxo})
+
+	connect(block2, stxos2)
+	checkBalance(addrA, 1900, 6900)
+	checkBalance(addrB, 8000, 8000)
+	checkUtxos(addrA, []AddrUtxo{{
+		OutPoint: wire.OutPoint{Hash: spend.TxHash(), Index: 1},
+		Amount:   1900,
+		PkScript: scriptA,
+		Height:   2,
+	}})
+
+	// Ensure the deltas are reported in order and honor the height range.
+	deltas, err := idx.DeltasForAddress(addrA, 0, 2)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: %v", err)
+	}
+	wantDeltas := []AddrDelta{{
+		TxHash: coinbase1.TxHash(),
+		Height: 1,
+		Amount: 5000,
+	}, {
+		TxHash:     spend.TxHash(),
+		Height:     2,
+		BlockIndex: 1,
+		Spending:   true,
+		Amount:     -5000,
+	}, {
+		TxHash:     spend.TxHash(),
+		Height:     2,
+		BlockIndex: 1,
+		Index:      1,
+		Amount:     1900,
+	}}
+	if !reflect.DeepEqual(deltas, wantDeltas) {
+		t.Fatalf("deltas: got %+v, want %+v", deltas, wantDeltas)
+	}
+	deltas, err = idx.DeltasForAddress(addrA, 2, 2)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: %v", err)
+	}
+	if !reflect.DeepEqual(deltas, wantDeltas[1:]) {
+		t.Fatalf("ranged deltas: got %+v, want %+v", deltas,
+			wantDeltas[1:])
+	}
+
+	// Disconnecting the second block must restore the prior state.
+	disconnect(block2, stxos2)
+	checkBalance(addrA, 5000, 5000)
+	checkBalance(addrB, 0, 0)
+	checkUtxos(addrA, []AddrUtxo{coinbase1Utxo})
+	checkUtxos(addrB, nil)
+	deltas, err = idx.DeltasForAddress(addrB, 0, 2)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: %v", err)
+	}
+	if len(deltas) != 0 {
+		t.Fatalf("unexpected deltas after disconnect: %+v", deltas)
+	}
+}
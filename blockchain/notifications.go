@@ -6,6 +6,8 @@ package blockchain
 
 import (
 	"fmt"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 )
 
 // NotificationType represents the type of a notification message.
@@ -29,6 +31,11 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTDeepReorg indicates a block would have caused a reorganization
+	// deeper than the configured maximum reorg depth and the
+	// reorganization was refused.
+	NTDeepReorg
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +44,7 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTDeepReorg:         "NTDeepReorg",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,11 +61,36 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *btcutil.Block
 // 	- NTBlockConnected:    *btcutil.Block
 // 	- NTBlockDisconnected: *btcutil.Block
+// 	- NTDeepReorg:         *DeepReorg
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// DeepReorg describes a reorganization that was refused because it would have
+// disconnected more blocks than the configured maximum reorg depth.
+type DeepReorg struct {
+	// ForkHash and ForkHeight identify the common ancestor of the current
+	// main chain and the competing branch.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+
+	// OldTipHash and OldTipHeight identify the tip of the main chain which
+	// remains in place.
+	OldTipHash   chainhash.Hash
+	OldTipHeight int32
+
+	// NewTipHash and NewTipHeight identify the tip of the competing branch
+	// that has more cumulative work.
+	NewTipHash   chainhash.Hash
+	NewTipHeight int32
+
+	// Depth is the number of main chain blocks the reorganization would
+	// have disconnected and MaxDepth is the configured limit.
+	Depth    int32
+	MaxDepth int32
+}
+
 // Subscribe to block chain notifications. Registers a callback to be executed
 // when various events take place. See the documentation on Notification and
 // NotificationType for details on the types and contents of notifications.
@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sync"
 	"time"
 
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
 	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/txscript"
 	"github.com/babylonchain-io/bbld/wire"
 )
@@ -23,6 +27,14 @@ type txValidateItem struct {
 	sigHashes *txscript.TxSigHashes
 }
 
+// deferredSchnorrItem houses an input whose scripts executed successfully
+// along with the batch of BIP0340 signatures that were deferred during the
+// execution and still need to be verified.
+type deferredSchnorrItem struct {
+	item  *txValidateItem
+	batch *schnorr.BatchVerifier
+}
+
 // txValidator provides a type which asynchronously validates transaction
 // inputs.  It provides several channels for communication and a processing
 // function that is intended to be in run multiple goroutines.
@@ -34,6 +46,14 @@ type txValidator struct {
 	flags        txscript.ScriptFlags
 	sigCache     *txscript.SigCache
 	hashCache    *txscript.HashCache
+
+	// batchSchnorr defers the verification of BIP0340 signatures during
+	// script execution so they can be batch verified once all of the
+	// scripts have executed.  The deferred signatures are collected in
+	// deferred, which is protected by deferredMtx.
+	batchSchnorr bool
+	deferredMtx  sync.Mutex
+	deferred     []deferredSchnorrItem
 }
 
 // sendResult sends the result of a script pair validation on the internal
@@ -76,7 +96,7 @@ out:
 			inputAmount := utxo.Amount()
 			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
 				txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes,
-				inputAmount)
+				inputAmount, v.utxoView)
 			if err != nil {
 				str := fmt.Sprintf("failed to parse input "+
 					"%s:%d which references output %v - "+
@@ -90,6 +110,12 @@ out:
 				break out
 			}
 
+			var batch *schnorr.BatchVerifier
+			if v.batchSchnorr {
+				batch = schnorr.NewBatchVerifier()
+				vm.SetSchnorrBatchVerifier(batch)
+			}
+
 			// Execute the script pair.
 			if err := vm.Execute(); err != nil {
 				str := fmt.Sprintf("failed to validate input "+
@@ -104,6 +130,17 @@ out:
 				break out
 			}
 
+			// The scripts are only valid once any deferred
+			// signatures are verified as well.
+			if batch != nil && batch.Len() > 0 {
+				v.deferredMtx.Lock()
+				v.deferred = append(v.deferred, deferredSchnorrItem{
+					item:  txVI,
+					batch: batch,
+				})
+				v.deferredMtx.Unlock()
+			}
+
 			// Validation succeeded.
 			v.sendResult(nil)
 
@@ -171,6 +208,96 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 	return nil
 }
 
+// verifyDeferredSchnorr batch verifies the BIP0340 signatures that were
+// deferred while validating the scripts.  The deferred signatures are split
+// into one batch per processor core which are verified concurrently.  The
+// inputs of any batch that fails to verify are validated again without
+// batching in order to identify the input with the invalid signature.
+//
+// This must only be called after Validate returns without error.
+func (v *txValidator) verifyDeferredSchnorr() error {
+	if len(v.deferred) == 0 {
+		return nil
+	}
+
+	numBatches := runtime.NumCPU()
+	if numBatches <= 0 {
+		numBatches = 1
+	}
+	if numBatches > len(v.deferred) {
+		numBatches = len(v.deferred)
+	}
+	batchSize := (len(v.deferred) + numBatches - 1) / numBatches
+
+	var chunks [][]deferredSchnorrItem
+	for start := 0; start < len(v.deferred); start += batchSize {
+		end := start + batchSize
+		if end > len(v.deferred) {
+			end = len(v.deferred)
+		}
+		chunks = append(chunks, v.deferred[start:end])
+	}
+
+	valid := make([]bool, len(chunks))
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+	for i, chunk := range chunks {
+		go func(i int, chunk []deferredSchnorrItem) {
+			defer wg.Done()
+
+			batch := schnorr.NewBatchVerifier()
+			for _, deferred := range chunk {
+				batch.AddBatch(deferred.batch)
+			}
+			valid[i] = batch.Verify()
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	var failedItems []*txValidateItem
+	for i, chunk := range chunks {
+		if !valid[i] {
+			for _, deferred := range chunk {
+				failedItems = append(failedItems, deferred.item)
+			}
+			continue
+		}
+
+		// Cache the signatures of the verified batch the same way the
+		// engine does when it verifies them itself.
+		if v.sigCache == nil {
+			continue
+		}
+		for _, deferred := range chunk {
+			deferred.batch.ForEach(func(sig *schnorr.Signature,
+				hash []byte, pubKey *btcec.PublicKey) {
+
+				var sigHash chainhash.Hash
+				copy(sigHash[:], hash)
+				v.sigCache.AddSchnorr(sigHash, sig, pubKey)
+			})
+		}
+	}
+	if len(failedItems) == 0 {
+		return nil
+	}
+
+	// Validate the inputs of the failed batches individually to find the
+	// input with the invalid signature.
+	validator := newTxValidator(v.utxoView, v.flags, v.sigCache,
+		v.hashCache)
+	if err := validator.Validate(failedItems); err != nil {
+		return err
+	}
+
+	// This should never happen since the batch verification of valid
+	// signatures always succeeds.  The signatures are valid regardless, so
+	// don't reject the block over it.
+	log.Errorf("Batch verification of %d taproot inputs failed although "+
+		"each of their signatures is valid", len(failedItems))
+	return nil
+}
+
 // newTxValidator returns a new instance of txValidator to be used for
 // validating transaction scripts asynchronously.
 func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
@@ -201,7 +328,7 @@ func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	// amongst all worker validation goroutines.
 	if segwitActive && tx.MsgTx().HasWitness() &&
 		!hashCache.ContainsHashes(tx.Hash()) {
-		hashCache.AddSigHashes(tx.MsgTx())
+		hashCache.AddSigHashes(tx.MsgTx(), utxoView)
 	}
 
 	var cachedHashes *txscript.TxSigHashes
@@ -266,7 +393,7 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 		if segwitActive && tx.HasWitness() && hashCache != nil &&
 			!hashCache.ContainsHashes(hash) {
 
-			hashCache.AddSigHashes(tx.MsgTx())
+			hashCache.AddSigHashes(tx.MsgTx(), utxoView)
 		}
 
 		var cachedHashes *txscript.TxSigHashes
@@ -274,7 +401,9 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 			if hashCache != nil {
 				cachedHashes, _ = hashCache.GetSigHashes(hash)
 			} else {
-				cachedHashes = txscript.NewTxSigHashes(tx.MsgTx())
+				cachedHashes = txscript.NewTxSigHashes(
+					tx.MsgTx(), utxoView,
+				)
 			}
 		}
 
@@ -294,12 +423,20 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 		}
 	}
 
-	// Validate all of the inputs.
+	// Validate all of the inputs.  The taproot signatures that aren't in
+	// the signature cache are batch verified once all of the scripts have
+	// executed, which is considerably faster than verifying each of them
+	// individually.
 	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache)
+	validator.batchSchnorr = scriptFlags&txscript.ScriptVerifyTaproot ==
+		txscript.ScriptVerifyTaproot
 	start := time.Now()
 	if err := validator.Validate(txValItems); err != nil {
 		return err
 	}
+	if err := validator.verifyDeferredSchnorr(); err != nil {
+		return err
+	}
 	elapsed := time.Since(start)
 
 	log.Tracef("block %v took %v to verify", block.Hash(), elapsed)
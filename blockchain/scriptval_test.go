@@ -5,10 +5,18 @@
 package blockchain
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
 )
 
 // TestCheckBlockScripts ensures that validating the all of the scripts in a
@@ -46,3 +54,171 @@ func TestCheckBlockScripts(t *testing.T) {
 		return
 	}
 }
+
+// TestCheckBlockScriptsTaproot ensures that the taproot signatures of a block
+// are batch verified and cached, that a batch failing to verify valid
+// signatures doesn't reject them, and that an invalid signature is
+// attributed to the input it belongs to.
+func TestCheckBlockScriptsTaproot(t *testing.T) {
+	t.Parallel()
+
+	const numSpends = 40
+	const amount = 100000
+
+	// Create a transaction that funds a taproot output for each of the
+	// spends.
+	privKeys := make([]*btcec.PrivateKey, 0, numSpends)
+	outputKeys := make([]*btcec.PublicKey, 0, numSpends)
+	fundingTx := wire.NewMsgTx(wire.TxVersion)
+	fundingTx.AddTxIn(&wire.TxIn{})
+	for i := 0; i < numSpends; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		outputKey, err := txscript.ComputeTaprootKeyNoScript(
+			privKey.PubKey(),
+		)
+		if err != nil {
+			t.Fatalf("unable to compute output key: %v", err)
+		}
+		pkScript, err := txscript.PayToTaprootScript(outputKey)
+		if err != nil {
+			t.Fatalf("unable to create script: %v", err)
+		}
+
+		privKeys = append(privKeys, privKey)
+		outputKeys = append(outputKeys, outputKey)
+		fundingTx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	}
+	view := NewUtxoViewpoint()
+	view.AddTxOuts(btcutil.NewTx(fundingTx), 1)
+
+	// Create a block that spends each of the outputs in its own
+	// transaction.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: math.MaxUint32},
+		SignatureScript:  []byte{0x51, 0x51},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+	block := &wire.MsgBlock{Transactions: []*wire.MsgTx{coinbase}}
+	for i, privKey := range privKeys {
+		txOut := fundingTx.TxOut[i]
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{
+				Hash:  fundingTx.TxHash(),
+				Index: uint32(i),
+			},
+		})
+		tx.AddTxOut(wire.NewTxOut(amount-1000, []byte{txscript.OP_TRUE}))
+
+		sigHashes := txscript.NewTxSigHashes(tx, view)
+		witness, err := txscript.TaprootWitnessSignature(
+			tx, sigHashes, 0, txOut.Value, txOut.PkScript,
+			txscript.SigHashDefault, privKey,
+		)
+		if err != nil {
+			t.Fatalf("unable to sign input: %v", err)
+		}
+		tx.TxIn[0].Witness = witness
+
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	scriptFlags := txscript.ScriptBip16 | txscript.ScriptVerifyWitness |
+		txscript.ScriptVerifyTaproot
+	sigCache := txscript.NewSigCache(numSpends)
+	err := checkBlockScripts(btcutil.NewBlock(block), view, scriptFlags,
+		sigCache, nil)
+	if err != nil {
+		t.Fatalf("valid taproot block failed to validate: %v", err)
+	}
+
+	// The batch verified signatures must be added to the signature cache.
+	items := make([]*txValidateItem, 0, numSpends)
+	for i, tx := range block.Transactions[1:] {
+		sigHashes := txscript.NewTxSigHashes(tx, view)
+		sigHash, err := txscript.CalcTaprootSignatureHash(sigHashes,
+			txscript.SigHashDefault, tx, 0, view)
+		if err != nil {
+			t.Fatalf("unable to calculate sighash: %v", err)
+		}
+		sig, err := schnorr.ParseSignature(tx.TxIn[0].Witness[0])
+		if err != nil {
+			t.Fatalf("unable to parse signature: %v", err)
+		}
+		pubKey, err := schnorr.ParsePubKey(
+			schnorr.SerializePubKey(outputKeys[i]),
+		)
+		if err != nil {
+			t.Fatalf("unable to parse public key: %v", err)
+		}
+		var sigHashKey chainhash.Hash
+		copy(sigHashKey[:], sigHash)
+		if !sigCache.ExistsSchnorr(sigHashKey, sig, pubKey) {
+			t.Fatalf("signature of spend %d not cached", i)
+		}
+
+		items = append(items, &txValidateItem{
+			txInIndex: 0,
+			txIn:      tx.TxIn[0],
+			tx:        btcutil.NewTx(tx),
+			sigHashes: sigHashes,
+		})
+	}
+
+	// A batch that fails to verify although each of the signatures of its
+	// inputs is valid must not reject them.
+	badBatch := schnorr.NewBatchVerifier()
+	sigs, hashes, pubKeys := make([]*schnorr.Signature, 0, 2),
+		make([][]byte, 0, 2), make([]*btcec.PublicKey, 0, 2)
+	for _, item := range items[:2] {
+		prevOut := fundingTx.TxOut[item.txIn.PreviousOutPoint.Index]
+		sigHash, err := txscript.CalcTaprootSignatureHash(
+			item.sigHashes, txscript.SigHashDefault, item.tx.MsgTx(),
+			0, view)
+		if err != nil {
+			t.Fatalf("unable to calculate sighash: %v", err)
+		}
+		sig, err := schnorr.ParseSignature(item.txIn.Witness[0])
+		if err != nil {
+			t.Fatalf("unable to parse signature: %v", err)
+		}
+		pubKey, err := schnorr.ParsePubKey(prevOut.PkScript[2:])
+		if err != nil {
+			t.Fatalf("unable to parse public key: %v", err)
+		}
+		sigs = append(sigs, sig)
+		hashes = append(hashes, sigHash)
+		pubKeys = append(pubKeys, pubKey)
+	}
+	if err := badBatch.Add(sigs[0], hashes[1], pubKeys[1]); err != nil {
+		t.Fatalf("unable to add signature: %v", err)
+	}
+	validator := newTxValidator(view, scriptFlags, nil, nil)
+	validator.deferred = []deferredSchnorrItem{
+		{item: items[0], batch: badBatch},
+		{item: items[1], batch: badBatch},
+	}
+	if err := validator.verifyDeferredSchnorr(); err != nil {
+		t.Fatalf("valid signatures rejected after failed batch: %v",
+			err)
+	}
+
+	// Invalidate the signature of one of the spends, which must be
+	// reported as the input that failed to validate.
+	badTx := block.Transactions[numSpends/2+1]
+	badTx.TxIn[0].Witness[0][10] ^= 0x01
+	err = checkBlockScripts(btcutil.NewBlock(block), view, scriptFlags,
+		nil, nil)
+	var rerr RuleError
+	if !errors.As(err, &rerr) || rerr.ErrorCode != ErrScriptValidation {
+		t.Fatalf("unexpected error for invalid signature: %v", err)
+	}
+	wantInput := fmt.Sprintf("%s:0", badTx.TxHash())
+	if !strings.Contains(err.Error(), wantInput) {
+		t.Fatalf("error does not identify input %s: %v", wantInput, err)
+	}
+}
@@ -6,7 +6,9 @@ package blockchain
 
 import (
 	"testing"
+	"time"
 
+	"github.com/babylonchain-io/bbld/chaincfg"
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 )
 
@@ -316,3 +318,59 @@ func TestThresholdStateTransition(t *testing.T) {
 		}
 	}
 }
+
+// TestMainNetTaprootDeployment ensures the taproot deployment on the main
+// network can still be voted in by blocks mined today, and activates once the
+// blocks of a confirmation window signal for it.
+func TestMainNetTaprootDeployment(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	window := int32(chaincfg.MainNetParams.MinerConfirmationWindow)
+
+	// Extend the chain by the passed number of blocks using the block
+	// version the chain would mine.  The blocks are spaced at the target
+	// time per block ending around the current time.
+	targetTimePerBlock := chaincfg.MainNetParams.TargetTimePerBlock
+	tip := chain.bestChain.Tip()
+	timestamp := time.Unix(time.Now().Unix(), 0).Add(
+		-targetTimePerBlock * time.Duration(4*window))
+	extend := func(numBlocks int32) {
+		for i := int32(0); i < numBlocks; i++ {
+			version, err := chain.calcNextBlockVersion(tip)
+			if err != nil {
+				t.Fatalf("calcNextBlockVersion: unexpected error: %v",
+					err)
+			}
+			timestamp = timestamp.Add(targetTimePerBlock)
+			tip = newFakeNode(tip, version, tip.bits, timestamp)
+			chain.index.AddNode(tip)
+		}
+	}
+
+	// The state of the first window is defined, after which the blocks
+	// signal for the deployment until it is locked in and activated.
+	wantStates := []ThresholdState{
+		ThresholdDefined,
+		ThresholdStarted,
+		ThresholdLockedIn,
+		ThresholdActive,
+	}
+	for i, want := range wantStates {
+		state, err := chain.deploymentState(tip,
+			chaincfg.DeploymentTaproot)
+		if err != nil {
+			t.Fatalf("window %d: unexpected error: %v", i, err)
+		}
+		if state != want {
+			t.Fatalf("window %d: taproot deployment state %v, "+
+				"want %v", i, state, want)
+		}
+
+		// The first window is one block short since it includes the
+		// genesis block.
+		if i == 0 {
+			extend(window - 1)
+		} else {
+			extend(window)
+		}
+	}
+}
@@ -159,6 +159,23 @@ func (view *UtxoViewpoint) LookupEntry(outpoint wire.OutPoint) *UtxoEntry {
 	return view.entries[outpoint]
 }
 
+// FetchPrevOutput fetches the previous output referenced by the passed
+// outpoint.  It will return nil if the passed output does not exist in the
+// view.
+//
+// NOTE: This is part of the txscript.PrevOutputFetcher interface.
+func (view *UtxoViewpoint) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	prevOut := view.entries[op]
+	if prevOut == nil {
+		return nil
+	}
+
+	return &wire.TxOut{
+		Value:    prevOut.amount,
+		PkScript: prevOut.PkScript(),
+	}
+}
+
 // addTxOut adds the specified output to the view if it is not provably
 // unspendable.  When the view already has an entry for the output, it will be
 // marked unspent.  All fields will be updated for existing entries since it's
@@ -656,3 +673,65 @@ func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error)
 
 	return entry, nil
 }
+
+// ForEachUtxo calls the passed function with every unspent transaction output
+// in the utxo set as of the end of the main chain, in the byte-wise order of
+// their outpoint keys.  Iteration stops at the first error returned by the
+// function, and that error is returned.  Otherwise, the best state the utxo set
+// was iterated at is returned.
+//
+// The utxo set is iterated from a snapshot of the database, so the main chain
+// is free to advance while a potentially long iteration is in progress.
+//
+// This function is safe for concurrent access however the entries passed to
+// the function are NOT.
+func (b *BlockChain) ForEachUtxo(fn func(outpoint wire.OutPoint, entry *UtxoEntry) error) (*BestState, error) {
+	// Open the database transaction while holding the chain lock to ensure
+	// the snapshot it provides matches the best state.
+	b.chainLock.RLock()
+	best := b.BestSnapshot()
+	dbTx, err := b.db.Begin(false)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	err = utxoBucket.ForEach(func(k, v []byte) error {
+		// The key is the hash of the transaction followed by the
+		// VLQ-encoded index of the output.
+		if len(k) <= chainhash.HashSize {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt utxo key %x",
+					k),
+			}
+		}
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], k[:chainhash.HashSize])
+		index, _ := deserializeVLQ(k[chainhash.HashSize:])
+		outpoint.Index = uint32(index)
+
+		entry, err := deserializeUtxoEntry(v)
+		if err != nil {
+			// Ensure any deserialization errors are returned as
+			// database corruption errors.
+			if isDeserializeErr(err) {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt utxo "+
+						"entry for %v: %v", outpoint, err),
+				}
+			}
+			return err
+		}
+
+		return fn(outpoint, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return best, nil
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package ellswift implements the ElligatorSwift encoding of secp256k1 public
+// keys specified by BIP-324, which makes public keys indistinguishable from
+// uniformly random 64-byte strings, and x-only ECDH with encoded public keys.
+package ellswift
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/babylonchain-io/bbld/btcec"
+)
+
+// EncodedSize is the size of an ElligatorSwift encoded public key.
+const EncodedSize = 64
+
+// sqrtMinus3 is a square root of -3 modulo the field prime.
+var sqrtMinus3 = setHex("0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f852")
+
+// setHex returns the field value of the passed big endian hex string.  It is
+// only used to initialize constants.
+func setHex(s string) *btcec.FieldVal {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	var f btcec.FieldVal
+	f.SetByteSlice(b)
+	return f.Normalize()
+}
+
+// The following helpers return the normalized result of the field operation on
+// the passed normalized field values in a new field value, which keeps the
+// arithmetic below close to the BIP-324 reference code without having to
+// track magnitudes.
+
+func feInt(v uint16) *btcec.FieldVal {
+	return new(btcec.FieldVal).SetInt(v)
+}
+
+func feAdd(a, b *btcec.FieldVal) *btcec.FieldVal {
+	return new(btcec.FieldVal).Add2(a, b).Normalize()
+}
+
+func feSub(a, b *btcec.FieldVal) *btcec.FieldVal {
+	return new(btcec.FieldVal).NegateVal(b, 1).Add(a).Normalize()
+}
+
+func feNeg(a *btcec.FieldVal) *btcec.FieldVal {
+	return new(btcec.FieldVal).NegateVal(a, 1).Normalize()
+}
+
+func feMul(a, b *btcec.FieldVal) *btcec.FieldVal {
+	return new(btcec.FieldVal).Mul2(a, b).Normalize()
+}
+
+func feDiv(a, b *btcec.FieldVal) *btcec.FieldVal {
+	inv := new(btcec.FieldVal).Set(b).Inverse()
+	return new(btcec.FieldVal).Mul2(a, inv).Normalize()
+}
+
+func feSqrt(a *btcec.FieldVal) (*btcec.FieldVal, bool) {
+	var r btcec.FieldVal
+	if !r.SquareRootVal(a) {
+		return nil, false
+	}
+	return r.Normalize(), true
+}
+
+// curveRHS returns x^3 + 7, the square of the y coordinates of the points with
+// the passed x coordinate.
+func curveRHS(x *btcec.FieldVal) *btcec.FieldVal {
+	return feAdd(feMul(feMul(x, x), x), feInt(7))
+}
+
+// isValidX returns whether the passed field value is the x coordinate of a
+// point on the curve.
+func isValidX(x *btcec.FieldVal) bool {
+	_, ok := feSqrt(curveRHS(x))
+	return ok
+}
+
+// XSwiftEC returns the x coordinate of the point on the curve the field values
+// u and t of an ElligatorSwift encoding map to.  Every pair of field values
+// maps to a point.  The passed field values must be normalized.
+func XSwiftEC(u, t *btcec.FieldVal) *btcec.FieldVal {
+	if u.IsZero() {
+		u = feInt(1)
+	}
+	if t.IsZero() {
+		t = feInt(1)
+	}
+
+	// Change t to 2t when u^3 + t^2 + 7 = 0 to avoid a division by zero
+	// below.
+	uRHS := curveRHS(u)
+	if feAdd(uRHS, feMul(t, t)).IsZero() {
+		t = feAdd(t, t)
+	}
+
+	// X = (u^3 + 7 - t^2) / 2t
+	// Y = (X + t) / (sqrt(-3) * u)
+	x := feDiv(feSub(uRHS, feMul(t, t)), feAdd(t, t))
+	y := feDiv(feAdd(x, t), feMul(sqrtMinus3, u))
+
+	// Return the first of u + 4Y^2, (-X/Y - u) / 2 and (X/Y - u) / 2 which
+	// is a valid x coordinate.  One of them always is.
+	candidate := feAdd(u, feMul(feInt(4), feMul(y, y)))
+	if isValidX(candidate) {
+		return candidate
+	}
+	xDivY := feDiv(x, y)
+	candidate = feDiv(feSub(feNeg(xDivY), u), feInt(2))
+	if isValidX(candidate) {
+		return candidate
+	}
+	return feDiv(feSub(xDivY, u), feInt(2))
+}
+
+// XSwiftECInv returns the field value t for which XSwiftEC maps the field
+// values u and t to the passed x coordinate, or nil if there is none.  Each
+// x coordinate has up to eight preimages for a given u, which are selected by
+// the case number in the range [0, 7].  The passed field values must be
+// normalized.
+func XSwiftECInv(u, x *btcec.FieldVal, caseNum int) *btcec.FieldVal {
+	var v, s *btcec.FieldVal
+	if caseNum&2 == 0 {
+		// The preimage is not decodable to x when -x - u is a valid x
+		// coordinate since it would be returned first.
+		if isValidX(feSub(feNeg(x), u)) {
+			return nil
+		}
+
+		// v = x
+		// s = -(u^3 + 7) / (u^2 + uv + v^2)
+		v = x
+		denom := feAdd(feAdd(feMul(u, u), feMul(u, v)), feMul(v, v))
+		s = feNeg(feDiv(curveRHS(u), denom))
+	} else {
+		// s = x - u
+		s = feSub(x, u)
+		if s.IsZero() {
+			return nil
+		}
+
+		// r = sqrt(-s(4(u^3 + 7) + 3su^2))
+		// v = (r/s - u) / 2
+		q := feAdd(feMul(feInt(4), curveRHS(u)),
+			feMul(feMul(feInt(3), s), feMul(u, u)))
+		r, ok := feSqrt(feNeg(feMul(s, q)))
+		if !ok {
+			return nil
+		}
+		if caseNum&1 != 0 && r.IsZero() {
+			return nil
+		}
+		v = feDiv(feSub(feDiv(r, s), u), feInt(2))
+	}
+
+	w, ok := feSqrt(s)
+	if !ok {
+		return nil
+	}
+
+	// The case number selects the sign of the result and which of the two
+	// cube roots of unity the result is based on.
+	var c *btcec.FieldVal
+	if caseNum&1 == 0 {
+		c = feSub(feInt(1), sqrtMinus3)
+	} else {
+		c = feAdd(feInt(1), sqrtMinus3)
+	}
+	t := feMul(w, feAdd(feDiv(feMul(u, c), feInt(2)), v))
+	if caseNum&5 == 0 || caseNum&5 == 5 {
+		t = feNeg(t)
+	}
+	return t
+}
+
+// xElligatorSwift returns a random ElligatorSwift encoding (u, t) of the
+// passed x coordinate.
+func xElligatorSwift(x *btcec.FieldVal) (*btcec.FieldVal, *btcec.FieldVal, error) {
+	for {
+		var b [33]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, nil, err
+		}
+
+		var u btcec.FieldVal
+		u.SetByteSlice(b[:32])
+		u.Normalize()
+		if u.IsZero() {
+			continue
+		}
+		if t := XSwiftECInv(&u, x, int(b[32]&7)); t != nil {
+			return &u, t, nil
+		}
+	}
+}
+
+// Encode returns a random ElligatorSwift encoding of the passed public key.
+// Since only the x coordinate is encoded, the public key with the opposite y
+// coordinate has the same encodings.
+func Encode(pubKey *btcec.PublicKey) ([EncodedSize]byte, error) {
+	var encoded [EncodedSize]byte
+	var p btcec.JacobianPoint
+	pubKey.AsJacobian(&p)
+	p.ToAffine()
+
+	u, t, err := xElligatorSwift(&p.X)
+	if err != nil {
+		return encoded, err
+	}
+	u.PutBytesUnchecked(encoded[:32])
+	t.PutBytesUnchecked(encoded[32:])
+	return encoded, nil
+}
+
+// decodeX returns the x coordinate of the public key encoded by the passed
+// ElligatorSwift encoding.
+func decodeX(encoded *[EncodedSize]byte) *btcec.FieldVal {
+	var u, t btcec.FieldVal
+	u.SetByteSlice(encoded[:32])
+	t.SetByteSlice(encoded[32:])
+	return XSwiftEC(u.Normalize(), t.Normalize())
+}
+
+// Decode returns the public key with an even y coordinate encoded by the
+// passed ElligatorSwift encoding.  Every 64-byte string decodes to a public
+// key.
+func Decode(encoded [EncodedSize]byte) *btcec.PublicKey {
+	x := decodeX(&encoded)
+	var y btcec.FieldVal
+	btcec.DecompressY(x, false, &y)
+	return btcec.NewPublicKey(x, y.Normalize())
+}
+
+// XOnlyECDH returns the x coordinate of the product of the passed private key
+// and the public key encoded by the passed ElligatorSwift encoding.
+func XOnlyECDH(privKey *btcec.PrivateKey, encoded [EncodedSize]byte) [32]byte {
+	var p, result btcec.JacobianPoint
+	Decode(encoded).AsJacobian(&p)
+	btcec.ScalarMultNonConst(&privKey.Key, &p, &result)
+	result.ToAffine()
+
+	var shared [32]byte
+	result.X.PutBytesUnchecked(shared[:])
+	return shared
+}
@@ -0,0 +1,338 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package schnorr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	ecdsa_schnorr "github.com/decred/dcrd/dcrec/secp256k1/v4/schnorr"
+)
+
+var (
+	// batchCoeffTag is the tagged hash tag used to derive the random
+	// coefficients of a batch verification from the batch seed.
+	batchCoeffTag = []byte("BIP0340/batch")
+)
+
+// batchEntry houses a single signature of a batch along with the message and
+// public key it is verified against.
+type batchEntry struct {
+	sig    *Signature
+	hash   [scalarSize]byte
+	key    *btcec.PublicKey
+	pubKey btcec.JacobianPoint
+}
+
+// BatchVerifier verifies a set of BIP-340 signatures at once using the batch
+// verification algorithm described in BIP-340.  Verifying a batch is faster
+// than verifying each signature individually, but a failed batch doesn't
+// identify which of the signatures is invalid.  Callers that need to know
+// which signature is invalid must fall back to verifying the signatures
+// individually.
+//
+// NOTE: A BatchVerifier is not safe for concurrent access.
+type BatchVerifier struct {
+	entries []batchEntry
+}
+
+// NewBatchVerifier returns a new empty batch verifier.
+func NewBatchVerifier() *BatchVerifier {
+	return &BatchVerifier{}
+}
+
+// Add adds a signature over the passed 32-byte hash under the passed public
+// key to the batch.  As with Signature.Verify, only the x coordinate of the
+// public key is used.
+func (b *BatchVerifier) Add(sig *Signature, hash []byte,
+	pubKey *btcec.PublicKey) error {
+
+	if len(hash) != scalarSize {
+		str := fmt.Sprintf("wrong size for message (got %v, want %v)",
+			len(hash), scalarSize)
+		return signatureError(ecdsa_schnorr.ErrInvalidHashLen, str)
+	}
+
+	// The public key is used with an even y coordinate, so negate it when
+	// its y coordinate is odd.
+	entry := batchEntry{sig: sig, key: pubKey}
+	copy(entry.hash[:], hash)
+	pubKey.AsJacobian(&entry.pubKey)
+	if entry.pubKey.Y.IsOdd() {
+		entry.pubKey.Y.Negate(1).Normalize()
+	}
+	b.entries = append(b.entries, entry)
+
+	return nil
+}
+
+// AddBatch adds all of the signatures of the passed batch to the batch.
+func (b *BatchVerifier) AddBatch(other *BatchVerifier) {
+	b.entries = append(b.entries, other.entries...)
+}
+
+// ForEach calls the passed function with each signature in the batch along
+// with the hash and public key it was added with.  This allows callers to
+// cache the signatures once the batch is verified.
+func (b *BatchVerifier) ForEach(f func(sig *Signature, hash []byte,
+	pubKey *btcec.PublicKey)) {
+
+	for i := range b.entries {
+		entry := &b.entries[i]
+		f(entry.sig, entry.hash[:], entry.key)
+	}
+}
+
+// Len returns the number of signatures in the batch.
+func (b *BatchVerifier) Len() int {
+	return len(b.entries)
+}
+
+// Verify returns whether or not all of the signatures in the batch are valid.
+// An empty batch is valid.
+//
+// The batch is verified by checking the random linear combination of the
+// individual verification equations:
+//
+//	(a_1*s_1 + ... + a_u*s_u)*G =
+//	    a_1*R_1 + ... + a_u*R_u + (a_1*e_1)*P_1 + ... + (a_u*e_u)*P_u
+//
+// where a_1 is 1 and the other coefficients are random 128-bit scalars which
+// can't be predicted by whoever created the signatures.
+func (b *BatchVerifier) Verify() bool {
+	switch len(b.entries) {
+	case 0:
+		return true
+
+	// There's nothing to gain from batching a single signature, so verify
+	// it on its own.
+	case 1:
+		entry := &b.entries[0]
+		var pBytes [scalarSize]byte
+		entry.pubKey.X.PutBytesUnchecked(pBytes[:])
+		return schnorrVerify(entry.sig, entry.hash[:], pBytes[:]) == nil
+	}
+
+	seed, err := b.seed()
+	if err != nil {
+		return false
+	}
+
+	var s btcec.ModNScalar
+	scalars := make([]btcec.ModNScalar, 0, len(b.entries)*2)
+	points := make([]btcec.JacobianPoint, 0, len(b.entries)*2)
+	for i := range b.entries {
+		entry := &b.entries[i]
+
+		// R = lift_x(r), which fails if r is not the x coordinate of a
+		// point on the curve.
+		var r btcec.JacobianPoint
+		r.X.Set(&entry.sig.r)
+		if !btcec.DecompressY(&r.X, false, &r.Y) {
+			return false
+		}
+		r.Z.SetInt(1)
+
+		// e = int(tagged_hash("BIP0340/challenge", bytes(r) ||
+		// bytes(P) || M)) mod n.
+		var rBytes, pBytes [scalarSize]byte
+		entry.sig.r.PutBytesUnchecked(rBytes[:])
+		entry.pubKey.X.PutBytesUnchecked(pBytes[:])
+		commitment := chainhash.TaggedHash(
+			chainhash.TagBIP0340Challenge, rBytes[:], pBytes[:],
+			entry.hash[:],
+		)
+		var e btcec.ModNScalar
+		e.SetBytes((*[32]byte)(commitment))
+
+		a := batchCoefficient(seed, i)
+
+		// s += a_i*s_i.
+		var as btcec.ModNScalar
+		as.Mul2(&a, &entry.sig.s)
+		s.Add(&as)
+
+		// The points are a_i*R_i and (a_i*e_i)*P_i.
+		var ae btcec.ModNScalar
+		ae.Mul2(&a, &e)
+		scalars = append(scalars, a, ae)
+		points = append(points, r, entry.pubKey)
+	}
+
+	var lhs, rhs btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&s, &lhs)
+	multiScalarMult(scalars, points, &rhs)
+
+	return jacobianEqual(&lhs, &rhs)
+}
+
+// seed returns the seed the random coefficients of the batch are derived
+// from.  The seed commits to all of the entries of the batch along with fresh
+// randomness, so the coefficients can't be predicted in advance.
+func (b *BatchVerifier) seed() ([]byte, error) {
+	h := sha256.New()
+
+	var randBytes [32]byte
+	if _, err := rand.Read(randBytes[:]); err != nil {
+		return nil, err
+	}
+	h.Write(randBytes[:])
+
+	for i := range b.entries {
+		entry := &b.entries[i]
+		var pBytes [scalarSize]byte
+		entry.pubKey.X.PutBytesUnchecked(pBytes[:])
+		h.Write(pBytes[:])
+		h.Write(entry.hash[:])
+		h.Write(entry.sig.Serialize())
+	}
+
+	return h.Sum(nil), nil
+}
+
+// batchCoefficient returns the random coefficient of the i-th entry of the
+// batch.  The coefficient of the first entry is always one, and the others
+// are 128-bit scalars derived from the seed.
+func batchCoefficient(seed []byte, i int) btcec.ModNScalar {
+	var a btcec.ModNScalar
+	if i == 0 {
+		a.SetInt(1)
+		return a
+	}
+
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], uint32(i))
+	h := chainhash.TaggedHash(batchCoeffTag, seed, idx[:])
+
+	// Only use the low 128 bits of the hash, which keeps the cost of the
+	// multiplications by the coefficients down.  Make sure the coefficient
+	// is never zero.
+	var coeffBytes [32]byte
+	copy(coeffBytes[16:], h[16:])
+	coeffBytes[16] |= 0x80
+	a.SetBytes(&coeffBytes)
+	return a
+}
+
+// jacobianEqual returns whether or not the passed points are equal without
+// converting them to affine coordinates.
+func jacobianEqual(p1, p2 *btcec.JacobianPoint) bool {
+	p1Inf := (p1.X.IsZero() && p1.Y.IsZero()) || p1.Z.IsZero()
+	p2Inf := (p2.X.IsZero() && p2.Y.IsZero()) || p2.Z.IsZero()
+	if p1Inf || p2Inf {
+		return p1Inf && p2Inf
+	}
+
+	// X1*Z2^2 == X2*Z1^2 and Y1*Z2^3 == Y2*Z1^3.
+	var z1Sq, z2Sq, z1Cu, z2Cu btcec.FieldVal
+	z1Sq.SquareVal(&p1.Z)
+	z2Sq.SquareVal(&p2.Z)
+	z1Cu.Mul2(&z1Sq, &p1.Z)
+	z2Cu.Mul2(&z2Sq, &p2.Z)
+
+	var x1, x2, y1, y2 btcec.FieldVal
+	x1.Mul2(&p1.X, &z2Sq).Normalize()
+	x2.Mul2(&p2.X, &z1Sq).Normalize()
+	y1.Mul2(&p1.Y, &z2Cu).Normalize()
+	y2.Mul2(&p2.Y, &z1Cu).Normalize()
+
+	return x1.Equals(&x2) && y1.Equals(&y2)
+}
+
+// msmWindowSize returns the window size in bits to use for a multi-scalar
+// multiplication of the passed number of points.
+func msmWindowSize(numPoints int) uint {
+	switch {
+	case numPoints < 8:
+		return 3
+	case numPoints > 1<<14:
+		return 12
+	default:
+		return uint(bits.Len(uint(numPoints))) - 2
+	}
+}
+
+// multiScalarMult computes the sum of scalars[i]*points[i] using the bucket
+// method described by Pippenger, which is much faster than multiplying each
+// point on its own and summing the results once there are more than a few
+// points.
+func multiScalarMult(scalars []btcec.ModNScalar, points []btcec.JacobianPoint,
+	result *btcec.JacobianPoint) {
+
+	window := msmWindowSize(len(points))
+	numBuckets := (1 << window) - 1
+
+	scalarBytes := make([][32]byte, len(scalars))
+	for i := range scalars {
+		scalarBytes[i] = scalars[i].Bytes()
+	}
+
+	*result = btcec.JacobianPoint{}
+	buckets := make([]btcec.JacobianPoint, numBuckets)
+	numWindows := (256 + int(window) - 1) / int(window)
+	for w := numWindows - 1; w >= 0; w-- {
+		// Shift the result by the size of the window.
+		if w != numWindows-1 {
+			for i := uint(0); i < window; i++ {
+				var doubled btcec.JacobianPoint
+				btcec.DoubleNonConst(result, &doubled)
+				*result = doubled
+			}
+		}
+
+		// Sort the points into buckets by their digit in this window.
+		for i := range buckets {
+			buckets[i] = btcec.JacobianPoint{}
+		}
+		bitOffset := uint(w) * window
+		for i := range points {
+			digit := scalarWindow(&scalarBytes[i], bitOffset, window)
+			if digit == 0 {
+				continue
+			}
+
+			var sum btcec.JacobianPoint
+			btcec.AddNonConst(&buckets[digit-1], &points[i], &sum)
+			buckets[digit-1] = sum
+		}
+
+		// Sum the buckets weighted by their digit using a running sum,
+		// so bucket j is added j+1 times.
+		var running, windowSum btcec.JacobianPoint
+		for j := numBuckets - 1; j >= 0; j-- {
+			var sum btcec.JacobianPoint
+			btcec.AddNonConst(&running, &buckets[j], &sum)
+			running = sum
+			btcec.AddNonConst(&windowSum, &running, &sum)
+			windowSum = sum
+		}
+
+		var sum btcec.JacobianPoint
+		btcec.AddNonConst(result, &windowSum, &sum)
+		*result = sum
+	}
+}
+
+// scalarWindow returns the value of the window of the passed number of bits
+// starting at the passed bit offset of the big-endian scalar.
+func scalarWindow(scalar *[32]byte, bitOffset, window uint) int {
+	var digit int
+	for i := uint(0); i < window; i++ {
+		bit := bitOffset + i
+		if bit >= 256 {
+			break
+		}
+		byteIdx := 31 - bit/8
+		if scalar[byteIdx]>>(bit%8)&1 == 1 {
+			digit |= 1 << i
+		}
+	}
+	return digit
+}
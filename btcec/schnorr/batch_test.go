@@ -0,0 +1,215 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package schnorr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcec"
+)
+
+// batchTestSigs returns the passed number of valid signatures over distinct
+// messages along with the messages and keys they are valid for.
+func batchTestSigs(t testing.TB, num int) ([]*Signature, [][]byte,
+	[]*btcec.PublicKey) {
+
+	sigs := make([]*Signature, 0, num)
+	msgs := make([][]byte, 0, num)
+	pubKeys := make([]*btcec.PublicKey, 0, num)
+	for i := 0; i < num; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		msg := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		sig, err := Sign(privKey, msg[:])
+		if err != nil {
+			t.Fatalf("unable to sign: %v", err)
+		}
+
+		sigs = append(sigs, sig)
+		msgs = append(msgs, msg[:])
+		pubKeys = append(pubKeys, privKey.PubKey())
+	}
+
+	return sigs, msgs, pubKeys
+}
+
+// TestBatchVerify ensures that batches of valid signatures verify, and that a
+// single invalid signature anywhere in a batch causes the batch to fail.
+func TestBatchVerify(t *testing.T) {
+	t.Parallel()
+
+	if !NewBatchVerifier().Verify() {
+		t.Fatalf("empty batch failed to verify")
+	}
+
+	for _, num := range []int{1, 2, 7, 8, 33, 100} {
+		sigs, msgs, pubKeys := batchTestSigs(t, num)
+
+		batch := NewBatchVerifier()
+		for i := range sigs {
+			if err := batch.Add(sigs[i], msgs[i], pubKeys[i]); err != nil {
+				t.Fatalf("unable to add signature: %v", err)
+			}
+		}
+		if batch.Len() != num {
+			t.Fatalf("unexpected batch size: got %d, want %d",
+				batch.Len(), num)
+		}
+		if !batch.Verify() {
+			t.Fatalf("batch of %d valid signatures failed to verify",
+				num)
+		}
+
+		// Swapping the messages of the first and last signatures, or
+		// verifying the last signature under the wrong key, must make
+		// the batch fail.
+		for _, swapKey := range []bool{false, true} {
+			if num < 2 {
+				break
+			}
+
+			batch := NewBatchVerifier()
+			for i := range sigs {
+				msg, pubKey := msgs[i], pubKeys[i]
+				switch {
+				case i == num-1 && swapKey:
+					pubKey = pubKeys[0]
+				case i == num-1:
+					msg = msgs[0]
+				}
+				err := batch.Add(sigs[i], msg, pubKey)
+				if err != nil {
+					t.Fatalf("unable to add signature: %v", err)
+				}
+			}
+			if batch.Verify() {
+				t.Fatalf("batch of %d signatures with an invalid "+
+					"signature verified (swap key %v)", num,
+					swapKey)
+			}
+		}
+	}
+
+	// Merging batches must verify all of the signatures of both.
+	sigs, msgs, pubKeys := batchTestSigs(t, 10)
+	batch1, batch2 := NewBatchVerifier(), NewBatchVerifier()
+	for i := range sigs {
+		batch := batch1
+		if i%2 == 1 {
+			batch = batch2
+		}
+		if err := batch.Add(sigs[i], msgs[i], pubKeys[i]); err != nil {
+			t.Fatalf("unable to add signature: %v", err)
+		}
+	}
+	batch1.AddBatch(batch2)
+	if batch1.Len() != len(sigs) || !batch1.Verify() {
+		t.Fatalf("merged batch failed to verify")
+	}
+
+	// The signatures are iterated along with the messages and keys they
+	// were added with.
+	var numSigs int
+	batch1.ForEach(func(sig *Signature, hash []byte,
+		pubKey *btcec.PublicKey) {
+
+		for i := range sigs {
+			if sigs[i] == sig && bytes.Equal(msgs[i], hash) &&
+				pubKeys[i] == pubKey {
+
+				numSigs++
+			}
+		}
+	})
+	if numSigs != len(sigs) {
+		t.Fatalf("iterated %d of the %d signatures", numSigs, len(sigs))
+	}
+
+	// Messages must be 32 bytes.
+	if err := batch1.Add(sigs[0], msgs[0][:31], pubKeys[0]); err == nil {
+		t.Fatalf("signature with short message added")
+	}
+}
+
+// TestBatchVerifyBIP340Vectors ensures that each of the BIP-340 test vectors
+// produces the same result when verified as a batch along with a valid
+// signature as when verified individually.
+func TestBatchVerifyBIP340Vectors(t *testing.T) {
+	t.Parallel()
+
+	sigs, msgs, pubKeys := batchTestSigs(t, 1)
+	for i, test := range bip340TestVectors {
+		pubKey, err := ParsePubKey(decodeHex(test.publicKey))
+		if err != nil {
+			continue
+		}
+		sig, err := ParseSignature(decodeHex(test.signature))
+		if err != nil {
+			continue
+		}
+
+		// Add the test vector both before and after the valid
+		// signature, since the first signature of a batch is treated
+		// differently.
+		for _, first := range []bool{true, false} {
+			batch := NewBatchVerifier()
+			if !first {
+				batch.Add(sigs[0], msgs[0], pubKeys[0])
+			}
+			err := batch.Add(sig, decodeHex(test.message), pubKey)
+			if err != nil {
+				t.Fatalf("test #%v: unable to add signature: %v",
+					i, err)
+			}
+			if first {
+				batch.Add(sigs[0], msgs[0], pubKeys[0])
+			}
+
+			if batch.Verify() != test.verifyResult {
+				t.Fatalf("test #%v: verification mismatch: "+
+					"expected %v, got %v", i,
+					test.verifyResult, !test.verifyResult)
+			}
+		}
+	}
+}
+
+// TestMultiScalarMult ensures that the multi-scalar multiplication produces
+// the same result as multiplying and summing each point on its own across
+// the various window sizes.
+func TestMultiScalarMult(t *testing.T) {
+	t.Parallel()
+
+	for _, num := range []int{1, 5, 8, 40, 300} {
+		scalars := make([]btcec.ModNScalar, num)
+		points := make([]btcec.JacobianPoint, num)
+		var want btcec.JacobianPoint
+		for i := 0; i < num; i++ {
+			privKey, err := btcec.NewPrivateKey()
+			if err != nil {
+				t.Fatalf("unable to generate key: %v", err)
+			}
+			privKey.PubKey().AsJacobian(&points[i])
+
+			seed := sha256.Sum256([]byte{byte(i), byte(num)})
+			scalars[i].SetBytes(&seed)
+
+			var product, sum btcec.JacobianPoint
+			btcec.ScalarMultNonConst(&scalars[i], &points[i], &product)
+			btcec.AddNonConst(&want, &product, &sum)
+			want = sum
+		}
+
+		var got btcec.JacobianPoint
+		multiScalarMult(scalars, points, &got)
+		if !jacobianEqual(&got, &want) {
+			t.Fatalf("mismatched result for %d points", num)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package schnorr
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"math/big"
 	"testing"
 
@@ -167,3 +168,42 @@ func BenchmarkSignRfc6979(b *testing.B) {
 	testSig = sig
 	testErr = err
 }
+
+// BenchmarkBatchVerify benchmarks how long it takes to verify batches of
+// signatures of various sizes compared to verifying each of the signatures
+// individually.
+func BenchmarkBatchVerify(b *testing.B) {
+	for _, num := range []int{1, 8, 64, 256, 1024} {
+		sigs, msgs, pubKeys := batchTestSigs(b, num)
+
+		b.Run(fmt.Sprintf("individual/%d", num), func(b *testing.B) {
+			var ok bool
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := range sigs {
+					ok = sigs[j].Verify(msgs[j], pubKeys[j])
+				}
+			}
+
+			testOk = ok
+		})
+
+		b.Run(fmt.Sprintf("batch/%d", num), func(b *testing.B) {
+			var ok bool
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := NewBatchVerifier()
+				for j := range sigs {
+					batch.Add(sigs[j], msgs[j], pubKeys[j])
+				}
+				ok = batch.Verify()
+			}
+
+			testOk = ok
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"errors"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+)
+
+var (
+	// ErrSigningContextReuse is returned when a session is used to sign
+	// more than once.  Signing twice with the same nonces leaks the
+	// signing key.
+	ErrSigningContextReuse = errors.New("session has already been used " +
+		"to sign")
+
+	// ErrAlreadyHaveAllNonces is returned when a nonce is registered after
+	// the nonces of all of the signers are known.
+	ErrAlreadyHaveAllNonces = errors.New("already have all nonces")
+
+	// ErrCombinedNonceUnavailable is returned when a session is used to
+	// sign before the nonces of all of the signers are known.
+	ErrCombinedNonceUnavailable = errors.New("the nonces of all signers " +
+		"are required to sign")
+
+	// ErrAlreadyHaveAllSigs is returned when a partial signature is
+	// combined after the signatures of all of the signers are known.
+	ErrAlreadyHaveAllSigs = errors.New("already have all partial " +
+		"signatures")
+
+	// ErrFinalSigInvalid is returned when the aggregated signature isn't
+	// valid under the aggregated key, which means one of the partial
+	// signatures is invalid.
+	ErrFinalSigInvalid = errors.New("aggregated signature is invalid")
+)
+
+// Context houses the signing key and the set of keys of the signers, which
+// are shared by all of the signing sessions between the same signers.
+type Context struct {
+	signingKey *btcec.PrivateKey
+	pubKey     *btcec.PublicKey
+	keySet     []*btcec.PublicKey
+	opts       []SignOption
+	aggKey     *AggregateKey
+}
+
+// NewContext returns a new signing context for the passed signing key and set
+// of signers, which must include the public key of the signing key.  The
+// options describe how the keys are aggregated and must be the same for all
+// of the signers.
+func NewContext(signingKey *btcec.PrivateKey, signers []*btcec.PublicKey,
+	options ...SignOption) (*Context, error) {
+
+	pubKey := signingKey.PubKey()
+	if !keyInSet(signers, pubKey) {
+		return nil, ErrSignerNotInKeySet
+	}
+
+	opts := &signOpts{}
+	for _, option := range options {
+		option(opts)
+	}
+	aggKey, err := AggregateKeys(signers, opts.sortKeys, opts.tweaks...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Context{
+		signingKey: signingKey,
+		pubKey:     pubKey,
+		keySet:     signers,
+		opts:       options,
+		aggKey:     aggKey,
+	}, nil
+}
+
+// CombinedKey returns the aggregated key of the signers, including any
+// tweaks.  Its x-only form is the key the final signature is valid under.
+func (c *Context) CombinedKey() *btcec.PublicKey {
+	return c.aggKey.FinalKey
+}
+
+// PubKey returns the public key of the signer.
+func (c *Context) PubKey() *btcec.PublicKey {
+	return c.pubKey
+}
+
+// NewSession starts a new signing session for the passed message with a
+// fresh set of nonces.  Sessions must never be reused across messages.
+func (c *Context) NewSession(msg [32]byte) (*Session, error) {
+	nonces, err := GenNonces(
+		WithPublicKey(c.pubKey),
+		WithNonceSecretKeyAux(c.signingKey),
+		WithNonceCombinedKeyAux(c.aggKey.XOnlyKey()),
+		WithNonceMessageAux(msg[:]),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ctx:         c,
+		msg:         msg,
+		localNonces: nonces,
+		pubNonces:   [][PubNonceSize]byte{nonces.PubNonce},
+	}, nil
+}
+
+// Session houses the state of a single signing session.  A session collects
+// the public nonces of the other signers, signs exactly once, and then
+// collects the partial signatures of the other signers to produce the final
+// signature.
+//
+// NOTE: A session is not safe for concurrent access.
+type Session struct {
+	ctx *Context
+	msg [32]byte
+
+	localNonces *Nonces
+	pubNonces   [][PubNonceSize]byte
+	aggNonce    *[PubNonceSize]byte
+
+	signed      bool
+	partialSigs []*PartialSignature
+	finalSig    *schnorr.Signature
+}
+
+// PublicNonce returns the public nonce of the signer, which must be sent to
+// all of the other signers.
+func (s *Session) PublicNonce() [PubNonceSize]byte {
+	return s.localNonces.PubNonce
+}
+
+// NumRegisteredNonces returns the number of public nonces known to the
+// session, including the nonce of the signer.
+func (s *Session) NumRegisteredNonces() int {
+	return len(s.pubNonces)
+}
+
+// RegisterPubNonce registers the public nonce of another signer.  It returns
+// true once the nonces of all of the signers are known.
+func (s *Session) RegisterPubNonce(nonce [PubNonceSize]byte) (bool, error) {
+	if s.aggNonce != nil {
+		return false, ErrAlreadyHaveAllNonces
+	}
+
+	s.pubNonces = append(s.pubNonces, nonce)
+	if len(s.pubNonces) < len(s.ctx.keySet) {
+		return false, nil
+	}
+
+	aggNonce, err := AggregateNonces(s.pubNonces)
+	if err != nil {
+		// Drop the invalid nonce so the caller can retry with the
+		// correct one.
+		s.pubNonces = s.pubNonces[:len(s.pubNonces)-1]
+		return false, err
+	}
+	s.aggNonce = &aggNonce
+
+	return true, nil
+}
+
+// Sign creates the partial signature of the signer once the nonces of all of
+// the signers are known.  A session can only be used to sign once.
+func (s *Session) Sign() (*PartialSignature, error) {
+	switch {
+	case s.signed:
+		return nil, ErrSigningContextReuse
+	case s.aggNonce == nil:
+		return nil, ErrCombinedNonceUnavailable
+	}
+
+	// The session is marked as used before signing, since the secret
+	// nonce is consumed even if signing fails.
+	s.signed = true
+
+	sig, err := Sign(
+		&s.localNonces.SecNonce, s.ctx.signingKey, *s.aggNonce,
+		s.ctx.keySet, s.msg[:], s.ctx.opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify our own signature to guard against faults before sharing
+	// it.
+	err = sig.Verify(
+		s.localNonces.PubNonce, *s.aggNonce, s.ctx.keySet,
+		s.ctx.pubKey, s.msg[:], s.ctx.opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.partialSigs = append(s.partialSigs, sig)
+
+	return sig, nil
+}
+
+// CombineSig adds the partial signature of another signer.  It returns true
+// once the partial signatures of all of the signers are known, at which point
+// the final signature is available via FinalSig.
+func (s *Session) CombineSig(sig *PartialSignature) (bool, error) {
+	if s.finalSig != nil {
+		return false, ErrAlreadyHaveAllSigs
+	}
+	if s.aggNonce == nil {
+		return false, ErrCombinedNonceUnavailable
+	}
+
+	s.partialSigs = append(s.partialSigs, sig)
+	if len(s.partialSigs) < len(s.ctx.keySet) {
+		return false, nil
+	}
+
+	finalSig, err := AggregatePartialSigs(
+		s.partialSigs, *s.aggNonce, s.ctx.keySet, s.msg[:],
+		s.ctx.opts...,
+	)
+	if err == nil && !finalSig.Verify(s.msg[:], s.ctx.CombinedKey()) {
+		err = ErrFinalSigInvalid
+	}
+	if err != nil {
+		// Drop the last signature so the caller can retry with the
+		// correct one.
+		s.partialSigs = s.partialSigs[:len(s.partialSigs)-1]
+		return false, err
+	}
+	s.finalSig = finalSig
+
+	return true, nil
+}
+
+// FinalSig returns the final aggregated signature, or nil if the partial
+// signatures of all of the signers aren't known yet.
+func (s *Session) FinalSig() *schnorr.Signature {
+	return s.finalSig
+}
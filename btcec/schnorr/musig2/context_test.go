@@ -0,0 +1,190 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcec"
+)
+
+// TestSession ensures that a set of signers can use signing sessions to
+// produce a valid aggregated signature, and that the sessions guard against
+// nonce reuse.
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	const numSigners = 3
+
+	var privKeys []*btcec.PrivateKey
+	var pubKeys []*btcec.PublicKey
+	for i := 0; i < numSigners; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		privKeys = append(privKeys, privKey)
+		pubKeys = append(pubKeys, privKey.PubKey())
+	}
+
+	tweak := KeyTweakDesc{
+		Tweak:   sha256.Sum256([]byte("taproot tweak")),
+		IsXOnly: true,
+	}
+	msg := sha256.Sum256([]byte("babylon"))
+
+	var sessions []*Session
+	for i, privKey := range privKeys {
+		ctx, err := NewContext(
+			privKey, pubKeys, WithSortedKeys(), WithTweaks(tweak),
+		)
+		if err != nil {
+			t.Fatalf("signer #%d: unable to create context: %v", i,
+				err)
+		}
+		if i > 0 && !ctx.CombinedKey().IsEqual(
+			sessions[0].ctx.CombinedKey()) {
+
+			t.Fatalf("signer #%d: combined key mismatch", i)
+		}
+
+		session, err := ctx.NewSession(msg)
+		if err != nil {
+			t.Fatalf("signer #%d: unable to create session: %v", i,
+				err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	// A session can't sign before all of the nonces are known.
+	if _, err := sessions[0].Sign(); !errors.Is(err, ErrCombinedNonceUnavailable) {
+		t.Fatalf("unexpected error signing without nonces: %v", err)
+	}
+
+	// Exchange the public nonces.
+	for i, session := range sessions {
+		for j, other := range sessions {
+			if i == j {
+				continue
+			}
+			haveAll, err := session.RegisterPubNonce(
+				other.PublicNonce(),
+			)
+			if err != nil {
+				t.Fatalf("signer #%d: unable to register nonce: "+
+					"%v", i, err)
+			}
+			if haveAll != (session.NumRegisteredNonces() == numSigners) {
+				t.Fatalf("signer #%d: unexpected nonce state", i)
+			}
+		}
+	}
+	_, err := sessions[0].RegisterPubNonce(sessions[1].PublicNonce())
+	if !errors.Is(err, ErrAlreadyHaveAllNonces) {
+		t.Fatalf("unexpected error for extra nonce: %v", err)
+	}
+
+	// Sign, and ensure a session can only sign once.
+	var partialSigs []*PartialSignature
+	for i, session := range sessions {
+		sig, err := session.Sign()
+		if err != nil {
+			t.Fatalf("signer #%d: unable to sign: %v", i, err)
+		}
+		partialSigs = append(partialSigs, sig)
+
+		if _, err := session.Sign(); !errors.Is(err, ErrSigningContextReuse) {
+			t.Fatalf("signer #%d: unexpected error for reuse: %v",
+				i, err)
+		}
+	}
+
+	// Combine the signatures of the other signers in the first session.
+	session := sessions[0]
+	for i, sig := range partialSigs[1:] {
+		haveAll, err := session.CombineSig(sig)
+		if err != nil {
+			t.Fatalf("unable to combine signature #%d: %v", i, err)
+		}
+		if haveAll != (i == numSigners-2) {
+			t.Fatalf("unexpected signature state after #%d", i)
+		}
+	}
+	if _, err := session.CombineSig(partialSigs[1]); !errors.Is(err, ErrAlreadyHaveAllSigs) {
+		t.Fatalf("unexpected error for extra signature: %v", err)
+	}
+
+	finalSig := session.FinalSig()
+	if finalSig == nil {
+		t.Fatalf("final signature not available")
+	}
+	if !finalSig.Verify(msg[:], session.ctx.CombinedKey()) {
+		t.Fatalf("final signature is invalid")
+	}
+
+	// The final signature must be the same when combined via the
+	// stateless API.
+	aggSig, err := AggregatePartialSigs(
+		partialSigs, *session.aggNonce, pubKeys, msg[:],
+		WithSortedKeys(), WithTweaks(tweak),
+	)
+	if err != nil {
+		t.Fatalf("unable to aggregate signatures: %v", err)
+	}
+	if !aggSig.IsEqual(finalSig) {
+		t.Fatalf("aggregated signature mismatch")
+	}
+}
+
+// TestSessionInvalidPartialSig ensures that an invalid partial signature
+// results in an invalid final signature being rejected.
+func TestSessionInvalidPartialSig(t *testing.T) {
+	t.Parallel()
+
+	var privKeys []*btcec.PrivateKey
+	var pubKeys []*btcec.PublicKey
+	for i := 0; i < 2; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		privKeys = append(privKeys, privKey)
+		pubKeys = append(pubKeys, privKey.PubKey())
+	}
+
+	if _, err := NewContext(privKeys[0], pubKeys[1:]); !errors.Is(err, ErrSignerNotInKeySet) {
+		t.Fatalf("unexpected error for signer not in key set: %v", err)
+	}
+
+	msg := sha256.Sum256([]byte("babylon"))
+	var sessions []*Session
+	for i, privKey := range privKeys {
+		ctx, err := NewContext(privKey, pubKeys)
+		if err != nil {
+			t.Fatalf("signer #%d: unable to create context: %v", i,
+				err)
+		}
+		session, err := ctx.NewSession(msg)
+		if err != nil {
+			t.Fatalf("signer #%d: unable to create session: %v", i,
+				err)
+		}
+		sessions = append(sessions, session)
+	}
+	if _, err := sessions[0].RegisterPubNonce(sessions[1].PublicNonce()); err != nil {
+		t.Fatalf("unable to register nonce: %v", err)
+	}
+	if _, err := sessions[0].Sign(); err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+
+	var bogusSig PartialSignature
+	bogusSig.S.SetInt(1)
+	if _, err := sessions[0].CombineSig(&bogusSig); !errors.Is(err, ErrFinalSigInvalid) {
+		t.Fatalf("unexpected error for invalid signature: %v", err)
+	}
+}
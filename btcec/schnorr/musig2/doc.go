@@ -0,0 +1,25 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package musig2 implements the MuSig2 multi-signature scheme as specified by
+BIP 327.
+
+MuSig2 allows a set of signers to produce a single BIP 340 Schnorr signature
+that is valid under an aggregated public key.  The aggregated key and the final
+signature are indistinguishable from a regular single-signer key and
+signature, so an output that requires all of the signers costs the same as one
+that requires a single signer.
+
+Signing takes two rounds.  In the first round, each signer generates a fresh
+pair of nonces with GenNonces and shares the public nonce.  Once all of the
+public nonces are known, each signer creates a partial signature with Sign,
+and the partial signatures are combined into the final signature with
+AggregatePartialSigs.
+
+The Context and Session types wrap these steps.  A session generates its own
+nonces and refuses to sign more than once, since signing twice with the same
+nonces leaks the signing key.
+*/
+package musig2
@@ -0,0 +1,245 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+)
+
+var (
+	// keyAggTagList is the tagged hash tag used to compute the hash of the
+	// list of sorted public keys.
+	keyAggTagList = []byte("KeyAgg list")
+
+	// keyAggTagCoeff is the tagged hash tag used to compute the key
+	// aggregation coefficient for each key.
+	keyAggTagCoeff = []byte("KeyAgg coefficient")
+
+	// ErrNoKeys is returned when an empty set of keys is aggregated.
+	ErrNoKeys = errors.New("at least one key is required for aggregation")
+
+	// ErrAggregateKeyInfinity is returned when the aggregated or tweaked
+	// key is the point at infinity.
+	ErrAggregateKeyInfinity = errors.New("aggregated key is the point " +
+		"at infinity")
+
+	// ErrTweakOverflow is returned when a tweak is not less than the
+	// order of the curve.
+	ErrTweakOverflow = errors.New("tweak overflows the group order")
+)
+
+// KeyTweakDesc describes a tweak to be applied to the aggregated public key.
+// Plain tweaks are added to the aggregated key as is, while x-only tweaks are
+// applied to the x-only form of the aggregated key, which is how BIP 341
+// taproot tweaks are applied.
+type KeyTweakDesc struct {
+	// Tweak is the 32-byte big-endian scalar to tweak the key with.
+	Tweak [32]byte
+
+	// IsXOnly indicates whether the tweak is applied to the x-only form
+	// of the key.
+	IsXOnly bool
+}
+
+// AggregateKey houses the result of aggregating a set of public keys along
+// with any tweaks applied to the aggregated key.
+type AggregateKey struct {
+	// FinalKey is the aggregated key after all of the tweaks have been
+	// applied.  Its x-only form is the key that signatures are valid
+	// under.
+	FinalKey *btcec.PublicKey
+
+	// PreTweakedKey is the aggregated key before any tweaks were applied.
+	PreTweakedKey *btcec.PublicKey
+
+	// parityAcc is the accumulated negation factor of the tweaks, which
+	// is either 1 or n-1.
+	parityAcc btcec.ModNScalar
+
+	// tweakAcc is the accumulated value of all of the tweaks.
+	tweakAcc btcec.ModNScalar
+}
+
+// SortKeys returns a copy of the passed keys sorted lexicographically by
+// their compressed serialization as described by the KeySort algorithm of
+// BIP 327.
+func SortKeys(keys []*btcec.PublicKey) []*btcec.PublicKey {
+	sortedKeys := make([]*btcec.PublicKey, len(keys))
+	copy(sortedKeys, keys)
+	sort.SliceStable(sortedKeys, func(i, j int) bool {
+		return bytes.Compare(
+			sortedKeys[i].SerializeCompressed(),
+			sortedKeys[j].SerializeCompressed(),
+		) < 0
+	})
+
+	return sortedKeys
+}
+
+// keyHashFingerprint computes the tagged hash of the serialized keys, which
+// every key aggregation coefficient commits to.
+func keyHashFingerprint(keys []*btcec.PublicKey) []byte {
+	var keyBytes bytes.Buffer
+	for _, key := range keys {
+		keyBytes.Write(key.SerializeCompressed())
+	}
+
+	h := chainhash.TaggedHash(keyAggTagList, keyBytes.Bytes())
+	return h[:]
+}
+
+// secondUniqueKey returns the serialization of the first key that differs
+// from the first key in the set, or 33 zero bytes if all keys are the same.
+// The coefficient of that key is always one, which saves a scalar
+// multiplication when aggregating.
+func secondUniqueKey(keys []*btcec.PublicKey) []byte {
+	firstKey := keys[0].SerializeCompressed()
+	for _, key := range keys[1:] {
+		keyBytes := key.SerializeCompressed()
+		if !bytes.Equal(keyBytes, firstKey) {
+			return keyBytes
+		}
+	}
+
+	return make([]byte, btcec.PubKeyBytesLenCompressed)
+}
+
+// aggregationCoefficient returns the key aggregation coefficient of the
+// target key within the set of keys described by the passed fingerprint and
+// second unique key.
+func aggregationCoefficient(keysHash, secondKey []byte,
+	targetKey *btcec.PublicKey) *btcec.ModNScalar {
+
+	var coefficient btcec.ModNScalar
+
+	targetKeyBytes := targetKey.SerializeCompressed()
+	if bytes.Equal(targetKeyBytes, secondKey) {
+		coefficient.SetInt(1)
+		return &coefficient
+	}
+
+	h := chainhash.TaggedHash(keyAggTagCoeff, keysHash, targetKeyBytes)
+	coefficient.SetByteSlice(h[:])
+	return &coefficient
+}
+
+// keyInSet returns true if the passed key is part of the set of keys.
+func keyInSet(keys []*btcec.PublicKey, key *btcec.PublicKey) bool {
+	for _, k := range keys {
+		if k.IsEqual(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInfinity returns true if the passed point is the point at infinity.
+func isInfinity(p *btcec.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
+
+// hasEvenY returns true if the y coordinate of the passed affine point is
+// even.
+func hasEvenY(p *btcec.JacobianPoint) bool {
+	return !p.Y.IsOdd()
+}
+
+// AggregateKeys aggregates the passed public keys into a single key as
+// described by the KeyAgg algorithm of BIP 327, and applies the passed tweaks
+// to it in order.  When sortKeys is true, the keys are sorted first so the
+// aggregated key doesn't depend on the order the keys are passed in.
+func AggregateKeys(keys []*btcec.PublicKey, sortKeys bool,
+	tweaks ...KeyTweakDesc) (*AggregateKey, error) {
+
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	if sortKeys {
+		keys = SortKeys(keys)
+	}
+
+	// Q = sum(a_i * P_i).
+	keysHash := keyHashFingerprint(keys)
+	secondKey := secondUniqueKey(keys)
+	var q btcec.JacobianPoint
+	for _, key := range keys {
+		var p, tweakedP, sum btcec.JacobianPoint
+		key.AsJacobian(&p)
+
+		a := aggregationCoefficient(keysHash, secondKey, key)
+		btcec.ScalarMultNonConst(a, &p, &tweakedP)
+		btcec.AddNonConst(&q, &tweakedP, &sum)
+		q.Set(&sum)
+	}
+	if isInfinity(&q) {
+		return nil, ErrAggregateKeyInfinity
+	}
+	q.ToAffine()
+
+	aggKey := &AggregateKey{
+		PreTweakedKey: btcec.NewPublicKey(&q.X, &q.Y),
+	}
+	aggKey.parityAcc.SetInt(1)
+
+	for i, tweak := range tweaks {
+		if err := aggKey.applyTweak(&q, tweak); err != nil {
+			return nil, fmt.Errorf("unable to apply tweak #%d: %w",
+				i, err)
+		}
+	}
+	aggKey.FinalKey = btcec.NewPublicKey(&q.X, &q.Y)
+
+	return aggKey, nil
+}
+
+// applyTweak applies the passed tweak to the affine point q, updating it in
+// place along with the parity and tweak accumulators as described by the
+// ApplyTweak algorithm of BIP 327.
+func (k *AggregateKey) applyTweak(q *btcec.JacobianPoint,
+	tweak KeyTweakDesc) error {
+
+	// g is -1 for x-only tweaks of a key with an odd y coordinate, since
+	// the x-only form of the key implicitly has an even y coordinate.
+	var g btcec.ModNScalar
+	g.SetInt(1)
+	if tweak.IsXOnly && !hasEvenY(q) {
+		g.Negate()
+	}
+
+	var t btcec.ModNScalar
+	if overflow := t.SetBytes(&tweak.Tweak); overflow == 1 {
+		return ErrTweakOverflow
+	}
+
+	// Q' = g*Q + t*G.
+	var gQ, tG, tweakedQ btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&g, q, &gQ)
+	btcec.ScalarBaseMultNonConst(&t, &tG)
+	btcec.AddNonConst(&gQ, &tG, &tweakedQ)
+	q.Set(&tweakedQ)
+	if isInfinity(q) {
+		return ErrAggregateKeyInfinity
+	}
+	q.ToAffine()
+
+	// gacc' = g*gacc, tacc' = t + g*tacc.
+	k.parityAcc.Mul(&g)
+	k.tweakAcc.Mul(&g).Add(&t)
+
+	return nil
+}
+
+// XOnlyKey returns the BIP 340 x-only serialization of the final aggregated
+// key, which is the key the aggregated signature is valid under.
+func (k *AggregateKey) XOnlyKey() []byte {
+	return schnorr.SerializePubKey(k.FinalKey)
+}
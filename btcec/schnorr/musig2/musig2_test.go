@@ -0,0 +1,627 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcec"
+)
+
+// decodeHex decodes the passed hex string and returns the resulting bytes.  It
+// panics if an error occurs.  This is only used in the tests as a helper since
+// the only way it can fail is if there is an error in the test source code.
+func decodeHex(hexStr string) []byte {
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		panic("invalid hex string in test source: err " + err.Error() +
+			", hex: " + hexStr)
+	}
+
+	return b
+}
+
+// mustParsePubKey parses the passed hex encoded compressed public key.  It
+// panics if an error occurs.
+func mustParsePubKey(hexStr string) *btcec.PublicKey {
+	key, err := btcec.ParsePubKey(decodeHex(hexStr))
+	if err != nil {
+		panic("invalid public key in test source: " + hexStr)
+	}
+
+	return key
+}
+
+// mustParseNonce parses the passed hex encoded public nonce.
+func mustParseNonce(hexStr string) [PubNonceSize]byte {
+	var nonce [PubNonceSize]byte
+	copy(nonce[:], decodeHex(hexStr))
+	return nonce
+}
+
+// keyAggTestKeys are the public keys used by the BIP 327 key aggregation test
+// vectors.
+var keyAggTestKeys = []string{
+	"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+	"03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+	"023590A94E768F8E1815C2F24B4D80A8E3149316C3518CE7B7AD338368D038CA66",
+}
+
+// TestKeySort ensures keys are sorted as specified by the BIP 327 test
+// vectors.
+func TestKeySort(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+		"023590A94E768F8E1815C2F24B4D80A8E3149316C3518CE7B7AD338368D038CA66",
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EFF",
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+	}
+	expected := []string{
+		"023590A94E768F8E1815C2F24B4D80A8E3149316C3518CE7B7AD338368D038CA66",
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		"02DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EFF",
+		"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+	}
+
+	var pubKeys []*btcec.PublicKey
+	for _, key := range keys {
+		pubKeys = append(pubKeys, mustParsePubKey(key))
+	}
+	sorted := SortKeys(pubKeys)
+	for i, key := range sorted {
+		got := strings.ToUpper(hex.EncodeToString(key.SerializeCompressed()))
+		if got != expected[i] {
+			t.Fatalf("key #%d: got %s, want %s", i, got, expected[i])
+		}
+	}
+
+	// The passed keys must not be modified.
+	if !pubKeys[0].IsEqual(mustParsePubKey(keys[0])) {
+		t.Fatalf("input keys were modified")
+	}
+}
+
+// TestKeyAggregation ensures keys are aggregated as specified by the BIP 327
+// test vectors.
+func TestKeyAggregation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		keyIndices []int
+		expected   string
+	}{{
+		keyIndices: []int{0, 1, 2},
+		expected:   "90539EEDE565F5D054F32CC0C220126889ED1E5D193BAF15AEF344FE59D4610C",
+	}, {
+		keyIndices: []int{2, 1, 0},
+		expected:   "6204DE8B083426DC6EAF9502D27024D53FC826BF7D2012148A0575435DF54B2B",
+	}, {
+		keyIndices: []int{0, 0, 0},
+		expected:   "B436E3BAD62B8CD409969A224731C193D051162D8C5AE8B109306127DA3AA935",
+	}, {
+		keyIndices: []int{0, 0, 1, 1},
+		expected:   "69BC22BFA5D106306E48A20679DE1D7389386124D07571D0D872686028C26A3E",
+	}}
+
+	for i, test := range tests {
+		var keys []*btcec.PublicKey
+		for _, idx := range test.keyIndices {
+			keys = append(keys, mustParsePubKey(keyAggTestKeys[idx]))
+		}
+
+		aggKey, err := AggregateKeys(keys, false)
+		if err != nil {
+			t.Fatalf("test #%d: unable to aggregate keys: %v", i, err)
+		}
+		got := strings.ToUpper(hex.EncodeToString(aggKey.XOnlyKey()))
+		if got != test.expected {
+			t.Fatalf("test #%d: got %s, want %s", i, got,
+				test.expected)
+		}
+	}
+
+	// An empty key set can't be aggregated.
+	if _, err := AggregateKeys(nil, false); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("unexpected error for empty key set: %v", err)
+	}
+
+	// A tweak that is not less than the group order is invalid.
+	var tweak KeyTweakDesc
+	copy(tweak.Tweak[:], decodeHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFE"+
+		"BAAEDCE6AF48A03BBFD25E8CD0364141"))
+	keys := []*btcec.PublicKey{mustParsePubKey(keyAggTestKeys[0])}
+	_, err := AggregateKeys(keys, false, tweak)
+	if !errors.Is(err, ErrTweakOverflow) {
+		t.Fatalf("unexpected error for overflowing tweak: %v", err)
+	}
+}
+
+// TestNonceAggregation ensures public nonces are aggregated as specified by
+// the BIP 327 test vectors.
+func TestNonceAggregation(t *testing.T) {
+	t.Parallel()
+
+	nonces := [][PubNonceSize]byte{
+		mustParseNonce("020151C80F435648DF67A22B749CD798CE54E0321D034B92B709B567D60A42E666" +
+			"03BA47FBC1834437B3212E89A84D8425E7BF12E0245D98262268EBDCB385D50641"),
+		mustParseNonce("03FF406FFD8ADB9CD29877E4985014F66A59F6CD01C0E88CAA8E5F3166B1F676A6" +
+			"0248C264CDD57D3C24D79990B0F865674EB62A0F9018277A95011B41BFC193B833"),
+	}
+	expected := "035FE1873B4F2967F52FEA4A06AD5A8ECCBE9D0FD73068012C894E2E87CCB5804B" +
+		"024725377345BDE0E9C33AF3C43C0A29A9249F2F2956FA8CFEB55C8573D0262DC8"
+
+	aggNonce, err := AggregateNonces(nonces)
+	if err != nil {
+		t.Fatalf("unable to aggregate nonces: %v", err)
+	}
+	got := strings.ToUpper(hex.EncodeToString(aggNonce[:]))
+	if got != expected {
+		t.Fatalf("got %s, want %s", got, expected)
+	}
+
+	// Nonces that sum to the point at infinity are encoded as zeros.
+	nonce := nonces[0]
+	var negNonce [PubNonceSize]byte
+	copy(negNonce[:], nonce[:])
+	negNonce[0] ^= 0x01
+	negNonce[33] ^= 0x01
+	aggNonce, err = AggregateNonces([][PubNonceSize]byte{nonce, negNonce})
+	if err != nil {
+		t.Fatalf("unable to aggregate nonces: %v", err)
+	}
+	if aggNonce != [PubNonceSize]byte{} {
+		t.Fatalf("got %x, want infinity", aggNonce)
+	}
+
+	// A nonce with an invalid point is rejected.
+	var badNonce [PubNonceSize]byte
+	copy(badNonce[:], nonce[:])
+	badNonce[0] = 0x04
+	_, err = AggregateNonces([][PubNonceSize]byte{nonce, badNonce})
+	if !errors.Is(err, ErrInvalidPubNonce) {
+		t.Fatalf("unexpected error for invalid nonce: %v", err)
+	}
+}
+
+// TestNonceGen ensures that generated nonces commit to all of their inputs,
+// that the public nonce matches the secret nonce and that the nonces match the
+// BIP 327 test vectors.
+func TestNonceGen(t *testing.T) {
+	t.Parallel()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(decodeHex(
+		"7FB9E0E687ADA1EEBF7ECFE2F21E73EBDB51A7D450948DFE8D76D7F2D1007671",
+	))
+	zeroRand := func() NonceGenOption {
+		return WithCustomRand(bytes.NewReader(make([]byte, 32)))
+	}
+
+	if _, err := GenNonces(zeroRand()); !errors.Is(err, ErrNoncePubKeyRequired) {
+		t.Fatalf("unexpected error without public key: %v", err)
+	}
+
+	nonces, err := GenNonces(WithPublicKey(pubKey), zeroRand())
+	if err != nil {
+		t.Fatalf("unable to generate nonces: %v", err)
+	}
+
+	// The public nonce must be the secret nonce times G, and the secret
+	// nonce must commit to the public key.
+	for j := 0; j < 2; j++ {
+		var k btcec.ModNScalar
+		k.SetByteSlice(nonces.SecNonce[j*32 : (j+1)*32])
+		var r btcec.JacobianPoint
+		btcec.ScalarBaseMultNonConst(&k, &r)
+		r.ToAffine()
+		rBytes := btcec.NewPublicKey(&r.X, &r.Y).SerializeCompressed()
+		if !bytes.Equal(rBytes, nonces.PubNonce[j*33:(j+1)*33]) {
+			t.Fatalf("public nonce #%d doesn't match secret nonce", j)
+		}
+	}
+	if !bytes.Equal(nonces.SecNonce[64:], pubKey.SerializeCompressed()) {
+		t.Fatalf("secret nonce doesn't commit to the public key")
+	}
+
+	// Every optional input must change the generated nonces.
+	options := []NonceGenOption{
+		WithNonceSecretKeyAux(privKey),
+		WithNonceCombinedKeyAux(bytes.Repeat([]byte{0x07}, 32)),
+		WithNonceMessageAux(nil),
+		WithNonceMessageAux(bytes.Repeat([]byte{0x01}, 32)),
+		WithNonceAuxInput(bytes.Repeat([]byte{0x08}, 32)),
+	}
+	seen := map[[PubNonceSize]byte]struct{}{nonces.PubNonce: {}}
+	for i, option := range options {
+		n, err := GenNonces(WithPublicKey(pubKey), zeroRand(), option)
+		if err != nil {
+			t.Fatalf("option #%d: unable to generate nonces: %v", i,
+				err)
+		}
+		if _, ok := seen[n.PubNonce]; ok {
+			t.Fatalf("option #%d: nonces don't commit to the input", i)
+		}
+		seen[n.PubNonce] = struct{}{}
+	}
+
+	// Ensure the nonces match the BIP 327 nonce generation test vectors
+	// when the randomness is injected.  Empty optional inputs are absent
+	// except for the message, which is only absent when nil.
+	pubKeyHex := "024D4B6CD1361032CA9BD2AEB9D900AA4D45D9EAD80AC9423374C451" +
+		"A7254D0766"
+	tests := []struct {
+		rand     string
+		secKey   string
+		pubKey   string
+		aggKey   string
+		msg      *string
+		extraIn  string
+		secNonce string
+	}{{
+		rand:    strings.Repeat("00", 32),
+		secKey:  strings.Repeat("02", 32),
+		pubKey:  pubKeyHex,
+		aggKey:  strings.Repeat("07", 32),
+		msg:     stringPtr(strings.Repeat("01", 32)),
+		extraIn: strings.Repeat("08", 32),
+		secNonce: "227243DCB40EF2A13A981DB188FA433717B506BDFA14B1AE47D5DC02" +
+			"7C9C3B9EF2370B2AD206E724243215137C86365699361126991E6FEC" +
+			"816845F837BDDAC3" + pubKeyHex,
+	}, {
+		rand:    strings.Repeat("00", 32),
+		secKey:  strings.Repeat("02", 32),
+		pubKey:  pubKeyHex,
+		aggKey:  strings.Repeat("07", 32),
+		msg:     stringPtr(""),
+		extraIn: strings.Repeat("08", 32),
+		secNonce: "CD0F47FE471D6788FF3243F47345EA0A179AEF69476BE8348322EF39" +
+			"C2723318870C2065AFB52DEDF02BF4FDBF6D2F442E608692F50C2374" +
+			"C08FFFE57042A61C" + pubKeyHex,
+	}, {
+		rand:    strings.Repeat("00", 32),
+		secKey:  strings.Repeat("02", 32),
+		pubKey:  pubKeyHex,
+		aggKey:  strings.Repeat("07", 32),
+		msg:     stringPtr(strings.Repeat("26", 38)),
+		extraIn: strings.Repeat("08", 32),
+		secNonce: "011F8BC60EF061DEEF4D72A0A87200D9994B3F0CD9867910085C38D5" +
+			"366E3E6B9FF03BC0124E56B24069E91EC3F162378983F194E8BD0ED8" +
+			"9BE3059649EAE262" + pubKeyHex,
+	}, {
+		rand: strings.Repeat("00", 32),
+		pubKey: "02F9308A019258C31049344F85F89D5229B531C845836F99B08601F1" +
+			"13BCE036F9",
+		secNonce: "890E83616A3BC4640AB9B6374F21C81FF89CDDDBAFAA7475AE2A102A" +
+			"92E3EDB29FD7E874E23342813A60D9646948242646B7951CA046B4B3" +
+			"6D7D6078506D3C9402F9308A019258C31049344F85F89D5229B531C8" +
+			"45836F99B08601F113BCE036F9",
+	}}
+	for i, test := range tests {
+		options := []NonceGenOption{
+			WithCustomRand(bytes.NewReader(decodeHex(test.rand))),
+			WithPublicKey(mustParsePubKey(test.pubKey)),
+		}
+		if test.secKey != "" {
+			secKey, _ := btcec.PrivKeyFromBytes(decodeHex(test.secKey))
+			options = append(options, WithNonceSecretKeyAux(secKey))
+		}
+		if test.aggKey != "" {
+			options = append(options, WithNonceCombinedKeyAux(
+				decodeHex(test.aggKey),
+			))
+		}
+		if test.msg != nil {
+			options = append(options, WithNonceMessageAux(
+				decodeHex(*test.msg),
+			))
+		}
+		if test.extraIn != "" {
+			options = append(options, WithNonceAuxInput(
+				decodeHex(test.extraIn),
+			))
+		}
+
+		nonces, err := GenNonces(options...)
+		if err != nil {
+			t.Fatalf("test #%d: unable to generate nonces: %v", i,
+				err)
+		}
+		if !bytes.Equal(nonces.SecNonce[:], decodeHex(test.secNonce)) {
+			t.Fatalf("test #%d: mismatched secret nonce: got %X, "+
+				"want %s", i, nonces.SecNonce, test.secNonce)
+		}
+	}
+}
+
+// stringPtr returns a pointer to the passed string.
+func stringPtr(s string) *string {
+	return &s
+}
+
+// Values shared by the BIP 327 signing test vectors.
+var (
+	signTestSecKey = "7FB9E0E687ADA1EEBF7ECFE2F21E73EBDB51A7D450948DFE8D76D7F2D1007671"
+
+	signTestKeys = []string{
+		"03935F972DA013F80AE011890FA89B67A27B7BE6CCB24D3274D18B2D4067F261A9",
+		"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		"02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA661",
+	}
+
+	signTestSecNonce = "508B81A611F100A6B2B6B29656590898AF488BCF2E1F55CF22E5CFB84421FE61" +
+		"FA27FD49B1D50085B481285E1CA205D55C82CC1B31FF5CD54A489829355901F7" +
+		"03935F972DA013F80AE011890FA89B67A27B7BE6CCB24D3274D18B2D4067F261A9"
+
+	signTestPubNonces = []string{
+		"0337C87821AFD50A8644D820A8F3E02E499C931865C2360FB43D0A0D20DAFE07EA" +
+			"0287BF891D2A6DEAEBADC909352AA9405D1428C15F4B75F04DAE642A95C2548480",
+		"0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798" +
+			"0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+		"032DE2662628C90B03F5E720284EB52FF7D71F4284F627B68A853D78C78E1FFE93" +
+			"03E4C5524E83FFE1493B9077CF1CA6BEB2090C93D930321071AD40B2F44E599046",
+		"0237C87821AFD50A8644D820A8F3E02E499C931865C2360FB43D0A0D20DAFE07EA" +
+			"0387BF891D2A6DEAEBADC909352AA9405D1428C15F4B75F04DAE642A95C2548480",
+	}
+
+	signTestAggNonces = []string{
+		"028465FCF0BBDBCF443AABCCE533D42B4B5A10966AC09A49655E8C42DAAB8FCD61" +
+			"037496A3CC86926D452CAFCFD55D25972CA1675D549310DE296BFF42F72EEEA8C9",
+		"000000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000000000000000000000000000000000000000000000000000000000000",
+	}
+
+	signTestMsgs = []string{
+		"F95466D086770E689964664219266FE5ED215C92AE20BAB5C9D79ADDDDF3C0CF",
+		"",
+		"2626262626262626262626262626262626262626262626262626262626262626262626262626",
+	}
+)
+
+// TestSignVerify ensures partial signatures are created and verified as
+// specified by the BIP 327 test vectors.
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(decodeHex(signTestSecKey))
+
+	tests := []struct {
+		keyIndices   []int
+		nonceIndices []int
+		aggNonceIdx  int
+		msgIdx       int
+		signerIdx    int
+		expected     string
+	}{{
+		keyIndices:   []int{0, 1, 2},
+		nonceIndices: []int{0, 1, 2},
+		signerIdx:    0,
+		expected:     "012ABBCB52B3016AC03AD82395A1A415C48B93DEF78718E62A7A90052FE224FB",
+	}, {
+		keyIndices:   []int{1, 0, 2},
+		nonceIndices: []int{1, 0, 2},
+		signerIdx:    1,
+		expected:     "9FF2F7AAA856150CC8819254218D3ADEEB0535269051897724F9DB3789513A52",
+	}, {
+		keyIndices:   []int{1, 2, 0},
+		nonceIndices: []int{1, 2, 0},
+		signerIdx:    2,
+		expected:     "FA23C359F6FAC4E7796BB93BC9F0532A95468C539BA20FF86D7C76ED92227900",
+	}, {
+		// The aggregated nonce is the point at infinity.
+		keyIndices:   []int{0, 1},
+		nonceIndices: []int{0, 3},
+		aggNonceIdx:  1,
+		signerIdx:    0,
+		expected:     "AE386064B26105404798F75DE2EB9AF5EDA5387B064B83D049CB7C5E08879531",
+	}, {
+		// An empty message.
+		keyIndices:   []int{0, 1, 2},
+		nonceIndices: []int{0, 1, 2},
+		msgIdx:       1,
+		signerIdx:    0,
+		expected:     "D7D63FFD644CCDA4E62BC2BC0B1D02DD32A1DC3030E155195810231D1037D82D",
+	}, {
+		// A 38-byte message.
+		keyIndices:   []int{0, 1, 2},
+		nonceIndices: []int{0, 1, 2},
+		msgIdx:       2,
+		signerIdx:    0,
+		expected:     "E184351828DA5094A97C79CABDAAA0BFB87608C32E8829A4DF5340A6F243B78C",
+	}}
+
+	for i, test := range tests {
+		var keys []*btcec.PublicKey
+		for _, idx := range test.keyIndices {
+			keys = append(keys, mustParsePubKey(signTestKeys[idx]))
+		}
+		var pubNonces [][PubNonceSize]byte
+		for _, idx := range test.nonceIndices {
+			pubNonces = append(
+				pubNonces, mustParseNonce(signTestPubNonces[idx]),
+			)
+		}
+		aggNonce := mustParseNonce(signTestAggNonces[test.aggNonceIdx])
+		msg := decodeHex(signTestMsgs[test.msgIdx])
+
+		// The aggregated nonce in the vector must match the
+		// aggregation of the public nonces.
+		gotAggNonce, err := AggregateNonces(pubNonces)
+		if err != nil {
+			t.Fatalf("test #%d: unable to aggregate nonces: %v", i,
+				err)
+		}
+		if gotAggNonce != aggNonce {
+			t.Fatalf("test #%d: got aggregated nonce %x, want %x", i,
+				gotAggNonce, aggNonce)
+		}
+
+		var secNonce [SecNonceSize]byte
+		copy(secNonce[:], decodeHex(signTestSecNonce))
+		sig, err := Sign(&secNonce, privKey, aggNonce, keys, msg)
+		if err != nil {
+			t.Fatalf("test #%d: unable to sign: %v", i, err)
+		}
+		sigBytes := sig.Serialize()
+		got := strings.ToUpper(hex.EncodeToString(sigBytes[:]))
+		if got != test.expected {
+			t.Fatalf("test #%d: got %s, want %s", i, got,
+				test.expected)
+		}
+
+		err = sig.Verify(
+			pubNonces[test.signerIdx], aggNonce, keys, pubKey, msg,
+		)
+		if err != nil {
+			t.Fatalf("test #%d: unable to verify: %v", i, err)
+		}
+
+		// A signature for a different message must not verify.
+		err = sig.Verify(
+			pubNonces[test.signerIdx], aggNonce, keys, pubKey,
+			[]byte("wrong message"),
+		)
+		if !errors.Is(err, ErrPartialSigInvalid) {
+			t.Fatalf("test #%d: unexpected error for wrong "+
+				"message: %v", i, err)
+		}
+
+		// The secret nonce must be unusable after signing.
+		_, err = Sign(&secNonce, privKey, aggNonce, keys, msg)
+		if !errors.Is(err, ErrSecNonceZero) {
+			t.Fatalf("test #%d: unexpected error for reused "+
+				"nonce: %v", i, err)
+		}
+	}
+}
+
+// TestSignErrors ensures signing fails for invalid inputs.
+func TestSignErrors(t *testing.T) {
+	t.Parallel()
+
+	privKey, _ := btcec.PrivKeyFromBytes(decodeHex(signTestSecKey))
+	var keys []*btcec.PublicKey
+	for _, key := range signTestKeys {
+		keys = append(keys, mustParsePubKey(key))
+	}
+	aggNonce := mustParseNonce(signTestAggNonces[0])
+	msg := decodeHex(signTestMsgs[0])
+
+	// The signer must be part of the key set.
+	var secNonce [SecNonceSize]byte
+	copy(secNonce[:], decodeHex(signTestSecNonce))
+	_, err := Sign(&secNonce, privKey, aggNonce, keys[1:], msg)
+	if !errors.Is(err, ErrSignerNotInKeySet) {
+		t.Fatalf("unexpected error for signer not in key set: %v", err)
+	}
+
+	// The secret nonce must be for the signing key.
+	otherKey, _ := btcec.PrivKeyFromBytes(decodeHex(
+		"0202020202020202020202020202020202020202020202020202020202020202",
+	))
+	copy(secNonce[:], decodeHex(signTestSecNonce))
+	_, err = Sign(&secNonce, otherKey, aggNonce, keys, msg)
+	if !errors.Is(err, ErrSecNoncePubKeyMismatch) {
+		t.Fatalf("unexpected error for wrong nonce key: %v", err)
+	}
+
+	// The aggregated nonce must be made up of valid points.
+	badAggNonce := aggNonce
+	badAggNonce[0] = 0x04
+	copy(secNonce[:], decodeHex(signTestSecNonce))
+	_, err = Sign(&secNonce, privKey, badAggNonce, keys, msg)
+	if !errors.Is(err, ErrInvalidAggNonce) {
+		t.Fatalf("unexpected error for invalid aggregated nonce: %v",
+			err)
+	}
+}
+
+// TestTweakedSign ensures partial signatures for tweaked keys are created as
+// specified by the BIP 327 test vectors.
+func TestTweakedSign(t *testing.T) {
+	t.Parallel()
+
+	privKey, pubKey := btcec.PrivKeyFromBytes(decodeHex(signTestSecKey))
+	keys := []*btcec.PublicKey{
+		mustParsePubKey("02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9"),
+		mustParsePubKey("02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659"),
+		pubKey,
+	}
+	aggNonce := mustParseNonce(signTestAggNonces[0])
+	msg := decodeHex(signTestMsgs[0])
+
+	var tweak [32]byte
+	copy(tweak[:], decodeHex(
+		"E8F791FF9225A2AF0102AFFF4A9A723D9612A682A25EBE79802B263CDFCD83BB",
+	))
+
+	tests := []struct {
+		isXOnly  bool
+		expected string
+	}{{
+		isXOnly:  true,
+		expected: "E28A5C66E61E178C2BA19DB77B6CF9F7E2F0F56C17918CD13135E60CC848FE91",
+	}, {
+		isXOnly:  false,
+		expected: "38B0767798252F21BF5702C48028B095428320F73A4B14DB1E25DE58543D2D2D",
+	}}
+
+	for i, test := range tests {
+		tweakDesc := KeyTweakDesc{Tweak: tweak, IsXOnly: test.isXOnly}
+
+		var secNonce [SecNonceSize]byte
+		copy(secNonce[:], decodeHex(signTestSecNonce))
+		sig, err := Sign(
+			&secNonce, privKey, aggNonce, keys, msg,
+			WithTweaks(tweakDesc),
+		)
+		if err != nil {
+			t.Fatalf("test #%d: unable to sign: %v", i, err)
+		}
+		sigBytes := sig.Serialize()
+		got := strings.ToUpper(hex.EncodeToString(sigBytes[:]))
+		if got != test.expected {
+			t.Fatalf("test #%d: got %s, want %s", i, got,
+				test.expected)
+		}
+	}
+}
+
+// TestPartialSignatureParse ensures partial signatures round trip and that
+// overflowing values are rejected.
+func TestPartialSignatureParse(t *testing.T) {
+	t.Parallel()
+
+	sigBytes := decodeHex(
+		"012ABBCB52B3016AC03AD82395A1A415C48B93DEF78718E62A7A90052FE224FB",
+	)
+	sig, err := ParsePartialSignature(sigBytes)
+	if err != nil {
+		t.Fatalf("unable to parse signature: %v", err)
+	}
+	serialized := sig.Serialize()
+	if !bytes.Equal(serialized[:], sigBytes) {
+		t.Fatalf("got %x, want %x", serialized, sigBytes)
+	}
+
+	_, err = ParsePartialSignature(decodeHex(
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141",
+	))
+	if !errors.Is(err, ErrPartialSigOverflow) {
+		t.Fatalf("unexpected error for overflowing signature: %v", err)
+	}
+
+	if _, err := ParsePartialSignature(sigBytes[1:]); err == nil {
+		t.Fatalf("parsed a short signature")
+	}
+}
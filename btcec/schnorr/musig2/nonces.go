@@ -0,0 +1,266 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+)
+
+const (
+	// PubNonceSize is the size of a public nonce, which consists of two
+	// compressed points.
+	PubNonceSize = 66
+
+	// SecNonceSize is the size of a secret nonce, which consists of two
+	// 32-byte scalars followed by the compressed public key of the
+	// signer.
+	SecNonceSize = 97
+)
+
+var (
+	// nonceAuxTag is the tagged hash tag used to mix the secret key into
+	// the randomness used to generate nonces.
+	nonceAuxTag = []byte("MuSig/aux")
+
+	// nonceGenTag is the tagged hash tag used to derive the secret nonces.
+	nonceGenTag = []byte("MuSig/nonce")
+
+	// ErrNoncePubKeyRequired is returned when nonces are generated
+	// without the public key of the signer.
+	ErrNoncePubKeyRequired = errors.New("the public key of the signer " +
+		"is required to generate nonces")
+
+	// ErrNonceZero is returned when a generated secret nonce is zero.
+	ErrNonceZero = errors.New("generated secret nonce is zero")
+
+	// ErrInvalidPubNonce is returned when a public nonce isn't made up of
+	// two valid points.
+	ErrInvalidPubNonce = errors.New("invalid public nonce")
+)
+
+// Nonces houses the secret nonce of a signer along with the public nonce that
+// is shared with the other signers.
+type Nonces struct {
+	// PubNonce is the public nonce, which is sent to the other signers.
+	PubNonce [PubNonceSize]byte
+
+	// SecNonce is the secret nonce.  It must never be shared, and must
+	// never be used to sign more than once.
+	SecNonce [SecNonceSize]byte
+}
+
+// nonceGenOpts houses the values that are mixed into the generated nonces.
+type nonceGenOpts struct {
+	randReader  io.Reader
+	publicKey   []byte
+	secretKey   []byte
+	combinedKey []byte
+	msg         []byte
+	hasMsg      bool
+	auxInput    []byte
+}
+
+// NonceGenOption is a functional option that adds additional inputs to the
+// nonce generation.
+type NonceGenOption func(*nonceGenOpts)
+
+// WithPublicKey sets the public key of the signer.  This option is required.
+func WithPublicKey(pubKey *btcec.PublicKey) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		o.publicKey = pubKey.SerializeCompressed()
+	}
+}
+
+// WithNonceSecretKeyAux mixes the secret key of the signer into the nonce
+// generation, which protects against a faulty random number generator.
+func WithNonceSecretKeyAux(secKey *btcec.PrivateKey) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		keyBytes := secKey.Key.Bytes()
+		o.secretKey = keyBytes[:]
+	}
+}
+
+// WithNonceCombinedKeyAux mixes the x-only aggregated key into the nonce
+// generation.
+func WithNonceCombinedKeyAux(combinedKey []byte) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		o.combinedKey = combinedKey
+	}
+}
+
+// WithNonceMessageAux mixes the message to be signed into the nonce
+// generation.
+func WithNonceMessageAux(msg []byte) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		o.msg = msg
+		o.hasMsg = true
+	}
+}
+
+// WithNonceAuxInput mixes arbitrary extra input into the nonce generation.
+func WithNonceAuxInput(aux []byte) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		o.auxInput = aux
+	}
+}
+
+// WithCustomRand sets the source of the randomness used to generate the
+// nonces.  This should only be used for testing.
+func WithCustomRand(r io.Reader) NonceGenOption {
+	return func(o *nonceGenOpts) {
+		o.randReader = r
+	}
+}
+
+// writeLenPrefixed writes the passed data to the buffer prefixed with its
+// length encoded in the passed number of big-endian bytes.
+func writeLenPrefixed(w *bytes.Buffer, data []byte, lenSize int) {
+	var lenBytes [8]byte
+	binary.BigEndian.PutUint64(lenBytes[:], uint64(len(data)))
+	w.Write(lenBytes[8-lenSize:])
+	w.Write(data)
+}
+
+// genNonceAuxBytes derives the i-th secret nonce scalar from the passed
+// randomness and options.
+func genNonceAuxBytes(randBytes []byte, i byte,
+	opts *nonceGenOpts) *btcec.ModNScalar {
+
+	var w bytes.Buffer
+	w.Write(randBytes)
+	writeLenPrefixed(&w, opts.publicKey, 1)
+	writeLenPrefixed(&w, opts.combinedKey, 1)
+	if opts.hasMsg {
+		w.WriteByte(1)
+		writeLenPrefixed(&w, opts.msg, 8)
+	} else {
+		w.WriteByte(0)
+	}
+	writeLenPrefixed(&w, opts.auxInput, 4)
+	w.WriteByte(i)
+
+	h := chainhash.TaggedHash(nonceGenTag, w.Bytes())
+
+	var k btcec.ModNScalar
+	k.SetByteSlice(h[:])
+	return &k
+}
+
+// GenNonces generates a fresh pair of nonces as described by the NonceGen
+// algorithm of BIP 327.  The public key of the signer must be passed using
+// WithPublicKey.  The other options add extra inputs, which make the nonces
+// robust against a faulty random number generator.
+func GenNonces(options ...NonceGenOption) (*Nonces, error) {
+	opts := &nonceGenOpts{
+		randReader: rand.Reader,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if len(opts.publicKey) == 0 {
+		return nil, ErrNoncePubKeyRequired
+	}
+
+	var randBytes [32]byte
+	if _, err := io.ReadFull(opts.randReader, randBytes[:]); err != nil {
+		return nil, fmt.Errorf("unable to read randomness: %w", err)
+	}
+
+	// Mix the secret key into the randomness when it's known.
+	if len(opts.secretKey) == 32 {
+		auxHash := chainhash.TaggedHash(nonceAuxTag, randBytes[:])
+		for i := range randBytes {
+			randBytes[i] = opts.secretKey[i] ^ auxHash[i]
+		}
+	}
+
+	k1 := genNonceAuxBytes(randBytes[:], 0, opts)
+	k2 := genNonceAuxBytes(randBytes[:], 1, opts)
+	if k1.IsZero() || k2.IsZero() {
+		return nil, ErrNonceZero
+	}
+
+	var r1, r2 btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(k1, &r1)
+	btcec.ScalarBaseMultNonConst(k2, &r2)
+	r1.ToAffine()
+	r2.ToAffine()
+
+	var nonces Nonces
+	r1Bytes := btcec.NewPublicKey(&r1.X, &r1.Y).SerializeCompressed()
+	r2Bytes := btcec.NewPublicKey(&r2.X, &r2.Y).SerializeCompressed()
+	copy(nonces.PubNonce[:], r1Bytes)
+	copy(nonces.PubNonce[33:], r2Bytes)
+	k1.PutBytesUnchecked(nonces.SecNonce[:32])
+	k2.PutBytesUnchecked(nonces.SecNonce[32:64])
+	copy(nonces.SecNonce[64:], opts.publicKey)
+
+	k1.Zero()
+	k2.Zero()
+
+	return &nonces, nil
+}
+
+// parsePointExt parses a compressed point, where 33 zero bytes encode the
+// point at infinity.
+func parsePointExt(b []byte, p *btcec.JacobianPoint) error {
+	if bytes.Equal(b, make([]byte, btcec.PubKeyBytesLenCompressed)) {
+		*p = btcec.JacobianPoint{}
+		return nil
+	}
+
+	key, err := btcec.ParsePubKey(b)
+	if err != nil {
+		return err
+	}
+	key.AsJacobian(p)
+	return nil
+}
+
+// serializePointExt serializes the passed point in compressed form, where
+// the point at infinity is encoded as 33 zero bytes.
+func serializePointExt(p *btcec.JacobianPoint) []byte {
+	if isInfinity(p) {
+		return make([]byte, btcec.PubKeyBytesLenCompressed)
+	}
+
+	p.ToAffine()
+	return btcec.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+}
+
+// AggregateNonces combines the public nonces of all of the signers into a
+// single aggregated nonce as described by the NonceAgg algorithm of BIP 327.
+func AggregateNonces(pubNonces [][PubNonceSize]byte) ([PubNonceSize]byte,
+	error) {
+
+	var aggNonce [PubNonceSize]byte
+	for j := 0; j < 2; j++ {
+		var r btcec.JacobianPoint
+		for i, pubNonce := range pubNonces {
+			nonce, err := btcec.ParsePubKey(pubNonce[j*33 : (j+1)*33])
+			if err != nil {
+				return aggNonce, fmt.Errorf("%w from signer #%d: %v",
+					ErrInvalidPubNonce, i, err)
+			}
+
+			var p, sum btcec.JacobianPoint
+			nonce.AsJacobian(&p)
+			btcec.AddNonConst(&r, &p, &sum)
+			r.Set(&sum)
+		}
+
+		copy(aggNonce[j*33:], serializePointExt(&r))
+	}
+
+	return aggNonce, nil
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package musig2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+)
+
+// PartialSigSize is the size of a serialized partial signature.
+const PartialSigSize = 32
+
+var (
+	// nonceCoefTag is the tagged hash tag used to compute the nonce
+	// coefficient.
+	nonceCoefTag = []byte("MuSig/noncecoef")
+
+	// ErrSecNonceZero is returned when a secret nonce is zero, which is
+	// the case once it has already been used to sign.
+	ErrSecNonceZero = errors.New("secret nonce is blank or has already " +
+		"been used")
+
+	// ErrSecNoncePubKeyMismatch is returned when the secret nonce was
+	// generated for a different public key than the signing key.
+	ErrSecNoncePubKeyMismatch = errors.New("secret nonce was generated " +
+		"for a different public key")
+
+	// ErrSignerNotInKeySet is returned when the signing key isn't part of
+	// the set of keys being aggregated.
+	ErrSignerNotInKeySet = errors.New("signing key is not in the key set")
+
+	// ErrInvalidAggNonce is returned when the aggregated nonce isn't made
+	// up of two valid points.
+	ErrInvalidAggNonce = errors.New("invalid aggregated nonce")
+
+	// ErrPartialSigOverflow is returned when a partial signature is not
+	// less than the order of the curve.
+	ErrPartialSigOverflow = errors.New("partial signature overflows the " +
+		"group order")
+
+	// ErrPartialSigInvalid is returned when a partial signature fails to
+	// verify.
+	ErrPartialSigInvalid = errors.New("partial signature is invalid")
+)
+
+// PartialSignature is the partial signature of a single signer.
+type PartialSignature struct {
+	// S is the partial signature scalar.
+	S btcec.ModNScalar
+}
+
+// Serialize returns the 32-byte big-endian serialization of the partial
+// signature.
+func (p *PartialSignature) Serialize() [PartialSigSize]byte {
+	return p.S.Bytes()
+}
+
+// ParsePartialSignature parses a 32-byte partial signature.
+func ParsePartialSignature(b []byte) (*PartialSignature, error) {
+	if len(b) != PartialSigSize {
+		return nil, fmt.Errorf("malformed partial signature: got %d "+
+			"bytes, want %d", len(b), PartialSigSize)
+	}
+
+	var sig PartialSignature
+	if overflow := sig.S.SetByteSlice(b); overflow {
+		return nil, ErrPartialSigOverflow
+	}
+	return &sig, nil
+}
+
+// signOpts houses the options that describe the key aggregation of a signing
+// session.
+type signOpts struct {
+	sortKeys bool
+	tweaks   []KeyTweakDesc
+}
+
+// SignOption is a functional option that describes how the keys of a signing
+// session are aggregated.
+type SignOption func(*signOpts)
+
+// WithSortedKeys sorts the keys before aggregating them.
+func WithSortedKeys() SignOption {
+	return func(o *signOpts) {
+		o.sortKeys = true
+	}
+}
+
+// WithTweaks applies the passed tweaks to the aggregated key in order.
+func WithTweaks(tweaks ...KeyTweakDesc) SignOption {
+	return func(o *signOpts) {
+		o.tweaks = tweaks
+	}
+}
+
+// sessionValues houses the values that are derived from the aggregated nonce,
+// the key set, and the message of a signing session.
+type sessionValues struct {
+	aggKey    *AggregateKey
+	keys      []*btcec.PublicKey
+	keysHash  []byte
+	secondKey []byte
+
+	// b is the nonce coefficient.
+	b btcec.ModNScalar
+
+	// r is the final nonce point in affine form.
+	r btcec.JacobianPoint
+
+	// e is the BIP 340 challenge.
+	e btcec.ModNScalar
+}
+
+// newSessionValues computes the session values as described by the
+// GetSessionValues algorithm of BIP 327.
+func newSessionValues(aggNonce [PubNonceSize]byte, keys []*btcec.PublicKey,
+	msg []byte, options ...SignOption) (*sessionValues, error) {
+
+	opts := &signOpts{}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.sortKeys {
+		keys = SortKeys(keys)
+	}
+
+	aggKey, err := AggregateKeys(keys, false, opts.tweaks...)
+	if err != nil {
+		return nil, err
+	}
+	qBytes := aggKey.XOnlyKey()
+
+	s := &sessionValues{
+		aggKey:    aggKey,
+		keys:      keys,
+		keysHash:  keyHashFingerprint(keys),
+		secondKey: secondUniqueKey(keys),
+	}
+
+	// b = int(hash_noncecoef(aggnonce || xbytes(Q) || m)).
+	bHash := chainhash.TaggedHash(nonceCoefTag, aggNonce[:], qBytes, msg)
+	s.b.SetByteSlice(bHash[:])
+
+	// R = R1 + b*R2, or G when that is the point at infinity.
+	var r1, r2, bR2 btcec.JacobianPoint
+	if err := parsePointExt(aggNonce[:33], &r1); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAggNonce, err)
+	}
+	if err := parsePointExt(aggNonce[33:], &r2); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAggNonce, err)
+	}
+	btcec.ScalarMultNonConst(&s.b, &r2, &bR2)
+	btcec.AddNonConst(&r1, &bR2, &s.r)
+	if isInfinity(&s.r) {
+		var one btcec.ModNScalar
+		one.SetInt(1)
+		btcec.ScalarBaseMultNonConst(&one, &s.r)
+	}
+	s.r.ToAffine()
+
+	// e = int(hash_BIP0340/challenge(xbytes(R) || xbytes(Q) || m)).
+	rBytes := s.r.X.Bytes()
+	eHash := chainhash.TaggedHash(
+		chainhash.TagBIP0340Challenge, rBytes[:], qBytes, msg,
+	)
+	s.e.SetByteSlice(eHash[:])
+
+	return s, nil
+}
+
+// keyCoefficient returns the key aggregation coefficient of the passed key,
+// which must be part of the key set of the session.
+func (s *sessionValues) keyCoefficient(key *btcec.PublicKey) (
+	*btcec.ModNScalar, error) {
+
+	if !keyInSet(s.keys, key) {
+		return nil, ErrSignerNotInKeySet
+	}
+	return aggregationCoefficient(s.keysHash, s.secondKey, key), nil
+}
+
+// parityFactor returns g*gacc, where g is -1 when the final aggregated key
+// has an odd y coordinate and 1 otherwise.
+func (s *sessionValues) parityFactor() *btcec.ModNScalar {
+	var g btcec.ModNScalar
+	g.SetInt(1)
+	if s.aggKey.FinalKey.SerializeCompressed()[0] == 0x03 {
+		g.Negate()
+	}
+	return g.Mul(&s.aggKey.parityAcc)
+}
+
+// Sign creates a partial signature over the message with the passed secret
+// nonce and key as described by the Sign algorithm of BIP 327.  The secret
+// nonce is zeroed once it has been used, so it can't be used to sign twice,
+// which would leak the signing key.
+func Sign(secNonce *[SecNonceSize]byte, privKey *btcec.PrivateKey,
+	aggNonce [PubNonceSize]byte, keys []*btcec.PublicKey, msg []byte,
+	options ...SignOption) (*PartialSignature, error) {
+
+	// Parse the secret nonce and zero it right away, so it is never used
+	// again regardless of whether signing succeeds.
+	var k1, k2 btcec.ModNScalar
+	overflow1 := k1.SetByteSlice(secNonce[:32])
+	overflow2 := k2.SetByteSlice(secNonce[32:64])
+	nonceKey := make([]byte, btcec.PubKeyBytesLenCompressed)
+	copy(nonceKey, secNonce[64:])
+	for i := range secNonce {
+		secNonce[i] = 0
+	}
+	if overflow1 || overflow2 || k1.IsZero() || k2.IsZero() {
+		return nil, ErrSecNonceZero
+	}
+
+	pubKey := privKey.PubKey()
+	if !bytes.Equal(nonceKey, pubKey.SerializeCompressed()) {
+		return nil, ErrSecNoncePubKeyMismatch
+	}
+
+	s, err := newSessionValues(aggNonce, keys, msg, options...)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.keyCoefficient(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Negate the nonces when the final nonce has an odd y coordinate.
+	if !hasEvenY(&s.r) {
+		k1.Negate()
+		k2.Negate()
+	}
+
+	// d = g*gacc*d'.
+	var d btcec.ModNScalar
+	d.Set(&privKey.Key).Mul(s.parityFactor())
+
+	// s = k1 + b*k2 + e*a*d.
+	var sig PartialSignature
+	sig.S.Mul2(&s.b, &k2).Add(&k1)
+	d.Mul(a).Mul(&s.e)
+	sig.S.Add(&d)
+
+	k1.Zero()
+	k2.Zero()
+	d.Zero()
+
+	return &sig, nil
+}
+
+// Verify returns nil if the partial signature is valid for the signer with the
+// passed public nonce and key as described by the PartialSigVerifyInternal
+// algorithm of BIP 327.
+func (p *PartialSignature) Verify(pubNonce [PubNonceSize]byte,
+	aggNonce [PubNonceSize]byte, keys []*btcec.PublicKey,
+	signerKey *btcec.PublicKey, msg []byte,
+	options ...SignOption) error {
+
+	s, err := newSessionValues(aggNonce, keys, msg, options...)
+	if err != nil {
+		return err
+	}
+	a, err := s.keyCoefficient(signerKey)
+	if err != nil {
+		return err
+	}
+
+	// Re = R1 + b*R2, negated when the final nonce has an odd y
+	// coordinate.
+	r1Key, err := btcec.ParsePubKey(pubNonce[:33])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPubNonce, err)
+	}
+	r2Key, err := btcec.ParsePubKey(pubNonce[33:])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPubNonce, err)
+	}
+	var r1, r2, bR2, re btcec.JacobianPoint
+	r1Key.AsJacobian(&r1)
+	r2Key.AsJacobian(&r2)
+	btcec.ScalarMultNonConst(&s.b, &r2, &bR2)
+	btcec.AddNonConst(&r1, &bR2, &re)
+	if !hasEvenY(&s.r) {
+		re.ToAffine()
+		re.Y.Negate(1).Normalize()
+	}
+
+	// s*G == Re + e*a*g*gacc*P.
+	var scalar btcec.ModNScalar
+	scalar.Set(&s.e).Mul(a).Mul(s.parityFactor())
+
+	var pk, eP, expected, sG btcec.JacobianPoint
+	signerKey.AsJacobian(&pk)
+	btcec.ScalarMultNonConst(&scalar, &pk, &eP)
+	btcec.AddNonConst(&re, &eP, &expected)
+	btcec.ScalarBaseMultNonConst(&p.S, &sG)
+
+	expected.ToAffine()
+	sG.ToAffine()
+	if isInfinity(&expected) || !expected.X.Equals(&sG.X) ||
+		!expected.Y.Equals(&sG.Y) {
+
+		return ErrPartialSigInvalid
+	}
+
+	return nil
+}
+
+// AggregatePartialSigs combines the partial signatures of all of the signers
+// into a BIP 340 signature that is valid under the final aggregated key as
+// described by the PartialSigAgg algorithm of BIP 327.
+func AggregatePartialSigs(partialSigs []*PartialSignature,
+	aggNonce [PubNonceSize]byte, keys []*btcec.PublicKey, msg []byte,
+	options ...SignOption) (*schnorr.Signature, error) {
+
+	s, err := newSessionValues(aggNonce, keys, msg, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// s = sum(s_i) + e*g*tacc.
+	var sum btcec.ModNScalar
+	for _, partialSig := range partialSigs {
+		sum.Add(&partialSig.S)
+	}
+
+	var g btcec.ModNScalar
+	g.SetInt(1)
+	if s.aggKey.FinalKey.SerializeCompressed()[0] == 0x03 {
+		g.Negate()
+	}
+	var tweakTerm btcec.ModNScalar
+	tweakTerm.Set(&s.e).Mul(&g).Mul(&s.aggKey.tweakAcc)
+	sum.Add(&tweakTerm)
+
+	return schnorr.NewSignature(&s.r.X, &sum), nil
+}
@@ -59,6 +59,29 @@ func NewDebugLevelCmd(levelSpec string) *DebugLevelCmd {
 	}
 }
 
+// DebugScriptCmd defines the debugscript JSON-RPC command.  This command is
+// not a standard Bitcoin command.  It is an extension for btcd.
+type DebugScriptCmd struct {
+	HexTx        string
+	Vin          uint32
+	ScriptPubKey string
+	Amount       float64
+}
+
+// NewDebugScriptCmd returns a new DebugScriptCmd which can be used to issue a
+// debugscript JSON-RPC command.  This command is not a standard Bitcoin
+// command.  It is an extension for btcd.
+func NewDebugScriptCmd(hexTx string, vin uint32, scriptPubKey string,
+	amount float64) *DebugScriptCmd {
+
+	return &DebugScriptCmd{
+		HexTx:        hexTx,
+		Vin:          vin,
+		ScriptPubKey: scriptPubKey,
+		Amount:       amount,
+	}
+}
+
 // GenerateToAddressCmd defines the generatetoaddress JSON-RPC command.
 type GenerateToAddressCmd struct {
 	NumBlocks int64
@@ -128,6 +151,26 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// TraceTransactionCmd defines the tracetransaction JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for btcd.
+type TraceTransactionCmd struct {
+	HexTx string
+	Vin   *uint32
+}
+
+// NewTraceTransactionCmd returns a new TraceTransactionCmd which can be used to
+// issue a tracetransaction JSON-RPC command.  This command is not a standard
+// Bitcoin command.  It is an extension for btcd.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewTraceTransactionCmd(hexTx string, vin *uint32) *TraceTransactionCmd {
+	return &TraceTransactionCmd{
+		HexTx: hexTx,
+		Vin:   vin,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -146,11 +189,13 @@ func init() {
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
+	MustRegisterCmd("debugscript", (*DebugScriptCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
 	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("tracetransaction", (*TraceTransactionCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
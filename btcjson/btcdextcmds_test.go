@@ -43,6 +43,22 @@ func TestBtcdExtCmds(t *testing.T) {
 				LevelSpec: "trace",
 			},
 		},
+		{
+			name: "debugscript",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("debugscript", "0100", 1, "51", 0.5)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDebugScriptCmd("0100", 1, "51", 0.5)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"debugscript","params":["0100",1,"51",0.5],"id":1}`,
+			unmarshalled: &btcjson.DebugScriptCmd{
+				HexTx:        "0100",
+				Vin:          1,
+				ScriptPubKey: "51",
+				Amount:       0.5,
+			},
+		},
 		{
 			name: "node",
 			newCmd: func() (interface{}, error) {
@@ -194,6 +210,33 @@ func TestBtcdExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "tracetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("tracetransaction", "0100")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTraceTransactionCmd("0100", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"tracetransaction","params":["0100"],"id":1}`,
+			unmarshalled: &btcjson.TraceTransactionCmd{
+				HexTx: "0100",
+			},
+		},
+		{
+			name: "tracetransaction optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("tracetransaction", "0100", 2)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTraceTransactionCmd("0100", btcjson.Uint32(2))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"tracetransaction","params":["0100",2],"id":1}`,
+			unmarshalled: &btcjson.TraceTransactionCmd{
+				HexTx: "0100",
+				Vin:   btcjson.Uint32(2),
+			},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
@@ -18,3 +18,29 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// ScriptTraceStep models a single opcode of the script execution trace
+// returned by the debugscript and tracetransaction commands.  The stacks list
+// the hex-encoded items from the bottom to the top of the stack.
+type ScriptTraceStep struct {
+	Script   int      `json:"script"`
+	Index    int      `json:"index"`
+	Opcode   string   `json:"opcode"`
+	Executed bool     `json:"executed"`
+	Stack    []string `json:"stack"`
+	AltStack []string `json:"altstack"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// TraceScriptResult models the data from the debugscript command and the
+// result for each input of the tracetransaction command.
+type TraceScriptResult struct {
+	TxID         string            `json:"txid"`
+	Vin          uint32            `json:"vin"`
+	ScriptPubKey string            `json:"scriptPubKey"`
+	Amount       float64           `json:"amount"`
+	Valid        bool              `json:"valid"`
+	ErrorCode    string            `json:"errorcode,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Steps        []ScriptTraceStep `json:"steps"`
+}
@@ -35,6 +35,26 @@ func TestBtcdExtCustomResults(t *testing.T) {
 			},
 			expected: `{"versionstring":"1.0.0","major":1,"minor":0,"patch":0,"prerelease":"pr","buildmetadata":"bm"}`,
 		},
+		{
+			name: "tracescriptresult",
+			result: &btcjson.TraceScriptResult{
+				TxID:         "123",
+				Vin:          1,
+				ScriptPubKey: "5187",
+				Amount:       0.5,
+				ErrorCode:    "ErrEvalFalse",
+				Error:        "false stack entry",
+				Steps: []btcjson.ScriptTraceStep{{
+					Script:   1,
+					Index:    0,
+					Opcode:   "OP_1",
+					Executed: true,
+					Stack:    []string{"02", "01"},
+					AltStack: []string{},
+				}},
+			},
+			expected: `{"txid":"123","vin":1,"scriptPubKey":"5187","amount":0.5,"valid":false,"errorcode":"ErrEvalFalse","error":"false stack entry","steps":[{"script":1,"index":0,"opcode":"OP_1","executed":true,"stack":["02","01"],"altstack":[]}]}`,
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
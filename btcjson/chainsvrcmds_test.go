@@ -42,6 +42,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "clearbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("clearbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewClearBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"clearbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ClearBannedCmd{},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -312,6 +323,79 @@ func TestChainSvrCmds(t *testing.T) {
 				Node: btcjson.String("127.0.0.1"),
 			},
 		},
+		{
+			name: "getaddressbalance",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressbalance", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressBalanceCmd([]string{"1Address"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressBalanceCmd{
+				Addresses:      []string{"1Address"},
+				IncludeMempool: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getaddressbalance optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressbalance", []string{"1Address"}, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressBalanceCmd([]string{"1Address"}, btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":[["1Address"],true],"id":1}`,
+			unmarshalled: &btcjson.GetAddressBalanceCmd{
+				Addresses:      []string{"1Address"},
+				IncludeMempool: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getaddressdeltas",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressdeltas", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressDeltasCmd([]string{"1Address"}, nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressdeltas","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressDeltasCmd{
+				Addresses:      []string{"1Address"},
+				IncludeMempool: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getaddressdeltas optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressdeltas", []string{"1Address"}, 100, 200, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressDeltasCmd([]string{"1Address"},
+					btcjson.Int32(100), btcjson.Int32(200), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressdeltas","params":[["1Address"],100,200,true],"id":1}`,
+			unmarshalled: &btcjson.GetAddressDeltasCmd{
+				Addresses:      []string{"1Address"},
+				Start:          btcjson.Int32(100),
+				End:            btcjson.Int32(200),
+				IncludeMempool: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getaddressutxos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressutxos", []string{"1Address"}, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressUtxosCmd([]string{"1Address"}, btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressutxos","params":[["1Address"],true],"id":1}`,
+			unmarshalled: &btcjson.GetAddressUtxosCmd{
+				Addresses:      []string{"1Address"},
+				IncludeMempool: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "getbestblockhash",
 			newCmd: func() (interface{}, error) {
@@ -1047,6 +1131,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListBannedCmd{},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -1084,6 +1179,44 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "scantxoutset start",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", btcjson.ScanTxOutSetStart,
+					[]btcjson.ScanTxOutSetObject{
+						{Desc: "addr(1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa)"},
+						{Desc: "pkh(xpub/*)", Range: &btcjson.DescriptorRange{Value: 100}},
+					})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStart,
+					&[]btcjson.ScanTxOutSetObject{
+						{Desc: "addr(1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa)"},
+						{Desc: "pkh(xpub/*)", Range: &btcjson.DescriptorRange{Value: 100}},
+					})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["start",["addr(1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa)",{"desc":"pkh(xpub/*)","range":100}]],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: btcjson.ScanTxOutSetStart,
+				ScanObjects: &[]btcjson.ScanTxOutSetObject{
+					{Desc: "addr(1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa)"},
+					{Desc: "pkh(xpub/*)", Range: &btcjson.DescriptorRange{Value: 100}},
+				},
+			},
+		},
+		{
+			name: "scantxoutset status",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", btcjson.ScanTxOutSetStatus)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStatus, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["status"],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: btcjson.ScanTxOutSetStatus,
+			},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -1308,6 +1441,39 @@ func TestChainSvrCmds(t *testing.T) {
 				HexData: func(s string) *string { return &s }("2211"),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "1.2.3.0/24", btcjson.SBAdd)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("1.2.3.0/24", btcjson.SBAdd, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["1.2.3.0/24","add"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "1.2.3.0/24",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(0),
+				Absolute: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "1.2.3.4", btcjson.SBAdd, 1700000000, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("1.2.3.4", btcjson.SBAdd,
+					btcjson.Int64(1700000000), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["1.2.3.4","add",1700000000,true],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "1.2.3.4",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(1700000000),
+				Absolute: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -1394,6 +1560,33 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxs: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "submitpackage optional data",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", []string{"1122", "3344"}, []string{"", "5566"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"}, &[]string{"", "5566"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"],["","5566"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxs:  []string{"1122", "3344"},
+				HexData: &[]string{"", "5566"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -38,6 +38,8 @@ type GetBlockStatsResult struct {
 	AverageFee         int64   `json:"avgfee"`
 	AverageFeeRate     int64   `json:"avgfeerate"`
 	AverageTxSize      int64   `json:"avgtxsize"`
+	Commitments        int64   `json:"commitments"`
+	CommitmentData     int64   `json:"commitment_data_bytes"`
 	FeeratePercentiles []int64 `json:"feerate_percentiles"`
 	Hash               string  `json:"blockhash"`
 	Height             int64   `json:"height"`
@@ -57,6 +59,7 @@ type GetBlockStatsResult struct {
 	SegWitTxs          int64   `json:"swtxs"`
 	Subsidy            int64   `json:"subsidy"`
 	Time               int64   `json:"time"`
+	TotalFee           int64   `json:"totalfee"`
 	TotalOut           int64   `json:"total_out"`
 	TotalSize          int64   `json:"total_size"`
 	TotalWeight        int64   `json:"total_weight"`
@@ -82,7 +85,7 @@ type GetBlockVerboseResult struct {
 	VersionHex    string        `json:"versionHex"`
 	MerkleRoot    string        `json:"merkleroot"`
 	Tx            []string      `json:"tx,omitempty"`
-	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose != 2.
+	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose < 2.
 	Time          int64         `json:"time"`
 	Nonce         uint32        `json:"nonce"`
 	Bits          string        `json:"bits"`
@@ -96,6 +99,8 @@ type GetBlockVerboseResult struct {
 // hex-encoded string. When the verbose flag is set to 1, getblock returns an object
 // whose tx field is an array of transaction hashes. When the verbose flag is set to 2,
 // getblock returns an object whose tx field is an array of raw transactions.
+// When the verbose flag is set to 3, the raw transactions additionally include
+// the fee and the previous output spent by each input.
 // Use GetBlockVerboseResult to unmarshal data received from passing verbose=1 to getblock.
 type GetBlockVerboseTxResult struct {
 	Hash          string        `json:"hash"`
@@ -129,6 +134,14 @@ type GetChainTxStatsResult struct {
 	TxRate                 float64 `json:"txrate"`
 }
 
+// GetChainTipsResult models the data returned from the getchaintips command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
 // CreateMultiSigResult models the data returned from the createmultisig
 // command.
 type CreateMultiSigResult struct {
@@ -159,6 +172,41 @@ type GetAddedNodeInfoResult struct {
 	Addresses *[]GetAddedNodeInfoResultAddr `json:"addresses,omitempty"`
 }
 
+// GetAddressBalanceResult models the data from the getaddressbalance command.
+type GetAddressBalanceResult struct {
+	Balance     float64 `json:"balance"`
+	Received    float64 `json:"received"`
+	Unconfirmed float64 `json:"unconfirmed"`
+}
+
+// GetAddressDeltasResult models a single balance change returned by the
+// getaddressdeltas command.  Unconfirmed changes have a height of zero and no
+// confirmations.
+type GetAddressDeltasResult struct {
+	Address       string  `json:"address"`
+	TxID          string  `json:"txid"`
+	Index         uint32  `json:"index"`
+	Spending      bool    `json:"spending"`
+	BlockIndex    uint32  `json:"blockindex"`
+	Height        int32   `json:"height"`
+	Confirmations int64   `json:"confirmations"`
+	Amount        float64 `json:"amount"`
+}
+
+// GetAddressUtxosResult models a single unspent output returned by the
+// getaddressutxos command.  Unconfirmed outputs have a height of zero and no
+// confirmations.
+type GetAddressUtxosResult struct {
+	Address       string  `json:"address"`
+	TxID          string  `json:"txid"`
+	Vout          uint32  `json:"vout"`
+	ScriptPubKey  string  `json:"scriptPubKey"`
+	Amount        float64 `json:"amount"`
+	Height        int32   `json:"height"`
+	Confirmations int64   `json:"confirmations"`
+	Coinbase      bool    `json:"coinbase"`
+}
+
 // SoftForkDescription describes the current state of a soft-fork which was
 // deployed using a super-majority block signalling.
 type SoftForkDescription struct {
@@ -380,6 +428,17 @@ type GetNodeAddressesResult struct {
 	Services uint64 `json:"services"` // The services offered
 	Address  string `json:"address"`  // The address of the node
 	Port     uint16 `json:"port"`     // The port of the node
+	Network  string `json:"network"`  // The network of the node
+}
+
+// ListBannedResult models the data returned from the listbanned command.
+type ListBannedResult struct {
+	Address       string `json:"address"`
+	BanCreated    int64  `json:"ban_created"`
+	BannedUntil   int64  `json:"banned_until"`
+	BanDuration   int64  `json:"ban_duration"`
+	TimeRemaining int64  `json:"time_remaining"`
+	BanReason     string `json:"ban_reason"`
 }
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
@@ -400,6 +459,8 @@ type GetPeerInfoResult struct {
 	Version        uint32  `json:"version"`
 	SubVer         string  `json:"subver"`
 	Inbound        bool    `json:"inbound"`
+	ConnectionType string  `json:"connection_type"`
+	MappedAS       uint32  `json:"mapped_as,omitempty"`
 	StartingHeight int32   `json:"startingheight"`
 	CurrentHeight  int32   `json:"currentheight,omitempty"`
 	BanScore       int32   `json:"banscore"`
@@ -501,9 +562,21 @@ func (g *GetTxOutSetInfoResult) UnmarshalJSON(data []byte) error {
 
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv uint64             `json:"totalbytesrecv"`
+	TotalBytesSent uint64             `json:"totalbytessent"`
+	TimeMillis     int64              `json:"timemillis"`
+	UploadTarget   UploadTargetResult `json:"uploadtarget"`
+}
+
+// UploadTargetResult models the state of the upload target returned as part of
+// the getnettotals command.
+type UploadTargetResult struct {
+	TimeFrame             int64  `json:"timeframe"`
+	Target                uint64 `json:"target"`
+	TargetReached         bool   `json:"target_reached"`
+	ServeHistoricalBlocks bool   `json:"serve_historical_blocks"`
+	BytesLeftInCycle      uint64 `json:"bytes_left_in_cycle"`
+	TimeLeftInCycle       int64  `json:"time_left_in_cycle"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
@@ -518,12 +591,13 @@ type ScriptSig struct {
 // getrawtransaction, decoderawtransaction, and searchrawtransaction use the
 // same structure.
 type Vin struct {
-	Coinbase  string     `json:"coinbase"`
-	Txid      string     `json:"txid"`
-	Vout      uint32     `json:"vout"`
-	ScriptSig *ScriptSig `json:"scriptSig"`
-	Sequence  uint32     `json:"sequence"`
-	Witness   []string   `json:"txinwitness"`
+	Coinbase  string             `json:"coinbase"`
+	Txid      string             `json:"txid"`
+	Vout      uint32             `json:"vout"`
+	ScriptSig *ScriptSig         `json:"scriptSig"`
+	Prevout   *SpentOutputResult `json:"prevout,omitempty"`
+	Sequence  uint32             `json:"sequence"`
+	Witness   []string           `json:"txinwitness"`
 }
 
 // IsCoinBase returns a bool to show if a Vin is a Coinbase one or not.
@@ -554,35 +628,49 @@ func (v *Vin) MarshalJSON() ([]byte, error) {
 
 	if v.HasWitness() {
 		txStruct := struct {
-			Txid      string     `json:"txid"`
-			Vout      uint32     `json:"vout"`
-			ScriptSig *ScriptSig `json:"scriptSig"`
-			Witness   []string   `json:"txinwitness"`
-			Sequence  uint32     `json:"sequence"`
+			Txid      string             `json:"txid"`
+			Vout      uint32             `json:"vout"`
+			ScriptSig *ScriptSig         `json:"scriptSig"`
+			Witness   []string           `json:"txinwitness"`
+			Prevout   *SpentOutputResult `json:"prevout,omitempty"`
+			Sequence  uint32             `json:"sequence"`
 		}{
 			Txid:      v.Txid,
 			Vout:      v.Vout,
 			ScriptSig: v.ScriptSig,
 			Witness:   v.Witness,
+			Prevout:   v.Prevout,
 			Sequence:  v.Sequence,
 		}
 		return json.Marshal(txStruct)
 	}
 
 	txStruct := struct {
-		Txid      string     `json:"txid"`
-		Vout      uint32     `json:"vout"`
-		ScriptSig *ScriptSig `json:"scriptSig"`
-		Sequence  uint32     `json:"sequence"`
+		Txid      string             `json:"txid"`
+		Vout      uint32             `json:"vout"`
+		ScriptSig *ScriptSig         `json:"scriptSig"`
+		Prevout   *SpentOutputResult `json:"prevout,omitempty"`
+		Sequence  uint32             `json:"sequence"`
 	}{
 		Txid:      v.Txid,
 		Vout:      v.Vout,
 		ScriptSig: v.ScriptSig,
+		Prevout:   v.Prevout,
 		Sequence:  v.Sequence,
 	}
 	return json.Marshal(txStruct)
 }
 
+// SpentOutputResult models the previous output spent by a transaction input.
+// It is only populated by getblock with a verbosity of 3, which sources it from
+// the spend journal so it is available without a transaction index.
+type SpentOutputResult struct {
+	Generated    bool               `json:"generated"`
+	Height       int32              `json:"height"`
+	Value        float64            `json:"value"`
+	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
 // PrevOut represents previous output for an input Vin.
 type PrevOut struct {
 	Addresses []string `json:"addresses,omitempty"`
@@ -702,25 +790,27 @@ type InfoChainResult struct {
 	Difficulty      float64 `json:"difficulty"`
 	TestNet         bool    `json:"testnet"`
 	RelayFee        float64 `json:"relayfee"`
+	ASMapChecksum   string  `json:"asmapchecksum,omitempty"`
 	Errors          string  `json:"errors"`
 }
 
 // TxRawResult models the data from the getrawtransaction command.
 type TxRawResult struct {
-	Hex           string `json:"hex"`
-	Txid          string `json:"txid"`
-	Hash          string `json:"hash,omitempty"`
-	Size          int32  `json:"size,omitempty"`
-	Vsize         int32  `json:"vsize,omitempty"`
-	Weight        int32  `json:"weight,omitempty"`
-	Version       uint32 `json:"version"`
-	LockTime      uint32 `json:"locktime"`
-	Vin           []Vin  `json:"vin"`
-	Vout          []Vout `json:"vout"`
-	BlockHash     string `json:"blockhash,omitempty"`
-	Confirmations uint64 `json:"confirmations,omitempty"`
-	Time          int64  `json:"time,omitempty"`
-	Blocktime     int64  `json:"blocktime,omitempty"`
+	Hex           string   `json:"hex"`
+	Txid          string   `json:"txid"`
+	Hash          string   `json:"hash,omitempty"`
+	Size          int32    `json:"size,omitempty"`
+	Vsize         int32    `json:"vsize,omitempty"`
+	Weight        int32    `json:"weight,omitempty"`
+	Version       uint32   `json:"version"`
+	LockTime      uint32   `json:"locktime"`
+	Vin           []Vin    `json:"vin"`
+	Vout          []Vout   `json:"vout"`
+	Fee           *float64 `json:"fee,omitempty"`
+	BlockHash     string   `json:"blockhash,omitempty"`
+	Confirmations uint64   `json:"confirmations,omitempty"`
+	Time          int64    `json:"time,omitempty"`
+	Blocktime     int64    `json:"blocktime,omitempty"`
 }
 
 // SearchRawTransactionsResult models the data from the searchrawtransaction
@@ -833,6 +923,56 @@ type GetDescriptorInfoResult struct {
 // DeriveAddressesResult models the data from the deriveaddresses command.
 type DeriveAddressesResult []string
 
+// ScanTxOutSetUnspent models an unspent transaction output found by the
+// scantxoutset command.
+type ScanTxOutSetUnspent struct {
+	TxID         string  `json:"txid"`
+	Vout         uint32  `json:"vout"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	Desc         string  `json:"desc"`
+	Amount       float64 `json:"amount"`
+	Height       int32   `json:"height"`
+}
+
+// ScanTxOutSetResult models the data from the scantxoutset command with the
+// start action.
+type ScanTxOutSetResult struct {
+	Success     bool                  `json:"success"`
+	TxOuts      uint64                `json:"txouts"`
+	Height      int32                 `json:"height"`
+	BestBlock   string                `json:"bestblock"`
+	Unspents    []ScanTxOutSetUnspent `json:"unspents"`
+	TotalAmount float64               `json:"total_amount"`
+}
+
+// ScanTxOutSetStatusResult models the data from the scantxoutset command with
+// the status action when a scan is in progress.
+type ScanTxOutSetStatusResult struct {
+	Progress float64 `json:"progress"`
+}
+
+// SubmitPackageFees models the fees of a transaction accepted by the
+// submitpackage command.
+type SubmitPackageFees struct {
+	Base float64 `json:"base"`
+}
+
+// SubmitPackageTxResult models the data of a package transaction from the
+// submitpackage command.  The fees are only set for the transactions which were
+// not already in the memory pool.
+type SubmitPackageTxResult struct {
+	TxID  string             `json:"txid"`
+	VSize int32              `json:"vsize"`
+	Fees  *SubmitPackageFees `json:"fees,omitempty"`
+}
+
+// SubmitPackageResult models the data from the submitpackage command.  The
+// transaction results are keyed by the witness hash of the transactions.
+type SubmitPackageResult struct {
+	PackageMsg string                           `json:"package_msg"`
+	TxResults  map[string]SubmitPackageTxResult `json:"tx-results"`
+}
+
 // LoadWalletResult models the data from the loadwallet command
 type LoadWalletResult struct {
 	Name    string `json:"name"`
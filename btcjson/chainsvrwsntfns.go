@@ -75,6 +75,11 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// DeepReorgNtfnMethod is the method used for notifications from the
+	// chain server that a reorganization deeper than its configured maximum
+	// reorg depth was refused.
+	DeepReorgNtfnMethod = "deepreorg"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +290,36 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// DeepReorgNtfn defines the deepreorg JSON-RPC notification.
+type DeepReorgNtfn struct {
+	ForkHash     string
+	ForkHeight   int32
+	OldTipHash   string
+	OldTipHeight int32
+	NewTipHash   string
+	NewTipHeight int32
+	Depth        int32
+	MaxDepth     int32
+}
+
+// NewDeepReorgNtfn returns a new instance which can be used to issue a
+// deepreorg JSON-RPC notification.
+func NewDeepReorgNtfn(forkHash string, forkHeight int32, oldTipHash string,
+	oldTipHeight int32, newTipHash string, newTipHeight int32, depth,
+	maxDepth int32) *DeepReorgNtfn {
+
+	return &DeepReorgNtfn{
+		ForkHash:     forkHash,
+		ForkHeight:   forkHeight,
+		OldTipHash:   oldTipHash,
+		OldTipHeight: oldTipHeight,
+		NewTipHash:   newTipHash,
+		NewTipHeight: newTipHeight,
+		Depth:        depth,
+		MaxDepth:     maxDepth,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +336,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(DeepReorgNtfnMethod, (*DeepReorgNtfn)(nil), flags)
 }
@@ -225,6 +225,28 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "deepreorg",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("deepreorg", "123", 100000, "456",
+					100010, "789", 100012, 10, 6)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewDeepReorgNtfn("123", 100000, "456",
+					100010, "789", 100012, 10, 6)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"deepreorg","params":["123",100000,"456",100010,"789",100012,10,6],"id":null}`,
+			unmarshalled: &btcjson.DeepReorgNtfn{
+				ForkHash:     "123",
+				ForkHeight:   100000,
+				OldTipHash:   "456",
+				OldTipHeight: 100010,
+				NewTipHash:   "789",
+				NewTipHeight: 100012,
+				Depth:        10,
+				MaxDepth:     6,
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
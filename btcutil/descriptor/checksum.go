@@ -0,0 +1,121 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ChecksumLength is the number of characters of a descriptor checksum.
+	ChecksumLength = 8
+
+	// inputCharset is the set of characters a descriptor may contain, in
+	// the order defined by BIP 380.  The position of a character is used
+	// to compute the checksum.
+	inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// checksumCharset is the set of characters the checksum is encoded
+	// with, which is the same as the bech32 character set.
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// checksumGenerator houses the generator of the BCH code the checksum is
+// based on.
+var checksumGenerator = [5]uint64{
+	0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+}
+
+// polyMod updates the passed checksum state with the passed symbol.
+func polyMod(c uint64, val int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(val)
+	for i := 0; i < 5; i++ {
+		if (c0>>uint(i))&1 == 1 {
+			c ^= checksumGenerator[i]
+		}
+	}
+	return c
+}
+
+// Checksum returns the checksum of the passed descriptor, which must not
+// include a checksum itself, as defined by BIP 380.
+func Checksum(desc string) (string, error) {
+	c := uint64(1)
+	cls := 0
+	clsCount := 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(inputCharset, ch)
+		if pos < 0 {
+			return "", fmt.Errorf("%w: invalid character %q",
+				ErrInvalidChecksum, ch)
+		}
+
+		// Emit a symbol for the position inside the group for every
+		// character, and a symbol for the group of every three
+		// characters.
+		c = polyMod(c, pos&31)
+		cls = cls*3 + (pos >> 5)
+		clsCount++
+		if clsCount == 3 {
+			c = polyMod(c, cls)
+			cls = 0
+			clsCount = 0
+		}
+	}
+	if clsCount > 0 {
+		c = polyMod(c, cls)
+	}
+
+	// Shift the checksum into place.
+	for i := 0; i < ChecksumLength; i++ {
+		c = polyMod(c, 0)
+	}
+	c ^= 1
+
+	var checksum [ChecksumLength]byte
+	for i := 0; i < ChecksumLength; i++ {
+		checksum[i] = checksumCharset[(c>>(5*(7-uint(i))))&31]
+	}
+	return string(checksum[:]), nil
+}
+
+// AddChecksum returns the passed descriptor, which must not include a
+// checksum, with its checksum appended.
+func AddChecksum(desc string) (string, error) {
+	checksum, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + checksum, nil
+}
+
+// splitChecksum splits the passed descriptor into the descriptor itself and
+// its checksum, and ensures the checksum is valid when it is present.
+func splitChecksum(desc string) (string, string, error) {
+	idx := strings.IndexByte(desc, '#')
+	if idx < 0 {
+		return desc, "", nil
+	}
+
+	body, checksum := desc[:idx], desc[idx+1:]
+	if len(checksum) != ChecksumLength {
+		return "", "", fmt.Errorf("%w: expected %d characters, got %d",
+			ErrInvalidChecksum, ChecksumLength, len(checksum))
+	}
+	want, err := Checksum(body)
+	if err != nil {
+		return "", "", err
+	}
+	if checksum != want {
+		return "", "", fmt.Errorf("%w: got %s, want %s",
+			ErrInvalidChecksum, checksum, want)
+	}
+
+	return body, checksum, nil
+}
@@ -0,0 +1,661 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/txscript"
+)
+
+const (
+	// maxBareMultiSigKeys is the maximum number of keys of a multi or
+	// sortedmulti expression that isn't nested in sh or wsh.
+	maxBareMultiSigKeys = 3
+
+	// maxP2SHMultiSigKeys is the maximum number of keys of a multi or
+	// sortedmulti expression nested in sh.
+	maxP2SHMultiSigKeys = 16
+
+	// maxTapTreeDepth is the maximum depth of a taproot script tree.
+	maxTapTreeDepth = 128
+)
+
+// scriptContext describes where in a descriptor an expression is located,
+// which determines the expressions and keys allowed.
+type scriptContext uint8
+
+const (
+	// ctxTop is the top level of a descriptor.
+	ctxTop scriptContext = iota
+
+	// ctxP2SH is the redeem script of an sh expression.
+	ctxP2SH
+
+	// ctxWitnessV0 is the witness script of a wsh expression, or the key
+	// of a wpkh expression.
+	ctxWitnessV0
+
+	// ctxTaproot is the internal key or a leaf script of a tr expression.
+	ctxTaproot
+)
+
+// exprType identifies the kind of a script expression.
+type exprType uint8
+
+const (
+	exprPk exprType = iota
+	exprPkh
+	exprWpkh
+	exprSh
+	exprWsh
+	exprMulti
+	exprSortedMulti
+	exprTr
+	exprAddr
+	exprRaw
+)
+
+// exprStrings is a map of script expression types back to their names.
+var exprStrings = map[exprType]string{
+	exprPk:          "pk",
+	exprPkh:         "pkh",
+	exprWpkh:        "wpkh",
+	exprSh:          "sh",
+	exprWsh:         "wsh",
+	exprMulti:       "multi",
+	exprSortedMulti: "sortedmulti",
+	exprTr:          "tr",
+	exprAddr:        "addr",
+	exprRaw:         "raw",
+}
+
+// exprNames is a map of script expression names to their types.  It is
+// populated from exprStrings on init.
+var exprNames = make(map[string]exprType, len(exprStrings))
+
+func init() {
+	for typ, name := range exprStrings {
+		exprNames[name] = typ
+	}
+}
+
+// String returns the name of the script expression type.
+func (t exprType) String() string {
+	if name, ok := exprStrings[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown exprType (%d)", uint8(t))
+}
+
+// scriptExpr is a parsed SCRIPT expression of a descriptor.
+type scriptExpr struct {
+	typ exprType
+	ctx scriptContext
+
+	// keys are the keys of the expression, where the first key of a tr
+	// expression is its internal key.
+	keys []*keyExpr
+
+	// threshold is the number of required signatures of a multi or
+	// sortedmulti expression.
+	threshold int
+
+	// sub is the script nested in an sh or wsh expression.
+	sub *scriptExpr
+
+	// tree is the script tree of a tr expression, if any.
+	tree *tapTree
+
+	// addr is the address of an addr expression.
+	addr btcutil.Address
+
+	// script is the script of a raw expression.
+	script []byte
+}
+
+// tapTree is a node of a taproot script tree, which is either a leaf script or
+// a branch with two children.
+type tapTree struct {
+	leaf        *scriptExpr
+	left, right *tapTree
+}
+
+// Descriptor is a parsed output script descriptor.
+type Descriptor struct {
+	expr   *scriptExpr
+	params *chaincfg.Params
+}
+
+// Parse parses the passed descriptor for the passed network.  The checksum of
+// the descriptor is optional, but it must be valid when present.
+func Parse(desc string, params *chaincfg.Params) (*Descriptor, error) {
+	body, _, err := splitChecksum(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := parseScriptExpr(body, ctxTop, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Descriptor{expr: expr, params: params}, nil
+}
+
+// splitArgs splits the passed arguments of an expression at the commas that
+// aren't nested in any brackets.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced %q",
+					ErrInvalidDescriptor, s[i])
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced brackets in %q",
+			ErrInvalidDescriptor, s)
+	}
+
+	return append(args, s[start:]), nil
+}
+
+// parseScriptExpr parses a SCRIPT expression in the passed context.
+func parseScriptExpr(s string, ctx scriptContext,
+	params *chaincfg.Params) (*scriptExpr, error) {
+
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("%w: %q is not a script expression",
+			ErrInvalidDescriptor, s)
+	}
+	name := s[:open]
+	typ, ok := exprNames[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown script expression %q",
+			ErrInvalidDescriptor, name)
+	}
+	args, err := splitArgs(s[open+1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	expr := &scriptExpr{typ: typ, ctx: ctx}
+	if !expr.allowedIn(ctx) {
+		return nil, fmt.Errorf("%w: %s is not allowed here",
+			ErrInvalidDescriptor, name)
+	}
+
+	switch typ {
+	case exprPk, exprPkh, exprWpkh:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s takes a single key",
+				ErrInvalidDescriptor, name)
+		}
+		keyCtx := ctx
+		if typ == exprWpkh {
+			keyCtx = ctxWitnessV0
+		}
+		key, err := parseKeyExpr(args[0], keyCtx, params)
+		if err != nil {
+			return nil, err
+		}
+		expr.keys = []*keyExpr{key}
+
+	case exprSh, exprWsh:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s takes a single script",
+				ErrInvalidDescriptor, name)
+		}
+		subCtx := ctxP2SH
+		if typ == exprWsh {
+			subCtx = ctxWitnessV0
+		}
+		expr.sub, err = parseScriptExpr(args[0], subCtx, params)
+		if err != nil {
+			return nil, err
+		}
+
+	case exprMulti, exprSortedMulti:
+		if err := expr.parseMulti(args, params); err != nil {
+			return nil, err
+		}
+
+	case exprTr:
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("%w: tr takes a key and an "+
+				"optional script tree", ErrInvalidDescriptor)
+		}
+		key, err := parseKeyExpr(args[0], ctxTaproot, params)
+		if err != nil {
+			return nil, err
+		}
+		expr.keys = []*keyExpr{key}
+		if len(args) == 2 {
+			expr.tree, err = parseTapTree(args[1], 0, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case exprAddr:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: addr takes a single address",
+				ErrInvalidDescriptor)
+		}
+		addr, err := btcutil.DecodeAddress(args[0], params)
+		if err != nil || !addr.IsForNet(params) {
+			return nil, fmt.Errorf("%w: invalid address %q",
+				ErrInvalidDescriptor, args[0])
+		}
+		expr.addr = addr
+
+	case exprRaw:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: raw takes a single script",
+				ErrInvalidDescriptor)
+		}
+		expr.script, err = hex.DecodeString(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid script hex %q",
+				ErrInvalidDescriptor, args[0])
+		}
+	}
+
+	return expr, nil
+}
+
+// allowedIn returns whether the expression is allowed in the passed context.
+func (e *scriptExpr) allowedIn(ctx scriptContext) bool {
+	switch e.typ {
+	case exprPk, exprPkh:
+		return true
+	case exprWpkh, exprWsh:
+		return ctx == ctxTop || ctx == ctxP2SH
+	case exprMulti, exprSortedMulti:
+		return ctx != ctxTaproot
+	default:
+		return ctx == ctxTop
+	}
+}
+
+// parseMulti parses the threshold and keys of a multi or sortedmulti
+// expression.
+func (e *scriptExpr) parseMulti(args []string, params *chaincfg.Params) error {
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: invalid multisig threshold %q",
+			ErrInvalidDescriptor, args[0])
+	}
+
+	maxKeys := txscript.MaxPubKeysPerMultiSig
+	switch e.ctx {
+	case ctxTop:
+		maxKeys = maxBareMultiSigKeys
+	case ctxP2SH:
+		maxKeys = maxP2SHMultiSigKeys
+	}
+	numKeys := len(args) - 1
+	if numKeys < 1 || numKeys > maxKeys {
+		return fmt.Errorf("%w: %s takes between 1 and %d keys, got %d",
+			ErrInvalidDescriptor, e.typ, maxKeys, numKeys)
+	}
+	if threshold < 1 || threshold > numKeys {
+		return fmt.Errorf("%w: multisig threshold %d is not between 1 "+
+			"and %d", ErrInvalidDescriptor, threshold, numKeys)
+	}
+
+	// The redeem script must fit in a single stack element when nested in
+	// sh.  Each key takes its length plus a push opcode, and the
+	// threshold, key count and OP_CHECKMULTISIG take an opcode each.
+	scriptLen := 3
+	for _, arg := range args[1:] {
+		key, err := parseKeyExpr(arg, e.ctx, params)
+		if err != nil {
+			return err
+		}
+		e.keys = append(e.keys, key)
+
+		scriptLen += 34
+		if !key.compressed {
+			scriptLen += 32
+		}
+	}
+	if e.ctx == ctxP2SH && scriptLen > txscript.MaxScriptElementSize {
+		return fmt.Errorf("%w: redeem script of %d bytes exceeds the "+
+			"limit of %d bytes", ErrInvalidDescriptor, scriptLen,
+			txscript.MaxScriptElementSize)
+	}
+
+	e.threshold = threshold
+	return nil
+}
+
+// parseTapTree parses a taproot script tree at the passed depth.
+func parseTapTree(s string, depth int,
+	params *chaincfg.Params) (*tapTree, error) {
+
+	if !strings.HasPrefix(s, "{") {
+		leaf, err := parseScriptExpr(s, ctxTaproot, params)
+		if err != nil {
+			return nil, err
+		}
+		return &tapTree{leaf: leaf}, nil
+	}
+
+	if depth == maxTapTreeDepth {
+		return nil, fmt.Errorf("%w: script tree is deeper than %d",
+			ErrInvalidDescriptor, maxTapTreeDepth)
+	}
+	if !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("%w: unbalanced braces in %q",
+			ErrInvalidDescriptor, s)
+	}
+	args, err := splitArgs(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("%w: script tree branch %q must have "+
+			"two children", ErrInvalidDescriptor, s)
+	}
+
+	left, err := parseTapTree(args[0], depth+1, params)
+	if err != nil {
+		return nil, err
+	}
+	right, err := parseTapTree(args[1], depth+1, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tapTree{left: left, right: right}, nil
+}
+
+// forEachKey calls the passed function with every key of the expression, including
+// the keys of nested scripts.
+func (e *scriptExpr) forEachKey(f func(key *keyExpr)) {
+	for _, key := range e.keys {
+		f(key)
+	}
+	if e.sub != nil {
+		e.sub.forEachKey(f)
+	}
+	if e.tree != nil {
+		e.tree.forEachKey(f)
+	}
+}
+
+// forEachKey calls the passed function with every key of the tree's leaf
+// scripts.
+func (t *tapTree) forEachKey(f func(key *keyExpr)) {
+	if t.leaf != nil {
+		t.leaf.forEachKey(f)
+		return
+	}
+	t.left.forEachKey(f)
+	t.right.forEachKey(f)
+}
+
+// buildScript returns the script of the expression at the passed index.
+func (e *scriptExpr) buildScript(index uint32) ([]byte, error) {
+	switch e.typ {
+	case exprPk:
+		key, err := e.keys[0].serialize(index, e.ctx)
+		if err != nil {
+			return nil, err
+		}
+		return txscript.NewScriptBuilder().AddData(key).
+			AddOp(txscript.OP_CHECKSIG).Script()
+
+	case exprPkh:
+		key, err := e.keys[0].serialize(index, e.ctx)
+		if err != nil {
+			return nil, err
+		}
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).
+			AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(key)).
+			AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).
+			Script()
+
+	case exprWpkh:
+		key, err := e.keys[0].serialize(index, ctxWitnessV0)
+		if err != nil {
+			return nil, err
+		}
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(btcutil.Hash160(key)).Script()
+
+	case exprSh:
+		redeemScript, err := e.sub.buildScript(index)
+		if err != nil {
+			return nil, err
+		}
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).
+			AddData(btcutil.Hash160(redeemScript)).
+			AddOp(txscript.OP_EQUAL).Script()
+
+	case exprWsh:
+		witnessScript, err := e.sub.buildScript(index)
+		if err != nil {
+			return nil, err
+		}
+		scriptHash := sha256.Sum256(witnessScript)
+		return txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(scriptHash[:]).Script()
+
+	case exprMulti, exprSortedMulti:
+		keys := make([][]byte, 0, len(e.keys))
+		for _, key := range e.keys {
+			serialized, err := key.serialize(index, e.ctx)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, serialized)
+		}
+		if e.typ == exprSortedMulti {
+			sort.Slice(keys, func(i, j int) bool {
+				return bytes.Compare(keys[i], keys[j]) < 0
+			})
+		}
+
+		builder := txscript.NewScriptBuilder().
+			AddInt64(int64(e.threshold))
+		for _, key := range keys {
+			builder.AddData(key)
+		}
+		return builder.AddInt64(int64(len(keys))).
+			AddOp(txscript.OP_CHECKMULTISIG).Script()
+
+	case exprTr:
+		internalKey, err := e.keys[0].derive(index)
+		if err != nil {
+			return nil, err
+		}
+		var scriptRoot []byte
+		if e.tree != nil {
+			rootHash, err := e.tree.hash(index)
+			if err != nil {
+				return nil, err
+			}
+			scriptRoot = rootHash[:]
+		}
+		outputKey, err := txscript.ComputeTaprootOutputKey(
+			internalKey, scriptRoot,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return txscript.PayToTaprootScript(outputKey)
+
+	case exprAddr:
+		return txscript.PayToAddrScript(e.addr)
+
+	case exprRaw:
+		return e.script, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown script expression",
+		ErrInvalidDescriptor)
+}
+
+// hash returns the tapscript hash of the tree at the passed index as defined
+// by BIP 341.
+func (t *tapTree) hash(index uint32) (chainhash.Hash, error) {
+	if t.leaf != nil {
+		script, err := t.leaf.buildScript(index)
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		return txscript.NewBaseTapLeaf(script).TapHash(), nil
+	}
+
+	left, err := t.left.hash(index)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	right, err := t.right.hash(index)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return txscript.TapBranchHash(left[:], right[:]), nil
+}
+
+// string returns the expression, which includes private keys when
+// withPrivate is set.
+func (e *scriptExpr) string(withPrivate bool) string {
+	var args []string
+	switch e.typ {
+	case exprPk, exprPkh, exprWpkh:
+		args = []string{e.keys[0].String(withPrivate)}
+
+	case exprSh, exprWsh:
+		args = []string{e.sub.string(withPrivate)}
+
+	case exprMulti, exprSortedMulti:
+		args = []string{strconv.Itoa(e.threshold)}
+		for _, key := range e.keys {
+			args = append(args, key.String(withPrivate))
+		}
+
+	case exprTr:
+		args = []string{e.keys[0].String(withPrivate)}
+		if e.tree != nil {
+			args = append(args, e.tree.string(withPrivate))
+		}
+
+	case exprAddr:
+		args = []string{e.addr.EncodeAddress()}
+
+	case exprRaw:
+		args = []string{hex.EncodeToString(e.script)}
+	}
+
+	return e.typ.String() + "(" + strings.Join(args, ",") + ")"
+}
+
+// string returns the script tree, which includes private keys when
+// withPrivate is set.
+func (t *tapTree) string(withPrivate bool) string {
+	if t.leaf != nil {
+		return t.leaf.string(withPrivate)
+	}
+	return "{" + t.left.string(withPrivate) + "," +
+		t.right.string(withPrivate) + "}"
+}
+
+// String returns the canonical form of the descriptor along with its
+// checksum.  Private keys are replaced with their public keys.
+func (d *Descriptor) String() string {
+	desc := d.expr.string(false)
+
+	// The canonical form only contains characters in the input character
+	// set, so computing its checksum can't fail.
+	checksum, _ := Checksum(desc)
+	return desc + "#" + checksum
+}
+
+// IsRange returns whether the descriptor contains keys that are derived at
+// the index it is derived at.
+func (d *Descriptor) IsRange() bool {
+	isRange := false
+	d.expr.forEachKey(func(key *keyExpr) {
+		isRange = isRange || key.isRange()
+	})
+	return isRange
+}
+
+// IsSolvable returns whether the descriptor has the information needed to
+// sign for its scripts given the private keys, which is the case for all
+// descriptors other than addr and raw.
+func (d *Descriptor) IsSolvable() bool {
+	return d.expr.typ != exprAddr && d.expr.typ != exprRaw
+}
+
+// HasPrivateKeys returns whether the descriptor contains any private keys.
+func (d *Descriptor) HasPrivateKeys() bool {
+	hasPrivate := false
+	d.expr.forEachKey(func(key *keyExpr) {
+		hasPrivate = hasPrivate || key.isPrivate()
+	})
+	return hasPrivate
+}
+
+// Script returns the output script of the descriptor at the passed index,
+// which must be below the first hardened child index.  The index is ignored
+// when the descriptor isn't ranged.
+func (d *Descriptor) Script(index uint32) ([]byte, error) {
+	return d.expr.buildScript(index)
+}
+
+// Address returns the address of the output script of the descriptor at the
+// passed index.  ErrNoAddress is returned for scripts without an address
+// form, such as bare multisig scripts.
+func (d *Descriptor) Address(index uint32) (btcutil.Address, error) {
+	if d.expr.typ == exprAddr {
+		return d.expr.addr, nil
+	}
+
+	script, err := d.Script(index)
+	if err != nil {
+		return nil, err
+	}
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(script, d.params)
+	if err != nil {
+		return nil, err
+	}
+	switch class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy,
+		txscript.WitnessV0PubKeyHashTy, txscript.WitnessV0ScriptHashTy,
+		txscript.WitnessV1TaprootTy:
+
+		return addrs[0], nil
+	}
+
+	return nil, ErrNoAddress
+}
@@ -0,0 +1,500 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+// References:
+//   [BIP380]: BIP0380 - Output Script Descriptors General Operation
+//   https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki
+//
+//   [BIP381]-[BIP386]: Descriptor script expressions
+//   https://github.com/bitcoin/bips/blob/master/bip-0381.mediawiki
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcutil/hdkeychain"
+	"github.com/babylonchain-io/bbld/chaincfg"
+)
+
+// testRootKey is the BIP32 root key of the mnemonic made up of eleven times
+// "abandon" followed by "about", which the BIP44, BIP49, BIP84 and BIP86 test
+// vectors are derived from.
+const testRootKey = "xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDx" +
+	"o1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu"
+
+// TestChecksum tests the descriptor checksum vectors provided by [BIP380].
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		desc string
+		err  error
+	}{
+		{
+			name: "valid checksum",
+			desc: "raw(deadbeef)#89f8spxm",
+		},
+		{
+			name: "no checksum",
+			desc: "raw(deadbeef)",
+		},
+		{
+			name: "empty checksum",
+			desc: "raw(deadbeef)#",
+			err:  ErrInvalidChecksum,
+		},
+		{
+			name: "checksum too long",
+			desc: "raw(deadbeef)#89f8spxmx",
+			err:  ErrInvalidChecksum,
+		},
+		{
+			name: "checksum too short",
+			desc: "raw(deadbeef)#89f8spx",
+			err:  ErrInvalidChecksum,
+		},
+		{
+			name: "wrong checksum",
+			desc: "raw(deadbeef)#89f8spxn",
+			err:  ErrInvalidChecksum,
+		},
+		{
+			name: "invalid character",
+			desc: "raw(Ü)#00000000",
+			err:  ErrInvalidChecksum,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.desc, &chaincfg.MainNetParams)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: unexpected error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+
+	withChecksum, err := AddChecksum("raw(deadbeef)")
+	if err != nil {
+		t.Fatalf("AddChecksum: unexpected error: %v", err)
+	}
+	if withChecksum != "raw(deadbeef)#89f8spxm" {
+		t.Fatalf("AddChecksum: got %s, want raw(deadbeef)#89f8spxm",
+			withChecksum)
+	}
+}
+
+// TestScripts ensures the script expressions of [BIP381] through [BIP386]
+// produce the expected scripts and canonical descriptors.
+func TestScripts(t *testing.T) {
+	tests := []struct {
+		name      string
+		desc      string
+		canonical string
+		script    string
+	}{
+		{
+			name:   "pk",
+			desc:   "pk(0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798)",
+			script: "210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac",
+		},
+		{
+			name:   "pkh",
+			desc:   "pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)",
+			script: "76a91406afd46bcdfd22ef94ac122aa11f241244a37ecc88ac",
+		},
+		{
+			name:   "sh(pk)",
+			desc:   "sh(pk(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5))",
+			script: "a91490ec9e04add3f73f7b64df70b1d6f084a158b77a87",
+		},
+		{
+			name:   "wpkh",
+			desc:   "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+			script: "00147dd65592d0ab2fe0d0257d571abf032cd9db93dc",
+		},
+		{
+			name:   "sh(wpkh)",
+			desc:   "sh(wpkh(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556))",
+			script: "a914cc6ffbc0bf31af759451068f90ba7a0272b6b33287",
+		},
+		{
+			name:   "wsh(pkh)",
+			desc:   "wsh(pkh(02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13))",
+			script: "0020fc5acc302aab97f821f9a61e1cc572e7968a603551e95d4ba12b51df6581482f",
+		},
+		{
+			name:   "multi",
+			desc:   "multi(1,022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe4,025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc)",
+			script: "5121022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe421025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc52ae",
+		},
+		{
+			name:   "sortedmulti",
+			desc:   "sortedmulti(1,025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc,022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe4)",
+			script: "5121022f8bde4d1a07209355b4a7250a5c5128e88b84bddc619ab7cba8d569b240efe421025cbdf0646e5db4eaa398f365f2ea7a0e3d419b7e0330e39ce92bddedcac4f9bc52ae",
+		},
+		{
+			name:      "pkh with WIF and hardened h markers",
+			desc:      "pkh([D34DB33F/44h/0h/0h]L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1)",
+			canonical: "pkh([d34db33f/44'/0'/0']03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)",
+			script:    "76a9149a1c78a507689f6f54b847ad1cef1e614ee23f1e88ac",
+		},
+		{
+			name:   "raw",
+			desc:   "raw(deadbeef)",
+			script: "deadbeef",
+		},
+		{
+			name:   "addr",
+			desc:   "addr(bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu)",
+			script: "0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2",
+		},
+	}
+
+	for _, test := range tests {
+		desc, err := Parse(test.desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+
+		script, err := desc.Script(0)
+		if err != nil {
+			t.Errorf("%s: unexpected script error: %v", test.name, err)
+			continue
+		}
+		if got := hex.EncodeToString(script); got != test.script {
+			t.Errorf("%s: mismatched script -- got %s, want %s",
+				test.name, got, test.script)
+		}
+
+		canonical := test.canonical
+		if canonical == "" {
+			canonical = test.desc
+		}
+		canonical, _ = AddChecksum(canonical)
+		if got := desc.String(); got != canonical {
+			t.Errorf("%s: mismatched descriptor -- got %s, want %s",
+				test.name, got, canonical)
+		}
+	}
+}
+
+// TestDerive ensures ranged descriptors derive the addresses of the BIP44,
+// BIP49, BIP84 and BIP86 test vectors.
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		name  string
+		desc  string
+		index uint32
+		addr  string
+	}{
+		{
+			name: "BIP44 pkh",
+			desc: "pkh(" + testRootKey + "/44'/0'/0'/0/*)",
+			addr: "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+		},
+		{
+			name: "BIP49 sh(wpkh)",
+			desc: "sh(wpkh(" + testRootKey + "/49'/0'/0'/0/*))",
+			addr: "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf",
+		},
+		{
+			name: "BIP84 wpkh",
+			desc: "wpkh(" + testRootKey + "/84h/0h/0h/0/*)",
+			addr: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		},
+		{
+			name: "BIP86 tr",
+			desc: "tr(" + testRootKey + "/86'/0'/0'/0/*)",
+			addr: "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+		},
+		{
+			name:  "BIP86 tr second address",
+			desc:  "tr(" + testRootKey + "/86'/0'/0'/0/*)",
+			index: 1,
+			addr:  "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh",
+		},
+	}
+
+	for _, test := range tests {
+		desc, err := Parse(test.desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		if !desc.IsRange() || !desc.HasPrivateKeys() || !desc.IsSolvable() {
+			t.Errorf("%s: unexpected descriptor info -- range %v, "+
+				"private %v, solvable %v", test.name, desc.IsRange(),
+				desc.HasPrivateKeys(), desc.IsSolvable())
+		}
+
+		addr, err := desc.Address(test.index)
+		if err != nil {
+			t.Errorf("%s: unexpected address error: %v", test.name, err)
+			continue
+		}
+		if addr.EncodeAddress() != test.addr {
+			t.Errorf("%s: mismatched address -- got %s, want %s",
+				test.name, addr.EncodeAddress(), test.addr)
+		}
+
+		// The canonical descriptor must not reveal the private key.
+		if strings.Contains(desc.String(), "xprv") {
+			t.Errorf("%s: canonical descriptor %s contains a private "+
+				"key", test.name, desc.String())
+		}
+	}
+}
+
+// TestDerivePublic ensures a ranged descriptor with an account extended
+// public key derives the same addresses as the private key it was neutered
+// from.
+func TestDerivePublic(t *testing.T) {
+	root, err := hdkeychain.NewKeyFromString(testRootKey)
+	if err != nil {
+		t.Fatalf("unexpected error parsing root key: %v", err)
+	}
+	account := root
+	for _, idx := range []uint32{84, 0, 0} {
+		account, err = account.Derive(hdkeychain.HardenedKeyStart + idx)
+		if err != nil {
+			t.Fatalf("unexpected derivation error: %v", err)
+		}
+	}
+	accountPub, err := account.Neuter()
+	if err != nil {
+		t.Fatalf("unexpected error neutering key: %v", err)
+	}
+
+	privDesc, err := Parse("wpkh("+testRootKey+"/84'/0'/0'/0/*)",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	pubDesc, err := Parse("wpkh([73c5da0a/84'/0'/0']"+accountPub.String()+
+		"/0/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if pubDesc.HasPrivateKeys() || !pubDesc.IsRange() {
+		t.Fatalf("unexpected descriptor info -- private %v, range %v",
+			pubDesc.HasPrivateKeys(), pubDesc.IsRange())
+	}
+
+	for i := uint32(0); i < 5; i++ {
+		privScript, err := privDesc.Script(i)
+		if err != nil {
+			t.Fatalf("unexpected script error: %v", err)
+		}
+		pubScript, err := pubDesc.Script(i)
+		if err != nil {
+			t.Fatalf("unexpected script error: %v", err)
+		}
+		if hex.EncodeToString(privScript) != hex.EncodeToString(pubScript) {
+			t.Fatalf("index %d: mismatched scripts %x and %x", i,
+				privScript, pubScript)
+		}
+	}
+
+	// Hardened child indexes are outside of the range.
+	_, err = pubDesc.Script(hdkeychain.HardenedKeyStart)
+	if !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("unexpected error -- got %v, want %v", err,
+			ErrInvalidRange)
+	}
+}
+
+// TestTapTree ensures a tr descriptor with a script tree commits to its
+// leaves and that the leaf order within a branch is irrelevant.
+func TestTapTree(t *testing.T) {
+	const (
+		internalKey = "a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd"
+		leafKey1    = "669b8afcec803a0d323e9a17f3ea8e68e8abe5a278020a929adbec52421adbd0"
+		leafKey2    = "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	)
+
+	scriptFor := func(s string) []byte {
+		t.Helper()
+		desc, err := Parse(s, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", s, err)
+		}
+		script, err := desc.Script(0)
+		if err != nil {
+			t.Fatalf("unexpected script error for %s: %v", s, err)
+		}
+		return script
+	}
+
+	keyOnly := scriptFor("tr(" + internalKey + ")")
+	tree := scriptFor("tr(" + internalKey + ",{pk(" + leafKey1 + "),pk(" +
+		leafKey2 + ")})")
+	swapped := scriptFor("tr(" + internalKey + ",{pk(" + leafKey2 + "),pk(" +
+		leafKey1 + ")})")
+	single := scriptFor("tr(" + internalKey + ",pk(" + leafKey1 + "))")
+
+	if hex.EncodeToString(tree) != hex.EncodeToString(swapped) {
+		t.Fatalf("branch hash depends on leaf order: %x != %x", tree,
+			swapped)
+	}
+	if hex.EncodeToString(keyOnly) == hex.EncodeToString(tree) ||
+		hex.EncodeToString(single) == hex.EncodeToString(tree) {
+
+		t.Fatalf("output key doesn't commit to the script tree")
+	}
+	for _, script := range [][]byte{keyOnly, tree, single} {
+		if len(script) != 34 || script[0] != 0x51 || script[1] != 0x20 {
+			t.Fatalf("unexpected taproot script %x", script)
+		}
+	}
+}
+
+// TestParseErrors ensures invalid descriptors are rejected with the expected
+// error.
+func TestParseErrors(t *testing.T) {
+	const (
+		compressed   = "03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd"
+		uncompressed = "04a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd5b8dec5235a0fa8722476c7709c02559e3aa73aa03918ba2d492eea75abea235"
+		xpub         = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	)
+
+	tests := []struct {
+		name string
+		desc string
+		err  error
+	}{
+		{
+			name: "unknown expression",
+			desc: "foo(" + compressed + ")",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "unbalanced parentheses",
+			desc: "sh(wpkh(" + compressed + ")",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "uncompressed key in wpkh",
+			desc: "wpkh(" + uncompressed + ")",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "uncompressed key in wsh",
+			desc: "wsh(pk(" + uncompressed + "))",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "nested sh",
+			desc: "sh(sh(pk(" + compressed + ")))",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "wpkh inside wsh",
+			desc: "wsh(wpkh(" + compressed + "))",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "nested tr",
+			desc: "sh(tr(" + compressed + "))",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "multi threshold above key count",
+			desc: "multi(2," + compressed + ")",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "multi threshold zero",
+			desc: "multi(0," + compressed + ")",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "bare multi with too many keys",
+			desc: "multi(1," + strings.Repeat(compressed+",", 3) +
+				compressed + ")",
+			err: ErrInvalidDescriptor,
+		},
+		{
+			name: "sh multi redeem script too large",
+			desc: "sh(multi(1," + strings.Repeat(uncompressed+",", 8) +
+				uncompressed + "))",
+			err: ErrInvalidDescriptor,
+		},
+		{
+			name: "multi in tr",
+			desc: "tr(" + compressed + ",multi(1," + compressed + "))",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "tr tree branch with one child",
+			desc: "tr(" + compressed + ",{pk(" + compressed + ")})",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "hardened derivation from xpub",
+			desc: "pkh(" + xpub + "/0'/*)",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "hardened wildcard from xpub",
+			desc: "pkh(" + xpub + "/0/*')",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "wildcard not last",
+			desc: "pkh(" + xpub + "/*/0)",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "invalid origin fingerprint",
+			desc: "pkh([d34db3/44'/0'/0']" + compressed + ")",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "extended key for wrong network",
+			desc: "pkh(tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp/*)",
+			err:  ErrInvalidKey,
+		},
+		{
+			name: "address for wrong network",
+			desc: "addr(tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx)",
+			err:  ErrInvalidDescriptor,
+		},
+		{
+			name: "invalid raw script",
+			desc: "raw(deadbee)",
+			err:  ErrInvalidDescriptor,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.desc, &chaincfg.MainNetParams)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: unexpected error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestNoAddress ensures descriptors whose scripts have no address form return
+// ErrNoAddress.
+func TestNoAddress(t *testing.T) {
+	desc, err := Parse("pk(0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28"+
+		"d959f2815b16f81798)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if desc.IsRange() || desc.HasPrivateKeys() || !desc.IsSolvable() {
+		t.Fatalf("unexpected descriptor info -- range %v, private %v, "+
+			"solvable %v", desc.IsRange(), desc.HasPrivateKeys(),
+			desc.IsSolvable())
+	}
+	if _, err := desc.Address(0); !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("unexpected error -- got %v, want %v", err,
+			ErrNoAddress)
+	}
+}
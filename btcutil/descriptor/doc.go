@@ -0,0 +1,30 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package descriptor implements output script descriptors as defined by BIP 380
+through BIP 386.
+
+A descriptor is a human readable description of a set of output scripts along
+with the information needed to derive them.  The pk, pkh, wpkh, sh, wsh, multi,
+sortedmulti, tr, addr and raw expressions are supported, with keys given as
+hex-encoded public keys, WIF-encoded private keys, or extended keys along with a
+derivation path that may end in a wildcard.
+
+Parsing and Checksums
+
+Parse validates a descriptor for a network and returns a Descriptor.  The
+checksum suffix of a descriptor is optional, but it is verified when present.
+Checksum and AddChecksum compute the checksum of a descriptor, and the String
+method of a Descriptor returns its canonical form, which never includes private
+keys, along with its checksum.
+
+Deriving Scripts
+
+Descriptors whose extended keys end in a wildcard are ranged and describe one
+script per child index.  The Script and Address methods derive the output script
+and address at a given index, which is ignored for descriptors that aren't
+ranged.
+*/
+package descriptor
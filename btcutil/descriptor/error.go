@@ -0,0 +1,30 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import "errors"
+
+var (
+	// ErrInvalidChecksum describes an error where a descriptor checksum is
+	// malformed or doesn't match the descriptor, or the descriptor contains
+	// characters a checksum can't be computed for.
+	ErrInvalidChecksum = errors.New("invalid descriptor checksum")
+
+	// ErrInvalidDescriptor describes an error where a descriptor isn't
+	// well-formed or uses an expression in a context it isn't allowed in.
+	ErrInvalidDescriptor = errors.New("invalid descriptor")
+
+	// ErrInvalidKey describes an error where a KEY expression of a
+	// descriptor is invalid.
+	ErrInvalidKey = errors.New("invalid descriptor key")
+
+	// ErrInvalidRange describes an error where a descriptor is derived at
+	// an index outside of the unhardened child index range.
+	ErrInvalidRange = errors.New("invalid descriptor range")
+
+	// ErrNoAddress describes an error where an address is requested for a
+	// descriptor whose script has no address form.
+	ErrNoAddress = errors.New("descriptor does not have an address")
+)
@@ -0,0 +1,364 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/btcutil/hdkeychain"
+	"github.com/babylonchain-io/bbld/chaincfg"
+)
+
+const (
+	// pubKeyBytesLenUncompressed is the length of an uncompressed public
+	// key, and pubKeyUncompressed is the format byte it starts with.
+	// Hybrid public keys aren't allowed in descriptors.
+	pubKeyBytesLenUncompressed = 65
+	pubKeyUncompressed         = 0x04
+)
+
+// wildcardType describes whether and how an extended key is derived at the
+// index a descriptor is derived at.
+type wildcardType uint8
+
+const (
+	// wildcardNone indicates the key isn't ranged.
+	wildcardNone wildcardType = iota
+
+	// wildcardUnhardened indicates the key is derived at the unhardened
+	// child index, as in xpub/*.
+	wildcardUnhardened
+
+	// wildcardHardened indicates the key is derived at the hardened child
+	// index, as in xprv/*'.
+	wildcardHardened
+)
+
+// keyExpr is a KEY expression of a descriptor.  The key is either a fixed
+// public key, a fixed private key in WIF, or an extended key along with the
+// path to derive from it.
+type keyExpr struct {
+	// origin is the key origin information including the brackets, or
+	// empty when there isn't any.
+	origin string
+
+	// pubKey is the key for fixed public and private keys.  xOnly is set
+	// when the key was given in its 32-byte x-only form, and compressed is
+	// set when the key is used in its compressed form.
+	pubKey     *btcec.PublicKey
+	xOnly      bool
+	compressed bool
+
+	// wif is set for fixed private keys.
+	wif *btcutil.WIF
+
+	// xKey is the extended key as given, and path and wildcard describe
+	// how to derive from it.  base is the key derived through path, which
+	// is derived at the index when the key is ranged.
+	xKey     *hdkeychain.ExtendedKey
+	path     []uint32
+	wildcard wildcardType
+	base     *hdkeychain.ExtendedKey
+}
+
+// parseKeyExpr parses a KEY expression in the passed script context.
+func parseKeyExpr(s string, ctx scriptContext,
+	params *chaincfg.Params) (*keyExpr, error) {
+
+	key := &keyExpr{}
+
+	// Split off the key origin, which must be of the form
+	// [fingerprint/path...].
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: key origin %q is missing a "+
+				"closing bracket", ErrInvalidKey, s)
+		}
+		origin := s[1:end]
+		parts := strings.Split(origin, "/")
+		fingerprint, err := hex.DecodeString(parts[0])
+		if err != nil || len(fingerprint) != 4 {
+			return nil, fmt.Errorf("%w: invalid key origin "+
+				"fingerprint %q", ErrInvalidKey, parts[0])
+		}
+		if _, err := parsePath(parts[1:]); err != nil {
+			return nil, err
+		}
+		key.origin = "[" + strings.ToLower(parts[0])
+		for _, part := range parts[1:] {
+			key.origin += "/" + normalizePathElement(part)
+		}
+		key.origin += "]"
+		s = s[end+1:]
+	}
+	if strings.ContainsAny(s, "[]") {
+		return nil, fmt.Errorf("%w: unexpected key origin in %q",
+			ErrInvalidKey, s)
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) == 1 {
+		if err := key.parseFixedKey(s, ctx, params); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	xKey, err := hdkeychain.NewKeyFromString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid extended key %q: %v",
+			ErrInvalidKey, parts[0], err)
+	}
+	if !xKey.IsForNet(params) {
+		return nil, fmt.Errorf("%w: extended key %q is for the wrong "+
+			"network", ErrInvalidKey, parts[0])
+	}
+	key.xKey = xKey
+	key.compressed = true
+
+	// The final path element can be a wildcard, which makes the key
+	// ranged.
+	pathParts := parts[1:]
+	switch pathParts[len(pathParts)-1] {
+	case "*":
+		key.wildcard = wildcardUnhardened
+		pathParts = pathParts[:len(pathParts)-1]
+	case "*'", "*h":
+		key.wildcard = wildcardHardened
+		pathParts = pathParts[:len(pathParts)-1]
+	}
+	key.path, err = parsePath(pathParts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive the fixed part of the path once up front, which also ensures
+	// hardened derivation is only used with private keys.
+	key.base = xKey
+	for _, idx := range key.path {
+		key.base, err = key.base.Derive(idx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unable to derive %q: %v",
+				ErrInvalidKey, s, err)
+		}
+	}
+	if key.wildcard == wildcardHardened && !xKey.IsPrivate() {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidKey, s,
+			hdkeychain.ErrDeriveHardFromPublic)
+	}
+
+	return key, nil
+}
+
+// parseFixedKey parses a hex-encoded public key or a WIF-encoded private key
+// into the key.
+func (k *keyExpr) parseFixedKey(s string, ctx scriptContext,
+	params *chaincfg.Params) error {
+
+	if keyBytes, err := hex.DecodeString(s); err == nil {
+		switch {
+		case len(keyBytes) == schnorr.PubKeyBytesLen && ctx == ctxTaproot:
+			pubKey, err := schnorr.ParsePubKey(keyBytes)
+			if err != nil {
+				return fmt.Errorf("%w: invalid x-only key %q: %v",
+					ErrInvalidKey, s, err)
+			}
+			k.pubKey = pubKey
+			k.xOnly = true
+			k.compressed = true
+			return nil
+
+		case btcec.IsCompressedPubKey(keyBytes),
+			len(keyBytes) == pubKeyBytesLenUncompressed &&
+				keyBytes[0] == pubKeyUncompressed:
+
+			pubKey, err := btcec.ParsePubKey(keyBytes)
+			if err != nil {
+				return fmt.Errorf("%w: invalid public key %q: %v",
+					ErrInvalidKey, s, err)
+			}
+			k.pubKey = pubKey
+			k.compressed = len(keyBytes) == btcec.PubKeyBytesLenCompressed
+			return k.checkCompressed(ctx)
+		}
+
+		return fmt.Errorf("%w: invalid public key %q", ErrInvalidKey, s)
+	}
+
+	wif, err := btcutil.DecodeWIF(s)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a valid public key, private key "+
+			"or extended key", ErrInvalidKey, s)
+	}
+	if !wif.IsForNet(params) {
+		return fmt.Errorf("%w: private key is for the wrong network",
+			ErrInvalidKey)
+	}
+	k.wif = wif
+	k.pubKey = wif.PrivKey.PubKey()
+	k.compressed = wif.CompressPubKey
+	return k.checkCompressed(ctx)
+}
+
+// checkCompressed ensures the key is compressed when the script context
+// requires it.
+func (k *keyExpr) checkCompressed(ctx scriptContext) error {
+	if !k.compressed && (ctx == ctxWitnessV0 || ctx == ctxTaproot) {
+		return fmt.Errorf("%w: uncompressed keys are not allowed in "+
+			"segwit scripts", ErrInvalidKey)
+	}
+	return nil
+}
+
+// parsePath parses the elements of a derivation path, where hardened indexes
+// are marked with either ' or h.
+func parsePath(elements []string) ([]uint32, error) {
+	path := make([]uint32, 0, len(elements))
+	for _, element := range elements {
+		hardened := strings.HasSuffix(element, "'") ||
+			strings.HasSuffix(element, "h")
+		if hardened {
+			element = element[:len(element)-1]
+		}
+
+		idx, err := strconv.ParseUint(element, 10, 32)
+		if err != nil || idx >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%w: invalid path element %q",
+				ErrInvalidKey, element)
+		}
+		if hardened {
+			idx += hdkeychain.HardenedKeyStart
+		}
+		path = append(path, uint32(idx))
+	}
+
+	return path, nil
+}
+
+// normalizePathElement returns the passed valid path element with hardened
+// indexes marked with '.
+func normalizePathElement(element string) string {
+	if strings.HasSuffix(element, "h") {
+		return element[:len(element)-1] + "'"
+	}
+	return element
+}
+
+// formatPath returns the string form of the passed derivation path, including
+// the leading separator.
+func formatPath(path []uint32) string {
+	var b strings.Builder
+	for _, idx := range path {
+		b.WriteByte('/')
+		if idx >= hdkeychain.HardenedKeyStart {
+			b.WriteString(strconv.FormatUint(
+				uint64(idx-hdkeychain.HardenedKeyStart), 10,
+			))
+			b.WriteByte('\'')
+			continue
+		}
+		b.WriteString(strconv.FormatUint(uint64(idx), 10))
+	}
+	return b.String()
+}
+
+// isRange returns whether the key is derived at the index the descriptor is
+// derived at.
+func (k *keyExpr) isRange() bool {
+	return k.wildcard != wildcardNone
+}
+
+// isPrivate returns whether the key includes a private key.
+func (k *keyExpr) isPrivate() bool {
+	return k.wif != nil || (k.xKey != nil && k.xKey.IsPrivate())
+}
+
+// derive returns the public key at the passed index, which is ignored for
+// keys that aren't ranged.
+func (k *keyExpr) derive(index uint32) (*btcec.PublicKey, error) {
+	if k.xKey == nil {
+		return k.pubKey, nil
+	}
+
+	child := k.base
+	switch k.wildcard {
+	case wildcardUnhardened, wildcardHardened:
+		if index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%w: index %d is out of range",
+				ErrInvalidRange, index)
+		}
+		if k.wildcard == wildcardHardened {
+			index += hdkeychain.HardenedKeyStart
+		}
+
+		var err error
+		child, err = k.base.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return child.ECPubKey()
+}
+
+// serialize returns the serialization of the public key at the passed index
+// as used in scripts of the passed context.
+func (k *keyExpr) serialize(index uint32, ctx scriptContext) ([]byte, error) {
+	pubKey, err := k.derive(index)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ctx == ctxTaproot:
+		return schnorr.SerializePubKey(pubKey), nil
+	case k.compressed:
+		return pubKey.SerializeCompressed(), nil
+	default:
+		return pubKey.SerializeUncompressed(), nil
+	}
+}
+
+// String returns the key expression, which includes the private key when
+// withPrivate is set.
+func (k *keyExpr) String(withPrivate bool) string {
+	var key string
+	switch {
+	case k.xKey != nil:
+		xKey := k.xKey
+		if !withPrivate && xKey.IsPrivate() {
+			// Neutering a valid private key can't fail.
+			xKey, _ = xKey.Neuter()
+		}
+		key = xKey.String() + formatPath(k.path)
+		switch k.wildcard {
+		case wildcardUnhardened:
+			key += "/*"
+		case wildcardHardened:
+			key += "/*'"
+		}
+
+	case k.wif != nil && withPrivate:
+		key = k.wif.String()
+
+	case k.xOnly:
+		key = hex.EncodeToString(schnorr.SerializePubKey(k.pubKey))
+
+	case k.compressed:
+		key = hex.EncodeToString(k.pubKey.SerializeCompressed())
+
+	default:
+		key = hex.EncodeToString(k.pubKey.SerializeUncompressed())
+	}
+
+	return k.origin + key
+}
@@ -27,12 +27,33 @@ var (
 	// TagBIP0340Nonce is the BIP-0340 tag for nonces.
 	TagBIP0340Nonce = []byte("BIP0340/nonce")
 
+	// TagTapSighash is the message tag prefix used by BIP 341 to compute
+	// the signature hash of taproot spends.
+	TagTapSighash = []byte("TapSighash")
+
+	// TagTapLeaf is the message tag prefix used to compute the hash
+	// digest of a tapscript leaf.
+	TagTapLeaf = []byte("TapLeaf")
+
+	// TagTapBranch is the message tag prefix used to compute the
+	// hash digest of two tap leaves into a taproot branch node.
+	TagTapBranch = []byte("TapBranch")
+
+	// TagTapTweak is the message tag prefix used to compute the hash tweak
+	// used to enable a public key to commit to the taproot branch root
+	// for the witness program.
+	TagTapTweak = []byte("TapTweak")
+
 	// precomputedTags is a map containing the SHA-256 hash of the BIP-0340
-	// tags.
+	// and BIP-0341 tags.
 	precomputedTags = map[string]Hash{
 		string(TagBIP0340Challenge): sha256.Sum256(TagBIP0340Challenge),
 		string(TagBIP0340Aux):       sha256.Sum256(TagBIP0340Aux),
 		string(TagBIP0340Nonce):     sha256.Sum256(TagBIP0340Nonce),
+		string(TagTapSighash):       sha256.Sum256(TagTapSighash),
+		string(TagTapLeaf):          sha256.Sum256(TagTapLeaf),
+		string(TagTapBranch):        sha256.Sum256(TagTapBranch),
+		string(TagTapTweak):         sha256.Sum256(TagTapTweak),
 	}
 )
 
@@ -136,6 +136,11 @@ const (
 	// includes the deployment of BIPS 141, 142, 144, 145, 147 and 173.
 	DeploymentSegwit
 
+	// DeploymentTaproot defines the rule change deployment ID for the
+	// Taproot (+Schnorr) soft-fork package. The taproot package includes
+	// the deployment of BIPS 340, 341 and 342.
+	DeploymentTaproot
+
 	// NOTE: DefinedDeployments must always come last since it is used to
 	// determine how many defined deployments there currently are.
 
@@ -333,6 +338,19 @@ var MainNetParams = Params{
 				time.Unix(1510704000, 0), // November 15, 2017 UTC.
 			),
 		},
+		// Taproot is voted on from the first confirmation window of the
+		// chain and never expires, since the timeframe of the Bitcoin
+		// deployment is long past on this chain.
+		DeploymentTaproot: {
+			BitNumber: 2,
+			DeploymentStarter: NewMedianTimeDeploymentStarter(
+				time.Time{}, // Always available for vote
+			),
+			DeploymentEnder: NewMedianTimeDeploymentEnder(
+				time.Time{}, // Never expires.
+			),
+			CustomActivationThreshold: 1815, // 90% of 2016
+		},
 	},
 
 	// Mempool parameters
@@ -432,6 +450,16 @@ var RegressionNetParams = Params{
 				time.Time{}, // Never expires.
 			),
 		},
+		DeploymentTaproot: {
+			BitNumber: 2,
+			DeploymentStarter: NewMedianTimeDeploymentStarter(
+				time.Time{}, // Always available for vote
+			),
+			DeploymentEnder: NewMedianTimeDeploymentEnder(
+				time.Time{}, // Never expires.
+			),
+			CustomActivationThreshold: 108, // Only needs 75% hash rate.
+		},
 	},
 
 	// Mempool parameters
@@ -529,6 +557,16 @@ var TestNet3Params = Params{
 				time.Unix(1493596800, 0), // May 1, 2017 UTC.
 			),
 		},
+		DeploymentTaproot: {
+			BitNumber: 2,
+			DeploymentStarter: NewMedianTimeDeploymentStarter(
+				time.Unix(1619222400, 0), // April 24th, 2021 UTC.
+			),
+			DeploymentEnder: NewMedianTimeDeploymentEnder(
+				time.Unix(1628640000, 0), // August 11th, 2021 UTC.
+			),
+			CustomActivationThreshold: 1512, // 75% of 2016
+		},
 	},
 
 	// Mempool parameters
@@ -632,6 +670,16 @@ var SimNetParams = Params{
 				time.Time{}, // Never expires.
 			),
 		},
+		DeploymentTaproot: {
+			BitNumber: 2,
+			DeploymentStarter: NewMedianTimeDeploymentStarter(
+				time.Time{}, // Always available for vote
+			),
+			DeploymentEnder: NewMedianTimeDeploymentEnder(
+				time.Time{}, // Never expires.
+			),
+			CustomActivationThreshold: 75, // Only needs 75% hash rate.
+		},
 	},
 
 	// Mempool parameters
@@ -750,6 +798,16 @@ func CustomSignetParams(challenge []byte, dnsSeeds []DNSSeed) Params {
 					time.Time{}, // Never expires
 				),
 			},
+			DeploymentTaproot: {
+				BitNumber: 2,
+				DeploymentStarter: NewMedianTimeDeploymentStarter(
+					time.Time{}, // Always available for vote
+				),
+				DeploymentEnder: NewMedianTimeDeploymentEnder(
+					time.Time{}, // Never expires.
+				),
+				CustomActivationThreshold: 1815, // Only needs 90% hash rate.
+			},
 		},
 
 		// Mempool parameters
@@ -53,13 +53,16 @@ const (
 )
 
 // ConnReq is the connection request to a network address. If permanent, the
-// connection will be retried on disconnection.
+// connection will be retried on disconnection.  Block-relay-only connections
+// are only used to relay blocks, which hides them from the transaction and
+// address relay based topology inference used by eclipse attacks.
 type ConnReq struct {
 	// The following variables must only be used atomically.
 	id uint64
 
-	Addr      net.Addr
-	Permanent bool
+	Addr           net.Addr
+	Permanent      bool
+	BlockRelayOnly bool
 
 	conn       net.Conn
 	state      ConnState
@@ -124,6 +127,16 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound uint32
 
+	// TargetBlockRelayOnly is the number of block-relay-only outbound
+	// network connections to maintain in addition to TargetOutbound.
+	TargetBlockRelayOnly uint32
+
+	// Anchors are the addresses of the block-relay-only connections of a
+	// previous run.  They are connected to first on start, up to
+	// TargetBlockRelayOnly, so an attacker can't take over all of the
+	// connections by flooding the known addresses before a restart.
+	Anchors []net.Addr
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -211,10 +224,10 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 				"-- retrying connection in: %v", maxFailedAttempts,
 				cm.cfg.RetryDuration)
 			time.AfterFunc(cm.cfg.RetryDuration, func() {
-				cm.NewConnReq()
+				cm.newConnReq(c.BlockRelayOnly)
 			})
 		} else {
-			go cm.NewConnReq()
+			go cm.newConnReq(c.BlockRelayOnly)
 		}
 	}
 }
@@ -317,13 +330,25 @@ out:
 				}
 
 				// Otherwise, we will attempt a reconnection if
-				// we do not have enough peers, or if this is a
-				// persistent peer. The connection request is
-				// re added to the pending map, so that
-				// subsequent processing of connections and
-				// failures do not ignore the request.
-				if uint32(len(conns)) < cm.cfg.TargetOutbound ||
-					connReq.Permanent {
+				// we do not have enough peers of the same kind,
+				// or if this is a persistent peer. The
+				// connection request is re added to the pending
+				// map, so that subsequent processing of
+				// connections and failures do not ignore the
+				// request.
+				var numBlockRelayOnly uint32
+				for _, c := range conns {
+					if c.BlockRelayOnly {
+						numBlockRelayOnly++
+					}
+				}
+				numConns := uint32(len(conns)) - numBlockRelayOnly
+				target := cm.cfg.TargetOutbound
+				if connReq.BlockRelayOnly {
+					numConns = numBlockRelayOnly
+					target = cm.cfg.TargetBlockRelayOnly
+				}
+				if numConns < target || connReq.Permanent {
 
 					connReq.updateState(ConnPending)
 					log.Debugf("Reconnecting to %v",
@@ -359,6 +384,18 @@ out:
 // NewConnReq creates a new connection request and connects to the
 // corresponding address.
 func (cm *ConnManager) NewConnReq() {
+	cm.newConnReq(false)
+}
+
+// NewBlockRelayOnlyConnReq creates a new block-relay-only connection request
+// and connects to the corresponding address.
+func (cm *ConnManager) NewBlockRelayOnlyConnReq() {
+	cm.newConnReq(true)
+}
+
+// newConnReq creates a new connection request of the passed kind and connects
+// to the corresponding address.
+func (cm *ConnManager) newConnReq(blockRelayOnly bool) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
@@ -366,7 +403,7 @@ func (cm *ConnManager) NewConnReq() {
 		return
 	}
 
-	c := &ConnReq{}
+	c := &ConnReq{BlockRelayOnly: blockRelayOnly}
 	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
 
 	// Submit a request of a pending connection attempt to the connection
@@ -529,6 +566,20 @@ func (cm *ConnManager) Start() {
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq()
 	}
+
+	// Reconnect to the anchors before making new block-relay-only
+	// connections.
+	anchors := cm.cfg.Anchors
+	if uint32(len(anchors)) > cm.cfg.TargetBlockRelayOnly {
+		anchors = anchors[:cm.cfg.TargetBlockRelayOnly]
+	}
+	for _, addr := range anchors {
+		log.Debugf("Connecting to anchor %v", addr)
+		go cm.Connect(&ConnReq{Addr: addr, BlockRelayOnly: true})
+	}
+	for i := len(anchors); uint32(i) < cm.cfg.TargetBlockRelayOnly; i++ {
+		go cm.NewBlockRelayOnlyConnReq()
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
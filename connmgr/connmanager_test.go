@@ -216,6 +216,73 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestBlockRelayOnly tests the target number of block-relay-only outbound
+// connections and that the anchors are connected to first.
+func TestBlockRelayOnly(t *testing.T) {
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       2,
+		TargetBlockRelayOnly: 2,
+		Anchors: []net.Addr{
+			&net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555},
+			&net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555},
+			&net.TCPAddr{IP: net.ParseIP("127.0.0.4"), Port: 18555},
+		},
+		Dial: mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	defer cmgr.Stop()
+
+	// Only the configured number of anchors are connected to.
+	var numBlockRelayOnly, numAnchors int
+	var blockRelayOnly *ConnReq
+	for i := 0; i < 4; i++ {
+		c := <-connected
+		if !c.BlockRelayOnly {
+			continue
+		}
+		numBlockRelayOnly++
+		blockRelayOnly = c
+		if c.Addr.String() != "127.0.0.1:18555" {
+			numAnchors++
+		}
+	}
+	if numBlockRelayOnly != 2 || numAnchors != 2 {
+		t.Fatalf("block relay only: got %d connections to %d anchors, "+
+			"want %d to %d", numBlockRelayOnly, numAnchors, 2, 2)
+	}
+	select {
+	case c := <-connected:
+		t.Fatalf("block relay only: got unexpected connection - %v",
+			c.Addr)
+	case <-time.After(time.Millisecond):
+	}
+
+	// A lost block-relay-only connection is replaced by another one.
+	cmgr.Disconnect(blockRelayOnly.ID())
+	<-disconnected
+	c := <-connected
+	if !c.BlockRelayOnly {
+		t.Fatalf("block relay only: replaced by full relay connection")
+	}
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
@@ -27,6 +27,13 @@ Application Options:
       --addrindex             Maintain a full address-based transaction index
                               which makes the searchrawtransactions RPC
                               available
+      --addrutxoindex         Maintain an index of the unspent outputs and
+                              balance of each address which makes the
+                              getaddressbalance, getaddressutxos, and
+                              getaddressdeltas RPCs available
+      --asmap=                Path to an asmap file mapping IP addresses to
+                              autonomous system numbers which are used to
+                              bucket addresses and diversify outbound peers
       --banduration=          How long to ban misbehaving peers.  Valid time
                               units are {s, m, h}.  Minimum 1 second (default:
                               24h0m0s)
@@ -59,6 +66,8 @@ Application Options:
                               info)
       --dropaddrindex         Deletes the address-based transaction index from
                               the database on start up and then exits.
+      --dropaddrutxoindex     Deletes the address utxo index from the database
+                              on start up and then exits.
       --dropcfindex           Deletes the index used for committed filtering
                               (CF) support from the database on start up and
                               then exits.
@@ -78,6 +87,17 @@ Application Options:
                               memory (default: 100)
       --maxpeers=             Max number of inbound and outbound peers
                               (default: 125)
+      --maxpeersendrate=      Max average number of bytes per second sent to
+                              each non-whitelisted peer -- 0 disables the limit
+      --maxreorgdepth=        Refuse chain reorganizations that disconnect more
+                              than this many blocks until the new branch is
+                              approved with the reconsiderblock RPC -- 0
+                              disables the limit
+      --maxuploadtarget=      Try to keep the bytes sent to peers below this
+                              target per 24 hours by no longer serving
+                              historical blocks to non-whitelisted peers once
+                              it is exceeded -- must exceed the 576000000 bytes
+                              kept to relay new blocks, 0 disables the limit
       --miningaddr=           Add the specified payment address to the list of
                               addresses to use for generated blocks -- At least
                               one address is required if the generate option is
@@ -139,8 +159,13 @@ Application Options:
                               verification cache (default: 100000)
       --simnet                Use the simulation test network
       --testnet               Use the test network
+      --torcontrol=           Publish an onion service for the listen port
+                              through the Tor control port at this address (eg.
+                              127.0.0.1:9051)
       --torisolation          Enable Tor stream isolation by randomizing user
                               credentials for each connection.
+      --torpassword=          Password for the Tor control port -- The
+                              authentication cookie of Tor is used when not set
       --trickleinterval=      Minimum time between attempts to send new
                               inventory to a connected peer (default: 10s)
       --txindex               Maintain a full hash-based transaction index
@@ -149,6 +174,8 @@ Application Options:
       --uacomment=            Comment to add to the user agent -- See BIP 14
                               for more information.
       --upnp                  Use UPnP to map our listening port outside of NAT
+      --v2transport           Support the encrypted v2 P2P transport protocol
+                              (BIP0324)
   -V, --version               Display version information and exit
       --whitelist=            Add an IP network or IP that will not be banned.
                               (eg. 192.168.1.0/24 or ::1)
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/aead/siphash"
+)
+
+const (
+	// evictionProtectNetGroups is the number of inbound peers from distinct
+	// network groups, selected by a keyed hash only known to this server,
+	// protected from eviction.  Since attackers can't predict which groups
+	// are chosen, they can't take over all inbound slots by only owning
+	// addresses in a few network groups.
+	evictionProtectNetGroups = 4
+
+	// evictionProtectPing is the number of inbound peers with the lowest
+	// ping time protected from eviction.
+	evictionProtectPing = 8
+
+	// evictionProtectTxRelay is the number of inbound peers which most
+	// recently relayed new transactions protected from eviction.
+	evictionProtectTxRelay = 4
+
+	// evictionProtectBlockRelay is the number of inbound peers which most
+	// recently relayed new blocks protected from eviction.
+	evictionProtectBlockRelay = 4
+)
+
+// evictionCandidate describes an inbound peer which may be evicted to make room
+// for a new inbound peer.
+type evictionCandidate struct {
+	id            int32
+	netGroup      string
+	keyedNetGroup uint64
+	pingMicros    int64
+	lastBlockTime int64
+	lastTxTime    int64
+	timeConnected time.Time
+}
+
+// newEvictionCandidate returns the eviction candidate describing the passed
+// peer in the passed network group.  The network group is hashed with the
+// passed key.
+func newEvictionCandidate(sp *serverPeer, netGroup string,
+	key *[siphash.KeySize]byte) evictionCandidate {
+
+	return evictionCandidate{
+		id:            sp.ID(),
+		netGroup:      netGroup,
+		keyedNetGroup: siphash.Sum64([]byte(netGroup), key),
+		pingMicros:    sp.LastPingMicros(),
+		lastBlockTime: atomic.LoadInt64(&sp.lastBlockTime),
+		lastTxTime:    atomic.LoadInt64(&sp.lastTxTime),
+		timeConnected: sp.TimeConnected(),
+	}
+}
+
+// protectCandidates removes the first n of the passed candidates according to
+// the passed ordering, which are protected from eviction, and returns the
+// remaining candidates.
+func protectCandidates(candidates []evictionCandidate, n int,
+	less func(a, b *evictionCandidate) bool) []evictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(&candidates[i], &candidates[j])
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[n:]
+}
+
+// selectPeerToEvict selects the inbound peer to evict among the passed
+// candidates to make room for a new inbound peer.  Peers from diverse network
+// groups, with the lowest ping times, which recently relayed new transactions
+// and blocks, and the longest connected ones are protected.  The youngest peer
+// of the network group with the most remaining peers is selected, so that an
+// attacker needs to control many network groups while behaving well to take
+// over the inbound slots.  It returns false when all peers are protected.
+func selectPeerToEvict(candidates []evictionCandidate) (int32, bool) {
+	candidates = protectCandidates(candidates, evictionProtectNetGroups,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		})
+
+	// Peers without a ping time yet are sorted last.
+	candidates = protectCandidates(candidates, evictionProtectPing,
+		func(a, b *evictionCandidate) bool {
+			if a.pingMicros == 0 || b.pingMicros == 0 {
+				return a.pingMicros != 0
+			}
+			return a.pingMicros < b.pingMicros
+		})
+
+	candidates = protectCandidates(candidates, evictionProtectTxRelay,
+		func(a, b *evictionCandidate) bool {
+			if a.lastTxTime != b.lastTxTime {
+				return a.lastTxTime > b.lastTxTime
+			}
+			return a.timeConnected.Before(b.timeConnected)
+		})
+
+	candidates = protectCandidates(candidates, evictionProtectBlockRelay,
+		func(a, b *evictionCandidate) bool {
+			if a.lastBlockTime != b.lastBlockTime {
+				return a.lastBlockTime > b.lastBlockTime
+			}
+			return a.timeConnected.Before(b.timeConnected)
+		})
+
+	// Protect half of the remaining peers which have been connected the
+	// longest.
+	candidates = protectCandidates(candidates, len(candidates)/2,
+		func(a, b *evictionCandidate) bool {
+			return a.timeConnected.Before(b.timeConnected)
+		})
+
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	// Find the network group with the most peers, preferring the one with
+	// the youngest peer on ties, and evict its youngest peer.
+	groups := make(map[string][]*evictionCandidate)
+	for i := range candidates {
+		c := &candidates[i]
+		groups[c.netGroup] = append(groups[c.netGroup], c)
+	}
+	var evictGroup []*evictionCandidate
+	var evictPeer *evictionCandidate
+	for _, group := range groups {
+		youngest := group[0]
+		for _, c := range group[1:] {
+			if c.timeConnected.After(youngest.timeConnected) {
+				youngest = c
+			}
+		}
+		if len(group) > len(evictGroup) || (len(group) == len(evictGroup) &&
+			youngest.timeConnected.After(evictPeer.timeConnected)) {
+
+			evictGroup = group
+			evictPeer = youngest
+		}
+	}
+	return evictPeer.id, true
+}
+
+// evictInboundPeer disconnects the inbound peer selected by the eviction
+// policy to make room for a new inbound peer.  Whitelisted peers are never
+// evicted.  It returns whether a peer was evicted.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]evictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.isWhitelisted || !sp.Connected() {
+			continue
+		}
+		netGroup := s.addrManager.GroupKey(sp.NA())
+		candidates = append(candidates, newEvictionCandidate(sp,
+			netGroup, &s.netGroupKey))
+	}
+
+	id, ok := selectPeerToEvict(candidates)
+	if !ok {
+		return false
+	}
+	sp := state.inboundPeers[id]
+	srvrLog.Debugf("Evicting inbound peer %s to make room for a new peer", sp)
+	sp.Disconnect()
+	return true
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSelectPeerToEvict ensures the inbound peer to evict is selected from the
+// largest network group among the peers which are not protected.
+func TestSelectPeerToEvict(t *testing.T) {
+	now := time.Now()
+
+	// newCandidates returns n candidates in the passed network group which
+	// connected at the passed number of seconds ago and decrementing.  The
+	// ids start at the passed id.
+	newCandidates := func(id int32, n int, netGroup string,
+		connectedAgo int) []evictionCandidate {
+
+		candidates := make([]evictionCandidate, 0, n)
+		for i := 0; i < n; i++ {
+			candidates = append(candidates, evictionCandidate{
+				id:            id + int32(i),
+				netGroup:      netGroup,
+				keyedNetGroup: uint64(1000 + id + int32(i)),
+				timeConnected: now.Add(-time.Duration(connectedAgo-i) *
+					time.Second),
+			})
+		}
+		return candidates
+	}
+
+	// honestCandidates returns 20 long connected candidates in distinct
+	// network groups with ping times whose ids start at 0.
+	honestCandidates := func() []evictionCandidate {
+		var candidates []evictionCandidate
+		for i := 0; i < 20; i++ {
+			c := newCandidates(int32(i), 1, fmt.Sprintf("honest%d", i),
+				10000+i)[0]
+			c.keyedNetGroup = uint64(i)
+			c.pingMicros = int64(1000 + i)
+			candidates = append(candidates, c)
+		}
+		return candidates
+	}
+
+	tests := []struct {
+		name       string
+		candidates func() []evictionCandidate
+		wantID     int32
+		wantEvict  bool
+	}{
+		{
+			name:       "no candidates",
+			candidates: func() []evictionCandidate { return nil },
+			wantEvict:  false,
+		},
+		{
+			name: "all candidates protected",
+			candidates: func() []evictionCandidate {
+				return newCandidates(0, 12, "group", 100)
+			},
+			wantEvict: false,
+		},
+		{
+			// The attackers occupy two network groups, so the
+			// youngest peer of the larger one is evicted.
+			name: "largest group youngest peer",
+			candidates: func() []evictionCandidate {
+				candidates := honestCandidates()
+				candidates = append(candidates, newCandidates(100, 10,
+					"attacker1", 100)...)
+				return append(candidates, newCandidates(200, 15,
+					"attacker2", 100)...)
+			},
+			wantID:    214,
+			wantEvict: true,
+		},
+		{
+			// The youngest attacker peers are protected since they
+			// relayed new transactions and blocks or have the
+			// lowest ping, so the next youngest one is evicted.
+			name: "protected by relay and ping",
+			candidates: func() []evictionCandidate {
+				candidates := honestCandidates()
+				attackers := newCandidates(200, 25, "attacker", 100)
+				attackers[24].lastTxTime = now.Unix()
+				attackers[23].lastBlockTime = now.Unix()
+				attackers[22].pingMicros = 1
+				return append(candidates, attackers...)
+			},
+			wantID:    221,
+			wantEvict: true,
+		},
+		{
+			// Ties in the number of peers are broken by evicting
+			// from the group with the youngest peer.
+			name: "tie broken by youngest peer",
+			candidates: func() []evictionCandidate {
+				candidates := honestCandidates()
+				candidates = append(candidates, newCandidates(100, 12,
+					"attacker1", 100)...)
+				return append(candidates, newCandidates(200, 12,
+					"attacker2", 50)...)
+			},
+			wantID:    211,
+			wantEvict: true,
+		},
+	}
+
+	for _, test := range tests {
+		id, ok := selectPeerToEvict(test.candidates())
+		if ok != test.wantEvict {
+			t.Errorf("%s: wrong eviction result - got %v, want %v",
+				test.name, ok, test.wantEvict)
+			continue
+		}
+		if ok && id != test.wantID {
+			t.Errorf("%s: wrong evicted peer - got %d, want %d",
+				test.name, id, test.wantID)
+		}
+	}
+}
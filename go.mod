@@ -7,6 +7,7 @@ replace github.com/babylonchain-io/bbld/btcutil => ./btcutil
 replace github.com/babylonchain-io/bbld/btcec => ./btcec
 
 require (
+	github.com/aead/siphash v1.0.1
 	github.com/babylonchain-io/bbld/btcec v0.0.0-00010101000000-000000000000
 	github.com/babylonchain-io/bbld/btcutil v0.0.0-00010101000000-000000000000
 	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f
@@ -22,8 +23,8 @@ require (
 )
 
 require (
-	github.com/aead/siphash v1.0.1 // indirect
 	github.com/btcsuite/snappy-go v1.0.0 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/hpcloud/tail v1.0.0 // indirect
 	github.com/kkdai/bstream v0.0.0-20161212061736-f391b8402d23 // indirect
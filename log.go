@@ -20,6 +20,7 @@ import (
 	"github.com/babylonchain-io/bbld/mining/cpuminer"
 	"github.com/babylonchain-io/bbld/netsync"
 	"github.com/babylonchain-io/bbld/peer"
+	"github.com/babylonchain-io/bbld/torcontrol"
 	"github.com/babylonchain-io/bbld/txscript"
 
 	"github.com/btcsuite/btclog"
@@ -68,6 +69,7 @@ var (
 	scrpLog = backendLog.Logger("SCRP")
 	srvrLog = backendLog.Logger("SRVR")
 	syncLog = backendLog.Logger("SYNC")
+	torcLog = backendLog.Logger("TORC")
 	txmpLog = backendLog.Logger("TXMP")
 )
 
@@ -83,6 +85,7 @@ func init() {
 	peer.UseLogger(peerLog)
 	txscript.UseLogger(scrpLog)
 	netsync.UseLogger(syncLog)
+	torcontrol.UseLogger(torcLog)
 	mempool.UseLogger(txmpLog)
 }
 
@@ -102,6 +105,7 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"SCRP": scrpLog,
 	"SRVR": srvrLog,
 	"SYNC": syncLog,
+	"TORC": torcLog,
 	"TXMP": txmpLog,
 }
 
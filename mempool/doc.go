@@ -48,6 +48,11 @@ be an exhaustive list.
    - Automatic addition of orphan transactions that are no longer orphans as new
      transactions are added to the pool
    - Individual orphan transaction query support
+ - Package acceptance (child-pays-for-parent)
+   - Evaluation of a child transaction along with its parents against the fees
+     of the package as a whole
+   - Acceptance of orphan transactions paying for a parent previously rejected
+     for paying insufficient fees
  - Configurable transaction acceptance policy
    - Option to accept or reject standard transactions
    - Option to accept or reject transactions based on priority calculations
@@ -174,6 +174,15 @@ type orphanWithData struct {
 	posData []byte
 }
 
+// lowFeeTx is a transaction that was rejected for paying insufficient fees on
+// its own and is cached so it can be accepted along with a transaction paying
+// for it.  It also contains an expiration time to help prevent caching the
+// transaction forever.
+type lowFeeTx struct {
+	*orphanWithData
+	expiration time.Time
+}
+
 // TxPool is used as a source of transactions that need to be mined into blocks
 // and relayed to other peers.  It is safe for concurrent access from multiple
 // peers.
@@ -181,14 +190,17 @@ type TxPool struct {
 	// The following variables must only be used atomically.
 	lastUpdated int64 // last time pool was updated
 
-	mtx           sync.RWMutex
-	cfg           Config
-	pool          map[chainhash.Hash]*TxDesc
-	orphans       map[chainhash.Hash]*orphanTx
-	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*orphanWithData
-	outpoints     map[wire.OutPoint]*btcutil.Tx
-	pennyTotal    float64 // exponentially decaying total for penny spends.
-	lastPennyUnix int64   // unix time of last ``penny spend''
+	mtx            sync.RWMutex
+	cfg            Config
+	pool           map[chainhash.Hash]*TxDesc
+	poolByWTxId    map[chainhash.Hash]*TxDesc
+	orphans        map[chainhash.Hash]*orphanTx
+	orphansByWTxId map[chainhash.Hash]*orphanTx
+	orphansByPrev  map[wire.OutPoint]map[chainhash.Hash]*orphanWithData
+	outpoints      map[wire.OutPoint]*btcutil.Tx
+	lowFeeTxns     map[chainhash.Hash]*lowFeeTx
+	pennyTotal     float64 // exponentially decaying total for penny spends.
+	lastPennyUnix  int64   // unix time of last ``penny spend''
 
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
@@ -239,6 +251,7 @@ func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
 
 	// Remove the transaction from the orphan pool.
 	delete(mp.orphans, *txHash)
+	delete(mp.orphansByWTxId, *otx.tx.WitnessHash())
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -288,6 +301,15 @@ func (mp *TxPool) limitNumOrphans() error {
 			}
 		}
 
+		// Also remove the expired low fee transactions since orphans
+		// paying for them are just as unlikely to materialize.
+		origNumLowFee := len(mp.lowFeeTxns)
+		for hash, lf := range mp.lowFeeTxns {
+			if now.After(lf.expiration) {
+				delete(mp.lowFeeTxns, hash)
+			}
+		}
+
 		// Set next expiration scan to occur after the scan interval.
 		mp.nextExpireScan = now.Add(orphanExpireScanInterval)
 
@@ -297,6 +319,12 @@ func (mp *TxPool) limitNumOrphans() error {
 				pickNoun(numExpired, "orphan", "orphans"),
 				numOrphans)
 		}
+		numLowFee := len(mp.lowFeeTxns)
+		if numExpired := origNumLowFee - numLowFee; numExpired > 0 {
+			log.Debugf("Expired %d low fee %s (remaining: %d)",
+				numExpired, pickNoun(numExpired, "transaction",
+					"transactions"), numLowFee)
+		}
 	}
 
 	// Nothing to do if adding another orphan will not cause the pool to
@@ -335,11 +363,13 @@ func (mp *TxPool) addOrphan(o *orphanWithData, tag Tag) {
 	// orphan if space is still needed.
 	mp.limitNumOrphans()
 
-	mp.orphans[*o.tx.Hash()] = &orphanTx{
+	otx := &orphanTx{
 		tx:         o.tx,
 		tag:        tag,
 		expiration: time.Now().Add(orphanTTL),
 	}
+	mp.orphans[*o.tx.Hash()] = otx
+	mp.orphansByWTxId[*o.tx.WitnessHash()] = otx
 	for _, txIn := range o.tx.MsgTx().TxIn {
 		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
 			mp.orphansByPrev[txIn.PreviousOutPoint] =
@@ -459,6 +489,22 @@ func (mp *TxPool) haveTransaction(hash *chainhash.Hash) bool {
 	return mp.isTransactionInPool(hash) || mp.isOrphanInPool(hash)
 }
 
+// HaveTransactionByWitnessHash returns whether or not the transaction with the
+// passed witness hash (wtxid) already exists in the main pool or in the orphan
+// pool.  Unlike HaveTransaction, it does not report transactions which only
+// differ in their witness data.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) HaveTransactionByWitnessHash(wtxid *chainhash.Hash) bool {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	_, inPool := mp.poolByWTxId[*wtxid]
+	_, inOrphanPool := mp.orphansByWTxId[*wtxid]
+	mp.mtx.RUnlock()
+
+	return inPool || inOrphanPool
+}
+
 // HaveTransaction returns whether or not the passed transaction already exists
 // in the main pool or in the orphan pool.
 //
@@ -501,6 +547,7 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		delete(mp.poolByWTxId, *tx.WitnessHash())
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -524,6 +571,10 @@ func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 // necessary when a block is connected to the main chain because the block may
 // contain transactions which were previously unknown to the memory pool.
 //
+// The passed transaction and the ones spending the same outputs are also
+// removed from the cache of transactions rejected for paying insufficient fees
+// since they can no longer be accepted.
+//
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	// Protect concurrent access.
@@ -535,6 +586,7 @@ func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 			}
 		}
 	}
+	mp.removeLowFeeDoubleSpends(tx)
 	mp.mtx.Unlock()
 }
 
@@ -559,6 +611,7 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 	}
 
 	mp.pool[*tx.Hash()] = txD
+	mp.poolByWTxId[*tx.WitnessHash()] = txD
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
@@ -836,6 +889,24 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*btcutil.Tx, []byte,
 	return nil, nil, fmt.Errorf("transaction is not in the pool")
 }
 
+// FetchTransactionByWitnessHash returns the transaction with the passed witness
+// hash (wtxid) from the transaction pool.  This only fetches from the main
+// transaction pool and does not include orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTransactionByWitnessHash(wtxid *chainhash.Hash) (*btcutil.Tx, []byte, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txDesc, exists := mp.poolByWTxId[*wtxid]
+	mp.mtx.RUnlock()
+
+	if exists {
+		return txDesc.Tx, txDesc.PosData, nil
+	}
+
+	return nil, nil, fmt.Errorf("transaction is not in the pool")
+}
+
 // validateReplacement determines whether a transaction is deemed as a valid
 // replacement of all of its conflicts according to the RBF policy. If it is
 // valid, no error is returned. Otherwise, an error is returned indicating what
@@ -934,8 +1005,14 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
 // more details.
 //
+// When a package is passed, the transaction is evaluated as part of it.  The
+// outputs of the transactions already validated in the package are available
+// to it, the fee checks are left to the caller to perform for the package as a
+// whole, and the transaction is recorded in the package instead of being added
+// to the main pool, in which case the returned descriptor is nil.
+//
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew, rateLimit, rejectDupOrphans bool, pkg *txPackage) ([]*chainhash.Hash, *TxDesc, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has witness data, and segwit isn't active yet, If
@@ -1045,6 +1122,14 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 		return nil, nil, err
 	}
 
+	// Replacements are not supported for package transactions since they
+	// are only validated against the fees of the package.
+	if isReplacement && pkg != nil {
+		str := fmt.Sprintf("package transaction %v replaces "+
+			"transactions in the memory pool", txHash)
+		return nil, nil, txRuleError(wire.RejectDuplicate, str)
+	}
+
 	// Fetch all of the unspent transaction outputs referenced by the inputs
 	// to this transaction.  This function also attempts to fetch the
 	// transaction itself to be used for detecting a duplicate transaction
@@ -1056,6 +1141,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 		}
 		return nil, nil, err
 	}
+	if pkg != nil {
+		pkg.addInputUtxos(tx, utxoView)
+	}
 
 	// Don't allow the transaction if it exists in the main chain and is
 	// already fully spent.
@@ -1170,9 +1258,15 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 	// which is more desirable.  Therefore, as long as the size of the
 	// transaction does not exceed 1000 less than the reserved space for
 	// high-priority transactions, don't require a fee for it.
+	//
+	// Package transactions are exempted since the fees of the package as a
+	// whole are checked instead.
 	serializedSize := GetTxVirtualSize(tx)
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
 		mp.cfg.Policy.MinRelayTxFee)
+	if pkg != nil {
+		minFee = 0
+	}
 	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
@@ -1229,11 +1323,22 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 		}
 	}
 
+	// Until the taproot soft-fork has activated, taproot outputs are
+	// treated as unknown witness programs, so spends of them are rejected
+	// as non-standard since they can't be mined under the new rules yet.
+	scriptFlags := txscript.StandardVerifyFlags
+	taprootActive, err := mp.cfg.IsDeploymentActive(chaincfg.DeploymentTaproot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !taprootActive {
+		scriptFlags &^= txscript.ScriptVerifyTaproot
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView,
-		txscript.StandardVerifyFlags, mp.cfg.SigCache,
-		mp.cfg.HashCache)
+		scriptFlags, mp.cfg.SigCache, mp.cfg.HashCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -1241,6 +1346,19 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 		return nil, nil, err
 	}
 
+	// The package transaction is valid, so record it in the package for
+	// the caller to add it to the mempool once the package as a whole is
+	// deemed acceptable.
+	if pkg != nil {
+		pkg.add(&packageTx{
+			tx:       tx,
+			posData:  posData,
+			utxoView: utxoView,
+			fee:      txFee,
+		})
+		return nil, nil, nil
+	}
+
 	// Now that we've deemed the transaction as valid, we can add it to the
 	// mempool. If it ended up replacing any transactions, we'll remove them
 	// first.
@@ -1277,7 +1395,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew,
 func (mp *TxPool) MaybeAcceptTransaction(tx *btcutil.Tx, posData []byte, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, posData, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, posData, isNew, rateLimit, true, nil)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
@@ -1320,7 +1438,7 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 			// Potentially accept an orphan into the tx pool.
 			for _, orphanWithData := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					orphanWithData.tx, orphanWithData.posData, true, true, false)
+					orphanWithData.tx, orphanWithData.posData, true, true, false, nil)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1389,10 +1507,17 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 // such as rejecting duplicate transactions, ensuring transactions follow all
 // rules, orphan transaction handling, and insertion into the memory pool.
 //
+// Transactions rejected for paying insufficient fees are cached, up to the max
+// number of orphans, so that an orphan transaction spending them can pay for
+// them, in which case both are accepted as a package.  See ProcessPackage for
+// more details.
+//
 // It returns a slice of transactions added to the mempool.  When the
 // error is nil, the list will include the passed transaction itself along
 // with any additional orphan transactions that were added as a result of
-// the passed one being accepted.
+// the passed one being accepted.  The passed transaction is the first one in
+// the list unless it is an orphan accepted along with its parent, which then
+// precedes it.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, posData []byte, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
@@ -1404,8 +1529,20 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, posData []byte, allowOrphan
 
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, posData, true, rateLimit,
-		true)
+		true, nil)
 	if err != nil {
+		// A transaction which doesn't pay sufficient fees on its own
+		// may still be paid for by an orphan transaction spending it,
+		// or by one received later, so attempt to accept it along with
+		// the orphans as a package and cache it otherwise.
+		if isInsufficientFeeError(err) {
+			o := &orphanWithData{tx: tx, posData: posData}
+			acceptedTxs := mp.resolveLowFeeTx(o)
+			if len(acceptedTxs) > 0 {
+				return acceptedTxs, nil
+			}
+			mp.addLowFeeTx(o)
+		}
 		return nil, err
 	}
 
@@ -1425,8 +1562,22 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, posData []byte, allowOrphan
 		return acceptedTxs, nil
 	}
 
-	// The transaction is an orphan (has inputs missing).  Reject
-	// it if the flag to allow orphans is not set.
+	// The transaction is an orphan (has inputs missing).  Attempt to accept
+	// it as a package along with its parent when orphans are allowed and
+	// the only missing parent was previously rejected for paying
+	// insufficient fees.
+	parent := mp.orphanPackageParent(missingParents)
+	if allowOrphan && parent != nil {
+		pkg := []*orphanWithData{parent, {tx: tx, posData: posData}}
+		acceptedTxs, err := mp.processPackage(pkg)
+		if err == nil {
+			return acceptedTxs, nil
+		}
+		log.Debugf("Rejected package of transaction %v with parent "+
+			"%v: %v", tx.Hash(), parent.tx.Hash(), err)
+	}
+
+	// Reject the orphan if the flag to allow orphans is not set.
 	if !allowOrphan {
 		// Only use the first missing parent transaction in
 		// the error message.
@@ -1577,9 +1728,12 @@ func New(cfg *Config) *TxPool {
 	return &TxPool{
 		cfg:            *cfg,
 		pool:           make(map[chainhash.Hash]*TxDesc),
+		poolByWTxId:    make(map[chainhash.Hash]*TxDesc),
 		orphans:        make(map[chainhash.Hash]*orphanTx),
+		orphansByWTxId: make(map[chainhash.Hash]*orphanTx),
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*orphanWithData),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		lowFeeTxns:     make(map[chainhash.Hash]*lowFeeTx),
 	}
 }
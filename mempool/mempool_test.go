@@ -107,6 +107,12 @@ func (s *fakeChain) CalcSequenceLock(tx *btcutil.Tx,
 	}, nil
 }
 
+// IsDeploymentActive returns whether the passed deployment is active for the
+// fake chain instance.  All deployments are treated as active.
+func (s *fakeChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
+	return true, nil
+}
+
 // spendableOutput is a convenience type that houses a particular utxo and the
 // amount associated with it.
 type spendableOutput struct {
@@ -326,13 +332,14 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 				MinRelayTxFee:        1000, // 1 Satoshi per byte
 				MaxTxVersion:         1,
 			},
-			ChainParams:      chainParams,
-			FetchUtxoView:    chain.FetchUtxoView,
-			BestHeight:       chain.BestHeight,
-			MedianTimePast:   chain.MedianTimePast,
-			CalcSequenceLock: chain.CalcSequenceLock,
-			SigCache:         nil,
-			AddrIndex:        nil,
+			ChainParams:        chainParams,
+			FetchUtxoView:      chain.FetchUtxoView,
+			BestHeight:         chain.BestHeight,
+			MedianTimePast:     chain.MedianTimePast,
+			CalcSequenceLock:   chain.CalcSequenceLock,
+			IsDeploymentActive: chain.IsDeploymentActive,
+			SigCache:           nil,
+			AddrIndex:          nil,
 		}),
 	}
 
@@ -449,6 +456,19 @@ func testPoolMembership(tc *testContext, tx *btcutil.Tx, inOrphanPool, inTxPool
 		tc.t.Fatalf("HaveTransaction: want %v, got %v", wantHaveTx,
 			gotHaveTx)
 	}
+
+	// The transaction must also be found by its witness hash.
+	wtxid := tx.WitnessHash()
+	gotHaveTx = tc.harness.txPool.HaveTransactionByWitnessHash(wtxid)
+	if wantHaveTx != gotHaveTx {
+		tc.t.Fatalf("HaveTransactionByWitnessHash: want %v, got %v",
+			wantHaveTx, gotHaveTx)
+	}
+	_, _, err := tc.harness.txPool.FetchTransactionByWitnessHash(wtxid)
+	if gotFetch := err == nil; inTxPool != gotFetch {
+		tc.t.Fatalf("FetchTransactionByWitnessHash: want %v, got %v",
+			inTxPool, gotFetch)
+	}
 }
 
 // TestSimpleOrphanChain ensures that a simple chain of orphans is handled
@@ -561,7 +581,7 @@ func TestOrphanReject(t *testing.T) {
 
 		// Ensure no transactions were reported as accepted.
 		if len(acceptedTxns) != 0 {
-			t.Fatal("ProcessTransaction: reported %d accepted "+
+			t.Fatalf("ProcessTransaction: reported %d accepted "+
 				"transactions from failed orphan attempt",
 				len(acceptedTxns))
 		}
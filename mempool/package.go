@@ -0,0 +1,453 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/mining"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions a package
+	// submitted to the memory pool may contain.
+	MaxPackageCount = 25
+
+	// MaxPackageVirtualSize is the maximum total virtual size of the
+	// transactions of a package submitted to the memory pool.
+	MaxPackageVirtualSize = 101000
+)
+
+// packageTx houses a transaction of a package that passed validation along with
+// the utxo view and fee it was validated with, so it can be added to the main
+// pool once the package as a whole is deemed acceptable.
+type packageTx struct {
+	tx       *btcutil.Tx
+	posData  []byte
+	utxoView *blockchain.UtxoViewpoint
+	fee      int64
+}
+
+// txPackage is a set of related transactions evaluated together against a
+// package fee rate instead of individually.  Transactions are validated in
+// topological order so the outputs of the already validated transactions are
+// available to the ones spending them.
+type txPackage struct {
+	txns  map[chainhash.Hash]*packageTx
+	order []*packageTx
+}
+
+// newTxPackage returns a new empty transaction package.
+func newTxPackage() *txPackage {
+	return &txPackage{
+		txns: make(map[chainhash.Hash]*packageTx),
+	}
+}
+
+// add records the passed transaction as validated in the package.
+func (p *txPackage) add(ptx *packageTx) {
+	p.txns[*ptx.tx.Hash()] = ptx
+	p.order = append(p.order, ptx)
+}
+
+// addInputUtxos populates the inputs of the passed transaction that are still
+// missing from the passed view with the outputs of the transactions already
+// validated in the package.
+func (p *txPackage) addInputUtxos(tx *btcutil.Tx, utxoView *blockchain.UtxoViewpoint) {
+	for _, txIn := range tx.MsgTx().TxIn {
+		prevOut := &txIn.PreviousOutPoint
+		entry := utxoView.LookupEntry(*prevOut)
+		if entry != nil && !entry.IsSpent() {
+			continue
+		}
+
+		if ptx, exists := p.txns[prevOut.Hash]; exists {
+			// AddTxOut ignores out of range index values, so it is
+			// safe to call without bounds checking here.
+			utxoView.AddTxOut(ptx.tx, prevOut.Index,
+				mining.UnminedHeight)
+		}
+	}
+}
+
+// isInsufficientFeeError returns whether or not the passed error is a rule
+// error rejecting a transaction for paying insufficient fees.  Such
+// transactions may still be accepted as part of a package.
+func isInsufficientFeeError(err error) bool {
+	ruleErr, ok := err.(RuleError)
+	if !ok {
+		return false
+	}
+	txRuleErr, ok := ruleErr.Err.(TxRuleError)
+	return ok && txRuleErr.RejectCode == wire.RejectInsufficientFee
+}
+
+// checkPackage ensures the passed transactions form a package that is accepted
+// for evaluation.  That is, a child transaction along with its parents, where
+// every transaction but the last one is a parent spent by the last one, sorted
+// so that no transaction spends the outputs of a later one, and which neither
+// contains duplicates nor transactions spending the same outputs.
+func checkPackage(txns []*btcutil.Tx) error {
+	if len(txns) == 0 {
+		return txRuleError(wire.RejectInvalid, "package is empty")
+	}
+	if len(txns) > MaxPackageCount {
+		str := fmt.Sprintf("package contains %d transactions which is "+
+			"more than the max allowed of %d", len(txns),
+			MaxPackageCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	var vsize int64
+	for _, tx := range txns {
+		vsize += GetTxVirtualSize(tx)
+	}
+	if vsize > MaxPackageVirtualSize {
+		str := fmt.Sprintf("package virtual size of %d is larger than "+
+			"the max allowed of %d", vsize, MaxPackageVirtualSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	// Ensure there are no duplicates or conflicts and that the package is
+	// sorted topologically.  The later transactions are tracked so a
+	// transaction spending one of them can be detected.
+	later := make(map[chainhash.Hash]struct{}, len(txns))
+	for _, tx := range txns {
+		if _, exists := later[*tx.Hash()]; exists {
+			str := fmt.Sprintf("package contains duplicate "+
+				"transaction %v", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		later[*tx.Hash()] = struct{}{}
+	}
+	spent := make(map[wire.OutPoint]struct{})
+	for _, tx := range txns {
+		delete(later, *tx.Hash())
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if _, exists := spent[prevOut]; exists {
+				str := fmt.Sprintf("package contains conflicting "+
+					"transactions spending output %v", prevOut)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			spent[prevOut] = struct{}{}
+
+			if _, exists := later[prevOut.Hash]; exists {
+				str := fmt.Sprintf("package is not sorted: "+
+					"transaction %v spends later transaction %v",
+					tx.Hash(), prevOut.Hash)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+		}
+	}
+
+	// Ensure every transaction but the last one is a parent of the last
+	// one.
+	child := txns[len(txns)-1]
+	parents := make(map[chainhash.Hash]struct{})
+	for _, txIn := range child.MsgTx().TxIn {
+		parents[txIn.PreviousOutPoint.Hash] = struct{}{}
+	}
+	for _, tx := range txns[:len(txns)-1] {
+		if _, exists := parents[*tx.Hash()]; !exists {
+			str := fmt.Sprintf("package is not a child with its "+
+				"parents: transaction %v is not spent by %v",
+				tx.Hash(), child.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	return nil
+}
+
+// processPackage is the internal function which implements the public
+// ProcessPackage.  See the comment for ProcessPackage for more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) processPackage(txns []*orphanWithData) ([]*TxDesc, error) {
+	pkgTxns := make([]*btcutil.Tx, 0, len(txns))
+	for _, o := range txns {
+		pkgTxns = append(pkgTxns, o.tx)
+	}
+	if err := checkPackage(pkgTxns); err != nil {
+		return nil, err
+	}
+
+	// Attempt to accept each transaction on its own first so the
+	// transactions which pay for themselves don't depend on the rest of
+	// the package.  Transactions which don't pay the minimum relay fee on
+	// their own, as well as the ones spending them, are deferred to be
+	// evaluated together.
+	//
+	// Package transactions are never accepted as free transactions, so
+	// they are validated without being added to the pool, which bypasses
+	// the priority check and the free transaction rate limiter, and their
+	// fees are checked here instead.
+	var acceptedTxns []*TxDesc
+	deferred := make([]*orphanWithData, 0, len(txns))
+	deferredSet := make(map[chainhash.Hash]struct{})
+	bestHeight := mp.cfg.BestHeight()
+	for _, o := range txns {
+		if mp.isTransactionInPool(o.tx.Hash()) {
+			continue
+		}
+
+		single := newTxPackage()
+		missingParents, _, err := mp.maybeAcceptTransaction(o.tx,
+			o.posData, true, false, false, single)
+		if err != nil {
+			return acceptedTxns, err
+		}
+
+		for _, parent := range missingParents {
+			if _, exists := deferredSet[*parent]; !exists {
+				str := fmt.Sprintf("package transaction %v "+
+					"references outputs of unknown or "+
+					"fully-spent transaction %v", o.tx.Hash(),
+					parent)
+				return acceptedTxns, txRuleError(
+					wire.RejectDuplicate, str)
+			}
+		}
+		ptx := single.txns[*o.tx.Hash()]
+		if len(missingParents) > 0 || ptx.fee < calcMinRequiredTxRelayFee(
+			GetTxVirtualSize(o.tx), mp.cfg.Policy.MinRelayTxFee) {
+
+			deferred = append(deferred, o)
+			deferredSet[*o.tx.Hash()] = struct{}{}
+			continue
+		}
+
+		txD := mp.addTransaction(ptx.utxoView, ptx.tx, ptx.posData,
+			bestHeight, ptx.fee)
+		mp.removeOrphan(o.tx, false)
+		delete(mp.lowFeeTxns, *o.tx.Hash())
+		acceptedTxns = append(acceptedTxns, txD)
+
+		log.Debugf("Accepted transaction %v (pool size: %v)",
+			o.tx.Hash(), len(mp.pool))
+	}
+
+	// Evaluate the deferred transactions as a package and ensure their
+	// combined fees cover the minimum relay fee of their combined size.
+	if len(deferred) > 0 {
+		pkg := newTxPackage()
+		var pkgFee, pkgSize int64
+		for _, o := range deferred {
+			missingParents, _, err := mp.maybeAcceptTransaction(o.tx,
+				o.posData, true, false, false, pkg)
+			if err != nil {
+				return acceptedTxns, err
+			}
+			if len(missingParents) > 0 {
+				str := fmt.Sprintf("package transaction %v "+
+					"references outputs of unknown or "+
+					"fully-spent transaction %v", o.tx.Hash(),
+					missingParents[0])
+				return acceptedTxns, txRuleError(
+					wire.RejectDuplicate, str)
+			}
+			ptx := pkg.txns[*o.tx.Hash()]
+			pkgFee += ptx.fee
+			pkgSize += GetTxVirtualSize(ptx.tx)
+		}
+
+		minFee := calcMinRequiredTxRelayFee(pkgSize,
+			mp.cfg.Policy.MinRelayTxFee)
+		if pkgFee < minFee {
+			child := deferred[len(deferred)-1].tx
+			str := fmt.Sprintf("package of transaction %v has %d "+
+				"fees which is under the required amount of %d",
+				child.Hash(), pkgFee, minFee)
+			return acceptedTxns, txRuleError(
+				wire.RejectInsufficientFee, str)
+		}
+
+		// The package is acceptable, so add its transactions to the
+		// main pool.
+		for _, ptx := range pkg.order {
+			txD := mp.addTransaction(ptx.utxoView, ptx.tx,
+				ptx.posData, bestHeight, ptx.fee)
+			mp.removeOrphan(ptx.tx, false)
+			delete(mp.lowFeeTxns, *ptx.tx.Hash())
+			acceptedTxns = append(acceptedTxns, txD)
+
+			log.Debugf("Accepted package transaction %v (pool "+
+				"size: %v)", ptx.tx.Hash(), len(mp.pool))
+		}
+	}
+
+	// Accept any orphan transactions that depend on the package
+	// transactions.  The list is iterated by index since the orphans
+	// accepted along the way are appended to it.
+	numPkgTxns := len(acceptedTxns)
+	for i := 0; i < numPkgTxns; i++ {
+		acceptedTxns = append(acceptedTxns,
+			mp.processOrphans(acceptedTxns[i].Tx)...)
+	}
+
+	return acceptedTxns, nil
+}
+
+// ProcessPackage handles insertion of a package of related transactions into
+// the memory pool.  The package must consist of a child transaction along with
+// its unconfirmed parents, sorted so that the child comes last and no
+// transaction spends the outputs of a later one.  The posData slice holds the
+// proof-of-stake data of each transaction and may be nil when none of them
+// carry any.
+//
+// Each transaction is first evaluated on its own.  The transactions that don't
+// pay the minimum relay fee on their own, such as a parent with no fees, are
+// then evaluated together so that a child with high enough fees can pay for its
+// parents (child-pays-for-parent).  That is, the combined fees of those
+// transactions must cover the minimum relay fee of their combined size.
+// Package transactions are never accepted as free transactions, so they are
+// not subject to the free transaction rate limiter.
+//
+// It returns a slice of transactions added to the mempool, which includes the
+// package transactions that were not already in the pool followed by any orphan
+// transactions that were added as a result of the package being accepted.
+// Transactions accepted on their own remain in the pool even if the rest of
+// the package is rejected, so the returned slice may not be empty when an
+// error is returned.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessPackage(txns []*btcutil.Tx, posData [][]byte) ([]*TxDesc, error) {
+	if posData != nil && len(posData) != len(txns) {
+		str := fmt.Sprintf("package contains %d transactions but "+
+			"data for %d", len(txns), len(posData))
+		return nil, txRuleError(wire.RejectInvalid, str)
+	}
+
+	pkgTxns := make([]*orphanWithData, 0, len(txns))
+	for i, tx := range txns {
+		o := &orphanWithData{tx: tx}
+		if posData != nil {
+			o.posData = posData[i]
+		}
+		pkgTxns = append(pkgTxns, o)
+	}
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	return mp.processPackage(pkgTxns)
+}
+
+// addLowFeeTx caches a transaction which was rejected for paying insufficient
+// fees so that it can be accepted as the parent of an orphan transaction paying
+// for it later.  The cache is limited to the same number of transactions as the
+// orphan pool by evicting random entries, and transactions larger than the max
+// orphan size are not cached.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addLowFeeTx(o *orphanWithData) {
+	if mp.cfg.Policy.MaxOrphanTxs <= 0 {
+		return
+	}
+	serializedLen := o.tx.MsgTx().SerializeSize() +
+		wire.VarIntSerializeSize(uint64(len(o.posData))) + len(o.posData)
+	if serializedLen > mp.cfg.Policy.MaxOrphanTxSize {
+		return
+	}
+
+	// Remove a random entry from the map when the cache is full.  See
+	// limitNumOrphans for why relying on the map iteration order is fine.
+	if len(mp.lowFeeTxns)+1 > mp.cfg.Policy.MaxOrphanTxs {
+		for hash := range mp.lowFeeTxns {
+			delete(mp.lowFeeTxns, hash)
+			break
+		}
+	}
+	mp.lowFeeTxns[*o.tx.Hash()] = &lowFeeTx{
+		orphanWithData: o,
+		expiration:     time.Now().Add(orphanTTL),
+	}
+}
+
+// removeLowFeeDoubleSpends removes the passed transaction, along with the
+// transactions which spend any of the outputs it spends, from the cache of low
+// fee transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeLowFeeDoubleSpends(tx *btcutil.Tx) {
+	delete(mp.lowFeeTxns, *tx.Hash())
+	if len(mp.lowFeeTxns) == 0 {
+		return
+	}
+
+	// The cache is limited to the max number of orphans, so simply scan
+	// all of the cached transactions.
+	spent := make(map[wire.OutPoint]struct{}, len(tx.MsgTx().TxIn))
+	for _, txIn := range tx.MsgTx().TxIn {
+		spent[txIn.PreviousOutPoint] = struct{}{}
+	}
+	for hash, lf := range mp.lowFeeTxns {
+		for _, txIn := range lf.tx.MsgTx().TxIn {
+			if _, exists := spent[txIn.PreviousOutPoint]; exists {
+				delete(mp.lowFeeTxns, hash)
+				break
+			}
+		}
+	}
+}
+
+// orphanPackageParent returns the cached low fee transaction which is the only
+// missing parent of an orphan transaction, given the missing parents returned
+// when attempting to accept it, or nil when there is no such transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) orphanPackageParent(missingParents []*chainhash.Hash) *orphanWithData {
+	for _, parent := range missingParents[1:] {
+		if *parent != *missingParents[0] {
+			return nil
+		}
+	}
+	lf, exists := mp.lowFeeTxns[*missingParents[0]]
+	if !exists {
+		return nil
+	}
+	return lf.orphanWithData
+}
+
+// resolveLowFeeTx attempts to accept the passed low fee transaction, which was
+// rejected on its own, along with each of the orphan transactions spending it
+// as a package until one of them pays for it.  It returns the transactions
+// added to the mempool, or nil when none of the packages are accepted.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) resolveLowFeeTx(parent *orphanWithData) []*TxDesc {
+	// Gather the orphans first since accepting a package modifies the
+	// orphan pool.
+	var children []*orphanWithData
+	prevOut := wire.OutPoint{Hash: *parent.tx.Hash()}
+	for txOutIdx := range parent.tx.MsgTx().TxOut {
+		prevOut.Index = uint32(txOutIdx)
+		for _, orphan := range mp.orphansByPrev[prevOut] {
+			children = append(children, orphan)
+		}
+	}
+
+	for _, child := range children {
+		if !mp.isOrphanInPool(child.tx.Hash()) {
+			continue
+		}
+		pkg := []*orphanWithData{parent, child}
+		acceptedTxns, err := mp.processPackage(pkg)
+		if err == nil || len(acceptedTxns) > 0 {
+			return acceptedTxns
+		}
+		log.Debugf("Rejected package of transaction %v with parent "+
+			"%v: %v", child.tx.Hash(), parent.tx.Hash(), err)
+	}
+
+	return nil
+}
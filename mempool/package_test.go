@@ -0,0 +1,333 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// newPackageHarness returns a new pool harness along with a parent transaction
+// paying the passed fee and a child transaction spending it paying the passed
+// fee.  Transactions with insufficient fees are rejected by the harness pool on
+// their own when processed with the rate limit flag set.
+func newPackageHarness(t *testing.T, parentFee,
+	childFee btcutil.Amount) (*testContext, *btcutil.Tx, *btcutil.Tx) {
+
+	t.Helper()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	harness.txPool.cfg.Policy.FreeTxRelayLimit = 0
+
+	parent, err := harness.CreateSignedTx(outputs, 1, parentFee, false)
+	if err != nil {
+		t.Fatalf("unable to create parent transaction: %v", err)
+	}
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, childFee,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create child transaction: %v", err)
+	}
+
+	return &testContext{t, harness}, parent, child
+}
+
+// TestProcessPackage ensures packages are accepted when their transactions pay
+// sufficient fees together, and rejected otherwise or when they are malformed.
+func TestProcessPackage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		parentFee btcutil.Amount
+		childFee  btcutil.Amount
+		reverse   bool
+		wantCode  wire.RejectCode
+	}{
+		{
+			name:      "child pays for zero fee parent",
+			parentFee: 0,
+			childFee:  10000,
+		},
+		{
+			name:      "both pay for themselves",
+			parentFee: 1000,
+			childFee:  1000,
+		},
+		{
+			name:      "insufficient package fee",
+			parentFee: 0,
+			childFee:  200,
+			wantCode:  wire.RejectInsufficientFee,
+		},
+		{
+			name:      "child before parent",
+			parentFee: 0,
+			childFee:  10000,
+			reverse:   true,
+			wantCode:  wire.RejectInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		tc, parent, child := newPackageHarness(t, test.parentFee,
+			test.childFee)
+		txns := []*btcutil.Tx{parent, child}
+		if test.reverse {
+			txns[0], txns[1] = child, parent
+		}
+
+		acceptedTxns, err := tc.harness.txPool.ProcessPackage(txns, nil)
+		if test.wantCode != 0 {
+			code, _ := extractRejectCode(err)
+			if err == nil || code != test.wantCode {
+				t.Fatalf("%s: wrong error - got %v, want code %v",
+					test.name, err, test.wantCode)
+			}
+			if len(acceptedTxns) != 0 {
+				t.Fatalf("%s: reported %d accepted transactions "+
+					"from a rejected package", test.name,
+					len(acceptedTxns))
+			}
+			testPoolMembership(tc, parent, false, false)
+			testPoolMembership(tc, child, false, false)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: ProcessPackage: unexpected error: %v",
+				test.name, err)
+		}
+
+		// Ensure both transactions were accepted with the parent first.
+		if len(acceptedTxns) != 2 || acceptedTxns[0].Tx != parent ||
+			acceptedTxns[1].Tx != child {
+
+			t.Fatalf("%s: wrong accepted transactions %v", test.name,
+				acceptedTxns)
+		}
+		if acceptedTxns[0].Fee != int64(test.parentFee) ||
+			acceptedTxns[1].Fee != int64(test.childFee) {
+
+			t.Fatalf("%s: wrong fees %d and %d", test.name,
+				acceptedTxns[0].Fee, acceptedTxns[1].Fee)
+		}
+		testPoolMembership(tc, parent, false, true)
+		testPoolMembership(tc, child, false, true)
+	}
+}
+
+// TestCheckPackage ensures malformed packages are rejected.
+func TestCheckPackage(t *testing.T) {
+	t.Parallel()
+
+	tc, parent, child := newPackageHarness(t, 0, 10000)
+	_, _, unrelated := newPackageHarness(t, 0, 10000)
+	doubleSpend, err := tc.harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 2, 1000,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		txns  []*btcutil.Tx
+		valid bool
+	}{
+		{"child with parent", []*btcutil.Tx{parent, child}, true},
+		{"lone transaction", []*btcutil.Tx{parent}, true},
+		{"empty", nil, false},
+		{"not sorted", []*btcutil.Tx{child, parent}, false},
+		{"duplicate", []*btcutil.Tx{parent, parent, child}, false},
+		{"conflict", []*btcutil.Tx{parent, doubleSpend, child}, false},
+		{"unrelated parent", []*btcutil.Tx{unrelated, parent, child}, false},
+	}
+
+	for _, test := range tests {
+		err := checkPackage(test.txns)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name,
+				err, test.valid)
+		}
+	}
+}
+
+// TestPackageOrphanResolution ensures an orphan transaction paying for its
+// parent, which was rejected on its own for paying insufficient fees, is
+// accepted along with it regardless of which of the two is received first.
+func TestPackageOrphanResolution(t *testing.T) {
+	t.Parallel()
+
+	// Ensure the parent is rejected on its own and then accepted along
+	// with the orphan paying for it.
+	tc, parent, child := newPackageHarness(t, 0, 10000)
+	pool := tc.harness.txPool
+	_, err := pool.ProcessTransaction(parent, nil, true, true, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: wrong error for zero fee parent "+
+			"- got %v, want code %v", err, wire.RejectInsufficientFee)
+	}
+	testPoolMembership(tc, parent, false, false)
+
+	acceptedTxns, err := pool.ProcessTransaction(child, nil, true, true, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	if len(acceptedTxns) != 2 || acceptedTxns[0].Tx != parent ||
+		acceptedTxns[1].Tx != child {
+
+		t.Fatalf("ProcessTransaction: wrong accepted transactions %v",
+			acceptedTxns)
+	}
+	testPoolMembership(tc, parent, false, true)
+	testPoolMembership(tc, child, false, true)
+
+	// Ensure an orphan paying for its parent is accepted along with it
+	// once the parent is received.
+	tc, parent, child = newPackageHarness(t, 0, 10000)
+	pool = tc.harness.txPool
+	acceptedTxns, err = pool.ProcessTransaction(child, nil, true, true, 0)
+	if err != nil || len(acceptedTxns) != 0 {
+		t.Fatalf("ProcessTransaction: unexpected result for orphan - "+
+			"accepted %d, error %v", len(acceptedTxns), err)
+	}
+	testPoolMembership(tc, child, true, false)
+
+	acceptedTxns, err = pool.ProcessTransaction(parent, nil, true, true, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	if len(acceptedTxns) != 2 || acceptedTxns[0].Tx != parent ||
+		acceptedTxns[1].Tx != child {
+
+		t.Fatalf("ProcessTransaction: wrong accepted transactions %v",
+			acceptedTxns)
+	}
+	testPoolMembership(tc, parent, false, true)
+	testPoolMembership(tc, child, false, true)
+
+	// Ensure an orphan not paying enough for its parent remains an orphan.
+	tc, parent, child = newPackageHarness(t, 0, 200)
+	pool = tc.harness.txPool
+	_, err = pool.ProcessTransaction(parent, nil, true, true, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted zero fee parent")
+	}
+	acceptedTxns, err = pool.ProcessTransaction(child, nil, true, true, 0)
+	if err != nil || len(acceptedTxns) != 0 {
+		t.Fatalf("ProcessTransaction: unexpected result for orphan - "+
+			"accepted %d, error %v", len(acceptedTxns), err)
+	}
+	testPoolMembership(tc, parent, false, false)
+	testPoolMembership(tc, child, true, false)
+}
+
+// TestPackageFreeTxns ensures package transactions are neither accepted as free
+// transactions nor counted against the free transaction rate limiter.
+func TestPackageFreeTxns(t *testing.T) {
+	t.Parallel()
+
+	// Ensure a zero fee parent is accepted along with a child paying for
+	// it without being counted against the rate limiter even though free
+	// transactions are allowed.
+	tc, parent, child := newPackageHarness(t, 0, 10000)
+	pool := tc.harness.txPool
+	pool.cfg.Policy.FreeTxRelayLimit = 15
+	acceptedTxns, err := pool.ProcessPackage([]*btcutil.Tx{parent, child},
+		nil)
+	if err != nil {
+		t.Fatalf("ProcessPackage: unexpected error: %v", err)
+	}
+	if len(acceptedTxns) != 2 {
+		t.Fatalf("ProcessPackage: accepted %d transactions, want 2",
+			len(acceptedTxns))
+	}
+	if pool.pennyTotal != 0 {
+		t.Fatalf("package transactions counted against the rate "+
+			"limiter: %v", pool.pennyTotal)
+	}
+
+	// Ensure a zero fee parent is not accepted as a free transaction when
+	// the child doesn't pay enough for both.
+	tc, parent, child = newPackageHarness(t, 0, 200)
+	pool = tc.harness.txPool
+	pool.cfg.Policy.FreeTxRelayLimit = 15
+	_, err = pool.ProcessPackage([]*btcutil.Tx{parent, child}, nil)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessPackage: wrong error - got %v, want code %v",
+			err, wire.RejectInsufficientFee)
+	}
+	testPoolMembership(tc, parent, false, false)
+	testPoolMembership(tc, child, false, false)
+}
+
+// TestLowFeeTxCache ensures transactions rejected for paying insufficient fees
+// are removed from the cache once they expire, are confirmed or are double
+// spent.
+func TestLowFeeTxCache(t *testing.T) {
+	t.Parallel()
+
+	// cacheParent processes the passed zero fee parent, which is rejected
+	// and cached as a result.
+	cacheParent := func(pool *TxPool, parent *btcutil.Tx) {
+		t.Helper()
+
+		_, err := pool.ProcessTransaction(parent, nil, true, true, 0)
+		if err == nil {
+			t.Fatal("ProcessTransaction: accepted zero fee parent")
+		}
+		if _, exists := pool.lowFeeTxns[*parent.Hash()]; !exists {
+			t.Fatal("zero fee parent not cached")
+		}
+	}
+
+	// Ensure expired transactions are removed by the orphan expiration
+	// scan.
+	tc, parent, _ := newPackageHarness(t, 0, 10000)
+	pool := tc.harness.txPool
+	cacheParent(pool, parent)
+	pool.lowFeeTxns[*parent.Hash()].expiration = time.Now().Add(-time.Second)
+	pool.nextExpireScan = time.Now().Add(-time.Second)
+	pool.limitNumOrphans()
+	if _, exists := pool.lowFeeTxns[*parent.Hash()]; exists {
+		t.Fatal("expired low fee transaction not removed")
+	}
+
+	// Ensure transactions are removed once they are confirmed.
+	tc, parent, _ = newPackageHarness(t, 0, 10000)
+	pool = tc.harness.txPool
+	cacheParent(pool, parent)
+	pool.RemoveDoubleSpends(parent)
+	if _, exists := pool.lowFeeTxns[*parent.Hash()]; exists {
+		t.Fatal("confirmed low fee transaction not removed")
+	}
+
+	// Ensure transactions are removed once one spending the same outputs
+	// is confirmed.
+	tc, parent, _ = newPackageHarness(t, 0, 10000)
+	pool = tc.harness.txPool
+	cacheParent(pool, parent)
+	doubleSpend, err := tc.harness.CreateSignedTx([]spendableOutput{{
+		outPoint: parent.MsgTx().TxIn[0].PreviousOutPoint,
+		amount:   btcutil.Amount(parent.MsgTx().TxOut[0].Value),
+	}}, 2, 10000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	pool.RemoveDoubleSpends(doubleSpend)
+	if _, exists := pool.lowFeeTxns[*parent.Hash()]; exists {
+		t.Fatal("double spent low fee transaction not removed")
+	}
+}
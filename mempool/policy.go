@@ -53,6 +53,11 @@ const (
 	// in a multi-signature transaction output script for it to be
 	// considered standard.
 	maxStandardMultiSigKeys = 3
+
+	// maxStandardTapscriptStackItemSize is the maximum size allowed for
+	// each of the initial stack items of a tapscript for the spending
+	// input to be considered standard.
+	maxStandardTapscriptStackItemSize = 80
 )
 
 // calcMinRequiredTxRelayFee returns the minimum transaction fee required for a
@@ -112,6 +117,14 @@ func checkInputsStandard(tx *btcutil.Tx, utxoView *blockchain.UtxoViewpoint) err
 				return txRuleError(wire.RejectNonstandard, str)
 			}
 
+		case txscript.WitnessV1TaprootTy:
+			err := checkTaprootWitnessStandard(txIn.Witness)
+			if err != nil {
+				str := fmt.Sprintf("transaction input #%d %v",
+					i, err)
+				return txRuleError(wire.RejectNonstandard, str)
+			}
+
 		case txscript.NonStandardTy:
 			str := fmt.Sprintf("transaction input #%d has a "+
 				"non-standard script form", i)
@@ -122,6 +135,54 @@ func checkInputsStandard(tx *btcutil.Tx, utxoView *blockchain.UtxoViewpoint) err
 	return nil
 }
 
+// checkTaprootWitnessStandard performs a series of checks on the witness of an
+// input spending a taproot output to ensure it is "standard".  The annex is
+// reserved for future soft-forks, so witnesses that contain one are not
+// considered standard.  Furthermore, the initial stack items of a tapscript
+// with the base leaf version must not exceed
+// maxStandardTapscriptStackItemSize bytes.
+func checkTaprootWitnessStandard(witness wire.TxWitness) error {
+	// A witness with at least two items whose last item starts with the
+	// annex tag has an annex.
+	if len(witness) >= 2 {
+		lastItem := witness[len(witness)-1]
+		if len(lastItem) > 0 && lastItem[0] == txscript.TaprootAnnexTag {
+			return fmt.Errorf("has a witness with an annex")
+		}
+	}
+
+	// A key path spend only has a single witness item, so there is
+	// nothing else to check.
+	if len(witness) < 2 {
+		return nil
+	}
+
+	// The control block of a script path spend is the last witness item,
+	// followed by the tapscript itself.  Only the stack items of known
+	// tapscript leaf versions are checked.
+	controlBlock := witness[len(witness)-1]
+	if len(controlBlock) == 0 {
+		return nil
+	}
+	leafVersion := txscript.TapscriptLeafVersion(
+		controlBlock[0] & txscript.TaprootLeafMask,
+	)
+	if leafVersion != txscript.BaseLeafVersion {
+		return nil
+	}
+
+	for j, item := range witness[:len(witness)-2] {
+		if len(item) > maxStandardTapscriptStackItemSize {
+			return fmt.Errorf("has tapscript stack item #%d of "+
+				"%d bytes which is larger than the max "+
+				"allowed size of %d bytes", j, len(item),
+				maxStandardTapscriptStackItemSize)
+		}
+	}
+
+	return nil
+}
+
 // checkPkScriptStandard performs a series of checks on a transaction output
 // script (public key script) to ensure it is a "standard" public key script.
 // A standard public key script is one that is a recognized form, and for
@@ -510,3 +510,75 @@ func TestCheckTransactionStandard(t *testing.T) {
 		}
 	}
 }
+
+// TestCheckTaprootWitnessStandard tests the checkTaprootWitnessStandard API.
+func TestCheckTaprootWitnessStandard(t *testing.T) {
+	sig := bytes.Repeat([]byte{0x01}, 64)
+	tapscript := []byte{txscript.OP_TRUE}
+	controlBlock := append(
+		[]byte{byte(txscript.BaseLeafVersion)},
+		bytes.Repeat([]byte{0x02}, 32)...,
+	)
+	unknownControlBlock := append(
+		[]byte{0xc2}, bytes.Repeat([]byte{0x02}, 32)...,
+	)
+	annex := []byte{txscript.TaprootAnnexTag, 0x00}
+	bigItem := bytes.Repeat([]byte{0x03},
+		maxStandardTapscriptStackItemSize+1)
+	maxItem := bytes.Repeat([]byte{0x03},
+		maxStandardTapscriptStackItemSize)
+
+	tests := []struct {
+		name       string
+		witness    wire.TxWitness
+		isStandard bool
+	}{
+		{
+			name:       "key path spend",
+			witness:    wire.TxWitness{sig},
+			isStandard: true,
+		},
+		{
+			name:       "key path spend with annex",
+			witness:    wire.TxWitness{sig, annex},
+			isStandard: false,
+		},
+		{
+			name:       "script path spend",
+			witness:    wire.TxWitness{maxItem, tapscript, controlBlock},
+			isStandard: true,
+		},
+		{
+			name: "script path spend with annex",
+			witness: wire.TxWitness{
+				maxItem, tapscript, controlBlock, annex,
+			},
+			isStandard: false,
+		},
+		{
+			name:       "script path spend with large stack item",
+			witness:    wire.TxWitness{bigItem, tapscript, controlBlock},
+			isStandard: false,
+		},
+		{
+			name: "unknown leaf version with large stack item",
+			witness: wire.TxWitness{
+				bigItem, tapscript, unknownControlBlock,
+			},
+			isStandard: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkTaprootWitnessStandard(test.witness)
+		if err == nil && !test.isStandard {
+			t.Errorf("checkTaprootWitnessStandard (%s): standard "+
+				"when it should not be", test.name)
+			continue
+		}
+		if err != nil && test.isStandard {
+			t.Errorf("checkTaprootWitnessStandard (%s): nonstandard "+
+				"when it should not be: %v", test.name, err)
+		}
+	}
+}
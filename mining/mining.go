@@ -86,6 +86,11 @@ type txPrioItem struct {
 	posData  []byte
 	fee      int64
 	priority float64
+
+	// feePerKB is the fee per kilobyte the transaction pays, or the fee
+	// rate of the package it forms with a descendant in the source pool
+	// and the other unmined ancestors of that descendant when it is
+	// higher.
 	feePerKB int64
 
 	// dependsOn holds a map of transaction hashes which this one depends
@@ -95,6 +100,70 @@ type txPrioItem struct {
 	dependsOn map[chainhash.Hash]struct{}
 }
 
+// txVirtualSize returns the virtual size of the passed transaction, which is
+// its weight scaled down by the witness scale factor and rounded up.
+func txVirtualSize(tx *btcutil.Tx) int64 {
+	return (blockchain.GetTransactionWeight(tx) +
+		(blockchain.WitnessScaleFactor - 1)) / blockchain.WitnessScaleFactor
+}
+
+// packageAncestors returns the transactions in the passed items the passed
+// one depends on directly or indirectly.  False is returned when any of them
+// isn't available for inclusion in the block, in which case the passed
+// transaction can't be included either.
+func packageAncestors(item *txPrioItem,
+	items map[chainhash.Hash]*txPrioItem) (map[chainhash.Hash]*txPrioItem, bool) {
+
+	ancestors := make(map[chainhash.Hash]*txPrioItem)
+	stack := []*txPrioItem{item}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for hash := range next.dependsOn {
+			if _, ok := ancestors[hash]; ok {
+				continue
+			}
+			ancestor, ok := items[hash]
+			if !ok {
+				return nil, false
+			}
+			ancestors[hash] = ancestor
+			stack = append(stack, ancestor)
+		}
+	}
+	return ancestors, true
+}
+
+// raisePackageFeeRates raises the fee per kilobyte of each of the passed items
+// which has descendants among them to the fee rate of the package a
+// descendant forms with all of its unmined ancestors when that is higher.
+// This allows a child to pay for its parents (CPFP) the same way the memory
+// pool accepts such packages, rather than the parents being skipped for not
+// paying enough on their own.
+func raisePackageFeeRates(items map[chainhash.Hash]*txPrioItem) {
+	for _, item := range items {
+		if item.dependsOn == nil {
+			continue
+		}
+		ancestors, ok := packageAncestors(item, items)
+		if !ok {
+			continue
+		}
+
+		fee, size := item.fee, txVirtualSize(item.tx)
+		for _, ancestor := range ancestors {
+			fee += ancestor.fee
+			size += txVirtualSize(ancestor.tx)
+		}
+		feePerKB := fee * 1000 / size
+		for _, ancestor := range ancestors {
+			if feePerKB > ancestor.feePerKB {
+				ancestor.feePerKB = feePerKB
+			}
+		}
+	}
+}
+
 // txPriorityQueueLessFunc describes a function that can be used as a compare
 // function for a transaction priority queue (txPriorityQueue).
 type txPriorityQueueLessFunc func(*txPriorityQueue, int, int) bool
@@ -399,8 +468,11 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
 // fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// higher fee per kilobyte are preferred.  The fee per kilobyte of a transaction
+// with descendants in the source pool is raised to the fee rate of the package
+// of a descendant and its ancestors when that is higher, so children can pay
+// for their parents.  Finally, the block generation related policy settings
+// are all taken into account.
 //
 // Transactions which only spend outputs from other transactions already in the
 // block chain are immediately added to a priority queue which either
@@ -500,6 +572,10 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	// in the block once each transaction has been included.
 	dependers := make(map[chainhash.Hash]map[chainhash.Hash]*txPrioItem)
 
+	// prioItems houses all of the transactions that are considered for
+	// inclusion in the block by their hash.
+	prioItems := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
+
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -594,6 +670,7 @@ mempoolLoop:
 		if prioItem.dependsOn == nil {
 			heap.Push(priorityQueue, prioItem)
 		}
+		prioItems[*tx.Hash()] = prioItem
 
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
@@ -601,6 +678,12 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
+	// Let the descendants of transactions pay for them and restore the
+	// ordering of the priority queue since the fee rates of the queued
+	// transactions may have changed.
+	raisePackageFeeRates(prioItems)
+	heap.Init(priorityQueue)
+
 	log.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
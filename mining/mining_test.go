@@ -7,9 +7,18 @@ package mining
 import (
 	"container/heap"
 	"math/rand"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/babylonchain-io/bbld/blockchain"
 	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
+	_ "github.com/babylonchain-io/bbld/database/ffldb"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
 )
 
 // TestTxFeePrioHeap ensures the priority queue for transaction fees and
@@ -108,3 +117,140 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// fakeTxSource provides a transaction source holding a fixed set of
+// transactions for generating block templates in tests.
+type fakeTxSource struct {
+	descs []*TxDesc
+}
+
+// LastUpdated returns the zero time since the source never changes.  It is
+// part of the TxSource interface.
+func (s *fakeTxSource) LastUpdated() time.Time {
+	return time.Time{}
+}
+
+// MiningDescs returns the descriptors of the transactions in the source.  It
+// is part of the TxSource interface.
+func (s *fakeTxSource) MiningDescs() []*TxDesc {
+	return s.descs
+}
+
+// HaveTransaction returns whether or not the passed transaction is in the
+// source.  It is part of the TxSource interface.
+func (s *fakeTxSource) HaveTransaction(hash *chainhash.Hash) bool {
+	for _, desc := range s.descs {
+		if desc.Tx.Hash().IsEqual(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds the passed transaction paying the passed fee to the source.
+func (s *fakeTxSource) add(tx *btcutil.Tx, fee int64) {
+	s.descs = append(s.descs, &TxDesc{
+		Tx:       tx,
+		Added:    time.Now(),
+		Fee:      fee,
+		FeePerKB: fee * 1000 / txVirtualSize(tx),
+	})
+}
+
+// TestNewBlockTemplateCPFP ensures a parent that doesn't pay the minimum fee
+// rate on its own is included in a block template along with a child paying
+// enough for both of them.
+func TestNewBlockTemplateCPFP(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	dbPath := filepath.Join(t.TempDir(), "mining_test")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	timeSource := blockchain.NewMedianTime()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	policy := &Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight,
+		TxMinFreeFee:   1000,
+	}
+	txSource := &fakeTxSource{}
+	g := NewBlkTmplGenerator(policy, &params, txSource, chain, timeSource,
+		txscript.NewSigCache(100), txscript.NewHashCache(100))
+
+	// newTemplate returns a new block template paying to anyone.
+	newTemplate := func() *wire.MsgBlock {
+		template, err := g.NewBlockTemplate(nil)
+		if err != nil {
+			t.Fatalf("unable to create block template: %v", err)
+		}
+		return template.Block
+	}
+
+	// Mine enough blocks for the coinbase of the first one to mature.
+	var coinbase *wire.MsgTx
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		block := newTemplate()
+		target := blockchain.CompactToBig(block.Header.Bits)
+		for {
+			hash := block.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			block.Header.Nonce++
+		}
+		_, _, err := chain.ProcessBlock(btcutil.NewBlock(block),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		if coinbase == nil {
+			coinbase = block.Transactions[0]
+		}
+	}
+
+	// spend returns a transaction spending the first output of the passed
+	// transaction, which is redeemable by anyone, and paying the passed
+	// fee.
+	spend := func(prev *wire.MsgTx, fee int64) *btcutil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: prev.TxHash()},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(prev.TxOut[0].Value-fee,
+			[]byte{txscript.OP_TRUE}))
+		return btcutil.NewTx(tx)
+	}
+	parent := spend(coinbase, 0)
+	child := spend(parent.MsgTx(), 10000)
+
+	// The parent alone doesn't pay the minimum fee rate.
+	txSource.add(parent, 0)
+	if block := newTemplate(); len(block.Transactions) != 1 {
+		t.Fatalf("template has %d transactions, want only the coinbase",
+			len(block.Transactions))
+	}
+
+	// The child pays for both of them.
+	txSource.add(child, 10000)
+	block := newTemplate()
+	if len(block.Transactions) != 3 {
+		t.Fatalf("template has %d transactions, want 3",
+			len(block.Transactions))
+	}
+	for i, tx := range []*btcutil.Tx{parent, child} {
+		if block.Transactions[i+1].TxHash() != *tx.Hash() {
+			t.Fatalf("template transaction %d is %v, want %v", i+1,
+				block.Transactions[i+1].TxHash(), tx.Hash())
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"errors"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/mempool"
+	peerpkg "github.com/babylonchain-io/bbld/peer"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// maxCmpctHighBandwidthPeers is the maximum number of peers that are
+	// asked to announce new blocks by sending compact blocks directly
+	// (BIP0152 high-bandwidth mode).
+	maxCmpctHighBandwidthPeers = 3
+)
+
+var (
+	// errCmpctBlockInvalid is returned when a compact block or the
+	// transactions sent to complete it are malformed.  A peer sending
+	// such data is misbehaving.
+	errCmpctBlockInvalid = errors.New("invalid compact block")
+
+	// errCmpctBlockFailed is returned when a block can't be reconstructed
+	// from a compact block, for example due to short id collisions, and
+	// the full block needs to be requested instead.
+	errCmpctBlockFailed = errors.New("compact block reconstruction failed")
+)
+
+// partialBlock houses a block that is being reconstructed from a compact
+// block announcement along with the transactions, and the data attached to
+// them, that are still missing.
+type partialBlock struct {
+	header  wire.BlockHeader
+	txns    []*wire.MsgTx
+	posData [][]byte
+	missing []uint32
+}
+
+// newPartialBlock starts reconstructing the block announced by the passed
+// compact block using the prefilled transactions and the transactions, along
+// with their attached data, in the provided transaction pool entries.  The
+// indexes of the transactions which could not be found are tracked in the
+// missing field of the returned partial block.
+func newPartialBlock(msg *wire.MsgCmpctBlock, txDescs []*mempool.TxDesc) (*partialBlock, error) {
+	txCount := msg.TxCount()
+	if txCount == 0 {
+		return nil, errCmpctBlockInvalid
+	}
+
+	pb := &partialBlock{
+		header:  msg.Header,
+		txns:    make([]*wire.MsgTx, txCount),
+		posData: make([][]byte, txCount),
+	}
+
+	// Place the prefilled transactions.  The wire decoding ensures the
+	// indexes are strictly increasing and within the block.
+	prefilled := make([]bool, txCount)
+	for _, ptx := range msg.PrefilledTxs {
+		if ptx.Tx == nil {
+			return nil, errCmpctBlockInvalid
+		}
+		pb.txns[ptx.Index] = ptx.Tx
+		pb.posData[ptx.Index] = ptx.Data
+		prefilled[ptx.Index] = true
+	}
+
+	// Assign the short ids to the remaining slots in order.  Duplicate
+	// short ids within the block make it impossible to tell transactions
+	// apart, so the full block is needed in that case.
+	slots := make(map[uint64]int, len(msg.ShortIDs))
+	shortIdx := 0
+	for i := 0; i < txCount; i++ {
+		if prefilled[i] {
+			continue
+		}
+		id := msg.ShortIDs[shortIdx]
+		shortIdx++
+		if _, exists := slots[id]; exists {
+			return nil, errCmpctBlockFailed
+		}
+		slots[id] = i
+	}
+
+	// Fill in the slots with the matching transactions from the pool.
+	// A pool transaction colliding with one that already matched clears
+	// the slot so the transaction is requested from the peer instead.
+	key := msg.ShortTxIDKey()
+	collided := make([]bool, txCount)
+	for _, desc := range txDescs {
+		msgTx := desc.Tx.MsgTx()
+		if msgTx.HasAttachedData() && desc.PosData == nil {
+			continue
+		}
+
+		id := wire.ShortTxID(&key, desc.Tx.WitnessHash())
+		slot, ok := slots[id]
+		if !ok || collided[slot] {
+			continue
+		}
+		if pb.txns[slot] != nil {
+			pb.txns[slot] = nil
+			pb.posData[slot] = nil
+			collided[slot] = true
+			continue
+		}
+		pb.txns[slot] = msgTx
+		pb.posData[slot] = desc.PosData
+	}
+
+	for i, tx := range pb.txns {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+
+	return pb, nil
+}
+
+// fill completes the partial block with the transactions, and the data
+// attached to them, in the passed blocktxn message.  The transactions must be
+// exactly the ones that are missing, in the order they were requested.
+func (pb *partialBlock) fill(msg *wire.MsgBlockTxn) error {
+	if len(msg.Transactions) != len(pb.missing) {
+		return errCmpctBlockInvalid
+	}
+
+	var dataIdx int
+	for i, tx := range msg.Transactions {
+		slot := pb.missing[i]
+		pb.txns[slot] = tx
+		if tx.HasAttachedData() {
+			pb.posData[slot] = msg.PosData[dataIdx]
+			dataIdx++
+		}
+	}
+	pb.missing = nil
+
+	return nil
+}
+
+// block returns the reconstructed block.  The transactions of the block are
+// checked against the merkle root committed to by the header, since a short
+// id collision with a pool transaction can't be detected otherwise.
+func (pb *partialBlock) block() (*btcutil.Block, error) {
+	if len(pb.missing) != 0 {
+		return nil, errCmpctBlockFailed
+	}
+
+	msgBlock := wire.NewMsgBlock(&pb.header)
+	for i, tx := range pb.txns {
+		if tx.HasAttachedData() {
+			msgBlock.AddTransactionWithData(tx, pb.posData[i])
+			continue
+		}
+		msgBlock.AddTransaction(tx)
+	}
+
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	if !pb.header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, errCmpctBlockFailed
+	}
+
+	return block, nil
+}
+
+// requestFullBlock requests the full block with the passed hash from the
+// peer.  It is used as the fallback when a block can't be reconstructed from
+// a compact block.
+func (sm *SyncManager) requestFullBlock(peer *peerpkg.Peer, state *peerSyncState, blockHash *chainhash.Hash) {
+	delete(state.partialBlocks, *blockHash)
+	limitAdd(sm.requestedBlocks, *blockHash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, *blockHash, maxRequestedBlocks)
+
+	invType := wire.InvTypeBlock
+	if peer.IsWitnessEnabled() {
+		invType = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(invType, blockHash))
+	peer.QueueMessage(gdmsg, nil)
+}
+
+// processPartialBlock hands the block reconstructed from a compact block over
+// to the regular block handling, or requests the full block from the peer
+// when the reconstruction failed.
+func (sm *SyncManager) processPartialBlock(peer *peerpkg.Peer, state *peerSyncState, pb *partialBlock) {
+	block, err := pb.block()
+	if err != nil {
+		blockHash := pb.header.BlockHash()
+		log.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting full block", blockHash, peer, err)
+		sm.requestFullBlock(peer, state, &blockHash)
+		return
+	}
+
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peer})
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The
+// announced block is reconstructed from the transactions in the memory pool
+// and any transactions which are not known are requested from the peer.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received cmpctblock message from unknown peer %s", peer)
+		return
+	}
+
+	msg := cmsg.cmpctBlock
+	blockHash := msg.BlockHash()
+	iv := wire.NewInvVect(wire.InvTypeBlock, &blockHash)
+	peer.AddKnownInventory(iv)
+
+	// Compact blocks are either requested by us or announced by peers in
+	// high-bandwidth mode.  Ignore announcements while syncing since the
+	// block will be downloaded as part of the sync anyways.
+	_, requested := state.requestedBlocks[blockHash]
+	if !requested {
+		if !sm.current() {
+			return
+		}
+		peer.UpdateLastAnnouncedBlock(&blockHash)
+	}
+
+	// Nothing to do if the block is already known, being reconstructed,
+	// or requested from another peer.
+	haveInv, err := sm.haveInventory(iv)
+	if err != nil {
+		log.Warnf("Unexpected failure when checking for existing "+
+			"inventory during cmpctblock message processing: %v", err)
+		return
+	}
+	if haveInv {
+		delete(state.requestedBlocks, blockHash)
+		delete(sm.requestedBlocks, blockHash)
+		return
+	}
+	if _, exists := state.partialBlocks[blockHash]; exists {
+		return
+	}
+	if _, exists := sm.requestedBlocks[blockHash]; exists && !requested {
+		return
+	}
+
+	// Reject headers without the required proof of work before asking for
+	// anything else.
+	header := btcutil.NewBlock(wire.NewMsgBlock(&msg.Header))
+	err = blockchain.CheckProofOfWork(header, sm.chainParams.PowLimit)
+	if err != nil {
+		log.Warnf("Got compact block %v with invalid proof of work from "+
+			"%s -- disconnecting", blockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	// The memory pool is only expected to hold the transactions of blocks
+	// which extend the best chain, so request any other block in full.
+	best := sm.chain.BestSnapshot()
+	if msg.Header.PrevBlock != best.Hash {
+		sm.requestFullBlock(peer, state, &blockHash)
+		return
+	}
+
+	pb, err := newPartialBlock(msg, sm.txMemPool.TxDescs())
+	switch err {
+	case nil:
+	case errCmpctBlockFailed:
+		log.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting full block", blockHash, peer, err)
+		sm.requestFullBlock(peer, state, &blockHash)
+		return
+	default:
+		log.Warnf("Got invalid compact block %v from %s -- "+
+			"disconnecting", blockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	limitAdd(sm.requestedBlocks, blockHash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, blockHash, maxRequestedBlocks)
+
+	if len(pb.missing) == 0 {
+		sm.processPartialBlock(peer, state, pb)
+		return
+	}
+
+	log.Debugf("Requesting %d of %d transactions of compact block %v "+
+		"from %s", len(pb.missing), len(pb.txns), blockHash, peer)
+	state.partialBlocks[blockHash] = pb
+	gbtmsg := wire.NewMsgGetBlockTxn(&blockHash)
+	for _, index := range pb.missing {
+		gbtmsg.AddIndex(index)
+	}
+	peer.QueueMessage(gbtmsg, nil)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  The
+// transactions complete a block previously announced with a compact block.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received blocktxn message from unknown peer %s", peer)
+		return
+	}
+
+	msg := bmsg.blockTxn
+	pb, exists := state.partialBlocks[msg.BlockHash]
+	if !exists {
+		log.Debugf("Ignoring unrequested blocktxn for block %v from %s",
+			msg.BlockHash, peer)
+		return
+	}
+	delete(state.partialBlocks, msg.BlockHash)
+
+	if err := pb.fill(msg); err != nil {
+		log.Warnf("Got invalid blocktxn for block %v from %s -- "+
+			"disconnecting", msg.BlockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	sm.processPartialBlock(peer, state, pb)
+}
+
+// selectHighBandwidthPeer asks the peer, which just delivered a new block, to
+// announce new blocks by sending compact blocks directly.  Only the peers which
+// most recently delivered blocks are kept in high-bandwidth mode, so the least
+// recent one is switched back to low-bandwidth mode when needed.
+func (sm *SyncManager) selectHighBandwidthPeer(peer *peerpkg.Peer) {
+	if !peer.WantsCmpctBlocks() {
+		return
+	}
+
+	// Move the peer to the back when it's already selected.
+	for i, p := range sm.cmpctHBPeers {
+		if p == peer {
+			copy(sm.cmpctHBPeers[i:], sm.cmpctHBPeers[i+1:])
+			sm.cmpctHBPeers[len(sm.cmpctHBPeers)-1] = peer
+			return
+		}
+	}
+
+	if len(sm.cmpctHBPeers) >= maxCmpctHighBandwidthPeers {
+		oldest := sm.cmpctHBPeers[0]
+		oldest.QueueMessage(wire.NewMsgSendCmpct(false,
+			wire.CmpctBlockVersion), nil)
+		sm.removeHighBandwidthPeer(oldest)
+	}
+
+	log.Debugf("Selecting %s as high-bandwidth compact block peer", peer)
+	peer.QueueMessage(wire.NewMsgSendCmpct(true, wire.CmpctBlockVersion),
+		nil)
+	sm.cmpctHBPeers = append(sm.cmpctHBPeers, peer)
+}
+
+// removeHighBandwidthPeer removes the peer from the high-bandwidth compact
+// block peers if it's one of them.
+func (sm *SyncManager) removeHighBandwidthPeer(peer *peerpkg.Peer) {
+	for i, p := range sm.cmpctHBPeers {
+		if p == peer {
+			copy(sm.cmpctHBPeers[i:], sm.cmpctHBPeers[i+1:])
+			sm.cmpctHBPeers[len(sm.cmpctHBPeers)-1] = nil
+			sm.cmpctHBPeers = sm.cmpctHBPeers[:len(sm.cmpctHBPeers)-1]
+			return
+		}
+	}
+}
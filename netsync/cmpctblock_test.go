@@ -0,0 +1,163 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/mempool"
+	"github.com/babylonchain-io/bbld/mining"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// cmpctTestTx returns a transaction which is made unique by the passed lock
+// time and commits to attached data of the passed size when it's non-zero.
+func cmpctTestTx(lockTime uint32, dataSize uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: lockTime}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(5000000000, []byte{0x51}))
+	tx.LockTime = lockTime
+	if dataSize > 0 {
+		tx.PosCommitment = wire.NewTxCommitment([wire.TagSize]uint8{},
+			1, 1, dataSize, chainhash.Hash{}, 0, nil)
+	}
+	return tx
+}
+
+// cmpctTestBlock returns a block with three transactions where the first and
+// the last transactions commit to attached data.
+func cmpctTestBlock() *wire.MsgBlock {
+	block := wire.NewMsgBlock(&wire.BlockHeader{Version: 1})
+	block.AddTransactionWithData(cmpctTestTx(0, 2), []byte{0x01, 0x02})
+	block.AddTransaction(cmpctTestTx(1, 0))
+	block.AddTransactionWithData(cmpctTestTx(2, 3), []byte{0x03, 0x04, 0x05})
+
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(block).Transactions(), false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return block
+}
+
+// cmpctTestTxDesc returns a transaction pool entry for the passed transaction
+// and attached data.
+func cmpctTestTxDesc(tx *wire.MsgTx, data []byte) *mempool.TxDesc {
+	return &mempool.TxDesc{
+		TxDesc: mining.TxDesc{
+			Tx:      btcutil.NewTx(tx),
+			PosData: data,
+		},
+	}
+}
+
+// TestPartialBlock ensures blocks, along with the data attached to their
+// transactions, are reconstructed from compact blocks using the transaction
+// pool and the transactions requested from the peer.
+func TestPartialBlock(t *testing.T) {
+	block := cmpctTestBlock()
+	cmpctBlock := wire.NewMsgCmpctBlockFromBlock(block, 1)
+
+	// Ensure the block is reconstructed when all of the transactions are
+	// in the pool.
+	pb, err := newPartialBlock(cmpctBlock, []*mempool.TxDesc{
+		cmpctTestTxDesc(block.Transactions[2], block.PosData[1]),
+		cmpctTestTxDesc(block.Transactions[1], nil),
+	})
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if len(pb.missing) != 0 {
+		t.Fatalf("newPartialBlock: unexpected missing transactions %v",
+			pb.missing)
+	}
+	got, err := pb.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.MsgBlock(), block) {
+		t.Fatalf("block: reconstructed block does not match")
+	}
+
+	// Ensure the transactions not in the pool are missing and the block
+	// is reconstructed once they are provided.
+	pb, err = newPartialBlock(cmpctBlock, []*mempool.TxDesc{
+		cmpctTestTxDesc(block.Transactions[1], nil),
+	})
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pb.missing, []uint32{2}) {
+		t.Fatalf("newPartialBlock: wrong missing transactions - got %v, "+
+			"want %v", pb.missing, []uint32{2})
+	}
+	if _, err := pb.block(); err != errCmpctBlockFailed {
+		t.Fatalf("block: wrong error - got %v, want %v", err,
+			errCmpctBlockFailed)
+	}
+	if err := pb.fill(wire.NewMsgBlockTxn(&chainhash.Hash{})); err != errCmpctBlockInvalid {
+		t.Fatalf("fill: wrong error - got %v, want %v", err,
+			errCmpctBlockInvalid)
+	}
+	blockTxn := wire.NewMsgBlockTxn(&chainhash.Hash{})
+	blockTxn.AddTransaction(block.Transactions[2], block.PosData[1])
+	if err := pb.fill(blockTxn); err != nil {
+		t.Fatalf("fill: unexpected error: %v", err)
+	}
+	got, err = pb.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.MsgBlock(), block) {
+		t.Fatalf("block: reconstructed block does not match")
+	}
+
+	// Ensure pool transactions which commit to data that isn't available
+	// are not used.
+	pb, err = newPartialBlock(cmpctBlock, []*mempool.TxDesc{
+		cmpctTestTxDesc(block.Transactions[2], nil),
+	})
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pb.missing, []uint32{1, 2}) {
+		t.Fatalf("newPartialBlock: wrong missing transactions - got %v, "+
+			"want %v", pb.missing, []uint32{1, 2})
+	}
+
+	// Ensure a block whose transactions don't match the merkle root fails
+	// to be reconstructed.
+	badRoot := *cmpctBlock
+	badRoot.Header.MerkleRoot = chainhash.Hash{}
+	pb, err = newPartialBlock(&badRoot, []*mempool.TxDesc{
+		cmpctTestTxDesc(block.Transactions[2], block.PosData[1]),
+		cmpctTestTxDesc(block.Transactions[1], nil),
+	})
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error: %v", err)
+	}
+	if _, err := pb.block(); err != errCmpctBlockFailed {
+		t.Fatalf("block: wrong error - got %v, want %v", err,
+			errCmpctBlockFailed)
+	}
+
+	// Ensure duplicate short ids require the full block.
+	dupIDs := wire.NewMsgCmpctBlock(&block.Header, 1)
+	dupIDs.AddShortID(1)
+	dupIDs.AddShortID(1)
+	if _, err := newPartialBlock(dupIDs, nil); err != errCmpctBlockFailed {
+		t.Fatalf("newPartialBlock: wrong error - got %v, want %v", err,
+			errCmpctBlockFailed)
+	}
+
+	// Ensure compact blocks without transactions are rejected.
+	empty := wire.NewMsgCmpctBlock(&block.Header, 1)
+	if _, err := newPartialBlock(empty, nil); err != errCmpctBlockInvalid {
+		t.Fatalf("newPartialBlock: wrong error - got %v, want %v", err,
+			errCmpctBlockInvalid)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
+	"github.com/babylonchain-io/bbld/mempool"
+	peerpkg "github.com/babylonchain-io/bbld/peer"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// blockDownloadWindow is the maximum number of blocks, starting with
+	// the next block to be processed, which are requested or waiting for
+	// their parents to be processed during a headers-first sync.  It bounds
+	// the number of downloaded blocks held in memory.
+	blockDownloadWindow = 1024
+
+	// maxHeaderBacklog is the maximum number of headers whose blocks have
+	// not been processed yet during a headers-first sync.  Headers are
+	// requested ahead of the download window up to this many so the header
+	// list does not grow with the length of the chain.
+	maxHeaderBacklog = 16 * blockDownloadWindow
+
+	// maxBlocksInFlightPerPeer is the maximum number of blocks requested
+	// from a single peer at a time during a headers-first sync.
+	maxBlocksInFlightPerPeer = 16
+
+	// blockStallTimeout is the time after which a peer which has not
+	// delivered the next block to be processed, while every other block in
+	// the download window is downloaded or requested, is considered to be
+	// stalling the download.
+	blockStallTimeout = 10 * time.Second
+)
+
+// assignBlockRequests distributes the blocks of the passed download window
+// which are neither downloaded nor requested among the passed peers.  Blocks
+// are only assigned to peers which are known to have them, and each block goes
+// to the peer with the fewest blocks in flight so the download is spread
+// evenly.  The passed number of blocks in flight per peer is updated
+// accordingly.
+func assignBlockRequests(window []*headerNode, peers []*peerpkg.Peer,
+	inFlight map[*peerpkg.Peer]int) map[*peerpkg.Peer][]*headerNode {
+
+	requests := make(map[*peerpkg.Peer][]*headerNode)
+	for _, node := range window {
+		if node.block != nil || node.peer != nil {
+			continue
+		}
+
+		var best *peerpkg.Peer
+		for _, peer := range peers {
+			if peer.LastBlock() < node.height ||
+				inFlight[peer] >= maxBlocksInFlightPerPeer {
+
+				continue
+			}
+			if best == nil || inFlight[peer] < inFlight[best] {
+				best = peer
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		requests[best] = append(requests[best], node)
+		inFlight[best]++
+	}
+	return requests
+}
+
+// stallingPeer returns the peer the first block of the passed download window
+// was requested from when the request is older than blockStallTimeout and all
+// of the other blocks in the window are downloaded or requested, meaning the
+// peer keeps the window from moving.  It returns nil otherwise.
+func stallingPeer(window []*headerNode, now time.Time) *peerpkg.Peer {
+	if len(window) == 0 {
+		return nil
+	}
+	first := window[0]
+	if first.peer == nil || now.Sub(first.requested) < blockStallTimeout {
+		return nil
+	}
+	for _, node := range window[1:] {
+		if node.block == nil && node.peer == nil {
+			return nil
+		}
+	}
+	return first.peer
+}
+
+// blockDownloadPeers returns the peers the blocks for the headers are
+// downloaded from during a headers-first sync.
+func (sm *SyncManager) blockDownloadPeers() []*peerpkg.Peer {
+	segwitActive, err := sm.chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+	if err != nil {
+		log.Errorf("Unable to query for segwit soft-fork state: %v", err)
+		return nil
+	}
+
+	var peers []*peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if !state.syncCandidate {
+			continue
+		}
+		if segwitActive && !peer.IsWitnessEnabled() {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// isMutatedBlockErr returns whether the passed error from processing a block
+// means the block does not match the header it was downloaded for, as opposed
+// to the block the header commits to being invalid.
+func isMutatedBlockErr(err error) bool {
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok {
+		return false
+	}
+	switch rerr.ErrorCode {
+	case blockchain.ErrBadMerkleRoot, blockchain.ErrDuplicateTx,
+		blockchain.ErrUnexpectedWitness,
+		blockchain.ErrInvalidWitnessCommitment,
+		blockchain.ErrWitnessCommitmentMismatch:
+
+		return true
+	}
+	return false
+}
+
+// isReorgTooDeepErr returns whether the passed error from processing a block
+// means the chain refused to reorganize to it for exceeding the maximum reorg
+// depth.  The block isn't known to be invalid in that case, so the peer which
+// delivered it is neither rejected nor penalized.
+func isReorgTooDeepErr(err error) bool {
+	rerr, ok := err.(blockchain.RuleError)
+	return ok && rerr.ErrorCode == blockchain.ErrReorgTooDeep
+}
+
+// inDownloadWindow returns whether the block for the passed header is within
+// the download window, which is the only part of the header list blocks are
+// requested for.
+func (sm *SyncManager) inDownloadWindow(node *headerNode) bool {
+	e := sm.headerList.Front()
+	if e == nil {
+		return false
+	}
+	return node.height-e.Value.(*headerNode).height < blockDownloadWindow
+}
+
+// disconnectBlockPeer disconnects the passed peer from the block download.
+// The blocks requested from the peer are released right away rather than once
+// it is gone so they are requested from the remaining peers.
+func (sm *SyncManager) disconnectBlockPeer(peer *peerpkg.Peer) {
+	if state, exists := sm.peerStates[peer]; exists {
+		sm.clearRequestedState(state)
+		state.requestedBlocks = make(map[chainhash.Hash]struct{})
+		state.syncCandidate = false
+	}
+	peer.Disconnect()
+}
+
+// fetchHeaderBlocks requests the blocks within the download window which are
+// neither downloaded nor requested from all of the candidate peers.  A peer
+// which stalls the download window is disconnected so the block it was asked
+// for is requested from another peer.
+func (sm *SyncManager) fetchHeaderBlocks() {
+	window := make([]*headerNode, 0, blockDownloadWindow)
+	for e := sm.headerList.Front(); e != nil; e = e.Next() {
+		if len(window) == blockDownloadWindow {
+			break
+		}
+		window = append(window, e.Value.(*headerNode))
+	}
+	if len(window) == 0 {
+		return
+	}
+
+	peers := sm.blockDownloadPeers()
+	now := time.Now()
+	if staller := stallingPeer(window, now); staller != nil && len(peers) > 1 {
+		log.Infof("Peer %s is stalling the block download -- "+
+			"disconnecting", staller.Addr())
+		sm.disconnectBlockPeer(staller)
+		peers = sm.blockDownloadPeers()
+	}
+
+	inFlight := make(map[*peerpkg.Peer]int, len(peers))
+	for _, peer := range peers {
+		inFlight[peer] = len(sm.peerStates[peer].requestedBlocks)
+	}
+	for peer, nodes := range assignBlockRequests(window, peers, inFlight) {
+		state := sm.peerStates[peer]
+		gdmsg := wire.NewMsgGetDataSizeHint(uint(len(nodes)))
+		for _, node := range nodes {
+			iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+
+			// If we're fetching from a witness enabled peer
+			// post-fork, then ensure that we receive all the
+			// witness data in the blocks.
+			if peer.IsWitnessEnabled() {
+				iv.Type = wire.InvTypeWitnessBlock
+			}
+			gdmsg.AddInvVect(iv)
+
+			node.peer = peer
+			node.requested = now
+			sm.requestedBlocks[*node.hash] = struct{}{}
+			state.requestedBlocks[*node.hash] = struct{}{}
+		}
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// fetchHeaders requests the next batch of headers starting from the header tip
+// from the sync peer.  Requesting headers is paused while the header list has
+// no room for a full message of them and resumed by processHeaderBlocks.
+func (sm *SyncManager) fetchHeaders() {
+	if sm.headerList.Len()+wire.MaxBlockHeadersPerMsg > maxHeaderBacklog {
+		if !sm.headersPaused {
+			log.Debugf("Pausing header download at height %d with "+
+				"%d blocks to fetch", sm.headerTip.height,
+				sm.headerList.Len())
+		}
+		sm.headersPaused = true
+		return
+	}
+	sm.headersPaused = false
+
+	locator := blockchain.BlockLocator([]*chainhash.Hash{sm.headerTip.hash})
+	err := sm.syncPeer.PushGetHeadersMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getheaders message to peer %s: %v",
+			sm.syncPeer.Addr(), err)
+	}
+}
+
+// queueHeaderBlock records the passed block downloaded for the passed header,
+// processes all blocks that are ready in order and requests more blocks.
+func (sm *SyncManager) queueHeaderBlock(peer *peerpkg.Peer, node *headerNode,
+	block *btcutil.Block) {
+
+	node.block = block
+	node.source = peer
+	node.peer = nil
+	sm.lastProgressTime = time.Now()
+
+	sm.processHeaderBlocks()
+	if sm.headersFirstMode {
+		sm.fetchHeaderBlocks()
+	}
+}
+
+// processHeaderBlocks processes the downloaded blocks at the front of the
+// header list in order.  Once the blocks for all headers have been processed
+// and the sync peer has no more headers, it switches to normal mode.
+func (sm *SyncManager) processHeaderBlocks() {
+	processed := false
+	for e := sm.headerList.Front(); e != nil; e = sm.headerList.Front() {
+		node := e.Value.(*headerNode)
+		if node.block == nil {
+			break
+		}
+
+		// Blocks covered by a verified checkpoint are eligible for less
+		// validation since their headers have been verified to link
+		// together up to the checkpoint.
+		behaviorFlags := blockchain.BFNone
+		if node.height <= sm.checkpointHeight {
+			behaviorFlags |= blockchain.BFFastAdd
+		}
+
+		_, isOrphan, err := sm.chain.ProcessBlock(node.block, behaviorFlags)
+		if err == nil && isOrphan {
+			// The block is the one committed to by the header, so
+			// it is the headers which do not connect.
+			log.Warnf("Block %v from %s does not connect to the "+
+				"chain as the headers claimed", node.hash,
+				node.source)
+			sm.updateSyncPeer(false)
+			return
+		}
+		if isReorgTooDeepErr(err) {
+			// The headers lead to a chain which is too deep of a
+			// reorganization to switch to.  Stop syncing from the
+			// sync peer without penalizing it since the chain isn't
+			// known to be invalid.
+			log.Warnf("Not syncing from %s: %v", sm.syncPeer, err)
+			if state, ok := sm.peerStates[sm.syncPeer]; ok {
+				state.syncCandidate = false
+			}
+			sm.updateSyncPeer(false)
+			return
+		}
+		if err != nil {
+			// When the error is a rule error, it means the block
+			// was simply rejected as opposed to something actually
+			// going wrong, so log it as such.  Otherwise, something
+			// really did go wrong, so log it as an actual error.
+			_, isRuleErr := err.(blockchain.RuleError)
+			if isRuleErr {
+				log.Infof("Rejected block %v from %s: %v",
+					node.hash, node.source, err)
+			} else {
+				log.Errorf("Failed to process block %v: %v",
+					node.hash, err)
+			}
+			if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
+				database.ErrCorruption {
+				panic(dbErr)
+			}
+
+			// Convert the error into an appropriate reject message
+			// and send it.
+			if isRuleErr {
+				code, reason := mempool.ErrToRejectErr(err)
+				node.source.PushRejectMsg(wire.CmdBlock, code,
+					reason, node.hash, false)
+			}
+
+			// A block which does not match what its header commits
+			// to was altered by the peer which delivered it, so
+			// disconnect that peer and download the block again
+			// from another one.  The same goes for blocks which
+			// could not be processed for reasons other than the
+			// rules, without penalizing the peer.
+			if !isRuleErr || isMutatedBlockErr(err) {
+				if isRuleErr {
+					log.Warnf("Peer %s delivered a block "+
+						"which does not match its header "+
+						"-- disconnecting", node.source)
+					sm.disconnectBlockPeer(node.source)
+				}
+				node.block = nil
+				node.source = nil
+				break
+			}
+
+			// Otherwise, the headers lead to an invalid block, so
+			// start over with a different sync peer.
+			sm.updateSyncPeer(true)
+			return
+		}
+
+		sm.headerList.Remove(e)
+		delete(sm.headerIndex, *node.hash)
+		sm.progressLogger.LogBlockHeight(node.block)
+		node.source.UpdateLastBlockHeight(node.height)
+		processed = true
+	}
+
+	// Clear the rejected transactions and resume requesting headers when
+	// processing the blocks made room for them.
+	if processed {
+		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+		if sm.headersPaused {
+			sm.fetchHeaders()
+		}
+	}
+
+	// Switch to normal mode once all blocks have been processed by
+	// requesting blocks from the latest one up to the end of the chain
+	// (zero hash) to catch up with any blocks found in the meantime.
+	if sm.headerList.Len() != 0 || !sm.headersSynced {
+		return
+	}
+	sm.headersFirstMode = false
+	log.Infof("Downloaded the blocks for all headers -- switching to " +
+		"normal mode")
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest "+
+			"block: %v", err)
+		return
+	}
+	err = sm.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getblocks message to peer %s: %v",
+			sm.syncPeer.Addr(), err)
+	}
+}
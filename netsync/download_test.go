@@ -0,0 +1,153 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	peerpkg "github.com/babylonchain-io/bbld/peer"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// downloadTestPeer returns a peer which claims to have the blocks up to the
+// passed height.
+func downloadTestPeer(t *testing.T, addr string, height int32) *peerpkg.Peer {
+	peer, err := peerpkg.NewOutboundPeer(&peerpkg.Config{}, addr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	peer.UpdateLastBlockHeight(height)
+	return peer
+}
+
+// downloadTestWindow returns a download window with headers for the passed
+// number of blocks starting at height 1.
+func downloadTestWindow(n int) []*headerNode {
+	window := make([]*headerNode, 0, n)
+	for i := 0; i < n; i++ {
+		hash := chainhash.Hash{byte(i), byte(i >> 8)}
+		window = append(window, &headerNode{height: int32(i + 1),
+			hash: &hash})
+	}
+	return window
+}
+
+// TestAssignBlockRequests ensures the blocks of the download window are spread
+// among the peers which have them without exceeding the blocks in flight limit.
+func TestAssignBlockRequests(t *testing.T) {
+	window := downloadTestWindow(50)
+	peerA := downloadTestPeer(t, "10.0.0.1:8333", 100)
+	peerB := downloadTestPeer(t, "10.0.0.2:8333", 100)
+	peerC := downloadTestPeer(t, "10.0.0.3:8333", 4)
+	peers := []*peerpkg.Peer{peerA, peerB, peerC}
+
+	// Mark some blocks as downloaded or already in flight.
+	window[0].block = btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{}))
+	window[1].peer = peerA
+	inFlight := map[*peerpkg.Peer]int{peerA: 1}
+
+	requests := assignBlockRequests(window, peers, inFlight)
+
+	// Only the blocks peer C has are assigned to it, while peers A and B
+	// are filled up to the limit.
+	if got := len(requests[peerC]); got != 1 {
+		t.Fatalf("wrong number of blocks for peer C - got %d, want %d",
+			got, 1)
+	}
+	if height := requests[peerC][0].height; height > 4 {
+		t.Fatalf("peer C assigned block at height %d it doesn't have",
+			height)
+	}
+	if inFlight[peerA] != maxBlocksInFlightPerPeer ||
+		inFlight[peerB] != maxBlocksInFlightPerPeer {
+
+		t.Fatalf("wrong number of blocks in flight - got %d and %d, "+
+			"want %d", inFlight[peerA], inFlight[peerB],
+			maxBlocksInFlightPerPeer)
+	}
+	if got := len(requests[peerA]); got != maxBlocksInFlightPerPeer-1 {
+		t.Fatalf("wrong number of blocks for peer A - got %d, want %d",
+			got, maxBlocksInFlightPerPeer-1)
+	}
+
+	// Ensure the blocks are assigned in order without gaps and that blocks
+	// which are downloaded or in flight are not assigned again.
+	assigned := make(map[int32]struct{})
+	for _, nodes := range requests {
+		for _, node := range nodes {
+			if _, ok := assigned[node.height]; ok {
+				t.Fatalf("block at height %d assigned twice",
+					node.height)
+			}
+			assigned[node.height] = struct{}{}
+		}
+	}
+	wantAssigned := (maxBlocksInFlightPerPeer - 1) + maxBlocksInFlightPerPeer + 1
+	if len(assigned) != wantAssigned {
+		t.Fatalf("wrong number of assigned blocks - got %d, want %d",
+			len(assigned), wantAssigned)
+	}
+	for height := int32(3); height < int32(3+wantAssigned); height++ {
+		if _, ok := assigned[height]; !ok {
+			t.Fatalf("block at height %d not assigned", height)
+		}
+	}
+
+	// Ensure nothing is assigned once all peers are at the limit.
+	for peer, nodes := range requests {
+		for _, node := range nodes {
+			node.peer = peer
+		}
+	}
+	if requests := assignBlockRequests(window, peers, inFlight); len(requests) != 0 {
+		t.Fatalf("unexpected requests for peers at the limit: %v",
+			requests)
+	}
+}
+
+// TestStallingPeer ensures peers are only considered to stall the download
+// when they keep the download window from moving.
+func TestStallingPeer(t *testing.T) {
+	now := time.Now()
+	peerA := downloadTestPeer(t, "10.0.0.1:8333", 100)
+	peerB := downloadTestPeer(t, "10.0.0.2:8333", 100)
+	window := downloadTestWindow(3)
+
+	// The first block was requested long ago while the other blocks are
+	// downloaded or in flight.
+	window[0].peer = peerA
+	window[0].requested = now.Add(-2 * blockStallTimeout)
+	window[1].block = btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{}))
+	window[2].peer = peerB
+	window[2].requested = now
+	if got := stallingPeer(window, now); got != peerA {
+		t.Fatalf("stallingPeer: got %v, want %v", got, peerA)
+	}
+
+	// Not stalling when a block in the window can still be requested.
+	window[2].peer = nil
+	if got := stallingPeer(window, now); got != nil {
+		t.Fatalf("stallingPeer: got %v, want nil", got)
+	}
+	window[2].peer = peerB
+
+	// Not stalling before the timeout.
+	window[0].requested = now.Add(-blockStallTimeout / 2)
+	if got := stallingPeer(window, now); got != nil {
+		t.Fatalf("stallingPeer: got %v, want nil", got)
+	}
+
+	// Not stalling when the first block isn't in flight.
+	window[0].peer = nil
+	if got := stallingPeer(window, now); got != nil {
+		t.Fatalf("stallingPeer: got %v, want nil", got)
+	}
+	if got := stallingPeer(nil, now); got != nil {
+		t.Fatalf("stallingPeer: got %v, want nil", got)
+	}
+}
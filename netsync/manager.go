@@ -23,11 +23,6 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
-
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
 	maxRejectedTxns = 1000
@@ -86,6 +81,22 @@ type notFoundMsg struct {
 	peer     *peerpkg.Peer
 }
 
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came
+// from together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peerpkg.Peer
+	reply      chan struct{}
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peerpkg.Peer
+	reply    chan struct{}
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *peerpkg.Peer
@@ -140,10 +151,24 @@ type pauseMsg struct {
 }
 
 // headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// and whose blocks are downloaded during a headers-first sync.
 type headerNode struct {
 	height int32
 	hash   *chainhash.Hash
+
+	// header is the checked header which the headers connecting to it are
+	// checked against.  It is nil for blocks already in the block chain.
+	header *blockchain.HeaderNode
+
+	// peer is the peer the block was requested from at the requested time.
+	// It is nil when the block is not in flight.
+	peer      *peerpkg.Peer
+	requested time.Time
+
+	// block is the downloaded block waiting for its parent to be processed
+	// and source is the peer that delivered it.
+	block  *btcutil.Block
+	source *peerpkg.Peer
 }
 
 // peerSyncState stores additional information that the SyncManager tracks
@@ -153,6 +178,7 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	partialBlocks   map[chainhash.Hash]*partialBlock
 }
 
 // limitAdd is a helper function for maps that require a maximum limit by
@@ -191,7 +217,11 @@ type SyncManager struct {
 	wg             sync.WaitGroup
 	quit           chan struct{}
 
-	// These fields should only be accessed from the blockHandler thread
+	// These fields should only be accessed from the blockHandler thread.
+	// Rejected transactions are keyed by their witness hash so a
+	// transaction with a malleated witness doesn't prevent the valid one
+	// from being downloaded.  Requested transactions are keyed by the hash
+	// they were requested with.
 	rejectedTxns     map[chainhash.Hash]struct{}
 	requestedTxns    map[chainhash.Hash]struct{}
 	requestedBlocks  map[chainhash.Hash]struct{}
@@ -199,10 +229,25 @@ type SyncManager struct {
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
 
-	// The following fields are used for headers-first mode.
+	// cmpctHBPeers are the peers that were asked to announce new blocks
+	// using compact blocks, ordered from the least to the most recent one
+	// to deliver a block.
+	cmpctHBPeers []*peerpkg.Peer
+
+	// The following fields are used for headers-first mode.  The header
+	// list holds the headers whose blocks have not been processed yet in
+	// chain order and the header index maps their hashes to the list
+	// elements.  The header tip is the latest header received, or the best
+	// block when there is none, and blocks up to the checkpoint height
+	// have been verified against a checkpoint.  Headers are not requested
+	// while headers paused is set since the header list is full.
 	headersFirstMode bool
+	headersSynced    bool
+	headersPaused    bool
 	headerList       *list.List
-	startHeader      *list.Element
+	headerIndex      map[chainhash.Hash]*list.Element
+	headerTip        *headerNode
+	checkpointHeight int32
 	nextCheckpoint   *chaincfg.Checkpoint
 
 	// An optional fee estimator.
@@ -213,16 +258,16 @@ type SyncManager struct {
 // syncing from a new peer.
 func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
 	sm.headersFirstMode = false
+	sm.headersSynced = false
+	sm.headersPaused = false
 	sm.headerList.Init()
-	sm.startHeader = nil
+	sm.headerIndex = make(map[chainhash.Hash]*list.Element)
+	sm.checkpointHeight = 0
+	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(newestHeight)
 
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
-	}
+	// Use the latest known block as the header tip.  This allows the next
+	// downloaded header to prove it links to the chain properly.
+	sm.headerTip = &headerNode{height: newestHeight, hash: newestHash}
 }
 
 // findNextHeaderCheckpoint returns the next checkpoint after the passed height.
@@ -314,7 +359,7 @@ func (sm *SyncManager) startSync() {
 	// falling back to a random peer of the same height if none are greater.
 	//
 	// TODO(conner): Use a better algorithm to ranking peers based on
-	// observed metrics and/or sync in parallel.
+	// observed metrics.
 	var bestPeer *peerpkg.Peer
 	switch {
 	case len(higherPeers) > 0:
@@ -341,32 +386,33 @@ func (sm *SyncManager) startSync() {
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
+		// When the peer has blocks we don't, use block headers to learn
+		// about which blocks comprise its chain first and then download
+		// the blocks from all of the candidate peers in parallel.  This
+		// is possible since each header contains the hash of the
+		// previous header and a merkle root.  Therefore if we validate
+		// all of the received headers link together properly, we can
+		// be sure the hashes for the blocks in between are accurate.
+		// Further, once the full blocks are downloaded, the merkle root
+		// is computed and compared against the value in the header
+		// which proves the full block hasn't been tampered with.  The
+		// blocks up to a checkpoint the headers match are eligible for
+		// less validation.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
+		// Once the blocks for all of the headers have been downloaded,
+		// use standard inv messages learn about the blocks and fully
+		// validate them.  Finally, regression test mode does not
+		// support the headers-first approach so do normal block
 		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
+		if best.Height < bestPeer.LastBlock() &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+			sm.resetHeaderState(&best.Hash, best.Height)
+			bestPeer.PushGetHeadersMsg(locator, &zeroHash)
 			sm.headersFirstMode = true
 			log.Infof("Downloading headers for blocks %d to "+
 				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
+				bestPeer.LastBlock(), bestPeer.Addr())
 		} else {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
@@ -435,11 +481,25 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		partialBlocks:   make(map[chainhash.Hash]*partialBlock),
+	}
+
+	// Let the peer know we support version 2 compact blocks so it relays
+	// them to us when asked.  Since the short ids are computed over the
+	// witness hashes, the peer must be able to provide witness data.
+	if peer.ProtocolVersion() >= wire.ShortIDsBlocksVersion &&
+		peer.IsWitnessEnabled() {
+
+		peer.QueueMessage(wire.NewMsgSendCmpct(false,
+			wire.CmpctBlockVersion), nil)
 	}
 
-	// Start syncing by choosing the best candidate if needed.
+	// Start syncing by choosing the best candidate if needed, or download
+	// blocks from the peer as well when a headers-first sync is underway.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
+	} else if isSyncCandidate && sm.headersFirstMode {
+		sm.fetchHeaderBlocks()
 	}
 }
 
@@ -452,6 +512,12 @@ func (sm *SyncManager) handleStallSample() {
 		return
 	}
 
+	// Check for peers stalling the download window in headers-first mode
+	// even when no blocks arrive.
+	if sm.headersFirstMode {
+		sm.fetchHeaderBlocks()
+	}
+
 	// If we don't have an active sync peer, exit early.
 	if sm.syncPeer == nil {
 		return
@@ -513,11 +579,16 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	sm.removeHighBandwidthPeer(peer)
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
+	} else if sm.headersFirstMode {
+		// Request the blocks that were in flight from the peer from
+		// the remaining peers.
+		sm.fetchHeaderBlocks()
 	}
 }
 
@@ -532,11 +603,14 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 	}
 
 	// Remove requested blocks from the global map so that they will be
-	// fetched from elsewhere next time we get an inv.
-	// TODO: we could possibly here check which peers have these blocks
-	// and request them now to speed things up a little.
+	// fetched from elsewhere next time we get an inv.  Blocks requested
+	// during a headers-first sync are marked as no longer in flight so they
+	// are requested from other peers.
 	for blockHash := range state.requestedBlocks {
 		delete(sm.requestedBlocks, blockHash)
+		if e, ok := sm.headerIndex[blockHash]; ok {
+			e.Value.(*headerNode).peer = nil
+		}
 	}
 }
 
@@ -581,11 +655,12 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// to disconnect peers for sending unsolicited transactions to provide
 	// interoperability.
 	txHash := tmsg.tx.Hash()
+	wtxid := tmsg.tx.WitnessHash()
 
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
 	// rejected, the transaction was unsolicited.
-	if _, exists = sm.rejectedTxns[*txHash]; exists {
+	if _, exists = sm.rejectedTxns[*wtxid]; exists {
 		log.Debugf("Ignoring unsolicited previously rejected "+
 			"transaction %v from %s", txHash, peer)
 		return
@@ -602,11 +677,20 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// we'll retry next time we get an inv.
 	delete(state.requestedTxns, *txHash)
 	delete(sm.requestedTxns, *txHash)
+	delete(state.requestedTxns, *wtxid)
+	delete(sm.requestedTxns, *wtxid)
 
 	if err != nil {
 		// Do not request this transaction again until a new block
-		// has been processed.
-		limitAdd(sm.rejectedTxns, *txHash, maxRejectedTxns)
+		// has been processed.  It is recorded by the witness hash
+		// announced by peers relaying by witness hash.  It is also
+		// recorded by the hash announced by the other peers when it
+		// has no witness data, since a different witness can't make
+		// it valid then, unlike the same transaction with a witness.
+		limitAdd(sm.rejectedTxns, *wtxid, maxRejectedTxns)
+		if !tmsg.tx.HasWitness() {
+			limitAdd(sm.rejectedTxns, *txHash, maxRejectedTxns)
+		}
 
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going wrong,
@@ -660,9 +744,18 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		return
 	}
 
-	// If we didn't ask for this block then the peer is misbehaving.
+	// If we didn't ask for this block then the peer is misbehaving.  Blocks
+	// for the headers being fetched in headers-first mode are accepted from
+	// any peer since they might have been requested from another peer after
+	// this one stalled, but only within the download window so the number
+	// of downloaded blocks held in memory remains bounded.
 	blockHash := bmsg.block.Hash()
-	if _, exists = state.requestedBlocks[*blockHash]; !exists {
+	headerEl, isHeaderBlock := sm.headerIndex[*blockHash]
+	if isHeaderBlock && !sm.inDownloadWindow(headerEl.Value.(*headerNode)) {
+		isHeaderBlock = false
+	}
+	_, exists = state.requestedBlocks[*blockHash]
+	if !exists && !isHeaderBlock {
 		// The regression test intentionally sends some blocks twice
 		// to test duplicate block insertion fails.  Don't disconnect
 		// the peer or ignore the block when we're in regression test
@@ -676,39 +769,30 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := blockchain.BFNone
-	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
-		}
-	}
-
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
+	delete(state.partialBlocks, *blockHash)
+
+	// When in headers-first mode, the blocks for the headers being fetched
+	// arrive out of order from multiple peers, so they are processed once
+	// their parents are.
+	if isHeaderBlock {
+		sm.queueHeaderBlock(peer, headerEl.Value.(*headerNode), bmsg.block)
+		return
+	}
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, blockchain.BFNone)
+	if isReorgTooDeepErr(err) {
+		// The block isn't known to be invalid, so don't reject it.
+		log.Warnf("Not reorganizing to block %v from %s: %v",
+			blockHash, peer, err)
+		return
+	}
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -792,6 +876,12 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// Clear the rejected transactions.
 		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+
+		// Ask the peer to announce new blocks using compact blocks
+		// since it is among the latest to deliver a block to us.
+		if sm.current() {
+			sm.selectHighBandwidthPeer(peer)
+		}
 	}
 
 	// Update the block height for this peer. But only send a message to
@@ -805,115 +895,10 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 				peer)
 		}
 	}
-
-	// Nothing more to do if we aren't in headers-first mode.
-	if !sm.headersFirstMode {
-		return
-	}
-
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
-		}
-		return
-	}
-
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
-			return
-		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
-		return
-	}
-
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
-	if err != nil {
-		log.Warnf("Failed to send getblocks message to peer %s: %v",
-			peer.Addr(), err)
-		return
-	}
-}
-
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
-		return
-	}
-
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
-			continue
-		}
-
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
-		haveInv, err := sm.haveInventory(iv)
-		if err != nil {
-			log.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
-		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
-
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
-
-			// If we're fetching from a witness enabled peer
-			// post-fork, then ensure that we receive all the
-			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
-				iv.Type = wire.InvTypeWitnessBlock
-			}
-
-			gdmsg.AddInvVect(iv)
-			numRequested++
-		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
-			break
-		}
-	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
-	}
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
-// requested when performing a headers-first sync.
+// requested from the sync peer when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
 	_, exists := sm.peerStates[peer]
@@ -932,39 +917,43 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
+	// Headers are only requested from the sync peer, so ignore the ones
+	// from any other peer such as a previous sync peer responding late.
+	if peer != sm.syncPeer {
+		log.Debugf("Ignoring %d headers from non-sync peer %s",
+			numHeaders, peer)
+		return
+	}
+
+	// Headers are only requested while there is room for a full message of
+	// them in the header list, so more than that were not requested.
+	if sm.headerList.Len()+numHeaders > maxHeaderBacklog {
+		log.Warnf("Got %d headers exceeding the header backlog from "+
+			"%s -- disconnecting", numHeaders, peer.Addr())
+		peer.Disconnect()
 		return
 	}
 
 	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
+	// previous, passes the same checks as when its block is processed and
+	// that checkpoints match.
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
 
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
-			peer.Disconnect()
-			return
+		// The first header links to the block the sync peer's chain
+		// forks from ours at when it isn't our best block, so use
+		// that block as the tip instead.
+		prevHash := &blockHeader.PrevBlock
+		if sm.headerList.Len() == 0 && !sm.headerTip.hash.IsEqual(prevHash) {
+			height, err := sm.chain.BlockHeightByHash(prevHash)
+			if err == nil {
+				sm.headerTip = &headerNode{height: height,
+					hash: prevHash}
+			}
 		}
 
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
+		// Ensure the header properly connects to the previous one.
+		if !sm.headerTip.hash.IsEqual(prevHash) {
 			log.Warnf("Received block header that does not "+
 				"properly connect to the chain from peer %s "+
 				"-- disconnecting", peer.Addr())
@@ -972,14 +961,30 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 			return
 		}
 
+		// Check the proof of work, difficulty and timestamp of the
+		// header against the headers before it.
+		checked, err := sm.chain.CheckBlockHeader(blockHeader,
+			sm.headerTip.header)
+		if err != nil {
+			if _, ok := err.(blockchain.RuleError); !ok {
+				log.Errorf("Failed to check block header %v: %v",
+					blockHash, err)
+				return
+			}
+			log.Warnf("Received invalid block header %v from peer "+
+				"%s: %v -- disconnecting", blockHash,
+				peer.Addr(), err)
+			peer.Disconnect()
+			return
+		}
+
 		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
+		node := &headerNode{height: checked.Height(),
+			hash: checked.Hash(), header: checked}
+		if sm.nextCheckpoint != nil &&
+			node.height == sm.nextCheckpoint.Height {
+
+			if !node.hash.IsEqual(sm.nextCheckpoint.Hash) {
 				log.Warnf("Block header at height %d/hash "+
 					"%s from peer %s does NOT match "+
 					"expected checkpoint hash of %s -- "+
@@ -989,34 +994,45 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 				peer.Disconnect()
 				return
 			}
-			break
+			log.Infof("Verified downloaded block header against "+
+				"checkpoint at height %d/hash %s", node.height,
+				node.hash)
+			sm.checkpointHeight = node.height
+			sm.nextCheckpoint = sm.findNextHeaderCheckpoint(node.height)
+		}
+		sm.headerTip = node
+
+		// Only the blocks which aren't already known need to be
+		// downloaded.
+		haveBlock, err := sm.chain.HaveBlock(node.hash)
+		if err != nil {
+			log.Warnf("Unexpected failure when checking for "+
+				"existing block during headers processing: %v",
+				err)
+		}
+		if !haveBlock {
+			sm.headerIndex[blockHash] = sm.headerList.PushBack(node)
 		}
 	}
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
+	// The sync peer has the blocks for all of the headers it sent.
+	peer.UpdateLastBlockHeight(sm.headerTip.height)
+
+	// Request the next batch of headers starting from the latest known
+	// header while the blocks are downloaded when the message was full.
+	// Otherwise, the sync peer has no more headers.
+	if numHeaders == wire.MaxBlockHeadersPerMsg {
+		sm.fetchHeaders()
+	} else {
+		sm.headersSynced = true
+		log.Infof("Received block headers up to height %d: "+
+			"fetching %d blocks", sm.headerTip.height,
 			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
-		sm.fetchHeaderBlocks()
-		return
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
-		return
+	sm.processHeaderBlocks()
+	if sm.headersFirstMode {
+		sm.fetchHeaderBlocks()
 	}
 }
 
@@ -1032,14 +1048,25 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 		// verify the hash was actually announced by the peer
 		// before deleting from the global requested maps.
 		switch inv.Type {
+		case wire.InvTypeCmpctBlock:
+			fallthrough
 		case wire.InvTypeWitnessBlock:
 			fallthrough
 		case wire.InvTypeBlock:
 			if _, exists := state.requestedBlocks[inv.Hash]; exists {
 				delete(state.requestedBlocks, inv.Hash)
 				delete(sm.requestedBlocks, inv.Hash)
+
+				// Mark the block as no longer in flight when
+				// it is one of the blocks being fetched in
+				// headers-first mode.
+				if e, ok := sm.headerIndex[inv.Hash]; ok {
+					e.Value.(*headerNode).peer = nil
+				}
 			}
 
+		case wire.InvTypeWTx:
+			fallthrough
 		case wire.InvTypeWitnessTx:
 			fallthrough
 		case wire.InvTypeTx:
@@ -1095,6 +1122,13 @@ func (sm *SyncManager) haveInventory(invVect *wire.InvVect) (bool, error) {
 		}
 
 		return false, nil
+
+	case wire.InvTypeWTx:
+		// Ask the transaction memory pool if the transaction is known
+		// to it in any form (main pool or orphan).  Unlike above, the
+		// main chain can't be checked since its outputs are looked up
+		// by the transaction hash.
+		return sm.txMemPool.HaveTransactionByWitnessHash(&invVect.Hash), nil
 	}
 
 	// The requested inventory is is an unsupported type, so just claim
@@ -1152,12 +1186,21 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 	// Finally, attempt to detect potential stalls due to long side chains
 	// we already have and request more blocks to prevent them.
 	for i, iv := range invVects {
-		// Ignore unsupported inventory types.
+		// Ignore unsupported inventory types.  Peers relaying
+		// transactions by their witness hash must only announce them
+		// that way, and other peers must only announce them by their
+		// hash.
 		switch iv.Type {
 		case wire.InvTypeBlock:
-		case wire.InvTypeTx:
 		case wire.InvTypeWitnessBlock:
-		case wire.InvTypeWitnessTx:
+		case wire.InvTypeTx, wire.InvTypeWitnessTx:
+			if peer.WantsWTxIdRelay() {
+				continue
+			}
+		case wire.InvTypeWTx:
+			if !peer.WantsWTxIdRelay() {
+				continue
+			}
 		default:
 			continue
 		}
@@ -1180,9 +1223,14 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			continue
 		}
 		if !haveInv {
-			if iv.Type == wire.InvTypeTx {
+			if iv.Type == wire.InvTypeTx || iv.Type == wire.InvTypeWTx {
 				// Skip the transaction if it has already been
-				// rejected.
+				// rejected.  The hash of the inventory is the
+				// witness hash for witness transaction
+				// inventory, which rejected transactions are
+				// always recorded by, and the hash otherwise,
+				// which they are recorded by when they have
+				// no witness data.
 				if _, exists := sm.rejectedTxns[iv.Hash]; exists {
 					continue
 				}
@@ -1266,6 +1314,14 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 					iv.Type = wire.InvTypeWitnessBlock
 				}
 
+				// Once synced, new blocks most likely only
+				// contain transactions already in the pool, so
+				// ask for a compact block when the peer
+				// supports them.
+				if sm.current() && peer.WantsCmpctBlocks() {
+					iv.Type = wire.InvTypeCmpctBlock
+				}
+
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -1285,6 +1341,18 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 					iv.Type = wire.InvTypeWitnessTx
 				}
 
+				gdmsg.AddInvVect(iv)
+				numRequested++
+			}
+
+		case wire.InvTypeWTx:
+			// Request the transaction by its witness hash if there
+			// is not already a pending request.  The transaction
+			// is always sent with its witness data.
+			if _, exists := sm.requestedTxns[iv.Hash]; !exists {
+				limitAdd(sm.requestedTxns, iv.Hash, maxRequestedTxns)
+				limitAdd(state.requestedTxns, iv.Hash, maxRequestedTxns)
+
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -1326,6 +1394,14 @@ out:
 				sm.handleBlockMsg(msg)
 				msg.reply <- struct{}{}
 
+			case *cmpctBlockMsg:
+				sm.handleCmpctBlockMsg(msg)
+				msg.reply <- struct{}{}
+
+			case *blockTxnMsg:
+				sm.handleBlockTxnMsg(msg)
+				msg.reply <- struct{}{}
+
 			case *invMsg:
 				sm.handleInvMsg(msg)
 
@@ -1406,7 +1482,7 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
-		sm.peerNotifier.RelayInventory(iv, block.MsgBlock().Header)
+		sm.peerNotifier.RelayInventory(iv, block)
 
 	// A block has been connected to the main block chain.
 	case blockchain.NTBlockConnected:
@@ -1524,6 +1600,32 @@ func (sm *SyncManager) QueueBlock(block *btcutil.Block, peer *peerpkg.Peer, done
 	sm.msgChan <- &blockMsg{block: block, peer: peer, reply: done}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue. Responds to the done channel argument after the message is
+// processed.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peerpkg.Peer, done chan struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer, reply: done}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue. Responds to the done channel argument after the message is
+// processed.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peerpkg.Peer, done chan struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: peer, reply: done}
+}
+
 // QueueInv adds the passed inv message and peer to the block handling queue.
 func (sm *SyncManager) QueueInv(inv *wire.MsgInv, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on inv
@@ -1650,13 +1752,8 @@ func New(config *Config) (*SyncManager, error) {
 	}
 
 	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	sm.resetHeaderState(&best.Hash, best.Height)
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
 
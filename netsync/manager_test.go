@@ -0,0 +1,773 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
+	_ "github.com/babylonchain-io/bbld/database/ffldb"
+	"github.com/babylonchain-io/bbld/integration/rpctest"
+	"github.com/babylonchain-io/bbld/mempool"
+	peerpkg "github.com/babylonchain-io/bbld/peer"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// managerTestConn is one end of an in-memory connection between two peers.
+type managerTestConn struct {
+	io.Reader
+	io.WriteCloser
+	laddr, raddr net.Addr
+}
+
+func (c *managerTestConn) LocalAddr() net.Addr                { return c.laddr }
+func (c *managerTestConn) RemoteAddr() net.Addr               { return c.raddr }
+func (c *managerTestConn) SetDeadline(t time.Time) error      { return nil }
+func (c *managerTestConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *managerTestConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// managerTestPeer is a peer connected to a remote peer which records the
+// getheaders, getblocks and reject messages it receives.
+type managerTestPeer struct {
+	*peerpkg.Peer
+	getHeaders chan *wire.MsgGetHeaders
+	getBlocks  chan *wire.MsgGetBlocks
+	rejects    chan *wire.MsgReject
+}
+
+// newManagerTestPeer returns a peer which claims to have the blocks up to the
+// passed height and has completed the version handshake with a remote peer.
+func newManagerTestPeer(t *testing.T, params *chaincfg.Params, height int32) *managerTestPeer {
+	t.Helper()
+	return newManagerTestPeerVersion(t, params, height, 0)
+}
+
+// newManagerTestPeerVersion returns a peer like newManagerTestPeer which
+// negotiated the passed protocol version, or the latest one when it is zero.
+func newManagerTestPeerVersion(t *testing.T, params *chaincfg.Params,
+	height int32, protocolVersion uint32) *managerTestPeer {
+
+	t.Helper()
+
+	p := &managerTestPeer{
+		getHeaders: make(chan *wire.MsgGetHeaders, 10),
+		getBlocks:  make(chan *wire.MsgGetBlocks, 10),
+		rejects:    make(chan *wire.MsgReject, 10),
+	}
+	verack := make(chan struct{}, 2)
+	cfg := peerpkg.Config{
+		Listeners: peerpkg.MessageListeners{
+			OnVerAck: func(*peerpkg.Peer, *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		ChainParams:     params,
+		Services:        wire.SFNodeNetwork | wire.SFNodeWitness,
+		ProtocolVersion: protocolVersion,
+		AllowSelfConns:  true,
+	}
+	remoteCfg := cfg
+	remoteCfg.Listeners.OnGetHeaders = func(_ *peerpkg.Peer, msg *wire.MsgGetHeaders) {
+		p.getHeaders <- msg
+	}
+	remoteCfg.Listeners.OnGetBlocks = func(_ *peerpkg.Peer, msg *wire.MsgGetBlocks) {
+		p.getBlocks <- msg
+	}
+	remoteCfg.Listeners.OnReject = func(_ *peerpkg.Peer, msg *wire.MsgReject) {
+		p.rejects <- msg
+	}
+
+	localAddr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 18444}
+	remoteAddr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 18444}
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	localConn := &managerTestConn{r1, w2, localAddr, remoteAddr}
+	remoteConn := &managerTestConn{r2, w1, remoteAddr, localAddr}
+
+	local, err := peerpkg.NewOutboundPeer(&cfg, remoteAddr.String())
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	remote := peerpkg.NewInboundPeer(&remoteCfg)
+	local.AssociateConnection(localConn)
+	remote.AssociateConnection(remoteConn)
+	t.Cleanup(func() {
+		local.Disconnect()
+		remote.Disconnect()
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second * 5):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	local.UpdateLastBlockHeight(height)
+	p.Peer = local
+	return p
+}
+
+// expectGetHeaders ensures the peer requested the headers after the passed
+// hash.
+func (p *managerTestPeer) expectGetHeaders(t *testing.T, hash *chainhash.Hash) {
+	t.Helper()
+
+	select {
+	case msg := <-p.getHeaders:
+		if len(msg.BlockLocatorHashes) != 1 ||
+			!msg.BlockLocatorHashes[0].IsEqual(hash) {
+
+			t.Fatalf("getheaders locator %v, want %v",
+				msg.BlockLocatorHashes, hash)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("no getheaders for the headers after %v", hash)
+	}
+}
+
+// expectNoGetHeaders ensures the peer did not request any headers.
+func (p *managerTestPeer) expectNoGetHeaders(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-p.getHeaders:
+		t.Fatalf("unexpected getheaders with locator %v",
+			msg.BlockLocatorHashes)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+// expectNoReject ensures the peer was not sent a reject message.
+func (p *managerTestPeer) expectNoReject(t *testing.T) {
+	t.Helper()
+
+	select {
+	case msg := <-p.rejects:
+		t.Fatalf("unexpected reject for %v: %v", msg.Hash, msg.Reason)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+// newManagerTestChain returns a block chain using a copy of the regression
+// test network parameters.
+func newManagerTestChain(t *testing.T) (*blockchain.BlockChain, *chaincfg.Params) {
+	t.Helper()
+	return newManagerTestChainReorgDepth(t, 0)
+}
+
+// newManagerTestChainReorgDepth returns a block chain using a copy of the
+// regression test network parameters which refuses reorganizations deeper
+// than the passed depth.
+func newManagerTestChainReorgDepth(t *testing.T,
+	maxReorgDepth int32) (*blockchain.BlockChain, *chaincfg.Params) {
+
+	t.Helper()
+
+	DisableLog()
+	params := chaincfg.RegressionNetParams
+	dbPath := filepath.Join(t.TempDir(), "netsync_test")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:            db,
+		ChainParams:   &params,
+		TimeSource:    blockchain.NewMedianTime(),
+		MaxReorgDepth: maxReorgDepth,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	return chain, &params
+}
+
+// newManagerTestSyncManager returns a sync manager for the passed chain which
+// is performing a headers-first sync from the passed peer.
+func newManagerTestSyncManager(chain *blockchain.BlockChain, params *chaincfg.Params,
+	syncPeer *peerpkg.Peer) *SyncManager {
+
+	sm := &SyncManager{
+		chain:           chain,
+		chainParams:     params,
+		rejectedTxns:    make(map[chainhash.Hash]struct{}),
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
+		progressLogger:  newBlockProgressLogger("Processed", log),
+		headerList:      list.New(),
+	}
+	best := chain.BestSnapshot()
+	sm.resetHeaderState(&best.Hash, best.Height)
+	addManagerTestPeer(sm, syncPeer)
+	sm.syncPeer = syncPeer
+	sm.headersFirstMode = true
+	return sm
+}
+
+// addManagerTestPeer adds the passed peer to the sync candidates of the passed
+// sync manager.
+func addManagerTestPeer(sm *SyncManager, peer *peerpkg.Peer) {
+	sm.peerStates[peer] = &peerSyncState{
+		syncCandidate:   true,
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+	}
+}
+
+// managerTestSolve sets the nonce of the passed header so its hash meets the
+// target of its difficulty bits, or exceeds it when solved is false.
+func managerTestSolve(header *wire.BlockHeader, solved bool) {
+	target := blockchain.CompactToBig(header.Bits)
+	for header.Nonce = 0; ; header.Nonce++ {
+		hash := header.BlockHash()
+		if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == solved {
+			return
+		}
+	}
+}
+
+// managerTestHeaders returns the passed number of solved headers building on
+// the passed header.  They are spaced apart far enough for the minimum
+// difficulty to remain valid.
+func managerTestHeaders(params *chaincfg.Params, prev *wire.BlockHeader, n int) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, n)
+	for i := 0; i < n; i++ {
+		header := &wire.BlockHeader{
+			Version:   0x20000000,
+			PrevBlock: prev.BlockHash(),
+			Timestamp: prev.Timestamp.Add(params.TargetTimePerBlock * 2),
+			Bits:      params.PowLimitBits,
+		}
+		managerTestSolve(header, true)
+		headers = append(headers, header)
+		prev = header
+	}
+	return headers
+}
+
+// managerTestBlocks returns the passed number of blocks building on the
+// genesis block.
+func managerTestBlocks(t *testing.T, params *chaincfg.Params, n int) []*btcutil.Block {
+	t.Helper()
+	return managerTestBlocksSpaced(t, params, n, params.TargetTimePerBlock*2)
+}
+
+// managerTestBlocksSpaced returns the passed number of blocks building on the
+// genesis block which are spaced apart by the passed duration.  Different
+// spacings result in different chains.
+func managerTestBlocksSpaced(t *testing.T, params *chaincfg.Params, n int,
+	spacing time.Duration) []*btcutil.Block {
+
+	t.Helper()
+
+	payAddr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	var prev *btcutil.Block
+	prevTime := params.GenesisBlock.Header.Timestamp
+	blocks := make([]*btcutil.Block, 0, n)
+	for i := 0; i < n; i++ {
+		prevTime = prevTime.Add(spacing)
+		block, err := rpctest.CreateBlock(prev, nil, nil, 0x20000000,
+			prevTime, payAddr, nil, params)
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		blocks = append(blocks, block)
+		prev = block
+	}
+	return blocks
+}
+
+// managerTestHeadersMsg returns a headers message with the passed headers.
+func managerTestHeadersMsg(headers []*wire.BlockHeader) *wire.MsgHeaders {
+	msg := wire.NewMsgHeaders()
+	for _, header := range headers {
+		msg.AddBlockHeader(header)
+	}
+	return msg
+}
+
+// TestHandleHeadersMsg ensures headers from the sync peer are checked against
+// the chain, that the headers waiting for their blocks are capped and that
+// peers sending invalid headers are disconnected.
+func TestHandleHeadersMsg(t *testing.T) {
+	chain, params := newManagerTestChain(t)
+	genesis := &params.GenesisBlock.Header
+	valid := managerTestHeaders(params, genesis, 2)
+
+	// Headers which fail the checks performed when their blocks are
+	// processed disconnect the peer.
+	hardBits := managerTestHeaders(params, genesis, 1)[0]
+	hardBits.Bits = 0x1f7fffff
+	managerTestSolve(hardBits, true)
+	tooOld := managerTestHeaders(params, valid[0], 1)[0]
+	tooOld.Timestamp = valid[0].Timestamp
+	managerTestSolve(tooOld, true)
+	unsolved := *valid[1]
+	managerTestSolve(&unsolved, false)
+
+	tests := []struct {
+		name       string
+		headers    []*wire.BlockHeader
+		wantQueued int
+	}{
+		{
+			name:       "unexpected difficulty",
+			headers:    []*wire.BlockHeader{hardBits},
+			wantQueued: 0,
+		},
+		{
+			name:       "timestamp not after median time",
+			headers:    []*wire.BlockHeader{valid[0], tooOld},
+			wantQueued: 1,
+		},
+		{
+			name:       "high hash",
+			headers:    []*wire.BlockHeader{valid[0], &unsolved},
+			wantQueued: 1,
+		},
+		{
+			name:       "does not connect",
+			headers:    []*wire.BlockHeader{valid[1]},
+			wantQueued: 0,
+		},
+	}
+	for _, test := range tests {
+		peer := newManagerTestPeer(t, params, 0)
+		sm := newManagerTestSyncManager(chain, params, peer.Peer)
+		sm.handleHeadersMsg(&headersMsg{
+			headers: managerTestHeadersMsg(test.headers),
+			peer:    peer.Peer,
+		})
+		if peer.Connected() {
+			t.Errorf("%s: peer was not disconnected", test.name)
+		}
+		if sm.headerList.Len() != test.wantQueued || sm.headersSynced {
+			t.Errorf("%s: %d headers queued and synced %v, want %d "+
+				"headers queued", test.name, sm.headerList.Len(),
+				sm.headersSynced, test.wantQueued)
+		}
+	}
+
+	// Full messages of valid headers are queued and the next headers are
+	// requested until there is no room for another message.
+	peer := newManagerTestPeer(t, params, 0)
+	sm := newManagerTestSyncManager(chain, params, peer.Peer)
+	prev := genesis
+	numMsgs := maxHeaderBacklog / wire.MaxBlockHeadersPerMsg
+	for i := 0; i < numMsgs; i++ {
+		headers := managerTestHeaders(params, prev, wire.MaxBlockHeadersPerMsg)
+		prev = headers[len(headers)-1]
+		sm.handleHeadersMsg(&headersMsg{
+			headers: managerTestHeadersMsg(headers),
+			peer:    peer.Peer,
+		})
+
+		wantLen := (i + 1) * wire.MaxBlockHeadersPerMsg
+		if sm.headerList.Len() != wantLen || len(sm.headerIndex) != wantLen {
+			t.Fatalf("message %d: %d headers queued, want %d", i,
+				sm.headerList.Len(), wantLen)
+		}
+		if sm.headerTip.height != int32(wantLen) {
+			t.Fatalf("message %d: header tip height %d, want %d", i,
+				sm.headerTip.height, wantLen)
+		}
+		if i < numMsgs-1 {
+			if sm.headersPaused {
+				t.Fatalf("message %d: headers paused", i)
+			}
+			peer.expectGetHeaders(t, sm.headerTip.hash)
+		}
+	}
+	if !sm.headersPaused || sm.headersSynced {
+		t.Fatalf("headers were not paused at %d queued headers",
+			sm.headerList.Len())
+	}
+	peer.expectNoGetHeaders(t)
+	if !peer.Connected() {
+		t.Fatal("peer sending valid headers was disconnected")
+	}
+
+	// Headers beyond the cap were not requested.
+	headers := managerTestHeaders(params, prev, wire.MaxBlockHeadersPerMsg)
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg(headers),
+		peer:    peer.Peer,
+	})
+	if peer.Connected() {
+		t.Fatal("peer sending headers beyond the cap was not " +
+			"disconnected")
+	}
+	if sm.headerList.Len() > maxHeaderBacklog {
+		t.Fatalf("%d headers queued beyond the cap of %d",
+			sm.headerList.Len(), maxHeaderBacklog)
+	}
+}
+
+// TestProcessHeaderBlocks ensures the blocks downloaded for the headers are
+// processed in order, that requesting headers resumes once processing them
+// made room and that the sync switches to normal mode once done.
+func TestProcessHeaderBlocks(t *testing.T) {
+	chain, params := newManagerTestChain(t)
+	const numBlocks = 5
+	blocks := managerTestBlocks(t, params, numBlocks)
+	headers := make([]*wire.BlockHeader, 0, numBlocks)
+	for _, block := range blocks {
+		headers = append(headers, &block.MsgBlock().Header)
+	}
+
+	peer := newManagerTestPeer(t, params, numBlocks)
+	sm := newManagerTestSyncManager(chain, params, peer.Peer)
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg(headers),
+		peer:    peer.Peer,
+	})
+	if !sm.headersSynced || sm.headerList.Len() != numBlocks {
+		t.Fatalf("got %d headers and synced %v, want %d headers and "+
+			"synced", sm.headerList.Len(), sm.headersSynced,
+			numBlocks)
+	}
+
+	// The blocks are requested from the peer.
+	for e := sm.headerList.Front(); e != nil; e = e.Next() {
+		node := e.Value.(*headerNode)
+		if node.peer != peer.Peer {
+			t.Fatalf("block %v at height %d was not requested",
+				node.hash, node.height)
+		}
+	}
+
+	// Blocks are only processed once their parents are.
+	tests := []struct {
+		block      int
+		wantHeight int32
+	}{
+		{block: 2, wantHeight: 0},
+		{block: 0, wantHeight: 1},
+		{block: 1, wantHeight: 3},
+		{block: 4, wantHeight: 3},
+		{block: 3, wantHeight: numBlocks},
+	}
+	for _, test := range tests {
+		sm.handleBlockMsg(&blockMsg{block: blocks[test.block],
+			peer: peer.Peer})
+		best := chain.BestSnapshot()
+		if best.Height != test.wantHeight {
+			t.Fatalf("block %d: best height %d, want %d",
+				test.block+1, best.Height, test.wantHeight)
+		}
+		wantLen := numBlocks - int(test.wantHeight)
+		if sm.headerList.Len() != wantLen || len(sm.headerIndex) != wantLen {
+			t.Fatalf("block %d: %d headers queued, want %d",
+				test.block+1, sm.headerList.Len(), wantLen)
+		}
+	}
+
+	// All blocks have been processed, so the remaining blocks are
+	// requested in normal mode.
+	if sm.headersFirstMode {
+		t.Fatal("did not switch to normal mode")
+	}
+	select {
+	case msg := <-peer.getBlocks:
+		best := chain.BestSnapshot()
+		if !msg.BlockLocatorHashes[0].IsEqual(&best.Hash) {
+			t.Fatalf("getblocks locator starts at %v, want %v",
+				msg.BlockLocatorHashes[0], best.Hash)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no getblocks after switching to normal mode")
+	}
+
+	// Requesting headers resumes once processing the blocks made room for
+	// a full message of them in the header list.
+	chain, params = newManagerTestChain(t)
+	peer = newManagerTestPeer(t, params, 0)
+	sm = newManagerTestSyncManager(chain, params, peer.Peer)
+	for _, block := range blocks[:2] {
+		node := &headerNode{height: block.Height(), hash: block.Hash()}
+		sm.headerIndex[*node.hash] = sm.headerList.PushBack(node)
+	}
+	for sm.headerList.Len() < maxHeaderBacklog-wire.MaxBlockHeadersPerMsg+2 {
+		hash := chainhash.Hash{byte(sm.headerList.Len()),
+			byte(sm.headerList.Len() >> 8)}
+		sm.headerTip = &headerNode{height: numBlocks +
+			int32(sm.headerList.Len()), hash: &hash}
+		sm.headerIndex[hash] = sm.headerList.PushBack(sm.headerTip)
+	}
+	sm.headersPaused = true
+
+	sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	if chain.BestSnapshot().Height != 1 {
+		t.Fatal("first block was not processed")
+	}
+	if !sm.headersPaused {
+		t.Fatal("headers resumed without room for them")
+	}
+	peer.expectNoGetHeaders(t)
+
+	sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: peer.Peer})
+	if chain.BestSnapshot().Height != 2 {
+		t.Fatal("second block was not processed")
+	}
+	if sm.headersPaused {
+		t.Fatal("headers still paused after making room")
+	}
+	peer.expectGetHeaders(t, sm.headerTip.hash)
+}
+
+// TestHeaderBlockMisbehavior ensures blocks for the headers are only held
+// within the download window, that a peer delivering a block which does not
+// match its header is disconnected without restarting the sync and that the
+// sync restarts when the headers lead to an invalid block.
+func TestHeaderBlockMisbehavior(t *testing.T) {
+	chain, params := newManagerTestChain(t)
+	blocks := managerTestBlocks(t, params, 2)
+
+	// Blocks for headers beyond the download window were not requested.
+	syncPeer := newManagerTestPeer(t, params, 0)
+	sm := newManagerTestSyncManager(chain, params, syncPeer.Peer)
+	headers := managerTestHeaders(params, &params.GenesisBlock.Header,
+		wire.MaxBlockHeadersPerMsg)
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg(headers),
+		peer:    syncPeer.Peer,
+	})
+	syncPeer.expectGetHeaders(t, sm.headerTip.hash)
+	other := newManagerTestPeer(t, params, 0)
+	addManagerTestPeer(sm, other.Peer)
+	inWindow := btcutil.NewBlock(wire.NewMsgBlock(headers[1]))
+	sm.handleBlockMsg(&blockMsg{block: inWindow, peer: other.Peer})
+	if node := sm.headerIndex[*inWindow.Hash()].Value.(*headerNode); node.block == nil {
+		t.Fatal("block within the download window was not queued")
+	}
+	beyond := btcutil.NewBlock(wire.NewMsgBlock(headers[blockDownloadWindow]))
+	sm.handleBlockMsg(&blockMsg{block: beyond, peer: other.Peer})
+	if node := sm.headerIndex[*beyond.Hash()].Value.(*headerNode); node.block != nil {
+		t.Fatal("block beyond the download window was queued")
+	}
+	if other.Connected() {
+		t.Fatal("peer sending a block beyond the download window was " +
+			"not disconnected")
+	}
+
+	// A block altered by the peer delivering it is downloaded again.
+	syncPeer = newManagerTestPeer(t, params, 2)
+	sm = newManagerTestSyncManager(chain, params, syncPeer.Peer)
+	other = newManagerTestPeer(t, params, 0)
+	addManagerTestPeer(sm, other.Peer)
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg([]*wire.BlockHeader{
+			&blocks[0].MsgBlock().Header,
+			&blocks[1].MsgBlock().Header,
+		}),
+		peer: syncPeer.Peer,
+	})
+	mutated := *blocks[0].MsgBlock()
+	coinbase := mutated.Transactions[0].Copy()
+	coinbase.LockTime++
+	mutated.Transactions = []*wire.MsgTx{coinbase}
+	sm.handleBlockMsg(&blockMsg{block: btcutil.NewBlock(&mutated),
+		peer: other.Peer})
+	if other.Connected() {
+		t.Fatal("peer sending a mutated block was not disconnected")
+	}
+	if !syncPeer.Connected() || !sm.headersFirstMode ||
+		sm.headerList.Len() != 2 {
+
+		t.Fatal("mutated block restarted the sync")
+	}
+	node := sm.headerIndex[*blocks[0].Hash()].Value.(*headerNode)
+	if node.block != nil || node.source != nil {
+		t.Fatal("mutated block was kept")
+	}
+	sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: syncPeer.Peer})
+	if chain.BestSnapshot().Height != 1 {
+		t.Fatal("block downloaded again was not processed")
+	}
+
+	// A block which matches its header but breaks the rules means the
+	// headers lead to an invalid block.
+	invalid := *blocks[1].MsgBlock()
+	coinbase = invalid.Transactions[0].Copy()
+	coinbase.TxOut[0].Value *= 2
+	invalid.Transactions = []*wire.MsgTx{coinbase}
+	merkles := blockchain.BuildMerkleTreeStore(
+		[]*btcutil.Tx{btcutil.NewTx(coinbase)}, false)
+	invalid.Header.MerkleRoot = *merkles[len(merkles)-1]
+	managerTestSolve(&invalid.Header, true)
+
+	syncPeer = newManagerTestPeer(t, params, 2)
+	sm = newManagerTestSyncManager(chain, params, syncPeer.Peer)
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg([]*wire.BlockHeader{
+			&invalid.Header,
+		}),
+		peer: syncPeer.Peer,
+	})
+	sm.handleBlockMsg(&blockMsg{block: btcutil.NewBlock(&invalid),
+		peer: syncPeer.Peer})
+	if syncPeer.Connected() {
+		t.Fatal("sync peer leading to an invalid block was not " +
+			"disconnected")
+	}
+	if sm.headerList.Len() != 0 || chain.BestSnapshot().Height != 1 {
+		t.Fatal("sync did not restart")
+	}
+}
+
+// TestReorgTooDeep ensures peers delivering blocks the chain refuses to
+// reorganize to for exceeding the maximum reorg depth are neither rejected nor
+// disconnected, and that the sync stops using the sync peer leading to them.
+func TestReorgTooDeep(t *testing.T) {
+	chain, params := newManagerTestChainReorgDepth(t, 1)
+	for _, block := range managerTestBlocks(t, params, 2) {
+		if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	fork := managerTestBlocksSpaced(t, params, 3, params.TargetTimePerBlock*3)
+
+	// Blocks announced in normal mode.
+	peer := newManagerTestPeer(t, params, 3)
+	sm := newManagerTestSyncManager(chain, params, peer.Peer)
+	sm.headersFirstMode = false
+	state := sm.peerStates[peer.Peer]
+	for _, block := range fork {
+		state.requestedBlocks[*block.Hash()] = struct{}{}
+		sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if !peer.Connected() {
+		t.Fatal("peer sending a deep reorg was disconnected")
+	}
+	peer.expectNoReject(t)
+	if best := chain.BestSnapshot(); best.Height != 2 {
+		t.Fatalf("best height %d, want 2", best.Height)
+	}
+
+	// Blocks for the headers of the sync peer.
+	chain, params = newManagerTestChainReorgDepth(t, 1)
+	for _, block := range managerTestBlocks(t, params, 2) {
+		if _, _, err := chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	peer = newManagerTestPeer(t, params, 3)
+	sm = newManagerTestSyncManager(chain, params, peer.Peer)
+	headers := make([]*wire.BlockHeader, 0, len(fork))
+	for _, block := range fork {
+		headers = append(headers, &block.MsgBlock().Header)
+	}
+	sm.handleHeadersMsg(&headersMsg{
+		headers: managerTestHeadersMsg(headers),
+		peer:    peer.Peer,
+	})
+	if sm.headerList.Len() != len(fork) {
+		t.Fatalf("%d headers queued, want %d", sm.headerList.Len(),
+			len(fork))
+	}
+	for _, block := range fork {
+		sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if !peer.Connected() {
+		t.Fatal("sync peer leading to a deep reorg was disconnected")
+	}
+	peer.expectNoReject(t)
+	if sm.peerStates[peer.Peer].syncCandidate {
+		t.Fatal("sync peer leading to a deep reorg is still a sync " +
+			"candidate")
+	}
+	if sm.syncPeer == peer.Peer || sm.headerList.Len() != 0 {
+		t.Fatal("sync did not stop using the sync peer")
+	}
+}
+
+// TestRejectedTxns ensures rejected transactions are not requested again when
+// announced by the hash they are known to be invalid by, while a witness
+// transaction announced by its hash is still requested since it may be valid
+// with a different witness.
+func TestRejectedTxns(t *testing.T) {
+	chain, params := newManagerTestChain(t)
+	peer := newManagerTestPeer(t, params, 0)
+	sm := newManagerTestSyncManager(chain, params, peer.Peer)
+	sm.headersFirstMode = false
+	sm.txMemPool = mempool.New(&mempool.Config{
+		Policy:        mempool.Policy{MaxTxVersion: wire.TxVersion},
+		ChainParams:   params,
+		FetchUtxoView: chain.FetchUtxoView,
+		BestHeight: func() int32 {
+			return chain.BestSnapshot().Height
+		},
+		MedianTimePast: func() time.Time {
+			return chain.BestSnapshot().MedianTime
+		},
+		IsDeploymentActive: func(uint32) (bool, error) {
+			return true, nil
+		},
+	})
+
+	// Transactions with an unsupported version are rejected as
+	// non-standard.
+	newTx := func(prevHash chainhash.Hash, witness wire.TxWitness) *btcutil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion + 1)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: prevHash},
+			Witness:          witness,
+		})
+		tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+		return btcutil.NewTx(tx)
+	}
+	noWitness := newTx(chainhash.Hash{0x01}, nil)
+	withWitness := newTx(chainhash.Hash{0x02}, wire.TxWitness{{0x01}})
+	for _, tx := range []*btcutil.Tx{noWitness, withWitness} {
+		sm.handleTxMsg(&txMsg{tx: tx, peer: peer.Peer})
+		if _, ok := sm.rejectedTxns[*tx.WitnessHash()]; !ok {
+			t.Fatalf("transaction %v was not rejected", tx.Hash())
+		}
+	}
+
+	// Peers relaying by witness hash announce both by their witness hash.
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeWTx, noWitness.WitnessHash()))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeWTx, withWitness.WitnessHash()))
+	sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	if len(sm.requestedTxns) != 0 {
+		t.Fatal("rejected transaction announced by its witness hash " +
+			"was requested")
+	}
+
+	// Other peers announce both by their hash.
+	txidPeer := newManagerTestPeerVersion(t, params, 0,
+		wire.WTxIdRelayVersion-1)
+	addManagerTestPeer(sm, txidPeer.Peer)
+	sm.syncPeer = txidPeer.Peer
+	inv = wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, noWitness.Hash()))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, withWitness.Hash()))
+	sm.handleInvMsg(&invMsg{inv: inv, peer: txidPeer.Peer})
+	if _, ok := sm.requestedTxns[*noWitness.Hash()]; ok {
+		t.Fatal("rejected transaction without a witness was requested")
+	}
+	if _, ok := sm.requestedTxns[*withWitness.Hash()]; !ok {
+		t.Fatal("witness transaction announced by its hash was not " +
+			"requested")
+	}
+}
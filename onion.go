@@ -0,0 +1,160 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babylonchain-io/bbld/addrmgr"
+	"github.com/babylonchain-io/bbld/torcontrol"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// onionPrivateKeyFilename is the name of the file in the data directory
+	// the private key of the onion service is kept in, so the service is
+	// published under the same onion address across restarts.
+	onionPrivateKeyFilename = "onion_v3_private_key"
+
+	// onionRetryInterval is the initial time to wait before publishing the
+	// onion service again after the Tor control port could not be used or
+	// the connection to it was lost.
+	onionRetryInterval = 5 * time.Second
+
+	// maxOnionRetryInterval is the maximum time to wait before publishing
+	// the onion service again.
+	maxOnionRetryInterval = 5 * time.Minute
+)
+
+// onionServiceTarget returns the address the onion service forwards
+// connections to for the passed listener address.  Listeners on all
+// interfaces are reached over the loopback interface.
+func onionServiceTarget(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil || (ip.IsUnspecified() && ip.To4() != nil):
+		host = "127.0.0.1"
+	case ip.IsUnspecified():
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// loadOnionPrivateKey returns the private key of the onion service stored in
+// the passed file, or an empty string when no key has been stored yet.
+func loadOnionPrivateKey(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// saveOnionPrivateKey stores the private key of the onion service in the
+// passed file, which only the owner is allowed to read.
+func saveOnionPrivateKey(path, privateKey string) error {
+	return ioutil.WriteFile(path, []byte(privateKey+"\n"), 0600)
+}
+
+// publishOnionService authenticates with the Tor control port and creates the
+// onion service of the server, reusing the stored private key when there is
+// one.  The onion address is then advertised to peers.
+func (s *server) publishOnionService(ctrl *torcontrol.Controller) error {
+	if err := ctrl.Authenticate(cfg.TorPassword); err != nil {
+		return err
+	}
+
+	keyPath := filepath.Join(cfg.DataDir, onionPrivateKeyFilename)
+	privateKey, err := loadOnionPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	if err != nil {
+		return err
+	}
+	serviceID, newKey, err := ctrl.AddOnion(privateKey, uint16(port),
+		s.onionTarget)
+	if err != nil {
+		return err
+	}
+	if newKey != privateKey {
+		if err := saveOnionPrivateKey(keyPath, newKey); err != nil {
+			return err
+		}
+	}
+
+	na, err := wire.NewNetAddressV2Host(serviceID+".onion", uint16(port),
+		s.services)
+	if err != nil {
+		return err
+	}
+	err = s.addrManager.AddLocalAddress(na, addrmgr.ManualPrio)
+	if err != nil {
+		return err
+	}
+	srvrLog.Infof("Published onion service %s", addrmgr.NetAddressKey(na))
+	return nil
+}
+
+// onionServiceHandler publishes the onion service of the server through the
+// Tor control port and keeps the control connection open for as long as the
+// server is running, since Tor removes the service once the connection is
+// closed.  The service is published again, with an exponential backoff, when
+// the control port can't be used or the connection to it is lost.
+//
+// It must be run as a goroutine.
+func (s *server) onionServiceHandler() {
+	defer s.wg.Done()
+
+	retryInterval := onionRetryInterval
+	for {
+		ctrl, err := torcontrol.Dial(cfg.TorControl)
+		if err == nil {
+			err = s.publishOnionService(ctrl)
+			if err == nil {
+				retryInterval = onionRetryInterval
+
+				done := make(chan error, 1)
+				go func() {
+					done <- ctrl.Wait()
+				}()
+				select {
+				case err = <-done:
+				case <-s.quit:
+					ctrl.Close()
+					return
+				}
+			}
+			ctrl.Close()
+		}
+
+		srvrLog.Warnf("Onion service unavailable through Tor control "+
+			"port %s: %v -- retrying in %v", cfg.TorControl, err,
+			retryInterval)
+		select {
+		case <-time.After(retryInterval):
+		case <-s.quit:
+			return
+		}
+		retryInterval *= 2
+		if retryInterval > maxOnionRetryInterval {
+			retryInterval = maxOnionRetryInterval
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOnionServiceTarget ensures the onion service forwards to the loopback
+// interface for listeners on all interfaces and to the listen address
+// otherwise.
+func TestOnionServiceTarget(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 8333}, "127.0.0.1:8333"},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 8333}, "[::1]:8333"},
+		{&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 18333}, "10.0.0.1:18333"},
+		{&net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 8333}, "[fd00::1]:8333"},
+	}
+
+	for _, test := range tests {
+		if got := onionServiceTarget(test.addr); got != test.want {
+			t.Errorf("onionServiceTarget(%v): got %s, want %s",
+				test.addr, got, test.want)
+		}
+	}
+}
+
+// TestOnionPrivateKey ensures the private key of the onion service is
+// persisted across restarts.
+func TestOnionPrivateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onion")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, onionPrivateKeyFilename)
+
+	key, err := loadOnionPrivateKey(path)
+	if err != nil || key != "" {
+		t.Fatalf("loadOnionPrivateKey without key: got %q, %v", key, err)
+	}
+
+	const privateKey = "ED25519-V3:c2VjcmV0"
+	if err := saveOnionPrivateKey(path, privateKey); err != nil {
+		t.Fatalf("saveOnionPrivateKey: unexpected error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unable to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected key file permissions %v", info.Mode())
+	}
+
+	key, err = loadOnionPrivateKey(path)
+	if err != nil || key != privateKey {
+		t.Fatalf("loadOnionPrivateKey: got %q, %v", key, err)
+	}
+}
@@ -19,6 +19,7 @@ A quick overview of the major features peer provides are as follows:
  - Provides a basic concurrent safe bitcoin peer for handling bitcoin
    communications via the peer-to-peer protocol
  - Full duplex reading and writing of bitcoin protocol messages
+ - Optional encrypted v2 transport (BIP0324) with fallback to the v1 transport
  - Automatic handling of the initial handshake process including protocol
    version negotiation
  - Asynchronous message queuing of outbound messages with optional channel for
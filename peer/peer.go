@@ -29,7 +29,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// DefaultTrickleInterval is the min time between attempts to send an
 	// inv message to a peer.
@@ -102,6 +102,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -200,6 +203,22 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -286,6 +305,16 @@ type Config struct {
 	// scenarios where the stall behavior isn't important to the system
 	// under test.
 	DisableStallHandler bool
+
+	// MaxSendRate is the maximum average number of bytes per second sent
+	// to the peer.  The messages are paced accordingly.  Zero means the
+	// send rate is not limited.
+	MaxSendRate uint64
+
+	// V2Transport specifies whether the encrypted v2 transport protocol
+	// (BIP0324) is used.  Outbound peers attempt the v2 handshake, while
+	// inbound peers still accept peers using the v1 transport.
+	V2Transport bool
 }
 
 // minUint32 is a helper function to return the minimum of two uint32s.
@@ -298,14 +327,14 @@ func minUint32(a, b uint32) uint32 {
 }
 
 // newNetAddress attempts to extract the IP address and port from the passed
-// net.Addr interface and create a bitcoin NetAddress structure using that
+// net.Addr interface and create a bitcoin NetAddressV2 structure using that
 // information.
-func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress, error) {
+func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddressV2, error) {
 	// addr will be a net.TCPAddr when not using a proxy.
 	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
 		ip := tcpAddr.IP
 		port := uint16(tcpAddr.Port)
-		na := wire.NewNetAddressIPPort(ip, port, services)
+		na := wire.NewNetAddressV2IPPort(ip, port, services)
 		return na, nil
 	}
 
@@ -316,7 +345,7 @@ func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress,
 			ip = net.ParseIP("0.0.0.0")
 		}
 		port := uint16(proxiedAddr.Port)
-		na := wire.NewNetAddressIPPort(ip, port, services)
+		na := wire.NewNetAddressV2IPPort(ip, port, services)
 		return na, nil
 	}
 
@@ -332,7 +361,7 @@ func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress,
 	if err != nil {
 		return nil, err
 	}
-	na := wire.NewNetAddressIPPort(ip, uint16(port), services)
+	na := wire.NewNetAddressV2IPPort(ip, uint16(port), services)
 	return na, nil
 }
 
@@ -397,12 +426,12 @@ type StatsSnap struct {
 type HashFunc func() (hash *chainhash.Hash, height int32, err error)
 
 // AddrFunc is a func which takes an address and returns a related address.
-type AddrFunc func(remoteAddr *wire.NetAddress) *wire.NetAddress
+type AddrFunc func(remoteAddr *wire.NetAddressV2) *wire.NetAddressV2
 
 // HostToNetAddrFunc is a func which takes a host, port, services and returns
 // the netaddress.
 type HostToNetAddrFunc func(host string, port uint16,
-	services wire.ServiceFlag) (*wire.NetAddress, error)
+	services wire.ServiceFlag) (*wire.NetAddressV2, error)
 
 // NOTE: The overall data flow of a peer is split into 3 goroutines.  Inbound
 // messages are read via the inHandler goroutine and generally dispatched to
@@ -441,6 +470,13 @@ type Peer struct {
 
 	conn net.Conn
 
+	// These fields are set during the transport negotiation and never
+	// modified afterwards.  The connReader field is used to read messages
+	// of peers using the v1 transport, while v2 is only set for peers using
+	// the v2 transport.
+	connReader io.Reader
+	v2         *v2Transport
+
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
 	addr    string
@@ -448,7 +484,7 @@ type Peer struct {
 	inbound bool
 
 	flagsMtx             sync.Mutex // protects the peer flags below
-	na                   *wire.NetAddress
+	na                   *wire.NetAddressV2
 	id                   int32
 	userAgent            string
 	services             wire.ServiceFlag
@@ -456,8 +492,13 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
+	wtxidRelay           bool   // peer sent a wtxidrelay message
+	sendCmpct            bool   // peer sent a supported sendcmpct message
+	cmpctHighBandwidth   bool   // peer wants cmpctblock announcements
 	verAckReceived       bool
 	witnessEnabled       bool
+	v2Rejected           bool // v2 handshake got no response
 
 	wireEncoding wire.MessageEncoding
 
@@ -535,6 +576,12 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is already known to
+// the peer.
+func (p *Peer) IsKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Contains(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -588,7 +635,7 @@ func (p *Peer) ID() int32 {
 // NA returns the peer network address.
 //
 // This function is safe for concurrent access.
-func (p *Peer) NA() *wire.NetAddress {
+func (p *Peer) NA() *wire.NetAddressV2 {
 	p.flagsMtx.Lock()
 	na := p.na
 	p.flagsMtx.Unlock()
@@ -811,6 +858,56 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsAddrV2 returns if the peer supports addrv2 messages instead of the
+// legacy addr messages (BIP0155).
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	sendAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return sendAddrV2
+}
+
+// WantsWTxIdRelay returns if the peer announces and requests transactions by
+// their witness hash using MSG_WTX inventory vectors instead of their hash
+// (BIP0339).
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsWTxIdRelay() bool {
+	p.flagsMtx.Lock()
+	wtxidRelay := p.wtxidRelay
+	p.flagsMtx.Unlock()
+
+	return wtxidRelay
+}
+
+// WantsCmpctBlocks returns if the peer signaled support for compact blocks of
+// the version supported by the wire package (BIP0152).
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	sendCmpct := p.sendCmpct
+	p.flagsMtx.Unlock()
+
+	return sendCmpct
+}
+
+// WantsCmpctBlockAnnouncements returns if the peer wants new blocks to be
+// announced directly with cmpctblock messages instead of inventory vectors or
+// headers, which is known as high-bandwidth mode (BIP0152).
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlockAnnouncements() bool {
+	p.flagsMtx.Lock()
+	highBandwidth := p.sendCmpct && p.cmpctHighBandwidth
+	p.flagsMtx.Unlock()
+
+	return highBandwidth
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -859,6 +956,41 @@ func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, er
 	return msg.AddrList, nil
 }
 
+// PushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.  It is the counterpart of PushAddrMsg for peers that
+// signaled support for addrv2 messages, which is reported by WantsAddrV2.  It
+// returns the addresses that were actually sent and no message will be sent
+// if there are no entries in the provided addresses slice.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PushAddrV2Msg(addresses []*wire.NetAddressV2) []*wire.NetAddressV2 {
+	addressCount := len(addresses)
+
+	// Nothing to send.
+	if addressCount == 0 {
+		return nil
+	}
+
+	msg := wire.NewMsgAddrV2()
+	msg.AddrList = make([]*wire.NetAddressV2, addressCount)
+	copy(msg.AddrList, addresses)
+
+	// Randomize the addresses sent if there are more than the maximum allowed.
+	if addressCount > wire.MaxV2AddrPerMsg {
+		// Shuffle the address list.
+		for i := 0; i < wire.MaxV2AddrPerMsg; i++ {
+			j := i + rand.Intn(addressCount-i)
+			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+		}
+
+		// Truncate it to the maximum size.
+		msg.AddrList = msg.AddrList[:wire.MaxV2AddrPerMsg]
+	}
+
+	p.QueueMessage(msg, nil)
+	return msg.AddrList
+}
+
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
 // and stop hash.  It will ignore back-to-back duplicate requests.
 //
@@ -1021,8 +1153,17 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	var n int
+	var msg wire.Message
+	var buf []byte
+	var err error
+	if p.v2 != nil {
+		n, msg, buf, err = p.v2.readMessage(p.ProtocolVersion(),
+			encoding)
+	} else {
+		n, msg, buf, err = wire.ReadMessageWithEncodingN(p.connReader,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	}
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
@@ -1084,8 +1225,14 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	var n int
+	var err error
+	if p.v2 != nil {
+		n, err = p.v2.writeMessage(msg, p.ProtocolVersion(), enc)
+	} else {
+		n, err = wire.WriteMessageWithEncodingN(p.conn, msg,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
@@ -1168,12 +1315,19 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[wire.CmdInv] = deadline
 
 	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
+		// Expects a block, cmpctblock, merkleblock, tx, or notfound
+		// message.
 		pendingResponses[wire.CmdBlock] = deadline
+		pendingResponses[wire.CmdCmpctBlock] = deadline
 		pendingResponses[wire.CmdMerkleBlock] = deadline
 		pendingResponses[wire.CmdTx] = deadline
 		pendingResponses[wire.CmdNotFound] = deadline
 
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message, or a block message when the
+		// remote peer chooses to send the full block instead.
+		pendingResponses[wire.CmdBlockTxn] = deadline
+
 	case wire.CmdGetHeaders:
 		// Expects a headers message.  Use a longer deadline since it
 		// can take a while for the remote peer to load all of the
@@ -1231,12 +1385,18 @@ out:
 				switch msgCmd := msg.message.Command(); msgCmd {
 				case wire.CmdBlock:
 					fallthrough
+				case wire.CmdCmpctBlock:
+					fallthrough
+				case wire.CmdBlockTxn:
+					fallthrough
 				case wire.CmdMerkleBlock:
 					fallthrough
 				case wire.CmdTx:
 					fallthrough
 				case wire.CmdNotFound:
 					delete(pendingResponses, wire.CmdBlock)
+					delete(pendingResponses, wire.CmdCmpctBlock)
+					delete(pendingResponses, wire.CmdBlockTxn)
 					delete(pendingResponses, wire.CmdMerkleBlock)
 					delete(pendingResponses, wire.CmdTx)
 					delete(pendingResponses, wire.CmdNotFound)
@@ -1356,6 +1516,14 @@ out:
 		// needed.
 		rmsg, buf, err := p.readMessage(p.wireEncoding)
 		idleTimer.Stop()
+
+		// Messages with unknown commands are ignored so that peers
+		// may use protocol extensions this package doesn't know about.
+		if errors.Is(err, wire.ErrUnknownMessage) {
+			log.Debugf("Ignoring unknown message from %s: %v", p, err)
+			idleTimer.Reset(idleTimeout)
+			continue
+		}
 		if err != nil {
 			// In order to allow regression tests with malformed messages, don't
 			// disconnect the peer when we're in regression test mode and the
@@ -1412,11 +1580,30 @@ out:
 				p.cfg.Listeners.OnGetAddr(p, msg)
 			}
 
+		case *wire.MsgSendAddrV2:
+			// The sendaddrv2 message is only allowed before the
+			// verack message.
+			p.PushRejectMsg(msg.Command(), wire.RejectInvalid,
+				"sendaddrv2 message after verack", nil, true)
+			break out
+
+		case *wire.MsgWTxIdRelay:
+			// The wtxidrelay message is only allowed before the
+			// verack message.
+			p.PushRejectMsg(msg.Command(), wire.RejectInvalid,
+				"wtxidrelay message after verack", nil, true)
+			break out
+
 		case *wire.MsgAddr:
 			if p.cfg.Listeners.OnAddr != nil {
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1548,6 +1735,35 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			// Only compact blocks of the supported version are
+			// relayed, so ignore announcements of other versions.
+			if msg.CmpctBlockVersion == wire.CmpctBlockVersion {
+				p.flagsMtx.Lock()
+				p.sendCmpct = true
+				p.cmpctHighBandwidth = msg.AnnounceUsingCmpctBlock
+				p.flagsMtx.Unlock()
+			}
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1749,6 +1965,11 @@ out:
 
 			p.stallControl <- stallControlMsg{sccSendMessage, msg.msg}
 
+			// Only the output handler writes messages at this
+			// point, so the bytes written for the message are the
+			// change of the bytes sent to the peer.
+			start := time.Now()
+			bytesSent := atomic.LoadUint64(&p.bytesSent)
 			err := p.writeMessage(msg.msg, msg.encoding)
 			if err != nil {
 				p.Disconnect()
@@ -1771,6 +1992,10 @@ out:
 			if msg.doneChan != nil {
 				msg.doneChan <- struct{}{}
 			}
+			if p.cfg.MaxSendRate != 0 {
+				p.paceSend(start, atomic.LoadUint64(&p.bytesSent)-
+					bytesSent)
+			}
 			p.sendDoneQueue <- struct{}{}
 
 		case <-p.quit:
@@ -1800,6 +2025,25 @@ cleanup:
 	log.Tracef("Peer output handler done for %s", p)
 }
 
+// paceSend waits until the passed number of bytes, which started to be sent at
+// the passed time, would have been sent at the maximum send rate of the peer,
+// which keeps the average send rate below the maximum.  It returns early when
+// the peer is disconnected.
+func (p *Peer) paceSend(start time.Time, n uint64) {
+	d := time.Duration(n * uint64(time.Second) / p.cfg.MaxSendRate)
+	wait := time.Until(start.Add(d))
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.quit:
+	}
+}
+
 // pingHandler periodically pings the peer.  It must be run as a goroutine.
 func (p *Peer) pingHandler() {
 	pingTicker := time.NewTicker(pingInterval)
@@ -1994,38 +2238,87 @@ func (p *Peer) readRemoteVersionMsg() error {
 	return nil
 }
 
-// readRemoteVerAckMsg waits for the next message to arrive from the remote
-// peer. If this message is not a verack message, then an error is returned.
-// This method is to be used as part of the version negotiation upon a new
-// connection.
+// readRemoteVerAckMsg waits for the verack message to arrive from the remote
+// peer.  The only other messages that may precede it are sendaddrv2 messages
+// and messages with unknown commands, which are ignored.  If any other message
+// arrives, then an error is returned.  This method is to be used as part of
+// the version negotiation upon a new connection.
 func (p *Peer) readRemoteVerAckMsg() error {
-	// Read the next message from the wire.
-	remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
-	if err != nil {
-		return err
+	for {
+		// Read the next message from the wire.
+		remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
+		if errors.Is(err, wire.ErrUnknownMessage) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg := remoteMsg.(type) {
+		case *wire.MsgSendAddrV2:
+			// Peers signal support for addrv2 messages before the
+			// verack message if they speak a recent enough
+			// protocol version.
+			if p.ProtocolVersion() >= wire.AddrV2Version {
+				p.flagsMtx.Lock()
+				p.sendAddrV2 = true
+				p.flagsMtx.Unlock()
+			}
+
+		case *wire.MsgWTxIdRelay:
+			// Peers signal that they relay transactions by their
+			// witness hash before the verack message if they speak
+			// a recent enough protocol version.
+			if p.ProtocolVersion() >= wire.WTxIdRelayVersion {
+				p.flagsMtx.Lock()
+				p.wtxidRelay = true
+				p.flagsMtx.Unlock()
+			}
+
+		case *wire.MsgVerAck:
+			p.flagsMtx.Lock()
+			p.verAckReceived = true
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnVerAck != nil {
+				p.cfg.Listeners.OnVerAck(p, msg)
+			}
+
+			return nil
+
+		default:
+			// It should be a verack message, otherwise send a
+			// reject message to the peer explaining why.
+			reason := "a verack message must follow version"
+			rejectMsg := wire.NewMsgReject(
+				msg.Command(), wire.RejectMalformed, reason,
+			)
+			_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
+			return errors.New(reason)
+		}
 	}
+}
 
-	// It should be a verack message, otherwise send a reject message to the
-	// peer explaining why.
-	msg, ok := remoteMsg.(*wire.MsgVerAck)
-	if !ok {
-		reason := "a verack message must follow version"
-		rejectMsg := wire.NewMsgReject(
-			msg.Command(), wire.RejectMalformed, reason,
-		)
-		_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
-		return errors.New(reason)
+// writeWTxIdRelayMsg signals to the remote peer that transactions are relayed
+// by their witness hash when the negotiated protocol version supports it.  It
+// must be sent after the version message and before the verack message.
+func (p *Peer) writeWTxIdRelayMsg() error {
+	if p.ProtocolVersion() < wire.WTxIdRelayVersion {
+		return nil
 	}
 
-	p.flagsMtx.Lock()
-	p.verAckReceived = true
-	p.flagsMtx.Unlock()
+	return p.writeMessage(wire.NewMsgWTxIdRelay(), wire.LatestEncoding)
+}
 
-	if p.cfg.Listeners.OnVerAck != nil {
-		p.cfg.Listeners.OnVerAck(p, msg)
+// writeSendAddrV2Msg signals support for addrv2 messages to the remote peer
+// when the negotiated protocol version supports them.  It must be sent after
+// the version message and before the verack message.
+func (p *Peer) writeSendAddrV2Msg() error {
+	if p.ProtocolVersion() < wire.AddrV2Version {
+		return nil
 	}
 
-	return nil
+	return p.writeMessage(wire.NewMsgSendAddrV2(), wire.LatestEncoding)
 }
 
 // localVersionMsg creates a version message that can be used to send to the
@@ -2040,7 +2333,13 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 		}
 	}
 
-	theirNA := p.na
+	// The version message is only able to carry legacy addresses, so an
+	// unroutable address is used for peers which don't have one, such as
+	// Tor v3 onion services.
+	theirNA := p.na.ToLegacy()
+	if theirNA == nil {
+		theirNA = wire.NewNetAddressIPPort(net.IPv4zero, 0, p.na.Services)
+	}
 
 	// If we are behind a proxy and the connection comes from the proxy then
 	// we return an unroutable address as their address. This is to prevent
@@ -2048,7 +2347,7 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 	if p.cfg.Proxy != "" {
 		proxyaddress, _, err := net.SplitHostPort(p.cfg.Proxy)
 		// invalid proxy means poorly configured, be on the safe side.
-		if err != nil || p.na.IP.String() == proxyaddress {
+		if err != nil || p.na.Host() == proxyaddress {
 			theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}), 0,
 				theirNA.Services)
 		}
@@ -2106,8 +2405,10 @@ func (p *Peer) writeLocalVersionMsg() error {
 //
 //   1. Remote peer sends their version.
 //   2. We send our version.
-//   3. We send our verack.
-//   4. Remote peer sends their verack.
+//   3. We send wtxidrelay and sendaddrv2 if their version supports them.
+//   4. We send our verack.
+//   5. Remote peer sends their verack, optionally preceded by wtxidrelay and
+//      sendaddrv2.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
@@ -2117,6 +2418,14 @@ func (p *Peer) negotiateInboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeWTxIdRelayMsg(); err != nil {
+		return err
+	}
+
+	if err := p.writeSendAddrV2Msg(); err != nil {
+		return err
+	}
+
 	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 	if err != nil {
 		return err
@@ -2131,8 +2440,10 @@ func (p *Peer) negotiateInboundProtocol() error {
 //
 //   1. We send our version.
 //   2. Remote peer sends their version.
-//   3. Remote peer sends their verack.
-//   4. We send our verack.
+//   3. Remote peer sends their verack, optionally preceded by wtxidrelay and
+//      sendaddrv2.
+//   4. We send wtxidrelay and sendaddrv2 if their version supports them.
+//   5. We send our verack.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
@@ -2146,15 +2457,87 @@ func (p *Peer) negotiateOutboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeWTxIdRelayMsg(); err != nil {
+		return err
+	}
+
+	if err := p.writeSendAddrV2Msg(); err != nil {
+		return err
+	}
+
 	return p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 }
 
+// negotiateTransport selects the transport protocol used with the peer.
+// Outbound peers perform the v2 handshake when the v2 transport is enabled.
+// Inbound peers perform it unless the peer starts sending a version message
+// with the v1 transport, in which case the v1 transport is used.
+func (p *Peer) negotiateTransport() error {
+	p.connReader = p.conn
+	if !p.cfg.V2Transport {
+		return nil
+	}
+
+	var received []byte
+	if p.inbound {
+		received = make([]byte, v1PrefixSize)
+		n, err := io.ReadFull(p.conn, received)
+		atomic.AddUint64(&p.bytesReceived, uint64(n))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(received, v1Prefix(p.cfg.ChainParams.Net)) {
+			p.connReader = io.MultiReader(bytes.NewReader(received),
+				p.conn)
+			return nil
+		}
+	}
+
+	t := newV2Transport(p.conn, p.cfg.ChainParams.Net, received)
+	err := t.handshake(!p.inbound)
+	atomic.AddUint64(&p.bytesReceived, uint64(t.bytesRead-len(received)))
+	atomic.AddUint64(&p.bytesSent, uint64(t.bytesWritten))
+	if err != nil {
+		// Peers which don't support the v2 transport close the
+		// connection without sending anything since they fail to parse
+		// the public key as a v1 message header.
+		if !p.inbound && t.bytesRead == 0 {
+			p.flagsMtx.Lock()
+			p.v2Rejected = true
+			p.flagsMtx.Unlock()
+		}
+		return err
+	}
+	p.v2 = t
+
+	log.Debugf("Using v2 transport with %s (session id %x)", p,
+		t.cipher.sessionID)
+	return nil
+}
+
+// V2TransportRejected returns whether the peer is outbound and closed the
+// connection without responding to the v2 handshake, which means it likely
+// only supports the v1 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2TransportRejected() bool {
+	p.flagsMtx.Lock()
+	rejected := p.v2Rejected
+	p.flagsMtx.Unlock()
+
+	return rejected
+}
+
 // start begins processing input and output messages.
 func (p *Peer) start() error {
 	log.Tracef("Starting peer %s", p)
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -2297,7 +2680,7 @@ func NewOutboundPeer(cfg *Config, addr string) (*Peer, error) {
 		}
 		p.na = na
 	} else {
-		p.na = wire.NewNetAddressIPPort(net.ParseIP(host), uint16(port), 0)
+		p.na = wire.NewNetAddressV2IPPort(net.ParseIP(host), uint16(port), 0)
 	}
 
 	return p, nil
@@ -110,6 +110,7 @@ type peerStats struct {
 	wantBytesSent       uint64
 	wantBytesReceived   uint64
 	wantWitnessEnabled  bool
+	wantAddrV2          bool
 }
 
 // testPeer tests the given peer's flags and stats
@@ -193,6 +194,12 @@ func testPeer(t *testing.T, p *peer.Peer, s peerStats) {
 		return
 	}
 
+	if p.WantsAddrV2() != s.wantAddrV2 {
+		t.Errorf("testPeer: wrong WantsAddrV2 - got %v, want %v",
+			p.WantsAddrV2(), s.wantAddrV2)
+		return
+	}
+
 	stats := p.StatsSnapshot()
 
 	if p.ID() != stats.ID {
@@ -356,6 +363,84 @@ func TestPeerConnection(t *testing.T) {
 	}
 }
 
+// TestPeerAddrV2 tests that peers speaking a recent enough protocol version
+// signal support for addrv2 messages and wtxid relay during the handshake.
+func TestPeerAddrV2(t *testing.T) {
+	tests := []struct {
+		name           string
+		pver           uint32
+		wantAddrV2     bool
+		wantWTxIdRelay bool
+	}{
+		{"latest protocol version", wire.AddrV2Version, true, true},
+		{"before addrv2", wire.FeeFilterVersion, false, false},
+	}
+
+	for _, test := range tests {
+		verack := make(chan struct{}, 4)
+		inCfg := &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			ChainParams:     &chaincfg.MainNetParams,
+			ProtocolVersion: test.pver,
+			TrickleInterval: time.Second * 10,
+			AllowSelfConns:  true,
+		}
+		outCfg := *inCfg
+		outCfg.ProtocolVersion = 0
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+
+		outPeer, err := peer.NewOutboundPeer(&outCfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err %v", test.name,
+				err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+
+		if inPeer.WantsAddrV2() != test.wantAddrV2 {
+			t.Errorf("%s: mismatched inbound addrv2 -- got %v, want %v",
+				test.name, inPeer.WantsAddrV2(), test.wantAddrV2)
+		}
+		if outPeer.WantsAddrV2() != test.wantAddrV2 {
+			t.Errorf("%s: mismatched outbound addrv2 -- got %v, "+
+				"want %v", test.name, outPeer.WantsAddrV2(),
+				test.wantAddrV2)
+		}
+		if inPeer.WantsWTxIdRelay() != test.wantWTxIdRelay {
+			t.Errorf("%s: mismatched inbound wtxidrelay -- got %v, "+
+				"want %v", test.name, inPeer.WantsWTxIdRelay(),
+				test.wantWTxIdRelay)
+		}
+		if outPeer.WantsWTxIdRelay() != test.wantWTxIdRelay {
+			t.Errorf("%s: mismatched outbound wtxidrelay -- got %v, "+
+				"want %v", test.name, outPeer.WantsWTxIdRelay(),
+				test.wantWTxIdRelay)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
+
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
@@ -368,6 +453,9 @@ func TestPeerListeners(t *testing.T) {
 			OnAddr: func(p *peer.Peer, msg *wire.MsgAddr) {
 				ok <- msg
 			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				ok <- msg
+			},
 			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
 				ok <- msg
 			},
@@ -450,6 +538,18 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
 		},
 		UserAgentName:     "peer",
 		UserAgentVersion:  "1.0",
@@ -499,6 +599,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnAddr",
 			wire.NewMsgAddr(),
 		},
+		{
+			"OnAddrV2",
+			wire.NewMsgAddrV2(),
+		},
 		{
 			"OnPing",
 			wire.NewMsgPing(42),
@@ -604,6 +708,23 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(true, wire.CmpctBlockVersion),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(wire.NewBlockHeader(1,
+				&chainhash.Hash{}, &chainhash.Hash{}, 1, 1), 1),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -616,6 +737,11 @@ func TestPeerListeners(t *testing.T) {
 			return
 		}
 	}
+
+	// The sendcmpct message must have been recorded by the receiving peer.
+	if !inPeer.WantsCmpctBlocks() || !inPeer.WantsCmpctBlockAnnouncements() {
+		t.Errorf("TestPeerListeners: sendcmpct message not recorded")
+	}
 	inPeer.Disconnect()
 	outPeer.Disconnect()
 }
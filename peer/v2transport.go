@@ -0,0 +1,516 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/ellswift"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/poly1305"
+)
+
+const (
+	// v2GarbageTerminatorSize is the size of the garbage terminators which
+	// end the garbage sent during the v2 handshake.
+	v2GarbageTerminatorSize = 16
+
+	// v2MaxGarbageSize is the maximum size of the garbage sent after the
+	// public key during the v2 handshake.
+	v2MaxGarbageSize = 4095
+
+	// v2LengthFieldSize is the size of the encrypted length field of v2
+	// packets.
+	v2LengthFieldSize = 3
+
+	// v2HeaderSize is the size of the encrypted header of v2 packets, which
+	// holds the ignore bit.
+	v2HeaderSize = 1
+
+	// v2IgnoreBit is the bit of the header of v2 packets which marks decoy
+	// packets that must be ignored.
+	v2IgnoreBit = 1 << 7
+
+	// v2Expansion is the number of bytes v2 packets are longer than their
+	// contents.
+	v2Expansion = v2LengthFieldSize + v2HeaderSize + poly1305.TagSize
+
+	// v2RekeyInterval is the number of messages after which the ciphers of
+	// the v2 transport are rekeyed.
+	v2RekeyInterval = 224
+
+	// v1PrefixSize is the size of the prefix of the version message sent by
+	// peers using the v1 transport, which inbound peers using the v2
+	// transport are told apart from.
+	v1PrefixSize = 16
+)
+
+var (
+	// v2SharedSecretTag is the tag of the tagged hash the ECDH secret of
+	// the v2 handshake is derived with.
+	v2SharedSecretTag = []byte("bip324_ellswift_xonly_ecdh")
+
+	// v2SaltPrefix is the prefix of the salt the keys of the v2 transport
+	// are derived with, followed by the network magic.
+	v2SaltPrefix = []byte("bitcoin_v2_shared_secret")
+
+	// errV2Authentication is returned when a v2 packet fails to
+	// authenticate.
+	errV2Authentication = errors.New("v2 packet authentication failed")
+)
+
+// chacha20Poly1305Tag returns the Poly1305 tag of the AEAD_CHACHA20_POLY1305
+// construction of RFC 8439 for the passed additional data and ciphertext.
+func chacha20Poly1305Tag(polyKey *[32]byte, aad, ciphertext []byte) [poly1305.TagSize]byte {
+	var padding [16]byte
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(aad)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+
+	mac := poly1305.New(polyKey)
+	mac.Write(aad)
+	mac.Write(padding[:(16-len(aad)%16)%16])
+	mac.Write(ciphertext)
+	mac.Write(padding[:(16-len(ciphertext)%16)%16])
+	mac.Write(lengths[:])
+
+	var tag [poly1305.TagSize]byte
+	mac.Sum(tag[:0])
+	return tag
+}
+
+// chacha20Poly1305 encrypts or decrypts the passed text in place with the
+// AEAD_CHACHA20_POLY1305 construction of RFC 8439 and returns the tag of the
+// ciphertext.
+func chacha20Poly1305(key, nonce []byte, aad, text []byte, decrypt bool) [poly1305.TagSize]byte {
+	c, err := chacha20.NewUnauthenticatedCipher(key, nonce)
+	if err != nil {
+		// The key and nonce sizes are fixed.
+		panic(err)
+	}
+
+	// The Poly1305 key is the start of the first block of the key stream
+	// and the text is encrypted with the following blocks.
+	var block [64]byte
+	c.XORKeyStream(block[:], block[:])
+	var polyKey [32]byte
+	copy(polyKey[:], block[:32])
+
+	if decrypt {
+		tag := chacha20Poly1305Tag(&polyKey, aad, text)
+		c.XORKeyStream(text, text)
+		return tag
+	}
+	c.XORKeyStream(text, text)
+	return chacha20Poly1305Tag(&polyKey, aad, text)
+}
+
+// fsChaCha20 is the ChaCha20 stream cipher the lengths of v2 packets are
+// encrypted with.  It is rekeyed with its own key stream every v2RekeyInterval
+// lengths for forward secrecy.
+type fsChaCha20 struct {
+	cipher       *chacha20.Cipher
+	chunkCounter uint64
+	rekeyCounter uint64
+}
+
+// newFSChaCha20 returns a length cipher with the passed initial key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	f := &fsChaCha20{}
+	f.setKey(key)
+	return f
+}
+
+// setKey starts the key stream of the passed key for the current rekey
+// counter.
+func (f *fsChaCha20) setKey(key []byte) {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], f.rekeyCounter)
+	c, err := chacha20.NewUnauthenticatedCipher(key, nonce[:])
+	if err != nil {
+		// The key and nonce sizes are fixed.
+		panic(err)
+	}
+	f.cipher = c
+}
+
+// crypt encrypts or decrypts the passed chunk in place.
+func (f *fsChaCha20) crypt(chunk []byte) {
+	f.cipher.XORKeyStream(chunk, chunk)
+	f.chunkCounter++
+	if f.chunkCounter%v2RekeyInterval == 0 {
+		var key [chacha20.KeySize]byte
+		f.cipher.XORKeyStream(key[:], key[:])
+		f.rekeyCounter++
+		f.setKey(key[:])
+	}
+}
+
+// fsChaCha20Poly1305 is the ChaCha20-Poly1305 AEAD the headers and contents of
+// v2 packets are encrypted with.  It is rekeyed every v2RekeyInterval packets
+// for forward secrecy.
+type fsChaCha20Poly1305 struct {
+	key           [chacha20.KeySize]byte
+	packetCounter uint64
+}
+
+// nonce returns the nonce of the current packet.
+func (f *fsChaCha20Poly1305) nonce() []byte {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:4],
+		uint32(f.packetCounter%v2RekeyInterval))
+	binary.LittleEndian.PutUint64(nonce[4:], f.packetCounter/v2RekeyInterval)
+	return nonce[:]
+}
+
+// next moves on to the next packet, rekeying the AEAD when the rekey interval
+// is over.
+func (f *fsChaCha20Poly1305) next() {
+	if (f.packetCounter+1)%v2RekeyInterval == 0 {
+		var nonce [chacha20.NonceSize]byte
+		binary.LittleEndian.PutUint32(nonce[:4], 0xffffffff)
+		binary.LittleEndian.PutUint64(nonce[4:],
+			f.packetCounter/v2RekeyInterval)
+		var key [chacha20.KeySize]byte
+		chacha20Poly1305(f.key[:], nonce[:], nil, key[:], false)
+		f.key = key
+	}
+	f.packetCounter++
+}
+
+// seal returns the encryption of the passed plaintext followed by the tag
+// authenticating it along with the passed additional data.
+func (f *fsChaCha20Poly1305) seal(aad, plaintext []byte) []byte {
+	out := make([]byte, len(plaintext), len(plaintext)+poly1305.TagSize)
+	copy(out, plaintext)
+	tag := chacha20Poly1305(f.key[:], f.nonce(), aad, out, false)
+	f.next()
+	return append(out, tag[:]...)
+}
+
+// open authenticates and decrypts the passed ciphertext followed by its tag
+// in place and returns the plaintext.
+func (f *fsChaCha20Poly1305) open(aad, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < poly1305.TagSize {
+		return nil, errV2Authentication
+	}
+	split := len(ciphertext) - poly1305.TagSize
+	text, expected := ciphertext[:split], ciphertext[split:]
+	tag := chacha20Poly1305(f.key[:], f.nonce(), aad, text, true)
+	f.next()
+	if subtle.ConstantTimeCompare(tag[:], expected) != 1 {
+		return nil, errV2Authentication
+	}
+	return text, nil
+}
+
+// v2Cipher holds the ciphers and secrets of a v2 transport session.
+type v2Cipher struct {
+	sendL *fsChaCha20
+	sendP *fsChaCha20Poly1305
+	recvL *fsChaCha20
+	recvP *fsChaCha20Poly1305
+
+	sessionID             [32]byte
+	sendGarbageTerminator [v2GarbageTerminatorSize]byte
+	recvGarbageTerminator [v2GarbageTerminatorSize]byte
+}
+
+// newV2Cipher derives the ciphers and secrets of a v2 transport session on the
+// passed network from the passed private key, its ElligatorSwift encoded
+// public key, and the encoded public key of the remote peer.
+func newV2Cipher(privKey *btcec.PrivateKey, ours, theirs [ellswift.EncodedSize]byte,
+	initiator bool, btcnet wire.BitcoinNet) *v2Cipher {
+
+	// The shared secret commits to the public keys of the initiator and
+	// the responder, in that order.
+	xShared := ellswift.XOnlyECDH(privKey, theirs)
+	initiatorKey, responderKey := ours, theirs
+	if !initiator {
+		initiatorKey, responderKey = theirs, ours
+	}
+	secret := chainhash.TaggedHash(v2SharedSecretTag, initiatorKey[:],
+		responderKey[:], xShared[:])
+
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(btcnet))
+	salt := append(append([]byte{}, v2SaltPrefix...), magic[:]...)
+	prk := hkdf.Extract(sha256.New, secret[:], salt)
+	expand := func(info string, out []byte) {
+		// Reading less than 255 hashes from HKDF can't fail.
+		io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(info)), out)
+	}
+
+	var initiatorL, initiatorP, responderL, responderP [32]byte
+	var garbageTerminators [2 * v2GarbageTerminatorSize]byte
+	var c v2Cipher
+	expand("initiator_L", initiatorL[:])
+	expand("initiator_P", initiatorP[:])
+	expand("responder_L", responderL[:])
+	expand("responder_P", responderP[:])
+	expand("garbage_terminators", garbageTerminators[:])
+	expand("session_id", c.sessionID[:])
+
+	sendL, sendP, recvL, recvP := initiatorL, initiatorP, responderL, responderP
+	sendTerminator := garbageTerminators[:v2GarbageTerminatorSize]
+	recvTerminator := garbageTerminators[v2GarbageTerminatorSize:]
+	if !initiator {
+		sendL, sendP, recvL, recvP = recvL, recvP, sendL, sendP
+		sendTerminator, recvTerminator = recvTerminator, sendTerminator
+	}
+	c.sendL = newFSChaCha20(sendL[:])
+	c.sendP = &fsChaCha20Poly1305{key: sendP}
+	c.recvL = newFSChaCha20(recvL[:])
+	c.recvP = &fsChaCha20Poly1305{key: recvP}
+	copy(c.sendGarbageTerminator[:], sendTerminator)
+	copy(c.recvGarbageTerminator[:], recvTerminator)
+	return &c
+}
+
+// encrypt returns the v2 packet which carries the passed contents and
+// authenticates the passed additional data.  Decoy packets are marked with
+// the ignore flag.
+func (c *v2Cipher) encrypt(contents, aad []byte, ignore bool) []byte {
+	var length [v2LengthFieldSize]byte
+	length[0] = byte(len(contents))
+	length[1] = byte(len(contents) >> 8)
+	length[2] = byte(len(contents) >> 16)
+	c.sendL.crypt(length[:])
+
+	plaintext := make([]byte, v2HeaderSize+len(contents))
+	if ignore {
+		plaintext[0] = v2IgnoreBit
+	}
+	copy(plaintext[v2HeaderSize:], contents)
+
+	return append(length[:], c.sendP.seal(aad, plaintext)...)
+}
+
+// decryptLength decrypts the passed length field of a v2 packet and returns the
+// size of its contents.
+func (c *v2Cipher) decryptLength(length [v2LengthFieldSize]byte) int {
+	c.recvL.crypt(length[:])
+	return int(length[0]) | int(length[1])<<8 | int(length[2])<<16
+}
+
+// decrypt authenticates and decrypts the passed v2 packet without its length
+// field along with the passed additional data and returns its contents and
+// whether it is a decoy packet.
+func (c *v2Cipher) decrypt(packet, aad []byte) ([]byte, bool, error) {
+	plaintext, err := c.recvP.open(aad, packet)
+	if err != nil {
+		return nil, false, err
+	}
+	ignore := plaintext[0]&v2IgnoreBit != 0
+	return plaintext[v2HeaderSize:], ignore, nil
+}
+
+// v1Prefix returns the prefix of the version message sent by peers using the
+// v1 transport on the passed network, which consists of the network magic and
+// the version command.
+func v1Prefix(btcnet wire.BitcoinNet) []byte {
+	prefix := make([]byte, v1PrefixSize)
+	binary.LittleEndian.PutUint32(prefix[:4], uint32(btcnet))
+	copy(prefix[4:], wire.CmdVersion)
+	return prefix
+}
+
+// v2Transport sends and receives messages over a connection using the
+// encrypted v2 transport protocol (BIP0324).
+type v2Transport struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	btcnet wire.BitcoinNet
+	cipher *v2Cipher
+
+	// bytesRead and bytesWritten count the bytes transferred during the
+	// handshake.
+	bytesRead    int
+	bytesWritten int
+}
+
+// newV2Transport returns a v2 transport over the passed connection on the
+// passed network.  The received bytes are the start of the handshake already
+// read from the connection.
+func newV2Transport(conn net.Conn, btcnet wire.BitcoinNet, received []byte) *v2Transport {
+	return &v2Transport{
+		conn:   conn,
+		r:      bufio.NewReader(io.MultiReader(bytes.NewReader(received), conn)),
+		btcnet: btcnet,
+	}
+}
+
+// write writes the passed bytes to the connection during the handshake.
+func (t *v2Transport) write(b []byte) error {
+	n, err := t.conn.Write(b)
+	t.bytesWritten += n
+	return err
+}
+
+// read reads the passed number of bytes from the connection during the
+// handshake.
+func (t *v2Transport) read(n int) ([]byte, error) {
+	b := make([]byte, n)
+	n, err := io.ReadFull(t.r, b)
+	t.bytesRead += n
+	return b, err
+}
+
+// handshake performs the v2 handshake as the initiator or the responder of the
+// connection.  The public keys are exchanged first, each followed by random
+// garbage.  Then each side sends its garbage terminator followed by its
+// version packet, which authenticates the garbage it sent.
+func (t *v2Transport) handshake(initiator bool) error {
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return err
+	}
+	ours, err := ellswift.Encode(privKey.PubKey())
+	if err != nil {
+		return err
+	}
+	garbageLen, err := rand.Int(rand.Reader, big.NewInt(v2MaxGarbageSize+1))
+	if err != nil {
+		return err
+	}
+	garbage := make([]byte, garbageLen.Int64())
+	if _, err := rand.Read(garbage); err != nil {
+		return err
+	}
+	if err := t.write(append(ours[:], garbage...)); err != nil {
+		return err
+	}
+
+	b, err := t.read(ellswift.EncodedSize)
+	if err != nil {
+		return err
+	}
+	var theirs [ellswift.EncodedSize]byte
+	copy(theirs[:], b)
+	t.cipher = newV2Cipher(privKey, ours, theirs, initiator, t.btcnet)
+
+	// The contents of the version packet are reserved for future
+	// extensions of the protocol.
+	versionPacket := t.cipher.encrypt(nil, garbage, false)
+	err = t.write(append(t.cipher.sendGarbageTerminator[:], versionPacket...))
+	if err != nil {
+		return err
+	}
+
+	theirGarbage, err := t.readGarbage()
+	if err != nil {
+		return err
+	}
+
+	// The first packet authenticates the garbage of the remote peer,
+	// regardless of whether it is a decoy packet.  The version packet
+	// follows any decoy packets.
+	aad := theirGarbage
+	for {
+		_, ignore, n, err := t.readPacket(aad)
+		t.bytesRead += n
+		if err != nil {
+			return err
+		}
+		if !ignore {
+			return nil
+		}
+		aad = nil
+	}
+}
+
+// readGarbage reads the garbage sent by the remote peer up to its garbage
+// terminator and returns it without the terminator.
+func (t *v2Transport) readGarbage() ([]byte, error) {
+	var garbage []byte
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		t.bytesRead++
+		garbage = append(garbage, b)
+
+		if len(garbage) >= v2GarbageTerminatorSize {
+			split := len(garbage) - v2GarbageTerminatorSize
+			if bytes.Equal(garbage[split:], t.cipher.recvGarbageTerminator[:]) {
+				return garbage[:split], nil
+			}
+			if split == v2MaxGarbageSize {
+				return nil, errors.New("v2 garbage terminator " +
+					"not found")
+			}
+		}
+	}
+}
+
+// readPacket reads and decrypts the next packet from the connection along
+// with the passed additional data.  It returns the contents of the packet,
+// whether it is a decoy packet and the number of bytes read.
+func (t *v2Transport) readPacket(aad []byte) ([]byte, bool, int, error) {
+	var length [v2LengthFieldSize]byte
+	n, err := io.ReadFull(t.r, length[:])
+	if err != nil {
+		return nil, false, n, err
+	}
+	contentsLen := t.cipher.decryptLength(length)
+	if contentsLen > 1+wire.CommandSize+wire.MaxMessagePayload {
+		str := fmt.Sprintf("v2 packet contents of %d bytes exceed the "+
+			"maximum message size", contentsLen)
+		return nil, false, n, errors.New(str)
+	}
+
+	packet := make([]byte, v2HeaderSize+contentsLen+poly1305.TagSize)
+	m, err := io.ReadFull(t.r, packet)
+	n += m
+	if err != nil {
+		return nil, false, n, err
+	}
+	contents, ignore, err := t.cipher.decrypt(packet, aad)
+	return contents, ignore, n, err
+}
+
+// readMessage reads the next message from the connection, skipping decoy
+// packets.  It returns the number of bytes read in addition to the message
+// and its payload.
+func (t *v2Transport) readMessage(pver uint32, enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+	totalBytes := 0
+	for {
+		contents, ignore, n, err := t.readPacket(nil)
+		totalBytes += n
+		if err != nil {
+			return totalBytes, nil, nil, err
+		}
+		if ignore {
+			continue
+		}
+		msg, payload, err := wire.DecodeV2Message(contents, pver, enc)
+		return totalBytes, msg, payload, err
+	}
+}
+
+// writeMessage writes the passed message to the connection and returns the
+// number of bytes written.
+func (t *v2Transport) writeMessage(msg wire.Message, pver uint32, enc wire.MessageEncoding) (int, error) {
+	contents, err := wire.EncodeV2Message(msg, pver, enc)
+	if err != nil {
+		return 0, err
+	}
+	return t.conn.Write(t.cipher.encrypt(contents, nil, false))
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/ellswift"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected. It will only (and must only) be called with
+// hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// TestV2CipherVectors tests the key derivation and packet encryption of the v2
+// transport against the test vectors of BIP0324.
+func TestV2CipherVectors(t *testing.T) {
+	tests := []struct {
+		inIdx                    int
+		inPrivOurs               string
+		inEllswiftOurs           string
+		inEllswiftTheirs         string
+		inInitiating             bool
+		inContents               string
+		outSessionID             string
+		outSendGarbageTerminator string
+		outRecvGarbageTerminator string
+		outCiphertext            string
+	}{
+		{
+			inIdx:                    1,
+			inPrivOurs:               "61062ea5071d800bbfd59e2e8b53d47d194b095ae5a4df04936b49772ef0d4d7",
+			inEllswiftOurs:           "ec0adff257bbfe500c188c80b4fdd640f6b45a482bbc15fc7cef5931deff0aa186f6eb9bba7b85dc4dcc28b28722de1e3d9108b985e2967045668f66098e475b",
+			inEllswiftTheirs:         "a4a94dfce69b4a2a0a099313d10f9f7e7d649d60501c9e1d274c300e0d89aafaffffffffffffffffffffffffffffffffffffffffffffffffffffffff8faf88d5",
+			inInitiating:             true,
+			inContents:               "8e",
+			outSessionID:             "ce72dffb015da62b0d0f5474cab8bc72605225b0cee3f62312ec680ec5f41ba5",
+			outSendGarbageTerminator: "faef555dfcdb936425d84aba524758f3",
+			outRecvGarbageTerminator: "02cb8ff24307a6e27de3b4e7ea3fa65b",
+			outCiphertext:            "7530d2a18720162ac09c25329a60d75adf36eda3c3",
+		},
+	}
+
+	for i, test := range tests {
+		privKey, _ := btcec.PrivKeyFromBytes(hexToBytes(test.inPrivOurs))
+		var ours, theirs [ellswift.EncodedSize]byte
+		copy(ours[:], hexToBytes(test.inEllswiftOurs))
+		copy(theirs[:], hexToBytes(test.inEllswiftTheirs))
+
+		c := newV2Cipher(privKey, ours, theirs, test.inInitiating,
+			wire.MainNet)
+		if got := hex.EncodeToString(c.sessionID[:]); got != test.outSessionID {
+			t.Errorf("#%d: wrong session id - got %s, want %s", i,
+				got, test.outSessionID)
+		}
+		got := hex.EncodeToString(c.sendGarbageTerminator[:])
+		if got != test.outSendGarbageTerminator {
+			t.Errorf("#%d: wrong send garbage terminator - got %s, "+
+				"want %s", i, got, test.outSendGarbageTerminator)
+		}
+		got = hex.EncodeToString(c.recvGarbageTerminator[:])
+		if got != test.outRecvGarbageTerminator {
+			t.Errorf("#%d: wrong receive garbage terminator - got "+
+				"%s, want %s", i, got, test.outRecvGarbageTerminator)
+		}
+
+		// Encrypt dummy packets up to the index of the test packet.
+		for j := 0; j < test.inIdx; j++ {
+			c.encrypt(nil, nil, false)
+		}
+		packet := c.encrypt(hexToBytes(test.inContents), nil, false)
+		if got := hex.EncodeToString(packet); got != test.outCiphertext {
+			t.Errorf("#%d: wrong ciphertext - got %s, want %s", i,
+				got, test.outCiphertext)
+		}
+	}
+}
+
+// newV2CipherPair returns the ciphers of the initiator and the responder of a
+// v2 transport session with random keys.
+func newV2CipherPair(t *testing.T) (*v2Cipher, *v2Cipher) {
+	t.Helper()
+
+	var privKeys [2]*btcec.PrivateKey
+	var encoded [2][ellswift.EncodedSize]byte
+	for i := range privKeys {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+		}
+		privKeys[i] = privKey
+		encoded[i], err = ellswift.Encode(privKey.PubKey())
+		if err != nil {
+			t.Fatalf("Encode: unexpected error: %v", err)
+		}
+	}
+
+	initiator := newV2Cipher(privKeys[0], encoded[0], encoded[1], true,
+		wire.MainNet)
+	responder := newV2Cipher(privKeys[1], encoded[1], encoded[0], false,
+		wire.MainNet)
+	return initiator, responder
+}
+
+// TestV2CipherRoundTrip ensures packets encrypted by one side of a v2 transport
+// session are decrypted by the other side across several rekeys, and that
+// tampered packets are rejected.
+func TestV2CipherRoundTrip(t *testing.T) {
+	initiator, responder := newV2CipherPair(t)
+	if initiator.sessionID != responder.sessionID {
+		t.Fatalf("mismatched session ids %x and %x", initiator.sessionID,
+			responder.sessionID)
+	}
+	if initiator.sendGarbageTerminator != responder.recvGarbageTerminator ||
+		initiator.recvGarbageTerminator != responder.sendGarbageTerminator {
+
+		t.Fatal("mismatched garbage terminators")
+	}
+
+	decrypt := func(c *v2Cipher, packet, aad []byte) ([]byte, bool, error) {
+		var length [v2LengthFieldSize]byte
+		copy(length[:], packet)
+		if n := c.decryptLength(length); n != len(packet)-v2Expansion {
+			t.Fatalf("wrong length %d for packet of %d bytes", n,
+				len(packet))
+		}
+		return c.decrypt(packet[v2LengthFieldSize:], aad)
+	}
+
+	for i := 0; i < 3*v2RekeyInterval+1; i++ {
+		from, to := initiator, responder
+		if i%3 == 0 {
+			from, to = responder, initiator
+		}
+		contents := bytes.Repeat([]byte{byte(i)}, i%70)
+		aad := []byte{byte(i >> 8), byte(i)}
+		ignore := i%5 == 0
+
+		packet := from.encrypt(contents, aad, ignore)
+		gotContents, gotIgnore, err := decrypt(to, packet, aad)
+		if err != nil {
+			t.Fatalf("packet #%d: unexpected error: %v", i, err)
+		}
+		if !bytes.Equal(gotContents, contents) || gotIgnore != ignore {
+			t.Fatalf("packet #%d: got contents %x (ignore %v), want "+
+				"%x (ignore %v)", i, gotContents, gotIgnore,
+				contents, ignore)
+		}
+	}
+
+	packet := initiator.encrypt([]byte("contents"), nil, false)
+	packet[len(packet)-1] ^= 1
+	if _, _, err := decrypt(responder, packet, nil); err != errV2Authentication {
+		t.Fatalf("tampered packet: wrong error - got %v, want %v", err,
+			errV2Authentication)
+	}
+}
+
+// connectPeers connects an inbound and an outbound peer with the passed
+// configurations over a loopback TCP connection and returns them once both
+// have received a verack, or once the outbound peer has disconnected.
+func connectPeers(t *testing.T, inCfg, outCfg *Config) (*Peer, *Peer) {
+	t.Helper()
+
+	verack := make(chan struct{}, 2)
+	inCfg.Listeners.OnVerAck = func(*Peer, *wire.MsgVerAck) {
+		verack <- struct{}{}
+	}
+	outCfg.Listeners.OnVerAck = inCfg.Listeners.OnVerAck
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: unexpected error: %v", err)
+	}
+	defer listener.Close()
+	outConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	inConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept: unexpected error: %v", err)
+	}
+
+	inPeer := NewInboundPeer(inCfg)
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := NewOutboundPeer(outCfg, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-outPeer.quit:
+			inPeer.Disconnect()
+			inPeer.WaitForDisconnect()
+			return inPeer, outPeer
+		case <-time.After(5 * time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+	return inPeer, outPeer
+}
+
+// TestV2TransportPeers ensures peers negotiate the v2 transport when both sides
+// support it, fall back to the v1 transport for inbound peers using it, and
+// detect outbound peers rejecting the v2 handshake.
+func TestV2TransportPeers(t *testing.T) {
+	tests := []struct {
+		name         string
+		inV2         bool
+		outV2        bool
+		wantV2       bool
+		wantRejected bool
+	}{
+		{"v2 to v2", true, true, true, false},
+		{"v1 to v2", true, false, false, false},
+		{"v1 to v1", false, false, false, false},
+		{"v2 to v1", false, true, false, true},
+	}
+
+	for _, test := range tests {
+		inCfg := &Config{
+			ChainParams:     &chaincfg.MainNetParams,
+			TrickleInterval: 10 * time.Second,
+			AllowSelfConns:  true,
+			V2Transport:     test.inV2,
+		}
+		outCfg := *inCfg
+		outCfg.V2Transport = test.outV2
+		pong := make(chan uint64, 1)
+		outCfg.Listeners.OnPong = func(_ *Peer, msg *wire.MsgPong) {
+			pong <- msg.Nonce
+		}
+
+		inPeer, outPeer := connectPeers(t, inCfg, &outCfg)
+		if test.wantRejected {
+			outPeer.WaitForDisconnect()
+			if !outPeer.V2TransportRejected() {
+				t.Errorf("%s: v2 transport not rejected", test.name)
+			}
+			continue
+		}
+
+		if (inPeer.v2 != nil) != test.wantV2 ||
+			(outPeer.v2 != nil) != test.wantV2 {
+
+			t.Errorf("%s: mismatched v2 transport - got inbound %v, "+
+				"outbound %v, want %v", test.name, inPeer.v2 != nil,
+				outPeer.v2 != nil, test.wantV2)
+		}
+		if outPeer.V2TransportRejected() {
+			t.Errorf("%s: unexpected v2 transport rejection",
+				test.name)
+		}
+
+		// Exchange a ping and pong over the negotiated transport.
+		outPeer.QueueMessage(wire.NewMsgPing(42), nil)
+		select {
+		case nonce := <-pong:
+			if nonce != 42 {
+				t.Errorf("%s: wrong pong nonce %d", test.name, nonce)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: pong timeout", test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
@@ -5,7 +5,9 @@
 package main
 
 import (
+	"net"
 	"sync/atomic"
+	"time"
 
 	"github.com/babylonchain-io/bbld/blockchain"
 	"github.com/babylonchain-io/bbld/btcutil"
@@ -61,6 +63,39 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// ConnectionType returns the type of the connection to the peer, which is one
+// of inbound, outbound-full-relay, block-relay-only or manual.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) ConnectionType() string {
+	sp := (*serverPeer)(p)
+	switch {
+	case sp.Inbound():
+		return "inbound"
+	case sp.persistent:
+		return "manual"
+	case sp.isBlockRelayOnly():
+		return "block-relay-only"
+	}
+	return "outbound-full-relay"
+}
+
+// MappedAS returns the number of the autonomous system the peer belongs to
+// according to the asmap in use, or zero when no asmap is used or the peer is
+// not mapped.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) MappedAS() uint32 {
+	sp := (*serverPeer)(p)
+	na := sp.NA()
+	if na == nil {
+		return 0
+	}
+	return sp.server.addrManager.MappedAS(na)
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -164,6 +199,14 @@ func (cm *rpcConnManager) NetTotals() (uint64, uint64) {
 	return cm.server.NetTotals()
 }
 
+// UploadTarget returns the state of the upload target in the current cycle.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) UploadTarget() uploadTargetStatus {
+	return cm.server.uploadTarget.status(time.Now())
+}
+
 // ConnectedPeers returns an array consisting of all connected peers.
 //
 // This function is safe for concurrent access and is part of the
@@ -228,10 +271,60 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 //
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
-func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddress {
+func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddressV2 {
 	return cm.server.addrManager.AddressCache()
 }
 
+// BanSubnet bans the provided subnet until the provided time and disconnects
+// the connected peers which are part of it.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BanSubnet(subnet *net.IPNet, until time.Time, reason string) {
+	replyChan := make(chan struct{})
+	cm.server.query <- banSubnetMsg{
+		subnet: subnet,
+		until:  until,
+		reason: reason,
+		reply:  replyChan,
+	}
+	<-replyChan
+}
+
+// UnbanSubnet lifts the ban of the provided subnet.  It returns whether the
+// subnet was banned.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) UnbanSubnet(subnet *net.IPNet) bool {
+	return cm.server.banList.remove(subnet)
+}
+
+// ClearBanned lifts all bans.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ClearBanned() {
+	cm.server.banList.clear()
+}
+
+// BannedSubnets returns the bans which are in effect.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BannedSubnets() []banEntry {
+	return cm.server.banList.list()
+}
+
+// ASMapChecksum returns the checksum of the asmap used to group addresses by
+// autonomous system, or the empty string when no asmap is used.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ASMapChecksum() string {
+	return cm.server.addrManager.ASMapChecksum()
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
@@ -271,6 +271,37 @@ func (c *Client) GetBlockVerboseTx(blockHash *chainhash.Hash) (*btcjson.GetBlock
 	return c.GetBlockVerboseTxAsync(blockHash).Receive()
 }
 
+// GetBlockVerboseTxPrevoutAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetBlockVerboseTxPrevout for the blocking version and more details.
+func (c *Client) GetBlockVerboseTxPrevoutAsync(blockHash *chainhash.Hash) FutureGetBlockVerboseTxResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	// If verbosity is 3, returns an Object with information about block,
+	// each transaction, and the previous outputs spent by their inputs.
+	cmd := btcjson.NewGetBlockCmd(hash, btcjson.Int(3))
+	return FutureGetBlockVerboseTxResult{
+		client:   c,
+		hash:     hash,
+		Response: c.SendCmd(cmd),
+	}
+}
+
+// GetBlockVerboseTxPrevout returns a data structure from the server with
+// information about a block and its transactions given its hash, including the
+// fee paid by each transaction and the previous output spent by each input.
+//
+// See GetBlockVerboseTx if the previous outputs are not needed.
+// See GetBlock to retrieve a raw block instead.
+func (c *Client) GetBlockVerboseTxPrevout(blockHash *chainhash.Hash) (*btcjson.GetBlockVerboseTxResult, error) {
+	return c.GetBlockVerboseTxPrevoutAsync(blockHash).Receive()
+}
+
 // FutureGetBlockCountResult is a future promise to deliver the result of a
 // GetBlockCountAsync RPC invocation (or an applicable error).
 type FutureGetBlockCountResult chan *Response
@@ -307,6 +338,43 @@ func (c *Client) GetBlockCount() (int64, error) {
 	return c.GetBlockCountAsync().Receive()
 }
 
+// FutureGetChainTipsResult is a future promise to deliver the result of a
+// GetChainTipsAsync RPC invocation (or an applicable error).
+type FutureGetChainTipsResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the tips
+// of the main chain and all known side chains.
+func (r FutureGetChainTipsResult) Receive() ([]*btcjson.GetChainTipsResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a slice of chain tips.
+	var chainTips []*btcjson.GetChainTipsResult
+	err = json.Unmarshal(res, &chainTips)
+	if err != nil {
+		return nil, err
+	}
+	return chainTips, nil
+}
+
+// GetChainTipsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetChainTips for the blocking version and more details.
+func (c *Client) GetChainTipsAsync() FutureGetChainTipsResult {
+	cmd := btcjson.NewGetChainTipsCmd()
+	return c.SendCmd(cmd)
+}
+
+// GetChainTips returns information about the tips of the main chain and all
+// side chains known to the server.
+func (c *Client) GetChainTips() ([]*btcjson.GetChainTipsResult, error) {
+	return c.GetChainTipsAsync().Receive()
+}
+
 // FutureGetChainTxStatsResult is a future promise to deliver the result of a
 // GetChainTxStatsAsync RPC invocation (or an applicable error).
 type FutureGetChainTxStatsResult chan *Response
@@ -1151,6 +1219,40 @@ func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
 	return c.InvalidateBlockAsync(blockHash).Receive()
 }
 
+// FutureReconsiderBlockResult is a future promise to deliver the result of a
+// ReconsiderBlockAsync RPC invocation (or an applicable error).
+type FutureReconsiderBlockResult chan *Response
+
+// Receive waits for the Response promised by the future and returns an error
+// if the block could not be reconsidered.
+func (r FutureReconsiderBlockResult) Receive() error {
+	_, err := ReceiveFuture(r)
+
+	return err
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash *chainhash.Hash) FutureReconsiderBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := btcjson.NewReconsiderBlockCmd(hash)
+	return c.SendCmd(cmd)
+}
+
+// ReconsiderBlock approves the branch containing a specific block so the
+// server follows it even when that requires a reorganization deeper than its
+// configured maximum reorg depth.
+func (c *Client) ReconsiderBlock(blockHash *chainhash.Hash) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
 // FutureGetCFilterResult is a future promise to deliver the result of a
 // GetCFilterAsync RPC invocation (or an applicable error).
 type FutureGetCFilterResult chan *Response
@@ -1382,3 +1484,120 @@ func (c *Client) GetDescriptorInfoAsync(descriptor string) FutureGetDescriptorIn
 func (c *Client) GetDescriptorInfo(descriptor string) (*btcjson.GetDescriptorInfoResult, error) {
 	return c.GetDescriptorInfoAsync(descriptor).Receive()
 }
+
+// FutureScanTxOutSetResult is a future promise to deliver the result of a
+// ScanTxOutSetAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// unspent transaction outputs found by the scan.
+func (r FutureScanTxOutSetResult) Receive() (*btcjson.ScanTxOutSetResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanResult btcjson.ScanTxOutSetResult
+	err = json.Unmarshal(res, &scanResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanResult, nil
+}
+
+// ScanTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ScanTxOutSet for the blocking version and more details.
+func (c *Client) ScanTxOutSetAsync(scanObjects []btcjson.ScanTxOutSetObject) FutureScanTxOutSetResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStart, &scanObjects)
+	return c.SendCmd(cmd)
+}
+
+// ScanTxOutSet scans the unspent transaction output set for the outputs paying
+// to the scripts of the passed output descriptors, by invoking the
+// scantxoutset RPC with the start action.  The call blocks until the scan
+// completes or is aborted with ScanTxOutSetAbort.
+//
+// See btcjson.ScanTxOutSetResult for details about the result.
+func (c *Client) ScanTxOutSet(scanObjects []btcjson.ScanTxOutSetObject) (*btcjson.ScanTxOutSetResult, error) {
+	return c.ScanTxOutSetAsync(scanObjects).Receive()
+}
+
+// FutureScanTxOutSetAbortResult is a future promise to deliver the result of a
+// ScanTxOutSetAbortAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetAbortResult chan *Response
+
+// Receive waits for the Response promised by the future and returns whether a
+// scan in progress was aborted.
+func (r FutureScanTxOutSetAbortResult) Receive() (bool, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var aborted bool
+	err = json.Unmarshal(res, &aborted)
+	if err != nil {
+		return false, err
+	}
+
+	return aborted, nil
+}
+
+// ScanTxOutSetAbortAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ScanTxOutSetAbort for the blocking version and more details.
+func (c *Client) ScanTxOutSetAbortAsync() FutureScanTxOutSetAbortResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetAbort, nil)
+	return c.SendCmd(cmd)
+}
+
+// ScanTxOutSetAbort aborts the scan of the unspent transaction output set in
+// progress, by invoking the scantxoutset RPC with the abort action.  It
+// returns whether a scan was in progress and aborted.
+func (c *Client) ScanTxOutSetAbort() (bool, error) {
+	return c.ScanTxOutSetAbortAsync().Receive()
+}
+
+// FutureScanTxOutSetStatusResult is a future promise to deliver the result of
+// a ScanTxOutSetStatusAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetStatusResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// progress of the scan in progress, or nil when no scan is in progress.
+func (r FutureScanTxOutSetStatusResult) Receive() (*btcjson.ScanTxOutSetStatusResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var status *btcjson.ScanTxOutSetStatusResult
+	err = json.Unmarshal(res, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// ScanTxOutSetStatusAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ScanTxOutSetStatus for the blocking version and more details.
+func (c *Client) ScanTxOutSetStatusAsync() FutureScanTxOutSetStatusResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStatus, nil)
+	return c.SendCmd(cmd)
+}
+
+// ScanTxOutSetStatus returns the progress of the scan of the unspent
+// transaction output set in progress, by invoking the scantxoutset RPC with
+// the status action.  It returns nil when no scan is in progress.
+func (c *Client) ScanTxOutSetStatus() (*btcjson.ScanTxOutSetStatusResult, error) {
+	return c.ScanTxOutSetStatusAsync().Receive()
+}
@@ -471,3 +471,262 @@ func (c *Client) VersionAsync() FutureVersionResult {
 func (c *Client) Version() (map[string]btcjson.VersionResult, error) {
 	return c.VersionAsync().Receive()
 }
+
+// encodeAddresses returns the encoded form of each of the passed addresses.
+func encodeAddresses(addresses []btcutil.Address) []string {
+	encoded := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		encoded = append(encoded, addr.EncodeAddress())
+	}
+	return encoded
+}
+
+// FutureGetAddressBalanceResult is a future promise to deliver the result of a
+// GetAddressBalanceAsync RPC invocation (or an applicable error).
+type FutureGetAddressBalanceResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// combined balance of the requested addresses.
+func (r FutureGetAddressBalanceResult) Receive() (*btcjson.GetAddressBalanceResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a balance result object.
+	var balance btcjson.GetAddressBalanceResult
+	err = json.Unmarshal(res, &balance)
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// GetAddressBalanceAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAddressBalance for the blocking version and more details.
+func (c *Client) GetAddressBalanceAsync(addresses []btcutil.Address,
+	includeMempool bool) FutureGetAddressBalanceResult {
+
+	cmd := btcjson.NewGetAddressBalanceCmd(encodeAddresses(addresses),
+		&includeMempool)
+	return c.SendCmd(cmd)
+}
+
+// GetAddressBalance returns the combined balance of the passed addresses along
+// with the total amount they have received.  The change made by unconfirmed
+// transactions is also returned when includeMempool is set.
+//
+// NOTE: This is a btcd extension and requires the address utxo index.
+func (c *Client) GetAddressBalance(addresses []btcutil.Address,
+	includeMempool bool) (*btcjson.GetAddressBalanceResult, error) {
+
+	return c.GetAddressBalanceAsync(addresses, includeMempool).Receive()
+}
+
+// FutureGetAddressDeltasResult is a future promise to deliver the result of a
+// GetAddressDeltasAsync RPC invocation (or an applicable error).
+type FutureGetAddressDeltasResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// changes made to the balance of the requested addresses.
+func (r FutureGetAddressDeltasResult) Receive() ([]btcjson.GetAddressDeltasResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a slice of balance changes.
+	var deltas []btcjson.GetAddressDeltasResult
+	err = json.Unmarshal(res, &deltas)
+	if err != nil {
+		return nil, err
+	}
+	return deltas, nil
+}
+
+// GetAddressDeltasAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAddressDeltas for the blocking version and more details.
+func (c *Client) GetAddressDeltasAsync(addresses []btcutil.Address,
+	startHeight, endHeight *int32, includeMempool bool) FutureGetAddressDeltasResult {
+
+	cmd := btcjson.NewGetAddressDeltasCmd(encodeAddresses(addresses),
+		startHeight, endHeight, &includeMempool)
+	return c.SendCmd(cmd)
+}
+
+// GetAddressDeltas returns every change made to the balance of the passed
+// addresses by blocks within the optional inclusive height range.  The changes
+// made by unconfirmed transactions are also returned when includeMempool is set
+// and no end height is specified.
+//
+// NOTE: This is a btcd extension and requires the address utxo index.
+func (c *Client) GetAddressDeltas(addresses []btcutil.Address, startHeight,
+	endHeight *int32, includeMempool bool) ([]btcjson.GetAddressDeltasResult, error) {
+
+	return c.GetAddressDeltasAsync(addresses, startHeight, endHeight,
+		includeMempool).Receive()
+}
+
+// FutureGetAddressUtxosResult is a future promise to deliver the result of a
+// GetAddressUtxosAsync RPC invocation (or an applicable error).
+type FutureGetAddressUtxosResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// unspent outputs paying to the requested addresses.
+func (r FutureGetAddressUtxosResult) Receive() ([]btcjson.GetAddressUtxosResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a slice of unspent outputs.
+	var utxos []btcjson.GetAddressUtxosResult
+	err = json.Unmarshal(res, &utxos)
+	if err != nil {
+		return nil, err
+	}
+	return utxos, nil
+}
+
+// GetAddressUtxosAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAddressUtxos for the blocking version and more details.
+func (c *Client) GetAddressUtxosAsync(addresses []btcutil.Address,
+	includeMempool bool) FutureGetAddressUtxosResult {
+
+	cmd := btcjson.NewGetAddressUtxosCmd(encodeAddresses(addresses),
+		&includeMempool)
+	return c.SendCmd(cmd)
+}
+
+// GetAddressUtxos returns the unspent outputs paying to the passed addresses.
+// When includeMempool is set, outputs created by unconfirmed transactions are
+// included and outputs they spend are excluded.
+//
+// NOTE: This is a btcd extension and requires the address utxo index.
+func (c *Client) GetAddressUtxos(addresses []btcutil.Address,
+	includeMempool bool) ([]btcjson.GetAddressUtxosResult, error) {
+
+	return c.GetAddressUtxosAsync(addresses, includeMempool).Receive()
+}
+
+// serializeTxHex returns the hex-encoded serialization of the passed
+// transaction, or an empty string when it is nil.
+func serializeTxHex(tx *wire.MsgTx) (string, error) {
+	if tx == nil {
+		return "", nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+	if err := tx.Serialize(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// FutureDebugScriptResult is a future promise to deliver the result of a
+// DebugScriptAsync RPC invocation (or an applicable error).
+type FutureDebugScriptResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the trace
+// of the execution of the scripts of the input.
+func (r FutureDebugScriptResult) Receive() (*btcjson.TraceScriptResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a script trace.
+	var trace btcjson.TraceScriptResult
+	err = json.Unmarshal(res, &trace)
+	if err != nil {
+		return nil, err
+	}
+	return &trace, nil
+}
+
+// DebugScriptAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See DebugScript for the blocking version and more details.
+func (c *Client) DebugScriptAsync(tx *wire.MsgTx, vin uint32,
+	prevOut *wire.TxOut) FutureDebugScriptResult {
+
+	txHex, err := serializeTxHex(tx)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	cmd := btcjson.NewDebugScriptCmd(txHex, vin,
+		hex.EncodeToString(prevOut.PkScript),
+		btcutil.Amount(prevOut.Value).ToBTC())
+	return c.SendCmd(cmd)
+}
+
+// DebugScript executes the scripts of the passed transaction input against
+// the passed output it spends and returns the trace of the execution.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) DebugScript(tx *wire.MsgTx, vin uint32,
+	prevOut *wire.TxOut) (*btcjson.TraceScriptResult, error) {
+
+	return c.DebugScriptAsync(tx, vin, prevOut).Receive()
+}
+
+// FutureTraceTransactionResult is a future promise to deliver the result of a
+// TraceTransactionAsync RPC invocation (or an applicable error).
+type FutureTraceTransactionResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the trace
+// of the execution of the scripts of each of the traced inputs.
+func (r FutureTraceTransactionResult) Receive() ([]btcjson.TraceScriptResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a slice of script traces.
+	var traces []btcjson.TraceScriptResult
+	err = json.Unmarshal(res, &traces)
+	if err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// TraceTransactionAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See TraceTransaction for the blocking version and more details.
+func (c *Client) TraceTransactionAsync(tx *wire.MsgTx,
+	vin *uint32) FutureTraceTransactionResult {
+
+	txHex, err := serializeTxHex(tx)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	cmd := btcjson.NewTraceTransactionCmd(txHex, vin)
+	return c.SendCmd(cmd)
+}
+
+// TraceTransaction executes the scripts of the inputs of the passed
+// transaction against the outputs they spend and returns the trace of each
+// execution.  All of the inputs are traced when vin is nil.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) TraceTransaction(tx *wire.MsgTx,
+	vin *uint32) ([]btcjson.TraceScriptResult, error) {
+
+	return c.TraceTransactionAsync(tx, vin).Receive()
+}
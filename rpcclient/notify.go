@@ -121,6 +121,13 @@ type NotificationHandlers struct {
 	// OnBlockDisconnected: it receives the block's height and header.
 	OnFilteredBlockDisconnected func(height int32, header *wire.BlockHeader)
 
+	// OnDeepReorg is invoked when the server refused a reorganization that
+	// would have disconnected more blocks than its configured maximum
+	// reorg depth.  It will only be invoked if a preceding call to
+	// NotifyBlocks has been made to register for the notification and the
+	// function is non-nil.
+	OnDeepReorg func(reorg *btcjson.DeepReorgNtfn)
+
 	// OnRecvTx is invoked when a transaction that receives funds to a
 	// registered address is received into the memory pool and also
 	// connected to the longest (best) chain.  It will only be invoked if a
@@ -290,6 +297,23 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 		c.ntfnHandlers.OnFilteredBlockDisconnected(blockHeight,
 			blockHeader)
 
+	// OnDeepReorg
+	case btcjson.DeepReorgNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnDeepReorg == nil {
+			return
+		}
+
+		reorg, err := parseDeepReorgNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid deep reorg notification: %v",
+				err)
+			return
+		}
+
+		c.ntfnHandlers.OnDeepReorg(reorg)
+
 	// OnRecvTx
 	case btcjson.RecvTxNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -775,6 +799,33 @@ func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*btcjson.TxRawR
 	return &rawTx, nil
 }
 
+// parseDeepReorgNtfnParams parses out the details of a refused reorganization
+// from the parameters of a deepreorg notification.
+func parseDeepReorgNtfnParams(params []json.RawMessage) (*btcjson.DeepReorgNtfn,
+	error) {
+
+	if len(params) != 8 {
+		return nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal the parameters in the order they are defined by the
+	// notification.
+	var reorg btcjson.DeepReorgNtfn
+	fields := []interface{}{
+		&reorg.ForkHash, &reorg.ForkHeight,
+		&reorg.OldTipHash, &reorg.OldTipHeight,
+		&reorg.NewTipHash, &reorg.NewTipHeight,
+		&reorg.Depth, &reorg.MaxDepth,
+	}
+	for i, field := range fields {
+		if err := json.Unmarshal(params[i], field); err != nil {
+			return nil, err
+		}
+	}
+
+	return &reorg, nil
+}
+
 // parseBtcdConnectedNtfnParams parses out the connection status of btcd
 // and btcwallet from the parameters of a btcdconnected notification.
 func parseBtcdConnectedNtfnParams(params []json.RawMessage) (bool, error) {
@@ -391,6 +391,55 @@ func (c *Client) SendRawTransactionWithData(tx *wire.MsgTx, allowHighFees bool,
 	return c.SendRawTransactionAsync(tx, allowHighFees, &posData).Receive()
 }
 
+// FutureSubmitPackageResult is a future promise to deliver the result of a
+// SubmitPackageAsync RPC invocation (or an applicable error).
+type FutureSubmitPackageResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the result
+// of submitting the package of transactions to the server.
+func (r FutureSubmitPackageResult) Receive() (*btcjson.SubmitPackageResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var packageResult btcjson.SubmitPackageResult
+	err = json.Unmarshal(res, &packageResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packageResult, nil
+}
+
+// SubmitPackageAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SubmitPackage for the blocking version and more details.
+func (c *Client) SubmitPackageAsync(txns []*wire.MsgTx, posData *[]string) FutureSubmitPackageResult {
+	txHexes := make([]string, 0, len(txns))
+	for _, tx := range txns {
+		// Serialize the transaction and convert to hex string.
+		buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+		if err := tx.Serialize(buf); err != nil {
+			return newFutureError(err)
+		}
+		txHexes = append(txHexes, hex.EncodeToString(buf.Bytes()))
+	}
+
+	cmd := btcjson.NewSubmitPackageCmd(txHexes, posData)
+	return c.SendCmd(cmd)
+}
+
+// SubmitPackage submits a package consisting of a child transaction along with
+// its unconfirmed parents to the server, which evaluates the transactions that
+// don't pay sufficient fees on their own together and then relays the accepted
+// ones to the network.
+func (c *Client) SubmitPackage(txns []*wire.MsgTx) (*btcjson.SubmitPackageResult, error) {
+	return c.SubmitPackageAsync(txns, nil).Receive()
+}
+
 // FutureSignRawTransactionResult is a future promise to deliver the result
 // of one of the SignRawTransactionAsync family of RPC invocations (or an
 // applicable error).
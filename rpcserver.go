@@ -21,17 +21,21 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/babylonchain-io/bbld/addrmgr"
 	"github.com/babylonchain-io/bbld/blockchain"
 	"github.com/babylonchain-io/bbld/blockchain/indexers"
 	"github.com/babylonchain-io/bbld/btcec/ecdsa"
 	"github.com/babylonchain-io/bbld/btcjson"
 	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/btcutil/descriptor"
+	"github.com/babylonchain-io/bbld/btcutil/hdkeychain"
 	"github.com/babylonchain-io/bbld/chaincfg"
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/database"
@@ -131,13 +135,19 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":                handleAddNode,
+	"clearbanned":            handleClearBanned,
 	"createrawtransaction":   handleCreateRawTransaction,
 	"debuglevel":             handleDebugLevel,
+	"debugscript":            handleDebugScript,
 	"decoderawtransaction":   handleDecodeRawTransaction,
 	"decodescript":           handleDecodeScript,
+	"deriveaddresses":        handleDeriveAddresses,
 	"estimatefee":            handleEstimateFee,
 	"generate":               handleGenerate,
 	"getaddednodeinfo":       handleGetAddedNodeInfo,
+	"getaddressbalance":      handleGetAddressBalance,
+	"getaddressdeltas":       handleGetAddressDeltas,
+	"getaddressutxos":        handleGetAddressUtxos,
 	"getbestblock":           handleGetBestBlock,
 	"getbestblockhash":       handleGetBestBlockHash,
 	"getblock":               handleGetBlock,
@@ -145,11 +155,14 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblockcount":          handleGetBlockCount,
 	"getblockhash":           handleGetBlockHash,
 	"getblockheader":         handleGetBlockHeader,
+	"getblockstats":          handleGetBlockStats,
 	"getblocktemplate":       handleGetBlockTemplate,
 	"getcfilter":             handleGetCFilter,
 	"getcfilterheader":       handleGetCFilterHeader,
+	"getchaintips":           handleGetChainTips,
 	"getconnectioncount":     handleGetConnectionCount,
 	"getcurrentnet":          handleGetCurrentNet,
+	"getdescriptorinfo":      handleGetDescriptorInfo,
 	"getdifficulty":          handleGetDifficulty,
 	"getgenerate":            handleGetGenerate,
 	"gethashespersec":        handleGetHashesPerSec,
@@ -165,14 +178,20 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getrawtransaction":      handleGetRawTransaction,
 	"gettxout":               handleGetTxOut,
 	"help":                   handleHelp,
+	"listbanned":             handleListBanned,
 	"node":                   handleNode,
 	"ping":                   handlePing,
+	"reconsiderblock":        handleReconsiderBlock,
+	"scantxoutset":           handleScanTxOutSet,
 	"searchrawtransactions":  handleSearchRawTransactions,
 	"sendrawtransaction":     handleSendRawTransaction,
+	"setban":                 handleSetBan,
 	"setgenerate":            handleSetGenerate,
 	"signmessagewithprivkey": handleSignMessageWithPrivKey,
 	"stop":                   handleStop,
 	"submitblock":            handleSubmitBlock,
+	"submitpackage":          handleSubmitPackage,
+	"tracetransaction":       handleTraceTransaction,
 	"uptime":                 handleUptime,
 	"validateaddress":        handleValidateAddress,
 	"verifychain":            handleVerifyChain,
@@ -231,13 +250,11 @@ var rpcAskWallet = map[string]struct{}{
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
-	"getchaintips":     {},
 	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
 	"invalidateblock":  {},
 	"preciousblock":    {},
-	"reconsiderblock":  {},
 }
 
 // Commands that are available to a limited user
@@ -258,17 +275,25 @@ var rpcLimited = map[string]struct{}{
 	// HTTP/S-only commands
 	"createrawtransaction":  {},
 	"decoderawtransaction":  {},
+	"debugscript":           {},
 	"decodescript":          {},
+	"deriveaddresses":       {},
 	"estimatefee":           {},
+	"getaddressbalance":     {},
+	"getaddressdeltas":      {},
+	"getaddressutxos":       {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
 	"getblockhash":          {},
 	"getblockheader":        {},
+	"getblockstats":         {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
+	"getchaintips":          {},
 	"getcurrentnet":         {},
+	"getdescriptorinfo":     {},
 	"getdifficulty":         {},
 	"getheaders":            {},
 	"getinfo":               {},
@@ -280,6 +305,8 @@ var rpcLimited = map[string]struct{}{
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"submitpackage":         {},
+	"tracetransaction":      {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
@@ -395,6 +422,94 @@ func handleAddNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return nil, nil
 }
 
+// handleClearBanned handles clearbanned commands.
+func handleClearBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	s.cfg.ConnMgr.ClearBanned()
+	return nil, nil
+}
+
+// handleListBanned handles listbanned commands.
+func handleListBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	now := time.Now()
+	bans := s.cfg.ConnMgr.BannedSubnets()
+	results := make([]btcjson.ListBannedResult, 0, len(bans))
+	for _, ban := range bans {
+		results = append(results, btcjson.ListBannedResult{
+			Address:       ban.subnet.String(),
+			BanCreated:    ban.created.Unix(),
+			BannedUntil:   ban.until.Unix(),
+			BanDuration:   int64(ban.until.Sub(ban.created) / time.Second),
+			TimeRemaining: int64(ban.until.Sub(now) / time.Second),
+			BanReason:     ban.reason,
+		})
+	}
+	return results, nil
+}
+
+// handleSetBan handles setban commands.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetBanCmd)
+
+	subnet, err := parseSubnet(c.SubNet)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+			Message: "Error: Invalid IP/Subnet",
+		}
+	}
+
+	switch c.SubCmd {
+	case btcjson.SBAdd:
+		for _, ban := range s.cfg.ConnMgr.BannedSubnets() {
+			if ban.subnet.String() == subnet.String() {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCClientNodeAlreadyAdded,
+					Message: "Error: IP/Subnet already banned",
+				}
+			}
+		}
+
+		var banTime int64
+		if c.BanTime != nil {
+			banTime = *c.BanTime
+		}
+		var until time.Time
+		switch {
+		case c.Absolute != nil && *c.Absolute:
+			until = time.Unix(banTime, 0)
+		case banTime > 0:
+			until = time.Now().Add(time.Duration(banTime) * time.Second)
+		default:
+			until = time.Now().Add(cfg.BanDuration)
+		}
+		if !until.After(time.Now()) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Error: Ban end time is in the past",
+			}
+		}
+
+		s.cfg.ConnMgr.BanSubnet(subnet, until, banReasonManual)
+
+	case btcjson.SBRemove:
+		if !s.cfg.ConnMgr.UnbanSubnet(subnet) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+				Message: "Error: Unban failed. Requested address/subnet was not previously banned.",
+			}
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
 // handleNode handles node commands.
 func handleNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.NodeCmd)
@@ -729,6 +844,49 @@ func handleDebugLevel(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return "Done.", nil
 }
 
+// handleDebugScript handles debugscript commands.
+func handleDebugScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DebugScriptCmd)
+
+	mtx, err := decodeTraceTx(c.HexTx)
+	if err != nil {
+		return nil, err
+	}
+	if c.Vin >= uint32(len(mtx.TxIn)) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Input index number (vin) does not exist for transaction.",
+		}
+	}
+
+	pkScript, err := hex.DecodeString(c.ScriptPubKey)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.ScriptPubKey)
+	}
+	amount, err := btcutil.NewAmount(c.Amount)
+	if err != nil {
+		context := "Failed to convert amount"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// Use the provided output for the traced input and look up the outputs
+	// spent by the other inputs, which are only needed by the taproot
+	// sighash, on a best effort basis.
+	prevOuts, err := fetchTracePrevOuts(s, mtx)
+	if err != nil {
+		return nil, err
+	}
+	prevOut := wire.NewTxOut(int64(amount), pkScript)
+	prevOuts.AddPrevOut(mtx.TxIn[c.Vin].PreviousOutPoint, prevOut)
+
+	flags, err := traceScriptFlags(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return traceTxInput(mtx, int(c.Vin), prevOut, prevOuts, flags), nil
+}
+
 // witnessToHex formats the passed witness stack as a slice of hex-encoded
 // strings to be used in a JSON response.
 func witnessToHex(witness wire.TxWitness) []string {
@@ -869,6 +1027,53 @@ func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
 	return txReply, nil
 }
 
+// addTxPrevouts populates the previous output spent by each input of the passed
+// raw transaction result along with the fee paid by the transaction.  The
+// provided spent outputs must be in the same order as the transaction inputs.
+func addTxPrevouts(txReply *btcjson.TxRawResult, mtx *wire.MsgTx,
+	stxos []blockchain.SpentTxOut, chainParams *chaincfg.Params) {
+
+	var totalIn int64
+	for i := range txReply.Vin {
+		stxo := &stxos[i]
+		totalIn += stxo.Amount
+
+		// The disassembled string will contain [error] inline if the
+		// script doesn't fully parse, so ignore the error here.
+		disbuf, _ := txscript.DisasmString(stxo.PkScript)
+
+		// Ignore the error here since an error means the script
+		// couldn't parse and there is no additional information about
+		// it anyways.
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			stxo.PkScript, chainParams)
+		encodedAddrs := make([]string, len(addrs))
+		for j, addr := range addrs {
+			encodedAddrs[j] = addr.EncodeAddress()
+		}
+
+		txReply.Vin[i].Prevout = &btcjson.SpentOutputResult{
+			Generated: stxo.IsCoinBase,
+			Height:    stxo.Height,
+			Value:     btcutil.Amount(stxo.Amount).ToBTC(),
+			ScriptPubKey: btcjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(stxo.PkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: encodedAddrs,
+			},
+		}
+	}
+
+	var totalOut int64
+	for _, txOut := range mtx.TxOut {
+		totalOut += txOut.Value
+	}
+	fee := btcutil.Amount(totalIn - totalOut).ToBTC()
+	txReply.Fee = &fee
+}
+
 // handleDecodeRawTransaction handles decoderawtransaction commands.
 func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeRawTransactionCmd)
@@ -950,6 +1155,118 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// maxDescriptorRange is the maximum number of child indexes a descriptor is
+// derived at in a single call.
+const maxDescriptorRange = 1000000
+
+// parseDescriptor parses the passed descriptor for the active network and
+// converts any errors to an RPC error.
+func parseDescriptor(s *rpcServer, desc string) (*descriptor.Descriptor, error) {
+	parsed, err := descriptor.Parse(desc, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: err.Error(),
+		}
+	}
+	return parsed, nil
+}
+
+// parseDescriptorRange returns the first and last child index of the passed
+// descriptor range, which is either the last index or an array of the first
+// and last index.
+func parseDescriptorRange(r *btcjson.DescriptorRange) (int, int, error) {
+	var begin, end int
+	switch v := r.Value.(type) {
+	case int:
+		end = v
+	case []int:
+		begin, end = v[0], v[1]
+	default:
+		return 0, 0, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range must be an integer or an array of two integers",
+		}
+	}
+	if begin < 0 || end < begin {
+		return 0, 0, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range should be greater or equal than 0 and end after begin",
+		}
+	}
+	if int64(end) >= int64(hdkeychain.HardenedKeyStart) {
+		return 0, 0, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range end should be lower than 2**31",
+		}
+	}
+	if end-begin >= maxDescriptorRange {
+		return 0, 0, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Range is too large, at most %d "+
+				"indexes can be derived", maxDescriptorRange),
+		}
+	}
+
+	return begin, end, nil
+}
+
+// handleDeriveAddresses handles deriveaddresses commands.
+func handleDeriveAddresses(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DeriveAddressesCmd)
+
+	// Unlike getdescriptorinfo, a checksum is required to make sure the
+	// addresses are derived from the intended descriptor.
+	if !strings.Contains(c.Descriptor, "#") {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Missing checksum",
+		}
+	}
+	desc, err := parseDescriptor(s, c.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine the range of indexes to derive.  A ranged descriptor
+	// requires a range, which is either the end of the range or the begin
+	// and end of it.
+	var begin, end int
+	switch {
+	case !desc.IsRange() && c.Range != nil:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range should not be specified for an un-ranged descriptor",
+		}
+
+	case desc.IsRange() && c.Range == nil:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range must be specified for a ranged descriptor",
+		}
+
+	case c.Range != nil:
+		begin, end, err = parseDescriptorRange(c.Range)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addresses := make(btcjson.DeriveAddressesResult, 0, end-begin+1)
+	for i := begin; i <= end; i++ {
+		addr, err := desc.Address(uint32(i))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Descriptor does not have a corresponding address",
+			}
+		}
+		addresses = append(addresses, addr.EncodeAddress())
+	}
+
+	return addresses, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.EstimateFeeCmd)
@@ -1116,6 +1433,318 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return results, nil
 }
 
+// decodeAddrUtxoIndexAddrs decodes the passed addresses for use with the
+// address utxo index while ensuring the index, along with the address index
+// when unconfirmed transactions are requested, is enabled.  Duplicate
+// addresses are only returned once.  The addresses are returned along with
+// their encoded form as provided by the caller.
+func decodeAddrUtxoIndexAddrs(s *rpcServer, encodedAddrs []string,
+	includeMempool bool) ([]btcutil.Address, []string, error) {
+
+	// Respond with an error if the required indexes are not enabled.
+	if s.cfg.AddrUtxoIndex == nil {
+		return nil, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Address utxo index must be enabled (--addrutxoindex)",
+		}
+	}
+	if includeMempool && s.cfg.AddrIndex == nil {
+		return nil, nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "Address index must be enabled (--addrindex) " +
+				"to include unconfirmed transactions",
+		}
+	}
+
+	params := s.cfg.ChainParams
+	addrs := make([]btcutil.Address, 0, len(encodedAddrs))
+	uniqueAddrs := make([]string, 0, len(encodedAddrs))
+	seen := make(map[string]struct{}, len(encodedAddrs))
+	for _, encodedAddr := range encodedAddrs {
+		addr, err := btcutil.DecodeAddress(encodedAddr, params)
+		if err != nil {
+			return nil, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + err.Error(),
+			}
+		}
+
+		// Ensure the address is one of the types supported by the
+		// index and that the network encoded with the address matches
+		// the network the server is currently on.
+		switch addr.(type) {
+		case *btcutil.AddressPubKeyHash:
+		case *btcutil.AddressScriptHash:
+		case *btcutil.AddressPubKey:
+		case *btcutil.AddressWitnessPubKeyHash:
+		case *btcutil.AddressWitnessScriptHash:
+		case *btcutil.AddressTaproot:
+		default:
+			return nil, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Unsupported address type: " + encodedAddr,
+			}
+		}
+		if !addr.IsForNet(params) {
+			return nil, nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address: " + encodedAddr +
+					" is for the wrong network",
+			}
+		}
+
+		if _, ok := seen[encodedAddr]; ok {
+			continue
+		}
+		seen[encodedAddr] = struct{}{}
+		addrs = append(addrs, addr)
+		uniqueAddrs = append(uniqueAddrs, encodedAddr)
+	}
+
+	return addrs, uniqueAddrs, nil
+}
+
+// mempoolAddrDelta describes a change to the balance of an address made by an
+// unconfirmed transaction in the memory pool.
+type mempoolAddrDelta struct {
+	tx       *btcutil.Tx
+	index    uint32
+	spending bool
+	amount   int64
+	pkScript []byte
+}
+
+// fetchMempoolAddrDeltas returns the changes to the balance of the passed
+// address made by the transactions in the memory pool.  The transactions are
+// located with the unconfirmed portion of the address index and the outputs
+// they spend are looked up in the memory pool and then the utxo set.  The
+// results are ordered by transaction hash and then by their position within
+// the transaction.
+func fetchMempoolAddrDeltas(s *rpcServer, addr btcutil.Address) []mempoolAddrDelta {
+	idx := s.cfg.AddrUtxoIndex
+	txns := s.cfg.AddrIndex.UnconfirmedTxnsForAddress(addr)
+	sort.Slice(txns, func(i, j int) bool {
+		return bytes.Compare(txns[i].Hash()[:], txns[j].Hash()[:]) < 0
+	})
+
+	var deltas []mempoolAddrDelta
+	for _, tx := range txns {
+		for i, txIn := range tx.MsgTx().TxIn {
+			var amount int64
+			var pkScript []byte
+			prevOut := txIn.PreviousOutPoint
+			prevTx, _, err := s.cfg.TxMemPool.FetchTransaction(&prevOut.Hash)
+			if err == nil {
+				prevTxOuts := prevTx.MsgTx().TxOut
+				if prevOut.Index >= uint32(len(prevTxOuts)) {
+					continue
+				}
+				amount = prevTxOuts[prevOut.Index].Value
+				pkScript = prevTxOuts[prevOut.Index].PkScript
+			} else {
+				entry, err := s.cfg.Chain.FetchUtxoEntry(prevOut)
+				if err != nil || entry == nil || entry.IsSpent() {
+					continue
+				}
+				amount = entry.Amount()
+				pkScript = entry.PkScript()
+			}
+			if !idx.PkScriptPaysToAddr(pkScript, addr) {
+				continue
+			}
+
+			deltas = append(deltas, mempoolAddrDelta{
+				tx:       tx,
+				index:    uint32(i),
+				spending: true,
+				amount:   -amount,
+				pkScript: pkScript,
+			})
+		}
+
+		for i, txOut := range tx.MsgTx().TxOut {
+			if !idx.PkScriptPaysToAddr(txOut.PkScript, addr) {
+				continue
+			}
+
+			deltas = append(deltas, mempoolAddrDelta{
+				tx:       tx,
+				index:    uint32(i),
+				amount:   txOut.Value,
+				pkScript: txOut.PkScript,
+			})
+		}
+	}
+
+	return deltas
+}
+
+// handleGetAddressBalance implements the getaddressbalance command.
+func handleGetAddressBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressBalanceCmd)
+
+	includeMempool := c.IncludeMempool != nil && *c.IncludeMempool
+	addrs, _, err := decodeAddrUtxoIndexAddrs(s, c.Addresses, includeMempool)
+	if err != nil {
+		return nil, err
+	}
+
+	var balance, received, unconfirmed int64
+	for _, addr := range addrs {
+		addrBalance, addrReceived, err :=
+			s.cfg.AddrUtxoIndex.BalanceForAddress(addr)
+		if err != nil {
+			context := "Failed to fetch address balance"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		balance += addrBalance
+		received += addrReceived
+
+		if includeMempool {
+			for _, delta := range fetchMempoolAddrDeltas(s, addr) {
+				unconfirmed += delta.amount
+			}
+		}
+	}
+
+	return &btcjson.GetAddressBalanceResult{
+		Balance:     btcutil.Amount(balance).ToBTC(),
+		Received:    btcutil.Amount(received).ToBTC(),
+		Unconfirmed: btcutil.Amount(unconfirmed).ToBTC(),
+	}, nil
+}
+
+// handleGetAddressDeltas implements the getaddressdeltas command.
+func handleGetAddressDeltas(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressDeltasCmd)
+
+	includeMempool := c.IncludeMempool != nil && *c.IncludeMempool
+	addrs, encodedAddrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses,
+		includeMempool)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default to the entire main chain when no height range is specified.
+	// Unconfirmed changes are only included when the range is open ended.
+	best := s.cfg.Chain.BestSnapshot()
+	startHeight, endHeight := int32(0), best.Height
+	if c.Start != nil {
+		startHeight = *c.Start
+	}
+	if c.End != nil {
+		endHeight = *c.End
+		includeMempool = false
+	}
+	if startHeight < 0 || endHeight < startHeight {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Start height must be non-negative and not exceed the end height",
+		}
+	}
+
+	deltas := make([]btcjson.GetAddressDeltasResult, 0)
+	for i, addr := range addrs {
+		addrDeltas, err := s.cfg.AddrUtxoIndex.DeltasForAddress(addr,
+			startHeight, endHeight)
+		if err != nil {
+			context := "Failed to fetch address deltas"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		for _, delta := range addrDeltas {
+			deltas = append(deltas, btcjson.GetAddressDeltasResult{
+				Address:       encodedAddrs[i],
+				TxID:          delta.TxHash.String(),
+				Index:         delta.Index,
+				Spending:      delta.Spending,
+				BlockIndex:    delta.BlockIndex,
+				Height:        delta.Height,
+				Confirmations: int64(1 + best.Height - delta.Height),
+				Amount:        btcutil.Amount(delta.Amount).ToBTC(),
+			})
+		}
+
+		if !includeMempool {
+			continue
+		}
+		for _, delta := range fetchMempoolAddrDeltas(s, addr) {
+			deltas = append(deltas, btcjson.GetAddressDeltasResult{
+				Address:  encodedAddrs[i],
+				TxID:     delta.tx.Hash().String(),
+				Index:    delta.index,
+				Spending: delta.spending,
+				Amount:   btcutil.Amount(delta.amount).ToBTC(),
+			})
+		}
+	}
+
+	return deltas, nil
+}
+
+// handleGetAddressUtxos implements the getaddressutxos command.
+func handleGetAddressUtxos(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressUtxosCmd)
+
+	includeMempool := c.IncludeMempool != nil && *c.IncludeMempool
+	addrs, encodedAddrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses,
+		includeMempool)
+	if err != nil {
+		return nil, err
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	utxos := make([]btcjson.GetAddressUtxosResult, 0)
+	for i, addr := range addrs {
+		addrUtxos, err := s.cfg.AddrUtxoIndex.UtxosForAddress(addr)
+		if err != nil {
+			context := "Failed to fetch address utxos"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		for _, utxo := range addrUtxos {
+			// Outputs spent by unconfirmed transactions are no
+			// longer spendable when they are included.
+			if includeMempool &&
+				s.cfg.TxMemPool.CheckSpend(utxo.OutPoint) != nil {
+				continue
+			}
+
+			utxos = append(utxos, btcjson.GetAddressUtxosResult{
+				Address:       encodedAddrs[i],
+				TxID:          utxo.OutPoint.Hash.String(),
+				Vout:          utxo.OutPoint.Index,
+				ScriptPubKey:  hex.EncodeToString(utxo.PkScript),
+				Amount:        btcutil.Amount(utxo.Amount).ToBTC(),
+				Height:        utxo.Height,
+				Confirmations: int64(1 + best.Height - utxo.Height),
+				Coinbase:      utxo.IsCoinBase,
+			})
+		}
+
+		if !includeMempool {
+			continue
+		}
+		for _, delta := range fetchMempoolAddrDeltas(s, addr) {
+			outpoint := wire.OutPoint{
+				Hash:  *delta.tx.Hash(),
+				Index: delta.index,
+			}
+			if delta.spending || s.cfg.TxMemPool.CheckSpend(outpoint) != nil {
+				continue
+			}
+
+			utxos = append(utxos, btcjson.GetAddressUtxosResult{
+				Address:      encodedAddrs[i],
+				TxID:         outpoint.Hash.String(),
+				Vout:         outpoint.Index,
+				ScriptPubKey: hex.EncodeToString(delta.pkScript),
+				Amount:       btcutil.Amount(delta.amount).ToBTC(),
+			})
+		}
+	}
+
+	return utxos, nil
+}
+
 // handleGetBestBlock implements the getbestblock command.
 func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// All other "get block" commands give either the height, the
@@ -1239,6 +1868,20 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 		blockReply.Tx = txNames
 	} else {
+		// A verbosity of 3 or more additionally includes the outputs
+		// spent by each input along with the fee of each transaction.
+		// They are loaded from the spend journal so no transaction
+		// index is required.
+		var stxos []blockchain.SpentTxOut
+		withPrevouts := *c.Verbosity >= 3
+		if withPrevouts {
+			stxos, err = s.cfg.Chain.FetchSpendJournal(blk)
+			if err != nil {
+				context := "Failed to fetch spend journal"
+				return nil, internalRPCError(err.Error(), context)
+			}
+		}
+
 		txns := blk.Transactions()
 		rawTxns := make([]btcjson.TxRawResult, len(txns))
 		for i, tx := range txns {
@@ -1248,6 +1891,21 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 			if err != nil {
 				return nil, err
 			}
+
+			// The coinbase does not spend any outputs, so the spend
+			// journal only contains entries for the others.
+			if withPrevouts && i > 0 {
+				numInputs := len(tx.MsgTx().TxIn)
+				if len(stxos) < numInputs {
+					context := "Spend journal is missing entries"
+					return nil, internalRPCError(fmt.Sprintf(
+						"block %v has fewer spent outputs than "+
+							"inputs", hash), context)
+				}
+				addTxPrevouts(rawTxn, tx.MsgTx(), stxos[:numInputs],
+					params)
+				stxos = stxos[numInputs:]
+			}
 			rawTxns[i] = *rawTxn
 		}
 		blockReply.RawTx = rawTxns
@@ -1349,6 +2007,9 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		case chaincfg.DeploymentSegwit:
 			forkName = "segwit"
 
+		case chaincfg.DeploymentTaproot:
+			forkName = "taproot"
+
 		default:
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCInternal.Code,
@@ -1486,6 +2147,283 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return blockHeaderReply, nil
 }
 
+// perUtxoOverhead is the approximate number of bytes a utxo set entry takes in
+// addition to its serialized output.  It matches the outpoint, height and
+// coinbase flag accounted for by Bitcoin Core so the utxo_size_inc statistic is
+// comparable.
+const perUtxoOverhead = 41
+
+// feeRatePercentiles are the weight percentiles reported by the
+// feerate_percentiles statistic of the getblockstats command.
+var feeRatePercentiles = []float64{0.10, 0.25, 0.50, 0.75, 0.90}
+
+// truncatedMedian returns the median of the passed values, averaging the two
+// middle values when there is an even number of them.  The slice is sorted in
+// place.
+func truncatedMedian(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// calcBlockStats computes the statistics reported by the getblockstats command
+// for the passed block using the spent outputs from its spend journal entry to
+// determine input values.  The coinbase transaction is excluded from all fee,
+// size and weight statistics.
+func calcBlockStats(params *chaincfg.Params, block *btcutil.Block,
+	medianTime time.Time, stxos []blockchain.SpentTxOut) (*btcjson.GetBlockStatsResult, error) {
+
+	msgBlock := block.MsgBlock()
+	stats := &btcjson.GetBlockStatsResult{
+		Hash:       block.Hash().String(),
+		Height:     int64(block.Height()),
+		MedianTime: medianTime.Unix(),
+		Time:       msgBlock.Header.Timestamp.Unix(),
+		Subsidy:    blockchain.CalcBlockSubsidy(block.Height(), params),
+		Txs:        int64(len(msgBlock.Transactions)),
+	}
+	for _, data := range msgBlock.PosData {
+		stats.CommitmentData += int64(len(data))
+	}
+
+	type feeRateWeight struct {
+		feeRate int64
+		weight  int64
+	}
+	var (
+		fees, sizes []int64
+		feeRates    []feeRateWeight
+		stxoIdx     int
+		minFee      int64 = -1
+		minFeeRate  int64 = -1
+		minTxSize   int64 = -1
+	)
+	for i, tx := range block.Transactions() {
+		msgTx := tx.MsgTx()
+		if msgTx.HasPosCommitment() {
+			stats.Commitments++
+		}
+
+		// Every output adds to the utxo set unless it is provably
+		// unspendable.
+		stats.Outs += int64(len(msgTx.TxOut))
+		var totalOut int64
+		for _, txOut := range msgTx.TxOut {
+			totalOut += txOut.Value
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			stats.UTXOIncrease++
+			stats.UTXOSizeIncrease += int64(txOut.SerializeSize()) +
+				perUtxoOverhead
+		}
+
+		// The remaining statistics only cover transactions that pay
+		// fees.
+		if i == 0 {
+			continue
+		}
+
+		// Every input removes the output it spends from the utxo set.
+		var totalIn int64
+		for range msgTx.TxIn {
+			if stxoIdx >= len(stxos) {
+				return nil, fmt.Errorf("spend journal for block %v "+
+					"has %d entries, which is too few for its "+
+					"inputs", block.Hash(), len(stxos))
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+
+			totalIn += stxo.Amount
+			spent := wire.NewTxOut(stxo.Amount, stxo.PkScript)
+			stats.UTXOIncrease--
+			stats.UTXOSizeIncrease -= int64(spent.SerializeSize()) +
+				perUtxoOverhead
+		}
+		stats.Ins += int64(len(msgTx.TxIn))
+		stats.TotalOut += totalOut
+
+		size := int64(msgTx.SerializeSize())
+		weight := blockchain.GetTransactionWeight(tx)
+		vsize := (weight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor
+		fee := totalIn - totalOut
+		feeRate := fee / vsize
+
+		stats.TotalFee += fee
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if msgTx.HasWitness() {
+			stats.SegWitTxs++
+			stats.SegWitTotalSize += size
+			stats.SegWitTotalWeight += weight
+		}
+
+		if fee > stats.MaxFee {
+			stats.MaxFee = fee
+		}
+		if minFee == -1 || fee < minFee {
+			minFee = fee
+		}
+		if feeRate > stats.MaxFeeRate {
+			stats.MaxFeeRate = feeRate
+		}
+		if minFeeRate == -1 || feeRate < minFeeRate {
+			minFeeRate = feeRate
+		}
+		if size > stats.MaxTxSize {
+			stats.MaxTxSize = size
+		}
+		if minTxSize == -1 || size < minTxSize {
+			minTxSize = size
+		}
+
+		fees = append(fees, fee)
+		sizes = append(sizes, size)
+		feeRates = append(feeRates, feeRateWeight{feeRate, weight})
+	}
+
+	// Convert the untouched minimums of blocks with only a coinbase to
+	// zero.
+	if minFee != -1 {
+		stats.MinFee = minFee
+		stats.MinFeeRate = minFeeRate
+		stats.MinTxSize = minTxSize
+	}
+
+	numTxns := int64(len(fees))
+	if numTxns > 0 {
+		stats.AverageFee = stats.TotalFee / numTxns
+		stats.AverageTxSize = stats.TotalSize / numTxns
+	}
+	if stats.TotalWeight > 0 {
+		stats.AverageFeeRate = stats.TotalFee *
+			blockchain.WitnessScaleFactor / stats.TotalWeight
+	}
+	stats.MedianFee = truncatedMedian(fees)
+	stats.MedianTxSize = truncatedMedian(sizes)
+
+	// Calculate the fee rates at each of the weight percentiles by walking
+	// the transactions in order of increasing fee rate.
+	stats.FeeratePercentiles = make([]int64, len(feeRatePercentiles))
+	if len(feeRates) > 0 {
+		sort.SliceStable(feeRates, func(i, j int) bool {
+			return feeRates[i].feeRate < feeRates[j].feeRate
+		})
+		var cumulative int64
+		next := 0
+		for _, fr := range feeRates {
+			cumulative += fr.weight
+			for next < len(feeRatePercentiles) && float64(cumulative) >=
+				float64(stats.TotalWeight)*feeRatePercentiles[next] {
+
+				stats.FeeratePercentiles[next] = fr.feeRate
+				next++
+			}
+		}
+		for ; next < len(feeRatePercentiles); next++ {
+			stats.FeeratePercentiles[next] = feeRates[len(feeRates)-1].feeRate
+		}
+	}
+
+	return stats, nil
+}
+
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	// Look up the main chain block by either its height or hash.
+	var hash *chainhash.Hash
+	switch v := c.HashOrHeight.Value.(type) {
+	case int:
+		var err error
+		hash, err = s.cfg.Chain.BlockHashByHeight(int32(v))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCOutOfRange,
+				Message: "Block number out of range",
+			}
+		}
+	case string:
+		var err error
+		hash, err = chainhash.NewHashFromStr(v)
+		if err != nil {
+			return nil, rpcDecodeHexError(v)
+		}
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The hash_or_height parameter must be a height or a block hash",
+		}
+	}
+	if !s.cfg.Chain.MainChainHasBlock(hash) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found in the main chain",
+		}
+	}
+	block, err := s.cfg.Chain.BlockByHash(hash)
+	if err != nil {
+		context := "Failed to fetch block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	// The spend journal provides the values of all outputs spent by the
+	// block, which are needed to compute fees without a transaction index.
+	stxos, err := s.cfg.Chain.FetchSpendJournal(block)
+	if err != nil {
+		context := "Failed to fetch spend journal"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	medianTime, err := s.cfg.Chain.MedianTimeByHash(hash)
+	if err != nil {
+		context := "Failed to obtain median time"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	stats, err := calcBlockStats(s.cfg.ChainParams, block, medianTime, stxos)
+	if err != nil {
+		context := "Failed to calculate block stats"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if c.Stats == nil || len(*c.Stats) == 0 {
+		return stats, nil
+	}
+
+	// Only return the selected statistics.  They are keyed by the same
+	// names used in the full result, so round trip it through JSON to
+	// select them by name.
+	statsJSON, err := json.Marshal(stats)
+	if err != nil {
+		context := "Failed to marshal block stats"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var allStats map[string]json.RawMessage
+	if err := json.Unmarshal(statsJSON, &allStats); err != nil {
+		context := "Failed to unmarshal block stats"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	selected := make(map[string]json.RawMessage, len(*c.Stats))
+	for _, name := range *c.Stats {
+		value, ok := allStats[name]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid selected statistic %s", name),
+			}
+		}
+		selected[name] = value
+	}
+	return selected, nil
+}
+
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
 func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
@@ -2339,14 +3277,59 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetChainTips implements the getchaintips command.
+func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	chainTips := s.cfg.Chain.ChainTips()
+	results := make([]btcjson.GetChainTipsResult, 0, len(chainTips))
+	for _, tip := range chainTips {
+		results = append(results, btcjson.GetChainTipsResult{
+			Height:    tip.Height,
+			Hash:      tip.Hash.String(),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status.String(),
+		})
+	}
+	return results, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
 }
 
-// handleGetCurrentNet implements the getcurrentnet command.
-func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	return s.cfg.ChainParams.Net, nil
+// handleGetCurrentNet implements the getcurrentnet command.
+func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.cfg.ChainParams.Net, nil
+}
+
+// handleGetDescriptorInfo implements the getdescriptorinfo command.
+func handleGetDescriptorInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDescriptorInfoCmd)
+
+	desc, err := parseDescriptor(s, c.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	// The checksum is that of the descriptor as passed, which parsing
+	// already ensured is valid.
+	body := c.Descriptor
+	if idx := strings.IndexByte(body, '#'); idx >= 0 {
+		body = body[:idx]
+	}
+	checksum, err := descriptor.Checksum(body)
+	if err != nil {
+		context := "Failed to compute descriptor checksum"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.GetDescriptorInfoResult{
+		Descriptor:     desc.String(),
+		Checksum:       checksum,
+		IsRange:        desc.IsRange(),
+		IsSolvable:     desc.IsSolvable(),
+		HasPrivateKeys: desc.HasPrivateKeys(),
+	}, nil
 }
 
 // handleGetDifficulty implements the getdifficulty command.
@@ -2420,6 +3403,7 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		Difficulty:      getDifficultyRatio(best.Bits, s.cfg.ChainParams),
 		TestNet:         cfg.TestNet3,
 		RelayFee:        cfg.minRelayTxFee.ToBTC(),
+		ASMapChecksum:   s.cfg.ConnMgr.ASMapChecksum(),
 	}
 
 	return ret, nil
@@ -2481,10 +3465,19 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 // handleGetNetTotals implements the getnettotals command.
 func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
+	uploadTarget := s.cfg.ConnMgr.UploadTarget()
 	reply := &btcjson.GetNetTotalsResult{
 		TotalBytesRecv: totalBytesRecv,
 		TotalBytesSent: totalBytesSent,
 		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		UploadTarget: btcjson.UploadTargetResult{
+			TimeFrame:             int64(uploadTargetTimeframe.Seconds()),
+			Target:                uploadTarget.target,
+			TargetReached:         uploadTarget.targetReached,
+			ServeHistoricalBlocks: uploadTarget.serveHistoricalBlocks,
+			BytesLeftInCycle:      uploadTarget.bytesLeftInCycle,
+			TimeLeftInCycle:       int64(uploadTarget.timeLeftInCycle.Seconds()),
+		},
 	}
 	return reply, nil
 }
@@ -2608,8 +3601,9 @@ func handleGetNodeAddresses(s *rpcServer, cmd interface{}, closeChan <-chan stru
 		address := &btcjson.GetNodeAddressesResult{
 			Time:     node.Timestamp.Unix(),
 			Services: uint64(node.Services),
-			Address:  node.IP.String(),
+			Address:  node.Host(),
 			Port:     node.Port,
+			Network:  addrmgr.NetworkName(node),
 		}
 		addresses = append(addresses, address)
 	}
@@ -2640,6 +3634,8 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			Version:        statsSnap.Version,
 			SubVer:         statsSnap.UserAgent,
 			Inbound:        statsSnap.Inbound,
+			ConnectionType: p.ConnectionType(),
+			MappedAS:       p.MappedAS(),
 			StartingHeight: statsSnap.StartingHeight,
 			CurrentHeight:  statsSnap.LastBlock,
 			BanScore:       int32(p.BanScore()),
@@ -3174,6 +4170,232 @@ func fetchMempoolTxnsForAddress(s *rpcServer, addr btcutil.Address, numToSkip, n
 	return mpTxns[numToSkip:rangeEnd], numToSkip
 }
 
+// handleReconsiderBlock implements the reconsiderblock command.  It approves
+// the branch containing the block so it may become the main chain even if that
+// requires a reorganization deeper than the configured max reorg depth.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ReconsiderBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if !s.cfg.Chain.MainChainHasBlock(hash) {
+		if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+	}
+
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		context := "Failed to reconsider block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return nil, nil
+}
+
+// defaultScanRange is the number of child indexes ranged descriptors are
+// derived at by the scantxoutset command when no range is specified.
+const defaultScanRange = 1000
+
+// utxoScanUpdateInterval is the number of utxos the scantxoutset command scans
+// between updating its progress and checking whether it has been aborted.
+const utxoScanUpdateInterval = 10000
+
+// errUtxoScanAborted is used to stop a scan of the utxo set that has been
+// aborted.
+var errUtxoScanAborted = errors.New("utxo set scan aborted")
+
+// utxoScanState houses the state of the scan of the utxo set started by the
+// scantxoutset command, of which only a single one may be in progress.
+type utxoScanState struct {
+	sync.Mutex
+	inProgress bool
+	progress   float64
+	abort      chan struct{}
+	aborted    bool
+}
+
+// handleScanTxOutSet implements the scantxoutset command.
+func handleScanTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ScanTxOutSetCmd)
+
+	state := &s.utxoScan
+	switch c.Action {
+	case btcjson.ScanTxOutSetStart:
+		return scanTxOutSet(s, c.ScanObjects, closeChan)
+
+	case btcjson.ScanTxOutSetAbort:
+		state.Lock()
+		defer state.Unlock()
+		if !state.inProgress || state.aborted {
+			return false, nil
+		}
+		close(state.abort)
+		state.aborted = true
+		return true, nil
+
+	case btcjson.ScanTxOutSetStatus:
+		state.Lock()
+		defer state.Unlock()
+		if !state.inProgress {
+			return nil, nil
+		}
+		return &btcjson.ScanTxOutSetStatusResult{
+			Progress: state.progress,
+		}, nil
+	}
+
+	return nil, &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInvalidParameter,
+		Message: fmt.Sprintf("Invalid action '%s'", c.Action),
+	}
+}
+
+// inferDescriptor returns a descriptor for the passed output script, which is
+// an addr descriptor when the script has an address and a raw descriptor
+// otherwise.
+func inferDescriptor(pkScript []byte, params *chaincfg.Params) string {
+	desc := "raw(" + hex.EncodeToString(pkScript) + ")"
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err == nil && len(addrs) == 1 && class != txscript.PubKeyTy {
+		desc = "addr(" + addrs[0].EncodeAddress() + ")"
+	}
+
+	// The descriptor only contains characters the checksum is defined for.
+	desc, _ = descriptor.AddChecksum(desc)
+	return desc
+}
+
+// scanTxOutSet scans the utxo set for the outputs paying to the scripts of the
+// passed scan objects for the scantxoutset command.
+func scanTxOutSet(s *rpcServer, scanObjects *[]btcjson.ScanTxOutSetObject,
+	closeChan <-chan struct{}) (interface{}, error) {
+
+	if scanObjects == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "scanobjects argument is required for the start action",
+		}
+	}
+
+	// Derive the set of scripts to scan for.
+	scripts := make(map[string]struct{})
+	for _, obj := range *scanObjects {
+		desc, err := parseDescriptor(s, obj.Desc)
+		if err != nil {
+			return nil, err
+		}
+
+		begin, end := 0, 0
+		if desc.IsRange() {
+			end = defaultScanRange - 1
+			if obj.Range != nil {
+				begin, end, err = parseDescriptorRange(obj.Range)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		for i := begin; i <= end; i++ {
+			script, err := desc.Script(uint32(i))
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidAddressOrKey,
+					Message: err.Error(),
+				}
+			}
+			scripts[string(script)] = struct{}{}
+		}
+	}
+
+	// Only a single scan may be in progress at a time.
+	state := &s.utxoScan
+	state.Lock()
+	if state.inProgress {
+		state.Unlock()
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Scan already in progress, use action " +
+				"\"abort\" or \"status\"",
+		}
+	}
+	abort := make(chan struct{})
+	state.inProgress = true
+	state.progress = 0
+	state.abort = abort
+	state.aborted = false
+	state.Unlock()
+	defer func() {
+		state.Lock()
+		state.inProgress = false
+		state.Unlock()
+	}()
+
+	result := &btcjson.ScanTxOutSetResult{
+		Success:  true,
+		Unspents: []btcjson.ScanTxOutSetUnspent{},
+	}
+	var totalAmount btcutil.Amount
+	bestAtStart := s.cfg.Chain.BestSnapshot()
+	best, err := s.cfg.Chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *blockchain.UtxoEntry) error {
+		result.TxOuts++
+		if result.TxOuts%utxoScanUpdateInterval == 0 {
+			select {
+			case <-abort:
+				return errUtxoScanAborted
+			case <-closeChan:
+				return ErrClientQuit
+			case <-s.quit:
+				return ErrClientQuit
+			default:
+			}
+
+			// The utxos are iterated in the order of their
+			// transaction hashes, so the progress is estimated from
+			// the position of the leading bytes of the current hash.
+			progress := float64(outpoint.Hash[0])*100/256 +
+				float64(outpoint.Hash[1])*100/65536
+			state.Lock()
+			state.progress = progress
+			state.Unlock()
+		}
+
+		pkScript := entry.PkScript()
+		if _, ok := scripts[string(pkScript)]; !ok {
+			return nil
+		}
+		amount := btcutil.Amount(entry.Amount())
+		totalAmount += amount
+		result.Unspents = append(result.Unspents, btcjson.ScanTxOutSetUnspent{
+			TxID:         outpoint.Hash.String(),
+			Vout:         outpoint.Index,
+			ScriptPubKey: hex.EncodeToString(pkScript),
+			Desc:         inferDescriptor(pkScript, s.cfg.ChainParams),
+			Amount:       amount.ToBTC(),
+			Height:       entry.BlockHeight(),
+		})
+		return nil
+	})
+	switch {
+	case err == errUtxoScanAborted:
+		// An aborted scan returns the outputs found so far along with
+		// the best state it started at.
+		result.Success = false
+		best = bestAtStart
+
+	case err != nil:
+		return nil, err
+	}
+
+	result.Height = best.Height
+	result.BestBlock = best.Hash.String()
+	result.TotalAmount = totalAmount.ToBTC()
+	return result, nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
@@ -3680,6 +4902,325 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SubmitPackageCmd)
+
+	if len(c.RawTxs) == 0 || len(c.RawTxs) > mempool.MaxPackageCount {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Array must contain between 1 and "+
+				"%d transactions", mempool.MaxPackageCount),
+		}
+	}
+	if c.HexData != nil && len(*c.HexData) != len(c.RawTxs) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Array of data must match the array of transactions",
+		}
+	}
+
+	// Deserialize the package transactions along with their data.
+	txns := make([]*btcutil.Tx, 0, len(c.RawTxs))
+	for _, hexStr := range c.RawTxs {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, btcutil.NewTx(&msgTx))
+	}
+	var posData [][]byte
+	if c.HexData != nil {
+		posData = make([][]byte, 0, len(*c.HexData))
+		for _, hexStr := range *c.HexData {
+			if len(hexStr)%2 != 0 {
+				hexStr = "0" + hexStr
+			}
+			data, err := hex.DecodeString(hexStr)
+			if err != nil {
+				return nil, rpcDecodeHexError(hexStr)
+			}
+			posData = append(posData, data)
+		}
+	}
+
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessPackage(txns, posData)
+
+	// Relay and notify the transactions accepted into the memory pool even
+	// when the rest of the package was rejected.
+	if len(acceptedTxs) > 0 {
+		s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+		s.NotifyNewTransactions(acceptedTxs)
+	}
+	child := txns[len(txns)-1]
+	if err != nil {
+		// When the error is a rule error, it means the package was
+		// simply rejected as opposed to something actually going
+		// wrong, so log it as such.
+		code := btcjson.ErrRPCTxRejected
+		if _, ok := err.(mempool.RuleError); ok {
+			rpcsLog.Debugf("Rejected package of transaction %v: %v",
+				child.Hash(), err)
+		} else {
+			rpcsLog.Errorf("Failed to process package of "+
+				"transaction %v: %v", child.Hash(), err)
+			code = btcjson.ErrRPCTxError
+		}
+
+		return nil, &btcjson.RPCError{
+			Code:    code,
+			Message: "Package rejected: " + err.Error(),
+		}
+	}
+
+	// Keep track of the accepted package transactions so that they can be
+	// rebroadcast if they don't make their way into a block, and report
+	// their fees.
+	accepted := make(map[chainhash.Hash]*mempool.TxDesc, len(acceptedTxs))
+	for _, txD := range acceptedTxs {
+		accepted[*txD.Tx.Hash()] = txD
+	}
+	result := &btcjson.SubmitPackageResult{
+		PackageMsg: "success",
+		TxResults:  make(map[string]btcjson.SubmitPackageTxResult, len(txns)),
+	}
+	for _, tx := range txns {
+		txResult := btcjson.SubmitPackageTxResult{
+			TxID:  tx.Hash().String(),
+			VSize: int32(mempool.GetTxVirtualSize(tx)),
+		}
+		if txD, ok := accepted[*tx.Hash()]; ok {
+			iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+			s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+
+			txResult.Fees = &btcjson.SubmitPackageFees{
+				Base: btcutil.Amount(txD.Fee).ToBTC(),
+			}
+		}
+		result.TxResults[tx.WitnessHash().String()] = txResult
+	}
+
+	return result, nil
+}
+
+// handleTraceTransaction implements the tracetransaction command.
+func handleTraceTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TraceTransactionCmd)
+
+	mtx, err := decodeTraceTx(c.HexTx)
+	if err != nil {
+		return nil, err
+	}
+	if blockchain.IsCoinBaseTx(mtx) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Coinbase transactions have no scripts to trace",
+		}
+	}
+
+	// Trace all of the inputs unless a specific one was requested.
+	start, end := 0, len(mtx.TxIn)
+	if c.Vin != nil {
+		if *c.Vin >= uint32(len(mtx.TxIn)) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Input index number (vin) does not exist for transaction.",
+			}
+		}
+		start, end = int(*c.Vin), int(*c.Vin)+1
+	}
+
+	prevOuts, err := fetchTracePrevOuts(s, mtx)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := traceScriptFlags(s)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]btcjson.TraceScriptResult, 0, end-start)
+	for txIdx := start; txIdx < end; txIdx++ {
+		prevOutPoint := mtx.TxIn[txIdx].PreviousOutPoint
+		prevOut := prevOuts.FetchPrevOutput(prevOutPoint)
+		if prevOut == nil {
+			results = append(results, btcjson.TraceScriptResult{
+				TxID:  mtx.TxHash().String(),
+				Vin:   uint32(txIdx),
+				Error: fmt.Sprintf("unable to find output %v", prevOutPoint),
+				Steps: []btcjson.ScriptTraceStep{},
+			})
+			continue
+		}
+
+		result := traceTxInput(mtx, txIdx, prevOut, prevOuts, flags)
+		results = append(results, *result)
+	}
+
+	return results, nil
+}
+
+// decodeTraceTx decodes the hex-encoded transaction passed to the debugscript
+// and tracetransaction commands.
+func decodeTraceTx(hexStr string) (*wire.MsgTx, error) {
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var mtx wire.MsgTx
+	err = mtx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+
+	return &mtx, nil
+}
+
+// fetchTracePrevOuts returns a previous output fetcher for the outputs spent
+// by the passed transaction.  The outputs are looked up in the memory pool and
+// the utxo set, and then via the transaction index when it is enabled, which
+// allows tracing transactions that have already been mined.  Outputs that
+// can't be found are left out of the fetcher.
+func fetchTracePrevOuts(s *rpcServer, mtx *wire.MsgTx) (*txscript.MultiPrevOutFetcher, error) {
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	var missing []wire.OutPoint
+	for _, txIn := range mtx.TxIn {
+		prevOutPoint := txIn.PreviousOutPoint
+		originTx, _, err := s.cfg.TxMemPool.FetchTransaction(&prevOutPoint.Hash)
+		if err == nil {
+			txOuts := originTx.MsgTx().TxOut
+			if prevOutPoint.Index < uint32(len(txOuts)) {
+				prevOuts.AddPrevOut(prevOutPoint, txOuts[prevOutPoint.Index])
+			}
+			continue
+		}
+
+		entry, err := s.cfg.Chain.FetchUtxoEntry(prevOutPoint)
+		if err != nil {
+			context := "Failed to fetch utxo"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if entry == nil || entry.IsSpent() {
+			missing = append(missing, prevOutPoint)
+			continue
+		}
+		prevOuts.AddPrevOut(prevOutPoint, wire.NewTxOut(entry.Amount(),
+			entry.PkScript()))
+	}
+
+	if len(missing) == 0 || s.cfg.TxIndex == nil {
+		return prevOuts, nil
+	}
+
+	// Ignore the error since outputs that can't be found via the
+	// transaction index are simply left out.
+	originOutputs, _ := fetchInputTxos(s, mtx)
+	for _, prevOutPoint := range missing {
+		if txOut, ok := originOutputs[prevOutPoint]; ok {
+			txOut := txOut
+			prevOuts.AddPrevOut(prevOutPoint, &txOut)
+		}
+	}
+
+	return prevOuts, nil
+}
+
+// traceScriptFlags returns the script flags used by the debugscript and
+// tracetransaction commands, which are the same flags the memory pool uses to
+// validate transactions.
+func traceScriptFlags(s *rpcServer) (txscript.ScriptFlags, error) {
+	flags := txscript.StandardVerifyFlags
+	taprootActive, err := s.cfg.Chain.IsDeploymentActive(
+		chaincfg.DeploymentTaproot,
+	)
+	if err != nil {
+		context := "Failed to check taproot deployment state"
+		return 0, internalRPCError(err.Error(), context)
+	}
+	if !taprootActive {
+		flags &^= txscript.ScriptVerifyTaproot
+	}
+
+	return flags, nil
+}
+
+// traceTxInput executes the scripts of the passed transaction input against
+// the output it spends and returns the result along with the trace of every
+// opcode that was executed.
+func traceTxInput(mtx *wire.MsgTx, txIdx int, prevOut *wire.TxOut,
+	prevOuts txscript.PrevOutputFetcher,
+	flags txscript.ScriptFlags) *btcjson.TraceScriptResult {
+
+	result := &btcjson.TraceScriptResult{
+		TxID:         mtx.TxHash().String(),
+		Vin:          uint32(txIdx),
+		ScriptPubKey: hex.EncodeToString(prevOut.PkScript),
+		Amount:       btcutil.Amount(prevOut.Value).ToBTC(),
+	}
+
+	var recorder txscript.TraceRecorder
+	sigHashes := txscript.NewTxSigHashes(mtx, prevOuts)
+	vm, err := txscript.NewEngine(prevOut.PkScript, mtx, txIdx, flags, nil,
+		sigHashes, prevOut.Value, prevOuts)
+	if err == nil {
+		vm.SetTracer(&recorder)
+		err = vm.Execute()
+	}
+
+	result.Steps = make([]btcjson.ScriptTraceStep, 0, len(recorder.Steps))
+	for _, step := range recorder.Steps {
+		traceStep := btcjson.ScriptTraceStep{
+			Script:   step.ScriptIdx,
+			Index:    step.OpcodeIdx,
+			Opcode:   step.Opcode,
+			Executed: step.Executed,
+			Stack:    make([]string, 0, len(step.Stack)),
+			AltStack: make([]string, 0, len(step.AltStack)),
+		}
+		for _, item := range step.Stack {
+			traceStep.Stack = append(traceStep.Stack,
+				hex.EncodeToString(item))
+		}
+		for _, item := range step.AltStack {
+			traceStep.AltStack = append(traceStep.AltStack,
+				hex.EncodeToString(item))
+		}
+		if step.Err != nil {
+			traceStep.Error = step.Err.Error()
+		}
+		result.Steps = append(result.Steps, traceStep)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		var serr txscript.Error
+		if errors.As(err, &serr) {
+			result.ErrorCode = serr.ErrorCode.String()
+		}
+		return result
+	}
+	result.Valid = true
+
+	return result
+}
+
 // handleUptime implements the uptime command.
 func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
@@ -3721,6 +5262,12 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		result.WitnessVersion = btcjson.Int32(int32(addr.WitnessVersion()))
 		result.WitnessProgram = btcjson.String(hex.EncodeToString(addr.WitnessProgram()))
 
+	case *btcutil.AddressTaproot:
+		result.IsScript = btcjson.Bool(true)
+		result.IsWitness = btcjson.Bool(true)
+		result.WitnessVersion = btcjson.Int32(int32(addr.WitnessVersion()))
+		result.WitnessProgram = btcjson.String(hex.EncodeToString(addr.WitnessProgram()))
+
 	default:
 		// Handle the case when a new Address is supported by btcutil, but none
 		// of the cases were matched in the switch block. The current behaviour
@@ -3877,6 +5424,7 @@ type rpcServer struct {
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
+	utxoScan               utxoScanState
 	quit                   chan int
 }
 
@@ -4566,6 +6114,14 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// ConnectionType returns the type of the connection to the peer.
+	ConnectionType() string
+
+	// MappedAS returns the number of the autonomous system the peer
+	// belongs to according to the asmap in use, or zero when no asmap is
+	// used or the peer is not mapped.
+	MappedAS() uint32
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -4608,6 +6164,10 @@ type rpcserverConnManager interface {
 	// network for all peers.
 	NetTotals() (uint64, uint64)
 
+	// UploadTarget returns the state of the upload target in the current
+	// cycle.
+	UploadTarget() uploadTargetStatus
+
 	// ConnectedPeers returns an array consisting of all connected peers.
 	ConnectedPeers() []rpcserverPeer
 
@@ -4630,7 +6190,26 @@ type rpcserverConnManager interface {
 
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
-	NodeAddresses() []*wire.NetAddress
+	NodeAddresses() []*wire.NetAddressV2
+
+	// BanSubnet bans the provided subnet until the provided time and
+	// disconnects the connected peers which are part of it.
+	BanSubnet(subnet *net.IPNet, until time.Time, reason string)
+
+	// UnbanSubnet lifts the ban of the provided subnet.  It returns whether
+	// the subnet was banned.
+	UnbanSubnet(subnet *net.IPNet) bool
+
+	// ClearBanned lifts all bans.
+	ClearBanned()
+
+	// BannedSubnets returns the bans which are in effect.
+	BannedSubnets() []banEntry
+
+	// ASMapChecksum returns the checksum of the asmap used to group
+	// addresses by autonomous system, or the empty string when no asmap is
+	// used.
+	ASMapChecksum() string
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4701,9 +6280,10 @@ type rpcserverConfig struct {
 
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex       *indexers.TxIndex
+	AddrIndex     *indexers.AddrIndex
+	AddrUtxoIndex *indexers.AddrUtxoIndex
+	CfIndex       *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -4771,6 +6351,17 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients.
 		s.ntfnMgr.NotifyBlockDisconnected(block)
+
+	case blockchain.NTDeepReorg:
+		reorg, ok := notification.Data.(*blockchain.DeepReorg)
+		if !ok {
+			rpcsLog.Warnf("Chain deep reorg notification is not a " +
+				"deep reorg.")
+			break
+		}
+
+		// Notify registered websocket clients of the refused reorg.
+		s.ntfnMgr.NotifyDeepReorg(reorg)
 	}
 }
 
@@ -0,0 +1,1170 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/babylonchain-io/bbld/blockchain"
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcjson"
+	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/btcutil/hdkeychain"
+	"github.com/babylonchain-io/bbld/chaincfg"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/database"
+	_ "github.com/babylonchain-io/bbld/database/ffldb"
+	"github.com/babylonchain-io/bbld/integration/rpctest"
+	"github.com/babylonchain-io/bbld/mempool"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// testConnManager provides a connection manager for the RPC server tests which
+// records the transactions it is asked to relay.  Calling any of the methods
+// it does not implement panics.
+type testConnManager struct {
+	rpcserverConnManager
+	relayed     []*mempool.TxDesc
+	rebroadcast []*wire.InvVect
+}
+
+// RelayTransactions records the passed transactions as relayed.
+func (cm *testConnManager) RelayTransactions(txns []*mempool.TxDesc) {
+	cm.relayed = append(cm.relayed, txns...)
+}
+
+// AddRebroadcastInventory records the passed inventory as rebroadcast.
+func (cm *testConnManager) AddRebroadcastInventory(iv *wire.InvVect, data interface{}) {
+	cm.rebroadcast = append(cm.rebroadcast, iv)
+}
+
+// testSpendableOut is an output paying to the key of an RPC test harness.
+type testSpendableOut struct {
+	outPoint wire.OutPoint
+	amount   int64
+}
+
+// rpcTestHarness houses an RPC server backed by a regression test chain and
+// memory pool along with the key that controls the outputs of the blocks and
+// transactions it creates.
+type rpcTestHarness struct {
+	t         *testing.T
+	params    *chaincfg.Params
+	chain     *blockchain.BlockChain
+	server    *rpcServer
+	connMgr   *testConnManager
+	signKey   *btcec.PrivateKey
+	payAddr   btcutil.Address
+	payScript []byte
+	tip       *btcutil.Block
+}
+
+// newRPCTestHarness returns an RPC server backed by a new regression test
+// chain in which coinbase outputs mature after a single block.
+func newRPCTestHarness(t *testing.T) *rpcTestHarness {
+	t.Helper()
+
+	// The loggers write to the log rotator, which is not initialized by
+	// the tests.
+	setLogLevels("off")
+
+	// Copy the chain params to ensure the modifications do not affect the
+	// global instance.
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+
+	dbPath := filepath.Join(t.TempDir(), "rpcserver_test")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	timeSource := blockchain.NewMedianTime()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	// Use a hard coded key pair for deterministic results.
+	keyBytes, err := hex.DecodeString("700868df1838811ffbdf918fb482c1f7e" +
+		"ad62db4b97bd7012c23e726485e577d")
+	if err != nil {
+		t.Fatalf("unable to decode key: %v", err)
+	}
+	signKey, signPub := btcec.PrivKeyFromBytes(keyBytes)
+	payAddr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(signPub.SerializeCompressed()), &params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	payScript, err := txscript.PayToAddrScript(payAddr)
+	if err != nil {
+		t.Fatalf("unable to create pay script: %v", err)
+	}
+
+	txMemPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			DisableRelayPriority: true,
+			FreeTxRelayLimit:     15.0,
+			MaxOrphanTxs:         5,
+			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
+			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:        mempool.DefaultMinRelayTxFee,
+			MaxTxVersion:         2,
+		},
+		ChainParams:    &params,
+		FetchUtxoView:  chain.FetchUtxoView,
+		BestHeight:     func() int32 { return chain.BestSnapshot().Height },
+		MedianTimePast: func() time.Time { return chain.BestSnapshot().MedianTime },
+		CalcSequenceLock: func(tx *btcutil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+	})
+
+	connMgr := &testConnManager{}
+	server := &rpcServer{
+		cfg: rpcserverConfig{
+			ConnMgr:     connMgr,
+			TimeSource:  timeSource,
+			Chain:       chain,
+			ChainParams: &params,
+			DB:          db,
+			TxMemPool:   txMemPool,
+		},
+		gbtWorkState: newGbtWorkState(timeSource),
+		quit:         make(chan int),
+	}
+
+	// Shut the notification manager down so that notifications about
+	// accepted transactions do not block without any websocket clients.
+	server.ntfnMgr = newWsNotificationManager(server)
+	server.ntfnMgr.Shutdown()
+
+	return &rpcTestHarness{
+		t:         t,
+		params:    &params,
+		chain:     chain,
+		server:    server,
+		connMgr:   connMgr,
+		signKey:   signKey,
+		payAddr:   payAddr,
+		payScript: payScript,
+	}
+}
+
+// generateBlock creates a block containing the passed transactions whose
+// coinbase pays to the harness key, and connects it to the main chain.
+func (h *rpcTestHarness) generateBlock(txns ...*btcutil.Tx) *btcutil.Block {
+	h.t.Helper()
+
+	return h.generateBlockTo(nil, txns...)
+}
+
+// generateBlockTo creates a block containing the passed transactions whose
+// coinbase pays to the passed outputs, or the harness key when there are none,
+// and connects it to the main chain.
+func (h *rpcTestHarness) generateBlockTo(mineTo []wire.TxOut,
+	txns ...*btcutil.Tx) *btcutil.Block {
+
+	h.t.Helper()
+
+	block, err := rpctest.CreateBlock(h.tip, txns, nil, 1, time.Time{},
+		h.payAddr, mineTo, h.params)
+	if err != nil {
+		h.t.Fatalf("unable to create block: %v", err)
+	}
+	isMainChain, isOrphan, err := h.chain.ProcessBlock(block,
+		blockchain.BFNone)
+	if err != nil {
+		h.t.Fatalf("unable to process block %d: %v", block.Height(), err)
+	}
+	if !isMainChain || isOrphan {
+		h.t.Fatalf("block %d was not connected to the main chain",
+			block.Height())
+	}
+	h.tip = block
+	return block
+}
+
+// coinbaseOut returns the output of the coinbase of the passed block, which
+// must have been generated by the harness.
+func (h *rpcTestHarness) coinbaseOut(block *btcutil.Block) testSpendableOut {
+	coinbase := block.Transactions()[0]
+	return testSpendableOut{
+		outPoint: wire.OutPoint{Hash: *coinbase.Hash()},
+		amount:   coinbase.MsgTx().TxOut[0].Value,
+	}
+}
+
+// createSignedTx returns a transaction which spends the passed outputs to the
+// passed amounts paid to the harness key, leaving the rest as its fee.
+func (h *rpcTestHarness) createSignedTx(inputs []testSpendableOut,
+	amounts ...int64) *btcutil.Tx {
+
+	h.t.Helper()
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, input := range inputs {
+		tx.AddTxIn(wire.NewTxIn(&input.outPoint, nil, nil))
+	}
+	for _, amount := range amounts {
+		tx.AddTxOut(wire.NewTxOut(amount, h.payScript))
+	}
+	for i := range tx.TxIn {
+		sigScript, err := txscript.SignatureScript(tx, i, h.payScript,
+			txscript.SigHashAll, h.signKey, true)
+		if err != nil {
+			h.t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+	return btcutil.NewTx(tx)
+}
+
+// txOut returns the output at the passed index of the passed transaction.
+func txOut(tx *btcutil.Tx, index uint32) testSpendableOut {
+	return testSpendableOut{
+		outPoint: wire.OutPoint{Hash: *tx.Hash(), Index: index},
+		amount:   tx.MsgTx().TxOut[index].Value,
+	}
+}
+
+// txHex returns the hex encoded serialization of the passed transaction.
+func txHex(t *testing.T, tx *btcutil.Tx) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := tx.MsgTx().Serialize(&buf); err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// checkRPCError ensures the passed error is an RPC error with the passed code.
+func checkRPCError(t *testing.T, err error, code btcjson.RPCErrorCode) {
+	t.Helper()
+
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		t.Fatalf("got error %v (%T), want RPC error code %d", err, err,
+			code)
+	}
+	if rpcErr.Code != code {
+		t.Fatalf("got RPC error code %d (%v), want %d", rpcErr.Code,
+			rpcErr.Message, code)
+	}
+}
+
+// TestHandleSubmitPackage ensures the submitpackage command accepts packages
+// in which the child pays for its parent, reports the fees of the accepted
+// transactions and rejects malformed or underpaying packages.
+func TestHandleSubmitPackage(t *testing.T) {
+	t.Parallel()
+
+	h := newRPCTestHarness(t)
+	coinbases := make([]testSpendableOut, 0, 4)
+	for i := 0; i < 4; i++ {
+		coinbases = append(coinbases, h.coinbaseOut(h.generateBlock()))
+	}
+	h.generateBlock()
+
+	// newPackage returns a package of a parent paying no fee and a child
+	// paying the passed fee.
+	newPackage := func(input testSpendableOut, childFee int64) (*btcutil.Tx, *btcutil.Tx) {
+		parent := h.createSignedTx([]testSpendableOut{input},
+			input.amount)
+		child := h.createSignedTx([]testSpendableOut{txOut(parent, 0)},
+			input.amount-childFee)
+		return parent, child
+	}
+	submit := func(txns []*btcutil.Tx, hexData *[]string) (interface{}, error) {
+		rawTxs := make([]string, 0, len(txns))
+		for _, tx := range txns {
+			rawTxs = append(rawTxs, txHex(t, tx))
+		}
+		cmd := btcjson.NewSubmitPackageCmd(rawTxs, hexData)
+		return handleSubmitPackage(h.server, cmd, nil)
+	}
+	txPool := h.server.cfg.TxMemPool
+
+	// The child pays for its parent, so both are accepted, relayed and
+	// reported along with their fees.
+	parent, child := newPackage(coinbases[0], 10000)
+	res, err := submit([]*btcutil.Tx{parent, child}, nil)
+	if err != nil {
+		t.Fatalf("submitpackage: unexpected error: %v", err)
+	}
+	result := res.(*btcjson.SubmitPackageResult)
+	if result.PackageMsg != "success" {
+		t.Fatalf("package msg: got %q, want %q", result.PackageMsg,
+			"success")
+	}
+	wantFees := map[*btcutil.Tx]float64{parent: 0, child: 0.0001}
+	if len(result.TxResults) != len(wantFees) {
+		t.Fatalf("got %d tx results, want %d", len(result.TxResults),
+			len(wantFees))
+	}
+	for tx, wantFee := range wantFees {
+		txResult, ok := result.TxResults[tx.WitnessHash().String()]
+		if !ok {
+			t.Fatalf("missing tx result for %v", tx.Hash())
+		}
+		if txResult.TxID != tx.Hash().String() {
+			t.Fatalf("txid: got %v, want %v", txResult.TxID,
+				tx.Hash())
+		}
+		wantVSize := int32(mempool.GetTxVirtualSize(tx))
+		if txResult.VSize != wantVSize {
+			t.Fatalf("vsize of %v: got %d, want %d", tx.Hash(),
+				txResult.VSize, wantVSize)
+		}
+		if txResult.Fees == nil || txResult.Fees.Base != wantFee {
+			t.Fatalf("fees of %v: got %+v, want %v", tx.Hash(),
+				txResult.Fees, wantFee)
+		}
+		if !txPool.IsTransactionInPool(tx.Hash()) {
+			t.Fatalf("transaction %v is not in the pool", tx.Hash())
+		}
+	}
+	if len(h.connMgr.relayed) != 2 || len(h.connMgr.rebroadcast) != 2 {
+		t.Fatalf("got %d relayed and %d rebroadcast transactions, "+
+			"want 2 of each", len(h.connMgr.relayed),
+			len(h.connMgr.rebroadcast))
+	}
+
+	// Malformed packages are rejected before they reach the memory pool.
+	parent, child = newPackage(coinbases[1], 10000)
+	_, err = submit(nil, nil)
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+	tooMany := make([]*btcutil.Tx, mempool.MaxPackageCount+1)
+	for i := range tooMany {
+		tooMany[i] = parent
+	}
+	_, err = submit(tooMany, nil)
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+	_, err = submit([]*btcutil.Tx{parent, child}, &[]string{""})
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+	_, err = submit([]*btcutil.Tx{parent, child}, &[]string{"", "zz"})
+	checkRPCError(t, err, btcjson.ErrRPCDecodeHexString)
+	_, err = handleSubmitPackage(h.server, btcjson.NewSubmitPackageCmd(
+		[]string{"00"}, nil), nil)
+	checkRPCError(t, err, btcjson.ErrRPCDeserialization)
+
+	// A child which does not pay enough for both transactions gets the
+	// package rejected without adding either of them to the pool.
+	h.connMgr.relayed = nil
+	parent, child = newPackage(coinbases[2], 200)
+	_, err = submit([]*btcutil.Tx{parent, child}, nil)
+	checkRPCError(t, err, btcjson.ErrRPCTxRejected)
+	if txPool.IsTransactionInPool(parent.Hash()) ||
+		txPool.IsTransactionInPool(child.Hash()) {
+
+		t.Fatal("rejected package transactions are in the pool")
+	}
+	if len(h.connMgr.relayed) != 0 {
+		t.Fatalf("got %d relayed transactions, want 0",
+			len(h.connMgr.relayed))
+	}
+
+	// A parent listed after its child is rejected as well.
+	parent, child = newPackage(coinbases[3], 10000)
+	_, err = submit([]*btcutil.Tx{child, parent}, nil)
+	checkRPCError(t, err, btcjson.ErrRPCTxRejected)
+}
+
+// TestTruncatedMedian ensures the median used by the getblockstats command
+// averages the two middle values of an even number of values.
+func TestTruncatedMedian(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		values []int64
+		want   int64
+	}{
+		{name: "no values", values: nil, want: 0},
+		{name: "single value", values: []int64{7}, want: 7},
+		{name: "odd number of values", values: []int64{9, 1, 5}, want: 5},
+		{name: "even number of values", values: []int64{8, 2, 4, 6}, want: 5},
+		{name: "truncated average", values: []int64{2, 1}, want: 1},
+		{name: "duplicate values", values: []int64{3, 3, 1, 3}, want: 3},
+	}
+
+	for _, test := range tests {
+		got := truncatedMedian(test.values)
+		if got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// TestCalcBlockStats ensures the statistics of the getblockstats command are
+// calculated from the transactions of a block and the outputs they spend.
+func TestCalcBlockStats(t *testing.T) {
+	t.Parallel()
+
+	const height = 10
+	params := &chaincfg.RegressionNetParams
+	subsidy := blockchain.CalcBlockSubsidy(height, params)
+	medianTime := time.Unix(1600000000, 0)
+	blockTime := time.Unix(1600000600, 0)
+
+	// Outputs paying to a public key hash take 34 bytes and those paying
+	// to a witness public key hash take 31 bytes, so including the per
+	// utxo overhead they change the utxo set size by 75 and 72 bytes.
+	p2pkhScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).AddData(make([]byte, 20)).
+		AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	p2wpkhScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+		AddData(make([]byte, 20)).Script()
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	nullDataScript, err := txscript.NullDataScript([]byte{0x01, 0x02})
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+
+	// newTx returns a transaction with the passed number of inputs, which
+	// have either a signature script or a witness, and outputs.
+	newTx := func(numInputs int, witness bool, outputs ...*wire.TxOut) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for i := 0; i < numInputs; i++ {
+			txIn := wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil,
+				nil)
+			if witness {
+				txIn.Witness = wire.TxWitness{
+					bytes.Repeat([]byte{0x01}, 72),
+					bytes.Repeat([]byte{0x02}, 33),
+				}
+			} else {
+				txIn.SignatureScript = bytes.Repeat([]byte{0x01}, 107)
+			}
+			tx.AddTxIn(txIn)
+		}
+		for _, txOut := range outputs {
+			tx.AddTxOut(txOut)
+		}
+		return tx
+	}
+	newCoinbase := func(outputs ...*wire.TxOut) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+			[]byte{0x01, 0x0a}, nil))
+		for _, txOut := range outputs {
+			tx.AddTxOut(txOut)
+		}
+		return tx
+	}
+	sizeOf := func(tx *wire.MsgTx) (int64, int64, int64) {
+		weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+		vsize := (weight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor
+		return int64(tx.SerializeSize()), weight, vsize
+	}
+	spent := func(amount int64, pkScript []byte) blockchain.SpentTxOut {
+		return blockchain.SpentTxOut{
+			Amount:   amount,
+			PkScript: pkScript,
+			Height:   height - 1,
+		}
+	}
+
+	// The mixed block pays a fee rate of 10 with a transaction carrying a
+	// commitment, which makes up between half and three quarters of the
+	// weight of the block, and a fee rate of 20 with a segwit transaction.
+	// Its coinbase includes a provably unspendable output.
+	mixedCoinbase := newCoinbase(wire.NewTxOut(subsidy, p2pkhScript),
+		wire.NewTxOut(0, nullDataScript))
+	commitTx := newTx(1, false, wire.NewTxOut(30000, p2pkhScript),
+		wire.NewTxOut(20000, p2pkhScript))
+	commitTx.PosCommitment = wire.NewTxCommitment([wire.TagSize]uint8{},
+		0, 1, 80, chainhash.Hash{}, 0, nil)
+	segwitTx := newTx(2, true, wire.NewTxOut(60000, p2pkhScript))
+	commitSize, commitWeight, commitVSize := sizeOf(commitTx)
+	segwitSize, segwitWeight, segwitVSize := sizeOf(segwitTx)
+	commitFee, segwitFee := 10*commitVSize, 20*segwitVSize
+	mixedStxos := []blockchain.SpentTxOut{
+		spent(50000+commitFee, p2pkhScript),
+		spent(30000, p2wpkhScript),
+		spent(30000+segwitFee, p2wpkhScript),
+	}
+
+	// The percentiles block contains transactions of the same weight
+	// paying fee rates of 1 to 4, so each one makes up a quarter of the
+	// weight of the block.
+	var percentileTxns []*wire.MsgTx
+	var percentileStxos []blockchain.SpentTxOut
+	for _, feeRate := range []int64{3, 1, 4, 2} {
+		tx := newTx(1, false, wire.NewTxOut(10000, p2pkhScript))
+		_, _, vsize := sizeOf(tx)
+		percentileTxns = append(percentileTxns, tx)
+		percentileStxos = append(percentileStxos,
+			spent(10000+feeRate*vsize, p2pkhScript))
+	}
+	percentileSize, percentileWeight, percentileVSize :=
+		sizeOf(percentileTxns[0])
+
+	tests := []struct {
+		name    string
+		txns    []*wire.MsgTx
+		posData [][]byte
+		stxos   []blockchain.SpentTxOut
+		want    *btcjson.GetBlockStatsResult
+		wantErr bool
+	}{
+		{
+			name: "coinbase only",
+			txns: []*wire.MsgTx{
+				newCoinbase(wire.NewTxOut(subsidy, p2pkhScript)),
+			},
+			want: &btcjson.GetBlockStatsResult{
+				FeeratePercentiles: []int64{0, 0, 0, 0, 0},
+				Height:             height,
+				MedianTime:         medianTime.Unix(),
+				Outs:               1,
+				Subsidy:            subsidy,
+				Time:               blockTime.Unix(),
+				Txs:                1,
+				UTXOIncrease:       1,
+				UTXOSizeIncrease:   75,
+			},
+		},
+		{
+			name:    "segwit and commitment transactions",
+			txns:    []*wire.MsgTx{mixedCoinbase, commitTx, segwitTx},
+			posData: [][]byte{make([]byte, 80)},
+			stxos:   mixedStxos,
+			want: &btcjson.GetBlockStatsResult{
+				AverageFee: (commitFee + segwitFee) / 2,
+				AverageFeeRate: (commitFee + segwitFee) *
+					blockchain.WitnessScaleFactor /
+					(commitWeight + segwitWeight),
+				AverageTxSize:      (commitSize + segwitSize) / 2,
+				Commitments:        1,
+				CommitmentData:     80,
+				FeeratePercentiles: []int64{10, 10, 10, 20, 20},
+				Height:             height,
+				Ins:                3,
+				MaxFee:             segwitFee,
+				MaxFeeRate:         20,
+				MaxTxSize:          segwitSize,
+				MedianFee:          (commitFee + segwitFee) / 2,
+				MedianTime:         medianTime.Unix(),
+				MedianTxSize:       (commitSize + segwitSize) / 2,
+				MinFee:             commitFee,
+				MinFeeRate:         10,
+				MinTxSize:          commitSize,
+				Outs:               5,
+				SegWitTotalSize:    segwitSize,
+				SegWitTotalWeight:  segwitWeight,
+				SegWitTxs:          1,
+				Subsidy:            subsidy,
+				Time:               blockTime.Unix(),
+				TotalFee:           commitFee + segwitFee,
+				TotalOut:           110000,
+				TotalSize:          commitSize + segwitSize,
+				TotalWeight:        commitWeight + segwitWeight,
+				Txs:                3,
+
+				// The coinbase and transaction outputs add
+				// 4 * 75 bytes, while the inputs remove 75 and
+				// 2 * 72 bytes.
+				UTXOIncrease:     1,
+				UTXOSizeIncrease: 81,
+			},
+		},
+		{
+			name: "fee rate percentiles",
+			txns: append([]*wire.MsgTx{
+				newCoinbase(wire.NewTxOut(subsidy, p2pkhScript)),
+			}, percentileTxns...),
+			stxos: percentileStxos,
+			want: &btcjson.GetBlockStatsResult{
+				AverageFee: 10 * percentileVSize / 4,
+				AverageFeeRate: 10 * percentileVSize *
+					blockchain.WitnessScaleFactor /
+					(4 * percentileWeight),
+				AverageTxSize:      percentileSize,
+				FeeratePercentiles: []int64{1, 1, 2, 3, 4},
+				Height:             height,
+				Ins:                4,
+				MaxFee:             4 * percentileVSize,
+				MaxFeeRate:         4,
+				MaxTxSize:          percentileSize,
+				MedianFee:          5 * percentileVSize / 2,
+				MedianTime:         medianTime.Unix(),
+				MedianTxSize:       percentileSize,
+				MinFee:             percentileVSize,
+				MinFeeRate:         1,
+				MinTxSize:          percentileSize,
+				Outs:               5,
+				Subsidy:            subsidy,
+				Time:               blockTime.Unix(),
+				TotalFee:           10 * percentileVSize,
+				TotalOut:           40000,
+				TotalSize:          4 * percentileSize,
+				TotalWeight:        4 * percentileWeight,
+				Txs:                5,
+				UTXOIncrease:       1,
+				UTXOSizeIncrease:   75,
+			},
+		},
+		{
+			name:    "spend journal missing entries",
+			txns:    []*wire.MsgTx{mixedCoinbase, commitTx, segwitTx},
+			stxos:   mixedStxos[:2],
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		block := btcutil.NewBlock(&wire.MsgBlock{
+			Header:       wire.BlockHeader{Timestamp: blockTime},
+			Transactions: test.txns,
+			PosData:      test.posData,
+		})
+		block.SetHeight(height)
+
+		stats, err := calcBlockStats(params, block, medianTime, test.stxos)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		test.want.Hash = block.Hash().String()
+		if !reflect.DeepEqual(stats, test.want) {
+			t.Errorf("%s: mismatched stats:\ngot  %+v\nwant %+v",
+				test.name, stats, test.want)
+		}
+	}
+}
+
+// TestHandleGetBlockStats ensures the getblockstats command looks up main
+// chain blocks by height or hash, computes their statistics from the spend
+// journal and filters them by the requested statistics.
+func TestHandleGetBlockStats(t *testing.T) {
+	t.Parallel()
+
+	h := newRPCTestHarness(t)
+	block1 := h.generateBlock()
+	h.generateBlock()
+	spendTx := h.createSignedTx(
+		[]testSpendableOut{h.coinbaseOut(block1)},
+		h.coinbaseOut(block1).amount-1000,
+	)
+	block3 := h.generateBlock(spendTx)
+	medianTime, err := h.chain.MedianTimeByHash(block3.Hash())
+	if err != nil {
+		t.Fatalf("unable to obtain median time: %v", err)
+	}
+
+	// The full statistics are those of the block and its spend journal.
+	stxos, err := h.chain.FetchSpendJournal(block3)
+	if err != nil {
+		t.Fatalf("unable to fetch spend journal: %v", err)
+	}
+	wantStats, err := calcBlockStats(h.params, block3, medianTime, stxos)
+	if err != nil {
+		t.Fatalf("unable to calculate stats: %v", err)
+	}
+	if wantStats.TotalFee != 1000 || wantStats.Ins != 1 ||
+		wantStats.UTXOIncrease != 1 || wantStats.UTXOSizeIncrease != 75 {
+
+		t.Fatalf("unexpected stats of block 3: %+v", wantStats)
+	}
+
+	percentilesJSON, err := json.Marshal(wantStats.FeeratePercentiles)
+	if err != nil {
+		t.Fatalf("unable to marshal fee rate percentiles: %v", err)
+	}
+
+	statNames := func(names ...string) *[]string { return &names }
+	tests := []struct {
+		name         string
+		hashOrHeight interface{}
+		stats        *[]string
+		want         interface{}
+		wantCode     btcjson.RPCErrorCode
+	}{
+		{
+			name:         "by height",
+			hashOrHeight: 3,
+			want:         wantStats,
+		},
+		{
+			name:         "by hash",
+			hashOrHeight: block3.Hash().String(),
+			stats:        statNames(),
+			want:         wantStats,
+		},
+		{
+			name:         "selected stats",
+			hashOrHeight: 3,
+			stats: statNames("totalfee", "utxo_size_inc",
+				"feerate_percentiles", "swtxs"),
+			want: map[string]json.RawMessage{
+				"totalfee":            json.RawMessage("1000"),
+				"utxo_size_inc":       json.RawMessage("75"),
+				"feerate_percentiles": json.RawMessage(percentilesJSON),
+				"swtxs":               json.RawMessage("0"),
+			},
+		},
+		{
+			name:         "invalid selected stat",
+			hashOrHeight: 3,
+			stats:        statNames("totalfee", "nosuchstat"),
+			wantCode:     btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name:         "height out of range",
+			hashOrHeight: 4,
+			wantCode:     btcjson.ErrRPCOutOfRange,
+		},
+		{
+			name:         "unknown block",
+			hashOrHeight: chainhash.Hash{0x01}.String(),
+			wantCode:     btcjson.ErrRPCBlockNotFound,
+		},
+		{
+			name:         "invalid hash",
+			hashOrHeight: "zz",
+			wantCode:     btcjson.ErrRPCDecodeHexString,
+		},
+	}
+
+	for _, test := range tests {
+		cmd := btcjson.NewGetBlockStatsCmd(btcjson.HashOrHeight{
+			Value: test.hashOrHeight,
+		}, test.stats)
+		result, err := handleGetBlockStats(h.server, cmd, nil)
+		if test.wantCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.wantCode {
+				t.Errorf("%s: got error %v, want code %d",
+					test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, result,
+				test.want)
+		}
+	}
+}
+
+// TestHandleGetBlockPrevouts ensures the getblock command includes the outputs
+// spent by each input along with the fee of each transaction from the spend
+// journal at verbosity 3, and only then.
+func TestHandleGetBlockPrevouts(t *testing.T) {
+	t.Parallel()
+
+	// Spend a coinbase in one block, and both an output of that spend and
+	// another coinbase in the next so the inputs of the final block spend
+	// both coinbase and regular outputs from different heights.
+	h := newRPCTestHarness(t)
+	block1 := h.generateBlock()
+	block2 := h.generateBlock()
+	splitTx := h.createSignedTx(
+		[]testSpendableOut{h.coinbaseOut(block1)},
+		h.coinbaseOut(block1).amount/2,
+		h.coinbaseOut(block1).amount/2-1000,
+	)
+	h.generateBlock(splitTx)
+	spendTx := h.createSignedTx(
+		[]testSpendableOut{txOut(splitTx, 1), h.coinbaseOut(block2)},
+		txOut(splitTx, 1).amount+h.coinbaseOut(block2).amount-1000,
+	)
+	block4 := h.generateBlock(spendTx)
+
+	stxos, err := h.chain.FetchSpendJournal(block4)
+	if err != nil {
+		t.Fatalf("unable to fetch spend journal: %v", err)
+	}
+	wantStxos := []blockchain.SpentTxOut{{
+		Amount:   txOut(splitTx, 1).amount,
+		PkScript: h.payScript,
+		Height:   3,
+	}, {
+		Amount:     h.coinbaseOut(block2).amount,
+		PkScript:   h.payScript,
+		Height:     2,
+		IsCoinBase: true,
+	}}
+	if !reflect.DeepEqual(stxos, wantStxos) {
+		t.Fatalf("unexpected spend journal: got %+v, want %+v", stxos,
+			wantStxos)
+	}
+
+	getBlock := func(verbosity int) btcjson.GetBlockVerboseResult {
+		t.Helper()
+
+		cmd := btcjson.NewGetBlockCmd(block4.Hash().String(), &verbosity)
+		result, err := handleGetBlock(h.server, cmd, nil)
+		if err != nil {
+			t.Fatalf("getblock verbosity %d: unexpected error: %v",
+				verbosity, err)
+		}
+		reply := result.(btcjson.GetBlockVerboseResult)
+		if len(reply.RawTx) != 2 {
+			t.Fatalf("getblock verbosity %d: got %d transactions, "+
+				"want 2", verbosity, len(reply.RawTx))
+		}
+		return reply
+	}
+
+	// Verbosity 2 does not include the spent outputs.
+	reply := getBlock(2)
+	for _, rawTx := range reply.RawTx {
+		if rawTx.Fee != nil {
+			t.Fatalf("verbosity 2: unexpected fee of %v", rawTx.Txid)
+		}
+		for _, vin := range rawTx.Vin {
+			if vin.Prevout != nil {
+				t.Fatalf("verbosity 2: unexpected prevout of %v",
+					rawTx.Txid)
+			}
+		}
+	}
+
+	// Verbosity 3 includes the spent outputs of all but the coinbase.
+	reply = getBlock(3)
+	coinbaseReply := reply.RawTx[0]
+	if coinbaseReply.Fee != nil || coinbaseReply.Vin[0].Prevout != nil {
+		t.Fatal("verbosity 3: unexpected prevout or fee of the coinbase")
+	}
+	spendReply := reply.RawTx[1]
+	if spendReply.Txid != spendTx.Hash().String() {
+		t.Fatalf("verbosity 3: got transaction %v, want %v",
+			spendReply.Txid, spendTx.Hash())
+	}
+	if len(spendReply.Vin) != len(wantStxos) {
+		t.Fatalf("verbosity 3: got %d inputs, want %d",
+			len(spendReply.Vin), len(wantStxos))
+	}
+	for i, stxo := range wantStxos {
+		prevout := spendReply.Vin[i].Prevout
+		if prevout == nil {
+			t.Fatalf("verbosity 3: missing prevout of input %d", i)
+		}
+		if prevout.Generated != stxo.IsCoinBase ||
+			prevout.Height != stxo.Height ||
+			prevout.Value != btcutil.Amount(stxo.Amount).ToBTC() {
+
+			t.Fatalf("verbosity 3: prevout of input %d: got %+v, "+
+				"want %+v", i, prevout, stxo)
+		}
+		script := prevout.ScriptPubKey
+		if script.Hex != hex.EncodeToString(stxo.PkScript) ||
+			script.Type != txscript.PubKeyHashTy.String() ||
+			!reflect.DeepEqual(script.Addresses,
+				[]string{h.payAddr.EncodeAddress()}) {
+
+			t.Fatalf("verbosity 3: script of input %d: got %+v",
+				i, script)
+		}
+	}
+
+	// The fee is the difference between the spent outputs and the output
+	// of the spending transaction.
+	wantFee := btcutil.Amount(1000).ToBTC()
+	if spendReply.Fee == nil || *spendReply.Fee != wantFee {
+		t.Fatalf("verbosity 3: got fee %v, want %v", spendReply.Fee,
+			wantFee)
+	}
+}
+
+// TestHandleScanTxOutSet ensures the scantxoutset command finds the unspent
+// outputs paying to the scripts of descriptors over their requested ranges,
+// and reports and aborts the scan in progress while rejecting another one.
+func TestHandleScanTxOutSet(t *testing.T) {
+	t.Parallel()
+
+	h := newRPCTestHarness(t)
+
+	// Create a ranged descriptor from an extended key with a fixed seed.
+	seed := bytes.Repeat([]byte{0x2a}, hdkeychain.RecommendedSeedLen)
+	master, err := hdkeychain.NewMaster(seed, h.params)
+	if err != nil {
+		t.Fatalf("unable to create master key: %v", err)
+	}
+	xpub, err := master.Neuter()
+	if err != nil {
+		t.Fatalf("unable to neuter master key: %v", err)
+	}
+	rangedDesc := "wpkh(" + xpub.String() + "/0/*)"
+	parsed, err := parseDescriptor(h.server, rangedDesc)
+	if err != nil {
+		t.Fatalf("unable to parse descriptor: %v", err)
+	}
+	derivedScript := func(index uint32) []byte {
+		script, err := parsed.Script(index)
+		if err != nil {
+			t.Fatalf("unable to derive script %d: %v", index, err)
+		}
+		return script
+	}
+
+	// Pay the coinbases of two blocks to the descriptor at an index within
+	// the default range and one beyond it, and the rest to the harness
+	// key.
+	block1 := h.generateBlock()
+	inRange := h.generateBlockTo([]wire.TxOut{
+		*wire.NewTxOut(50000, derivedScript(2)),
+	})
+	beyondRange := h.generateBlockTo([]wire.TxOut{
+		*wire.NewTxOut(70000, derivedScript(defaultScanRange+500)),
+	})
+	block4 := h.generateBlock()
+	tip := h.chain.BestSnapshot()
+
+	// unspent returns the expected unspent output for the coinbase of the
+	// passed block.
+	unspent := func(block *btcutil.Block) btcjson.ScanTxOutSetUnspent {
+		coinbase := block.Transactions()[0]
+		pkScript := coinbase.MsgTx().TxOut[0].PkScript
+		return btcjson.ScanTxOutSetUnspent{
+			TxID:         coinbase.Hash().String(),
+			ScriptPubKey: hex.EncodeToString(pkScript),
+			Desc:         inferDescriptor(pkScript, h.params),
+			Amount: btcutil.Amount(
+				coinbase.MsgTx().TxOut[0].Value).ToBTC(),
+			Height: block.Height(),
+		}
+	}
+	scanRange := func(value interface{}) *btcjson.DescriptorRange {
+		return &btcjson.DescriptorRange{Value: value}
+	}
+	addrDesc := "addr(" + h.payAddr.EncodeAddress() + ")"
+
+	tests := []struct {
+		name     string
+		objects  []btcjson.ScanTxOutSetObject
+		want     []btcjson.ScanTxOutSetUnspent
+		wantCode btcjson.RPCErrorCode
+	}{
+		{
+			name:    "default range",
+			objects: []btcjson.ScanTxOutSetObject{{Desc: rangedDesc}},
+			want: []btcjson.ScanTxOutSetUnspent{
+				unspent(inRange),
+			},
+		},
+		{
+			name: "range end",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange(2),
+			}},
+			want: []btcjson.ScanTxOutSetUnspent{
+				unspent(inRange),
+			},
+		},
+		{
+			name: "range excluding the output",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange(1),
+			}},
+			want: []btcjson.ScanTxOutSetUnspent{},
+		},
+		{
+			name: "range begin and end",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc: rangedDesc,
+				Range: scanRange([]int{defaultScanRange,
+					defaultScanRange + 1000}),
+			}},
+			want: []btcjson.ScanTxOutSetUnspent{
+				unspent(beyondRange),
+			},
+		},
+		{
+			name: "multiple objects",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange([]int{0, defaultScanRange + 500}),
+			}, {
+				Desc: addrDesc,
+			}},
+			want: []btcjson.ScanTxOutSetUnspent{
+				unspent(block1), unspent(inRange),
+				unspent(beyondRange), unspent(block4),
+			},
+		},
+		{
+			name: "range end before begin",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange([]int{5, 2}),
+			}},
+			wantCode: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name: "range too large",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange(maxDescriptorRange),
+			}},
+			wantCode: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name: "invalid range",
+			objects: []btcjson.ScanTxOutSetObject{{
+				Desc:  rangedDesc,
+				Range: scanRange("1"),
+			}},
+			wantCode: btcjson.ErrRPCInvalidParameter,
+		},
+		{
+			name:     "invalid descriptor",
+			objects:  []btcjson.ScanTxOutSetObject{{Desc: "wpkh(nokey)"}},
+			wantCode: btcjson.ErrRPCInvalidAddressOrKey,
+		},
+	}
+
+	for _, test := range tests {
+		objects := test.objects
+		cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStart,
+			&objects)
+		result, err := handleScanTxOutSet(h.server, cmd, nil)
+		if test.wantCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.wantCode {
+				t.Errorf("%s: got error %v, want code %d",
+					test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		// The unspent outputs are found in the order of the utxo set,
+		// so sort them to compare them.
+		res := result.(*btcjson.ScanTxOutSetResult)
+		sort.Slice(res.Unspents, func(i, j int) bool {
+			return res.Unspents[i].Height < res.Unspents[j].Height
+		})
+		var totalAmount btcutil.Amount
+		for _, u := range test.want {
+			amount, _ := btcutil.NewAmount(u.Amount)
+			totalAmount += amount
+		}
+		want := &btcjson.ScanTxOutSetResult{
+			Success:     true,
+			TxOuts:      uint64(tip.Height),
+			Height:      tip.Height,
+			BestBlock:   tip.Hash.String(),
+			Unspents:    test.want,
+			TotalAmount: totalAmount.ToBTC(),
+		}
+		if !reflect.DeepEqual(res, want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, res, want)
+		}
+	}
+
+	// A missing list of scan objects and an unknown action are rejected.
+	_, err = handleScanTxOutSet(h.server, btcjson.NewScanTxOutSetCmd(
+		btcjson.ScanTxOutSetStart, nil), nil)
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+	_, err = handleScanTxOutSet(h.server, btcjson.NewScanTxOutSetCmd(
+		"restart", nil), nil)
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+
+	// runAction runs the passed action without any scan objects.
+	runAction := func(action btcjson.ScanTxOutSetAction) interface{} {
+		t.Helper()
+
+		cmd := btcjson.NewScanTxOutSetCmd(action, nil)
+		result, err := handleScanTxOutSet(h.server, cmd, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", action, err)
+		}
+		return result
+	}
+
+	// Without a scan in progress there is no status to report and nothing
+	// to abort.
+	if status := runAction(btcjson.ScanTxOutSetStatus); status != nil {
+		t.Fatalf("status without a scan: got %+v, want nil", status)
+	}
+	if aborted := runAction(btcjson.ScanTxOutSetAbort); aborted != false {
+		t.Fatalf("abort without a scan: got %v, want false", aborted)
+	}
+
+	// Mark a scan as in progress the way a running scan does, which
+	// reports its progress, rejects starting another scan and is aborted
+	// only once.
+	state := &h.server.utxoScan
+	abort := make(chan struct{})
+	state.Lock()
+	state.inProgress = true
+	state.progress = 42.5
+	state.abort = abort
+	state.aborted = false
+	state.Unlock()
+
+	status := runAction(btcjson.ScanTxOutSetStatus)
+	wantStatus := &btcjson.ScanTxOutSetStatusResult{Progress: 42.5}
+	if !reflect.DeepEqual(status, wantStatus) {
+		t.Fatalf("status: got %+v, want %+v", status, wantStatus)
+	}
+	objects := []btcjson.ScanTxOutSetObject{{Desc: addrDesc}}
+	_, err = handleScanTxOutSet(h.server, btcjson.NewScanTxOutSetCmd(
+		btcjson.ScanTxOutSetStart, &objects), nil)
+	checkRPCError(t, err, btcjson.ErrRPCInvalidParameter)
+	if aborted := runAction(btcjson.ScanTxOutSetAbort); aborted != true {
+		t.Fatalf("abort: got %v, want true", aborted)
+	}
+	select {
+	case <-abort:
+	default:
+		t.Fatal("abort did not signal the scan in progress")
+	}
+	if aborted := runAction(btcjson.ScanTxOutSetAbort); aborted != false {
+		t.Fatalf("second abort: got %v, want false", aborted)
+	}
+
+	// Once the scan finishes, another one may be started.
+	state.Lock()
+	state.inProgress = false
+	state.Unlock()
+	_, err = handleScanTxOutSet(h.server, btcjson.NewScanTxOutSetCmd(
+		btcjson.ScanTxOutSetStart, &objects), nil)
+	if err != nil {
+		t.Fatalf("start after the scan finished: unexpected error: %v",
+			err)
+	}
+}
@@ -29,11 +29,48 @@ var helpDescsEnUS = map[string]string{
 	"debuglevel--result0":    "The string 'Done.'",
 	"debuglevel--result1":    "The list of subsystems",
 
+	// ScriptTraceStep help.
+	"scripttracestep-script":   "The index of the script the opcode belongs to (0 is the signature script, 1 the public key script, followed by the redeem and witness scripts)",
+	"scripttracestep-index":    "The index of the opcode within its script",
+	"scripttracestep-opcode":   "The disassembled opcode, including any data it pushes",
+	"scripttracestep-executed": "Whether the opcode was executed as opposed to skipped by a conditional branch that isn't executing",
+	"scripttracestep-stack":    "The hex-encoded data stack items after the opcode executed, from the bottom to the top of the stack",
+	"scripttracestep-altstack": "The hex-encoded alternate stack items after the opcode executed, from the bottom to the top of the stack",
+	"scripttracestep-error":    "The reason the opcode failed, if it did",
+
+	// TraceScriptResult help.
+	"tracescriptresult-txid":         "The hash of the transaction",
+	"tracescriptresult-vin":          "The index of the traced input",
+	"tracescriptresult-scriptPubKey": "The hex-encoded public key script of the output spent by the input",
+	"tracescriptresult-amount":       "The value of the output spent by the input in BTC",
+	"tracescriptresult-valid":        "Whether the scripts of the input are valid",
+	"tracescriptresult-errorcode":    "The script error code when the scripts are invalid",
+	"tracescriptresult-error":        "The reason the scripts are invalid",
+	"tracescriptresult-steps":        "Every opcode that was stepped through in order",
+
+	// DebugScriptCmd help.
+	"debugscript--synopsis": "Executes the scripts of a transaction input against the provided output and returns the trace of the execution.\n" +
+		"The outputs spent by the other inputs, which are only required by taproot signatures, are looked up in the memory pool and utxo set.",
+	"debugscript-hextx":        "Serialized, hex-encoded transaction",
+	"debugscript-vin":          "The index of the input to trace",
+	"debugscript-scriptpubkey": "The hex-encoded public key script of the output spent by the input",
+	"debugscript-amount":       "The value of the output spent by the input in BTC",
+
+	// TraceTransactionCmd help.
+	"tracetransaction--synopsis": "Executes the scripts of the inputs of a transaction against the outputs they spend and returns the trace of each execution.\n" +
+		"The spent outputs are looked up in the memory pool and utxo set, or via the transaction index (--txindex) when they have already been spent.",
+	"tracetransaction-hextx":    "Serialized, hex-encoded transaction",
+	"tracetransaction-vin":      "The index of the input to trace (defaults to all inputs)",
+	"tracetransaction--result0": "The trace of each traced input",
+
 	// AddNodeCmd help.
 	"addnode--synopsis": "Attempts to add or remove a persistent peer.",
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// ClearBannedCmd help.
+	"clearbanned--synopsis": "Lifts the bans of all banned IP addresses and subnets.",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -88,6 +125,13 @@ var helpDescsEnUS = map[string]string{
 	"vin-scriptSig":   "The signature script used to redeem the origin transaction as a JSON object (non-coinbase txns only)",
 	"vin-txinwitness": "The witness used to redeem the input encoded as a string array of its items",
 	"vin-sequence":    "The script sequence number",
+	"vin-prevout":     "The previous output spent by the input (only when getblock verbosity=3)",
+
+	// SpentOutputResult help.
+	"spentoutputresult-generated":    "Whether the previous output was created by a coinbase transaction",
+	"spentoutputresult-height":       "The height of the block that created the previous output",
+	"spentoutputresult-value":        "The value of the previous output in BTC",
+	"spentoutputresult-scriptPubKey": "The public key script of the previous output",
 
 	// ScriptPubKeyResult help.
 	"scriptpubkeyresult-asm":       "Disassembly of the script",
@@ -123,6 +167,15 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DeriveAddressesCmd help.
+	"deriveaddresses--synopsis":  "Derives one or more addresses from an output descriptor.",
+	"deriveaddresses-descriptor": "The output descriptor, which must include its checksum",
+	"deriveaddresses-range":      "The end or the [begin,end] range of child indexes to derive, which is required for ranged descriptors only",
+	"deriveaddresses--result0":   "The derived addresses",
+
+	// DescriptorRange help.
+	"descriptorrange-value": "The end of the range as an integer, or the range itself as an array of [begin,end] integers",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -155,6 +208,50 @@ var helpDescsEnUS = map[string]string{
 	"getaddednodeinfo--condition1": "dns=true",
 	"getaddednodeinfo--result0":    "List of added peers",
 
+	// GetAddressBalanceResult help.
+	"getaddressbalanceresult-balance":     "The confirmed balance of the addresses in BTC",
+	"getaddressbalanceresult-received":    "The total amount ever received by the addresses in confirmed transactions in BTC",
+	"getaddressbalanceresult-unconfirmed": "The change to the balance made by unconfirmed transactions in BTC (only when includemempool=true)",
+
+	// GetAddressBalanceCmd help.
+	"getaddressbalance--synopsis":      "Returns the combined balance of the passed addresses as tracked by the address utxo index (--addrutxoindex).",
+	"getaddressbalance-addresses":      "The addresses to query",
+	"getaddressbalance-includemempool": "Include the balance change made by unconfirmed transactions, which requires the address index (--addrindex)",
+
+	// GetAddressDeltasResult help.
+	"getaddressdeltasresult-address":       "The address the change applies to",
+	"getaddressdeltasresult-txid":          "The hash of the transaction which made the change",
+	"getaddressdeltasresult-index":         "The index of the input or output within the transaction",
+	"getaddressdeltasresult-spending":      "Whether the change spends a previous output (input) or creates a new one (output)",
+	"getaddressdeltasresult-blockindex":    "The index of the transaction within its block",
+	"getaddressdeltasresult-height":        "The height of the block containing the transaction (0 when unconfirmed)",
+	"getaddressdeltasresult-confirmations": "The number of confirmations of the transaction",
+	"getaddressdeltasresult-amount":        "The change to the balance in BTC, which is negative when spending",
+
+	// GetAddressDeltasCmd help.
+	"getaddressdeltas--synopsis":      "Returns every change made to the balance of the passed addresses within the given height range as tracked by the address utxo index (--addrutxoindex).",
+	"getaddressdeltas-addresses":      "The addresses to query",
+	"getaddressdeltas-start":          "The first block height to include",
+	"getaddressdeltas-end":            "The last block height to include (defaults to the best height)",
+	"getaddressdeltas-includemempool": "Append the changes made by unconfirmed transactions when no end height is specified, which requires the address index (--addrindex)",
+	"getaddressdeltas--result0":       "The balance changes ordered by address, height, and position within the block",
+
+	// GetAddressUtxosResult help.
+	"getaddressutxosresult-address":       "The address the output pays to",
+	"getaddressutxosresult-txid":          "The hash of the transaction which created the output",
+	"getaddressutxosresult-vout":          "The index of the output within the transaction",
+	"getaddressutxosresult-scriptPubKey":  "The hex-encoded public key script of the output",
+	"getaddressutxosresult-amount":        "The value of the output in BTC",
+	"getaddressutxosresult-height":        "The height of the block containing the output (0 when unconfirmed)",
+	"getaddressutxosresult-confirmations": "The number of confirmations of the output",
+	"getaddressutxosresult-coinbase":      "Whether the output was created by a coinbase transaction",
+
+	// GetAddressUtxosCmd help.
+	"getaddressutxos--synopsis":      "Returns the unspent outputs paying to the passed addresses as tracked by the address utxo index (--addrutxoindex).",
+	"getaddressutxos-addresses":      "The addresses to query",
+	"getaddressutxos-includemempool": "Include outputs created by unconfirmed transactions and exclude outputs they spend, which requires the address index (--addrindex)",
+	"getaddressutxos--result0":       "The unspent outputs ordered by address",
+
 	// GetBestBlockResult help.
 	"getbestblockresult-hash":   "Hex-encoded bytes of the best block hash",
 	"getbestblockresult-height": "Height of the best block",
@@ -170,7 +267,7 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockCmd help.
 	"getblock--synopsis":   "Returns information about a block given its hash.",
 	"getblock-hash":        "The hash of the block",
-	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), or as parsed data with parsed transaction data (2) ",
+	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), as parsed data with parsed transaction data (2), or as parsed data with parsed transaction data including the fee and the previous outputs spent by each input (3)",
 	"getblock--condition0": "verbosity=0",
 	"getblock--condition1": "verbosity=1",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
@@ -228,6 +325,7 @@ var helpDescsEnUS = map[string]string{
 	"txrawresult-vsize":         "The virtual size of the transaction in bytes",
 	"txrawresult-weight":        "The transaction's weight (between vsize*4-3 and vsize*4)",
 	"txrawresult-hash":          "The wtxid of the transaction",
+	"txrawresult-fee":           "The fee paid by the transaction in BTC (only when getblock verbosity=3)",
 
 	// SearchRawTransactionsResult help.
 	"searchrawtransactionsresult-hex":           "Hex-encoded transaction",
@@ -254,7 +352,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-versionHex":        "The block version in hexadecimal",
 	"getblockverboseresult-merkleroot":        "Root hash of the merkle tree",
 	"getblockverboseresult-tx":                "The transaction hashes (only when verbosity=1)",
-	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2)",
+	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity>=2)",
 	"getblockverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
 	"getblockverboseresult-nonce":             "The block nonce",
 	"getblockverboseresult-bits":              "The bits which represent the block difficulty",
@@ -295,6 +393,53 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis": "Returns statistics about a block in the main chain computed from the block and its spend journal, so input values are known without a transaction index.\n" +
+		"Fee, size and weight statistics exclude the coinbase transaction.  Fee rates are in satoshis per virtual byte.",
+	"getblockstats-hashorheight":    "The hash or height of the block",
+	"getblockstats-stats":           "The names of the statistics to return (default: all)",
+	"getblockstats--condition0":     "stats not provided",
+	"getblockstats--condition1":     "stats provided",
+	"getblockstats--result1--desc":  "An object containing only the selected statistics",
+	"getblockstats--result1--key":   "Statistic name",
+	"getblockstats--result1--value": "The value of the statistic",
+
+	// HashOrHeight help.
+	"hashorheight-value": "Either a block hash as a string or a block height as a number",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-avgfee":                "Average fee in the block",
+	"getblockstatsresult-avgfeerate":            "Average fee rate",
+	"getblockstatsresult-avgtxsize":             "Average transaction size",
+	"getblockstatsresult-commitments":           "The number of transactions with a PoS commitment",
+	"getblockstatsresult-commitment_data_bytes": "The total number of bytes of commitment data attached to the block",
+	"getblockstatsresult-feerate_percentiles":   "Fee rates at the 10th, 25th, 50th, 75th and 90th percentile weight unit",
+	"getblockstatsresult-blockhash":             "The block hash",
+	"getblockstatsresult-height":                "The height of the block",
+	"getblockstatsresult-ins":                   "The number of inputs (excluding coinbase)",
+	"getblockstatsresult-maxfee":                "Maximum fee in the block",
+	"getblockstatsresult-maxfeerate":            "Maximum fee rate in the block",
+	"getblockstatsresult-maxtxsize":             "Maximum transaction size",
+	"getblockstatsresult-medianfee":             "Truncated median fee in the block",
+	"getblockstatsresult-mediantime":            "The block median time past",
+	"getblockstatsresult-mediantxsize":          "Truncated median transaction size",
+	"getblockstatsresult-minfee":                "Minimum fee in the block",
+	"getblockstatsresult-minfeerate":            "Minimum fee rate in the block",
+	"getblockstatsresult-mintxsize":             "Minimum transaction size",
+	"getblockstatsresult-outs":                  "The number of outputs",
+	"getblockstatsresult-swtotal_size":          "Total size of all segwit transactions",
+	"getblockstatsresult-swtotal_weight":        "Total weight of all segwit transactions",
+	"getblockstatsresult-swtxs":                 "The number of segwit transactions",
+	"getblockstatsresult-subsidy":               "The block subsidy",
+	"getblockstatsresult-time":                  "The block time",
+	"getblockstatsresult-totalfee":              "The fee total",
+	"getblockstatsresult-total_out":             "Total amount in all outputs (excluding coinbase)",
+	"getblockstatsresult-total_size":            "Total size of all non-coinbase transactions",
+	"getblockstatsresult-total_weight":          "Total weight of all non-coinbase transactions",
+	"getblockstatsresult-txs":                   "The number of transactions (including coinbase)",
+	"getblockstatsresult-utxo_increase":         "The increase or decrease in the number of unspent outputs",
+	"getblockstatsresult-utxo_size_inc":         "The increase or decrease in the size of the utxo set",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
@@ -367,6 +512,15 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetChainTipsCmd help.
+	"getchaintips--synopsis": "Returns information about all known tips in the block tree, including the main chain and all side chains.",
+
+	// GetChainTipsResult help.
+	"getchaintipsresult-height":    "The height of the chain tip",
+	"getchaintipsresult-hash":      "The block hash of the chain tip",
+	"getchaintipsresult-branchlen": "The length of the branch connecting the tip to the main chain (0 for the main chain)",
+	"getchaintipsresult-status":    "The status of the chain (active, valid-fork, valid-headers, headers-only, invalid)",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -375,6 +529,17 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDescriptorInfoCmd help.
+	"getdescriptorinfo--synopsis":  "Analyses an output descriptor.",
+	"getdescriptorinfo-descriptor": "The output descriptor, which may include its checksum",
+
+	// GetDescriptorInfoResult help.
+	"getdescriptorinforesult-descriptor":     "The descriptor in canonical form, without private keys",
+	"getdescriptorinforesult-checksum":       "The checksum of the input descriptor",
+	"getdescriptorinforesult-isrange":        "Whether the descriptor is ranged",
+	"getdescriptorinforesult-issolvable":     "Whether the descriptor is solvable",
+	"getdescriptorinforesult-hasprivatekeys": "Whether the input descriptor contains at least one private key",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -397,6 +562,7 @@ var helpDescsEnUS = map[string]string{
 	"infochainresult-difficulty":      "The current target difficulty",
 	"infochainresult-testnet":         "Whether or not server is using testnet",
 	"infochainresult-relayfee":        "The minimum relay fee for non-free transactions in BTC/KB",
+	"infochainresult-asmapchecksum":   "The checksum of the asmap used to group addresses by autonomous system, if any",
 	"infochainresult-errors":          "Any current errors",
 
 	// InfoWalletResult help.
@@ -463,12 +629,22 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-totalbytesrecv": "Total bytes received",
 	"getnettotalsresult-totalbytessent": "Total bytes sent",
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-uploadtarget":   "The state of the upload target",
+
+	// UploadTargetResult help.
+	"uploadtargetresult-timeframe":               "Length of the cycles the target applies to in seconds",
+	"uploadtargetresult-target":                  "Target in bytes per cycle, or 0 when there is no target",
+	"uploadtargetresult-target_reached":          "Whether or not the target is reached",
+	"uploadtargetresult-serve_historical_blocks": "Whether or not historical blocks are served to non-whitelisted peers",
+	"uploadtargetresult-bytes_left_in_cycle":     "Bytes left in the current cycle",
+	"uploadtargetresult-time_left_in_cycle":      "Seconds left in the current cycle",
 
 	// GetNodeAddressesResult help.
 	"getnodeaddressesresult-time":     "Timestamp in seconds since epoch (Jan 1 1970 GMT) keeping track of when the node was last seen",
 	"getnodeaddressesresult-services": "The services offered",
 	"getnodeaddressesresult-address":  "The address of the node",
 	"getnodeaddressesresult-port":     "The port of the node",
+	"getnodeaddressesresult-network":  "The network of the node (ipv4, ipv6, onion, i2p or cjdns)",
 
 	// GetNodeAddressesCmd help.
 	"getnodeaddresses--synopsis": "Return known addresses which can potentially be used to find new nodes in the network",
@@ -476,27 +652,29 @@ var helpDescsEnUS = map[string]string{
 	"getnodeaddresses--result0":  "List of node addresses",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":              "A unique node ID",
+	"getpeerinforesult-addr":            "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":       "Local address",
+	"getpeerinforesult-services":        "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":       "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":        "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":        "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":       "Total bytes sent",
+	"getpeerinforesult-bytesrecv":       "Total bytes received",
+	"getpeerinforesult-conntime":        "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":      "The time offset of the peer",
+	"getpeerinforesult-pingtime":        "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":        "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":         "The protocol version of the peer",
+	"getpeerinforesult-subver":          "The user agent of the peer",
+	"getpeerinforesult-inbound":         "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-connection_type": "The type of the connection (inbound, outbound-full-relay, block-relay-only or manual)",
+	"getpeerinforesult-startingheight":  "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":   "The current height of the peer",
+	"getpeerinforesult-banscore":        "The ban score",
+	"getpeerinforesult-feefilter":       "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":        "Whether or not the peer is the sync peer",
+	"getpeerinforesult-mapped_as":       "The number of the autonomous system the peer belongs to according to the asmap, if any",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -549,10 +727,59 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":        "The banned IP address or subnet",
+	"listbannedresult-ban_created":    "The time the ban was created in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-banned_until":   "The time the ban ends in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_duration":   "The duration of the ban in seconds",
+	"listbannedresult-time_remaining": "The time remaining until the ban ends in seconds",
+	"listbannedresult-ban_reason":     "The reason of the ban",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Approves the branch containing the given block so it may become the main chain even when doing so requires a reorganization deeper than the configured --maxreorgdepth.\n" +
+		"The reorganization is performed immediately when the branch already has more cumulative work than the current best chain.",
+	"reconsiderblock-blockhash": "The hash of the block to approve",
+
+	// ScanTxOutSetCmd help.
+	"scantxoutset--synopsis": "Scans the unspent transaction output set for the outputs paying to the scripts of a set of output descriptors.\n" +
+		"Only a single scan may be in progress at a time.  The start action blocks until the scan completes, and the abort and status actions stop and report the progress of the scan in progress.  The status action returns null when no scan is in progress.",
+	"scantxoutset-action":      "The action to perform: start, abort or status",
+	"scantxoutset-scanobjects": "The output descriptors to scan for, which are only used by the start action.  Use addr(ADDRESS) and raw(HEX) descriptors to scan for addresses and scripts",
+	"scantxoutset--condition0": "action=start",
+	"scantxoutset--condition1": "action=abort",
+	"scantxoutset--condition2": "action=status",
+	"scantxoutset--result1":    "Whether a scan in progress was aborted",
+
+	// ScanTxOutSetObject help.
+	"scantxoutsetobject-desc":  "The output descriptor",
+	"scantxoutsetobject-range": "The end or the [begin,end] range of child indexes to derive a ranged descriptor at (default: 1000)",
+
+	// ScanTxOutSetResult help.
+	"scantxoutsetresult-success":      "Whether the scan completed without being aborted",
+	"scantxoutsetresult-txouts":       "The number of unspent transaction outputs scanned",
+	"scantxoutsetresult-height":       "The height of the best block the scan was performed at",
+	"scantxoutsetresult-bestblock":    "The hash of the best block the scan was performed at",
+	"scantxoutsetresult-unspents":     "The unspent transaction outputs found",
+	"scantxoutsetresult-total_amount": "The total amount of the unspent transaction outputs found in BTC",
+
+	// ScanTxOutSetUnspent help.
+	"scantxoutsetunspent-txid":         "The hash of the transaction",
+	"scantxoutsetunspent-vout":         "The index of the output",
+	"scantxoutsetunspent-scriptPubKey": "The hex-encoded script of the output",
+	"scantxoutsetunspent-desc":         "A descriptor for the script of the output",
+	"scantxoutsetunspent-amount":       "The amount of the output in BTC",
+	"scantxoutsetunspent-height":       "The height of the block containing the output",
+
+	// ScanTxOutSetStatusResult help.
+	"scantxoutsetstatusresult-progress": "The approximate progress of the scan in percent",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -578,6 +805,14 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction--result0":     "The hash of the transaction",
 	"allowhighfeesormaxfeerate-value": "Either the boolean value for the allowhighfees parameter in bitcoind < v0.19.0 or the numerical value for the maxfeerate field in bitcoind v0.19.0 and later",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans an IP address or subnet, or lifts its ban.\n" +
+		"Banning disconnects the connected peers in the subnet and prevents connections to and from them until the ban ends.  Bans are persisted across restarts.",
+	"setban-subnet":   "The IP address or the subnet in CIDR notation (e.g. 1.2.3.0/24) to operate on",
+	"setban-subcmd":   "'add' to ban the subnet or 'remove' to lift its ban",
+	"setban-bantime":  "The duration of the ban in seconds, or the time the ban ends in seconds since 1 Jan 1970 GMT when absolute is set (0 uses --banduration)",
+	"setban-absolute": "Whether bantime is an absolute time instead of a duration",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -604,6 +839,28 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package of serialized, hex-encoded transactions to the local peer and relays the accepted ones to the network.\n" +
+		"The package must consist of a child transaction along with its unconfirmed parents, sorted so that the child comes last and no transaction spends the outputs of a later one.  " +
+		"The transactions which don't pay sufficient fees on their own are evaluated together, so a child paying high enough fees can pay for its parents.",
+	"submitpackage-rawtxs":  "Serialized, hex-encoded signed transactions of the package",
+	"submitpackage-hexdata": "Hex-encoded data which should match the data declared in the commitment of each transaction (an empty string for transactions without data)",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-package_msg":       "The result of the package evaluation, which is 'success' when the package was accepted",
+	"submitpackageresult-tx-results":        "The results of the package transactions",
+	"submitpackageresult-tx-results--key":   "wtxid",
+	"submitpackageresult-tx-results--value": "An object describing the result of a package transaction",
+	"submitpackageresult-tx-results--desc":  "The results of the package transactions keyed by their witness hash",
+
+	// SubmitPackageTxResult help.
+	"submitpackagetxresult-txid":  "The hash of the transaction",
+	"submitpackagetxresult-vsize": "The virtual size of the transaction",
+	"submitpackagetxresult-fees":  "The fees of the transaction, which are omitted for transactions already in the memory pool",
+
+	// SubmitPackageFees help.
+	"submitpackagefees-base": "The fees of the transaction in BTC",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid":         "Whether or not the address is valid",
 	"validateaddresschainresult-address":         "The bitcoin address (only when isvalid is true)",
@@ -640,7 +897,7 @@ var helpDescsEnUS = map[string]string{
 	"sessionresult-sessionid": "The unique session ID for a client's websocket connection.",
 
 	// NotifyBlocksCmd help.
-	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain, or a reorganization deeper than the configured max reorg depth is refused.",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
@@ -722,25 +979,34 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":                nil,
+	"clearbanned":            nil,
 	"createrawtransaction":   {(*string)(nil)},
 	"debuglevel":             {(*string)(nil), (*string)(nil)},
+	"debugscript":            {(*btcjson.TraceScriptResult)(nil)},
 	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
+	"deriveaddresses":        {(*[]string)(nil)},
 	"estimatefee":            {(*float64)(nil)},
 	"generate":               {(*[]string)(nil)},
 	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getaddressbalance":      {(*btcjson.GetAddressBalanceResult)(nil)},
+	"getaddressdeltas":       {(*[]btcjson.GetAddressDeltasResult)(nil)},
+	"getaddressutxos":        {(*[]btcjson.GetAddressUtxosResult)(nil)},
 	"getbestblock":           {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":       {(*string)(nil)},
 	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
 	"getblockcount":          {(*int64)(nil)},
 	"getblockhash":           {(*string)(nil)},
 	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":          {(*btcjson.GetBlockStatsResult)(nil), (*map[string]interface{})(nil)},
 	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"getblockchaininfo":      {(*btcjson.GetBlockChainInfoResult)(nil)},
 	"getcfilter":             {(*string)(nil)},
 	"getcfilterheader":       {(*string)(nil)},
+	"getchaintips":           {(*[]btcjson.GetChainTipsResult)(nil)},
 	"getconnectioncount":     {(*int32)(nil)},
 	"getcurrentnet":          {(*uint32)(nil)},
+	"getdescriptorinfo":      {(*btcjson.GetDescriptorInfoResult)(nil)},
 	"getdifficulty":          {(*float64)(nil)},
 	"getgenerate":            {(*bool)(nil)},
 	"gethashespersec":        {(*float64)(nil)},
@@ -755,15 +1021,21 @@ var rpcResultTypes = map[string][]interface{}{
 	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
 	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
+	"listbanned":             {(*[]btcjson.ListBannedResult)(nil)},
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
 	"ping":                   nil,
+	"reconsiderblock":        nil,
+	"scantxoutset":           {(*btcjson.ScanTxOutSetResult)(nil), (*bool)(nil), (*btcjson.ScanTxOutSetStatusResult)(nil)},
 	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":     {(*string)(nil)},
+	"setban":                 nil,
 	"setgenerate":            nil,
 	"signmessagewithprivkey": {(*string)(nil)},
 	"stop":                   {(*string)(nil)},
 	"submitblock":            {nil, (*string)(nil)},
+	"submitpackage":          {(*btcjson.SubmitPackageResult)(nil)},
+	"tracetransaction":       {(*[]btcjson.TraceScriptResult)(nil)},
 	"uptime":                 {(*int64)(nil)},
 	"validateaddress":        {(*btcjson.ValidateAddressChainResult)(nil)},
 	"verifychain":            {(*bool)(nil)},
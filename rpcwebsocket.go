@@ -226,6 +226,20 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *btcutil.Block) {
 	}
 }
 
+// NotifyDeepReorg passes a reorganization refused by the chain for exceeding
+// the max reorg depth to the notification manager for block notification
+// processing.
+func (m *wsNotificationManager) NotifyDeepReorg(reorg *blockchain.DeepReorg) {
+	// As NotifyDeepReorg will be called by the block manager and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- (*notificationDeepReorg)(reorg):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -447,6 +461,7 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 // Notification types
 type notificationBlockConnected btcutil.Block
 type notificationBlockDisconnected btcutil.Block
+type notificationDeepReorg blockchain.DeepReorg
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
@@ -532,6 +547,12 @@ out:
 						block)
 				}
 
+			case *notificationDeepReorg:
+				if len(blockNotifications) != 0 {
+					m.notifyDeepReorg(blockNotifications,
+						(*blockchain.DeepReorg)(n))
+				}
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -730,6 +751,26 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	}
 }
 
+// notifyDeepReorg notifies websocket clients that have registered for block
+// updates when a reorganization deeper than the max reorg depth was refused.
+func (*wsNotificationManager) notifyDeepReorg(clients map[chan struct{}]*wsClient,
+	reorg *blockchain.DeepReorg) {
+
+	ntfn := btcjson.NewDeepReorgNtfn(reorg.ForkHash.String(),
+		reorg.ForkHeight, reorg.OldTipHash.String(), reorg.OldTipHeight,
+		reorg.NewTipHash.String(), reorg.NewTipHeight, reorg.Depth,
+		reorg.MaxDepth)
+	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal deep reorg notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
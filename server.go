@@ -22,6 +22,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/aead/siphash"
 	"github.com/babylonchain-io/bbld/addrmgr"
 	"github.com/babylonchain-io/bbld/blockchain"
 	"github.com/babylonchain-io/bbld/blockchain/indexers"
@@ -38,6 +39,7 @@ import (
 	"github.com/babylonchain-io/bbld/peer"
 	"github.com/babylonchain-io/bbld/txscript"
 	"github.com/babylonchain-io/bbld/wire"
+	"github.com/decred/dcrd/lru"
 )
 
 const (
@@ -53,10 +55,30 @@ const (
 	// defaultTargetOutbound is the default number of outbound peers to target.
 	defaultTargetOutbound = 8
 
+	// defaultBlockRelayOnlyOutbound is the default number of block-relay-only
+	// outbound peers to target in addition to the full relay ones.
+	defaultBlockRelayOnlyOutbound = 2
+
 	// connectionRetryInterval is the base amount of time to wait in between
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// maxCmpctBlockDepth is the maximum depth of a block, relative to the
+	// best chain tip, which is served as a compact block.  Deeper blocks
+	// are sent in full since peers are unlikely to be able to reconstruct
+	// them from their transaction pool.
+	maxCmpctBlockDepth = 5
+
+	// maxBlockTxnDepth is the maximum depth of a block, relative to the
+	// best chain tip, for which individual transactions are served in
+	// response to a getblocktxn message.  Deeper blocks are sent in full.
+	maxBlockTxnDepth = 10
+
+	// maxV1OnlyAddrs is the maximum number of addresses remembered to have
+	// rejected the v2 transport, which are connected to with the v1
+	// transport instead.
+	maxV1OnlyAddrs = 1000
 )
 
 var (
@@ -151,12 +173,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -207,6 +228,8 @@ type server struct {
 
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
+	banList              *banList
+	uploadTarget         *uploadTarget
 	connManager          *connmgr.ConnManager
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
@@ -226,6 +249,8 @@ type server struct {
 	wg                   sync.WaitGroup
 	quit                 chan struct{}
 	nat                  NAT
+	onionTarget          string
+	v1OnlyAddrs          lru.Cache
 	db                   database.DB
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
@@ -234,9 +259,10 @@ type server struct {
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex       *indexers.TxIndex
+	addrIndex     *indexers.AddrIndex
+	addrUtxoIndex *indexers.AddrUtxoIndex
+	cfIndex       *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -254,13 +280,19 @@ type server struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// netGroupKey is the random key the network groups of inbound peers
+	// are hashed with to select the ones protected from eviction.
+	netGroupKey [siphash.KeySize]byte
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter     int64
+	lastBlockTime int64
+	lastTxTime    int64
 
 	*peer.Peer
 
@@ -296,6 +328,29 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 	}
 }
 
+// noteRelayedBlock records the time the peer relayed the block with the passed
+// hash when the block was not known before and has been accepted.  Peers which
+// recently relayed new blocks are protected from eviction.
+func (sp *serverPeer) noteRelayedBlock(hash *chainhash.Hash, known bool) {
+	if known {
+		return
+	}
+	chain := sp.server.chain
+	if have, _ := chain.HaveBlock(hash); have && !chain.IsKnownOrphan(hash) {
+		atomic.StoreInt64(&sp.lastBlockTime, time.Now().Unix())
+	}
+}
+
+// noteRelayedTx records the time the peer relayed the transaction with the
+// passed hash when the transaction was not known before and has been accepted
+// to the memory pool.  Peers which recently relayed new transactions are
+// protected from eviction.
+func (sp *serverPeer) noteRelayedTx(hash *chainhash.Hash, known bool) {
+	if !known && sp.server.txMemPool.IsTransactionInPool(hash) {
+		atomic.StoreInt64(&sp.lastTxTime, time.Now().Unix())
+	}
+}
+
 // newestBlock returns the current best block hash and height using the format
 // required by the configuration for the peer package.
 func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
@@ -305,7 +360,7 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
 
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
-func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
+func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddressV2) {
 	sp.addressesMtx.Lock()
 	for _, na := range addresses {
 		sp.knownAddresses[addrmgr.NetAddressKey(na)] = struct{}{}
@@ -314,13 +369,20 @@ func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
 }
 
 // addressKnown true if the given address is already known to the peer.
-func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
+func (sp *serverPeer) addressKnown(na *wire.NetAddressV2) bool {
 	sp.addressesMtx.RLock()
 	_, exists := sp.knownAddresses[addrmgr.NetAddressKey(na)]
 	sp.addressesMtx.RUnlock()
 	return exists
 }
 
+// isBlockRelayOnly returns whether the peer is an outbound peer only used to
+// relay blocks.  No transactions or addresses are relayed to or accepted from
+// such peers.
+func (sp *serverPeer) isBlockRelayOnly() bool {
+	return sp.connReq != nil && sp.connReq.BlockRelayOnly
+}
+
 // setDisableRelayTx toggles relaying of transactions for the given peer.
 // It is safe for concurrent access.
 func (sp *serverPeer) setDisableRelayTx(disable bool) {
@@ -329,6 +391,17 @@ func (sp *serverPeer) setDisableRelayTx(disable bool) {
 	sp.relayMtx.Unlock()
 }
 
+// txInvVect returns the inventory vector the passed transaction is announced
+// to and requested from the peer with.  Peers relaying transactions by their
+// witness hash (BIP0339) use MSG_WTX inventory vectors, while other peers use
+// MSG_TX inventory vectors with the transaction hash.
+func (sp *serverPeer) txInvVect(tx *btcutil.Tx) *wire.InvVect {
+	if sp.WantsWTxIdRelay() {
+		return wire.NewInvVect(wire.InvTypeWTx, tx.WitnessHash())
+	}
+	return wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+}
+
 // relayTxDisabled returns whether or not relaying of transactions for the given
 // peer is disabled.
 // It is safe for concurrent access.
@@ -340,23 +413,41 @@ func (sp *serverPeer) relayTxDisabled() bool {
 	return isDisabled
 }
 
-// pushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.
-func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
+// pushAddrMsg sends an addrv2 message to the connected peer using the provided
+// addresses when it signaled support for them, or an addr message otherwise.
+// Addresses that can't be represented in an addr message are not sent to
+// peers that don't support addrv2.
+func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddressV2) {
 	// Filter addresses already known to the peer.
-	addrs := make([]*wire.NetAddress, 0, len(addresses))
+	addrs := make([]*wire.NetAddressV2, 0, len(addresses))
 	for _, addr := range addresses {
 		if !sp.addressKnown(addr) {
 			addrs = append(addrs, addr)
 		}
 	}
-	known, err := sp.PushAddrMsg(addrs)
+
+	if sp.WantsAddrV2() {
+		sp.addKnownAddresses(sp.PushAddrV2Msg(addrs))
+		return
+	}
+
+	legacyAddrs := make([]*wire.NetAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		if legacy := addr.ToLegacy(); legacy != nil {
+			legacyAddrs = append(legacyAddrs, legacy)
+		}
+	}
+	known, err := sp.PushAddrMsg(legacyAddrs)
 	if err != nil {
 		peerLog.Errorf("Can't push address message to %s: %v", sp.Peer, err)
 		sp.Disconnect()
 		return
 	}
-	sp.addKnownAddresses(known)
+	knownAddrs := make([]*wire.NetAddressV2, 0, len(known))
+	for _, na := range known {
+		knownAddrs = append(knownAddrs, wire.NewNetAddressV2FromLegacy(na))
+	}
+	sp.addKnownAddresses(knownAddrs)
 }
 
 // addBanScore increases the persistent and decaying ban score fields by the
@@ -518,8 +609,7 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 		// or only the transactions that match the filter when there is
 		// one.
 		if !sp.filter.IsLoaded() || sp.filter.MatchTxAndUpdate(txDesc.Tx) {
-			iv := wire.NewInvVect(wire.InvTypeTx, txDesc.Tx.Hash())
-			invMsg.AddInvVect(iv)
+			invMsg.AddInvVect(sp.txInvVect(txDesc.Tx))
 			if len(invMsg.InvList)+1 > wire.MaxInvPerMsg {
 				break
 			}
@@ -538,7 +628,7 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 // transactions don't rely on the previous one in a linear fashion like blocks.
 // TODO: after babylon modification it is not used, so consider removing it
 func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
-	if cfg.BlocksOnly {
+	if cfg.BlocksOnly || sp.isBlockRelayOnly() {
 		peerLog.Tracef("Ignoring tx %v from %v - blocksonly enabled",
 			msg.TxHash(), sp)
 		return
@@ -548,16 +638,17 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	// Convert the raw MsgTx to a btcutil.Tx which provides some convenience
 	// methods and things such as hash caching.
 	tx := btcutil.NewTx(msg)
-	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
-	sp.AddKnownInventory(iv)
+	sp.AddKnownInventory(sp.txInvVect(tx))
 
 	// Queue the transaction up to be handled by the sync manager and
 	// intentionally block further receives until the transaction is fully
 	// processed and known good or bad.  This helps prevent a malicious peer
 	// from queuing up a bunch of bad transactions before disconnecting (or
 	// being disconnected) and wasting memory.
+	known := sp.server.txMemPool.HaveTransaction(tx.Hash())
 	sp.server.syncManager.QueueTx(tx, nil, sp.Peer, sp.txProcessed)
 	<-sp.txProcessed
+	sp.noteRelayedTx(tx.Hash(), known)
 }
 
 // OnTx is invoked when a peer receives a tx wit data babylon message.  It blocks
@@ -565,7 +656,7 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 // handler this does not serialize all transactions through a single thread
 // transactions don't rely on the previous one in a linear fashion like blocks.
 func (sp *serverPeer) OnTxWithData(_ *peer.Peer, msg *wire.MsgTxData) {
-	if cfg.BlocksOnly {
+	if cfg.BlocksOnly || sp.isBlockRelayOnly() {
 		peerLog.Tracef("Ignoring tx %v from %v - blocksonly enabled",
 			msg.Tx.TxHash(), sp)
 		return
@@ -575,16 +666,17 @@ func (sp *serverPeer) OnTxWithData(_ *peer.Peer, msg *wire.MsgTxData) {
 	// Convert the raw MsgTx to a btcutil.Tx which provides some convenience
 	// methods and things such as hash caching.
 	tx := btcutil.NewTx(&msg.Tx)
-	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
-	sp.AddKnownInventory(iv)
+	sp.AddKnownInventory(sp.txInvVect(tx))
 
 	// Queue the transaction up to be handled by the sync manager and
 	// intentionally block further receives until the transaction is fully
 	// processed and known good or bad.  This helps prevent a malicious peer
 	// from queuing up a bunch of bad transactions before disconnecting (or
 	// being disconnected) and wasting memory.
+	known := sp.server.txMemPool.HaveTransaction(tx.Hash())
 	sp.server.syncManager.QueueTx(tx, msg.Data, sp.Peer, sp.txProcessed)
 	<-sp.txProcessed
+	sp.noteRelayedTx(tx.Hash(), known)
 }
 
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
@@ -609,8 +701,91 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	// reference implementation processes blocks in the same
 	// thread and therefore blocks further messages until
 	// the bitcoin block has been fully processed.
+	known, _ := sp.server.chain.HaveBlock(block.Hash())
 	sp.server.syncManager.QueueBlock(block, sp.Peer, sp.blockProcessed)
 	<-sp.blockProcessed
+	sp.noteRelayedBlock(block.Hash(), known)
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// The compact block is handed over to the sync manager which reconstructs
+// the block from the transaction pool.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	// Like blocks, intentionally block further receives until the compact
+	// block is processed.
+	blockHash := msg.Header.BlockHash()
+	known, _ := sp.server.chain.HaveBlock(&blockHash)
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer, sp.blockProcessed)
+	<-sp.blockProcessed
+	sp.noteRelayedBlock(&blockHash, known)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  The
+// transactions are handed over to the sync manager to complete the block
+// previously announced by a compact block.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	known, _ := sp.server.chain.HaveBlock(&msg.BlockHash)
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer, sp.blockProcessed)
+	<-sp.blockProcessed
+	sp.noteRelayedBlock(&msg.BlockHash, known)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// The requested transactions, along with their attached data, are sent back
+// so the peer can complete a block announced by a compact block.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	chain := sp.server.chain
+	doneChan := make(chan struct{}, 1)
+
+	// Send blocks which are too deep to have been recently announced in
+	// full.  The same applies to blocks not in the main chain.
+	height, err := chain.BlockHeightByHash(&msg.BlockHash)
+	if err != nil || chain.BestSnapshot().Height-height > maxBlockTxnDepth {
+		err := sp.server.pushBlockMsg(sp, &msg.BlockHash, doneChan, nil,
+			wire.WitnessEncoding)
+		if err != nil {
+			peerLog.Debugf("Unable to serve getblocktxn for block %v "+
+				"to %s: %v", msg.BlockHash, sp, err)
+		}
+		<-doneChan
+		return
+	}
+
+	block, err := chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch requested block hash %v: %v",
+			msg.BlockHash, err)
+		return
+	}
+
+	// Locate the data attached to each transaction of the block.
+	msgBlock := block.MsgBlock()
+	dataIndexes := make([]int, len(msgBlock.Transactions))
+	var numData int
+	for i, tx := range msgBlock.Transactions {
+		if tx.HasAttachedData() {
+			dataIndexes[i] = numData
+			numData++
+		}
+	}
+
+	blockTxn := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if int(index) >= len(msgBlock.Transactions) {
+			sp.addBanScore(100, 0, "getblocktxn index out of range")
+			return
+		}
+
+		tx := msgBlock.Transactions[index]
+		var data []byte
+		if tx.HasAttachedData() {
+			data = msgBlock.PosData[dataIndexes[index]]
+		}
+		blockTxn.AddTransaction(tx, data)
+	}
+
+	sp.QueueMessageWithEncoding(blockTxn, doneChan, wire.WitnessEncoding)
+	<-doneChan
 }
 
 // OnInv is invoked when a peer receives an inv bitcoin message and is
@@ -618,7 +793,7 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.isBlockRelayOnly() {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -627,7 +802,9 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 
 	newInv := wire.NewMsgInvSizeHint(uint(len(msg.InvList)))
 	for _, invVect := range msg.InvList {
-		if invVect.Type == wire.InvTypeTx {
+		if invVect.Type == wire.InvTypeTx ||
+			invVect.Type == wire.InvTypeWTx {
+
 			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
 				"blocksonly enabled", invVect.Hash, sp)
 			if sp.ProtocolVersion() >= wire.BIP0037Version {
@@ -692,14 +869,18 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 		}
 		var err error
 		switch iv.Type {
+		case wire.InvTypeWTx:
+			err = sp.server.pushTxMsg(sp, &iv.Hash, true, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeWitnessTx:
-			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
+			err = sp.server.pushTxMsg(sp, &iv.Hash, false, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeTx:
-			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+			err = sp.server.pushTxMsg(sp, &iv.Hash, false, c, waitChan, wire.BaseEncoding)
 		case wire.InvTypeWitnessBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeFilteredWitnessBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeFilteredBlock:
@@ -1282,8 +1463,9 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// Ignore addresses when running on the simulation test network.  This
 	// helps prevent the network from becoming another public test network
 	// since it will not be able to learn about other peers that have not
-	// specifically been provided.
-	if cfg.SimNet {
+	// specifically been provided.  Addresses are not relayed over
+	// block-relay-only connections either.
+	if cfg.SimNet || sp.isBlockRelayOnly() {
 		return
 	}
 
@@ -1300,7 +1482,38 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	addrs := make([]*wire.NetAddressV2, 0, len(msg.AddrList))
 	for _, na := range msg.AddrList {
+		addrs = append(addrs, wire.NewNetAddressV2FromLegacy(na))
+	}
+	sp.addAddresses(addrs)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	// Ignore addresses when running on the simulation test network.  This
+	// helps prevent the network from becoming another public test network
+	// since it will not be able to learn about other peers that have not
+	// specifically been provided.  Addresses are not relayed over
+	// block-relay-only connections either.
+	if cfg.SimNet || sp.isBlockRelayOnly() {
+		return
+	}
+
+	// Addresses of networks unknown to us are dropped when decoding the
+	// message, so unlike addr, an empty address list is not an error.
+	if len(msg.AddrList) == 0 {
+		return
+	}
+
+	sp.addAddresses(msg.AddrList)
+}
+
+// addAddresses adds the addresses advertised by the peer to its set of known
+// addresses and to the server address manager.
+func (sp *serverPeer) addAddresses(addrs []*wire.NetAddressV2) {
+	for _, na := range addrs {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -1315,7 +1528,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		}
 
 		// Add address to known addresses for this peer.
-		sp.addKnownAddresses([]*wire.NetAddress{na})
+		sp.addKnownAddresses([]*wire.NetAddressV2{na})
 	}
 
 	// Add addresses to server address manager.  The address manager handles
@@ -1323,7 +1536,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrs, sp.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1351,10 +1564,14 @@ func (sp *serverPeer) OnNotFound(p *peer.Peer, msg *wire.MsgNotFound) {
 			numBlocks++
 		case wire.InvTypeWitnessBlock:
 			numBlocks++
+		case wire.InvTypeCmpctBlock:
+			numBlocks++
 		case wire.InvTypeTx:
 			numTxns++
 		case wire.InvTypeWitnessTx:
 			numTxns++
+		case wire.InvTypeWTx:
+			numTxns++
 		default:
 			peerLog.Debugf("Invalid inv type '%d' in notfound message from %s",
 				inv.Type, sp)
@@ -1457,15 +1674,21 @@ func (s *server) TransactionConfirmed(tx *btcutil.Tx) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
-// pushTxMsg sends a tx message for the provided transaction hash to the
-// connected peer.  An error is returned if the transaction hash is not known.
-func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
-	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
+// pushTxMsg sends a tx message for the provided transaction hash, or witness
+// hash when the wtxid flag is set, to the connected peer.  An error is returned
+// if the transaction hash is not known.
+func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, wtxid bool,
+	doneChan chan<- struct{}, waitChan <-chan struct{},
+	encoding wire.MessageEncoding) error {
 
 	// Attempt to fetch the requested transaction from the pool.  A
 	// call could be made to check for existence first, but simply trying
 	// to fetch a missing transaction results in the same behavior.
-	tx, posData, err := s.txMemPool.FetchTransaction(hash)
+	fetchTransaction := s.txMemPool.FetchTransaction
+	if wtxid {
+		fetchTransaction = s.txMemPool.FetchTransactionByWitnessHash
+	}
+	tx, posData, err := fetchTransaction(hash)
 	if err != nil {
 		peerLog.Tracef("Unable to fetch tx %v from transaction "+
 			"pool: %v", hash, err)
@@ -1489,11 +1712,55 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	return nil
 }
 
+// mayServeBlock returns whether the block with the provided hash may be sent to
+// the peer with regards to the upload target.  Once the target is reached,
+// historical blocks, as well as filtered blocks which are mostly requested by
+// syncing light clients, are no longer served to peers which are not
+// whitelisted, and such peers are disconnected as they are of no use to them.
+func (s *server) mayServeBlock(sp *serverPeer, hash *chainhash.Hash,
+	filtered bool) bool {
+
+	if sp.isWhitelisted {
+		return true
+	}
+	if s.uploadTarget.historicalBlocksAllowed(time.Now()) {
+		return true
+	}
+	if !filtered {
+		header, err := s.chain.HeaderByHash(hash)
+		if err != nil {
+			// Unknown blocks are reported as not found.
+			return true
+		}
+		best := s.chain.BestSnapshot()
+		bestHeader, err := s.chain.HeaderByHash(&best.Hash)
+		if err != nil {
+			return true
+		}
+		age := bestHeader.Timestamp.Sub(header.Timestamp)
+		if age <= historicalBlockAge {
+			return true
+		}
+	}
+
+	peerLog.Infof("Historical block serving limit reached -- "+
+		"disconnecting peer %s", sp)
+	sp.Disconnect()
+	return false
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
 	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
+	if !s.mayServeBlock(sp, hash, false) {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return nil
+	}
+
 	// Fetch the raw block bytes from the database.
 	var blockBytes []byte
 	err := sp.server.db.View(func(dbTx database.Tx) error {
@@ -1555,6 +1822,51 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  Blocks which are too deep in the chain to be
+// reconstructed from the transaction pool of the peer are sent in full
+// instead.  An error is returned if the block hash is not known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+
+	chain := sp.server.chain
+	height, err := chain.BlockHeightByHash(hash)
+	if err != nil || chain.BestSnapshot().Height-height > maxCmpctBlockDepth {
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan,
+			wire.WitnessEncoding)
+	}
+
+	blk, err := chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	cmpctBlock := wire.NewMsgCmpctBlockFromBlock(blk.MsgBlock(), nonce)
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	// The short ids commit to the witness hashes, so the prefilled
+	// transactions are always sent along with their witnesses.
+	sp.QueueMessageWithEncoding(cmpctBlock, doneChan, wire.WitnessEncoding)
+	return nil
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1563,7 +1875,7 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 	doneChan chan<- struct{}, waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
 	// Do not send a response if the peer doesn't have a filter loaded.
-	if !sp.filter.IsLoaded() {
+	if !sp.filter.IsLoaded() || !s.mayServeBlock(sp, hash, true) {
 		if doneChan != nil {
 			doneChan <- struct{}{}
 		}
@@ -1671,22 +1983,21 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd))
-			sp.Disconnect()
-			return false
-		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
+	if banEnd, ok := s.banList.isBanned(net.ParseIP(host)); ok {
+		srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
+			host, time.Until(banEnd))
+		sp.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= cfg.MaxPeers {
+	// Limit max number of total peers.  New inbound peers take the place
+	// of an existing inbound peer selected by the eviction policy when
+	// possible so attackers can't easily occupy all slots.
+	if state.Count() >= cfg.MaxPeers &&
+		(!sp.Inbound() || !s.evictInboundPeer(state)) {
+
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
 			cfg.MaxPeers, sp)
 		sp.Disconnect()
@@ -1700,7 +2011,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1725,13 +2036,17 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if !cfg.SimNet && !sp.Inbound() {
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
-		// known tip.
-		if !cfg.DisableListen && s.syncManager.IsCurrent() {
+		// known tip.  Addresses are not relayed over block-relay-only
+		// connections.
+		blockRelayOnly := sp.isBlockRelayOnly()
+		if !cfg.DisableListen && !blockRelayOnly &&
+			s.syncManager.IsCurrent() {
+
 			// Get address that best matches.
 			lna := s.addrManager.GetBestLocalAddress(sp.NA())
 			if addrmgr.IsRoutable(lna) {
 				// Filter addresses the peer already knows about.
-				addresses := []*wire.NetAddress{lna}
+				addresses := []*wire.NetAddressV2{lna}
 				sp.pushAddrMsg(addresses)
 			}
 		}
@@ -1740,7 +2055,9 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		// more and the peer has a protocol version new enough to
 		// include a timestamp with addresses.
 		hasTimestamp := sp.ProtocolVersion() >= wire.NetAddressTimeVersion
-		if s.addrManager.NeedMoreAddresses() && hasTimestamp {
+		if !blockRelayOnly && s.addrManager.NeedMoreAddresses() &&
+			hasTimestamp {
+
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
@@ -1767,8 +2084,26 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	// our connection manager about the disconnection. This can happen if we
 	// process a peer's `done` message before its `add`.
 	if !sp.Inbound() {
+		// Peers which rejected the v2 transport are reconnected with the
+		// v1 transport.  Persistent peers are retried anyway.
+		v2Rejected := sp.V2TransportRejected()
+		if v2Rejected {
+			srvrLog.Debugf("Peer %s rejected the v2 transport -- "+
+				"reconnecting with the v1 transport", sp)
+			s.v1OnlyAddrs.Add(sp.connReq.Addr.String())
+		}
+
 		if sp.persistent {
 			s.connManager.Disconnect(sp.connReq.ID())
+		} else if v2Rejected {
+			s.connManager.Remove(sp.connReq.ID())
+			go s.connManager.Connect(&connmgr.ConnReq{
+				Addr:           sp.connReq.Addr,
+				BlockRelayOnly: sp.connReq.BlockRelayOnly,
+			})
+		} else if sp.isBlockRelayOnly() {
+			s.connManager.Remove(sp.connReq.ID())
+			go s.connManager.NewBlockRelayOnlyConnReq()
 		} else {
 			s.connManager.Remove(sp.connReq.ID())
 			go s.connManager.NewConnReq()
@@ -1777,7 +2112,7 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		delete(list, sp.ID())
 		srvrLog.Debugf("Removed peer %s", sp)
@@ -1793,30 +2128,72 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
 		return
 	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		srvrLog.Debugf("can't ban peer %s without an IP address",
+			sp.Addr())
+		return
+	}
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
+	s.banList.add(singleIPSubnet(ip), time.Now().Add(cfg.BanDuration),
+		banReasonMisbehaving)
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// The compact block announced to high-bandwidth peers is only built
+	// once, the first time it's needed.
+	var cmpctBlock *wire.MsgCmpctBlock
+
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
 
+		// If the inventory is a block and the peer asked for compact
+		// block announcements, send the compact block directly.
+		if msg.invVect.Type == wire.InvTypeBlock &&
+			sp.WantsCmpctBlockAnnouncements() {
+
+			if sp.IsKnownInventory(msg.invVect) {
+				return
+			}
+			block, ok := msg.data.(*btcutil.Block)
+			if !ok {
+				peerLog.Warnf("Underlying data for compact " +
+					"block is not a block")
+				return
+			}
+			if cmpctBlock == nil {
+				nonce, err := wire.RandomUint64()
+				if err != nil {
+					peerLog.Errorf("Failed to generate compact "+
+						"block nonce: %v", err)
+					return
+				}
+				cmpctBlock = wire.NewMsgCmpctBlockFromBlock(
+					block.MsgBlock(), nonce)
+			}
+			sp.AddKnownInventory(msg.invVect)
+			sp.QueueMessageWithEncoding(cmpctBlock, nil,
+				wire.WitnessEncoding)
+			return
+		}
+
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
 		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
-			blockHeader, ok := msg.data.(wire.BlockHeader)
+			block, ok := msg.data.(*btcutil.Block)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
-					" is not a block header")
+					" is not a block")
 				return
 			}
+			blockHeader := block.MsgBlock().Header
 			msgHeaders := wire.NewMsgHeaders()
 			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
 				peerLog.Errorf("Failed to add block"+
@@ -1829,8 +2206,8 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 
 		if msg.invVect.Type == wire.InvTypeTx {
 			// Don't relay the transaction to the peer when it has
-			// transaction relaying disabled.
-			if sp.relayTxDisabled() {
+			// transaction relaying disabled or only relays blocks.
+			if sp.relayTxDisabled() || sp.isBlockRelayOnly() {
 				return
 			}
 
@@ -1856,6 +2233,11 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Announce the transaction by its witness hash to
+			// peers relaying transactions that way.
+			sp.QueueInventory(sp.txInvVect(txD.Tx))
+			return
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1916,6 +2298,13 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type banSubnetMsg struct {
+	subnet *net.IPNet
+	until  time.Time
+	reason string
+	reply  chan struct{}
+}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -1973,7 +2362,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -2009,7 +2398,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -2017,7 +2406,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -2025,6 +2414,23 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		}
 
 		msg.reply <- errors.New("peer not found")
+
+	case banSubnetMsg:
+		s.banList.add(msg.subnet, msg.until, msg.reason)
+
+		// Disconnect the connected peers which are now banned.
+		state.forAllPeers(func(sp *serverPeer) {
+			host, _, err := net.SplitHostPort(sp.Addr())
+			if err != nil {
+				return
+			}
+			ip := net.ParseIP(host)
+			if ip != nil && msg.subnet.Contains(ip) {
+				srvrLog.Infof("Disconnecting banned peer %s", sp)
+				sp.Disconnect()
+			}
+		})
+		msg.reply <- struct{}{}
 	}
 }
 
@@ -2054,6 +2460,12 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
+	// Whitelisted peers are exempt from the send rate limit.
+	var maxSendRate uint64
+	if !sp.isWhitelisted {
+		maxSendRate = cfg.MaxPeerSendRate
+	}
+
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:      sp.OnVersion,
@@ -2062,6 +2474,9 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnTx:           sp.OnTx,
 			OnTxData:       sp.OnTxWithData,
 			OnBlock:        sp.OnBlock,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
+			OnBlockTxn:     sp.OnBlockTxn,
 			OnInv:          sp.OnInv,
 			OnHeaders:      sp.OnHeaders,
 			OnGetData:      sp.OnGetData,
@@ -2076,6 +2491,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:   sp.OnFilterLoad,
 			OnGetAddr:      sp.OnGetAddr,
 			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 			OnNotFound:     sp.OnNotFound,
@@ -2098,9 +2514,29 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		ProtocolVersion:     peer.MaxProtocolVersion,
 		TrickleInterval:     cfg.TrickleInterval,
 		DisableStallHandler: cfg.DisableStallHandler,
+		MaxSendRate:         maxSendRate,
+		V2Transport:         cfg.V2Transport,
 	}
 }
 
+// useV2Transport returns whether the v2 transport protocol is attempted for the
+// passed outbound connection request.  It is only attempted with addresses
+// advertising support for it, or persistent peers since their services are
+// unknown, unless the address already rejected it.
+func (s *server) useV2Transport(c *connmgr.ConnReq) bool {
+	if !cfg.V2Transport || s.v1OnlyAddrs.Contains(c.Addr.String()) {
+		return false
+	}
+	if c.Permanent {
+		return true
+	}
+	na, err := s.addrManager.DeserializeNetAddress(c.Addr.String(), 0)
+	if err != nil {
+		return false
+	}
+	return s.addrManager.Services(na)&wire.SFNodeP2PV2 != 0
+}
+
 // inboundPeerConnected is invoked by the connection manager when a new inbound
 // connection is established.  It initializes a new inbound server peer
 // instance, associates it with the connection, and starts a goroutine to wait
@@ -2120,11 +2556,22 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+
+	// Ask block-relay-only peers not to announce transactions.
+	peerCfg := newPeerConfig(sp)
+	if c.BlockRelayOnly {
+		peerCfg.DisableRelayTx = true
+	}
+	peerCfg.V2Transport = s.useV2Transport(c)
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		if c.Permanent {
 			s.connManager.Disconnect(c.ID())
+		} else if c.BlockRelayOnly {
+			s.connManager.Remove(c.ID())
+			go s.connManager.NewBlockRelayOnlyConnReq()
 		} else {
 			s.connManager.Remove(c.ID())
 			go s.connManager.NewConnReq()
@@ -2133,7 +2580,6 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	}
 	sp.Peer = p
 	sp.connReq = c
-	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
@@ -2177,7 +2623,6 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
@@ -2190,7 +2635,11 @@ func (s *server) peerHandler() {
 				// DNS seed lookups will vary quite a lot.
 				// to replicate this behaviour we put all addresses as
 				// having come from the first one.
-				s.addrManager.AddAddresses(addrs, addrs[0])
+				addrsV2 := make([]*wire.NetAddressV2, 0, len(addrs))
+				for _, na := range addrs {
+					addrsV2 = append(addrsV2, wire.NewNetAddressV2FromLegacy(na))
+				}
+				s.addrManager.AddAddresses(addrsV2, addrsV2[0])
 			})
 	}
 	go s.connManager.Start()
@@ -2227,6 +2676,18 @@ out:
 			s.handleQuery(state, qmsg)
 
 		case <-s.quit:
+			// Persist the block-relay-only peers as the anchors to
+			// connect to first on the next start.
+			var anchors []string
+			state.forAllOutboundPeers(func(sp *serverPeer) {
+				if sp.Connected() && sp.isBlockRelayOnly() {
+					anchors = append(anchors, sp.Addr())
+				}
+			})
+			if len(anchors) > 0 {
+				saveAnchors(cfg.DataDir, anchors)
+			}
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				srvrLog.Tracef("Shutdown peer %s", sp)
@@ -2305,6 +2766,7 @@ func (s *server) OutboundGroupCount(key string) int {
 // for the server.  It is safe for concurrent access.
 func (s *server) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.uploadTarget.addBytesSent(bytesSent, time.Now())
 }
 
 // AddBytesReceived adds the passed number of bytes to the total bytes received
@@ -2410,6 +2872,11 @@ func (s *server) Start() {
 		go s.upnpUpdateThread()
 	}
 
+	if s.onionTarget != "" {
+		s.wg.Add(1)
+		go s.onionServiceHandler()
+	}
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
@@ -2575,7 +3042,7 @@ out:
 					srvrLog.Warnf("UPnP can't get external address: %v", err)
 					continue out
 				}
-				na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
+				na := wire.NewNetAddressV2IPPort(externalip, uint16(listenPort),
 					s.services)
 				err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
 				if err != nil {
@@ -2664,8 +3131,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.V2Transport {
+		services |= wire.SFNodeP2PV2
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	if cfg.ASMap != "" {
+		asmap, err := addrmgr.LoadASMap(cfg.ASMap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load asmap %s: %v",
+				cfg.ASMap, err)
+		}
+		amgr.SetASMap(asmap)
+		srvrLog.Infof("Using asmap %s with checksum %s", cfg.ASMap,
+			asmap.Checksum())
+	}
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2690,6 +3170,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	s := server{
 		chainParams:          chainParams,
 		addrManager:          amgr,
+		banList:              newBanList(cfg.DataDir),
+		uploadTarget:         newUploadTarget(cfg.MaxUploadTarget),
+		v1OnlyAddrs:          lru.NewCache(maxV1OnlyAddrs),
 		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
 		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
 		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
@@ -2710,6 +3193,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		agentWhitelist:       agentWhitelist,
 	}
 
+	if _, err := rand.Read(s.netGroupKey[:]); err != nil {
+		return nil, err
+	}
+
+	// Publish an onion service which forwards to the first listener when a
+	// Tor control port is configured.
+	if cfg.TorControl != "" && len(listeners) > 0 {
+		s.onionTarget = onionServiceTarget(listeners[0].Addr())
+	}
+
+	// Load the banned subnets persisted by previous runs.
+	if err := s.banList.load(); err != nil {
+		srvrLog.Warnf("Unable to load banned subnets: %v", err)
+	}
+
 	// Create the transaction and address indexes if needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
@@ -2736,6 +3234,11 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
+	if cfg.AddrUtxoIndex {
+		indxLog.Info("Address utxo index is enabled")
+		s.addrUtxoIndex = indexers.NewAddrUtxoIndex(db, chainParams)
+		indexes = append(indexes, s.addrUtxoIndex)
+	}
 	if !cfg.NoCFilters {
 		indxLog.Info("Committed filter index is enabled")
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
@@ -2757,14 +3260,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:            s.db,
+		Interrupt:     interrupt,
+		ChainParams:   s.chainParams,
+		Checkpoints:   checkpoints,
+		TimeSource:    s.timeSource,
+		SigCache:      s.sigCache,
+		IndexManager:  indexManager,
+		HashCache:     s.hashCache,
+		MaxReorgDepth: cfg.MaxReorgDepth,
 	})
 	if err != nil {
 		return nil, err
@@ -2886,7 +3390,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				// in the same group so that we are not connecting
 				// to the same network segment at the expense of
 				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
+				key := s.addrManager.GroupKey(addr.NetAddress())
 				if s.OutboundGroupCount(key) != 0 {
 					continue
 				}
@@ -2914,19 +3418,39 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 	}
 
-	// Create a connection manager.
+	// Create a connection manager.  Block-relay-only connections are only
+	// made when connecting to discovered peers, in which case the ones of
+	// the previous run are connected to first.
 	targetOutbound := defaultTargetOutbound
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	var targetBlockRelayOnly int
+	var anchors []net.Addr
+	if newAddressFunc != nil {
+		targetBlockRelayOnly = defaultBlockRelayOnlyOutbound
+		if cfg.MaxPeers-targetOutbound < targetBlockRelayOnly {
+			targetBlockRelayOnly = cfg.MaxPeers - targetOutbound
+		}
+		for _, addr := range loadAnchors(cfg.DataDir) {
+			netAddr, err := addrStringToNetAddr(addr)
+			if err != nil {
+				srvrLog.Warnf("Ignoring anchor %s: %v", addr, err)
+				continue
+			}
+			anchors = append(anchors, netAddr)
+		}
+	}
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:            listeners,
+		OnAccept:             s.inboundPeerConnected,
+		RetryDuration:        connectionRetryInterval,
+		TargetOutbound:       uint32(targetOutbound),
+		TargetBlockRelayOnly: uint32(targetBlockRelayOnly),
+		Anchors:              anchors,
+		Dial:                 btcdDial,
+		OnConnection:         s.outboundPeerConnected,
+		GetNewAddress:        newAddressFunc,
 	})
 	if err != nil {
 		return nil, err
@@ -2962,21 +3486,22 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
-			StartupTime:  s.startupTime,
-			ConnMgr:      &rpcConnManager{&s},
-			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
-			TimeSource:   s.timeSource,
-			Chain:        s.chain,
-			ChainParams:  chainParams,
-			DB:           db,
-			TxMemPool:    s.txMemPool,
-			Generator:    blockTemplateGenerator,
-			CPUMiner:     s.cpuMiner,
-			TxIndex:      s.txIndex,
-			AddrIndex:    s.addrIndex,
-			CfIndex:      s.cfIndex,
-			FeeEstimator: s.feeEstimator,
+			Listeners:     rpcListeners,
+			StartupTime:   s.startupTime,
+			ConnMgr:       &rpcConnManager{&s},
+			SyncMgr:       &rpcSyncMgr{&s, s.syncManager},
+			TimeSource:    s.timeSource,
+			Chain:         s.chain,
+			ChainParams:   chainParams,
+			DB:            db,
+			TxMemPool:     s.txMemPool,
+			Generator:     blockTemplateGenerator,
+			CPUMiner:      s.cpuMiner,
+			TxIndex:       s.txIndex,
+			AddrIndex:     s.addrIndex,
+			AddrUtxoIndex: s.addrUtxoIndex,
+			CfIndex:       s.cfIndex,
+			FeeEstimator:  s.feeEstimator,
 		})
 		if err != nil {
 			return nil, err
@@ -3149,7 +3674,7 @@ func addLocalAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.Se
 				continue
 			}
 
-			netAddr := wire.NewNetAddressIPPort(ifaceIP, uint16(port), services)
+			netAddr := wire.NewNetAddressV2IPPort(ifaceIP, uint16(port), services)
 			addrMgr.AddLocalAddress(netAddr, addrmgr.BoundPrio)
 		}
 	} else {
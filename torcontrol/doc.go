@@ -0,0 +1,24 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package torcontrol implements a client of the Tor control port which publishes
+onion services.
+
+Tor Control Overview
+
+A Tor daemon exposes a control port which its controllers use to change its
+configuration over a line based text protocol.  This package authenticates with
+the control port using no authentication, a password, or the authentication
+cookie of the daemon (preferring the SAFECOOKIE challenge-response method over
+sending the cookie itself), and creates v3 onion services with the ADD_ONION
+command.
+
+An onion service created by ADD_ONION only lasts as long as the control
+connection it was created on, so the connection must be kept open for as long
+as the service should be reachable.  The private key of the service is returned
+when it is generated by Tor, and can be passed in later to publish the service
+under the same onion address again.
+*/
+package torcontrol
@@ -0,0 +1,415 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package torcontrol
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dialTimeout is the maximum time to wait for the connection to the
+	// control port to be established.
+	dialTimeout = 10 * time.Second
+
+	// replyOK is the status code of successful replies.
+	replyOK = 250
+
+	// replyAsync is the status code of asynchronous event notifications.
+	replyAsync = 650
+
+	// safeCookieNonceSize is the size of the nonces exchanged during
+	// SAFECOOKIE authentication.
+	safeCookieNonceSize = 32
+
+	// The keys of the HMACs exchanged during SAFECOOKIE authentication.
+	safeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	safeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+
+	// newOnionKey requests ADD_ONION to generate a new v3 onion service
+	// key.
+	newOnionKey = "NEW:ED25519-V3"
+)
+
+var (
+	// ErrNoAuthMethod is returned when the control port supports none of
+	// the authentication methods which can be used with the given
+	// configuration.
+	ErrNoAuthMethod = errors.New("no supported authentication method")
+
+	// ErrServerHashMismatch is returned when the control port fails to
+	// prove it knows the authentication cookie during SAFECOOKIE
+	// authentication, which means the cookie file belongs to a different
+	// Tor daemon than the one connected to.
+	ErrServerHashMismatch = errors.New("safe cookie server hash mismatch")
+)
+
+// ReplyError describes an error reply of the control port to a command.
+type ReplyError struct {
+	Code    int
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("tor control reply %d: %s", e.Code, e.Message)
+}
+
+// reply is a reply of the control port to a command.  The lines hold the text
+// of each reply line after the status code, with the data of multi-line
+// entries appended to their line separated by newlines.
+type reply struct {
+	code  int
+	lines []string
+}
+
+// Controller is a client of the Tor control port.
+type Controller struct {
+	conn   net.Conn
+	reader *textproto.Reader
+}
+
+// NewController returns a controller which speaks the control protocol over
+// the passed connection to the control port.
+func NewController(conn net.Conn) *Controller {
+	return &Controller{
+		conn:   conn,
+		reader: textproto.NewReader(bufio.NewReader(conn)),
+	}
+}
+
+// Dial connects to the control port at the passed address.
+func Dial(addr string) (*Controller, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewController(conn), nil
+}
+
+// Close closes the connection to the control port, which removes the onion
+// services created over it.
+func (c *Controller) Close() error {
+	return c.conn.Close()
+}
+
+// Wait blocks until the connection to the control port is closed, discarding
+// any asynchronous events, and returns the error which closed it.
+func (c *Controller) Wait() error {
+	for {
+		if _, err := c.readReply(); err != nil {
+			return err
+		}
+	}
+}
+
+// readReply reads the next reply from the control port.
+func (c *Controller) readReply() (*reply, error) {
+	var r reply
+	for {
+		line, err := c.reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 {
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+		r.code = code
+
+		text := line[4:]
+		switch line[3] {
+		case ' ':
+			r.lines = append(r.lines, text)
+			return &r, nil
+
+		case '-':
+			r.lines = append(r.lines, text)
+
+		case '+':
+			data, err := c.reader.ReadDotLines()
+			if err != nil {
+				return nil, err
+			}
+			r.lines = append(r.lines, text+"\n"+
+				strings.Join(data, "\n"))
+
+		default:
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+	}
+}
+
+// sendCommand sends the passed command to the control port and returns its
+// reply.  Asynchronous events received in the meantime are discarded.  A
+// ReplyError is returned when the command failed.
+func (c *Controller) sendCommand(cmd string) (*reply, error) {
+	if _, err := c.conn.Write([]byte(cmd + "\r\n")); err != nil {
+		return nil, err
+	}
+
+	for {
+		r, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		if r.code == replyAsync {
+			continue
+		}
+		if r.code != replyOK {
+			return nil, &ReplyError{
+				Code:    r.code,
+				Message: strings.Join(r.lines, " "),
+			}
+		}
+		return r, nil
+	}
+}
+
+// protocolInfo describes the authentication methods supported by the control
+// port as returned by the PROTOCOLINFO command.
+type protocolInfo struct {
+	authMethods map[string]struct{}
+	cookieFile  string
+}
+
+// protocolInfo queries the authentication methods of the control port.
+func (c *Controller) protocolInfo() (*protocolInfo, error) {
+	r, err := c.sendCommand("PROTOCOLINFO 1")
+	if err != nil {
+		return nil, err
+	}
+
+	info := protocolInfo{authMethods: make(map[string]struct{})}
+	for _, line := range r.lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		args := parseArgs(strings.TrimPrefix(line, "AUTH "))
+		for _, method := range strings.Split(args["METHODS"], ",") {
+			info.authMethods[method] = struct{}{}
+		}
+		info.cookieFile = args["COOKIEFILE"]
+	}
+	return &info, nil
+}
+
+// Authenticate authenticates the controller with the control port.  When a
+// password is passed, it is used with the HASHEDPASSWORD method.  Otherwise,
+// no authentication is used if the control port allows it, or else the
+// authentication cookie of the Tor daemon is used with the SAFECOOKIE or
+// COOKIE methods.
+func (c *Controller) Authenticate(password string) error {
+	info, err := c.protocolInfo()
+	if err != nil {
+		return err
+	}
+	supports := func(method string) bool {
+		_, ok := info.authMethods[method]
+		return ok
+	}
+
+	switch {
+	case password != "" && supports("HASHEDPASSWORD"):
+		_, err = c.sendCommand("AUTHENTICATE " + quote(password))
+		return err
+
+	case password == "" && supports("NULL"):
+		_, err = c.sendCommand("AUTHENTICATE")
+		return err
+
+	case password == "" && supports("SAFECOOKIE"):
+		return c.authenticateSafeCookie(info.cookieFile)
+
+	case password == "" && supports("COOKIE"):
+		cookie, err := ioutil.ReadFile(info.cookieFile)
+		if err != nil {
+			return err
+		}
+		_, err = c.sendCommand("AUTHENTICATE " + hex.EncodeToString(cookie))
+		return err
+	}
+	return ErrNoAuthMethod
+}
+
+// authenticateSafeCookie authenticates with the cookie in the passed file
+// using the SAFECOOKIE challenge-response method, which proves knowledge of
+// the cookie without revealing it to a control port impersonating Tor.
+func (c *Controller) authenticateSafeCookie(cookieFile string) error {
+	cookie, err := ioutil.ReadFile(cookieFile)
+	if err != nil {
+		return err
+	}
+
+	var clientNonce [safeCookieNonceSize]byte
+	if _, err := rand.Read(clientNonce[:]); err != nil {
+		return err
+	}
+	r, err := c.sendCommand("AUTHCHALLENGE SAFECOOKIE " +
+		hex.EncodeToString(clientNonce[:]))
+	if err != nil {
+		return err
+	}
+	args := parseArgs(strings.TrimPrefix(r.lines[0], "AUTHCHALLENGE "))
+	serverHash, err := hex.DecodeString(args["SERVERHASH"])
+	if err != nil {
+		return fmt.Errorf("malformed server hash: %v", err)
+	}
+	serverNonce, err := hex.DecodeString(args["SERVERNONCE"])
+	if err != nil {
+		return fmt.Errorf("malformed server nonce: %v", err)
+	}
+
+	message := make([]byte, 0, len(cookie)+2*safeCookieNonceSize)
+	message = append(message, cookie...)
+	message = append(message, clientNonce[:]...)
+	message = append(message, serverNonce...)
+	if !hmac.Equal(serverHash, safeCookieHash(safeCookieServerKey, message)) {
+		return ErrServerHashMismatch
+	}
+
+	clientHash := safeCookieHash(safeCookieClientKey, message)
+	_, err = c.sendCommand("AUTHENTICATE " + hex.EncodeToString(clientHash))
+	return err
+}
+
+// safeCookieHash returns the HMAC-SHA256 of the passed message with the passed
+// key.
+func safeCookieHash(key string, message []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// AddOnion creates a v3 onion service which forwards the connections to the
+// passed virtual port to the passed target address for as long as the
+// connection to the control port is open.  A new private key is generated for
+// the service when the passed private key is empty.  It returns the service
+// id, which is the onion address without the .onion suffix, and the private
+// key of the service in the "ED25519-V3:<base64 key>" form ADD_ONION accepts.
+func (c *Controller) AddOnion(privateKey string, virtPort uint16,
+	target string) (string, string, error) {
+
+	key := privateKey
+	if key == "" {
+		key = newOnionKey
+	}
+	r, err := c.sendCommand(fmt.Sprintf("ADD_ONION %s Port=%d,%s", key,
+		virtPort, target))
+	if err != nil {
+		return "", "", err
+	}
+
+	var serviceID string
+	for _, line := range r.lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = strings.TrimPrefix(line, "ServiceID=")
+		case strings.HasPrefix(line, "PrivateKey="):
+			privateKey = strings.TrimPrefix(line, "PrivateKey=")
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("no service id in ADD_ONION reply")
+	}
+	if privateKey == "" {
+		return "", "", errors.New("no private key in ADD_ONION reply")
+	}
+
+	log.Debugf("Created onion service %s.onion", serviceID)
+	return serviceID, privateKey, nil
+}
+
+// parseArgs parses the space separated KEY=VALUE arguments of a reply line.
+// Values may be quoted strings, which are unescaped.  Arguments without a
+// value are ignored.
+func parseArgs(s string) map[string]string {
+	args := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := s[:eq]
+		if sp := strings.IndexByte(key, ' '); sp >= 0 {
+			// An argument without a value.
+			s = s[sp:]
+			continue
+		}
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s = unquote(s)
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		args[key] = value
+	}
+	return args
+}
+
+// unquote returns the unescaped content of the quoted string at the start of
+// the passed string, along with the rest of the passed string after it.
+func unquote(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:]
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(s[i])
+				}
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// quote returns the passed string as a quoted string of the control protocol.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package torcontrol
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeControlPort is a fake Tor control port which supports the commands
+// needed to authenticate and create onion services.
+type fakeControlPort struct {
+	listener    net.Listener
+	authMethods string
+	cookieFile  string
+	cookie      []byte
+	password    string
+
+	// commands receives the commands sent to the control port.
+	commands chan string
+}
+
+// newFakeControlPort starts a fake control port which supports the passed
+// authentication methods.  The authentication cookie is written to the passed
+// directory.
+func newFakeControlPort(t *testing.T, dir, authMethods,
+	password string) *fakeControlPort {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	cookie := []byte("0123456789abcdef0123456789abcdef")
+	cookieFile := filepath.Join(dir, "control_auth_cookie")
+	if err := ioutil.WriteFile(cookieFile, cookie, 0600); err != nil {
+		t.Fatalf("unable to write cookie: %v", err)
+	}
+
+	f := &fakeControlPort{
+		listener:    listener,
+		authMethods: authMethods,
+		cookieFile:  cookieFile,
+		cookie:      cookie,
+		password:    password,
+		commands:    make(chan string, 10),
+	}
+	go f.serve()
+	return f
+}
+
+// serve handles a single control connection.
+func (f *fakeControlPort) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var clientNonce, serverNonce []byte
+	authenticated := false
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		f.commands <- line
+		fields := strings.Fields(line)
+
+		var reply string
+		switch {
+		case fields[0] == "PROTOCOLINFO":
+			reply = fmt.Sprintf("250-PROTOCOLINFO 1\r\n"+
+				"250-AUTH METHODS=%s COOKIEFILE=%q\r\n"+
+				"250-VERSION Tor=\"0.4.5.7\"\r\n250 OK\r\n",
+				f.authMethods, f.cookieFile)
+
+		case fields[0] == "AUTHCHALLENGE":
+			clientNonce, _ = hex.DecodeString(fields[2])
+			serverNonce = []byte("fedcba9876543210fedcba9876543210")
+			message := append(append(append([]byte{}, f.cookie...),
+				clientNonce...), serverNonce...)
+			reply = fmt.Sprintf("250 AUTHCHALLENGE SERVERHASH=%x "+
+				"SERVERNONCE=%x\r\n", safeCookieHash(
+				safeCookieServerKey, message), serverNonce)
+
+		case fields[0] == "AUTHENTICATE":
+			var want string
+			switch {
+			case f.password != "":
+				want = quote(f.password)
+			case clientNonce != nil:
+				message := append(append(append([]byte{},
+					f.cookie...), clientNonce...),
+					serverNonce...)
+				want = hex.EncodeToString(safeCookieHash(
+					safeCookieClientKey, message))
+			case strings.Contains(f.authMethods, "COOKIE"):
+				want = hex.EncodeToString(f.cookie)
+			}
+			got := strings.TrimPrefix(strings.TrimPrefix(line,
+				"AUTHENTICATE"), " ")
+			if got != want {
+				reply = "515 Authentication failed: Password " +
+					"did not match HashedControlPassword " +
+					"*or* authentication cookie.\r\n"
+				break
+			}
+			authenticated = true
+			reply = "250 OK\r\n"
+
+		case !authenticated:
+			reply = "514 Authentication required.\r\n"
+
+		case fields[0] == "ADD_ONION":
+			// Asynchronous events may precede the reply.
+			reply = "650 STATUS_CLIENT NOTICE CIRCUIT_ESTABLISHED\r\n" +
+				"250-ServiceID=pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2" +
+				"ymmju6nubxndf4pscryd\r\n"
+			if fields[1] == newOnionKey {
+				reply += "250-PrivateKey=ED25519-V3:c2VjcmV0\r\n"
+			}
+			reply += "250 OK\r\n"
+
+		default:
+			reply = "510 Unrecognized command\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// TestController ensures the controller authenticates with the supported
+// methods and creates onion services.
+func TestController(t *testing.T) {
+	tests := []struct {
+		name         string
+		authMethods  string
+		serverPass   string
+		password     string
+		wantCommands []string
+		wantErr      bool
+	}{
+		{
+			name:        "null",
+			authMethods: "NULL",
+			wantCommands: []string{"PROTOCOLINFO 1",
+				"AUTHENTICATE"},
+		},
+		{
+			name:        "password",
+			authMethods: "HASHEDPASSWORD",
+			serverPass:  `pass"word`,
+			password:    `pass"word`,
+			wantCommands: []string{"PROTOCOLINFO 1",
+				`AUTHENTICATE "pass\"word"`},
+		},
+		{
+			name:        "wrong password",
+			authMethods: "HASHEDPASSWORD",
+			serverPass:  "password",
+			password:    "wrong",
+			wantErr:     true,
+		},
+		{
+			name:        "safe cookie",
+			authMethods: "COOKIE,SAFECOOKIE",
+			wantCommands: []string{"PROTOCOLINFO 1",
+				"AUTHCHALLENGE SAFECOOKIE"},
+		},
+		{
+			name:        "cookie",
+			authMethods: "COOKIE",
+			wantCommands: []string{"PROTOCOLINFO 1",
+				"AUTHENTICATE 30313233"},
+		},
+		{
+			name:        "no supported method",
+			authMethods: "HASHEDPASSWORD",
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "torcontrol")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		port := newFakeControlPort(t, dir, test.authMethods,
+			test.serverPass)
+		defer port.listener.Close()
+
+		ctrl, err := Dial(port.listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: Dial: unexpected error: %v", test.name, err)
+		}
+		defer ctrl.Close()
+
+		err = ctrl.Authenticate(test.password)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: Authenticate: unexpected success",
+					test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Authenticate: unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		for _, want := range test.wantCommands {
+			if got := <-port.commands; !strings.HasPrefix(got, want) {
+				t.Errorf("%s: wrong command - got %q, want %q",
+					test.name, got, want)
+			}
+		}
+
+		// A new private key is returned when the service is created
+		// for the first time.
+		serviceID, key, err := ctrl.AddOnion("", 8333, "127.0.0.1:8333")
+		if err != nil {
+			t.Errorf("%s: AddOnion: unexpected error: %v", test.name,
+				err)
+			continue
+		}
+		if !strings.HasPrefix(serviceID, "pg6mmjiyjmcrsslvykfwnntlaru7p5") ||
+			key != "ED25519-V3:c2VjcmV0" {
+
+			t.Errorf("%s: AddOnion: unexpected result %s, %s",
+				test.name, serviceID, key)
+		}
+
+		// The passed private key is used to recreate the service.
+		_, key2, err := ctrl.AddOnion(key, 8333, "127.0.0.1:8333")
+		if err != nil || key2 != key {
+			t.Errorf("%s: AddOnion with key: got %s, %v", test.name,
+				key2, err)
+		}
+	}
+}
+
+// TestAddOnionBeforeAuthentication ensures error replies are returned as
+// ReplyError.
+func TestAddOnionBeforeAuthentication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torcontrol")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	port := newFakeControlPort(t, dir, "NULL", "")
+	defer port.listener.Close()
+
+	ctrl, err := Dial(port.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	defer ctrl.Close()
+
+	_, _, err = ctrl.AddOnion("", 8333, "127.0.0.1:8333")
+	replyErr, ok := err.(*ReplyError)
+	if !ok || replyErr.Code != 514 {
+		t.Fatalf("AddOnion: unexpected error %v", err)
+	}
+}
+
+// TestParseArgs ensures reply line arguments, including quoted strings, are
+// parsed as expected.
+func TestParseArgs(t *testing.T) {
+	args := parseArgs(`METHODS=COOKIE,SAFECOOKIE FLAG ` +
+		`COOKIEFILE="/var/lib/tor/a \"b\"\\c"`)
+	if args["METHODS"] != "COOKIE,SAFECOOKIE" {
+		t.Errorf("wrong METHODS %q", args["METHODS"])
+	}
+	if want := `/var/lib/tor/a "b"\c`; args["COOKIEFILE"] != want {
+		t.Errorf("wrong COOKIEFILE - got %q, want %q",
+			args["COOKIEFILE"], want)
+	}
+	if _, ok := args["FLAG"]; ok {
+		t.Errorf("argument without value parsed")
+	}
+	if got := quote(`a "b"\c`); got != `"a \"b\"\\c"` {
+		t.Errorf("wrong quoted string %s", got)
+	}
+}
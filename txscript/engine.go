@@ -13,6 +13,8 @@ import (
 	"strings"
 
 	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/wire"
 )
 
@@ -95,6 +97,25 @@ const (
 	// operation whose public key isn't serialized in a compressed format
 	// non-standard.
 	ScriptVerifyWitnessPubKeyType
+
+	// ScriptVerifyTaproot defines whether or not to verify a transaction
+	// output using the new taproot validation rules.  This is BIP0341 and
+	// BIP0342.
+	ScriptVerifyTaproot
+
+	// ScriptVerifyDiscourageUpgradeableTaprootVersion defines whether or
+	// not to consider any new/unknown taproot leaf versions as
+	// non-standard.
+	ScriptVerifyDiscourageUpgradeableTaprootVersion
+
+	// ScriptVerifyDiscourageOpSuccess defines whether or not to consider
+	// usage of OP_SUCCESS op codes during tapscript execution as
+	// non-standard.
+	ScriptVerifyDiscourageOpSuccess
+
+	// ScriptVerifyDiscourageUpgradeablePubkeyType defines if unknown
+	// public key versions (during tapscript execution) are non-standard.
+	ScriptVerifyDiscourageUpgradeablePubkeyType
 )
 
 const (
@@ -112,11 +133,54 @@ const (
 	// payToWitnessScriptHashDataSize is the size of the witness program's
 	// data push for a pay-to-witness-script-hash output.
 	payToWitnessScriptHashDataSize = 32
+
+	// payToTaprootDataSize is the size of the witness program push for
+	// taproot spends.  This will be the serialized x-coordinate of the
+	// top-level taproot output public key.
+	payToTaprootDataSize = 32
 )
 
 // halforder is used to tame ECDSA malleability (see BIP0062).
 var halfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
 
+// taprootExecutionCtx houses the special context-specific information we need
+// to validate a taproot script spend.  This includes the annex, the running
+// sig op count tally, and other relevant information.
+type taprootExecutionCtx struct {
+	annex []byte
+
+	codeSepPos uint32
+
+	tapLeafHash chainhash.Hash
+
+	sigOpsBudget int32
+
+	mustSucceed bool
+}
+
+// tallysigOp attempts to decrease the current sig ops budget by sigOpsDelta.
+// An error is returned if after subtracting the delta, the budget is below
+// zero.
+func (t *taprootExecutionCtx) tallysigOp() error {
+	t.sigOpsBudget -= sigOpsDelta
+
+	if t.sigOpsBudget < 0 {
+		return scriptError(ErrTaprootMaxSigOps, "")
+	}
+
+	return nil
+}
+
+// newTaprootExecutionCtx returns a fresh instance of the taproot execution
+// context.  The starting sig ops budget is the passed witness size plus the
+// base budget.
+func newTaprootExecutionCtx(inputWitnessSize int32) *taprootExecutionCtx {
+	return &taprootExecutionCtx{
+		codeSepPos:   blankCodeSepValue,
+		sigOpsBudget: sigOpsDelta + inputWitnessSize,
+	}
+}
+
 // Engine is the virtual machine that executes scripts.
 type Engine struct {
 	// The following fields are set when the engine is created and must not be
@@ -145,13 +209,30 @@ type Engine struct {
 	// since transaction scripts are often executed more than once from various
 	// contexts (e.g. new block templates, when transactions are first seen
 	// prior to being mined, part of full block verification, etc).
-	flags     ScriptFlags
-	tx        wire.MsgTx
-	txIdx     int
-	version   uint16
-	bip16     bool
-	sigCache  *SigCache
-	hashCache *TxSigHashes
+	//
+	// hashCache caches the midstate of the segwit v0 and v1 sighashes to
+	// optimize worst-case hashing complexity.
+	//
+	// prevOutFetcher is used to look up all the previous output of a
+	// transaction being validated, which is required by the taproot
+	// sighash.
+	//
+	// schnorrBatch, when set, collects the BIP0340 signatures that aren't
+	// in the signature cache instead of verifying them, so the caller can
+	// verify them all at once after execution.
+	//
+	// tracer, when set, is notified of every opcode the engine steps
+	// through.
+	flags          ScriptFlags
+	tx             wire.MsgTx
+	txIdx          int
+	version        uint16
+	bip16          bool
+	sigCache       *SigCache
+	hashCache      *TxSigHashes
+	prevOutFetcher PrevOutputFetcher
+	schnorrBatch   *schnorr.BatchVerifier
+	tracer         ExecutionTracer
 
 	// The following fields handle keeping track of the current execution state
 	// of the engine.
@@ -187,6 +268,10 @@ type Engine struct {
 	//
 	// numOps tracks the total number of non-push operations in a script and is
 	// primarily used to enforce maximum limits.
+	//
+	// taprootCtx houses the annex, sig op budget and tapscript leaf of a
+	// taproot spend, and is only set once the witness program has been
+	// identified as a taproot output.
 	scripts         [][]byte
 	scriptIdx       int
 	opcodeIdx       int
@@ -200,6 +285,7 @@ type Engine struct {
 	witnessVersion  int
 	witnessProgram  []byte
 	inputAmount     int64
+	taprootCtx      *taprootExecutionCtx
 }
 
 // hasFlag returns whether the script engine instance has the passed flag set.
@@ -355,8 +441,12 @@ func (vm *Engine) executeOpcode(op *opcode, data []byte) error {
 	}
 
 	// Note that this includes OP_RESERVED which counts as a push operation.
+	// Tapscript has no limit on the number of operations since signature
+	// operations are instead limited by the sig op budget.
 	if op.value > OP_16 {
-		vm.numOps++
+		if vm.taprootCtx == nil {
+			vm.numOps++
+		}
 		if vm.numOps > MaxOpsPerScript {
 			str := fmt.Sprintf("exceeded max operation limit of %d",
 				MaxOpsPerScript)
@@ -488,6 +578,19 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 				len(vm.witnessProgram))
 			return scriptError(ErrWitnessProgramWrongLength, errStr)
 		}
+	} else if vm.isWitnessVersionActive(TaprootWitnessVersion) &&
+		len(vm.witnessProgram) == payToTaprootDataSize && !vm.bip16 &&
+		vm.hasFlag(ScriptVerifyTaproot) {
+
+		// We're attempting to verify a taproot input, and the witness
+		// program data push is of the expected size, so we'll be
+		// looking for a normal key-path spend, or a merkle proof for a
+		// tapscript with execution afterwards.  Prior to the
+		// activation of taproot, such outputs are treated like any
+		// other unknown witness program version below.
+		if err := vm.verifyTaprootWitness(witness); err != nil {
+			return err
+		}
 	} else if vm.hasFlag(ScriptVerifyDiscourageUpgradeableWitnessProgram) {
 		errStr := fmt.Sprintf("new witness program versions "+
 			"invalid: %v", vm.witnessProgram)
@@ -517,6 +620,128 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 	return nil
 }
 
+// verifyTaprootWitness validates the passed witness against the taproot
+// witness program stored in the engine.  A witness with a single element
+// after the optional annex is removed is a key path spend, which is fully
+// validated here.  Otherwise, the witness is a script path spend, in which
+// case the commitment of the revealed tapscript within the output key is
+// checked and the tapscript is set up as the next script to execute.
+func (vm *Engine) verifyTaprootWitness(witness [][]byte) error {
+	// The witness stack MUST NOT be empty.
+	if len(witness) == 0 {
+		return scriptError(ErrWitnessProgramEmpty, "witness "+
+			"program empty passed empty witness")
+	}
+
+	// The sig op budget of a tapscript is derived from the size of the
+	// entire serialized witness, including the annex, the tapscript and
+	// the control block.
+	witnessSize := wire.TxWitness(witness).SerializeSize()
+	vm.taprootCtx = newTaprootExecutionCtx(int32(witnessSize))
+
+	// If the witness has an annex, then it's removed from the witness
+	// stack, but committed to within the sighash of all signatures.
+	if isAnnexedWitness(witness) {
+		vm.taprootCtx.annex = witness[len(witness)-1]
+		witness = witness[:len(witness)-1]
+	}
+
+	// A single remaining element is a key path spend, so the element must
+	// be a valid signature for the witness program, which is the output
+	// key itself.
+	if len(witness) == 1 {
+		err := vm.verifyTaprootSig(witness[0], vm.witnessProgram)
+		if err != nil {
+			return err
+		}
+
+		// Nothing else is executed for a key path spend, so the
+		// validation of the input is now complete.
+		vm.taprootCtx.mustSucceed = true
+		return nil
+	}
+
+	// Otherwise this is a script path spend, so the last element is the
+	// control block, and the element before it is the revealed script.
+	controlBlock, err := ParseControlBlock(witness[len(witness)-1])
+	if err != nil {
+		return err
+	}
+	witnessScript := witness[len(witness)-2]
+
+	// Ensure that the revealed script is committed to within the output
+	// key through the merkle proof of the control block.
+	tapLeaf := NewTapLeaf(controlBlock.LeafVersion, witnessScript)
+	vm.taprootCtx.tapLeafHash = tapLeaf.TapHash()
+	err = verifyTaprootLeafCommitment(
+		controlBlock, vm.taprootCtx.tapLeafHash, vm.witnessProgram,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Unknown leaf versions are reserved for future soft forks, so they
+	// succeed without executing the script unless they're discouraged.
+	if controlBlock.LeafVersion != BaseLeafVersion {
+		if vm.hasFlag(ScriptVerifyDiscourageUpgradeableTaprootVersion) {
+			str := fmt.Sprintf("tapscript leaf version %#x is "+
+				"reserved for soft-fork upgrades",
+				controlBlock.LeafVersion)
+			return scriptError(ErrDiscourageUpgradeableTaprootVersion, str)
+		}
+
+		vm.taprootCtx.mustSucceed = true
+		return nil
+	}
+
+	// A tapscript that contains an OP_SUCCESS opcode anywhere succeeds
+	// unconditionally, even when the remainder of the script fails to
+	// parse.  Thus, scan the script for them before checking it parses.
+	tokenizer := MakeScriptTokenizer(vm.version, witnessScript)
+	for tokenizer.Next() {
+		if !IsOpSuccess(tokenizer.Opcode()) {
+			continue
+		}
+
+		if vm.hasFlag(ScriptVerifyDiscourageOpSuccess) {
+			str := fmt.Sprintf("tapscript contains reserved "+
+				"opcode %#x", tokenizer.Opcode())
+			return scriptError(ErrDiscourageOpSuccess, str)
+		}
+
+		vm.taprootCtx.mustSucceed = true
+		return nil
+	}
+	if err := tokenizer.Err(); err != nil {
+		return err
+	}
+
+	// The initial tapscript stack is subject to the same limits as the
+	// stack during execution.  Note that, unlike other scripts, there is
+	// no limit on the size of a tapscript.
+	stack := witness[:len(witness)-2]
+	if len(stack) > MaxStackSize {
+		str := fmt.Sprintf("tapscript stack size %d > max allowed %d",
+			len(stack), MaxStackSize)
+		return scriptError(ErrStackOverflow, str)
+	}
+	for _, witElement := range stack {
+		if len(witElement) > MaxScriptElementSize {
+			str := fmt.Sprintf("element size %d exceeds max "+
+				"allowed size %d", len(witElement),
+				MaxScriptElementSize)
+			return scriptError(ErrElementTooBig, str)
+		}
+	}
+
+	// Use the remaining witness as the stack, and set the tapscript to be
+	// the next script executed.
+	vm.scripts = append(vm.scripts, witnessScript)
+	vm.SetStack(stack)
+
+	return nil
+}
+
 // DisasmPC returns the string for the disassembly of the opcode that will be
 // next to execute when Step is called.
 func (vm *Engine) DisasmPC() (string, error) {
@@ -593,6 +818,14 @@ func (vm *Engine) CheckErrorCondition(finalScript bool) error {
 			"error check when script unfinished")
 	}
 
+	// If this is a taproot spend that has already been determined to be
+	// valid, such as a key path spend, or a tapscript with an OP_SUCCESS
+	// opcode or an unknown leaf version, then there is nothing else to
+	// check.
+	if vm.taprootCtx != nil && vm.taprootCtx.mustSucceed {
+		return nil
+	}
+
 	// If we're in version zero witness execution mode, and this was the
 	// final script, then the stack MUST be clean in order to maintain
 	// compatibility with BIP16.
@@ -601,6 +834,13 @@ func (vm *Engine) CheckErrorCondition(finalScript bool) error {
 			"have clean stack")
 	}
 
+	// The stack MUST also be clean after the execution of a tapscript.
+	if finalScript && vm.taprootCtx != nil && vm.dstack.Depth() != 1 {
+		str := fmt.Sprintf("tapscript stack must contain exactly one "+
+			"item (contains %d)", vm.dstack.Depth())
+		return scriptError(ErrCleanStack, str)
+	}
+
 	// The final script must end with exactly one data stack item when the
 	// verify clean stack flag is set.  Otherwise, there must be at least one
 	// data stack item in order to interpret it as a boolean.
@@ -665,11 +905,22 @@ func (vm *Engine) Step() (done bool, err error) {
 		return true, scriptError(ErrInvalidProgramCounter, str)
 	}
 
+	// Note whether the opcode executes before executing it for the tracer
+	// since executing it can change the conditional state.
+	var executed bool
+	if vm.tracer != nil {
+		executed = vm.isBranchExecuting() ||
+			isOpcodeConditional(vm.tokenizer.op.value)
+	}
+
 	// Execute the opcode while taking into account several things such as
 	// disabled opcodes, illegal opcodes, maximum allowed operations per script,
 	// maximum script element sizes, and conditionals.
 	err = vm.executeOpcode(vm.tokenizer.op, vm.tokenizer.Data())
 	if err != nil {
+		if vm.tracer != nil {
+			vm.traceStep(executed, err)
+		}
 		return true, err
 	}
 
@@ -679,7 +930,15 @@ func (vm *Engine) Step() (done bool, err error) {
 	if combinedStackSize > MaxStackSize {
 		str := fmt.Sprintf("combined stack size %d > max allowed %d",
 			combinedStackSize, MaxStackSize)
-		return false, scriptError(ErrStackOverflow, str)
+		err = scriptError(ErrStackOverflow, str)
+		if vm.tracer != nil {
+			vm.traceStep(executed, err)
+		}
+		return false, err
+	}
+
+	if vm.tracer != nil {
+		vm.traceStep(executed, nil)
 	}
 
 	// Prepare for next instruction.
@@ -1068,6 +1327,104 @@ func (vm *Engine) checkSignatureEncoding(sig []byte) error {
 	return nil
 }
 
+// verifyTaprootSig verifies the passed BIP0340 signature of either a key path
+// spend, or a signature check within a tapscript, against the passed
+// serialized x-only public key.  The signature may be followed by a single
+// byte sighash type, in which case it must not be the implicit default
+// sighash type.  Any additional sighash options, such as the tapscript
+// extension, are committed to in the signature hash as well as the annex of
+// the spend, if present.
+func (vm *Engine) verifyTaprootSig(rawSig, pkBytes []byte,
+	sigHashOpts ...TaprootSigHashOption) error {
+
+	sigHashType := SigHashDefault
+	switch len(rawSig) {
+	case schnorr.SignatureSize:
+	case schnorr.SignatureSize + 1:
+		sigHashType = SigHashType(rawSig[schnorr.SignatureSize])
+		if sigHashType == SigHashDefault {
+			str := "default sighash type must be implicit in a " +
+				"64-byte signature"
+			return scriptError(ErrInvalidSigHashType, str)
+		}
+		rawSig = rawSig[:schnorr.SignatureSize]
+
+	default:
+		str := fmt.Sprintf("invalid taproot signature length %d",
+			len(rawSig))
+		return scriptError(ErrInvalidTaprootSigLen, str)
+	}
+
+	if !isValidTaprootSigHash(sigHashType) {
+		str := fmt.Sprintf("invalid taproot sighash type %#x",
+			sigHashType)
+		return scriptError(ErrInvalidSigHashType, str)
+	}
+	if sigHashType&sigHashMask == SigHashSingle &&
+		vm.txIdx >= len(vm.tx.TxOut) {
+
+		str := fmt.Sprintf("sighash single with input index %d but "+
+			"only %d outputs", vm.txIdx, len(vm.tx.TxOut))
+		return scriptError(ErrInvalidSigHashType, str)
+	}
+
+	if vm.taprootCtx.annex != nil {
+		sigHashOpts = append(sigHashOpts, WithAnnex(vm.taprootCtx.annex))
+	}
+
+	sigHash, err := calcTaprootSignatureHashRaw(
+		vm.hashCache, sigHashType, &vm.tx, vm.txIdx, vm.prevOutFetcher,
+		sigHashOpts...,
+	)
+	if err != nil {
+		return err
+	}
+
+	pubKey, err := schnorr.ParsePubKey(pkBytes)
+	if err != nil {
+		str := fmt.Sprintf("invalid taproot public key: %v", err)
+		return scriptError(ErrTaprootSigInvalid, str)
+	}
+	signature, err := schnorr.ParseSignature(rawSig)
+	if err != nil {
+		str := fmt.Sprintf("invalid taproot signature: %v", err)
+		return scriptError(ErrTaprootSigInvalid, str)
+	}
+
+	// Consult the signature cache before performing the expensive
+	// verification, and add the signature to it once verified.
+	var sigHashKey chainhash.Hash
+	copy(sigHashKey[:], sigHash)
+	if vm.sigCache != nil &&
+		vm.sigCache.ExistsSchnorr(sigHashKey, signature, pubKey) {
+
+		return nil
+	}
+
+	// Defer the verification to the batch when one is set.  This doesn't
+	// change the result of the script since a non-empty signature that
+	// fails to verify always causes the script to fail.  The caller adds
+	// the signatures of the batch to the cache once it is verified.
+	if vm.schnorrBatch != nil {
+		err := vm.schnorrBatch.Add(signature, sigHash, pubKey)
+		if err != nil {
+			str := fmt.Sprintf("invalid taproot signature: %v", err)
+			return scriptError(ErrTaprootSigInvalid, str)
+		}
+		return nil
+	}
+
+	if !signature.Verify(sigHash, pubKey) {
+		return scriptError(ErrTaprootSigInvalid,
+			"taproot signature verification failed")
+	}
+	if vm.sigCache != nil {
+		vm.sigCache.AddSchnorr(sigHashKey, signature, pubKey)
+	}
+
+	return nil
+}
+
 // getStack returns the contents of stack as a byte array bottom up
 func getStack(stack *stack) [][]byte {
 	array := make([][]byte, stack.Depth())
@@ -1113,11 +1470,45 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 	setStack(&vm.astack, data)
 }
 
+// SetTracer sets a tracer that is notified of every opcode the engine steps
+// through, which is useful for debugging why a script fails.  Passing nil
+// removes the tracer.
+func (vm *Engine) SetTracer(tracer ExecutionTracer) {
+	vm.tracer = tracer
+}
+
+// traceStep notifies the tracer of the opcode that was just stepped through
+// along with the resulting state of the stacks.
+func (vm *Engine) traceStep(executed bool, err error) {
+	var buf strings.Builder
+	disasmOpcode(&buf, vm.tokenizer.op, vm.tokenizer.Data(), false)
+
+	vm.tracer.TraceStep(&TraceStep{
+		ScriptIdx: vm.scriptIdx,
+		OpcodeIdx: vm.opcodeIdx,
+		Opcode:    buf.String(),
+		Executed:  executed,
+		Stack:     vm.GetStack(),
+		AltStack:  vm.GetAltStack(),
+		Err:       err,
+	})
+}
+
+// SetSchnorrBatchVerifier sets a batch verifier that BIP0340 signatures are
+// added to instead of being verified during execution.  A successful
+// execution only means the script is valid once the batch is also verified.
+func (vm *Engine) SetSchnorrBatchVerifier(batch *schnorr.BatchVerifier) {
+	vm.schnorrBatch = batch
+}
+
 // NewEngine returns a new script engine for the provided public key script,
 // transaction, and input index.  The flags modify the behavior of the script
-// engine according to the description provided by each flag.
+// engine according to the description provided by each flag.  The previous
+// output fetcher must be able to return the outputs spent by all inputs of
+// the transaction when it spends taproot outputs, and may be nil otherwise.
 func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags,
-	sigCache *SigCache, hashCache *TxSigHashes, inputAmount int64) (*Engine, error) {
+	sigCache *SigCache, hashCache *TxSigHashes, inputAmount int64,
+	prevOutFetcher PrevOutputFetcher) (*Engine, error) {
 	const scriptVersion = 0
 
 	// The provided transaction input index must refer to a valid input.
@@ -1148,7 +1539,7 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	// when it should be. The same goes for segwit which will pull in
 	// additional scripts for execution from the witness stack.
 	vm := Engine{flags: flags, sigCache: sigCache, hashCache: hashCache,
-		inputAmount: inputAmount}
+		inputAmount: inputAmount, prevOutFetcher: prevOutFetcher}
 	if vm.hasFlag(ScriptVerifyCleanStack) && (!vm.hasFlag(ScriptBip16) &&
 		!vm.hasFlag(ScriptVerifyWitness)) {
 		return nil, scriptError(ErrInvalidFlags,
@@ -6,6 +6,7 @@
 package txscript
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
@@ -55,7 +56,7 @@ func TestBadPC(t *testing.T) {
 	pkScript := mustParseShortForm("NOP")
 
 	for _, test := range tests {
-		vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, -1)
+		vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, -1, nil)
 		if err != nil {
 			t.Errorf("Failed to create script: %v", err)
 		}
@@ -112,7 +113,7 @@ func TestCheckErrorCondition(t *testing.T) {
 	pkScript := mustParseShortForm("NOP NOP NOP NOP NOP NOP NOP NOP NOP" +
 		" NOP TRUE")
 
-	vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, 0)
+	vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, 0, nil)
 	if err != nil {
 		t.Errorf("failed to create script: %v", err)
 	}
@@ -188,7 +189,7 @@ func TestInvalidFlagCombinations(t *testing.T) {
 	pkScript := []byte{OP_NOP}
 
 	for i, test := range tests {
-		_, err := NewEngine(pkScript, tx, 0, test, nil, nil, -1)
+		_, err := NewEngine(pkScript, tx, 0, test, nil, nil, -1, nil)
 		if !IsErrorCode(err, ErrInvalidFlags) {
 			t.Fatalf("TestInvalidFlagCombinations #%d unexpected "+
 				"error: %v", i, err)
@@ -426,3 +427,173 @@ func TestCheckSignatureEncoding(t *testing.T) {
 		}
 	}
 }
+
+// equalStacks returns whether the passed stacks contain the same items.
+func equalStacks(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestEngineTracer ensures the tracer set on the engine is notified of every
+// opcode along with the resulting stacks, including skipped opcodes and the
+// opcode that fails.
+func TestEngineTracer(t *testing.T) {
+	t.Parallel()
+
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{Index: 0},
+			SignatureScript:  mustParseShortForm("1 2"),
+			Sequence:         4294967295,
+		}},
+		TxOut: []*wire.TxOut{{Value: 1000000000}},
+	}
+
+	type wantStep struct {
+		scriptIdx int
+		opcodeIdx int
+		opcode    string
+		executed  bool
+		stack     [][]byte
+		altStack  [][]byte
+		failed    bool
+	}
+	tests := []struct {
+		name     string
+		pkScript string
+		valid    bool
+		steps    []wantStep
+	}{{
+		name:     "valid with skipped branch",
+		pkScript: "TOALTSTACK 0 IF 3 ENDIF FROMALTSTACK ADD 3 EQUAL",
+		valid:    true,
+		steps: []wantStep{
+			{0, 0, "OP_1", true, [][]byte{{1}}, nil, false},
+			{0, 1, "OP_2", true, [][]byte{{1}, {2}}, nil, false},
+			{1, 0, "OP_TOALTSTACK", true, [][]byte{{1}}, [][]byte{{2}}, false},
+			{1, 1, "OP_0", true, [][]byte{{1}, nil}, [][]byte{{2}}, false},
+			{1, 2, "OP_IF", true, [][]byte{{1}}, [][]byte{{2}}, false},
+			{1, 3, "OP_3", false, [][]byte{{1}}, [][]byte{{2}}, false},
+			{1, 4, "OP_ENDIF", true, [][]byte{{1}}, [][]byte{{2}}, false},
+			{1, 5, "OP_FROMALTSTACK", true, [][]byte{{1}, {2}}, nil, false},
+			{1, 6, "OP_ADD", true, [][]byte{{3}}, nil, false},
+			{1, 7, "OP_3", true, [][]byte{{3}, {3}}, nil, false},
+			{1, 8, "OP_EQUAL", true, [][]byte{{1}}, nil, false},
+		},
+	}, {
+		name:     "failed opcode",
+		pkScript: "ADD 4 EQUALVERIFY",
+		valid:    false,
+		steps: []wantStep{
+			{0, 0, "OP_1", true, [][]byte{{1}}, nil, false},
+			{0, 1, "OP_2", true, [][]byte{{1}, {2}}, nil, false},
+			{1, 0, "OP_ADD", true, [][]byte{{3}}, nil, false},
+			{1, 1, "OP_4", true, [][]byte{{3}, {4}}, nil, false},
+			{1, 2, "OP_EQUALVERIFY", true, nil, nil, true},
+		},
+	}}
+
+	for _, test := range tests {
+		pkScript := mustParseShortForm(test.pkScript)
+		vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, -1, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to create engine: %v", test.name, err)
+		}
+		var recorder TraceRecorder
+		vm.SetTracer(&recorder)
+
+		err = vm.Execute()
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: unexpected execution result: %v", test.name,
+				err)
+		}
+
+		if len(recorder.Steps) != len(test.steps) {
+			t.Fatalf("%s: unexpected number of steps: got %d, want %d",
+				test.name, len(recorder.Steps), len(test.steps))
+		}
+		for i, want := range test.steps {
+			got := recorder.Steps[i]
+			if got.ScriptIdx != want.scriptIdx ||
+				got.OpcodeIdx != want.opcodeIdx ||
+				got.Opcode != want.opcode ||
+				got.Executed != want.executed ||
+				(got.Err != nil) != want.failed {
+
+				t.Fatalf("%s: step #%d mismatch: got %d:%d %s "+
+					"executed %v err %v", test.name, i,
+					got.ScriptIdx, got.OpcodeIdx, got.Opcode,
+					got.Executed, got.Err)
+			}
+			if want.failed {
+				continue
+			}
+			if !equalStacks(got.Stack, want.stack) ||
+				!equalStacks(got.AltStack, want.altStack) {
+
+				t.Fatalf("%s: step #%d stack mismatch: got %x / "+
+					"%x, want %x / %x", test.name, i, got.Stack,
+					got.AltStack, want.stack, want.altStack)
+			}
+		}
+	}
+}
+
+// TestEngineTracerStackOverflow ensures the step which overflows the stack is
+// reported to the tracer and that Step still reports it as not done.
+func TestEngineTracerStackOverflow(t *testing.T) {
+	t.Parallel()
+
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{Index: 0},
+			SignatureScript:  mustParseShortForm("1 2"),
+			Sequence:         4294967295,
+		}},
+		TxOut: []*wire.TxOut{{Value: 1000000000}},
+	}
+
+	// The signature script pushes two elements, so the last push of the
+	// public key script exceeds the maximum stack size.
+	pkScript := bytes.Repeat([]byte{OP_1}, MaxStackSize-1)
+	vm, err := NewEngine(pkScript, tx, 0, 0, nil, nil, -1, nil)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	var recorder TraceRecorder
+	vm.SetTracer(&recorder)
+
+	var done bool
+	for err == nil {
+		done, err = vm.Step()
+	}
+	if !IsErrorCode(err, ErrStackOverflow) {
+		t.Fatalf("unexpected error: got %v, want %v", err,
+			ErrStackOverflow)
+	}
+	if done {
+		t.Fatalf("Step reported done on stack overflow")
+	}
+
+	numSteps := len(recorder.Steps)
+	if numSteps != MaxStackSize+1 {
+		t.Fatalf("unexpected number of steps: got %d, want %d",
+			numSteps, MaxStackSize+1)
+	}
+	last := recorder.Steps[numSteps-1]
+	if last.ScriptIdx != 1 || last.OpcodeIdx != MaxStackSize-2 ||
+		!IsErrorCode(last.Err, ErrStackOverflow) {
+
+		t.Fatalf("unexpected last step: got %d:%d err %v",
+			last.ScriptIdx, last.OpcodeIdx, last.Err)
+	}
+}
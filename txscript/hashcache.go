@@ -5,30 +5,199 @@
 package txscript
 
 import (
+	"bytes"
+	"encoding/binary"
 	"sync"
 
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/wire"
 )
 
-// TxSigHashes houses the partial set of sighashes introduced within BIP0143.
-// This partial set of sighashes may be re-used within each input across a
-// transaction when validating all inputs. As a result, validation complexity
-// for SigHashAll can be reduced by a polynomial factor.
+// PrevOutputFetcher is an interface used to supply the sighash cache and the
+// script engine with the previous output information needed to calculate the
+// BIP0341 sighash, which commits to the amounts and scripts of all of the
+// outputs spent by a transaction.
+type PrevOutputFetcher interface {
+	// FetchPrevOutput attempts to fetch the previous output referenced by
+	// the passed outpoint.  A nil value will be returned if the passed
+	// outpoint doesn't exist.
+	FetchPrevOutput(wire.OutPoint) *wire.TxOut
+}
+
+// CannedPrevOutputFetcher is an implementation of PrevOutputFetcher that only
+// is able to return information for a single previous output.  It is intended
+// for callers that only deal with transactions that have a single input.
+type CannedPrevOutputFetcher struct {
+	pkScript []byte
+	amt      int64
+}
+
+// NewCannedPrevOutputFetcher returns an instance of a CannedPrevOutputFetcher
+// that can only return the TxOut defined by the passed script and amount.
+func NewCannedPrevOutputFetcher(script []byte, amt int64) *CannedPrevOutputFetcher {
+	return &CannedPrevOutputFetcher{
+		pkScript: script,
+		amt:      amt,
+	}
+}
+
+// FetchPrevOutput attempts to fetch the previous output referenced by the
+// passed outpoint.
+//
+// NOTE: This is a part of the PrevOutputFetcher interface.
+func (c *CannedPrevOutputFetcher) FetchPrevOutput(wire.OutPoint) *wire.TxOut {
+	return &wire.TxOut{
+		PkScript: c.pkScript,
+		Value:    c.amt,
+	}
+}
+
+// A compile-time assertion to ensure that CannedPrevOutputFetcher matches the
+// PrevOutputFetcher interface.
+var _ PrevOutputFetcher = (*CannedPrevOutputFetcher)(nil)
+
+// MultiPrevOutFetcher is an implementation of PrevOutputFetcher backed by a
+// map of outpoints to the outputs they reference.
+type MultiPrevOutFetcher struct {
+	prevOuts map[wire.OutPoint]*wire.TxOut
+}
+
+// NewMultiPrevOutFetcher returns an instance of a PrevOutputFetcher that's
+// backed by an optional map which is used as an input source.  The map can be
+// nil, in which case outputs are added with AddPrevOut.
+func NewMultiPrevOutFetcher(prevOuts map[wire.OutPoint]*wire.TxOut) *MultiPrevOutFetcher {
+	if prevOuts == nil {
+		prevOuts = make(map[wire.OutPoint]*wire.TxOut)
+	}
+
+	return &MultiPrevOutFetcher{
+		prevOuts: prevOuts,
+	}
+}
+
+// FetchPrevOutput attempts to fetch the previous output referenced by the
+// passed outpoint.
+//
+// NOTE: This is a part of the PrevOutputFetcher interface.
+func (m *MultiPrevOutFetcher) FetchPrevOutput(op wire.OutPoint) *wire.TxOut {
+	return m.prevOuts[op]
+}
+
+// AddPrevOut adds a new prev out, tx out pair to the backing map.
+func (m *MultiPrevOutFetcher) AddPrevOut(op wire.OutPoint, txOut *wire.TxOut) {
+	m.prevOuts[op] = txOut
+}
+
+// A compile-time assertion to ensure that MultiPrevOutFetcher matches the
+// PrevOutputFetcher interface.
+var _ PrevOutputFetcher = (*MultiPrevOutFetcher)(nil)
+
+// TxSigHashes houses the partial set of sighashes introduced within BIP0143
+// and BIP0341.  This partial set of sighashes may be re-used within each input
+// across a transaction when validating all inputs.  As a result, validation
+// complexity for SigHashAll can be reduced by a polynomial factor.
+//
+// The V1 midstate is only calculated when the transaction spends at least one
+// taproot output and the previous outputs were available when the sighashes
+// were created.
 type TxSigHashes struct {
 	HashPrevOuts chainhash.Hash
 	HashSequence chainhash.Hash
 	HashOutputs  chainhash.Hash
+
+	HashPrevOutsV1     chainhash.Hash
+	HashSequenceV1     chainhash.Hash
+	HashOutputsV1      chainhash.Hash
+	HashInputAmountsV1 chainhash.Hash
+	HashInputScriptsV1 chainhash.Hash
+
+	// hasV1 indicates whether the V1 midstate above was calculated.
+	hasV1 bool
 }
 
 // NewTxSigHashes computes, and returns the cached sighashes of the given
-// transaction.
-func NewTxSigHashes(tx *wire.MsgTx) *TxSigHashes {
-	return &TxSigHashes{
-		HashPrevOuts: calcHashPrevOuts(tx),
-		HashSequence: calcHashSequence(tx),
-		HashOutputs:  calcHashOutputs(tx),
+// transaction.  The previous output fetcher is used to detect whether any
+// inputs spend taproot outputs, in which case the BIP0341 midstate, which
+// commits to all of the spent amounts and scripts, is calculated as well.  It
+// may be nil when the transaction is known not to spend taproot outputs.
+func NewTxSigHashes(tx *wire.MsgTx, prevOutFetcher PrevOutputFetcher) *TxSigHashes {
+	// The BIP0341 midstate hashes are single sha256 hashes of the same data
+	// that BIP0143 hashes twice, so calculate them first and derive the
+	// version 0 hashes from them.
+	hashPrevOutsV1 := calcHashPrevOuts(tx)
+	hashSequenceV1 := calcHashSequence(tx)
+	hashOutputsV1 := calcHashOutputs(tx)
+
+	sigHashes := &TxSigHashes{
+		HashPrevOuts: chainhash.HashH(hashPrevOutsV1[:]),
+		HashSequence: chainhash.HashH(hashSequenceV1[:]),
+		HashOutputs:  chainhash.HashH(hashOutputsV1[:]),
+	}
+	if !spendsTaproot(tx, prevOutFetcher) {
+		return sigHashes
+	}
+
+	sigHashes.HashPrevOutsV1 = hashPrevOutsV1
+	sigHashes.HashSequenceV1 = hashSequenceV1
+	sigHashes.HashOutputsV1 = hashOutputsV1
+	sigHashes.HashInputAmountsV1 = calcHashInputAmounts(tx, prevOutFetcher)
+	sigHashes.HashInputScriptsV1 = calcHashInputScripts(tx, prevOutFetcher)
+	sigHashes.hasV1 = true
+
+	return sigHashes
+}
+
+// spendsTaproot returns whether any of the inputs of the passed transaction
+// spend a taproot output according to the passed previous output fetcher.
+func spendsTaproot(tx *wire.MsgTx, prevOutFetcher PrevOutputFetcher) bool {
+	if prevOutFetcher == nil {
+		return false
+	}
+
+	for _, txIn := range tx.TxIn {
+		prevOut := prevOutFetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut != nil && IsPayToTaproot(prevOut.PkScript) {
+			return true
+		}
 	}
+
+	return false
+}
+
+// calcHashInputAmounts computes a hash digest of the amounts of all of the
+// outputs spent by the passed transaction as required by BIP0341.
+func calcHashInputAmounts(tx *wire.MsgTx, prevOutFetcher PrevOutputFetcher) chainhash.Hash {
+	var b bytes.Buffer
+	for _, txIn := range tx.TxIn {
+		var amt int64
+		prevOut := prevOutFetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut != nil {
+			amt = prevOut.Value
+		}
+
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(amt))
+		b.Write(buf[:])
+	}
+
+	return chainhash.HashH(b.Bytes())
+}
+
+// calcHashInputScripts computes a hash digest of the public key scripts of
+// all of the outputs spent by the passed transaction as required by BIP0341.
+func calcHashInputScripts(tx *wire.MsgTx, prevOutFetcher PrevOutputFetcher) chainhash.Hash {
+	var b bytes.Buffer
+	for _, txIn := range tx.TxIn {
+		var pkScript []byte
+		prevOut := prevOutFetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut != nil {
+			pkScript = prevOut.PkScript
+		}
+
+		wire.WriteVarBytes(&b, 0, pkScript)
+	}
+
+	return chainhash.HashH(b.Bytes())
 }
 
 // HashCache houses a set of partial sighashes keyed by txid. The set of partial
@@ -51,10 +220,11 @@ func NewHashCache(maxSize uint) *HashCache {
 }
 
 // AddSigHashes computes, then adds the partial sighashes for the passed
-// transaction.
-func (h *HashCache) AddSigHashes(tx *wire.MsgTx) {
+// transaction.  See NewTxSigHashes for the purpose of the previous output
+// fetcher.
+func (h *HashCache) AddSigHashes(tx *wire.MsgTx, prevOutFetcher PrevOutputFetcher) {
 	h.Lock()
-	h.sigHashes[tx.TxHash()] = NewTxSigHashes(tx)
+	h.sigHashes[tx.TxHash()] = NewTxSigHashes(tx, prevOutFetcher)
 	h.Unlock()
 }
 
@@ -0,0 +1,39 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package miniscript implements Miniscript for witness v0 scripts.
+
+Miniscript is a language for writing a structured subset of Bitcoin scripts
+that can be analyzed, composed and satisfied generically.  A miniscript
+describes the conditions under which an output can be spent, such as
+and_v(v:pk(A),or_d(pk(B),older(144))), and compiles to the script enforcing
+them.
+
+Parsing and Type Checking
+
+Parse parses a miniscript expression, in which keys are hex-encoded compressed
+public keys, and type checks it.  Every expression has a Type made up of one
+of the B, V, K and W basic types along with properties describing how it is
+satisfied, and each fragment only accepts subexpressions of certain types.
+The top-level expression must be of the B type.
+
+A valid miniscript can still be unsafe to use.  Sane reports whether a
+miniscript stays within the consensus and standardness resource limits, can
+only be satisfied in ways that can't be malleated by third parties, always
+requires a signature, doesn't mix height and time timelocks and doesn't repeat
+keys.  MaxSatisfactionSize, MaxSatisfactionElements and MaxOps return the
+worst-case cost of spending the output, which can be used for fee estimation.
+
+Compiling and Satisfying
+
+Script returns the witness script of a miniscript, which is built with a
+txscript.ScriptBuilder.  Satisfy returns the witness stack items spending it
+using the signatures, preimages and timelocks provided by a Satisfier.  It
+picks the smallest satisfaction that third parties can't change into another
+valid one, while SatisfyMalleable also accepts malleable satisfactions.  The
+witness script has to be appended to the returned items to spend a
+pay-to-witness-script-hash output.
+*/
+package miniscript
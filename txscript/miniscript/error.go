@@ -0,0 +1,30 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import "errors"
+
+var (
+	// ErrMalformed describes an error where a miniscript expression isn't
+	// well-formed, such as an unknown fragment, a wrong number of
+	// arguments or an invalid key, hash or number argument.
+	ErrMalformed = errors.New("malformed miniscript")
+
+	// ErrInvalidType describes an error where a fragment is applied to
+	// subexpressions whose types it doesn't accept, or where the top-level
+	// expression isn't of the B type.
+	ErrInvalidType = errors.New("invalid miniscript type")
+
+	// ErrNotSane describes an error where a miniscript is valid but isn't
+	// safe to use, because it exceeds a resource limit, can be malleated,
+	// mixes timelock types, repeats a key or can be spent without a
+	// signature.
+	ErrNotSane = errors.New("miniscript is not sane")
+
+	// ErrUnsatisfiable describes an error where a witness can't be
+	// produced for a miniscript from the available signatures, preimages
+	// and timelocks.
+	ErrUnsatisfiable = errors.New("unable to satisfy miniscript")
+)
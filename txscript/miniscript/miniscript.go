@@ -0,0 +1,909 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// maxStandardP2WSHScriptSize is the largest witness script that is
+	// relayed by default.
+	maxStandardP2WSHScriptSize = 3600
+
+	// maxStandardP2WSHStackItems is the largest number of witness stack
+	// items, not including the witness script, that is relayed by
+	// default.
+	maxStandardP2WSHStackItems = 100
+
+	// maxTimelock is the largest value of the older and after fragments.
+	// Values with the highest bit set disable relative timelocks and
+	// aren't valid script numbers for absolute ones.
+	maxTimelock = wire.SequenceLockTimeDisabled - 1
+
+	// sigSize and pubKeySize are the largest serialized size of a witness
+	// stack item holding a signature with its sighash type and the size of
+	// one holding a compressed public key, including their length
+	// prefixes.
+	sigSize    = 1 + 72
+	pubKeySize = 1 + 33
+
+	// preimageSize is the size of the preimages of the hash fragments.
+	preimageSize = 32
+)
+
+// fragment identifies the kind of a miniscript expression.
+type fragment uint8
+
+const (
+	fragZero fragment = iota
+	fragOne
+	fragPkK
+	fragPkH
+	fragOlder
+	fragAfter
+	fragSha256
+	fragHash256
+	fragRipemd160
+	fragHash160
+	fragAndOr
+	fragAndV
+	fragAndB
+	fragOrB
+	fragOrC
+	fragOrD
+	fragOrI
+	fragThresh
+	fragMulti
+	fragWrapA
+	fragWrapS
+	fragWrapC
+	fragWrapD
+	fragWrapV
+	fragWrapJ
+	fragWrapN
+)
+
+// fragmentNames maps the fragments that are written as a name followed by
+// their arguments to their names.
+var fragmentNames = map[fragment]string{
+	fragPkK:       "pk_k",
+	fragPkH:       "pk_h",
+	fragOlder:     "older",
+	fragAfter:     "after",
+	fragSha256:    "sha256",
+	fragHash256:   "hash256",
+	fragRipemd160: "ripemd160",
+	fragHash160:   "hash160",
+	fragAndOr:     "andor",
+	fragAndV:      "and_v",
+	fragAndB:      "and_b",
+	fragOrB:       "or_b",
+	fragOrC:       "or_c",
+	fragOrD:       "or_d",
+	fragOrI:       "or_i",
+	fragThresh:    "thresh",
+	fragMulti:     "multi",
+}
+
+// wrapperFragments maps the wrapper letters to the fragments they stand for.
+var wrapperFragments = map[byte]fragment{
+	'a': fragWrapA,
+	's': fragWrapS,
+	'c': fragWrapC,
+	'd': fragWrapD,
+	'v': fragWrapV,
+	'j': fragWrapJ,
+	'n': fragWrapN,
+}
+
+// hashSizes maps the hash fragments to the size of their hash argument.
+var hashSizes = map[fragment]int{
+	fragSha256:    32,
+	fragHash256:   32,
+	fragRipemd160: 20,
+	fragHash160:   20,
+}
+
+// maxInt is a size or count that is only valid when the spending path it
+// describes exists.
+type maxInt struct {
+	valid bool
+	value int
+}
+
+// validInt returns a valid maxInt with the passed value.
+func validInt(value int) maxInt {
+	return maxInt{valid: true, value: value}
+}
+
+// add returns the sum of both values, which is only valid when both are.
+func (a maxInt) add(b maxInt) maxInt {
+	if !a.valid || !b.valid {
+		return maxInt{}
+	}
+	return validInt(a.value + b.value)
+}
+
+// or returns the largest of the valid values.
+func (a maxInt) or(b maxInt) maxInt {
+	switch {
+	case !a.valid:
+		return b
+	case !b.valid:
+		return a
+	case a.value >= b.value:
+		return a
+	default:
+		return b
+	}
+}
+
+// satSizes is a pair of maximum sizes or counts for the satisfactions and
+// the dissatisfactions of an expression.
+type satSizes struct {
+	sat  maxInt
+	dsat maxInt
+}
+
+// node is an expression of a miniscript along with its analysis.
+type node struct {
+	frag fragment
+	subs []*node
+
+	// k is the threshold of the thresh and multi fragments, and the value
+	// of the older and after fragments.
+	k uint32
+
+	// keys are the serialized compressed public keys of the key fragments,
+	// and data is the hash of the hash fragments.
+	keys [][]byte
+	data []byte
+
+	typ Type
+
+	// opCount is the number of non-push opcodes of the script and ops is
+	// the number of public keys checked by executed CHECKMULTISIG
+	// opcodes, which count towards the opcode limit too.
+	opCount int
+	ops     satSizes
+
+	// stack is the number of witness stack items and witness the
+	// serialized size of the witness stack.
+	stack   satSizes
+	witness satSizes
+}
+
+// newNode returns a node for the passed fragment with its type and sizes
+// computed, or an error when the subexpressions don't have the types the
+// fragment requires.
+func newNode(frag fragment, k uint32, keys [][]byte, data []byte,
+	subs ...*node) (*node, error) {
+
+	n := &node{
+		frag: frag,
+		subs: subs,
+		k:    k,
+		keys: keys,
+		data: data,
+	}
+	n.typ = computeType(n)
+	if n.typ == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidType, n)
+	}
+	n.computeSizes()
+	return n, nil
+}
+
+// computeSizes computes the opcode counts and the witness sizes of the node
+// from those of its subexpressions.
+func (n *node) computeSizes() {
+	var x, y, z *node
+	switch len(n.subs) {
+	case 3:
+		z = n.subs[2]
+		fallthrough
+	case 2:
+		y = n.subs[1]
+		fallthrough
+	case 1:
+		x = n.subs[0]
+	}
+
+	zero, one, none := validInt(0), validInt(1), maxInt{}
+	switch n.frag {
+	case fragZero:
+		n.ops = satSizes{none, zero}
+		n.stack = satSizes{none, zero}
+		n.witness = satSizes{none, zero}
+
+	case fragOne:
+		n.ops = satSizes{zero, none}
+		n.stack = satSizes{zero, none}
+		n.witness = satSizes{zero, none}
+
+	case fragPkK:
+		n.ops = satSizes{zero, zero}
+		n.stack = satSizes{one, one}
+		n.witness = satSizes{validInt(sigSize), one}
+
+	case fragPkH:
+		n.opCount = 3
+		n.ops = satSizes{zero, zero}
+		n.stack = satSizes{validInt(2), validInt(2)}
+		n.witness = satSizes{
+			validInt(sigSize + pubKeySize),
+			validInt(1 + pubKeySize),
+		}
+
+	case fragOlder, fragAfter:
+		n.opCount = 1
+		n.ops = satSizes{zero, none}
+		n.stack = satSizes{zero, none}
+		n.witness = satSizes{zero, none}
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		n.opCount = 4
+		n.ops = satSizes{zero, zero}
+		n.stack = satSizes{one, one}
+		n.witness = satSizes{
+			validInt(1 + preimageSize),
+			validInt(1 + preimageSize),
+		}
+
+	case fragAndOr:
+		n.opCount = 3 + x.opCount + y.opCount + z.opCount
+		combine := func(x, y, z satSizes) satSizes {
+			return satSizes{
+				x.sat.add(y.sat).or(x.dsat.add(z.sat)),
+				x.dsat.add(z.dsat),
+			}
+		}
+		n.ops = combine(x.ops, y.ops, z.ops)
+		n.stack = combine(x.stack, y.stack, z.stack)
+		n.witness = combine(x.witness, y.witness, z.witness)
+
+	case fragAndV:
+		n.opCount = x.opCount + y.opCount
+		combine := func(x, y satSizes) satSizes {
+			return satSizes{x.sat.add(y.sat), none}
+		}
+		n.ops = combine(x.ops, y.ops)
+		n.stack = combine(x.stack, y.stack)
+		n.witness = combine(x.witness, y.witness)
+
+	case fragAndB:
+		n.opCount = 1 + x.opCount + y.opCount
+		combine := func(x, y satSizes) satSizes {
+			return satSizes{x.sat.add(y.sat), x.dsat.add(y.dsat)}
+		}
+		n.ops = combine(x.ops, y.ops)
+		n.stack = combine(x.stack, y.stack)
+		n.witness = combine(x.witness, y.witness)
+
+	case fragOrB:
+		n.opCount = 1 + x.opCount + y.opCount
+		combine := func(x, z satSizes) satSizes {
+			return satSizes{
+				x.dsat.add(z.sat).or(x.sat.add(z.dsat)),
+				x.dsat.add(z.dsat),
+			}
+		}
+		n.ops = combine(x.ops, y.ops)
+		n.stack = combine(x.stack, y.stack)
+		n.witness = combine(x.witness, y.witness)
+
+	case fragOrC:
+		n.opCount = 2 + x.opCount + y.opCount
+		combine := func(x, z satSizes) satSizes {
+			return satSizes{x.sat.or(x.dsat.add(z.sat)), none}
+		}
+		n.ops = combine(x.ops, y.ops)
+		n.stack = combine(x.stack, y.stack)
+		n.witness = combine(x.witness, y.witness)
+
+	case fragOrD:
+		n.opCount = 3 + x.opCount + y.opCount
+		combine := func(x, z satSizes) satSizes {
+			return satSizes{
+				x.sat.or(x.dsat.add(z.sat)),
+				x.dsat.add(z.dsat),
+			}
+		}
+		n.ops = combine(x.ops, y.ops)
+		n.stack = combine(x.stack, y.stack)
+		n.witness = combine(x.witness, y.witness)
+
+	case fragOrI:
+		// The branch is selected by a 1 or an empty witness stack item,
+		// which take up two and one bytes respectively.
+		n.opCount = 3 + x.opCount + y.opCount
+		n.ops = satSizes{
+			x.ops.sat.or(y.ops.sat),
+			x.ops.dsat.or(y.ops.dsat),
+		}
+		n.stack = satSizes{
+			x.stack.sat.add(one).or(y.stack.sat.add(one)),
+			x.stack.dsat.add(one).or(y.stack.dsat.add(one)),
+		}
+		n.witness = satSizes{
+			x.witness.sat.add(validInt(2)).or(y.witness.sat.add(one)),
+			x.witness.dsat.add(validInt(2)).or(y.witness.dsat.add(one)),
+		}
+
+	case fragThresh:
+		// Find the largest sizes of satisfying exactly k of the
+		// subexpressions and of dissatisfying all of them.
+		for _, sub := range n.subs {
+			n.opCount += sub.opCount + 1
+		}
+		combine := func(sizes func(*node) satSizes) satSizes {
+			sats := []maxInt{zero}
+			for _, sub := range n.subs {
+				s := sizes(sub)
+				next := []maxInt{sats[0].add(s.dsat)}
+				for j := 1; j < len(sats); j++ {
+					next = append(next, sats[j].add(s.dsat).or(
+						sats[j-1].add(s.sat),
+					))
+				}
+				next = append(next, sats[len(sats)-1].add(s.sat))
+				sats = next
+			}
+			return satSizes{sats[n.k], sats[0]}
+		}
+		n.ops = combine(func(sub *node) satSizes { return sub.ops })
+		n.stack = combine(func(sub *node) satSizes { return sub.stack })
+		n.witness = combine(func(sub *node) satSizes {
+			return sub.witness
+		})
+
+	case fragMulti:
+		// The extra empty item is consumed by the off-by-one bug of
+		// CHECKMULTISIG.
+		n.opCount = 1
+		n.ops = satSizes{validInt(len(n.keys)), validInt(len(n.keys))}
+		n.stack = satSizes{validInt(int(n.k) + 1), validInt(int(n.k) + 1)}
+		n.witness = satSizes{
+			validInt(int(n.k)*sigSize + 1),
+			validInt(int(n.k) + 1),
+		}
+
+	case fragWrapA:
+		n.opCount = 2 + x.opCount
+		n.ops, n.stack, n.witness = x.ops, x.stack, x.witness
+
+	case fragWrapS, fragWrapC, fragWrapN:
+		n.opCount = 1 + x.opCount
+		n.ops, n.stack, n.witness = x.ops, x.stack, x.witness
+
+	case fragWrapD:
+		n.opCount = 3 + x.opCount
+		n.ops = satSizes{x.ops.sat, zero}
+		n.stack = satSizes{x.stack.sat.add(one), one}
+		n.witness = satSizes{x.witness.sat.add(validInt(2)), one}
+
+	case fragWrapV:
+		n.opCount = x.opCount
+		if x.typ.Has(TypeX) {
+			n.opCount++
+		}
+		n.ops = satSizes{x.ops.sat, none}
+		n.stack = satSizes{x.stack.sat, none}
+		n.witness = satSizes{x.witness.sat, none}
+
+	case fragWrapJ:
+		n.opCount = 4 + x.opCount
+		n.ops = satSizes{x.ops.sat, zero}
+		n.stack = satSizes{x.stack.sat, one}
+		n.witness = satSizes{x.witness.sat, one}
+	}
+}
+
+// Miniscript is a parsed and type checked miniscript expression for a witness
+// v0 script.
+type Miniscript struct {
+	root *node
+}
+
+// Parse parses and type checks the passed miniscript expression.  Keys are
+// given as hex-encoded compressed public keys.  The top-level expression must
+// be of the B type.
+//
+// A miniscript that parses is valid, but it isn't necessarily safe to use.
+// See Sane for the additional requirements.
+func Parse(s string) (*Miniscript, error) {
+	root, err := parseExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	if !root.typ.Has(TypeB) {
+		return nil, fmt.Errorf("%w: top-level expression is of type "+
+			"%s, not B", ErrInvalidType, root.typ)
+	}
+
+	return &Miniscript{root: root}, nil
+}
+
+// parseExpr parses the passed miniscript expression along with its wrappers.
+func parseExpr(s string) (*node, error) {
+	// The wrappers are written as letters separated from the expression
+	// they apply to by a colon.
+	colon := strings.IndexByte(s, ':')
+	paren := strings.IndexByte(s, '(')
+	if colon < 0 || (paren >= 0 && paren < colon) {
+		return parseFragment(s)
+	}
+	wrappers := s[:colon]
+	if wrappers == "" {
+		return nil, fmt.Errorf("%w: missing wrappers before ':'",
+			ErrMalformed)
+	}
+	n, err := parseExpr(s[colon+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The wrappers apply from right to left.
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		n, err = wrap(wrappers[i], n)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// wrap applies the passed wrapper to the passed expression.
+func wrap(wrapper byte, n *node) (*node, error) {
+	// The t:, l: and u: wrappers are shorthands for fragments that take
+	// the expression along with a constant.
+	switch wrapper {
+	case 't':
+		one, _ := newNode(fragOne, 0, nil, nil)
+		return newNode(fragAndV, 0, nil, nil, n, one)
+	case 'l':
+		zero, _ := newNode(fragZero, 0, nil, nil)
+		return newNode(fragOrI, 0, nil, nil, zero, n)
+	case 'u':
+		zero, _ := newNode(fragZero, 0, nil, nil)
+		return newNode(fragOrI, 0, nil, nil, n, zero)
+	}
+
+	frag, ok := wrapperFragments[wrapper]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown wrapper %q", ErrMalformed,
+			wrapper)
+	}
+	return newNode(frag, 0, nil, nil, n)
+}
+
+// parseFragment parses the passed miniscript expression without wrappers.
+func parseFragment(s string) (*node, error) {
+	switch s {
+	case "0":
+		return newNode(fragZero, 0, nil, nil)
+	case "1":
+		return newNode(fragOne, 0, nil, nil)
+	}
+
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("%w: invalid expression %q", ErrMalformed,
+			s)
+	}
+	name := s[:open]
+	args, err := splitArgs(s[open+1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "pk", "pkh", "pk_k", "pk_h":
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		key, err := parseKey(args[0])
+		if err != nil {
+			return nil, err
+		}
+		frag := fragPkK
+		if name == "pkh" || name == "pk_h" {
+			frag = fragPkH
+		}
+		n, err := newNode(frag, 0, [][]byte{key}, nil)
+		if err != nil || name == "pk_k" || name == "pk_h" {
+			return n, err
+		}
+
+		// The pk and pkh fragments are shorthands for the c:
+		// wrapper applied to pk_k and pk_h.
+		return newNode(fragWrapC, 0, nil, nil, n)
+
+	case "older", "after":
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		k, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || k < 1 || k > maxTimelock {
+			return nil, fmt.Errorf("%w: invalid %s value %q",
+				ErrMalformed, name, args[0])
+		}
+		frag := fragOlder
+		if name == "after" {
+			frag = fragAfter
+		}
+		return newNode(frag, uint32(k), nil, nil)
+
+	case "sha256", "hash256", "ripemd160", "hash160":
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		frag := fragmentByName(name)
+		hash, err := hex.DecodeString(args[0])
+		if err != nil || len(hash) != hashSizes[frag] {
+			return nil, fmt.Errorf("%w: invalid %s hash %q",
+				ErrMalformed, name, args[0])
+		}
+		return newNode(frag, 0, nil, hash)
+
+	case "andor", "and_n", "and_v", "and_b", "or_b", "or_c", "or_d", "or_i":
+		numArgs := 2
+		if name == "andor" {
+			numArgs = 3
+		}
+		if err := checkArgs(name, args, numArgs); err != nil {
+			return nil, err
+		}
+		subs := make([]*node, 0, 3)
+		for _, arg := range args {
+			sub, err := parseExpr(arg)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+
+		// The and_n fragment is a shorthand for andor with a 0 as
+		// the last subexpression.
+		if name == "and_n" {
+			zero, _ := newNode(fragZero, 0, nil, nil)
+			return newNode(fragAndOr, 0, nil, nil, subs[0], subs[1],
+				zero)
+		}
+		return newNode(fragmentByName(name), 0, nil, nil, subs...)
+
+	case "thresh", "multi":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: %s needs a threshold and at "+
+				"least one argument", ErrMalformed, name)
+		}
+		k, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || k < 1 || k > uint64(len(args)-1) {
+			return nil, fmt.Errorf("%w: invalid %s threshold %q",
+				ErrMalformed, name, args[0])
+		}
+
+		if name == "multi" {
+			if len(args)-1 > txscript.MaxPubKeysPerMultiSig {
+				return nil, fmt.Errorf("%w: multi has more than %d "+
+					"keys", ErrMalformed,
+					txscript.MaxPubKeysPerMultiSig)
+			}
+			keys := make([][]byte, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				key, err := parseKey(arg)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+			return newNode(fragMulti, uint32(k), keys, nil)
+		}
+
+		subs := make([]*node, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			sub, err := parseExpr(arg)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+		return newNode(fragThresh, uint32(k), nil, nil, subs...)
+	}
+
+	return nil, fmt.Errorf("%w: unknown fragment %q", ErrMalformed, name)
+}
+
+// fragmentByName returns the fragment that is written with the passed name.
+func fragmentByName(name string) fragment {
+	for frag, fragName := range fragmentNames {
+		if fragName == name {
+			return frag
+		}
+	}
+	panic(fmt.Sprintf("unknown fragment name %q", name))
+}
+
+// checkArgs ensures the passed fragment has the expected number of arguments.
+func checkArgs(name string, args []string, want int) error {
+	if len(args) != want {
+		return fmt.Errorf("%w: %s takes %d arguments, got %d",
+			ErrMalformed, name, want, len(args))
+	}
+	return nil
+}
+
+// parseKey parses a hex-encoded compressed public key.
+func parseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || !btcec.IsCompressedPubKey(key) {
+		return nil, fmt.Errorf("%w: %q is not a compressed public key",
+			ErrMalformed, s)
+	}
+	if _, err := btcec.ParsePubKey(key); err != nil {
+		return nil, fmt.Errorf("%w: invalid public key %q: %v",
+			ErrMalformed, s, err)
+	}
+	return key, nil
+}
+
+// splitArgs splits the passed arguments of a fragment at the commas that
+// aren't nested in the arguments of another fragment.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced parentheses",
+					ErrMalformed)
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced parentheses", ErrMalformed)
+	}
+	return append(args, s[start:]), nil
+}
+
+// String returns the miniscript expression.  Shorthands such as pk, and_n
+// and the t:, l: and u: wrappers are used where they apply, so the
+// expression is the same for miniscripts that compile to the same script.
+func (m *Miniscript) String() string {
+	return m.root.String()
+}
+
+// String returns the expression of the node.
+func (n *node) String() string {
+	var wrappers string
+	for {
+		wrapper, sub := n.wrapper()
+		if sub == nil {
+			break
+		}
+		wrappers += string(wrapper)
+		n = sub
+	}
+	if wrappers != "" {
+		return wrappers + ":" + n.body()
+	}
+	return n.body()
+}
+
+// wrapper returns the wrapper letter of the node and the expression it
+// wraps, or a nil expression when the node isn't written as a wrapper.
+func (n *node) wrapper() (byte, *node) {
+	switch n.frag {
+	case fragWrapC:
+		// The c: wrapper of pk_k and pk_h is written as pk and pkh.
+		sub := n.subs[0]
+		if sub.frag == fragPkK || sub.frag == fragPkH {
+			return 0, nil
+		}
+		return 'c', sub
+
+	case fragWrapA, fragWrapS, fragWrapD, fragWrapV, fragWrapJ, fragWrapN:
+		for letter, frag := range wrapperFragments {
+			if frag == n.frag {
+				return letter, n.subs[0]
+			}
+		}
+
+	case fragAndV:
+		if n.subs[1].frag == fragOne {
+			return 't', n.subs[0]
+		}
+
+	case fragOrI:
+		if n.subs[0].frag == fragZero {
+			return 'l', n.subs[1]
+		}
+		if n.subs[1].frag == fragZero {
+			return 'u', n.subs[0]
+		}
+	}
+	return 0, nil
+}
+
+// body returns the expression of the node without its wrappers.
+func (n *node) body() string {
+	var args []string
+	name := fragmentNames[n.frag]
+	switch n.frag {
+	case fragZero:
+		return "0"
+
+	case fragOne:
+		return "1"
+
+	case fragWrapC:
+		name = "pk"
+		if n.subs[0].frag == fragPkH {
+			name = "pkh"
+		}
+		args = []string{hex.EncodeToString(n.subs[0].keys[0])}
+
+	case fragPkK, fragPkH:
+		args = []string{hex.EncodeToString(n.keys[0])}
+
+	case fragOlder, fragAfter:
+		args = []string{strconv.FormatUint(uint64(n.k), 10)}
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		args = []string{hex.EncodeToString(n.data)}
+
+	case fragMulti:
+		args = []string{strconv.FormatUint(uint64(n.k), 10)}
+		for _, key := range n.keys {
+			args = append(args, hex.EncodeToString(key))
+		}
+
+	case fragThresh:
+		args = []string{strconv.FormatUint(uint64(n.k), 10)}
+		for _, sub := range n.subs {
+			args = append(args, sub.String())
+		}
+
+	default:
+		subs := n.subs
+		if n.frag == fragAndOr && subs[2].frag == fragZero {
+			name, subs = "and_n", subs[:2]
+		}
+		for _, sub := range subs {
+			args = append(args, sub.String())
+		}
+	}
+
+	return name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Type returns the type of the miniscript.
+func (m *Miniscript) Type() Type {
+	return m.root.typ
+}
+
+// IsNonMalleable returns whether the miniscript can always be satisfied
+// without a third party being able to change the witness into another valid
+// one.
+func (m *Miniscript) IsNonMalleable() bool {
+	return m.root.typ.Has(TypeM)
+}
+
+// RequiresSignature returns whether every satisfaction of the miniscript
+// requires a signature.
+func (m *Miniscript) RequiresSignature() bool {
+	return m.root.typ.Has(TypeS)
+}
+
+// HasTimelockMix returns whether a spending path of the miniscript requires
+// both a height and a time timelock of the same kind, which can never be
+// satisfied.
+func (m *Miniscript) HasTimelockMix() bool {
+	return !m.root.typ.Has(TypeNoTimelockMix)
+}
+
+// MaxOps returns the largest number of non-push opcodes, including the public
+// keys checked by CHECKMULTISIG, executed by a satisfaction of the miniscript.
+func (m *Miniscript) MaxOps() int {
+	return m.root.opCount + m.root.ops.sat.value
+}
+
+// MaxSatisfactionElements returns the largest number of witness stack items of
+// a satisfaction of the miniscript, not including the witness script.
+func (m *Miniscript) MaxSatisfactionElements() int {
+	return m.root.stack.sat.value
+}
+
+// MaxSatisfactionSize returns the largest serialized size of the witness stack
+// items of a satisfaction of the miniscript, not including the witness script
+// and the count of the items.  Signatures are assumed to be 72 bytes along
+// with their sighash type.
+func (m *Miniscript) MaxSatisfactionSize() int {
+	return m.root.witness.sat.value
+}
+
+// Sane returns an error when the miniscript isn't safe to use.  A sane
+// miniscript has a satisfaction within the consensus and standardness limits,
+// only has non-malleable satisfactions that all require a signature, doesn't
+// mix timelock types and doesn't repeat a key.
+func (m *Miniscript) Sane() error {
+	root := m.root
+	if !root.stack.sat.valid {
+		return fmt.Errorf("%w: miniscript can't be satisfied", ErrNotSane)
+	}
+	if ops := m.MaxOps(); ops > txscript.MaxOpsPerScript {
+		return fmt.Errorf("%w: satisfaction executes %d opcodes, more "+
+			"than the limit of %d", ErrNotSane, ops,
+			txscript.MaxOpsPerScript)
+	}
+	if items := m.MaxSatisfactionElements(); items > maxStandardP2WSHStackItems {
+		return fmt.Errorf("%w: satisfaction has %d witness items, more "+
+			"than the limit of %d", ErrNotSane, items,
+			maxStandardP2WSHStackItems)
+	}
+	script, err := m.Script()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotSane, err)
+	}
+	if len(script) > maxStandardP2WSHScriptSize {
+		return fmt.Errorf("%w: script is %d bytes, more than the limit "+
+			"of %d", ErrNotSane, len(script),
+			maxStandardP2WSHScriptSize)
+	}
+	if !m.IsNonMalleable() {
+		return fmt.Errorf("%w: miniscript is malleable", ErrNotSane)
+	}
+	if !m.RequiresSignature() {
+		return fmt.Errorf("%w: miniscript can be satisfied without a "+
+			"signature", ErrNotSane)
+	}
+	if m.HasTimelockMix() {
+		return fmt.Errorf("%w: miniscript mixes height and time "+
+			"timelocks", ErrNotSane)
+	}
+
+	seen := make(map[string]struct{})
+	var dup []byte
+	root.walk(func(n *node) {
+		for _, key := range n.keys {
+			if _, ok := seen[string(key)]; ok && dup == nil {
+				dup = key
+			}
+			seen[string(key)] = struct{}{}
+		}
+	})
+	if dup != nil {
+		return fmt.Errorf("%w: key %x is used more than once", ErrNotSane,
+			dup)
+	}
+
+	return nil
+}
+
+// walk calls the passed function for the node and all of its subexpressions.
+func (n *node) walk(fn func(*node)) {
+	fn(n)
+	for _, sub := range n.subs {
+		sub.walk(fn)
+	}
+}
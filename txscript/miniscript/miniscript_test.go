@@ -0,0 +1,575 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// testKeys returns deterministic private keys for the tests along with a
+// replacer for the key names A, B, C and D used in the test expressions.
+func testKeys() (map[string]*btcec.PrivateKey, *strings.Replacer) {
+	keys := make(map[string]*btcec.PrivateKey)
+	var names []string
+	for _, name := range []string{"A", "B", "C", "D"} {
+		seed := sha256.Sum256([]byte(name))
+		privKey, pubKey := btcec.PrivKeyFromBytes(seed[:])
+		keys[name] = privKey
+		names = append(names, name,
+			hex.EncodeToString(pubKey.SerializeCompressed()))
+	}
+	return keys, strings.NewReplacer(names...)
+}
+
+// testPreimage is the preimage of the hashes used in the test expressions.
+var testPreimage = []byte("miniscript test preimage bytes!!")
+
+// expandHashes replaces the hash names H256, HASH256, RIPEMD160 and HASH160
+// in the passed expression with the hashes of the test preimage.
+func expandHashes(s string) string {
+	return strings.NewReplacer(
+		"H256", hex.EncodeToString(HashSHA256.Hash(testPreimage)),
+		"HASH256", hex.EncodeToString(HashHASH256.Hash(testPreimage)),
+		"RIPEMD160", hex.EncodeToString(HashRIPEMD160.Hash(testPreimage)),
+		"HASH160", hex.EncodeToString(HashHASH160.Hash(testPreimage)),
+	).Replace(s)
+}
+
+// TestParse ensures miniscripts are type checked and analyzed as expected.
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		expr      string
+		typ       string
+		sane      bool
+		malleable bool
+	}{{
+		name: "pk",
+		expr: "pk(A)",
+		typ:  "Bonduesmk",
+		sane: true,
+	}, {
+		name: "pkh",
+		expr: "pkh(A)",
+		typ:  "Bnduesmk",
+		sane: true,
+	}, {
+		name: "and_v with verify",
+		expr: "and_v(v:pk(A),pk(B))",
+		typ:  "Bnufsmk",
+		sane: true,
+	}, {
+		name: "or_b with swap",
+		expr: "or_b(pk(A),s:pk(B))",
+		typ:  "Bduesmxk",
+		sane: true,
+	}, {
+		name: "or_d with timelock",
+		expr: "and_v(v:pk(A),or_d(pk(B),older(144)))",
+		typ:  "Bnfsmxhk",
+		sane: true,
+	}, {
+		name: "thresh",
+		expr: "thresh(2,pk(A),s:pk(B),s:pk(C))",
+		typ:  "Bduesmk",
+		sane: true,
+	}, {
+		name: "multi",
+		expr: "multi(2,A,B,C)",
+		typ:  "Bnduesmk",
+		sane: true,
+	}, {
+		name: "andor",
+		expr: "andor(pk(A),older(10),pk(B))",
+		typ:  "Bdesmxhk",
+		sane: true,
+	}, {
+		name: "and_n",
+		expr: "and_n(pk(A),sha256(H256))",
+		typ:  "Bduesmxk",
+		sane: true,
+	}, {
+		name: "or_i with wrappers",
+		expr: "or_i(and_v(v:pkh(A),hash160(HASH160)),pk(B))",
+		typ:  "Bduesmxk",
+		sane: true,
+	}, {
+		name: "l: wrapper",
+		expr: "and_v(v:pk(A),l:after(100))",
+		typ:  "Bnfsmxjk",
+		sane: true,
+	}, {
+		name: "u: and t: wrappers",
+		expr: "and_v(v:pk(A),utv:pk(B))",
+		typ:  "Bnufsmxk",
+		sane: true,
+	}, {
+		name: "d: wrapper",
+		expr: "and_b(pk(A),adv:older(144))",
+		typ:  "Bndusmxhk",
+		sane: true,
+	}, {
+		name: "j: and n: wrappers",
+		expr: "or_d(pk(A),jn:and_v(v:pk(B),ripemd160(RIPEMD160)))",
+		typ:  "Bduesmxk",
+		sane: true,
+	}, {
+		name:      "hash without signature",
+		expr:      "sha256(H256)",
+		typ:       "Bondumk",
+		malleable: false,
+	}, {
+		name:      "malleable or_d",
+		expr:      "or_d(hash256(HASH256),pk(A))",
+		typ:       "Bduxk",
+		malleable: true,
+	}, {
+		name: "timelock mix",
+		expr: "and_v(v:pk(A),and_v(v:after(100),after(500000001)))",
+		typ:  "Bonfsmxij",
+	}, {
+		name: "duplicate key",
+		expr: "and_v(v:pk(A),pk(A))",
+		typ:  "Bnufsmk",
+	}}
+
+	_, keyNames := testKeys()
+	for _, test := range tests {
+		expr := keyNames.Replace(expandHashes(test.expr))
+		m, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		if m.String() != expr {
+			t.Errorf("%s: mismatched string -- got %s, want %s",
+				test.name, m.String(), expr)
+		}
+		if m.Type().String() != test.typ {
+			t.Errorf("%s: mismatched type -- got %s, want %s",
+				test.name, m.Type(), test.typ)
+		}
+		if m.IsNonMalleable() == test.malleable {
+			t.Errorf("%s: mismatched malleability -- got %v, want %v",
+				test.name, !m.IsNonMalleable(), test.malleable)
+		}
+		err = m.Sane()
+		if test.sane && err != nil {
+			t.Errorf("%s: unexpected sanity error: %v", test.name, err)
+		}
+		if !test.sane && !errors.Is(err, ErrNotSane) {
+			t.Errorf("%s: mismatched sanity error -- got %v, want %v",
+				test.name, err, ErrNotSane)
+		}
+	}
+}
+
+// TestParseErrors ensures invalid miniscripts are rejected.
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		err  error
+	}{
+		{"unknown fragment", "pk_x(A)", ErrMalformed},
+		{"unknown wrapper", "q:pk(A)", ErrMalformed},
+		{"empty wrapper", ":pk(A)", ErrMalformed},
+		{"uncompressed key", "pk(04" + strings.Repeat("00", 64) + ")",
+			ErrMalformed},
+		{"invalid hash", "sha256(00)", ErrMalformed},
+		{"zero timelock", "older(0)", ErrMalformed},
+		{"huge timelock", "after(2147483648)", ErrMalformed},
+		{"wrong arg count", "and_v(v:pk(A))", ErrMalformed},
+		{"zero threshold", "thresh(0,pk(A))", ErrMalformed},
+		{"high threshold", "multi(3,A,B)", ErrMalformed},
+		{"unbalanced", "and_v(v:pk(A),pk(B)", ErrMalformed},
+		{"or_b needs W", "or_b(pk(A),pk(B))", ErrInvalidType},
+		{"and_v needs V", "and_v(pk(A),pk(B))", ErrInvalidType},
+		{"j: needs n", "j:older(1)", ErrInvalidType},
+		{"top level V", "v:pk(A)", ErrInvalidType},
+		{"top level K", "pk_k(A)", ErrInvalidType},
+		{"thresh needs Wdu", "thresh(1,pk(A),pk(B))", ErrInvalidType},
+	}
+
+	_, keyNames := testKeys()
+	for _, test := range tests {
+		_, err := Parse(keyNames.Replace(test.expr))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestScript ensures miniscripts compile to the expected scripts.
+func TestScript(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr   string
+		script string
+	}{{
+		expr:   "and_v(v:pk(A),pk(B))",
+		script: "A OP_CHECKSIGVERIFY B OP_CHECKSIG",
+	}, {
+		expr: "and_v(v:pk(A),or_d(pk(B),older(144)))",
+		script: "A OP_CHECKSIGVERIFY B OP_CHECKSIG OP_IFDUP OP_NOTIF " +
+			"9000 OP_CHECKSEQUENCEVERIFY OP_ENDIF",
+	}, {
+		expr: "thresh(2,pk(A),s:pk(B),s:pk(C))",
+		script: "A OP_CHECKSIG OP_SWAP B OP_CHECKSIG OP_ADD OP_SWAP C " +
+			"OP_CHECKSIG OP_ADD 2 OP_EQUAL",
+	}, {
+		expr:   "multi(2,A,B,C)",
+		script: "2 A B C 3 OP_CHECKMULTISIG",
+	}, {
+		expr:   "and_v(v:multi(1,A,B),pk(C))",
+		script: "1 A B 2 OP_CHECKMULTISIGVERIFY C OP_CHECKSIG",
+	}, {
+		expr: "c:or_i(pk_k(A),pk_h(B))",
+		script: "OP_IF A OP_ELSE OP_DUP OP_HASH160 HB OP_EQUALVERIFY " +
+			"OP_ENDIF OP_CHECKSIG",
+	}, {
+		expr: "and_v(v:sha256(H256),pk(A))",
+		script: "OP_SIZE 20 OP_EQUALVERIFY OP_SHA256 H256 " +
+			"OP_EQUALVERIFY A OP_CHECKSIG",
+	}, {
+		expr: "and_b(pk(A),adv:older(144))",
+		script: "A OP_CHECKSIG OP_TOALTSTACK OP_DUP OP_IF 9000 " +
+			"OP_CHECKSEQUENCEVERIFY OP_VERIFY OP_ENDIF " +
+			"OP_FROMALTSTACK OP_BOOLAND",
+	}, {
+		expr: "andor(pk(A),older(10),or_d(pk(B),jn:pk(C)))",
+		script: "A OP_CHECKSIG OP_NOTIF B OP_CHECKSIG OP_IFDUP OP_NOTIF " +
+			"OP_SIZE " +
+			"OP_0NOTEQUAL OP_IF C OP_CHECKSIG OP_0NOTEQUAL OP_ENDIF " +
+			"OP_ENDIF OP_ELSE 10 OP_CHECKSEQUENCEVERIFY OP_ENDIF",
+	}}
+
+	keys, keyNames := testKeys()
+	var names []string
+	for name, key := range keys {
+		pubKey := key.PubKey().SerializeCompressed()
+		names = append(names, hex.EncodeToString(pubKey), name,
+			hex.EncodeToString(hash160(pubKey)), "H"+name)
+	}
+	names = append(names, hex.EncodeToString(HashSHA256.Hash(testPreimage)),
+		"H256")
+	hexNames := strings.NewReplacer(names...)
+
+	for _, test := range tests {
+		m, err := Parse(keyNames.Replace(expandHashes(test.expr)))
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.expr, err)
+			continue
+		}
+		script, err := m.Script()
+		if err != nil {
+			t.Errorf("%s: unexpected script error: %v", test.expr, err)
+			continue
+		}
+		disasm, err := txscript.DisasmString(script)
+		if err != nil {
+			t.Errorf("%s: unexpected disasm error: %v", test.expr, err)
+			continue
+		}
+		if got := hexNames.Replace(disasm); got != test.script {
+			t.Errorf("%s: mismatched script -- got %s, want %s",
+				test.expr, got, test.script)
+		}
+	}
+}
+
+// testSatisfier is a Satisfier for a transaction spending a pay-to-witness-
+// script-hash output in its first input.
+type testSatisfier struct {
+	t             *testing.T
+	tx            *wire.MsgTx
+	sigHashes     *txscript.TxSigHashes
+	amount        int64
+	witnessScript []byte
+	keys          map[string]*btcec.PrivateKey
+	preimage      bool
+}
+
+// Sign returns a signature for the passed key when it's available.
+func (s *testSatisfier) Sign(pubKey []byte) ([]byte, bool) {
+	for _, key := range s.keys {
+		if string(key.PubKey().SerializeCompressed()) != string(pubKey) {
+			continue
+		}
+		sig, err := txscript.RawTxInWitnessSignature(s.tx, s.sigHashes,
+			0, s.amount, s.witnessScript, txscript.SigHashAll, key)
+		if err != nil {
+			s.t.Fatalf("unable to sign: %v", err)
+		}
+		return sig, true
+	}
+	return nil, false
+}
+
+// Preimage returns the test preimage when it's available.
+func (s *testSatisfier) Preimage(hashFunc HashFunc, hash []byte) ([]byte, bool) {
+	return testPreimage, s.preimage
+}
+
+// CheckOlder returns whether the sequence of the spending input satisfies the
+// relative timelock.
+func (s *testSatisfier) CheckOlder(sequence uint32) bool {
+	const mask = wire.SequenceLockTimeIsSeconds | wire.SequenceLockTimeMask
+	txSequence := s.tx.TxIn[0].Sequence
+	return s.tx.Version >= 2 &&
+		txSequence&wire.SequenceLockTimeDisabled == 0 &&
+		txSequence&wire.SequenceLockTimeIsSeconds ==
+			sequence&wire.SequenceLockTimeIsSeconds &&
+		sequence&mask <= txSequence&mask
+}
+
+// CheckAfter returns whether the lock time of the spending transaction
+// satisfies the absolute timelock.
+func (s *testSatisfier) CheckAfter(lockTime uint32) bool {
+	return s.tx.TxIn[0].Sequence != wire.MaxTxInSequenceNum &&
+		(lockTime < txscript.LockTimeThreshold) ==
+			(s.tx.LockTime < txscript.LockTimeThreshold) &&
+		lockTime <= s.tx.LockTime
+}
+
+// TestSatisfy ensures the witnesses produced for miniscripts are valid and
+// within the computed satisfaction sizes.
+func TestSatisfy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		signers  string
+		preimage bool
+		sequence uint32
+		lockTime uint32
+		err      error
+		items    int
+	}{{
+		name:    "and_v both keys",
+		expr:    "and_v(v:pk(A),pk(B))",
+		signers: "AB",
+		items:   2,
+	}, {
+		name:    "and_v missing key",
+		expr:    "and_v(v:pk(A),pk(B))",
+		signers: "A",
+		err:     ErrUnsatisfiable,
+	}, {
+		name:    "or_d with key",
+		expr:    "and_v(v:pk(A),or_d(pk(B),older(144)))",
+		signers: "AB",
+		items:   2,
+	}, {
+		name:     "or_d with timelock",
+		expr:     "and_v(v:pk(A),or_d(pk(B),older(144)))",
+		signers:  "A",
+		sequence: 144,
+		items:    2,
+	}, {
+		name:     "or_d with timelock not reached",
+		expr:     "and_v(v:pk(A),or_d(pk(B),older(144)))",
+		signers:  "A",
+		sequence: 143,
+		err:      ErrUnsatisfiable,
+	}, {
+		name:    "thresh",
+		expr:    "thresh(2,pk(A),s:pk(B),s:pk(C))",
+		signers: "AC",
+		items:   3,
+	}, {
+		name:    "thresh prefers smaller",
+		expr:    "thresh(2,pk(A),s:pk(B),s:pk(C))",
+		signers: "ABC",
+		items:   3,
+	}, {
+		name:    "multi",
+		expr:    "multi(2,A,B,C)",
+		signers: "BC",
+		items:   3,
+	}, {
+		name:    "multi missing key",
+		expr:    "multi(2,A,B,C)",
+		signers: "C",
+		err:     ErrUnsatisfiable,
+	}, {
+		name:    "andor else branch",
+		expr:    "andor(pk(A),older(10),pk(B))",
+		signers: "B",
+		items:   2,
+	}, {
+		name:    "or_b",
+		expr:    "or_b(pk(A),s:pk(B))",
+		signers: "B",
+		items:   2,
+	}, {
+		name:     "and_b with d:",
+		expr:     "and_b(pk(A),adv:older(144))",
+		signers:  "A",
+		sequence: 144,
+		items:    2,
+	}, {
+		name:     "or_i with preimage",
+		expr:     "or_i(and_v(v:pkh(A),hash160(HASH160)),pk(B))",
+		signers:  "A",
+		preimage: true,
+		items:    4,
+	}, {
+		name:    "or_i other branch",
+		expr:    "or_i(and_v(v:pkh(A),hash160(HASH160)),pk(B))",
+		signers: "B",
+		items:   2,
+	}, {
+		name:     "and_n with preimage",
+		expr:     "and_n(pk(A),sha256(H256))",
+		signers:  "A",
+		preimage: true,
+		items:    2,
+	}, {
+		name:     "after",
+		expr:     "and_v(v:pk(A),after(100))",
+		signers:  "A",
+		sequence: wire.MaxTxInSequenceNum - 1,
+		lockTime: 100,
+		items:    1,
+	}, {
+		name:     "j: and n: wrappers",
+		expr:     "or_d(pk(A),jn:and_v(v:pk(B),ripemd160(RIPEMD160)))",
+		signers:  "B",
+		preimage: true,
+		items:    3,
+	}, {
+		name:     "malleable without signature",
+		expr:     "or_d(hash256(HASH256),pk(A))",
+		signers:  "A",
+		preimage: true,
+		err:      ErrUnsatisfiable,
+	}}
+
+	keys, keyNames := testKeys()
+	for _, test := range tests {
+		m, err := Parse(keyNames.Replace(expandHashes(test.expr)))
+		if err != nil {
+			t.Errorf("%s: unexpected parse error: %v", test.name, err)
+			continue
+		}
+		witnessScript, err := m.Script()
+		if err != nil {
+			t.Errorf("%s: unexpected script error: %v", test.name, err)
+			continue
+		}
+		scriptHash := sha256.Sum256(witnessScript)
+		pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(scriptHash[:]).Script()
+		if err != nil {
+			t.Fatalf("%s: unable to build pkScript: %v", test.name, err)
+		}
+
+		// Spend the output in a transaction with the sequence and lock
+		// time of the test.
+		const amount = 100000
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}},
+			Sequence:         test.sequence,
+		})
+		tx.AddTxOut(wire.NewTxOut(amount-1000, pkScript))
+		tx.LockTime = test.lockTime
+		prevOuts := txscript.NewCannedPrevOutputFetcher(pkScript, amount)
+		sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+
+		signers := make(map[string]*btcec.PrivateKey)
+		for _, name := range test.signers {
+			signers[string(name)] = keys[string(name)]
+		}
+		satisfier := &testSatisfier{
+			t:             t,
+			tx:            tx,
+			sigHashes:     sigHashes,
+			amount:        amount,
+			witnessScript: witnessScript,
+			keys:          signers,
+			preimage:      test.preimage,
+		}
+		items, err := m.Satisfy(satisfier)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if len(items) != test.items {
+			t.Errorf("%s: mismatched number of items -- got %d, "+
+				"want %d", test.name, len(items), test.items)
+		}
+		if len(items) > m.MaxSatisfactionElements() {
+			t.Errorf("%s: %d items exceed the maximum of %d",
+				test.name, len(items), m.MaxSatisfactionElements())
+		}
+		var size int
+		for _, item := range items {
+			size += wire.VarIntSerializeSize(uint64(len(item))) +
+				len(item)
+		}
+		if size > m.MaxSatisfactionSize() {
+			t.Errorf("%s: witness size %d exceeds the maximum of %d",
+				test.name, size, m.MaxSatisfactionSize())
+		}
+
+		tx.TxIn[0].Witness = append(items, witnessScript)
+		vm, err := txscript.NewEngine(pkScript, tx, 0,
+			txscript.StandardVerifyFlags, nil, sigHashes, amount, prevOuts)
+		if err != nil {
+			t.Errorf("%s: unable to create engine: %v", test.name, err)
+			continue
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("%s: witness failed to execute: %v", test.name, err)
+		}
+	}
+}
+
+// TestSatisfyMalleable ensures malleable satisfactions are only returned when
+// they are allowed.
+func TestSatisfyMalleable(t *testing.T) {
+	t.Parallel()
+
+	m, err := Parse(expandHashes("sha256(H256)"))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	satisfier := &testSatisfier{t: t, tx: wire.NewMsgTx(2), preimage: true}
+	if _, err := m.Satisfy(satisfier); !errors.Is(err, ErrUnsatisfiable) {
+		t.Fatalf("mismatched error -- got %v, want %v", err,
+			ErrUnsatisfiable)
+	}
+	items, err := m.SatisfyMalleable(satisfier)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 1 || string(items[0]) != string(testPreimage) {
+		t.Fatalf("mismatched witness -- got %x, want %x", items,
+			testPreimage)
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// HashFunc identifies the hash function of a hash fragment.
+type HashFunc uint8
+
+const (
+	// HashSHA256 is the hash function of the sha256 fragment.
+	HashSHA256 HashFunc = iota
+
+	// HashHASH256 is the double SHA256 hash function of the hash256
+	// fragment.
+	HashHASH256
+
+	// HashRIPEMD160 is the hash function of the ripemd160 fragment.
+	HashRIPEMD160
+
+	// HashHASH160 is the RIPEMD160 of SHA256 hash function of the hash160
+	// fragment.
+	HashHASH160
+)
+
+// hashFuncs maps the hash fragments to their hash functions.
+var hashFuncs = map[fragment]HashFunc{
+	fragSha256:    HashSHA256,
+	fragHash256:   HashHASH256,
+	fragRipemd160: HashRIPEMD160,
+	fragHash160:   HashHASH160,
+}
+
+// Hash returns the hash of the passed data.
+func (f HashFunc) Hash(data []byte) []byte {
+	switch f {
+	case HashSHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case HashHASH256:
+		return chainhash.DoubleHashB(data)
+	case HashRIPEMD160:
+		h := ripemd160.New()
+		h.Write(data)
+		return h.Sum(nil)
+	default:
+		return hash160(data)
+	}
+}
+
+// Satisfier provides the signatures, preimages and timelocks available to
+// satisfy a miniscript.
+type Satisfier interface {
+	// Sign returns a signature, including the sighash type, of the
+	// spending transaction for the passed serialized public key, and
+	// whether one is available.
+	Sign(pubKey []byte) ([]byte, bool)
+
+	// Preimage returns the preimage of the passed hash under the passed
+	// hash function, and whether it is known.
+	Preimage(hashFunc HashFunc, hash []byte) ([]byte, bool)
+
+	// CheckOlder returns whether the spending input satisfies a relative
+	// timelock with the passed sequence value.
+	CheckOlder(sequence uint32) bool
+
+	// CheckAfter returns whether the spending transaction satisfies an
+	// absolute timelock with the passed lock time.
+	CheckAfter(lockTime uint32) bool
+}
+
+// inputStack is a candidate witness stack that satisfies or dissatisfies an
+// expression, along with the properties needed to choose between candidates.
+type inputStack struct {
+	// available is set when the stack can be produced from the available
+	// signatures, preimages and timelocks.
+	available bool
+
+	// hasSig is set when the stack contains a signature, and malleable
+	// when a third party can change it into another valid stack.
+	hasSig    bool
+	malleable bool
+
+	// size is the serialized size of the stack items.
+	size  int
+	items [][]byte
+}
+
+var (
+	// invalidStack is a stack that isn't available.
+	invalidStack = inputStack{}
+
+	// emptyStack is an available stack without any items.
+	emptyStack = inputStack{available: true}
+)
+
+// newStack returns an available stack with the passed item.
+func newStack(item []byte) inputStack {
+	return inputStack{
+		available: true,
+		size:      len(item) + 1,
+		items:     [][]byte{item},
+	}
+}
+
+// zeroStack returns a stack with an empty item, which is a zero.
+func zeroStack() inputStack {
+	return newStack(nil)
+}
+
+// oneStack returns a stack with a one.
+func oneStack() inputStack {
+	return newStack([]byte{1})
+}
+
+// withSig returns the stack marked as containing a signature, and as
+// unavailable when no signature was available.
+func (s inputStack) withSig(available bool) inputStack {
+	s.hasSig = true
+	s.available = s.available && available
+	return s
+}
+
+// withMalleable returns the stack marked as malleable when malleable is set.
+func (s inputStack) withMalleable(malleable bool) inputStack {
+	s.malleable = s.malleable || malleable
+	return s
+}
+
+// cat returns the stack with the items of the passed stack on top.
+func (s inputStack) cat(top inputStack) inputStack {
+	if !s.available || !top.available {
+		return invalidStack
+	}
+
+	items := make([][]byte, 0, len(s.items)+len(top.items))
+	items = append(items, s.items...)
+	items = append(items, top.items...)
+	return inputStack{
+		available: true,
+		hasSig:    s.hasSig || top.hasSig,
+		malleable: s.malleable || top.malleable,
+		size:      s.size + top.size,
+		items:     items,
+	}
+}
+
+// or returns the best of two alternative stacks.  Stacks without a signature
+// are preferred, since a third party could otherwise use them instead, and
+// choosing between two of them is inevitably malleable.  Otherwise
+// non-malleable stacks are preferred, followed by smaller ones.
+func (s inputStack) or(other inputStack) inputStack {
+	switch {
+	case !s.available:
+		return other
+	case !other.available:
+		return s
+	case !s.hasSig && other.hasSig:
+		return s
+	case s.hasSig && !other.hasSig:
+		return other
+	case !s.hasSig && !other.hasSig:
+		s.malleable = true
+		other.malleable = true
+	case !s.malleable && other.malleable:
+		return s
+	case s.malleable && !other.malleable:
+		return other
+	}
+
+	if s.size <= other.size {
+		return s
+	}
+	return other
+}
+
+// inputResult is the best satisfaction and dissatisfaction of an expression.
+type inputResult struct {
+	dsat inputStack
+	sat  inputStack
+}
+
+// Satisfy returns the witness stack items, not including the witness script,
+// of the best non-malleable satisfaction of the miniscript using the
+// signatures, preimages and timelocks provided by the passed satisfier.  The
+// items are ordered from the bottom of the stack to the top.
+//
+// ErrUnsatisfiable is returned when the miniscript can't be satisfied, or
+// when every satisfaction is malleable or lacks a signature.
+func (m *Miniscript) Satisfy(satisfier Satisfier) ([][]byte, error) {
+	return m.satisfy(satisfier, true)
+}
+
+// SatisfyMalleable is like Satisfy, except it also returns satisfactions a
+// third party can change into another valid witness, such as those that
+// don't require a signature.
+func (m *Miniscript) SatisfyMalleable(satisfier Satisfier) ([][]byte, error) {
+	return m.satisfy(satisfier, false)
+}
+
+// satisfy returns the witness stack items of the best satisfaction of the
+// miniscript, which must be non-malleable when nonMalleable is set.
+func (m *Miniscript) satisfy(satisfier Satisfier,
+	nonMalleable bool) ([][]byte, error) {
+
+	sat := m.root.produceInput(satisfier).sat
+	switch {
+	case !sat.available:
+		return nil, fmt.Errorf("%w: not enough signatures, preimages "+
+			"or timelocks are available", ErrUnsatisfiable)
+	case nonMalleable && sat.malleable:
+		return nil, fmt.Errorf("%w: the only satisfaction is malleable",
+			ErrUnsatisfiable)
+	case nonMalleable && !sat.hasSig:
+		return nil, fmt.Errorf("%w: the only satisfaction doesn't "+
+			"require a signature", ErrUnsatisfiable)
+	}
+
+	items := sat.items
+	if items == nil {
+		items = [][]byte{}
+	}
+	return items, nil
+}
+
+// produceInput returns the best satisfaction and dissatisfaction of the node.
+func (n *node) produceInput(satisfier Satisfier) inputResult {
+	subs := make([]inputResult, 0, len(n.subs))
+	for _, sub := range n.subs {
+		subs = append(subs, sub.produceInput(satisfier))
+	}
+
+	switch n.frag {
+	case fragZero:
+		return inputResult{dsat: emptyStack, sat: invalidStack}
+
+	case fragOne:
+		return inputResult{dsat: invalidStack, sat: emptyStack}
+
+	case fragPkK:
+		sig, ok := satisfier.Sign(n.keys[0])
+		return inputResult{
+			dsat: zeroStack(),
+			sat:  newStack(sig).withSig(ok),
+		}
+
+	case fragPkH:
+		key := newStack(n.keys[0])
+		sig, ok := satisfier.Sign(n.keys[0])
+		return inputResult{
+			dsat: zeroStack().cat(key),
+			sat:  newStack(sig).withSig(ok).cat(key),
+		}
+
+	case fragOlder:
+		if satisfier.CheckOlder(n.k) {
+			return inputResult{dsat: invalidStack, sat: emptyStack}
+		}
+		return inputResult{dsat: invalidStack, sat: invalidStack}
+
+	case fragAfter:
+		if satisfier.CheckAfter(n.k) {
+			return inputResult{dsat: invalidStack, sat: emptyStack}
+		}
+		return inputResult{dsat: invalidStack, sat: invalidStack}
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		// Any value of the right size other than the preimage
+		// dissatisfies the expression, so dissatisfactions are
+		// malleable.
+		dsat := newStack(make([]byte, preimageSize)).withMalleable(true)
+		hashFunc := hashFuncs[n.frag]
+		preimage, ok := satisfier.Preimage(hashFunc, n.data)
+		if !ok || len(preimage) != preimageSize ||
+			!bytes.Equal(hashFunc.Hash(preimage), n.data) {
+
+			return inputResult{dsat: dsat, sat: invalidStack}
+		}
+		return inputResult{dsat: dsat, sat: newStack(preimage)}
+
+	case fragAndOr:
+		x, y, z := subs[0], subs[1], subs[2]
+		return inputResult{
+			dsat: y.dsat.cat(x.sat).or(z.dsat.cat(x.dsat)),
+			sat:  y.sat.cat(x.sat).or(z.sat.cat(x.dsat)),
+		}
+
+	case fragAndV:
+		x, y := subs[0], subs[1]
+		return inputResult{
+			dsat: y.dsat.cat(x.sat),
+			sat:  y.sat.cat(x.sat),
+		}
+
+	case fragAndB:
+		// Dissatisfying only one of the subexpressions is malleable,
+		// since a third party can dissatisfy the other one too.
+		x, y := subs[0], subs[1]
+		return inputResult{
+			dsat: y.dsat.cat(x.dsat).
+				or(y.sat.cat(x.dsat).withMalleable(true)).
+				or(y.dsat.cat(x.sat).withMalleable(true)),
+			sat: y.sat.cat(x.sat),
+		}
+
+	case fragOrB:
+		// Satisfying both subexpressions is malleable, since a third
+		// party can dissatisfy either one of them.
+		x, z := subs[0], subs[1]
+		return inputResult{
+			dsat: z.dsat.cat(x.dsat),
+			sat: z.dsat.cat(x.sat).
+				or(z.sat.cat(x.dsat)).
+				or(z.sat.cat(x.sat).withMalleable(true)),
+		}
+
+	case fragOrC:
+		x, z := subs[0], subs[1]
+		return inputResult{
+			dsat: invalidStack,
+			sat:  x.sat.or(z.sat.cat(x.dsat)),
+		}
+
+	case fragOrD:
+		x, z := subs[0], subs[1]
+		return inputResult{
+			dsat: z.dsat.cat(x.dsat),
+			sat:  x.sat.or(z.sat.cat(x.dsat)),
+		}
+
+	case fragOrI:
+		x, z := subs[0], subs[1]
+		return inputResult{
+			dsat: x.dsat.cat(oneStack()).or(z.dsat.cat(zeroStack())),
+			sat:  x.sat.cat(oneStack()).or(z.sat.cat(zeroStack())),
+		}
+
+	case fragThresh:
+		// sats[j] is the best stack satisfying exactly j of the
+		// subexpressions processed so far, which are processed from
+		// the last one since it consumes the bottom of the stack.
+		sats := []inputStack{emptyStack}
+		for i := len(subs) - 1; i >= 0; i-- {
+			res := subs[i]
+			next := []inputStack{sats[0].cat(res.dsat)}
+			for j := 1; j < len(sats); j++ {
+				next = append(next, sats[j].cat(res.dsat).or(
+					sats[j-1].cat(res.sat),
+				))
+			}
+			next = append(next, sats[len(sats)-1].cat(res.sat))
+			sats = next
+		}
+
+		// Satisfying any number of the subexpressions other than k
+		// dissatisfies the expression, but only satisfying none of
+		// them isn't malleable.
+		dsat := invalidStack
+		for j, stack := range sats {
+			if j == int(n.k) {
+				continue
+			}
+			dsat = dsat.or(stack.withMalleable(j != 0))
+		}
+		return inputResult{dsat: dsat, sat: sats[n.k]}
+
+	case fragMulti:
+		// sats[j] is the best stack with j signatures for the keys
+		// processed so far.  All stacks start with an extra empty item
+		// that is consumed by the off-by-one bug of CHECKMULTISIG.
+		sats := []inputStack{zeroStack()}
+		for _, key := range n.keys {
+			sig, ok := satisfier.Sign(key)
+			sat := newStack(sig).withSig(ok)
+			next := []inputStack{sats[0]}
+			for j := 1; j < len(sats); j++ {
+				next = append(next, sats[j].or(sats[j-1].cat(sat)))
+			}
+			next = append(next, sats[len(sats)-1].cat(sat))
+			sats = next
+		}
+
+		dsat := zeroStack()
+		for i := uint32(0); i < n.k; i++ {
+			dsat = dsat.cat(zeroStack())
+		}
+		return inputResult{dsat: dsat, sat: sats[n.k]}
+
+	case fragWrapA, fragWrapS, fragWrapC, fragWrapN:
+		return subs[0]
+
+	case fragWrapD:
+		return inputResult{
+			dsat: zeroStack(),
+			sat:  subs[0].sat.cat(oneStack()),
+		}
+
+	case fragWrapV:
+		return inputResult{dsat: invalidStack, sat: subs[0].sat}
+
+	case fragWrapJ:
+		// Whether the subexpression has a dissatisfaction with a
+		// nonzero top stack item isn't tracked, so one that can be
+		// dissatisfied without a signature is assumed to have one,
+		// which would be an alternative dissatisfaction.
+		x := subs[0]
+		return inputResult{
+			dsat: zeroStack().withMalleable(
+				x.dsat.available && !x.dsat.hasSig,
+			),
+			sat: x.sat,
+		}
+	}
+
+	return inputResult{dsat: invalidStack, sat: invalidStack}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"crypto/sha256"
+
+	"github.com/babylonchain-io/bbld/txscript"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// hash160 returns the RIPEMD160 hash of the SHA256 hash of the passed data.
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// verifyOps maps the opcodes that have a verify form to that form.
+var verifyOps = map[byte]byte{
+	txscript.OP_EQUAL:         txscript.OP_EQUALVERIFY,
+	txscript.OP_CHECKSIG:      txscript.OP_CHECKSIGVERIFY,
+	txscript.OP_CHECKMULTISIG: txscript.OP_CHECKMULTISIGVERIFY,
+}
+
+// hashOpcodes maps the hash fragments to the opcode computing their hash.
+var hashOpcodes = map[fragment]byte{
+	fragSha256:    txscript.OP_SHA256,
+	fragHash256:   txscript.OP_HASH256,
+	fragRipemd160: txscript.OP_RIPEMD160,
+	fragHash160:   txscript.OP_HASH160,
+}
+
+// Script returns the witness script the miniscript compiles to.
+func (m *Miniscript) Script() ([]byte, error) {
+	builder := txscript.NewScriptBuilder()
+	m.root.compile(builder, false)
+	return builder.Script()
+}
+
+// compile adds the script of the node to the passed builder.  When verify is
+// set, the last opcode of the script is replaced by its verify form, which
+// is only requested for nodes that don't have the x property.
+func (n *node) compile(b *txscript.ScriptBuilder, verify bool) {
+	// last adds the last opcode of the script.
+	last := func(op byte) {
+		if verify {
+			op = verifyOps[op]
+		}
+		b.AddOp(op)
+	}
+
+	switch n.frag {
+	case fragZero:
+		b.AddOp(txscript.OP_0)
+
+	case fragOne:
+		b.AddOp(txscript.OP_1)
+
+	case fragPkK:
+		b.AddData(n.keys[0])
+
+	case fragPkH:
+		b.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160)
+		b.AddData(hash160(n.keys[0])).AddOp(txscript.OP_EQUALVERIFY)
+
+	case fragOlder:
+		b.AddInt64(int64(n.k)).AddOp(txscript.OP_CHECKSEQUENCEVERIFY)
+
+	case fragAfter:
+		b.AddInt64(int64(n.k)).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY)
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		b.AddOp(txscript.OP_SIZE).AddInt64(preimageSize)
+		b.AddOp(txscript.OP_EQUALVERIFY).AddOp(hashOpcodes[n.frag])
+		b.AddData(n.data)
+		last(txscript.OP_EQUAL)
+
+	case fragAndOr:
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_NOTIF)
+		n.subs[2].compile(b, false)
+		b.AddOp(txscript.OP_ELSE)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragAndV:
+		n.subs[0].compile(b, false)
+		n.subs[1].compile(b, verify)
+
+	case fragAndB:
+		n.subs[0].compile(b, false)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_BOOLAND)
+
+	case fragOrB:
+		n.subs[0].compile(b, false)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_BOOLOR)
+
+	case fragOrC:
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_NOTIF)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragOrD:
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_IFDUP).AddOp(txscript.OP_NOTIF)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragOrI:
+		b.AddOp(txscript.OP_IF)
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_ELSE)
+		n.subs[1].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragThresh:
+		for i, sub := range n.subs {
+			sub.compile(b, false)
+			if i > 0 {
+				b.AddOp(txscript.OP_ADD)
+			}
+		}
+		b.AddInt64(int64(n.k))
+		last(txscript.OP_EQUAL)
+
+	case fragMulti:
+		b.AddInt64(int64(n.k))
+		for _, key := range n.keys {
+			b.AddData(key)
+		}
+		b.AddInt64(int64(len(n.keys)))
+		last(txscript.OP_CHECKMULTISIG)
+
+	case fragWrapA:
+		b.AddOp(txscript.OP_TOALTSTACK)
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_FROMALTSTACK)
+
+	case fragWrapS:
+		b.AddOp(txscript.OP_SWAP)
+		n.subs[0].compile(b, verify)
+
+	case fragWrapC:
+		n.subs[0].compile(b, false)
+		last(txscript.OP_CHECKSIG)
+
+	case fragWrapD:
+		b.AddOp(txscript.OP_DUP).AddOp(txscript.OP_IF)
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragWrapV:
+		// Expressions without the x property end in an opcode with a
+		// verify form, which is used instead of a separate VERIFY.
+		sub := n.subs[0]
+		if !sub.typ.Has(TypeX) {
+			sub.compile(b, true)
+			break
+		}
+		sub.compile(b, false)
+		b.AddOp(txscript.OP_VERIFY)
+
+	case fragWrapJ:
+		b.AddOp(txscript.OP_SIZE).AddOp(txscript.OP_0NOTEQUAL)
+		b.AddOp(txscript.OP_IF)
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_ENDIF)
+
+	case fragWrapN:
+		n.subs[0].compile(b, false)
+		b.AddOp(txscript.OP_0NOTEQUAL)
+	}
+}
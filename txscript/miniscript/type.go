@@ -0,0 +1,382 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miniscript
+
+import (
+	"github.com/babylonchain-io/bbld/txscript"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// Type is the type of a miniscript expression, which consists of exactly one
+// of the basic types along with any number of properties that describe how it
+// is satisfied and dissatisfied.
+type Type uint32
+
+const (
+	// TypeB is the base type.  Expressions of this type consume their
+	// inputs from the top of the stack and push a nonzero value when
+	// satisfied, or an exact zero when dissatisfied.
+	TypeB Type = 1 << iota
+
+	// TypeV is the verify type.  Expressions of this type consume their
+	// inputs from the top of the stack and either continue without pushing
+	// anything or abort execution.
+	TypeV
+
+	// TypeK is the key type.  Expressions of this type consume their
+	// inputs from the top of the stack and push a public key for which a
+	// signature is checked to satisfy the expression.
+	TypeK
+
+	// TypeW is the wrapped type.  Expressions of this type consume their
+	// inputs from below the top of the stack and behave like a B
+	// expression with the top element left in place.
+	TypeW
+
+	// TypeZ (zero-arg) marks expressions that always consume exactly zero
+	// stack elements.
+	TypeZ
+
+	// TypeO (one-arg) marks expressions that always consume exactly one
+	// stack element.
+	TypeO
+
+	// TypeN (nonzero) marks expressions whose satisfactions never need a
+	// zero top stack element.
+	TypeN
+
+	// TypeD (dissatisfiable) marks expressions with a dissatisfaction that
+	// doesn't require a signature.
+	TypeD
+
+	// TypeU (unit) marks expressions that push exactly 1 when satisfied.
+	TypeU
+
+	// TypeE (expressive) marks expressions with a unique dissatisfaction
+	// that doesn't need a signature, while every other dissatisfaction
+	// does.
+	TypeE
+
+	// TypeF (forced) marks expressions that can't be dissatisfied.
+	TypeF
+
+	// TypeS (safe) marks expressions whose every satisfaction requires a
+	// signature.
+	TypeS
+
+	// TypeM (non-malleable) marks expressions for which a non-malleable
+	// satisfaction exists.
+	TypeM
+
+	// TypeX (expensive verify) marks expressions whose last opcode isn't
+	// EQUAL, CHECKSIG or CHECKMULTISIG, so the v: wrapper has to add an
+	// extra VERIFY opcode rather than using the verify form of the last
+	// opcode.
+	TypeX
+
+	// TypeG marks expressions containing a relative time timelock.
+	TypeG
+
+	// TypeH marks expressions containing a relative height timelock.
+	TypeH
+
+	// TypeI marks expressions containing an absolute time timelock.
+	TypeI
+
+	// TypeJ marks expressions containing an absolute height timelock.
+	TypeJ
+
+	// TypeNoTimelockMix, written as k, marks expressions that don't
+	// combine a height and a time timelock of the same kind in a single
+	// spending path.
+	TypeNoTimelockMix
+)
+
+// basicTypes is the set of basic types, exactly one of which is set on a
+// valid expression.
+const basicTypes = TypeB | TypeV | TypeK | TypeW
+
+// typeLetters are the letters the types and properties are written as, in
+// the order of their bits.
+const typeLetters = "BVKWzonduefsmxghijk"
+
+// Has returns whether the type includes all of the passed types and
+// properties.
+func (t Type) Has(props Type) bool {
+	return t&props == props
+}
+
+// String returns the type as the letters of its basic type and properties, such
+// as "Bdu" for a dissatisfiable unit B expression.
+func (t Type) String() string {
+	letters := make([]byte, 0, len(typeLetters))
+	for i := 0; i < len(typeLetters); i++ {
+		if t&(1<<uint(i)) != 0 {
+			letters = append(letters, typeLetters[i])
+		}
+	}
+	return string(letters)
+}
+
+// typeIf returns the passed type when cond is set and no type otherwise.
+func typeIf(cond bool, t Type) Type {
+	if cond {
+		return t
+	}
+	return 0
+}
+
+// timelocksMixed returns whether the timelocks of the two passed types
+// combine a height and a time timelock of the same kind.
+func timelocksMixed(x, y Type) bool {
+	return (x.Has(TypeG) && y.Has(TypeH)) ||
+		(x.Has(TypeH) && y.Has(TypeG)) ||
+		(x.Has(TypeI) && y.Has(TypeJ)) ||
+		(x.Has(TypeJ) && y.Has(TypeI))
+}
+
+// computeType returns the type of the passed node from the types of its
+// subexpressions, or no type when the subexpressions don't have the types
+// the fragment requires.
+func computeType(n *node) Type {
+	const timelocks = TypeG | TypeH | TypeI | TypeJ
+
+	var x, y, z Type
+	switch len(n.subs) {
+	case 3:
+		z = n.subs[2].typ
+		fallthrough
+	case 2:
+		y = n.subs[1].typ
+		fallthrough
+	case 1:
+		x = n.subs[0].typ
+	}
+
+	var t Type
+	switch n.frag {
+	case fragZero:
+		t = TypeB | TypeZ | TypeU | TypeD | TypeE | TypeM | TypeS |
+			TypeX | TypeNoTimelockMix
+
+	case fragOne:
+		t = TypeB | TypeZ | TypeU | TypeF | TypeM | TypeX |
+			TypeNoTimelockMix
+
+	case fragPkK:
+		t = TypeK | TypeO | TypeN | TypeU | TypeD | TypeE | TypeM |
+			TypeS | TypeX | TypeNoTimelockMix
+
+	case fragPkH:
+		t = TypeK | TypeN | TypeU | TypeD | TypeE | TypeM | TypeS |
+			TypeX | TypeNoTimelockMix
+
+	case fragOlder:
+		t = TypeB | TypeZ | TypeF | TypeM | TypeX | TypeNoTimelockMix
+		if n.k&wire.SequenceLockTimeIsSeconds != 0 {
+			t |= TypeG
+		} else {
+			t |= TypeH
+		}
+
+	case fragAfter:
+		t = TypeB | TypeZ | TypeF | TypeM | TypeX | TypeNoTimelockMix
+		if n.k >= txscript.LockTimeThreshold {
+			t |= TypeI
+		} else {
+			t |= TypeJ
+		}
+
+	case fragSha256, fragHash256, fragRipemd160, fragHash160:
+		t = TypeB | TypeO | TypeN | TypeU | TypeD | TypeM |
+			TypeNoTimelockMix
+
+	case fragWrapA:
+		t = typeIf(x.Has(TypeB), TypeW) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeU|TypeD|TypeF|TypeE|TypeM|TypeS) |
+			TypeX
+
+	case fragWrapS:
+		t = typeIf(x.Has(TypeB|TypeO), TypeW) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeU|TypeD|TypeF|TypeE|TypeM|TypeS|TypeX)
+
+	case fragWrapC:
+		t = typeIf(x.Has(TypeK), TypeB) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeO|TypeN|TypeD|TypeF|TypeE|TypeM) |
+			TypeU | TypeS
+
+	case fragWrapD:
+		// The d: wrapper isn't unit in witness v0 scripts, since the
+		// requirement for the argument of IF to be exactly 0 or 1 is
+		// only a policy rule there.
+		t = typeIf(x.Has(TypeV|TypeZ), TypeB) |
+			typeIf(x.Has(TypeZ), TypeO) |
+			typeIf(x.Has(TypeF), TypeE) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeM|TypeS) |
+			TypeN | TypeD | TypeX
+
+	case fragWrapV:
+		t = typeIf(x.Has(TypeB), TypeV) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeZ|TypeO|TypeN|TypeM|TypeS) |
+			TypeF | TypeX
+
+	case fragWrapJ:
+		t = typeIf(x.Has(TypeB|TypeN), TypeB) |
+			typeIf(x.Has(TypeF), TypeE) |
+			x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeO|TypeU|TypeM|TypeS) |
+			TypeN | TypeD | TypeX
+
+	case fragWrapN:
+		t = x&(timelocks|TypeNoTimelockMix) |
+			x&(TypeB|TypeZ|TypeO|TypeN|TypeD|TypeF|TypeE|TypeM|TypeS) |
+			TypeU | TypeX
+
+	case fragAndV:
+		t = typeIf(x.Has(TypeV), y&(TypeK|TypeV|TypeB)) |
+			x&TypeN | typeIf(x.Has(TypeZ), y&TypeN) |
+			typeIf((x|y).Has(TypeZ), (x|y)&TypeO) |
+			x&y&(TypeD|TypeM|TypeZ) |
+			(x|y)&TypeS |
+			typeIf(y.Has(TypeF) || x.Has(TypeS), TypeF) |
+			y&(TypeU|TypeX) |
+			(x|y)&timelocks |
+			typeIf(x.Has(TypeNoTimelockMix) &&
+				y.Has(TypeNoTimelockMix) &&
+				!timelocksMixed(x, y), TypeNoTimelockMix)
+
+	case fragAndB:
+		t = typeIf(y.Has(TypeW), x&TypeB) |
+			typeIf((x|y).Has(TypeZ), (x|y)&TypeO) |
+			x&TypeN | typeIf(x.Has(TypeZ), y&TypeN) |
+			typeIf((x&y).Has(TypeS), x&y&TypeE) |
+			x&y&(TypeD|TypeZ|TypeM) |
+			typeIf((x&y).Has(TypeF) || x.Has(TypeS|TypeF) ||
+				y.Has(TypeS|TypeF), TypeF) |
+			(x|y)&TypeS |
+			TypeU | TypeX |
+			(x|y)&timelocks |
+			typeIf(x.Has(TypeNoTimelockMix) &&
+				y.Has(TypeNoTimelockMix) &&
+				!timelocksMixed(x, y), TypeNoTimelockMix)
+
+	case fragOrB:
+		t = typeIf(x.Has(TypeB|TypeD) && y.Has(TypeW|TypeD), TypeB) |
+			typeIf((x|y).Has(TypeZ), (x|y)&TypeO) |
+			typeIf((x|y).Has(TypeS) && (x&y).Has(TypeE),
+				x&y&TypeM) |
+			x&y&(TypeZ|TypeS|TypeE) |
+			TypeD | TypeU | TypeX |
+			(x|y)&timelocks |
+			x&y&TypeNoTimelockMix
+
+	case fragOrD:
+		t = typeIf(x.Has(TypeB|TypeD|TypeU), y&TypeB) |
+			typeIf(y.Has(TypeZ), x&TypeO) |
+			typeIf(x.Has(TypeE) && (x|y).Has(TypeS), x&y&TypeM) |
+			x&y&(TypeZ|TypeE|TypeS) |
+			y&(TypeU|TypeF|TypeD) |
+			TypeX |
+			(x|y)&timelocks |
+			x&y&TypeNoTimelockMix
+
+	case fragOrC:
+		t = typeIf(x.Has(TypeB|TypeD|TypeU), y&TypeV) |
+			typeIf(y.Has(TypeZ), x&TypeO) |
+			typeIf(x.Has(TypeE) && (x|y).Has(TypeS), x&y&TypeM) |
+			x&y&(TypeZ|TypeS) |
+			TypeF | TypeX |
+			(x|y)&timelocks |
+			x&y&TypeNoTimelockMix
+
+	case fragOrI:
+		t = x&y&(TypeV|TypeB|TypeK|TypeU|TypeF|TypeS) |
+			typeIf((x&y).Has(TypeZ), TypeO) |
+			typeIf((x|y).Has(TypeF), (x|y)&TypeE) |
+			typeIf((x|y).Has(TypeS), x&y&TypeM) |
+			(x|y)&TypeD |
+			TypeX |
+			(x|y)&timelocks |
+			x&y&TypeNoTimelockMix
+
+	case fragAndOr:
+		t = typeIf(x.Has(TypeB|TypeD|TypeU), y&z&(TypeB|TypeK|TypeV)) |
+			x&y&z&TypeZ |
+			typeIf((x|(y&z)).Has(TypeZ), (x|(y&z))&TypeO) |
+			y&z&TypeU |
+			typeIf(x.Has(TypeS) || y.Has(TypeF), z&(TypeF|TypeE)) |
+			z&TypeD |
+			typeIf(x.Has(TypeE) && (x|y|z).Has(TypeS), x&y&z&TypeM) |
+			z&(x|y)&TypeS |
+			TypeX |
+			(x|y|z)&timelocks |
+			typeIf((x&y&z).Has(TypeNoTimelockMix) &&
+				!timelocksMixed(x, y), TypeNoTimelockMix)
+
+	case fragMulti:
+		t = TypeB | TypeN | TypeU | TypeD | TypeE | TypeM | TypeS |
+			TypeNoTimelockMix
+
+	case fragThresh:
+		allE, allM := true, true
+		var args, numS int
+		acc := TypeNoTimelockMix
+		for i, sub := range n.subs {
+			st := sub.typ
+			required := TypeW | TypeD | TypeU
+			if i == 0 {
+				required = TypeB | TypeD | TypeU
+			}
+			if !st.Has(required) {
+				return 0
+			}
+			if !st.Has(TypeE) {
+				allE = false
+			}
+			if !st.Has(TypeM) {
+				allM = false
+			}
+			if st.Has(TypeS) {
+				numS++
+			}
+			switch {
+			case st.Has(TypeZ):
+			case st.Has(TypeO):
+				args++
+			default:
+				args += 2
+			}
+
+			// A threshold above one mixes timelocks when two of the
+			// subexpressions use different kinds of the same
+			// timelock.
+			acc = (acc|st)&timelocks |
+				typeIf((acc&st).Has(TypeNoTimelockMix) &&
+					(n.k <= 1 || !timelocksMixed(acc, st)),
+					TypeNoTimelockMix)
+		}
+
+		numSubs, k := len(n.subs), int(n.k)
+		t = TypeB | TypeD | TypeU |
+			typeIf(args == 0, TypeZ) |
+			typeIf(args == 1, TypeO) |
+			typeIf(allE && numS == numSubs, TypeE) |
+			typeIf(allE && allM && numS >= numSubs-k, TypeM) |
+			typeIf(numS >= numSubs-k+1, TypeS) |
+			acc
+	}
+
+	// Valid expressions have exactly one basic type.
+	switch t & basicTypes {
+	case TypeB, TypeV, TypeK, TypeW:
+		return t
+	}
+	return 0
+}
@@ -226,7 +226,7 @@ const (
 	OP_NOP8                = 0xb7 // 183
 	OP_NOP9                = 0xb8 // 184
 	OP_NOP10               = 0xb9 // 185
-	OP_UNKNOWN186          = 0xba // 186
+	OP_CHECKSIGADD         = 0xba // 186
 	OP_UNKNOWN187          = 0xbb // 187
 	OP_UNKNOWN188          = 0xbc // 188
 	OP_UNKNOWN189          = 0xbd // 189
@@ -512,7 +512,7 @@ var opcodeArray = [256]opcode{
 	OP_NOP10: {OP_NOP10, "OP_NOP10", 1, opcodeNop},
 
 	// Undefined opcodes.
-	OP_UNKNOWN186: {OP_UNKNOWN186, "OP_UNKNOWN186", 1, opcodeInvalid},
+	OP_CHECKSIGADD: {OP_CHECKSIGADD, "OP_CHECKSIGADD", 1, opcodeCheckSigAdd},
 	OP_UNKNOWN187: {OP_UNKNOWN187, "OP_UNKNOWN187", 1, opcodeInvalid},
 	OP_UNKNOWN188: {OP_UNKNOWN188, "OP_UNKNOWN188", 1, opcodeInvalid},
 	OP_UNKNOWN189: {OP_UNKNOWN189, "OP_UNKNOWN189", 1, opcodeInvalid},
@@ -742,18 +742,21 @@ func opcodeNop(op *opcode, data []byte, vm *Engine) error {
 // of nuisance malleability, post-segwit for version 0 witness programs, we now
 // require the following: for OP_IF and OP_NOT_IF, the top stack item MUST
 // either be an empty byte slice, or [0x01]. Otherwise, the item at the top of
-// the stack will be popped and interpreted as a boolean.
+// the stack will be popped and interpreted as a boolean.  The same policy is a
+// consensus rule within tapscript, so it is always enforced there.
 func popIfBool(vm *Engine) (bool, error) {
-	// When not in witness execution mode, not executing a v0 witness
-	// program, or the minimal if flag isn't set pop the top stack item as
-	// a normal bool.
-	if !vm.isWitnessVersionActive(0) || !vm.hasFlag(ScriptVerifyMinimalIf) {
+	// When not executing a tapscript, and either not executing a v0
+	// witness program or the minimal if flag isn't set, pop the top stack
+	// item as a normal bool.
+	minimalIf := vm.taprootCtx != nil ||
+		(vm.isWitnessVersionActive(0) && vm.hasFlag(ScriptVerifyMinimalIf))
+	if !minimalIf {
 		return vm.dstack.PopBool()
 	}
 
-	// At this point, a v0 witness program is being executed and the minimal
-	// if flag is set, so enforce additional constraints on the top stack
-	// item.
+	// At this point, either a v0 witness program is being executed with
+	// the minimal if flag set, or a tapscript is being executed, so
+	// enforce additional constraints on the top stack item.
 	so, err := vm.dstack.PopByteArray()
 	if err != nil {
 		return false, err
@@ -1839,11 +1842,16 @@ func opcodeHash256(op *opcode, data []byte, vm *Engine) error {
 }
 
 // opcodeCodeSeparator stores the current script offset as the most recently
-// seen OP_CODESEPARATOR which is used during signature checking.
+// seen OP_CODESEPARATOR which is used during signature checking.  Within
+// tapscript, the signature hash instead commits to the opcode position of the
+// most recently executed OP_CODESEPARATOR.
 //
 // This opcode does not change the contents of the data stack.
 func opcodeCodeSeparator(op *opcode, data []byte, vm *Engine) error {
 	vm.lastCodeSep = int(vm.tokenizer.ByteIndex())
+	if vm.taprootCtx != nil {
+		vm.taprootCtx.codeSepPos = uint32(vm.opcodeIdx)
+	}
 	return nil
 }
 
@@ -1860,6 +1868,10 @@ func opcodeCodeSeparator(op *opcode, data []byte, vm *Engine) error {
 // "script hash" is calculated, the signature is checked using standard
 // cryptographic methods against the provided public key.
 //
+// Within tapscript, the signature is instead a BIP0340 signature that is
+// checked against a BIP0341 signature hash.  See checkTapscriptSig for
+// details.
+//
 // Stack transformation: [... signature pubkey] -> [... bool]
 func opcodeCheckSig(op *opcode, data []byte, vm *Engine) error {
 	pkBytes, err := vm.dstack.PopByteArray()
@@ -1872,6 +1884,16 @@ func opcodeCheckSig(op *opcode, data []byte, vm *Engine) error {
 		return err
 	}
 
+	if vm.taprootCtx != nil {
+		valid, err := vm.checkTapscriptSig(fullSigBytes, pkBytes)
+		if err != nil {
+			return err
+		}
+
+		vm.dstack.PushBool(valid)
+		return nil
+	}
+
 	// The signature actually needs needs to be longer than this, but at
 	// least 1 byte is needed for the hash type below.  The full length is
 	// checked depending on the script flags and upon parsing the signature.
@@ -1914,7 +1936,7 @@ func opcodeCheckSig(op *opcode, data []byte, vm *Engine) error {
 		if vm.hashCache != nil {
 			sigHashes = vm.hashCache
 		} else {
-			sigHashes = NewTxSigHashes(&vm.tx)
+			sigHashes = NewTxSigHashes(&vm.tx, vm.prevOutFetcher)
 		}
 
 		hash, err = calcWitnessSignatureHashRaw(subScript, sigHashes, hashType,
@@ -1985,6 +2007,101 @@ func opcodeCheckSigVerify(op *opcode, data []byte, vm *Engine) error {
 	return err
 }
 
+// checkTapscriptSig performs a signature check within tapscript as defined by
+// BIP0342 and returns whether the signature is valid.  Every non-empty
+// signature consumes a portion of the sig op budget of the tapscript.  An
+// empty signature is simply treated as a failed check, while any non-empty
+// signature that fails to verify results in a script error.  Public keys that
+// aren't 32 bytes are reserved for future soft forks, so any non-empty
+// signature is treated as valid for them.
+func (vm *Engine) checkTapscriptSig(sigBytes, pkBytes []byte) (bool, error) {
+	if len(sigBytes) != 0 {
+		if err := vm.taprootCtx.tallysigOp(); err != nil {
+			return false, err
+		}
+	}
+
+	switch len(pkBytes) {
+	case 0:
+		return false, scriptError(ErrTaprootPubkeyIsEmpty,
+			"tapscript public key is empty")
+
+	case payToTaprootDataSize:
+		if len(sigBytes) == 0 {
+			return false, nil
+		}
+
+		err := vm.verifyTaprootSig(sigBytes, pkBytes,
+			WithBaseTapscriptVersion(
+				vm.taprootCtx.codeSepPos,
+				vm.taprootCtx.tapLeafHash[:],
+			),
+		)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+
+	default:
+		if vm.hasFlag(ScriptVerifyDiscourageUpgradeablePubkeyType) {
+			str := fmt.Sprintf("tapscript public key of %d bytes "+
+				"is reserved for soft-fork upgrades", len(pkBytes))
+			return false, scriptError(
+				ErrDiscourageUpgradeablePubKeyType, str,
+			)
+		}
+
+		return len(sigBytes) != 0, nil
+	}
+}
+
+// opcodeCheckSigAdd treats the top 3 items on the stack as a public key, an
+// integer, and a signature.  The items are replaced with the integer
+// incremented by one if the signature was successfully verified, or the
+// integer unchanged if the signature is empty.  It is only valid within
+// tapscript, where it replaces OP_CHECKMULTISIG, and the signature is checked
+// in the same way as OP_CHECKSIG within tapscript.
+//
+// Stack transformation: [... signature n pubkey] -> [... n+success]
+func opcodeCheckSigAdd(op *opcode, data []byte, vm *Engine) error {
+	// The opcode is an unknown opcode outside of tapscript.
+	if vm.taprootCtx == nil {
+		return opcodeInvalid(op, data, vm)
+	}
+
+	if vm.dstack.Depth() < 3 {
+		str := fmt.Sprintf("attempt to read from stack with %d items "+
+			"when %d are required", vm.dstack.Depth(), 3)
+		return scriptError(ErrInvalidStackOperation, str)
+	}
+
+	pkBytes, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+
+	n, err := vm.dstack.PopInt()
+	if err != nil {
+		return err
+	}
+
+	sigBytes, err := vm.dstack.PopByteArray()
+	if err != nil {
+		return err
+	}
+
+	valid, err := vm.checkTapscriptSig(sigBytes, pkBytes)
+	if err != nil {
+		return err
+	}
+
+	if valid {
+		n++
+	}
+	vm.dstack.PushInt(n)
+	return nil
+}
+
 // parsedSigInfo houses a raw signature along with its parsed form and a flag
 // for whether or not it has already been parsed.  It is used to prevent parsing
 // the same signature multiple times when verifying a multisig.
@@ -2014,6 +2131,14 @@ type parsedSigInfo struct {
 // Stack transformation:
 // [... dummy [sig ...] numsigs [pubkey ...] numpubkeys] -> [... bool]
 func opcodeCheckMultiSig(op *opcode, data []byte, vm *Engine) error {
+	// OP_CHECKMULTISIG and OP_CHECKMULTISIGVERIFY are disabled within
+	// tapscript in favor of OP_CHECKSIGADD.
+	if vm.taprootCtx != nil {
+		str := fmt.Sprintf("attempt to execute %s within tapscript",
+			op.name)
+		return scriptError(ErrTapscriptCheckMultisig, str)
+	}
+
 	numKeys, err := vm.dstack.PopInt()
 	if err != nil {
 		return err
@@ -2185,7 +2310,7 @@ func opcodeCheckMultiSig(op *opcode, data []byte, vm *Engine) error {
 			if vm.hashCache != nil {
 				sigHashes = vm.hashCache
 			} else {
-				sigHashes = NewTxSigHashes(&vm.tx)
+				sigHashes = NewTxSigHashes(&vm.tx, vm.prevOutFetcher)
 			}
 
 			hash, err = calcWitnessSignatureHashRaw(script, sigHashes, hashType,
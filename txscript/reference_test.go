@@ -6,16 +6,22 @@ package txscript
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
 	"github.com/babylonchain-io/bbld/btcutil"
+	"github.com/babylonchain-io/bbld/chaincfg"
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 	"github.com/babylonchain-io/bbld/wire"
 )
@@ -192,6 +198,14 @@ func parseScriptFlags(flagStr string) (ScriptFlags, error) {
 			flags |= ScriptVerifyMinimalIf
 		case "WITNESS_PUBKEYTYPE":
 			flags |= ScriptVerifyWitnessPubKeyType
+		case "TAPROOT":
+			flags |= ScriptVerifyTaproot
+		case "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION":
+			flags |= ScriptVerifyDiscourageUpgradeableTaprootVersion
+		case "DISCOURAGE_OP_SUCCESS":
+			flags |= ScriptVerifyDiscourageOpSuccess
+		case "DISCOURAGE_UPGRADABLE_PUBKEYTYPE":
+			flags |= ScriptVerifyDiscourageUpgradeablePubkeyType
 		default:
 			return flags, fmt.Errorf("invalid flag: %s", flag)
 		}
@@ -285,6 +299,27 @@ func parseExpectedResult(expected string) ([]ErrorCode, error) {
 		return []ErrorCode{ErrWitnessUnexpected}, nil
 	case "WITNESS_PUBKEYTYPE":
 		return []ErrorCode{ErrWitnessPubKeyType}, nil
+	case "SCHNORR_SIG_SIZE":
+		return []ErrorCode{ErrInvalidTaprootSigLen}, nil
+	case "SCHNORR_SIG_HASHTYPE":
+		return []ErrorCode{ErrInvalidSigHashType}, nil
+	case "SCHNORR_SIG":
+		return []ErrorCode{ErrTaprootSigInvalid}, nil
+	case "TAPROOT_WRONG_CONTROL_SIZE":
+		return []ErrorCode{ErrControlBlockTooSmall,
+			ErrControlBlockTooLarge, ErrControlBlockInvalidLength}, nil
+	case "TAPSCRIPT_VALIDATION_WEIGHT":
+		return []ErrorCode{ErrTaprootMaxSigOps}, nil
+	case "TAPSCRIPT_CHECKMULTISIG":
+		return []ErrorCode{ErrTapscriptCheckMultisig}, nil
+	case "TAPSCRIPT_MINIMALIF":
+		return []ErrorCode{ErrMinimalIf}, nil
+	case "DISCOURAGE_OP_SUCCESS":
+		return []ErrorCode{ErrDiscourageOpSuccess}, nil
+	case "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION":
+		return []ErrorCode{ErrDiscourageUpgradeableTaprootVersion}, nil
+	case "DISCOURAGE_UPGRADABLE_PUBKEYTYPE":
+		return []ErrorCode{ErrDiscourageUpgradeablePubKeyType}, nil
 	}
 
 	return nil, fmt.Errorf("unrecognized expected result in test data: %v",
@@ -443,8 +478,9 @@ func testScripts(t *testing.T, tests [][]interface{}, useSigCache bool) {
 		// used, then create a new engine to execute the scripts.
 		tx := createSpendingTx(witness, scriptSig, scriptPubKey,
 			int64(inputAmt))
+		prevOuts := NewCannedPrevOutputFetcher(scriptPubKey, int64(inputAmt))
 		vm, err := NewEngine(scriptPubKey, tx, 0, flags, sigCache, nil,
-			int64(inputAmt))
+			int64(inputAmt), prevOuts)
 		if err == nil {
 			err = vm.Execute()
 		}
@@ -575,6 +611,7 @@ testloop:
 		}
 
 		prevOuts := make(map[wire.OutPoint]scriptWithInputVal)
+		prevOutFetcher := NewMultiPrevOutFetcher(nil)
 		for j, iinput := range inputs {
 			input, ok := iinput.([]interface{})
 			if !ok {
@@ -640,6 +677,8 @@ testloop:
 				pkScript: script,
 			}
 			prevOuts[*wire.NewOutPoint(prevhash, idx)] = v
+			prevOutFetcher.AddPrevOut(*wire.NewOutPoint(prevhash, idx),
+				&wire.TxOut{Value: v.inputVal, PkScript: v.pkScript})
 		}
 
 		for k, txin := range tx.MsgTx().TxIn {
@@ -653,7 +692,7 @@ testloop:
 			// input fails the transaction has failed. (some of the
 			// test txns have good inputs, too..
 			vm, err := NewEngine(prevOut.pkScript, tx.MsgTx(), k,
-				flags, nil, nil, prevOut.inputVal)
+				flags, nil, nil, prevOut.inputVal, prevOutFetcher)
 			if err != nil {
 				continue testloop
 			}
@@ -731,6 +770,7 @@ testloop:
 		}
 
 		prevOuts := make(map[wire.OutPoint]scriptWithInputVal)
+		prevOutFetcher := NewMultiPrevOutFetcher(nil)
 		for j, iinput := range inputs {
 			input, ok := iinput.([]interface{})
 			if !ok {
@@ -796,6 +836,8 @@ testloop:
 				pkScript: script,
 			}
 			prevOuts[*wire.NewOutPoint(prevhash, idx)] = v
+			prevOutFetcher.AddPrevOut(*wire.NewOutPoint(prevhash, idx),
+				&wire.TxOut{Value: v.inputVal, PkScript: v.pkScript})
 		}
 
 		for k, txin := range tx.MsgTx().TxIn {
@@ -806,7 +848,7 @@ testloop:
 				continue testloop
 			}
 			vm, err := NewEngine(prevOut.pkScript, tx.MsgTx(), k,
-				flags, nil, nil, prevOut.inputVal)
+				flags, nil, nil, prevOut.inputVal, prevOutFetcher)
 			if err != nil {
 				t.Errorf("test (%d:%v:%d) failed to create "+
 					"script: %v", i, test, k, err)
@@ -882,3 +924,555 @@ func TestCalcSignatureHash(t *testing.T) {
 		}
 	}
 }
+
+// parseTaprootTestTree parses a tapscript tree from the BIP 341 wallet test
+// vectors, which is either null, a single leaf or a pair of subtrees, and returns the merkle root of the passed tapscript tree
+// along with the leaves and their hashes in the order they appear in the tree.
+// A nil merkle root is returned for an empty tree.
+func parseTaprootTestTree(tree json.RawMessage) ([]byte, []TapLeaf,
+	[]chainhash.Hash, error) {
+
+	if len(tree) == 0 || string(tree) == "null" {
+		return nil, nil, nil, nil
+	}
+
+	// A pair of subtrees is hashed into a branch.
+	var branch []json.RawMessage
+	if err := json.Unmarshal(tree, &branch); err == nil {
+		if len(branch) != 2 {
+			return nil, nil, nil, fmt.Errorf("branch with %d "+
+				"children", len(branch))
+		}
+		left, leaves, leafHashes, err := parseTaprootTestTree(branch[0])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		right, rightLeaves, rightHashes, err := parseTaprootTestTree(
+			branch[1],
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		branchHash := TapBranchHash(left, right)
+		return branchHash[:], append(leaves, rightLeaves...),
+			append(leafHashes, rightHashes...), nil
+	}
+
+	var leaf struct {
+		Script      string `json:"script"`
+		LeafVersion uint8  `json:"leafVersion"`
+	}
+	if err := json.Unmarshal(tree, &leaf); err != nil {
+		return nil, nil, nil, err
+	}
+	script, err := hex.DecodeString(leaf.Script)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tapLeaf := NewTapLeaf(TapscriptLeafVersion(leaf.LeafVersion), script)
+	leafHash := tapLeaf.TapHash()
+	return leafHash[:], []TapLeaf{tapLeaf}, []chainhash.Hash{leafHash}, nil
+}
+
+// taprootTestVectors houses the BIP 341 wallet test vectors in
+// bip341_wallet_vectors.json.
+type taprootTestVectors struct {
+	ScriptPubKey []struct {
+		Given struct {
+			InternalPubkey string          `json:"internalPubkey"`
+			ScriptTree     json.RawMessage `json:"scriptTree"`
+		} `json:"given"`
+		Intermediary struct {
+			LeafHashes    []string `json:"leafHashes"`
+			MerkleRoot    *string  `json:"merkleRoot"`
+			Tweak         string   `json:"tweak"`
+			TweakedPubkey string   `json:"tweakedPubkey"`
+		} `json:"intermediary"`
+		Expected struct {
+			ScriptPubKey            string   `json:"scriptPubKey"`
+			Bip350Address           string   `json:"bip350Address"`
+			ScriptPathControlBlocks []string `json:"scriptPathControlBlocks"`
+		} `json:"expected"`
+	} `json:"scriptPubKey"`
+
+	KeyPathSpending []struct {
+		Given struct {
+			RawUnsignedTx string `json:"rawUnsignedTx"`
+			UtxosSpent    []struct {
+				ScriptPubKey string `json:"scriptPubKey"`
+				AmountSats   int64  `json:"amountSats"`
+			} `json:"utxosSpent"`
+		} `json:"given"`
+		Intermediary struct {
+			HashAmounts       string `json:"hashAmounts"`
+			HashOutputs       string `json:"hashOutputs"`
+			HashPrevouts      string `json:"hashPrevouts"`
+			HashScriptPubkeys string `json:"hashScriptPubkeys"`
+			HashSequences     string `json:"hashSequences"`
+		} `json:"intermediary"`
+		InputSpending []struct {
+			Given struct {
+				TxinIndex       int     `json:"txinIndex"`
+				InternalPrivkey string  `json:"internalPrivkey"`
+				MerkleRoot      *string `json:"merkleRoot"`
+				HashType        uint32  `json:"hashType"`
+			} `json:"given"`
+			Intermediary struct {
+				InternalPubkey string `json:"internalPubkey"`
+				Tweak          string `json:"tweak"`
+				TweakedPrivkey string `json:"tweakedPrivkey"`
+				SigHash        string `json:"sigHash"`
+			} `json:"intermediary"`
+			Expected struct {
+				Witness []string `json:"witness"`
+			} `json:"expected"`
+		} `json:"inputSpending"`
+	} `json:"keyPathSpending"`
+}
+
+// loadTaprootTestVectors loads the BIP 341 wallet test vectors.
+func loadTaprootTestVectors(t *testing.T) *taprootTestVectors {
+	t.Helper()
+
+	file, err := ioutil.ReadFile("data/bip341_wallet_vectors.json")
+	if err != nil {
+		t.Fatalf("unable to read test vectors: %v", err)
+	}
+	var vectors taprootTestVectors
+	if err := json.Unmarshal(file, &vectors); err != nil {
+		t.Fatalf("unable to parse test vectors: %v", err)
+	}
+	return &vectors
+}
+
+// hexOrNil decodes the passed optional hex string, returning nil when it's
+// absent.
+func hexOrNil(s *string) []byte {
+	if s == nil {
+		return nil
+	}
+	return hexToBytes(*s)
+}
+
+// TestTaprootScriptPubKeyVectors runs the BIP 341 wallet test vectors which
+// derive taproot outputs from an internal key and a tapscript tree.
+// https://github.com/bitcoin/bips/blob/master/bip-0341/wallet-test-vectors.json
+func TestTaprootScriptPubKeyVectors(t *testing.T) {
+	t.Parallel()
+
+	vectors := loadTaprootTestVectors(t)
+	for i, test := range vectors.ScriptPubKey {
+		merkleRoot, leaves, leafHashes, err := parseTaprootTestTree(
+			test.Given.ScriptTree,
+		)
+		if err != nil {
+			t.Errorf("test #%d: unable to parse script tree: %v", i,
+				err)
+			continue
+		}
+		wantMerkleRoot := hexOrNil(test.Intermediary.MerkleRoot)
+		if !bytes.Equal(merkleRoot, wantMerkleRoot) {
+			t.Errorf("test #%d: merkle root mismatch: got %x, want %x",
+				i, merkleRoot, wantMerkleRoot)
+			continue
+		}
+		for j, want := range test.Intermediary.LeafHashes {
+			if hex.EncodeToString(leafHashes[j][:]) != want {
+				t.Errorf("test #%d: leaf #%d hash mismatch: got "+
+					"%x, want %s", i, j, leafHashes[j][:], want)
+			}
+		}
+
+		internalKeyBytes := hexToBytes(test.Given.InternalPubkey)
+		internalKey, err := schnorr.ParsePubKey(internalKeyBytes)
+		if err != nil {
+			t.Errorf("test #%d: unable to parse internal key: %v", i,
+				err)
+			continue
+		}
+		tweak := chainhash.TaggedHash(
+			chainhash.TagTapTweak, internalKeyBytes, merkleRoot,
+		)
+		if hex.EncodeToString(tweak[:]) != test.Intermediary.Tweak {
+			t.Errorf("test #%d: tweak mismatch: got %x, want %s", i,
+				tweak[:], test.Intermediary.Tweak)
+		}
+
+		outputKey, err := ComputeTaprootOutputKey(internalKey, merkleRoot)
+		if err != nil {
+			t.Errorf("test #%d: unable to compute output key: %v", i,
+				err)
+			continue
+		}
+		outputKeyBytes := schnorr.SerializePubKey(outputKey)
+		gotOutputKey := hex.EncodeToString(outputKeyBytes)
+		if gotOutputKey != test.Intermediary.TweakedPubkey {
+			t.Errorf("test #%d: output key mismatch: got %s, want %s",
+				i, gotOutputKey, test.Intermediary.TweakedPubkey)
+			continue
+		}
+
+		pkScript, err := PayToTaprootScript(outputKey)
+		if err != nil {
+			t.Errorf("test #%d: unable to create script: %v", i, err)
+			continue
+		}
+		if hex.EncodeToString(pkScript) != test.Expected.ScriptPubKey {
+			t.Errorf("test #%d: script mismatch: got %x, want %s", i,
+				pkScript, test.Expected.ScriptPubKey)
+		}
+
+		if test.Expected.Bip350Address != "" {
+			addr, err := btcutil.NewAddressTaproot(outputKeyBytes,
+				&chaincfg.MainNetParams)
+			if err != nil {
+				t.Errorf("test #%d: unable to create address: %v",
+					i, err)
+				continue
+			}
+			if addr.EncodeAddress() != test.Expected.Bip350Address {
+				t.Errorf("test #%d: address mismatch: got %s, "+
+					"want %s", i, addr.EncodeAddress(),
+					test.Expected.Bip350Address)
+			}
+		}
+
+		// Each control block must prove its leaf is committed to by
+		// the output key.
+		for j, ctrlBlockHex := range test.Expected.ScriptPathControlBlocks {
+			ctrlBlock, err := ParseControlBlock(hexToBytes(ctrlBlockHex))
+			if err != nil {
+				t.Errorf("test #%d: unable to parse control block "+
+					"#%d: %v", i, j, err)
+				continue
+			}
+			if ctrlBlock.LeafVersion != leaves[j].LeafVersion {
+				t.Errorf("test #%d: control block #%d leaf version "+
+					"mismatch: got %x, want %x", i, j,
+					ctrlBlock.LeafVersion, leaves[j].LeafVersion)
+			}
+			err = VerifyTaprootLeafCommitment(
+				ctrlBlock, outputKeyBytes, leaves[j].Script,
+			)
+			if err != nil {
+				t.Errorf("test #%d: control block #%d does not "+
+					"commit to leaf: %v", i, j, err)
+			}
+		}
+	}
+}
+
+// TestTaprootKeyPathSpendingVectors runs the BIP 341 wallet test vectors which
+// compute the signature hashes and tweaked private keys used to sign key path
+// spends, and verifies the resulting signatures.
+// https://github.com/bitcoin/bips/blob/master/bip-0341/wallet-test-vectors.json
+func TestTaprootKeyPathSpendingVectors(t *testing.T) {
+	t.Parallel()
+
+	vectors := loadTaprootTestVectors(t)
+	for i, test := range vectors.KeyPathSpending {
+		// Transactions in this chain carry an additional optional
+		// proof of space commitment, so mark it as absent in order to
+		// parse the bitcoin transaction.
+		rawTx := append(hexToBytes(test.Given.RawUnsignedTx), 0x00)
+		var tx wire.MsgTx
+		if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+			t.Fatalf("test #%d: unable to parse transaction: %v", i,
+				err)
+		}
+		prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+		for j, utxo := range test.Given.UtxosSpent {
+			prevOuts[tx.TxIn[j].PreviousOutPoint] = wire.NewTxOut(
+				utxo.AmountSats, hexToBytes(utxo.ScriptPubKey),
+			)
+		}
+		prevOutFetcher := NewMultiPrevOutFetcher(prevOuts)
+		sigHashes := NewTxSigHashes(&tx, prevOutFetcher)
+
+		midstate := []struct {
+			name string
+			got  chainhash.Hash
+			want string
+		}{
+			{"hashAmounts", sigHashes.HashInputAmountsV1,
+				test.Intermediary.HashAmounts},
+			{"hashOutputs", sigHashes.HashOutputsV1,
+				test.Intermediary.HashOutputs},
+			{"hashPrevouts", sigHashes.HashPrevOutsV1,
+				test.Intermediary.HashPrevouts},
+			{"hashScriptPubkeys", sigHashes.HashInputScriptsV1,
+				test.Intermediary.HashScriptPubkeys},
+			{"hashSequences", sigHashes.HashSequenceV1,
+				test.Intermediary.HashSequences},
+		}
+		for _, hash := range midstate {
+			if hex.EncodeToString(hash.got[:]) != hash.want {
+				t.Errorf("test #%d: %s mismatch: got %x, want %s",
+					i, hash.name, hash.got[:], hash.want)
+			}
+		}
+
+		for _, input := range test.InputSpending {
+			idx := input.Given.TxinIndex
+			merkleRoot := hexOrNil(input.Given.MerkleRoot)
+			privKey, pubKey := btcec.PrivKeyFromBytes(
+				hexToBytes(input.Given.InternalPrivkey),
+			)
+			internalKeyBytes := schnorr.SerializePubKey(pubKey)
+			gotInternalKey := hex.EncodeToString(internalKeyBytes)
+			if gotInternalKey != input.Intermediary.InternalPubkey {
+				t.Errorf("test #%d input %d: internal key "+
+					"mismatch: got %s, want %s", i, idx,
+					gotInternalKey, input.Intermediary.InternalPubkey)
+			}
+			tweak := chainhash.TaggedHash(
+				chainhash.TagTapTweak, internalKeyBytes, merkleRoot,
+			)
+			if hex.EncodeToString(tweak[:]) != input.Intermediary.Tweak {
+				t.Errorf("test #%d input %d: tweak mismatch: got "+
+					"%x, want %s", i, idx, tweak[:],
+					input.Intermediary.Tweak)
+			}
+
+			tweakedPrivKey, err := TweakTaprootPrivKey(privKey,
+				merkleRoot)
+			if err != nil {
+				t.Errorf("test #%d input %d: unable to tweak "+
+					"private key: %v", i, idx, err)
+				continue
+			}
+			gotPrivKey := hex.EncodeToString(tweakedPrivKey.Serialize())
+			if gotPrivKey != input.Intermediary.TweakedPrivkey {
+				t.Errorf("test #%d input %d: tweaked private key "+
+					"mismatch: got %s, want %s", i, idx,
+					gotPrivKey, input.Intermediary.TweakedPrivkey)
+			}
+
+			hashType := SigHashType(input.Given.HashType)
+			sigHash, err := CalcTaprootSignatureHash(sigHashes,
+				hashType, &tx, idx, prevOutFetcher)
+			if err != nil {
+				t.Errorf("test #%d input %d: unable to compute "+
+					"sighash: %v", i, idx, err)
+				continue
+			}
+			if hex.EncodeToString(sigHash) != input.Intermediary.SigHash {
+				t.Errorf("test #%d input %d: sighash mismatch: "+
+					"got %x, want %s", i, idx, sigHash,
+					input.Intermediary.SigHash)
+				continue
+			}
+
+			// The expected signature, when given, must be valid for
+			// the output key and commit to the hash type unless
+			// it's the default one.
+			if len(input.Expected.Witness) == 0 {
+				continue
+			}
+			rawSig := hexToBytes(input.Expected.Witness[0])
+			wantSigLen := schnorr.SignatureSize
+			if hashType != SigHashDefault {
+				wantSigLen++
+			}
+			if len(rawSig) != wantSigLen || (wantSigLen >
+				schnorr.SignatureSize && rawSig[wantSigLen-1] !=
+				byte(hashType)) {
+
+				t.Errorf("test #%d input %d: malformed witness "+
+					"signature %x", i, idx, rawSig)
+				continue
+			}
+			sig, err := schnorr.ParseSignature(
+				rawSig[:schnorr.SignatureSize],
+			)
+			if err != nil {
+				t.Errorf("test #%d input %d: unable to parse "+
+					"signature: %v", i, idx, err)
+				continue
+			}
+			if !sig.Verify(sigHash, tweakedPrivKey.PubKey()) {
+				t.Errorf("test #%d input %d: invalid signature", i,
+					idx)
+			}
+		}
+	}
+}
+
+// taprootScriptAsset is a single test case of the script assets generated by
+// the taproot functional test of the reference implementation.  The input at
+// the index of the transaction must validate with the success witness and
+// must not validate with the failure witness when one is given.
+type taprootScriptAsset struct {
+	Tx       string               `json:"tx"`
+	Prevouts []string             `json:"prevouts"`
+	Index    int                  `json:"index"`
+	Flags    string               `json:"flags"`
+	Comment  string               `json:"comment"`
+	Success  *taprootAssetWitness `json:"success"`
+	Failure  *taprootAssetWitness `json:"failure"`
+}
+
+// taprootAssetWitness is the signature script and witness of the input of a
+// taproot script asset.
+type taprootAssetWitness struct {
+	ScriptSig string   `json:"scriptSig"`
+	Witness   []string `json:"witness"`
+}
+
+// parseScriptAssetPrevOut parses the passed hex encoded serialized transaction
+// output of a taproot script asset.
+func parseScriptAssetPrevOut(prevOutHex string) (*wire.TxOut, error) {
+	r := bytes.NewReader(hexToBytes(prevOutHex))
+	var value [8]byte
+	if _, err := io.ReadFull(r, value[:]); err != nil {
+		return nil, fmt.Errorf("unable to read prevout value: %v", err)
+	}
+	pkScript, err := wire.ReadVarBytes(r, 0, wire.MaxMessagePayload,
+		"pkScript")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read prevout script: %v", err)
+	}
+	amount := int64(binary.LittleEndian.Uint64(value[:]))
+	return wire.NewTxOut(amount, pkScript), nil
+}
+
+// isLegacyScriptAsset returns whether the input of the passed script asset
+// spends a legacy output, which is neither a witness program nor a pay to
+// script hash output redeemed by one.
+func isLegacyScriptAsset(test *taprootScriptAsset) (bool, error) {
+	prevOut, err := parseScriptAssetPrevOut(test.Prevouts[test.Index])
+	if err != nil {
+		return false, err
+	}
+	if IsWitnessProgram(prevOut.PkScript) {
+		return false, nil
+	}
+	if !IsPayToScriptHash(prevOut.PkScript) {
+		return true, nil
+	}
+	pushes, err := PushedData(hexToBytes(test.Success.ScriptSig))
+	if err != nil || len(pushes) == 0 {
+		return true, nil
+	}
+	return !IsWitnessProgram(pushes[len(pushes)-1]), nil
+}
+
+// executeTaprootScriptAsset runs the input of the passed script asset through
+// the script engine with the passed signature script and witness.
+func executeTaprootScriptAsset(test *taprootScriptAsset,
+	input *taprootAssetWitness) error {
+
+	// Transactions in this chain carry an additional optional proof of
+	// space commitment, so mark it as absent in order to parse the bitcoin
+	// transaction.
+	var msgTx wire.MsgTx
+	rawTx := append(hexToBytes(test.Tx), 0x00)
+	if err := msgTx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		return fmt.Errorf("unable to parse transaction: %v", err)
+	}
+	if len(test.Prevouts) != len(msgTx.TxIn) {
+		return fmt.Errorf("%d prevouts for %d inputs",
+			len(test.Prevouts), len(msgTx.TxIn))
+	}
+
+	// The prevouts are the outputs spent by the inputs in order.
+	prevOuts := NewMultiPrevOutFetcher(nil)
+	for i, prevOutHex := range test.Prevouts {
+		prevOut, err := parseScriptAssetPrevOut(prevOutHex)
+		if err != nil {
+			return err
+		}
+		prevOuts.AddPrevOut(msgTx.TxIn[i].PreviousOutPoint, prevOut)
+	}
+
+	flags, err := parseScriptFlags(test.Flags)
+	if err != nil {
+		return err
+	}
+
+	txIn := msgTx.TxIn[test.Index]
+	txIn.SignatureScript = hexToBytes(input.ScriptSig)
+	txIn.Witness = make(wire.TxWitness, 0, len(input.Witness))
+	for _, item := range input.Witness {
+		txIn.Witness = append(txIn.Witness, hexToBytes(item))
+	}
+
+	prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+	vm, err := NewEngine(prevOut.PkScript, &msgTx, test.Index, flags, nil,
+		NewTxSigHashes(&msgTx, prevOuts), prevOut.Value, prevOuts)
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+// TestTaprootScriptAssets runs the script assets generated by the taproot
+// functional test of the reference implementation, which cover the key and
+// script path spending rules of BIP 341 and the tapscript rules of BIP 342.
+// https://github.com/bitcoin/bitcoin/blob/master/test/functional/feature_taproot.py
+func TestTaprootScriptAssets(t *testing.T) {
+	t.Parallel()
+
+	paths, err := filepath.Glob(filepath.Join("data", "taproot-ref", "*"))
+	if err != nil {
+		t.Fatalf("unable to list script assets: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no script assets found")
+	}
+
+	var numLegacy int
+	for _, path := range paths {
+		file, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unable to read script asset: %v", err)
+		}
+
+		// Each file holds an entry of the JSON array of the reference
+		// implementation including its trailing comma.
+		file = bytes.TrimRight(file, ",\n")
+		var test taprootScriptAsset
+		if err := json.Unmarshal(file, &test); err != nil {
+			t.Fatalf("unable to parse script asset %s: %v", path, err)
+		}
+
+		name := fmt.Sprintf("%s (%s)", filepath.Base(path), test.Comment)
+		if test.Success == nil {
+			t.Errorf("%s: no success witness", name)
+			continue
+		}
+
+		// The legacy signature hash commits to the serialized
+		// transaction, which in this chain includes the proof of space
+		// commitment marker, so the legacy signatures of the bitcoin
+		// transactions do not validate.  Only the failure witnesses of
+		// legacy spends are checked.
+		legacy, err := isLegacyScriptAsset(&test)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if legacy {
+			numLegacy++
+		} else {
+			err := executeTaprootScriptAsset(&test, test.Success)
+			if err != nil {
+				t.Errorf("%s: success witness failed: %v", name,
+					err)
+			}
+		}
+		if test.Failure == nil {
+			continue
+		}
+		if err := executeTaprootScriptAsset(&test, test.Failure); err == nil {
+			t.Errorf("%s: failure witness succeeded", name)
+		}
+	}
+
+	// Legacy spends are only included by the script assets for the
+	// compatibility of taproot with them, so they must remain a small
+	// minority.
+	if numLegacy*10 > len(paths) {
+		t.Fatalf("%d of %d script assets spend legacy outputs",
+			numLegacy, len(paths))
+	}
+}
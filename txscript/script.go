@@ -27,6 +27,7 @@ type SigHashType uint32
 // Hash type bits from the end of a signature.
 const (
 	SigHashOld          SigHashType = 0x0
+	SigHashDefault      SigHashType = 0x0
 	SigHashAll          SigHashType = 0x1
 	SigHashNone         SigHashType = 0x2
 	SigHashSingle       SigHashType = 0x3
@@ -84,6 +85,12 @@ func IsPayToWitnessScriptHash(script []byte) bool {
 	return isWitnessScriptHashScript(script)
 }
 
+// IsPayToTaproot returns true if the passed script is in the standard
+// pay-to-taproot (P2TR) format, false otherwise.
+func IsPayToTaproot(script []byte) bool {
+	return isWitnessTaprootScript(script)
+}
+
 // IsPayToWitnessPubKeyHash returns true if the is in the standard
 // pay-to-witness-pubkey-hash (P2WKH) format, false otherwise.
 func IsPayToWitnessPubKeyHash(script []byte) bool {
@@ -298,6 +305,9 @@ func removeOpcodeByData(script []byte, dataToRemove []byte) []byte {
 // signature hash type of SigHashAll. This allows validation to re-use previous
 // hashing computation, reducing the complexity of validating SigHashAll inputs
 // from  O(N^2) to O(N).
+//
+// The returned hash is a single sha256 as required by BIP0341.  The BIP0143
+// midstate is the sha256 of this value.
 func calcHashPrevOuts(tx *wire.MsgTx) chainhash.Hash {
 	var b bytes.Buffer
 	for _, in := range tx.TxIn {
@@ -312,7 +322,7 @@ func calcHashPrevOuts(tx *wire.MsgTx) chainhash.Hash {
 		b.Write(buf[:])
 	}
 
-	return chainhash.DoubleHashH(b.Bytes())
+	return chainhash.HashH(b.Bytes())
 }
 
 // calcHashSequence computes an aggregated hash of each of the sequence numbers
@@ -321,6 +331,9 @@ func calcHashPrevOuts(tx *wire.MsgTx) chainhash.Hash {
 // using the SigHashAll sighash type. This allows validation to re-use previous
 // hashing computation, reducing the complexity of validating SigHashAll inputs
 // from O(N^2) to O(N).
+//
+// The returned hash is a single sha256 as required by BIP0341.  The BIP0143
+// midstate is the sha256 of this value.
 func calcHashSequence(tx *wire.MsgTx) chainhash.Hash {
 	var b bytes.Buffer
 	for _, in := range tx.TxIn {
@@ -329,7 +342,7 @@ func calcHashSequence(tx *wire.MsgTx) chainhash.Hash {
 		b.Write(buf[:])
 	}
 
-	return chainhash.DoubleHashH(b.Bytes())
+	return chainhash.HashH(b.Bytes())
 }
 
 // calcHashOutputs computes a hash digest of all outputs created by the
@@ -337,13 +350,16 @@ func calcHashSequence(tx *wire.MsgTx) chainhash.Hash {
 // when validating all inputs spending witness programs, which include
 // signatures using the SigHashAll sighash type. This allows computation to be
 // cached, reducing the total hashing complexity from O(N^2) to O(N).
+//
+// The returned hash is a single sha256 as required by BIP0341.  The BIP0143
+// midstate is the sha256 of this value.
 func calcHashOutputs(tx *wire.MsgTx) chainhash.Hash {
 	var b bytes.Buffer
 	for _, out := range tx.TxOut {
 		wire.WriteTxOut(&b, 0, 0, out)
 	}
 
-	return chainhash.DoubleHashH(b.Bytes())
+	return chainhash.HashH(b.Bytes())
 }
 
 // calcWitnessSignatureHashRaw computes the sighash digest of a transaction's
@@ -438,8 +454,8 @@ func calcWitnessSignatureHashRaw(scriptSig []byte, sigHashes *TxSigHashes,
 	// re-use the pre-generated hashoutputs sighash fragment. Otherwise,
 	// we'll serialize and add only the target output index to the signature
 	// pre-image.
-	if hashType&SigHashSingle != SigHashSingle &&
-		hashType&SigHashNone != SigHashNone {
+	if hashType&sigHashMask != SigHashSingle &&
+		hashType&sigHashMask != SigHashNone {
 		sigHash.Write(sigHashes.HashOutputs[:])
 	} else if hashType&sigHashMask == SigHashSingle && idx < len(tx.TxOut) {
 		var b bytes.Buffer
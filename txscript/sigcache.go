@@ -9,6 +9,7 @@ import (
 
 	"github.com/babylonchain-io/bbld/btcec"
 	"github.com/babylonchain-io/bbld/btcec/ecdsa"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
 	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
 )
 
@@ -17,13 +18,15 @@ import (
 // scenario of a cache-hit (according to the sigHash), an additional comparison
 // of the signature, and public key will be executed in order to ensure a complete
 // match. In the occasion that two sigHashes collide, the newer sigHash will
-// simply overwrite the existing entry.
+// simply overwrite the existing entry.  Exactly one of the ECDSA and the
+// BIP0340 Schnorr signature is set.
 type sigCacheEntry struct {
-	sig    *ecdsa.Signature
-	pubKey *btcec.PublicKey
+	sig        *ecdsa.Signature
+	schnorrSig *schnorr.Signature
+	pubKey     *btcec.PublicKey
 }
 
-// SigCache implements an ECDSA signature verification cache with a randomized
+// SigCache implements an ECDSA and Schnorr signature verification cache with a randomized
 // entry eviction policy. Only valid signatures will be added to the cache. The
 // benefits of SigCache are two fold. Firstly, usage of SigCache mitigates a DoS
 // attack wherein an attack causes a victim's client to hang due to worst-case
@@ -61,7 +64,23 @@ func (s *SigCache) Exists(sigHash chainhash.Hash, sig *ecdsa.Signature, pubKey *
 	entry, ok := s.validSigs[sigHash]
 	s.RUnlock()
 
-	return ok && entry.pubKey.IsEqual(pubKey) && entry.sig.IsEqual(sig)
+	return ok && entry.sig != nil && entry.pubKey.IsEqual(pubKey) &&
+		entry.sig.IsEqual(sig)
+}
+
+// ExistsSchnorr returns true if an existing entry of the BIP0340 Schnorr
+// signature 'sig' over 'sigHash' for public key 'pubKey' is found within the
+// SigCache. Otherwise, false is returned.
+//
+// NOTE: This function is safe for concurrent access. Readers won't be blocked
+// unless there exists a writer, adding an entry to the SigCache.
+func (s *SigCache) ExistsSchnorr(sigHash chainhash.Hash, sig *schnorr.Signature, pubKey *btcec.PublicKey) bool {
+	s.RLock()
+	entry, ok := s.validSigs[sigHash]
+	s.RUnlock()
+
+	return ok && entry.schnorrSig != nil && entry.pubKey.IsEqual(pubKey) &&
+		entry.schnorrSig.IsEqual(sig)
 }
 
 // Add adds an entry for a signature over 'sigHash' under public key 'pubKey'
@@ -72,6 +91,23 @@ func (s *SigCache) Exists(sigHash chainhash.Hash, sig *ecdsa.Signature, pubKey *
 // NOTE: This function is safe for concurrent access. Writers will block
 // simultaneous readers until function execution has concluded.
 func (s *SigCache) Add(sigHash chainhash.Hash, sig *ecdsa.Signature, pubKey *btcec.PublicKey) {
+	s.add(sigHash, sigCacheEntry{sig: sig, pubKey: pubKey})
+}
+
+// AddSchnorr adds an entry for a BIP0340 Schnorr signature over 'sigHash'
+// under public key 'pubKey' to the signature cache. In the event that the
+// SigCache is 'full', an existing entry is randomly chosen to be evicted in
+// order to make space for the new entry.
+//
+// NOTE: This function is safe for concurrent access. Writers will block
+// simultaneous readers until function execution has concluded.
+func (s *SigCache) AddSchnorr(sigHash chainhash.Hash, sig *schnorr.Signature, pubKey *btcec.PublicKey) {
+	s.add(sigHash, sigCacheEntry{schnorrSig: sig, pubKey: pubKey})
+}
+
+// add adds the passed entry to the signature cache, evicting a random entry
+// when the cache is full.
+func (s *SigCache) add(sigHash chainhash.Hash, entry sigCacheEntry) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -96,5 +132,5 @@ func (s *SigCache) Add(sigHash chainhash.Hash, sig *ecdsa.Signature, pubKey *btc
 			break
 		}
 	}
-	s.validSigs[sigHash] = sigCacheEntry{sig, pubKey}
+	s.validSigs[sigHash] = entry
 }
@@ -5,9 +5,11 @@
 package txscript
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/babylonchain-io/bbld/btcec/ecdsa"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
 
 	"github.com/babylonchain-io/bbld/btcec"
 	"github.com/babylonchain-io/bbld/btcutil"
@@ -62,6 +64,128 @@ func WitnessSignature(tx *wire.MsgTx, sigHashes *TxSigHashes, idx int, amt int64
 	return wire.TxWitness{sig, pkData}, nil
 }
 
+// taprootSigHashesReady returns an error if the passed sighashes don't house
+// the BIP 341 midstate.  The taproot signing helpers are only given the output
+// spent by the input being signed, so the midstate, which commits to all of
+// the spent outputs, must have been calculated up front by NewTxSigHashes.
+func taprootSigHashesReady(sigHashes *TxSigHashes) error {
+	if sigHashes == nil || !sigHashes.hasV1 {
+		return errors.New("sighashes must be created with the previous " +
+			"outputs of all inputs to sign for taproot")
+	}
+	return nil
+}
+
+// RawTxInTaprootSignature returns a valid schnorr signature required to
+// perform a taproot key-spend of the passed input idx.  The key is tweaked
+// with the passed script root before signing, so an output that commits to a
+// tapscript tree can be spent using the key path as well.  An empty script
+// root should be passed for outputs that only commit to the key.  The passed
+// sighashes must have been created using the previous outputs of all of the
+// inputs of the transaction.  The hashType is only appended to the signature
+// when it isn't SigHashDefault.
+func RawTxInTaprootSignature(tx *wire.MsgTx, sigHashes *TxSigHashes, idx int,
+	amt int64, pkScript []byte, tapScriptRootHash []byte,
+	hashType SigHashType, key *btcec.PrivateKey) ([]byte, error) {
+
+	if err := taprootSigHashesReady(sigHashes); err != nil {
+		return nil, err
+	}
+
+	// The tweaked key must match the output being spent, otherwise the
+	// signature would never be valid.
+	privKeyTweak, err := TweakTaprootPrivKey(key, tapScriptRootHash)
+	if err != nil {
+		return nil, err
+	}
+	expectedScript, err := PayToTaprootScript(privKeyTweak.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(expectedScript, pkScript) {
+		return nil, errors.New("tweaked key does not match the " +
+			"taproot output being spent")
+	}
+
+	sigHash, err := calcTaprootSignatureHashRaw(
+		sigHashes, hashType, tx, idx,
+		NewCannedPrevOutputFetcher(pkScript, amt),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := schnorr.Sign(privKeyTweak, sigHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return taprootSigWithHashType(signature, hashType), nil
+}
+
+// RawTxInTapscriptSignature returns a valid schnorr signature required to
+// perform a tapscript spend of the passed input idx via the passed leaf.  The
+// signature commits to the leaf and is meant to satisfy a signature check of
+// the leaf script that precedes any OP_CODESEPARATOR.  The passed sighashes
+// must have been created using the previous outputs of all of the inputs of
+// the transaction.  The hashType is only appended to the signature when it
+// isn't SigHashDefault.
+func RawTxInTapscriptSignature(tx *wire.MsgTx, sigHashes *TxSigHashes, idx int,
+	amt int64, pkScript []byte, tapLeaf TapLeaf, hashType SigHashType,
+	privKey *btcec.PrivateKey) ([]byte, error) {
+
+	if err := taprootSigHashesReady(sigHashes); err != nil {
+		return nil, err
+	}
+
+	sigHash, err := CalcTapscriptSignaturehash(
+		sigHashes, hashType, tx, idx,
+		NewCannedPrevOutputFetcher(pkScript, amt), tapLeaf,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := schnorr.Sign(privKey, sigHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return taprootSigWithHashType(signature, hashType), nil
+}
+
+// taprootSigWithHashType serializes the passed schnorr signature, appending
+// the hash type unless it is SigHashDefault, which is implied by a bare
+// 64-byte signature.
+func taprootSigWithHashType(sig *schnorr.Signature,
+	hashType SigHashType) []byte {
+
+	sigBytes := sig.Serialize()
+	if hashType == SigHashDefault {
+		return sigBytes
+	}
+	return append(sigBytes, byte(hashType))
+}
+
+// TaprootWitnessSignature returns a valid witness stack that can be used to
+// spend the key-spend path of a taproot input as specified in BIP 341 and BIP
+// 86.  The output being spent must commit to the public key of privKey with
+// no tapscript tree.
+func TaprootWitnessSignature(tx *wire.MsgTx, sigHashes *TxSigHashes, idx int,
+	amt int64, pkScript []byte, hashType SigHashType,
+	key *btcec.PrivateKey) (wire.TxWitness, error) {
+
+	sig, err := RawTxInTaprootSignature(
+		tx, sigHashes, idx, amt, pkScript, nil, hashType, key,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The witness of a key-spend is just the signature itself.
+	return wire.TxWitness{sig}, nil
+}
+
 // RawTxInSignature returns the serialized ECDSA signature for the input idx of
 // the given transaction, with hashType appended to it.
 func RawTxInSignature(tx *wire.MsgTx, idx int, subScript []byte,
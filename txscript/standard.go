@@ -7,6 +7,8 @@ package txscript
 import (
 	"fmt"
 
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
 	"github.com/babylonchain-io/bbld/btcutil"
 	"github.com/babylonchain-io/bbld/chaincfg"
 	"github.com/babylonchain-io/bbld/wire"
@@ -42,7 +44,11 @@ const (
 		ScriptVerifyWitness |
 		ScriptVerifyDiscourageUpgradeableWitnessProgram |
 		ScriptVerifyMinimalIf |
-		ScriptVerifyWitnessPubKeyType
+		ScriptVerifyWitnessPubKeyType |
+		ScriptVerifyTaproot |
+		ScriptVerifyDiscourageUpgradeableTaprootVersion |
+		ScriptVerifyDiscourageOpSuccess |
+		ScriptVerifyDiscourageUpgradeablePubkeyType
 )
 
 // ScriptClass is an enumeration for the list of standard types of script.
@@ -59,6 +65,7 @@ const (
 	MultiSigTy                               // Multi signature.
 	NullDataTy                               // Empty data-only (provably prunable).
 	WitnessUnknownTy                         // Witness unknown
+	WitnessV1TaprootTy                       // Taproot output
 )
 
 // scriptClassToName houses the human-readable strings which describe each
@@ -73,6 +80,7 @@ var scriptClassToName = []string{
 	MultiSigTy:            "multisig",
 	NullDataTy:            "nulldata",
 	WitnessUnknownTy:      "witness_unknown",
+	WitnessV1TaprootTy:    "witness_v1_taproot",
 }
 
 // String implements the Stringer interface by returning the name of
@@ -387,6 +395,28 @@ func isWitnessScriptHashScript(script []byte) bool {
 	return extractWitnessScriptHash(script) != nil
 }
 
+// extractWitnessV1KeyBytes extracts the x-only taproot output key from the
+// passed script if it is a standard pay-to-taproot script.  It will return nil
+// otherwise.
+func extractWitnessV1KeyBytes(script []byte) []byte {
+	// A pay-to-taproot script is of the form:
+	//   OP_1 OP_DATA_32 <32-byte-x-only-key>
+	if len(script) == 34 &&
+		script[0] == OP_1 &&
+		script[1] == OP_DATA_32 {
+
+		return script[2:34]
+	}
+
+	return nil
+}
+
+// isWitnessTaprootScript returns whether or not the passed script is a
+// standard pay-to-taproot script.
+func isWitnessTaprootScript(script []byte) bool {
+	return extractWitnessV1KeyBytes(script) != nil
+}
+
 // extractWitnessProgramInfo returns the version and program if the passed
 // script constitutes a valid witness program. The last return value indicates
 // whether or not the script is a valid witness program.
@@ -500,6 +530,8 @@ func typeOfScript(scriptVersion uint16, script []byte) ScriptClass {
 		return WitnessV0PubKeyHashTy
 	case isWitnessScriptHashScript(script):
 		return WitnessV0ScriptHashTy
+	case isWitnessTaprootScript(script):
+		return WitnessV1TaprootTy
 	case isMultisigScript(scriptVersion, script):
 		return MultiSigTy
 	case isNullDataScript(scriptVersion, script):
@@ -561,6 +593,10 @@ func expectedInputs(script []byte, class ScriptClass) int {
 		// Not including script.  That is handled by the caller.
 		return 1
 
+	case WitnessV1TaprootTy:
+		// A key path spend only requires the signature.
+		return 1
+
 	case MultiSigTy:
 		// Standard multisig has a push a small number for the number
 		// of sigs and number of keys.  Check the first push instruction
@@ -758,6 +794,20 @@ func payToWitnessScriptHashScript(scriptHash []byte) ([]byte, error) {
 	return NewScriptBuilder().AddOp(OP_0).AddData(scriptHash).Script()
 }
 
+// payToWitnessTaprootScript creates a new script to pay to a version 1
+// (taproot) witness program. The passed key is expected to be a valid 32-byte
+// x-only public key.
+func payToWitnessTaprootScript(rawKey []byte) ([]byte, error) {
+	return NewScriptBuilder().AddOp(OP_1).AddData(rawKey).Script()
+}
+
+// PayToTaprootScript creates a new script to pay to a version 1 (taproot)
+// witness program. The passed public key is expected to be the taproot
+// output key, which is serialized in its x-only form.
+func PayToTaprootScript(taprootKey *btcec.PublicKey) ([]byte, error) {
+	return payToWitnessTaprootScript(schnorr.SerializePubKey(taprootKey))
+}
+
 // payToPubkeyScript creates a new script to pay a transaction output to a
 // public key. It is expected that the input is a valid pubkey.
 func payToPubKeyScript(serializedPubKey []byte) ([]byte, error) {
@@ -804,6 +854,12 @@ func PayToAddrScript(addr btcutil.Address) ([]byte, error) {
 				nilAddrErrStr)
 		}
 		return payToWitnessScriptHashScript(addr.ScriptAddress())
+	case *btcutil.AddressTaproot:
+		if addr == nil {
+			return nil, scriptError(ErrUnsupportedAddress,
+				nilAddrErrStr)
+		}
+		return payToWitnessTaprootScript(addr.ScriptAddress())
 	}
 
 	str := fmt.Sprintf("unable to generate payment script for unsupported "+
@@ -965,6 +1021,15 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 		return WitnessV0ScriptHashTy, addrs, 1, nil
 	}
 
+	if rawKey := extractWitnessV1KeyBytes(pkScript); rawKey != nil {
+		var addrs []btcutil.Address
+		addr, err := btcutil.NewAddressTaproot(rawKey, chainParams)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+		return WitnessV1TaprootTy, addrs, 1, nil
+	}
+
 	// If none of the above passed, then the address must be non-standard.
 	return NonStandardTy, nil, 0, nil
 }
@@ -71,6 +71,20 @@ func newAddressScriptHash(scriptHash []byte) btcutil.Address {
 	return addr
 }
 
+// newAddressTaproot returns a new btcutil.AddressTaproot from the provided
+// x-only output key.  It panics if an error occurs.  This is only used in the
+// tests as a helper since the only way it can fail is if there is an error in
+// the test source code.
+func newAddressTaproot(outputKey []byte) btcutil.Address {
+	addr, err := btcutil.NewAddressTaproot(outputKey,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		panic("invalid taproot output key in test source")
+	}
+
+	return addr
+}
+
 // TestExtractPkScriptAddrs ensures that extracting the type, addresses, and
 // number of required signatures from PkScripts works as intended.
 func TestExtractPkScriptAddrs(t *testing.T) {
@@ -327,6 +341,19 @@ func TestExtractPkScriptAddrs(t *testing.T) {
 			reqSigs: 1,
 			class:   MultiSigTy,
 		},
+		{
+			// From BIP 86, the first receiving address.
+			name: "p2tr",
+			script: hexToBytes("5120a60869f0dbcf1dc659c9cecbaf8050" +
+				"135ea9e8cdc487053f1dc6880949dc684c"),
+			addrs: []btcutil.Address{
+				newAddressTaproot(hexToBytes("a60869f0dbcf1dc6" +
+					"59c9cecbaf8050135ea9e8cdc487053f1dc6" +
+					"880949dc684c")),
+			},
+			reqSigs: 1,
+			class:   WitnessV1TaprootTy,
+		},
 		{
 			name:    "empty script",
 			script:  []byte{},
@@ -637,6 +664,14 @@ func TestPayToAddrScript(t *testing.T) {
 			err)
 	}
 
+	// bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr
+	p2trMain, err := btcutil.NewAddressTaproot(hexToBytes("a60869f0dbcf1"+
+		"dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c"),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Unable to create taproot address: %v", err)
+	}
+
 	// Errors used in the tests below defined here for convenience and to
 	// keep the horizontal test size shorter.
 	errUnsupportedAddress := scriptError(ErrUnsupportedAddress, "")
@@ -683,11 +718,19 @@ func TestPayToAddrScript(t *testing.T) {
 				"CHECKSIG",
 			nil,
 		},
+		// pay-to-taproot address on mainnet.
+		{
+			p2trMain,
+			"1 DATA_32 0xa60869f0dbcf1dc659c9cecbaf8050135ea9e8cd" +
+				"c487053f1dc6880949dc684c",
+			nil,
+		},
 
 		// Supported address types with nil pointers.
 		{(*btcutil.AddressPubKeyHash)(nil), "", errUnsupportedAddress},
 		{(*btcutil.AddressScriptHash)(nil), "", errUnsupportedAddress},
 		{(*btcutil.AddressPubKey)(nil), "", errUnsupportedAddress},
+		{(*btcutil.AddressTaproot)(nil), "", errUnsupportedAddress},
 
 		// Unsupported address type.
 		{&bogusAddress{}, "", errUnsupportedAddress},
@@ -1041,6 +1084,12 @@ var scriptClassTests = []struct {
 		script: "0 DATA_32 0x9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
 		class:  WitnessV0ScriptHashTy,
 	},
+	{
+		// A pay to taproot pk script.
+		name:   "Pay To Taproot",
+		script: "1 DATA_32 0xa60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+		class:  WitnessV1TaprootTy,
+	},
 }
 
 // TestScriptClass ensures all the scripts in scriptClassTests have the expected
@@ -0,0 +1,404 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// TapscriptLeafVersion represents the various possible versions of a tapscript
+// leaf version.  Leaf versions are used to define, or introduce new script
+// semantics, without having to fork the witness version.
+type TapscriptLeafVersion uint8
+
+const (
+	// BaseLeafVersion is the base tapscript leaf version.  The semantics
+	// of this version are defined in BIP 342.
+	BaseLeafVersion TapscriptLeafVersion = 0xc0
+)
+
+const (
+	// TaprootWitnessVersion is the witness version used for taproot
+	// outputs.
+	TaprootWitnessVersion = 1
+
+	// TaprootAnnexTag is the tag that identifies the optional annex as the
+	// final element of the witness of a taproot spend.
+	TaprootAnnexTag = 0x50
+
+	// TaprootLeafMask is the mask applied to the first byte of a control
+	// block to extract the leaf version.  The remaining bit denotes the
+	// parity of the y coordinate of the output key.
+	TaprootLeafMask = 0xfe
+
+	// ControlBlockBaseSize is the base size of a control block.  This
+	// includes the initial byte for the leaf version and parity, and the
+	// 32 bytes of the x-only internal key.
+	ControlBlockBaseSize = 33
+
+	// ControlBlockNodeSize is the size of a single node of the merkle
+	// inclusion proof within a control block.
+	ControlBlockNodeSize = 32
+
+	// ControlBlockMaxNodeCount is the max number of nodes that can be
+	// included in the merkle inclusion proof of a control block.  This
+	// bounds the depth of a tapscript tree to 128 levels.
+	ControlBlockMaxNodeCount = 128
+
+	// ControlBlockMaxSize is the max possible size of a control block.
+	ControlBlockMaxSize = ControlBlockBaseSize + (ControlBlockNodeSize *
+		ControlBlockMaxNodeCount)
+
+	// sigOpsDelta is the amount the sig op budget of a tapscript is
+	// decremented by for each executed signature check with a non-empty
+	// signature.
+	sigOpsDelta = 50
+
+	// blankCodeSepValue is the value of the code separator position in the
+	// tapscript sighash when no OP_CODESEPARATOR has been executed.
+	blankCodeSepValue = ^uint32(0)
+)
+
+// TapLeaf represents a leaf in a tapscript tree.  A leaf has two components:
+// the leaf version, and the script associated with that leaf version.
+type TapLeaf struct {
+	// LeafVersion is the leaf version of this leaf.
+	LeafVersion TapscriptLeafVersion
+
+	// Script is the script to be validated based on the specified leaf
+	// version.
+	Script []byte
+}
+
+// NewBaseTapLeaf returns a new TapLeaf for the specified script, using the
+// current base tapscript leaf version (BIP 342).
+func NewBaseTapLeaf(script []byte) TapLeaf {
+	return NewTapLeaf(BaseLeafVersion, script)
+}
+
+// NewTapLeaf returns a new TapLeaf with the given leaf version and script.
+func NewTapLeaf(leafVersion TapscriptLeafVersion, script []byte) TapLeaf {
+	return TapLeaf{
+		LeafVersion: leafVersion,
+		Script:      script,
+	}
+}
+
+// TapHash returns the hash digest of the target leaf as defined by BIP 341:
+//
+//	tagged_hash("TapLeaf", leaf_version || compact_size(script) || script)
+func (t TapLeaf) TapHash() chainhash.Hash {
+	var leafEncoding bytes.Buffer
+	leafEncoding.WriteByte(byte(t.LeafVersion))
+	_ = wire.WriteVarBytes(&leafEncoding, 0, t.Script)
+
+	return *chainhash.TaggedHash(chainhash.TagTapLeaf, leafEncoding.Bytes())
+}
+
+// TapBranchHash takes the raw tap hashes of the left and right nodes of a
+// branch and hashes them into a branch node as defined by BIP 341.  The nodes
+// are sorted lexicographically before hashing so the proof does not need to
+// encode which side each node is on.
+func TapBranchHash(l, r []byte) chainhash.Hash {
+	if bytes.Compare(l, r) > 0 {
+		l, r = r, l
+	}
+
+	return *chainhash.TaggedHash(chainhash.TagTapBranch, l, r)
+}
+
+// ControlBlock houses the structure of the control block of a script path
+// spend.  The control block carries the information needed to prove that the
+// revealed script is committed to by the taproot output key.
+type ControlBlock struct {
+	// InternalKey is the internal public key of the taproot output.
+	InternalKey *btcec.PublicKey
+
+	// OutputKeyYIsOdd denotes if the y coordinate of the output key, which
+	// is the internal key tweaked by the merkle root, is odd.
+	OutputKeyYIsOdd bool
+
+	// LeafVersion is the leaf version of the revealed script.
+	LeafVersion TapscriptLeafVersion
+
+	// InclusionProof is the series of sibling hashes, ordered from the
+	// leaf to the root, that proves the revealed script is a leaf of the
+	// tapscript tree.
+	InclusionProof []byte
+}
+
+// ToBytes returns the control block in the serialized format used as the last
+// element of a witness spending a tapscript.
+func (c *ControlBlock) ToBytes() []byte {
+	controlBlock := make(
+		[]byte, 0, ControlBlockBaseSize+len(c.InclusionProof),
+	)
+
+	// The first byte houses the leaf version and the parity of the
+	// output key, followed by the x-only internal key.
+	firstByte := byte(c.LeafVersion)
+	if c.OutputKeyYIsOdd {
+		firstByte |= 0x01
+	}
+	controlBlock = append(controlBlock, firstByte)
+	controlBlock = append(
+		controlBlock, schnorr.SerializePubKey(c.InternalKey)...,
+	)
+
+	return append(controlBlock, c.InclusionProof...)
+}
+
+// RootHash calculates the root hash of the tapscript tree given the revealed
+// script.
+func (c *ControlBlock) RootHash(revealedScript []byte) []byte {
+	// We'll start by computing the leaf hash of the revealed script,
+	// which is the starting point of the inclusion proof.
+	leaf := NewTapLeaf(c.LeafVersion, revealedScript)
+	return c.rootHashFromLeaf(leaf.TapHash())
+}
+
+// rootHashFromLeaf walks the inclusion proof of the control block starting at
+// the passed leaf hash and returns the resulting root hash.
+func (c *ControlBlock) rootHashFromLeaf(leafHash chainhash.Hash) []byte {
+	merkleAccumulator := leafHash
+	numNodes := len(c.InclusionProof) / ControlBlockNodeSize
+	for nodeOffset := 0; nodeOffset < numNodes; nodeOffset++ {
+		leafOffset := nodeOffset * ControlBlockNodeSize
+		nextNode := c.InclusionProof[leafOffset : leafOffset+
+			ControlBlockNodeSize]
+
+		merkleAccumulator = TapBranchHash(merkleAccumulator[:], nextNode)
+	}
+
+	return merkleAccumulator[:]
+}
+
+// ParseControlBlock attempts to parse the raw bytes of a control block.  An
+// error is returned if the control block isn't well formed, or can't be
+// parsed.
+func ParseControlBlock(ctrlBlock []byte) (*ControlBlock, error) {
+	// The control block must be at least 33 bytes, and no larger than
+	// 4129 bytes.  The remaining bytes after the base size must be a
+	// multiple of the node size.
+	switch {
+	case len(ctrlBlock) < ControlBlockBaseSize:
+		str := fmt.Sprintf("min size is %v bytes, control block "+
+			"is %v bytes", ControlBlockBaseSize, len(ctrlBlock))
+		return nil, scriptError(ErrControlBlockTooSmall, str)
+
+	case len(ctrlBlock) > ControlBlockMaxSize:
+		str := fmt.Sprintf("max size is %v, control block is %v bytes",
+			ControlBlockMaxSize, len(ctrlBlock))
+		return nil, scriptError(ErrControlBlockTooLarge, str)
+
+	case (len(ctrlBlock)-ControlBlockBaseSize)%ControlBlockNodeSize != 0:
+		str := fmt.Sprintf("control block proof is not a multiple "+
+			"of 32: %v", len(ctrlBlock)-ControlBlockBaseSize)
+		return nil, scriptError(ErrControlBlockInvalidLength, str)
+	}
+
+	// The first byte houses both the leaf version and the parity of the
+	// output key.
+	leafVersion := TapscriptLeafVersion(ctrlBlock[0] & TaprootLeafMask)
+	yIsOdd := (ctrlBlock[0] & 0x01) == 0x01
+
+	// The next 32 bytes are the x-only internal key, which must be a
+	// valid point on the curve.
+	rawKey := ctrlBlock[1:ControlBlockBaseSize]
+	pubKey, err := schnorr.ParsePubKey(rawKey)
+	if err != nil {
+		str := fmt.Sprintf("invalid control block internal key: %v",
+			err)
+		return nil, scriptError(ErrTaprootMerkleProofInvalid, str)
+	}
+
+	return &ControlBlock{
+		InternalKey:     pubKey,
+		OutputKeyYIsOdd: yIsOdd,
+		LeafVersion:     leafVersion,
+		InclusionProof:  ctrlBlock[ControlBlockBaseSize:],
+	}, nil
+}
+
+// ComputeTaprootOutputKey returns the taproot output key that results from
+// tweaking the passed internal key with the merkle root of a tapscript tree
+// as defined by BIP 341:
+//
+//	Q = P + int(tagged_hash("TapTweak", x(P) || scriptRoot))*G
+//
+// The internal key is treated as an x-only key, so its y coordinate is
+// assumed to be even.  An empty script root commits to no scripts at all.
+func ComputeTaprootOutputKey(internalKey *btcec.PublicKey,
+	scriptRoot []byte) (*btcec.PublicKey, error) {
+
+	// The internal key is always used with an even y coordinate, so
+	// re-parse it in its x-only form to enforce that.
+	internalKeyBytes := schnorr.SerializePubKey(internalKey)
+	evenKey, err := schnorr.ParsePubKey(internalKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compute the tweak that commits the internal key to the script
+	// root.  A tweak that overflows the group order is invalid.
+	tapTweakHash := chainhash.TaggedHash(
+		chainhash.TagTapTweak, internalKeyBytes, scriptRoot,
+	)
+	var tweakScalar btcec.ModNScalar
+	if overflow := tweakScalar.SetByteSlice(tapTweakHash[:]); overflow {
+		return nil, fmt.Errorf("taproot tweak overflows the group " +
+			"order")
+	}
+
+	// Q = P + t*G.
+	var internalPoint, tweakPoint, outputPoint btcec.JacobianPoint
+	evenKey.AsJacobian(&internalPoint)
+	btcec.ScalarBaseMultNonConst(&tweakScalar, &tweakPoint)
+	btcec.AddNonConst(&internalPoint, &tweakPoint, &outputPoint)
+
+	// The output key must not be the point at infinity.
+	if (outputPoint.X.IsZero() && outputPoint.Y.IsZero()) ||
+		outputPoint.Z.IsZero() {
+
+		return nil, fmt.Errorf("taproot output key is the point at " +
+			"infinity")
+	}
+
+	outputPoint.ToAffine()
+	return btcec.NewPublicKey(&outputPoint.X, &outputPoint.Y), nil
+}
+
+// ComputeTaprootKeyNoScript returns the taproot output key for an internal
+// key that doesn't commit to any tapscript leaves, which means the output can
+// only be spent using the key path.
+func ComputeTaprootKeyNoScript(internalKey *btcec.PublicKey) (*btcec.PublicKey,
+	error) {
+
+	return ComputeTaprootOutputKey(internalKey, nil)
+}
+
+// TweakTaprootPrivKey returns the private key that corresponds to the taproot
+// output key derived from the public key of the passed private key and the
+// script root, as returned by ComputeTaprootOutputKey.  The returned key can
+// be used to sign for the key path of the output.
+func TweakTaprootPrivKey(privKey *btcec.PrivateKey,
+	scriptRoot []byte) (*btcec.PrivateKey, error) {
+
+	// The internal key is always used with an even y coordinate, so the
+	// private key needs to be negated when the public key has an odd y
+	// coordinate.
+	privKeyScalar := privKey.Key
+	pubKey := privKey.PubKey()
+	if pubKey.SerializeCompressed()[0] == 0x03 {
+		privKeyScalar.Negate()
+	}
+
+	tapTweakHash := chainhash.TaggedHash(
+		chainhash.TagTapTweak, schnorr.SerializePubKey(pubKey),
+		scriptRoot,
+	)
+	var tweakScalar btcec.ModNScalar
+	if overflow := tweakScalar.SetByteSlice(tapTweakHash[:]); overflow {
+		return nil, fmt.Errorf("taproot tweak overflows the group " +
+			"order")
+	}
+
+	// d' = d + t.
+	privKeyScalar.Add(&tweakScalar)
+	if privKeyScalar.IsZero() {
+		return nil, fmt.Errorf("tweaked taproot private key is zero")
+	}
+
+	keyBytes := privKeyScalar.Bytes()
+	tweakedKey, _ := btcec.PrivKeyFromBytes(keyBytes[:])
+	return tweakedKey, nil
+}
+
+// verifyTaprootLeafCommitment verifies that the passed control block and leaf
+// hash commit to the taproot witness program, which is the x-only output
+// key.  The parity of the output key y coordinate must match the parity
+// encoded in the control block.
+func verifyTaprootLeafCommitment(controlBlock *ControlBlock,
+	leafHash chainhash.Hash, taprootWitnessProgram []byte) error {
+
+	rootHash := controlBlock.rootHashFromLeaf(leafHash)
+	outputKey, err := ComputeTaprootOutputKey(
+		controlBlock.InternalKey, rootHash,
+	)
+	if err != nil {
+		str := fmt.Sprintf("unable to derive taproot output key: %v",
+			err)
+		return scriptError(ErrTaprootMerkleProofInvalid, str)
+	}
+
+	// The x coordinate of the derived output key must match the witness
+	// program.
+	expectedWitnessProgram := schnorr.SerializePubKey(outputKey)
+	if !bytes.Equal(expectedWitnessProgram, taprootWitnessProgram) {
+		str := fmt.Sprintf("derived output key %x doesn't match witness "+
+			"program %x", expectedWitnessProgram,
+			taprootWitnessProgram)
+		return scriptError(ErrTaprootMerkleProofInvalid, str)
+	}
+
+	// Finally, the parity of the y coordinate of the output key must
+	// match the parity bit of the control block.  The format byte of a
+	// compressed public key is 0x03 when the y coordinate is odd.
+	derivedYIsOdd := outputKey.SerializeCompressed()[0] == 0x03
+	if controlBlock.OutputKeyYIsOdd != derivedYIsOdd {
+		str := fmt.Sprintf("control block y is odd: %v, derived "+
+			"parity is odd: %v", controlBlock.OutputKeyYIsOdd,
+			derivedYIsOdd)
+		return scriptError(ErrTaprootMerkleProofInvalid, str)
+	}
+
+	return nil
+}
+
+// VerifyTaprootLeafCommitment attempts to verify a taproot commitment of the
+// revealed script within the taprootWitnessProgram (a schnorr public key) given
+// the required information included in the control block.  An error is
+// returned if the reconstructed taproot commitment (a function of the merkle
+// root and the internal key) doesn't match the passed witness program.
+func VerifyTaprootLeafCommitment(controlBlock *ControlBlock,
+	taprootWitnessProgram []byte, revealedScript []byte) error {
+
+	leaf := NewTapLeaf(controlBlock.LeafVersion, revealedScript)
+	return verifyTaprootLeafCommitment(
+		controlBlock, leaf.TapHash(), taprootWitnessProgram,
+	)
+}
+
+// isAnnexedWitness returns true if the passed witness has a final push that is
+// a taproot annex.  A witness with a single element can't have an annex since
+// that element is the signature of a key path spend.
+func isAnnexedWitness(witness wire.TxWitness) bool {
+	if len(witness) < 2 {
+		return false
+	}
+
+	lastElement := witness[len(witness)-1]
+	return len(lastElement) > 0 && lastElement[0] == TaprootAnnexTag
+}
+
+// IsOpSuccess returns true if the passed opcode is one of the OP_SUCCESS
+// opcodes defined by BIP 342.  These opcodes cause a tapscript that contains
+// them to succeed unconditionally, which allows them to be redefined by future
+// soft forks.
+func IsOpSuccess(opcode byte) bool {
+	return opcode == 80 || opcode == 98 ||
+		(opcode >= 126 && opcode <= 129) ||
+		(opcode >= 131 && opcode <= 134) ||
+		(opcode >= 137 && opcode <= 138) ||
+		(opcode >= 141 && opcode <= 142) ||
+		(opcode >= 149 && opcode <= 153) ||
+		(opcode >= 187 && opcode <= 254)
+}
@@ -0,0 +1,913 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/btcec"
+	"github.com/babylonchain-io/bbld/btcec/schnorr"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// taprootTestFlags are the script flags used to validate the taproot spends
+// within the tests.
+const taprootTestFlags = StandardVerifyFlags
+
+// payToTaprootTestScript returns the public key script that pays to the
+// passed taproot output key.
+func payToTaprootTestScript(t *testing.T, outputKey *btcec.PublicKey) []byte {
+	t.Helper()
+
+	pkScript, err := PayToTaprootScript(outputKey)
+	if err != nil {
+		t.Fatalf("unable to create taproot script: %v", err)
+	}
+	return pkScript
+}
+
+// taprootTestSpend houses a transaction spending a taproot output along with
+// the fetcher for the output it spends.
+type taprootTestSpend struct {
+	tx        *wire.MsgTx
+	prevOuts  *MultiPrevOutFetcher
+	pkScript  []byte
+	sigHashes *TxSigHashes
+}
+
+// newTaprootTestSpend returns a transaction that spends the first output of a
+// funding transaction that pays to the passed public key script along with an
+// unrelated second input.
+func newTaprootTestSpend(pkScript []byte) *taprootTestSpend {
+	const amt = 100000
+
+	fundingTx := wire.NewMsgTx(2)
+	fundingTx.AddTxOut(wire.NewTxOut(amt, pkScript))
+	fundingTx.AddTxOut(wire.NewTxOut(amt, []byte{OP_TRUE}))
+	fundingHash := fundingTx.TxHash()
+
+	spendTx := wire.NewMsgTx(2)
+	for i := range fundingTx.TxOut {
+		outPoint := wire.NewOutPoint(&fundingHash, uint32(i))
+		spendTx.AddTxIn(wire.NewTxIn(outPoint, nil, nil))
+	}
+	spendTx.AddTxOut(wire.NewTxOut(amt, []byte{OP_TRUE}))
+
+	prevOuts := NewMultiPrevOutFetcher(nil)
+	for i, txOut := range fundingTx.TxOut {
+		outPoint := wire.NewOutPoint(&fundingHash, uint32(i))
+		prevOuts.AddPrevOut(*outPoint, txOut)
+	}
+
+	return &taprootTestSpend{
+		tx:        spendTx,
+		prevOuts:  prevOuts,
+		pkScript:  pkScript,
+		sigHashes: NewTxSigHashes(spendTx, prevOuts),
+	}
+}
+
+// execute validates the first input of the spending transaction with the
+// passed witness and flags.
+func (s *taprootTestSpend) execute(witness wire.TxWitness, flags ScriptFlags,
+	sigCache *SigCache) error {
+
+	s.tx.TxIn[0].Witness = witness
+	vm, err := NewEngine(
+		s.pkScript, s.tx, 0, flags, sigCache, s.sigHashes,
+		s.prevOuts.FetchPrevOutput(s.tx.TxIn[0].PreviousOutPoint).Value,
+		s.prevOuts,
+	)
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+// TestTaprootKeyPathSpend ensures that key path spends of taproot outputs
+// validate for all of the taproot sighash types, both with and without an
+// annex, and that invalid signatures are rejected.
+func TestTaprootKeyPathSpend(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	outputKey, err := ComputeTaprootOutputKey(privKey.PubKey(), nil)
+	if err != nil {
+		t.Fatalf("unable to tweak key: %v", err)
+	}
+	tweakedPrivKey, err := TweakTaprootPrivKey(privKey, nil)
+	if err != nil {
+		t.Fatalf("unable to tweak private key: %v", err)
+	}
+
+	spend := newTaprootTestSpend(payToTaprootTestScript(t, outputKey))
+
+	// sign returns a key path signature with the passed sighash type and
+	// options.
+	sign := func(hashType SigHashType,
+		opts ...TaprootSigHashOption) []byte {
+
+		sigHash, err := calcTaprootSignatureHashRaw(
+			spend.sigHashes, hashType, spend.tx, 0, spend.prevOuts,
+			opts...,
+		)
+		if err != nil {
+			t.Fatalf("unable to calc sighash: %v", err)
+		}
+		sig, err := schnorr.Sign(tweakedPrivKey, sigHash)
+		if err != nil {
+			t.Fatalf("unable to sign: %v", err)
+		}
+
+		rawSig := sig.Serialize()
+		if hashType != SigHashDefault {
+			rawSig = append(rawSig, byte(hashType))
+		}
+		return rawSig
+	}
+
+	hashTypes := []SigHashType{
+		SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay,
+	}
+	for _, hashType := range hashTypes {
+		witness := wire.TxWitness{sign(hashType)}
+		if err := spend.execute(witness, taprootTestFlags, nil); err != nil {
+			t.Fatalf("hash type %v: unexpected error: %v", hashType,
+				err)
+		}
+
+		// The annex must be committed to by the signature.
+		annex := []byte{TaprootAnnexTag, 0x01, 0x02}
+		witness = wire.TxWitness{
+			sign(hashType, WithAnnex(annex)), annex,
+		}
+		if err := spend.execute(witness, taprootTestFlags, nil); err != nil {
+			t.Fatalf("hash type %v with annex: unexpected error: "+
+				"%v", hashType, err)
+		}
+		witness = wire.TxWitness{sign(hashType), annex}
+		err := spend.execute(witness, taprootTestFlags, nil)
+		if !IsErrorCode(err, ErrTaprootSigInvalid) {
+			t.Fatalf("hash type %v with uncommitted annex: "+
+				"unexpected error: %v", hashType, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		witness wire.TxWitness
+		flags   ScriptFlags
+		err     ErrorCode
+	}{{
+		name:    "empty witness",
+		witness: wire.TxWitness{},
+		flags:   taprootTestFlags,
+		err:     ErrWitnessProgramEmpty,
+	}, {
+		name: "invalid signature",
+		witness: func() wire.TxWitness {
+			sig := sign(SigHashDefault)
+			sig[0] ^= 0x01
+			return wire.TxWitness{sig}
+		}(),
+		flags: taprootTestFlags,
+		err:   ErrTaprootSigInvalid,
+	}, {
+		name:    "signature too short",
+		witness: wire.TxWitness{sign(SigHashDefault)[:63]},
+		flags:   taprootTestFlags,
+		err:     ErrInvalidTaprootSigLen,
+	}, {
+		name: "explicit default sighash type",
+		witness: wire.TxWitness{
+			append(sign(SigHashDefault), byte(SigHashDefault)),
+		},
+		flags: taprootTestFlags,
+		err:   ErrInvalidSigHashType,
+	}, {
+		name: "invalid sighash type",
+		witness: wire.TxWitness{
+			append(sign(SigHashDefault), 0x04),
+		},
+		flags: taprootTestFlags,
+		err:   ErrInvalidSigHashType,
+	}, {
+		name:    "unknown witness version without taproot flag",
+		witness: wire.TxWitness{{0x01}},
+		flags:   ScriptBip16 | ScriptVerifyWitness,
+	}, {
+		name:  "discouraged witness version without taproot flag",
+		flags: taprootTestFlags &^ ScriptVerifyTaproot,
+		err:   ErrDiscourageUpgradableWitnessProgram,
+	}}
+	for _, test := range tests {
+		err := spend.execute(test.witness, test.flags, nil)
+		if test.err == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestTaprootSigCache ensures that verified taproot signatures are added to
+// the signature cache.
+func TestTaprootSigCache(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	outputKey, err := ComputeTaprootOutputKey(privKey.PubKey(), nil)
+	if err != nil {
+		t.Fatalf("unable to tweak key: %v", err)
+	}
+	spend := newTaprootTestSpend(payToTaprootTestScript(t, outputKey))
+
+	sigHash, err := CalcTaprootSignatureHash(
+		spend.sigHashes, SigHashDefault, spend.tx, 0, spend.prevOuts,
+	)
+	if err != nil {
+		t.Fatalf("unable to calc sighash: %v", err)
+	}
+	tweakedPrivKey, err := TweakTaprootPrivKey(privKey, nil)
+	if err != nil {
+		t.Fatalf("unable to tweak private key: %v", err)
+	}
+	sig, err := schnorr.Sign(tweakedPrivKey, sigHash)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+
+	// The engine parses the x-only output key, so the cache entry is keyed
+	// by the even-y form of the key.
+	outputKey, err = schnorr.ParsePubKey(schnorr.SerializePubKey(outputKey))
+	if err != nil {
+		t.Fatalf("unable to parse output key: %v", err)
+	}
+
+	var sigHashKey chainhash.Hash
+	copy(sigHashKey[:], sigHash)
+	sigCache := NewSigCache(10)
+	if sigCache.ExistsSchnorr(sigHashKey, sig, outputKey) {
+		t.Fatalf("signature unexpectedly in cache")
+	}
+
+	witness := wire.TxWitness{sig.Serialize()}
+	if err := spend.execute(witness, taprootTestFlags, sigCache); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sigCache.ExistsSchnorr(sigHashKey, sig, outputKey) {
+		t.Fatalf("signature not added to cache")
+	}
+
+	// An ECDSA lookup with the same key must not match the entry.
+	if sigCache.Exists(sigHashKey, nil, outputKey) {
+		t.Fatalf("schnorr entry matched an ECDSA lookup")
+	}
+
+	// The cached entry must be used for validation.
+	if err := spend.execute(witness, taprootTestFlags, sigCache); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestTaprootSigHashMidstate ensures that taproot sighashes calculated with
+// the precomputed midstate match the ones calculated without it.
+func TestTaprootSigHashMidstate(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	spend := newTaprootTestSpend(
+		payToTaprootTestScript(t, privKey.PubKey()),
+	)
+
+	if !spend.sigHashes.hasV1 {
+		t.Fatalf("midstate not calculated for taproot spend")
+	}
+	if NewTxSigHashes(spend.tx, nil).hasV1 {
+		t.Fatalf("midstate calculated without previous outputs")
+	}
+
+	// The version 0 sighashes must not depend on the previous outputs.
+	v0SigHashes := NewTxSigHashes(spend.tx, nil)
+	if v0SigHashes.HashPrevOuts != spend.sigHashes.HashPrevOuts ||
+		v0SigHashes.HashSequence != spend.sigHashes.HashSequence ||
+		v0SigHashes.HashOutputs != spend.sigHashes.HashOutputs {
+
+		t.Fatalf("mismatched version 0 sighashes")
+	}
+
+	hashTypes := []SigHashType{
+		SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay,
+	}
+	for _, hashType := range hashTypes {
+		for idx := range spend.tx.TxIn {
+			if hashType&sigHashMask == SigHashSingle &&
+				idx >= len(spend.tx.TxOut) {
+
+				_, err := CalcTaprootSignatureHash(
+					spend.sigHashes, hashType, spend.tx, idx,
+					spend.prevOuts,
+				)
+				if err == nil {
+					t.Fatalf("sighash single without " +
+						"output did not fail")
+				}
+				continue
+			}
+
+			want, err := CalcTaprootSignatureHash(
+				nil, hashType, spend.tx, idx, spend.prevOuts,
+			)
+			if err != nil {
+				t.Fatalf("unable to calc sighash: %v", err)
+			}
+			got, err := CalcTaprootSignatureHash(
+				spend.sigHashes, hashType, spend.tx, idx,
+				spend.prevOuts,
+			)
+			if err != nil {
+				t.Fatalf("unable to calc sighash: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("hash type %v input %d: mismatched "+
+					"sighash -- got %x, want %x", hashType,
+					idx, got, want)
+			}
+		}
+	}
+
+	// The previous outputs are required without a midstate.
+	_, err = CalcTaprootSignatureHash(
+		nil, SigHashDefault, spend.tx, 0, nil,
+	)
+	if err == nil {
+		t.Fatalf("sighash without previous outputs did not fail")
+	}
+}
+
+// testTapscriptTree is a tapscript tree used to test script path spends.
+type testTapscriptTree struct {
+	internalKey *btcec.PrivateKey
+	outputKey   *btcec.PublicKey
+	leaves      []TapLeaf
+	rootHash    chainhash.Hash
+}
+
+// newTestTapscriptTree returns a tapscript tree that commits to the passed
+// leaves, which must either be a single leaf, or four leaves that form a
+// balanced tree.
+func newTestTapscriptTree(t *testing.T, leaves ...TapLeaf) *testTapscriptTree {
+	t.Helper()
+
+	internalKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	tree := &testTapscriptTree{
+		internalKey: internalKey,
+		leaves:      leaves,
+	}
+	switch len(leaves) {
+	case 1:
+		tree.rootHash = leaves[0].TapHash()
+
+	case 4:
+		h := make([]chainhash.Hash, len(leaves))
+		for i, leaf := range leaves {
+			h[i] = leaf.TapHash()
+		}
+		left := TapBranchHash(h[0][:], h[1][:])
+		right := TapBranchHash(h[2][:], h[3][:])
+		tree.rootHash = TapBranchHash(left[:], right[:])
+
+	default:
+		t.Fatalf("unsupported number of leaves %d", len(leaves))
+	}
+
+	tree.outputKey, err = ComputeTaprootOutputKey(
+		internalKey.PubKey(), tree.rootHash[:],
+	)
+	if err != nil {
+		t.Fatalf("unable to tweak key: %v", err)
+	}
+	return tree
+}
+
+// controlBlock returns the serialized control block for the leaf at the
+// passed index.
+func (tree *testTapscriptTree) controlBlock(idx int) []byte {
+	var proof []byte
+	if len(tree.leaves) == 4 {
+		sibling := tree.leaves[idx^1].TapHash()
+		otherLeft := tree.leaves[(idx^2)&^1].TapHash()
+		otherRight := tree.leaves[(idx^2)|1].TapHash()
+		otherBranch := TapBranchHash(otherLeft[:], otherRight[:])
+		proof = append(proof, sibling[:]...)
+		proof = append(proof, otherBranch[:]...)
+	}
+
+	controlBlock := ControlBlock{
+		InternalKey: tree.internalKey.PubKey(),
+		OutputKeyYIsOdd: tree.outputKey.SerializeCompressed()[0] ==
+			0x03,
+		LeafVersion:    tree.leaves[idx].LeafVersion,
+		InclusionProof: proof,
+	}
+	return controlBlock.ToBytes()
+}
+
+// signTapscript returns a tapscript signature of the first input of the
+// passed spend for the passed leaf.
+func signTapscript(t *testing.T, spend *taprootTestSpend,
+	privKey *btcec.PrivateKey, leaf TapLeaf,
+	opts ...TaprootSigHashOption) []byte {
+
+	t.Helper()
+
+	sigHash, err := CalcTapscriptSignaturehash(
+		spend.sigHashes, SigHashDefault, spend.tx, 0, spend.prevOuts,
+		leaf, opts...,
+	)
+	if err != nil {
+		t.Fatalf("unable to calc sighash: %v", err)
+	}
+	sig, err := schnorr.Sign(privKey, sigHash)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	return sig.Serialize()
+}
+
+// mustParseShortFormTest parses the passed short form script and fails the
+// test if it can't be parsed.
+func mustParseShortFormTest(t *testing.T, script string) []byte {
+	t.Helper()
+
+	s, err := parseShortForm(script)
+	if err != nil {
+		t.Fatalf("unable to parse script %q: %v", script, err)
+	}
+	return s
+}
+
+// TestTaprootScriptPathSpend ensures that script path spends of taproot
+// outputs validate according to the tapscript rules.
+func TestTaprootScriptPathSpend(t *testing.T) {
+	t.Parallel()
+
+	keyA, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	keyB, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	pkA := schnorr.SerializePubKey(keyA.PubKey())
+	pkB := schnorr.SerializePubKey(keyB.PubKey())
+
+	builder := func() *ScriptBuilder { return NewScriptBuilder() }
+	checkSigScript, _ := builder().AddData(pkA).AddOp(OP_CHECKSIG).Script()
+	checkSigAddScript, _ := builder().AddData(pkA).AddOp(OP_CHECKSIG).
+		AddData(pkB).AddOp(OP_CHECKSIGADD).AddOp(OP_2).
+		AddOp(OP_NUMEQUAL).Script()
+	opSuccessScript := []byte{OP_RESERVED, OP_PUSHDATA1}
+	codeSepScript, _ := builder().AddOp(OP_1).AddOp(OP_DROP).
+		AddOp(OP_CODESEPARATOR).AddData(pkA).AddOp(OP_CHECKSIG).Script()
+
+	leaves := []TapLeaf{
+		NewBaseTapLeaf(checkSigScript),
+		NewBaseTapLeaf(checkSigAddScript),
+		NewBaseTapLeaf(opSuccessScript),
+		NewBaseTapLeaf(codeSepScript),
+	}
+	tree := newTestTapscriptTree(t, leaves...)
+	spend := newTaprootTestSpend(payToTaprootTestScript(t, tree.outputKey))
+
+	sigA := signTapscript(t, spend, keyA, leaves[0])
+	sigAddA := signTapscript(t, spend, keyA, leaves[1])
+	sigAddB := signTapscript(t, spend, keyB, leaves[1])
+	annex := []byte{TaprootAnnexTag}
+	codeSepLeafHash := leaves[3].TapHash()
+
+	tests := []struct {
+		name    string
+		witness wire.TxWitness
+		flags   ScriptFlags
+		err     ErrorCode
+	}{{
+		name: "checksig",
+		witness: wire.TxWitness{
+			sigA, checkSigScript, tree.controlBlock(0),
+		},
+		flags: taprootTestFlags,
+	}, {
+		name: "checksig without signature",
+		witness: wire.TxWitness{
+			nil, checkSigScript, tree.controlBlock(0),
+		},
+		flags: taprootTestFlags,
+		err:   ErrEvalFalse,
+	}, {
+		name: "checksig with invalid signature",
+		witness: wire.TxWitness{
+			sigAddA, checkSigScript, tree.controlBlock(0),
+		},
+		flags: taprootTestFlags,
+		err:   ErrTaprootSigInvalid,
+	}, {
+		name: "checksig with annex",
+		witness: wire.TxWitness{
+			signTapscript(t, spend, keyA, leaves[0], WithAnnex(annex)),
+			checkSigScript, tree.controlBlock(0), annex,
+		},
+		flags: taprootTestFlags,
+	}, {
+		name: "checksig with wrong control block",
+		witness: wire.TxWitness{
+			sigA, checkSigScript, tree.controlBlock(1),
+		},
+		flags: taprootTestFlags,
+		err:   ErrTaprootMerkleProofInvalid,
+	}, {
+		name: "checksig with wrong control block parity",
+		witness: func() wire.TxWitness {
+			controlBlock := tree.controlBlock(0)
+			controlBlock[0] ^= 0x01
+			return wire.TxWitness{
+				sigA, checkSigScript, controlBlock,
+			}
+		}(),
+		flags: taprootTestFlags,
+		err:   ErrTaprootMerkleProofInvalid,
+	}, {
+		name: "control block too small",
+		witness: wire.TxWitness{
+			sigA, checkSigScript, tree.controlBlock(0)[:32],
+		},
+		flags: taprootTestFlags,
+		err:   ErrControlBlockTooSmall,
+	}, {
+		name: "control block with invalid length",
+		witness: wire.TxWitness{
+			sigA, checkSigScript,
+			append(tree.controlBlock(0), 0x00),
+		},
+		flags: taprootTestFlags,
+		err:   ErrControlBlockInvalidLength,
+	}, {
+		name: "control block too large",
+		witness: wire.TxWitness{
+			sigA, checkSigScript,
+			make([]byte, ControlBlockMaxSize+ControlBlockNodeSize),
+		},
+		flags: taprootTestFlags,
+		err:   ErrControlBlockTooLarge,
+	}, {
+		name: "checksigadd",
+		witness: wire.TxWitness{
+			sigAddB, sigAddA, checkSigAddScript,
+			tree.controlBlock(1),
+		},
+		flags: taprootTestFlags,
+	}, {
+		name: "checksigadd with missing signature",
+		witness: wire.TxWitness{
+			nil, sigAddA, checkSigAddScript, tree.controlBlock(1),
+		},
+		flags: taprootTestFlags,
+		err:   ErrEvalFalse,
+	}, {
+		name: "op_success",
+		witness: wire.TxWitness{
+			opSuccessScript, tree.controlBlock(2),
+		},
+		flags: taprootTestFlags &^ ScriptVerifyDiscourageOpSuccess,
+	}, {
+		name: "discouraged op_success",
+		witness: wire.TxWitness{
+			opSuccessScript, tree.controlBlock(2),
+		},
+		flags: taprootTestFlags,
+		err:   ErrDiscourageOpSuccess,
+	}, {
+		name: "codeseparator",
+		witness: wire.TxWitness{
+			signTapscript(t, spend, keyA, leaves[3],
+				WithBaseTapscriptVersion(2, codeSepLeafHash[:])),
+			codeSepScript, tree.controlBlock(3),
+		},
+		flags: taprootTestFlags,
+	}, {
+		name: "codeseparator without position commitment",
+		witness: wire.TxWitness{
+			signTapscript(t, spend, keyA, leaves[3]),
+			codeSepScript, tree.controlBlock(3),
+		},
+		flags: taprootTestFlags,
+		err:   ErrTaprootSigInvalid,
+	}}
+	for _, test := range tests {
+		err := spend.execute(test.witness, test.flags, nil)
+		if test.err == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestTapscriptRules ensures that the execution rules specific to tapscript
+// are enforced.
+func TestTapscriptRules(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	pubKey := schnorr.SerializePubKey(privKey.PubKey())
+
+	// sigOpsScript returns a script that checks the same signature the
+	// passed number of times.
+	sigOpsScript := func(numSigOps int) []byte {
+		builder := NewScriptBuilder().AddData(pubKey)
+		for i := 0; i < numSigOps; i++ {
+			builder.AddOp(OP_2DUP).AddOp(OP_CHECKSIGVERIFY)
+		}
+		script, _ := builder.AddOp(OP_2DROP).AddOp(OP_1).Script()
+		return script
+	}
+
+	tests := []struct {
+		name        string
+		script      []byte
+		leafVersion TapscriptLeafVersion
+		stack       wire.TxWitness
+		sign        bool
+		flags       ScriptFlags
+		err         ErrorCode
+	}{{
+		name:   "sig ops within budget",
+		script: sigOpsScript(3),
+		sign:   true,
+		flags:  taprootTestFlags,
+	}, {
+		name:   "sig ops exceed budget",
+		script: sigOpsScript(10),
+		sign:   true,
+		flags:  taprootTestFlags,
+		err:    ErrTaprootMaxSigOps,
+	}, {
+		name:   "checkmultisig",
+		script: mustParseShortFormTest(t, "0 0 0 CHECKMULTISIG"),
+		flags:  taprootTestFlags,
+		err:    ErrTapscriptCheckMultisig,
+	}, {
+		name:   "checkmultisigverify",
+		script: mustParseShortFormTest(t, "0 0 0 CHECKMULTISIGVERIFY 1"),
+		flags:  taprootTestFlags,
+		err:    ErrTapscriptCheckMultisig,
+	}, {
+		name:   "minimal if without flag",
+		script: mustParseShortFormTest(t, "IF 1 ENDIF"),
+		stack:  wire.TxWitness{{0x02}},
+		flags:  ScriptBip16 | ScriptVerifyWitness | ScriptVerifyTaproot,
+		err:    ErrMinimalIf,
+	}, {
+		name:   "minimal if",
+		script: mustParseShortFormTest(t, "IF 1 ENDIF"),
+		stack:  wire.TxWitness{{0x01}},
+		flags:  ScriptBip16 | ScriptVerifyWitness | ScriptVerifyTaproot,
+	}, {
+		name:   "unclean stack",
+		script: mustParseShortFormTest(t, "1 1"),
+		flags:  ScriptBip16 | ScriptVerifyWitness | ScriptVerifyTaproot,
+		err:    ErrCleanStack,
+	}, {
+		name:   "empty public key",
+		script: mustParseShortFormTest(t, "0 CHECKSIG"),
+		stack:  wire.TxWitness{{0x01}},
+		flags:  taprootTestFlags,
+		err:    ErrTaprootPubkeyIsEmpty,
+	}, {
+		name:   "unknown public key type",
+		script: mustParseShortFormTest(t, "0x02 0x0101 CHECKSIG"),
+		stack:  wire.TxWitness{{0x01}},
+		flags:  taprootTestFlags &^ ScriptVerifyDiscourageUpgradeablePubkeyType,
+	}, {
+		name:   "discouraged unknown public key type",
+		script: mustParseShortFormTest(t, "0x02 0x0101 CHECKSIG"),
+		stack:  wire.TxWitness{{0x01}},
+		flags:  taprootTestFlags,
+		err:    ErrDiscourageUpgradeablePubKeyType,
+	}, {
+		name:   "stack element too large",
+		script: mustParseShortFormTest(t, "DROP 1"),
+		stack:  wire.TxWitness{make([]byte, MaxScriptElementSize+1)},
+		flags:  taprootTestFlags,
+		err:    ErrElementTooBig,
+	}, {
+		name: "no operation limit",
+		script: func() []byte {
+			script := make([]byte, MaxOpsPerScript+1)
+			for i := range script {
+				script[i] = OP_NOP
+			}
+			return append(script, OP_1)
+		}(),
+		flags: taprootTestFlags,
+	}, {
+		name: "checksigadd with empty signature",
+		script: mustParseShortFormTest(t, "0 0 0x20 0x"+
+			"0000000000000000000000000000000000000000000000000000000000000000"+
+			" CHECKSIGADD 0 EQUAL"),
+		flags: taprootTestFlags,
+	}, {
+		name:        "unknown leaf version",
+		script:      []byte{OP_RETURN},
+		leafVersion: 0xc2,
+		flags:       taprootTestFlags &^ ScriptVerifyDiscourageUpgradeableTaprootVersion,
+	}, {
+		name:        "discouraged unknown leaf version",
+		script:      []byte{OP_RETURN},
+		leafVersion: 0xc2,
+		flags:       taprootTestFlags,
+		err:         ErrDiscourageUpgradeableTaprootVersion,
+	}}
+	for _, test := range tests {
+		leafVersion := test.leafVersion
+		if leafVersion == 0 {
+			leafVersion = BaseLeafVersion
+		}
+		leaf := NewTapLeaf(leafVersion, test.script)
+		tree := newTestTapscriptTree(t, leaf)
+		spend := newTaprootTestSpend(
+			payToTaprootTestScript(t, tree.outputKey),
+		)
+
+		witness := append(wire.TxWitness{}, test.stack...)
+		if test.sign {
+			sig := signTapscript(t, spend, privKey, leaf)
+			witness = append(witness, sig)
+		}
+		witness = append(witness, test.script, tree.controlBlock(0))
+
+		err := spend.execute(witness, test.flags, nil)
+		if test.err == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if !IsErrorCode(err, test.err) {
+			t.Errorf("%s: mismatched error -- got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestCheckSigAddOutsideTapscript ensures that OP_CHECKSIGADD is an invalid
+// opcode outside of tapscript.
+func TestCheckSigAddOutsideTapscript(t *testing.T) {
+	t.Parallel()
+
+	pkScript := mustParseShortFormTest(t, "0 0 0 CHECKSIGADD")
+	tx := createSpendingTx(nil, nil, pkScript, 0)
+	vm, err := NewEngine(pkScript, tx, 0, StandardVerifyFlags, nil, nil, 0,
+		nil)
+	if err != nil {
+		t.Fatalf("unable to create engine: %v", err)
+	}
+	if err := vm.Execute(); !IsErrorCode(err, ErrReservedOpcode) {
+		t.Fatalf("mismatched error -- got %v, want %v", err,
+			ErrReservedOpcode)
+	}
+}
+
+// TestTaprootSigningHelpers ensures that the signatures created by the taproot
+// signing helpers are accepted by the engine for both key path and script
+// path spends.
+func TestTaprootSigningHelpers(t *testing.T) {
+	t.Parallel()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	// A key path spend of an output that doesn't commit to any scripts.
+	outputKey, err := ComputeTaprootKeyNoScript(privKey.PubKey())
+	if err != nil {
+		t.Fatalf("unable to tweak key: %v", err)
+	}
+	spend := newTaprootTestSpend(payToTaprootTestScript(t, outputKey))
+	amt := spend.tx.TxOut[0].Value
+	for _, hashType := range []SigHashType{SigHashDefault, SigHashAll} {
+		witness, err := TaprootWitnessSignature(
+			spend.tx, spend.sigHashes, 0, amt, spend.pkScript,
+			hashType, privKey,
+		)
+		if err != nil {
+			t.Fatalf("unable to sign with hash type %v: %v",
+				hashType, err)
+		}
+		err = spend.execute(witness, taprootTestFlags, nil)
+		if err != nil {
+			t.Fatalf("key path spend with hash type %v: %v",
+				hashType, err)
+		}
+	}
+
+	// Signing with a key that doesn't match the output must fail.
+	otherKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	_, err = TaprootWitnessSignature(
+		spend.tx, spend.sigHashes, 0, amt, spend.pkScript,
+		SigHashDefault, otherKey,
+	)
+	if err == nil {
+		t.Fatalf("signed with a key that doesn't match the output")
+	}
+
+	// Sighashes without the taproot midstate can't be used.
+	_, err = TaprootWitnessSignature(
+		spend.tx, NewTxSigHashes(spend.tx, nil), 0, amt,
+		spend.pkScript, SigHashDefault, privKey,
+	)
+	if err == nil {
+		t.Fatalf("signed without the taproot midstate")
+	}
+
+	// Both the key path and the script path of an output that commits to
+	// a tapscript tree.
+	leafKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	leafScript, err := NewScriptBuilder().
+		AddData(schnorr.SerializePubKey(leafKey.PubKey())).
+		AddOp(OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatalf("unable to create leaf script: %v", err)
+	}
+	leaf := NewBaseTapLeaf(leafScript)
+	tree := newTestTapscriptTree(t, leaf)
+	spend = newTaprootTestSpend(payToTaprootTestScript(t, tree.outputKey))
+
+	sig, err := RawTxInTaprootSignature(
+		spend.tx, spend.sigHashes, 0, amt, spend.pkScript,
+		tree.rootHash[:], SigHashDefault, tree.internalKey,
+	)
+	if err != nil {
+		t.Fatalf("unable to sign key path: %v", err)
+	}
+	err = spend.execute(wire.TxWitness{sig}, taprootTestFlags, nil)
+	if err != nil {
+		t.Fatalf("key path spend with script root: %v", err)
+	}
+
+	sig, err = RawTxInTapscriptSignature(
+		spend.tx, spend.sigHashes, 0, amt, spend.pkScript, leaf,
+		SigHashAll, leafKey,
+	)
+	if err != nil {
+		t.Fatalf("unable to sign script path: %v", err)
+	}
+	witness := wire.TxWitness{sig, leafScript, tree.controlBlock(0)}
+	if err := spend.execute(witness, taprootTestFlags, nil); err != nil {
+		t.Fatalf("script path spend: %v", err)
+	}
+}
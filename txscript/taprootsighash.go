@@ -0,0 +1,362 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+// sigHashExtFlag represents the sig hash extension flag as defined in BIP 341.
+// Extensions to the base sighash algorithm will be appended to the base
+// sighash digest.
+type sigHashExtFlag uint8
+
+const (
+	// baseSigHashExtFlag is the base extension flag.  This adds no
+	// changes to the sighash digest message.  This is used for segwit v1
+	// key path spends.
+	baseSigHashExtFlag sigHashExtFlag = 0
+
+	// tapscriptSighashExtFlag is the extension flag defined by tapscript
+	// base leaf version spend defined in BIP 342.  This augments the base
+	// sighash by including the tapscript leaf hash, the key version, and
+	// the position of the last executed OP_CODESEPARATOR.
+	tapscriptSighashExtFlag sigHashExtFlag = 1
+)
+
+// taprootSigHashOptions houses a set of functional options that may optionally
+// modify how the taproot/script-path sighash digest algorithm is
+// implemented.
+type taprootSigHashOptions struct {
+	// extFlag denotes the current message digest extension being used.
+	extFlag sigHashExtFlag
+
+	// annexHash is the sha256 hash of the annex with a compact size length
+	// prefix: sha256(compactsize(annex) || annex).
+	annexHash []byte
+
+	// tapLeafHash is the hash of the tapscript leaf as defined in BIP 341.
+	// This should be h_tapleaf(version || compactsize(script) || script).
+	tapLeafHash []byte
+
+	// keyVersion is the key version as defined in BIP 341.  This is always
+	// 0x00 for all currently defined leaf versions.
+	keyVersion byte
+
+	// codeSepPos is the opcode position of the last executed
+	// OP_CODESEPARATOR, or 0xffffffff if none have been executed.
+	codeSepPos uint32
+}
+
+// defaultTaprootSighashOptions returns the set of default options for the
+// taproot sighash digest calculation.
+func defaultTaprootSighashOptions() *taprootSigHashOptions {
+	return &taprootSigHashOptions{
+		codeSepPos: blankCodeSepValue,
+	}
+}
+
+// writeDigestExtensions writes out the sighash message extension defined by
+// the current active sigHashExtFlags.
+func (t *taprootSigHashOptions) writeDigestExtensions(w *bytes.Buffer) {
+	switch t.extFlag {
+	// The base extension, used for tapscript keypath spends doesn't
+	// modify the digest at all.
+	case baseSigHashExtFlag:
+		return
+
+	// The tapscript base leaf version extension adds the leaf hash, key
+	// version, and code separator position to the final digest.
+	case tapscriptSighashExtFlag:
+		w.Write(t.tapLeafHash)
+		w.WriteByte(t.keyVersion)
+
+		var bCodeSepPos [4]byte
+		binary.LittleEndian.PutUint32(bCodeSepPos[:], t.codeSepPos)
+		w.Write(bCodeSepPos[:])
+	}
+}
+
+// TaprootSigHashOption defines a set of functional param options that can be
+// used to modify the base sighash message with optional extensions.
+type TaprootSigHashOption func(*taprootSigHashOptions)
+
+// WithAnnex is a functional option that allows the caller to specify the
+// existence of an annex in the final witness stack for the taproot/tapscript
+// spends.
+func WithAnnex(annex []byte) TaprootSigHashOption {
+	return func(o *taprootSigHashOptions) {
+		// It's just a bytes.Buffer which never returns an error on
+		// write.
+		var b bytes.Buffer
+		_ = wire.WriteVarBytes(&b, 0, annex)
+
+		annexHash := sha256.Sum256(b.Bytes())
+		o.annexHash = annexHash[:]
+	}
+}
+
+// WithBaseTapscriptVersion is a functional option that specifies that the
+// sighash digest should include the extra information included as part of
+// the base tapscript version.
+func WithBaseTapscriptVersion(codeSepPos uint32,
+	tapLeafHash []byte) TaprootSigHashOption {
+
+	return func(o *taprootSigHashOptions) {
+		o.extFlag = tapscriptSighashExtFlag
+		o.tapLeafHash = tapLeafHash
+		o.keyVersion = 0
+		o.codeSepPos = codeSepPos
+	}
+}
+
+// isValidTaprootSigHash returns true if the passed sighash is a valid taproot
+// sighash.
+func isValidTaprootSigHash(hashType SigHashType) bool {
+	switch hashType {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle:
+		return true
+	case 0x81, 0x82, 0x83:
+		return true
+	default:
+		return false
+	}
+}
+
+// taprootSigHashes returns the passed sighashes when they house the BIP 341
+// midstate, and calculates the midstate from the previous outputs otherwise.
+func taprootSigHashes(sigHashes *TxSigHashes, tx *wire.MsgTx,
+	prevOutFetcher PrevOutputFetcher) (*TxSigHashes, error) {
+
+	if sigHashes != nil && sigHashes.hasV1 {
+		return sigHashes, nil
+	}
+	if prevOutFetcher == nil {
+		return nil, fmt.Errorf("the previous outputs of all inputs are " +
+			"required to calculate a taproot sighash")
+	}
+
+	return &TxSigHashes{
+		HashPrevOutsV1:     calcHashPrevOuts(tx),
+		HashSequenceV1:     calcHashSequence(tx),
+		HashOutputsV1:      calcHashOutputs(tx),
+		HashInputAmountsV1: calcHashInputAmounts(tx, prevOutFetcher),
+		HashInputScriptsV1: calcHashInputScripts(tx, prevOutFetcher),
+		hasV1:              true,
+	}, nil
+}
+
+// calcTaprootSignatureHashRaw computes the sighash as specified in BIP 341.
+// The BIP 341 midstate within the passed sighashes is used when present in
+// order to avoid hashing the transaction for every input.
+func calcTaprootSignatureHashRaw(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int, prevOutFetcher PrevOutputFetcher,
+	sigHashOptions ...TaprootSigHashOption) ([]byte, error) {
+
+	opts := defaultTaprootSighashOptions()
+	for _, sigHashOpt := range sigHashOptions {
+		sigHashOpt(opts)
+	}
+
+	// If a valid sighash type isn't passed in, then we'll exit early.
+	if !isValidTaprootSigHash(hType) {
+		return nil, fmt.Errorf("invalid taproot sighash type: %v", hType)
+	}
+
+	// As a sanity check, ensure the passed input index for the transaction
+	// is valid.
+	if idx > len(tx.TxIn)-1 {
+		return nil, fmt.Errorf("idx %d but %d txins", idx, len(tx.TxIn))
+	}
+
+	// If this is the sighash single type, then there must be an output
+	// with the same index as the input being signed.
+	if hType&sigHashMask == SigHashSingle && idx >= len(tx.TxOut) {
+		return nil, fmt.Errorf("sighash single with idx %d but only %d "+
+			"txouts", idx, len(tx.TxOut))
+	}
+
+	var err error
+	sigHashes, err = taprootSigHashes(sigHashes, tx, prevOutFetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	// We'll utilize this buffer throughout to incrementally calculate
+	// the signature hash for this transaction.
+	var sigMsg bytes.Buffer
+
+	// The final sighash always has a value of 0x00 prepended to it, which
+	// is called the sighash epoch.
+	sigMsg.WriteByte(0x00)
+
+	// First, we write the hash type encoded as a single byte.
+	if err := sigMsg.WriteByte(byte(hType)); err != nil {
+		return nil, err
+	}
+
+	// Next we'll write out the transaction specific data which binds the
+	// outer context of the sighash.
+	var bVersion [4]byte
+	binary.LittleEndian.PutUint32(bVersion[:], uint32(tx.Version))
+	sigMsg.Write(bVersion[:])
+
+	var bLockTime [4]byte
+	binary.LittleEndian.PutUint32(bLockTime[:], tx.LockTime)
+	sigMsg.Write(bLockTime[:])
+
+	// If sighash isn't anyone can pay, then we'll include all the
+	// pre-computed midstate digests in the sighash.
+	if hType&SigHashAnyOneCanPay != SigHashAnyOneCanPay {
+		sigMsg.Write(sigHashes.HashPrevOutsV1[:])
+		sigMsg.Write(sigHashes.HashInputAmountsV1[:])
+		sigMsg.Write(sigHashes.HashInputScriptsV1[:])
+		sigMsg.Write(sigHashes.HashSequenceV1[:])
+	}
+
+	// If this is sighash all, or its taproot alias (sighash default),
+	// then we'll also include the pre-computed digest of all the outputs
+	// of the transaction.
+	if hType&sigHashMask != SigHashSingle &&
+		hType&sigHashMask != SigHashNone {
+
+		sigMsg.Write(sigHashes.HashOutputsV1[:])
+	}
+
+	// Next, we'll write out the relevant information for this specific
+	// input.
+	//
+	// The spend type is computed as the (ext_flag*2) + annex_present.  We
+	// use this to bind the extension flag (that BIP 342 uses), as well as
+	// the annex if its present.
+	input := tx.TxIn[idx]
+	witnessHasAnnex := opts.annexHash != nil
+	spendType := byte(opts.extFlag) * 2
+	if witnessHasAnnex {
+		spendType++
+	}
+
+	if err := sigMsg.WriteByte(spendType); err != nil {
+		return nil, err
+	}
+
+	// If anyone can pay is active, then we'll write out just the specific
+	// information about this input, given we skipped writing all the
+	// information of all the inputs above.
+	if hType&SigHashAnyOneCanPay == SigHashAnyOneCanPay {
+		// We'll start out with writing this input specific information
+		// by first writing the entire previous outpoint.
+		sigMsg.Write(input.PreviousOutPoint.Hash[:])
+		var bIndex [4]byte
+		binary.LittleEndian.PutUint32(
+			bIndex[:], input.PreviousOutPoint.Index,
+		)
+		sigMsg.Write(bIndex[:])
+
+		// Next, we'll write out the previous output (amt+script) being
+		// spent itself.
+		var prevOut *wire.TxOut
+		if prevOutFetcher != nil {
+			prevOut = prevOutFetcher.FetchPrevOutput(
+				input.PreviousOutPoint,
+			)
+		}
+		if prevOut == nil {
+			return nil, fmt.Errorf("unable to find previous output "+
+				"%v", input.PreviousOutPoint)
+		}
+		if err := wire.WriteTxOut(&sigMsg, 0, 0, prevOut); err != nil {
+			return nil, err
+		}
+
+		// Finally, we'll write out the input sequence itself.
+		var bSequence [4]byte
+		binary.LittleEndian.PutUint32(bSequence[:], input.Sequence)
+		sigMsg.Write(bSequence[:])
+	} else {
+		var bIndex [4]byte
+		binary.LittleEndian.PutUint32(bIndex[:], uint32(idx))
+		sigMsg.Write(bIndex[:])
+	}
+
+	// Now that we have the input specific information written, we'll
+	// include the annex, if we have it.
+	if witnessHasAnnex {
+		sigMsg.Write(opts.annexHash)
+	}
+
+	// Finally, if this is sighash single, then we'll write out the
+	// information for this given output.
+	if hType&sigHashMask == SigHashSingle {
+		// Now that we know this is a valid sighash single input, we'll
+		// write out the single output being signed.
+		var b bytes.Buffer
+		if err := wire.WriteTxOut(&b, 0, 0, tx.TxOut[idx]); err != nil {
+			return nil, err
+		}
+		singleOutputHash := sha256.Sum256(b.Bytes())
+		sigMsg.Write(singleOutputHash[:])
+	}
+
+	// Now that we've written out all the base information, we'll write any
+	// message extensions (if they exist).
+	opts.writeDigestExtensions(&sigMsg)
+
+	// The final sighash is computed as: hash_TagSigHash(0x00 || sigMsg).
+	// We wrote the 0x00 above so we don't need to append here and incur
+	// extra allocations.
+	sigHash := chainhash.TaggedHash(chainhash.TagTapSighash, sigMsg.Bytes())
+	return sigHash[:], nil
+}
+
+// CalcTaprootSignatureHash computes the sighash digest of a transaction's
+// taproot-spending input using the new sighash digest algorithm described in
+// BIP 341.  As the new digest algorithm may require the digest to commit to
+// the entire prev output, the caller must supply a fetcher that is able to
+// return the outputs spent by all of the inputs of the transaction.
+//
+// NOTE: This function is used for key path spends.  Script path spends must
+// use CalcTapscriptSignaturehash instead.
+func CalcTaprootSignatureHash(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int,
+	prevOutFetcher PrevOutputFetcher) ([]byte, error) {
+
+	return calcTaprootSignatureHashRaw(
+		sigHashes, hType, tx, idx, prevOutFetcher,
+	)
+}
+
+// CalcTapscriptSignaturehash computes the sighash digest of a transaction's
+// taproot-spending input using the new sighash digest algorithm described in
+// BIP 341.  As the new digest algorithm may require the digest to commit to
+// the entire prev output, the caller must supply a fetcher that is able to
+// return the outputs spent by all of the inputs of the transaction.  The
+// sighash also commits to the passed tapscript leaf, and assumes that no
+// OP_CODESEPARATOR was executed before the signature check unless the caller
+// overrides the position with WithBaseTapscriptVersion.
+//
+// NOTE: This function is used for script path spends.  Key path spends must
+// use CalcTaprootSignatureHash instead.
+func CalcTapscriptSignaturehash(sigHashes *TxSigHashes, hType SigHashType,
+	tx *wire.MsgTx, idx int, prevOutFetcher PrevOutputFetcher,
+	tapLeaf TapLeaf,
+	sigHashOpts ...TaprootSigHashOption) ([]byte, error) {
+
+	tapLeafHash := tapLeaf.TapHash()
+
+	opts := []TaprootSigHashOption{
+		WithBaseTapscriptVersion(blankCodeSepValue, tapLeafHash[:]),
+	}
+	opts = append(opts, sigHashOpts...)
+	return calcTaprootSignatureHashRaw(
+		sigHashes, hType, tx, idx, prevOutFetcher, opts...,
+	)
+}
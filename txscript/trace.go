@@ -0,0 +1,60 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+// TraceStep describes the execution of a single opcode by the script engine
+// along with the state of the stacks once it has executed.
+type TraceStep struct {
+	// ScriptIdx is the index of the script the opcode belongs to.  Index 0
+	// is the signature script and 1 is the public key script, followed by
+	// the redeem script and the witness script as applicable.
+	ScriptIdx int
+
+	// OpcodeIdx is the index of the opcode within its script.
+	OpcodeIdx int
+
+	// Opcode is the disassembly of the opcode, including any data it
+	// pushes.
+	Opcode string
+
+	// Executed is whether the opcode was executed as opposed to skipped
+	// due to being in a conditional branch that isn't executing.
+	Executed bool
+
+	// Stack and AltStack are the contents of the data and alternate stacks
+	// after the opcode executed, where the last item is the top of the
+	// stack.  The items must not be modified.
+	Stack    [][]byte
+	AltStack [][]byte
+
+	// Err is the error that caused the opcode to fail, if any.  Execution
+	// stops at the first failed opcode.
+	Err error
+}
+
+// ExecutionTracer is the interface that must be implemented by types that
+// observe the execution of scripts by the engine.  It is set with
+// Engine.SetTracer.
+type ExecutionTracer interface {
+	// TraceStep is invoked after each opcode the engine steps through,
+	// including those that fail.
+	TraceStep(step *TraceStep)
+}
+
+// TraceRecorder is an ExecutionTracer that records every step of the
+// execution in order.
+type TraceRecorder struct {
+	Steps []TraceStep
+}
+
+// TraceStep records the passed step.
+//
+// This is part of the ExecutionTracer interface.
+func (r *TraceRecorder) TraceStep(step *TraceStep) {
+	r.Steps = append(r.Steps, *step)
+}
+
+// Ensure TraceRecorder implements the ExecutionTracer interface.
+var _ ExecutionTracer = (*TraceRecorder)(nil)
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/babylonchain-io/bbld/wire"
+)
+
+const (
+	// uploadTargetTimeframe is the duration of the cycles the upload target
+	// applies to.
+	uploadTargetTimeframe = 24 * time.Hour
+
+	// historicalBlockAge is the age, relative to the best chain tip, beyond
+	// which a block is considered historical and is no longer served to
+	// peers which are not whitelisted once the upload target is reached.
+	historicalBlockAge = 7 * 24 * time.Hour
+
+	// uploadTargetBlockInterval is the expected time between blocks for
+	// which room is kept in the upload target to relay new blocks.
+	uploadTargetBlockInterval = 10 * time.Minute
+
+	// uploadTargetReserve is the room kept at the start of a cycle to relay
+	// a maximum sized block every uploadTargetBlockInterval.  Upload targets
+	// must exceed it for historical blocks to be served at all.
+	uploadTargetReserve = uint64(uploadTargetTimeframe/
+		uploadTargetBlockInterval) * wire.MaxBlockPayload
+)
+
+// uploadTargetStatus describes the state of the upload target in the current
+// cycle.
+type uploadTargetStatus struct {
+	target                uint64
+	targetReached         bool
+	serveHistoricalBlocks bool
+	bytesLeftInCycle      uint64
+	timeLeftInCycle       time.Duration
+}
+
+// uploadTarget keeps track of the bytes sent to all peers in cycles of
+// uploadTargetTimeframe to keep the upload traffic below a target.  The cycle
+// starts with the first bytes sent after the previous one ended.
+type uploadTarget struct {
+	mtx         sync.Mutex
+	target      uint64
+	cycleStart  time.Time
+	sentInCycle uint64
+}
+
+// newUploadTarget returns an upload target of the passed number of bytes per
+// cycle.  A target of zero means there is no limit.
+func newUploadTarget(target uint64) *uploadTarget {
+	return &uploadTarget{target: target}
+}
+
+// addBytesSent records the passed number of bytes sent at the passed time.
+func (u *uploadTarget) addBytesSent(n uint64, now time.Time) {
+	u.mtx.Lock()
+	if u.cycleStart.IsZero() || now.Sub(u.cycleStart) > uploadTargetTimeframe {
+		u.cycleStart = now
+		u.sentInCycle = 0
+	}
+	u.sentInCycle += n
+	u.mtx.Unlock()
+}
+
+// timeLeftInCycle returns the time left in the current cycle.
+//
+// This function MUST be called with the upload target lock held.
+func (u *uploadTarget) timeLeftInCycle(now time.Time) time.Duration {
+	if u.cycleStart.IsZero() {
+		return uploadTargetTimeframe
+	}
+	left := u.cycleStart.Add(uploadTargetTimeframe).Sub(now)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// reached returns whether the upload target is reached at the passed time.
+// When historical is set, room is kept to relay a maximum sized block every
+// uploadTargetBlockInterval for the rest of the cycle, so historical blocks
+// stop being served before new blocks can no longer be relayed.
+//
+// This function MUST be called with the upload target lock held.
+func (u *uploadTarget) reached(historical bool, now time.Time) bool {
+	if u.target == 0 {
+		return false
+	}
+	if historical {
+		blocks := uint64(u.timeLeftInCycle(now) / uploadTargetBlockInterval)
+		reserve := blocks * wire.MaxBlockPayload
+		return reserve >= u.target || u.sentInCycle >= u.target-reserve
+	}
+	return u.sentInCycle >= u.target
+}
+
+// historicalBlocksAllowed returns whether historical blocks may be served to
+// peers which are not whitelisted at the passed time.
+func (u *uploadTarget) historicalBlocksAllowed(now time.Time) bool {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	return !u.reached(true, now)
+}
+
+// status returns the state of the upload target at the passed time.
+func (u *uploadTarget) status(now time.Time) uploadTargetStatus {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	status := uploadTargetStatus{
+		target:                u.target,
+		targetReached:         u.reached(false, now),
+		serveHistoricalBlocks: !u.reached(true, now),
+	}
+	if u.target == 0 {
+		return status
+	}
+	if u.sentInCycle < u.target {
+		status.bytesLeftInCycle = u.target - u.sentInCycle
+	}
+	status.timeLeftInCycle = u.timeLeftInCycle(now)
+	return status
+}
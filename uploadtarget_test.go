@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUploadTarget ensures the upload target stops serving historical blocks
+// while keeping room to relay new blocks, and that the cycle is reset once it
+// ends.
+func TestUploadTarget(t *testing.T) {
+	// The reserve to relay new blocks for the whole cycle is the minimum
+	// upload target documented for the maxuploadtarget option.
+	reserve := uploadTargetReserve
+	if reserve != 576000000 {
+		t.Fatalf("reserve is %d bytes, documented as 576000000", reserve)
+	}
+
+	now := time.Now()
+	u := newUploadTarget(reserve + 1000)
+	status := u.status(now)
+	if status.targetReached || !status.serveHistoricalBlocks ||
+		status.bytesLeftInCycle != reserve+1000 ||
+		status.timeLeftInCycle != uploadTargetTimeframe {
+
+		t.Fatalf("unexpected status for new target: %+v", status)
+	}
+
+	// Historical blocks are no longer served once the target minus the
+	// reserve is reached.
+	u.addBytesSent(999, now)
+	if !u.historicalBlocksAllowed(now) {
+		t.Fatalf("historical blocks not allowed below the target")
+	}
+	u.addBytesSent(1, now)
+	if u.historicalBlocksAllowed(now) {
+		t.Fatalf("historical blocks allowed once the target minus " +
+			"the reserve is reached")
+	}
+
+	// The reserve shrinks as the cycle goes by.
+	later := now.Add(uploadTargetTimeframe / 2)
+	if !u.historicalBlocksAllowed(later) {
+		t.Fatalf("historical blocks not allowed with a smaller reserve")
+	}
+
+	// The target itself is reached once all of the bytes are sent.
+	u.addBytesSent(reserve, later)
+	status = u.status(later)
+	if !status.targetReached || status.serveHistoricalBlocks ||
+		status.bytesLeftInCycle != 0 ||
+		status.timeLeftInCycle != uploadTargetTimeframe/2 {
+
+		t.Fatalf("unexpected status for reached target: %+v", status)
+	}
+
+	// A new cycle starts with the first bytes sent after the cycle ended.
+	next := now.Add(uploadTargetTimeframe + time.Second)
+	u.addBytesSent(1, next)
+	status = u.status(next)
+	if status.targetReached || status.bytesLeftInCycle != reserve+999 ||
+		status.timeLeftInCycle != uploadTargetTimeframe {
+
+		t.Fatalf("unexpected status for new cycle: %+v", status)
+	}
+
+	// There is no limit without a target.
+	u = newUploadTarget(0)
+	u.addBytesSent(reserve*10, now)
+	status = u.status(now)
+	if status.targetReached || !status.serveHistoricalBlocks {
+		t.Fatalf("unexpected status without a target: %+v", status)
+	}
+}
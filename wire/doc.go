@@ -158,5 +158,7 @@ This package includes spec changes outlined by the following BIPs:
 	BIP0111	(https://github.com/bitcoin/bips/blob/master/bip-0111.mediawiki)
 	BIP0130 (https://github.com/bitcoin/bips/blob/master/bip-0130.mediawiki)
 	BIP0133 (https://github.com/bitcoin/bips/blob/master/bip-0133.mediawiki)
+	BIP0324 (https://github.com/bitcoin/bips/blob/master/bip-0324.mediawiki)
+	BIP0339 (https://github.com/bitcoin/bips/blob/master/bip-0339.mediawiki)
 */
 package wire
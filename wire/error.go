@@ -5,9 +5,16 @@
 package wire
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrUnknownMessage is the error returned when decoding a message with a
+// command that is not known to this package.  Callers may use errors.Is to
+// detect it and ignore such messages as BIP0155 and later protocol upgrades
+// expect.
+var ErrUnknownMessage = errors.New("received unknown message")
+
 // MessageError describes an issue with a message.
 // An example of some potential issues are messages from the wrong bitcoin
 // network, invalid commands, mismatched checksums, and exceeding max payloads.
@@ -18,6 +25,7 @@ import (
 type MessageError struct {
 	Func        string // Function name
 	Description string // Human readable description of the issue
+	Err         error  // Underlying error, if any
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -28,6 +36,11 @@ func (e *MessageError) Error() string {
 	return e.Description
 }
 
+// Unwrap returns the underlying error of the message error, if any.
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
 // messageError creates an error for the given function and description.
 func messageError(f string, desc string) *MessageError {
 	return &MessageError{Func: f, Description: desc}
@@ -7,6 +7,7 @@ package wire
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
 	"reflect"
@@ -51,6 +52,8 @@ func TestMessage(t *testing.T) {
 	msgVerack := NewMsgVerAck()
 	msgGetAddr := NewMsgGetAddr()
 	msgAddr := NewMsgAddr()
+	msgSendAddrV2 := NewMsgSendAddrV2()
+	msgAddrV2 := NewMsgAddrV2()
 	msgGetBlocks := NewMsgGetBlocks(&chainhash.Hash{})
 	msgBlock := &blockOne
 	msgInv := NewMsgInv()
@@ -77,6 +80,11 @@ func TestMessage(t *testing.T) {
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
 	msgTxData := NewMsgTxData(msgTx, []byte{1, 2})
+	msgSendCmpct := NewMsgSendCmpct(true, CmpctBlockVersion)
+	msgCmpctBlock := NewMsgCmpctBlockFromBlock(&blockOne, 123123)
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{})
+	msgWTxIdRelay := NewMsgWTxIdRelay()
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -89,6 +97,8 @@ func TestMessage(t *testing.T) {
 		{msgVerack, msgVerack, pver, MainNet, 24},
 		{msgGetAddr, msgGetAddr, pver, MainNet, 24},
 		{msgAddr, msgAddr, pver, MainNet, 25},
+		{msgSendAddrV2, msgSendAddrV2, pver, MainNet, 24},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
 		{msgGetBlocks, msgGetBlocks, pver, MainNet, 61},
 		{msgBlock, msgBlock, pver, MainNet, 241},
 		{msgInv, msgInv, pver, MainNet, 25},
@@ -113,6 +123,11 @@ func TestMessage(t *testing.T) {
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
 		{msgTxData, msgTxData, pver, MainNet, 38},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 250},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 57},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 58},
+		{msgWTxIdRelay, msgWTxIdRelay, pver, MainNet, 24},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -382,6 +397,21 @@ func TestReadMessageWireErrors(t *testing.T) {
 	}
 }
 
+// TestReadMessageUnknown ensures reading a message with an unknown command
+// returns an error that matches ErrUnknownMessage so callers can ignore it.
+func TestReadMessageUnknown(t *testing.T) {
+	buf := makeHeader(MainNet, "bogus", 0, 0)
+	_, _, err := ReadMessage(bytes.NewReader(buf), ProtocolVersion, MainNet)
+	if !errors.Is(err, ErrUnknownMessage) {
+		t.Fatalf("ReadMessage: wrong error - got %v, want %v", err,
+			ErrUnknownMessage)
+	}
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("ReadMessage: wrong error type - got %T, want %T",
+			err, &MessageError{})
+	}
+}
+
 // TestWriteMessageWireErrors performs negative tests against wire encoding from
 // concrete messages to confirm error paths work correctly.
 func TestWriteMessageWireErrors(t *testing.T) {
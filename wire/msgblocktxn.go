@@ -0,0 +1,168 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+)
+
+// MsgBlockTxn implements the Message interface and represents a bitcoin
+// blocktxn message as defined by BIP0152.  It is sent in reply to a
+// getblocktxn message and carries the requested transactions of a block in
+// the order they were requested.  Like a block message, the data attached to
+// the transactions that commit to any follows the transactions in the same
+// order.
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgBlockTxn struct {
+	BlockHash    chainhash.Hash
+	Transactions []*MsgTx
+	PosData      Data
+}
+
+// AddTransaction adds a transaction, along with its attached data if it
+// commits to any, to the message.
+func (msg *MsgBlockTxn) AddTransaction(tx *MsgTx, data []byte) {
+	msg.Transactions = append(msg.Transactions, tx)
+	if tx.HasAttachedData() {
+		msg.PosData = append(msg.PosData, data)
+	}
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	txCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if txCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", txCount, maxTxPerBlock)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	var numOfTxWithData uint64
+	msg.Transactions = make([]*MsgTx, 0, txCount)
+	for i := uint64(0); i < txCount; i++ {
+		tx := MsgTx{}
+		err := tx.BtcDecode(r, pver, enc)
+		if err != nil {
+			return err
+		}
+		if tx.HasAttachedData() {
+			numOfTxWithData++
+		}
+		msg.Transactions = append(msg.Transactions, &tx)
+	}
+
+	dataCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if dataCount != numOfTxWithData {
+		str := fmt.Sprintf("number of data slices different than "+
+			"transactions which carry data [dataCount %d, txCount %d]",
+			dataCount, numOfTxWithData)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	msg.PosData = make([][]byte, 0, dataCount)
+	for i := uint64(0); i < dataCount; i++ {
+		data, err := ReadVarBytes(r, pver, MaxPosDataSize,
+			"blocktxn pos data")
+		if err != nil {
+			return err
+		}
+		msg.PosData = append(msg.PosData, data)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcEncode", str)
+	}
+
+	txCount := len(msg.Transactions)
+	if txCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", txCount, maxTxPerBlock)
+		return messageError("MsgBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(txCount))
+	if err != nil {
+		return err
+	}
+	for _, tx := range msg.Transactions {
+		err = tx.BtcEncode(w, pver, enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PosData)))
+	if err != nil {
+		return err
+	}
+	for _, data := range msg.PosData {
+		err = WriteVarBytes(w, pver, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// The transactions are a subset of a block, so the message is never
+	// larger than a block message.
+	return MaxBlockPayload
+}
+
+// NewMsgBlockTxn returns a new bitcoin blocktxn message that conforms to the
+// Message interface.  See MsgBlockTxn for details.
+func NewMsgBlockTxn(blockHash *chainhash.Hash) *MsgBlockTxn {
+	return &MsgBlockTxn{
+		BlockHash:    *blockHash,
+		Transactions: make([]*MsgTx, 0),
+		PosData:      make([][]byte, 0),
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode for
+// transactions with and without attached data.
+func TestBlockTxnWire(t *testing.T) {
+	hash := mainNetGenesisHash
+	block := cmpctTestBlock()
+
+	noTxns := NewMsgBlockTxn(&hash)
+
+	multiTxns := NewMsgBlockTxn(&hash)
+	multiTxns.AddTransaction(block.Transactions[1], nil)
+	multiTxns.AddTransaction(block.Transactions[2], block.PosData[1])
+	if len(multiTxns.PosData) != 1 {
+		t.Fatalf("AddTransaction: wrong number of data items - got %d, "+
+			"want %d", len(multiTxns.PosData), 1)
+	}
+
+	tests := []struct {
+		in  *MsgBlockTxn    // Message to encode
+		enc MessageEncoding // Message encoding format
+	}{
+		{noTxns, BaseEncoding},
+		{multiTxns, BaseEncoding},
+		{multiTxns, WitnessEncoding},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgBlockTxn
+		rbuf := bytes.NewReader(buf.Bytes())
+		err = msg.BtcDecode(rbuf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.in))
+			continue
+		}
+	}
+}
+
+// TestBlockTxnWireErrors performs negative tests against wire decode of
+// MsgBlockTxn to confirm error paths work correctly.
+func TestBlockTxnWireErrors(t *testing.T) {
+	hash := mainNetGenesisHash
+	block := cmpctTestBlock()
+
+	// Encode a message whose data doesn't match the transactions
+	// committing to data.
+	msg := NewMsgBlockTxn(&hash)
+	msg.AddTransaction(block.Transactions[2], block.PosData[1])
+	msg.PosData = append(msg.PosData, []byte{0x01})
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode: unexpected error %v", err)
+	}
+
+	var readMsg MsgBlockTxn
+	err = readMsg.BtcDecode(bytes.NewReader(buf.Bytes()), ProtocolVersion,
+		BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error got: %v, want: %T", err,
+			&MessageError{})
+	}
+
+	// Ensure the message is rejected before compact blocks were introduced.
+	err = readMsg.BtcDecode(bytes.NewReader(buf.Bytes()),
+		ShortIDsBlocksVersion-1, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error got: %v, want: %T", err,
+			&MessageError{})
+	}
+	err = msg.BtcEncode(&buf, ShortIDsBlocksVersion-1, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode: wrong error got: %v, want: %T", err,
+			&MessageError{})
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/aead/siphash"
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+)
+
+// ShortTxIDSize is the number of bytes used to encode a short transaction id
+// in a cmpctblock message.
+const ShortTxIDSize = 6
+
+// shortTxIDMask masks a 64-bit SipHash down to the 48 bits that make up a
+// short transaction id.
+const shortTxIDMask = 1<<(ShortTxIDSize*8) - 1
+
+// PrefilledTx is a transaction, along with its attached data if it commits to
+// any, that is sent in full as part of a cmpctblock message because the
+// receiving peer is unlikely to already have it, such as the coinbase.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+	Data  []byte
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message as defined by BIP0152.  It is used to relay a block in
+// a compact form that identifies its transactions by short ids the receiving
+// peer can match against the transactions in its memory pool.  Transactions
+// the receiver is unlikely to have are prefilled in full.
+//
+// The transactions of the block are the union of the prefilled transactions
+// and the short ids, where the short ids fill the positions not taken by
+// prefilled transactions in order.
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgCmpctBlock struct {
+	Header       BlockHeader
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []*PrefilledTx
+}
+
+// AddShortID adds the short id of a transaction to the message.
+func (msg *MsgCmpctBlock) AddShortID(shortID uint64) {
+	msg.ShortIDs = append(msg.ShortIDs, shortID&shortTxIDMask)
+}
+
+// AddPrefilledTx adds a prefilled transaction at the given index in the block
+// to the message.  Prefilled transactions must be added in ascending order of
+// their index.
+func (msg *MsgCmpctBlock) AddPrefilledTx(index uint32, tx *MsgTx, data []byte) {
+	msg.PrefilledTxs = append(msg.PrefilledTxs, &PrefilledTx{
+		Index: index,
+		Tx:    tx,
+		Data:  data,
+	})
+}
+
+// TxCount returns the number of transactions in the block described by the
+// message.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// ShortTxIDKey returns the SipHash key used to calculate the short ids of the
+// message.  It is made of the first 16 bytes of the single SHA256 of the block
+// header and the nonce.
+func (msg *MsgCmpctBlock) ShortTxIDKey() [16]byte {
+	var buf bytes.Buffer
+	buf.Grow(blockHeaderLen + 8)
+	_ = writeBlockHeader(&buf, 0, &msg.Header)
+	var nonce [8]byte
+	littleEndian.PutUint64(nonce[:], msg.Nonce)
+	buf.Write(nonce[:])
+
+	hash := sha256.Sum256(buf.Bytes())
+	var key [16]byte
+	copy(key[:], hash[:16])
+	return key
+}
+
+// ShortTxID returns the short id of the transaction with the passed hash
+// using the passed key as returned by ShortTxIDKey.  Version 2 compact blocks
+// identify transactions by their witness hash.
+func ShortTxID(key *[16]byte, hash *chainhash.Hash) uint64 {
+	return siphash.Sum64(hash[:], key) & shortTxIDMask
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	msg.Nonce, err = binarySerializer.Uint64(r, littleEndian)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more short ids than could possibly fit into a block.
+	shortIDCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if shortIDCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids to fit into a block "+
+			"[count %d, max %d]", shortIDCount, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.ShortIDs = make([]uint64, 0, shortIDCount)
+	var buf [8]byte
+	for i := uint64(0); i < shortIDCount; i++ {
+		if _, err := io.ReadFull(r, buf[:ShortTxIDSize]); err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, littleEndian.Uint64(buf[:]))
+	}
+
+	prefilledCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if prefilledCount > maxTxPerBlock-shortIDCount {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", shortIDCount+prefilledCount,
+			maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	// The indexes of prefilled transactions are differentially encoded
+	// relative to the index of the previous prefilled transaction.
+	txCount := shortIDCount + prefilledCount
+	msg.PrefilledTxs = make([]*PrefilledTx, 0, prefilledCount)
+	var nextIndex uint64
+	for i := uint64(0); i < prefilledCount; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		if diff >= txCount-nextIndex {
+			str := fmt.Sprintf("prefilled transaction index out of "+
+				"range [index %d, count %d]", nextIndex+diff,
+				txCount)
+			return messageError("MsgCmpctBlock.BtcDecode", str)
+		}
+		index := nextIndex + diff
+		nextIndex = index + 1
+
+		ptx := PrefilledTx{Index: uint32(index), Tx: &MsgTx{}}
+		if err := readPrefilledTx(r, pver, enc, &ptx); err != nil {
+			return err
+		}
+		msg.PrefilledTxs = append(msg.PrefilledTxs, &ptx)
+	}
+
+	return nil
+}
+
+// readPrefilledTx reads the transaction of a prefilled transaction along with
+// its attached data, which is only present when the transaction commits to
+// any.
+func readPrefilledTx(r io.Reader, pver uint32, enc MessageEncoding, ptx *PrefilledTx) error {
+	err := ptx.Tx.BtcDecode(r, pver, enc)
+	if err != nil {
+		return err
+	}
+	if !ptx.Tx.HasAttachedData() {
+		return nil
+	}
+
+	ptx.Data, err = ReadVarBytes(r, pver, MaxPosDataSize,
+		"prefilled transaction pos data")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	txCount := msg.TxCount()
+	if txCount > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", txCount, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = binarySerializer.PutUint64(w, littleEndian, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, shortID := range msg.ShortIDs {
+		littleEndian.PutUint64(buf[:], shortID)
+		if _, err := w.Write(buf[:ShortTxIDSize]); err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	var nextIndex uint32
+	for _, ptx := range msg.PrefilledTxs {
+		if ptx.Index < nextIndex || int(ptx.Index) >= txCount {
+			str := fmt.Sprintf("prefilled transaction index %d out "+
+				"of order or range", ptx.Index)
+			return messageError("MsgCmpctBlock.BtcEncode", str)
+		}
+		err = WriteVarInt(w, pver, uint64(ptx.Index-nextIndex))
+		if err != nil {
+			return err
+		}
+		nextIndex = ptx.Index + 1
+
+		if err := writePrefilledTx(w, pver, enc, ptx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePrefilledTx writes the transaction of a prefilled transaction along
+// with its attached data when the transaction commits to any.
+func writePrefilledTx(w io.Writer, pver uint32, enc MessageEncoding, ptx *PrefilledTx) error {
+	err := ptx.Tx.BtcEncode(w, pver, enc)
+	if err != nil {
+		return err
+	}
+	if !ptx.Tx.HasAttachedData() {
+		return nil
+	}
+
+	if len(ptx.Data) > MaxPosDataSize {
+		str := fmt.Sprintf("prefilled transaction pos data too large "+
+			"[size %d, max %d]", len(ptx.Data), MaxPosDataSize)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+	return WriteVarBytes(w, pver, ptx.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block is never larger than the block it describes.
+	return MaxBlockPayload
+}
+
+// BlockHash computes the block identifier hash for the block described by
+// the message.
+func (msg *MsgCmpctBlock) BlockHash() chainhash.Hash {
+	return msg.Header.BlockHash()
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface.  See MsgCmpctBlock for details.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header:       *header,
+		Nonce:        nonce,
+		ShortIDs:     make([]uint64, 0),
+		PrefilledTxs: make([]*PrefilledTx, 0),
+	}
+}
+
+// NewMsgCmpctBlockFromBlock returns a new bitcoin cmpctblock message for the
+// passed block using the provided nonce.  The coinbase transaction is
+// prefilled and all other transactions are identified by their short ids.
+func NewMsgCmpctBlockFromBlock(block *MsgBlock, nonce uint64) *MsgCmpctBlock {
+	msg := NewMsgCmpctBlock(&block.Header, nonce)
+	if len(block.Transactions) == 0 {
+		return msg
+	}
+
+	key := msg.ShortTxIDKey()
+	var dataIdx int
+	for i, tx := range block.Transactions {
+		var data []byte
+		if tx.HasAttachedData() && dataIdx < len(block.PosData) {
+			data = block.PosData[dataIdx]
+			dataIdx++
+		}
+
+		if i == 0 {
+			msg.AddPrefilledTx(0, tx, data)
+			continue
+		}
+		wtxid := tx.WitnessHash()
+		msg.AddShortID(ShortTxID(&key, &wtxid))
+	}
+
+	return msg
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// cmpctTestBlock returns a block with three transactions where the first and
+// the last transactions commit to attached data.
+func cmpctTestBlock() *MsgBlock {
+	block := NewMsgBlock(&blockOne.Header)
+
+	tx0 := multiTx.Copy()
+	tx0.PosCommitment = generaterateRandomCommitment(1, 1, 4, 0, 0)
+	block.AddTransactionWithData(tx0, []byte{0x01, 0x02, 0x03, 0x04})
+
+	tx1 := multiTx.Copy()
+	tx1.LockTime = 1
+	block.AddTransaction(tx1)
+
+	tx2 := multiTx.Copy()
+	tx2.PosCommitment = generaterateRandomCommitment(1, 1, 2, 1, 0)
+	block.AddTransactionWithData(tx2, []byte{0x05, 0x06})
+
+	return block
+}
+
+// TestCmpctBlock tests the MsgCmpctBlock API.
+func TestCmpctBlock(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Ensure the command is expected value.
+	wantCmd := "cmpctblock"
+	msg := NewMsgCmpctBlock(&blockOne.Header, 0)
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure short ids are truncated to 48 bits.
+	msg.AddShortID(0xffffffffffffffff)
+	if msg.ShortIDs[0] != 0xffffffffffff {
+		t.Errorf("AddShortID: wrong short id - got %x, want %x",
+			msg.ShortIDs[0], uint64(0xffffffffffff))
+	}
+
+	// Ensure a compact block created from a block prefills the coinbase
+	// along with its data and identifies the remaining transactions by
+	// their short ids.
+	block := cmpctTestBlock()
+	msg = NewMsgCmpctBlockFromBlock(block, 0x0102030405060708)
+	if msg.BlockHash() != block.BlockHash() {
+		t.Errorf("NewMsgCmpctBlockFromBlock: wrong block hash - got %v, "+
+			"want %v", msg.BlockHash(), block.BlockHash())
+	}
+	if msg.TxCount() != len(block.Transactions) {
+		t.Fatalf("NewMsgCmpctBlockFromBlock: wrong tx count - got %d, "+
+			"want %d", msg.TxCount(), len(block.Transactions))
+	}
+	if len(msg.PrefilledTxs) != 1 {
+		t.Fatalf("NewMsgCmpctBlockFromBlock: wrong number of prefilled "+
+			"txs - got %d, want %d", len(msg.PrefilledTxs), 1)
+	}
+	prefilled := msg.PrefilledTxs[0]
+	if prefilled.Index != 0 || prefilled.Tx != block.Transactions[0] ||
+		!bytes.Equal(prefilled.Data, block.PosData[0]) {
+
+		t.Errorf("NewMsgCmpctBlockFromBlock: wrong prefilled tx - got "+
+			"%v", spew.Sdump(prefilled))
+	}
+
+	key := msg.ShortTxIDKey()
+	for i, tx := range block.Transactions[1:] {
+		wtxid := tx.WitnessHash()
+		want := ShortTxID(&key, &wtxid)
+		if want>>48 != 0 {
+			t.Errorf("ShortTxID: short id %x exceeds 48 bits", want)
+		}
+		if msg.ShortIDs[i] != want {
+			t.Errorf("NewMsgCmpctBlockFromBlock: wrong short id #%d "+
+				"- got %x, want %x", i, msg.ShortIDs[i], want)
+		}
+	}
+
+	// Ensure the short ids depend on the nonce.
+	other := NewMsgCmpctBlockFromBlock(block, 0x0102030405060709)
+	if other.ShortTxIDKey() == key || other.ShortIDs[0] == msg.ShortIDs[0] {
+		t.Errorf("NewMsgCmpctBlockFromBlock: short ids do not depend " +
+			"on the nonce")
+	}
+}
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode.
+func TestCmpctBlockWire(t *testing.T) {
+	var header bytes.Buffer
+	if err := writeBlockHeader(&header, 0, &blockOne.Header); err != nil {
+		t.Fatalf("writeBlockHeader: unexpected error: %v", err)
+	}
+
+	// Compact block with short ids only.
+	shortIDsOnly := NewMsgCmpctBlock(&blockOne.Header, 0x0102030405060708)
+	shortIDsOnly.AddShortID(0x010203040506)
+	shortIDsOnly.AddShortID(0xa0a1a2a3a4a5)
+	shortIDsOnlyEncoded := append(header.Bytes(), []byte{
+		0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Nonce
+		0x02,                               // Varint for number of short ids
+		0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // Short id
+		0xa5, 0xa4, 0xa3, 0xa2, 0xa1, 0xa0, // Short id
+		0x00, // Varint for number of prefilled txs
+	}...)
+
+	tests := []struct {
+		in  *MsgCmpctBlock  // Message to encode
+		buf []byte          // Wire encoding, if checked
+		enc MessageEncoding // Message encoding format
+	}{
+		{shortIDsOnly, shortIDsOnlyEncoded, BaseEncoding},
+		{NewMsgCmpctBlockFromBlock(cmpctTestBlock(), 1), nil, WitnessEncoding},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if test.buf != nil && !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgCmpctBlock
+		rbuf := bytes.NewReader(buf.Bytes())
+		err = msg.BtcDecode(rbuf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.in))
+			continue
+		}
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire encode and
+// decode of MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	var header bytes.Buffer
+	if err := writeBlockHeader(&header, 0, &blockOne.Header); err != nil {
+		t.Fatalf("writeBlockHeader: unexpected error: %v", err)
+	}
+	nonce := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	withHeader := func(b ...byte) []byte {
+		buf := append([]byte{}, header.Bytes()...)
+		buf = append(buf, nonce...)
+		return append(buf, b...)
+	}
+
+	// Ensure decoding fails for invalid encodings.
+	decodeTests := []struct {
+		buf  []byte // Wire encoding
+		pver uint32 // Protocol version for wire encoding
+	}{
+		// Protocol version before compact blocks.
+		{withHeader(0x00, 0x00), ShortIDsBlocksVersion - 1},
+		// Too many short ids.
+		{withHeader(0xfe, 0xff, 0xff, 0xff, 0x00), pver},
+		// Prefilled transaction index past the number of transactions.
+		{withHeader(0x00, 0x01, 0x01), pver},
+	}
+	for i, test := range decodeTests {
+		var msg MsgCmpctBlock
+		err := msg.BtcDecode(bytes.NewReader(test.buf), test.pver,
+			BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, wireErr)
+		}
+	}
+
+	// Ensure encoding fails for prefilled transactions out of order.
+	msg := NewMsgCmpctBlock(&blockOne.Header, 0)
+	msg.AddShortID(1)
+	msg.AddPrefilledTx(1, multiTx, nil)
+	msg.AddPrefilledTx(0, multiTx, nil)
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, pver, BaseEncoding)
+	if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+		t.Errorf("BtcEncode wrong error got: %v, want: %v", err,
+			wireErr)
+	}
+
+	// Ensure encoding fails for the protocol version before compact
+	// blocks.
+	buf.Reset()
+	err = NewMsgCmpctBlock(&blockOne.Header, 0).BtcEncode(&buf,
+		ShortIDsBlocksVersion-1, BaseEncoding)
+	if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+		t.Errorf("BtcEncode wrong error got: %v, want: %v", err,
+			wireErr)
+	}
+}
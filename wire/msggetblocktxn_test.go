@@ -0,0 +1,150 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/babylonchain-io/bbld/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode,
+// including the differential encoding of the transaction indexes.
+func TestGetBlockTxnWire(t *testing.T) {
+	hash := mainNetGenesisHash
+
+	noIndexes := NewMsgGetBlockTxn(&hash)
+	noIndexesEncoded := append(hash.CloneBytes(),
+		0x00, // Varint for number of indexes
+	)
+
+	multiIndexes := NewMsgGetBlockTxn(&hash)
+	multiIndexes.AddIndex(1)
+	multiIndexes.AddIndex(2)
+	multiIndexes.AddIndex(300)
+	multiIndexesEncoded := append(hash.CloneBytes(),
+		0x03,             // Varint for number of indexes
+		0x01,             // Index 1
+		0x00,             // Index 2
+		0xfd, 0x29, 0x01, // Index 300
+	)
+
+	tests := []struct {
+		in  *MsgGetBlockTxn // Message to encode
+		buf []byte          // Wire encoding
+	}{
+		{noIndexes, noIndexesEncoded},
+		{multiIndexes, multiIndexesEncoded},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgGetBlockTxn
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.in))
+			continue
+		}
+	}
+}
+
+// TestGetBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgGetBlockTxn to confirm error paths work correctly.
+func TestGetBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	hash := chainhash.Hash{}
+	outOfOrder := NewMsgGetBlockTxn(&hash)
+	outOfOrder.AddIndex(2)
+	outOfOrder.AddIndex(1)
+
+	tests := []struct {
+		in       *MsgGetBlockTxn // Value to encode
+		buf      []byte          // Wire encoding
+		pver     uint32          // Protocol version for wire encoding
+		max      int             // Max size of fixed buffer to induce errors
+		writeErr error           // Expected write error
+		readErr  error           // Expected read error
+	}{
+		// Force error in block hash.
+		{outOfOrder, hash[:], pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error with indexes out of order.
+		{outOfOrder, append(hash.CloneBytes(), 0xfe, 0xff, 0xff,
+			0xff, 0x00), pver, 64, wireErr, wireErr},
+		// Force error with an index out of range.
+		{NewMsgGetBlockTxn(&hash), append(hash.CloneBytes(), 0x01,
+			0xfe, 0xff, 0xff, 0xff, 0x00), pver, 64, nil, wireErr},
+		// Force error with protocol version before compact blocks.
+		{NewMsgGetBlockTxn(&hash), append(hash.CloneBytes(), 0x00),
+			ShortIDsBlocksVersion - 1, 64, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgGetBlockTxn
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// NetworkID identifies the network an address in an addrv2 message belongs
+// to as defined by BIP0155.
+type NetworkID uint8
+
+const (
+	// NetworkIPv4 identifies an IPv4 address.
+	NetworkIPv4 NetworkID = 1
+
+	// NetworkIPv6 identifies an IPv6 address.
+	NetworkIPv6 NetworkID = 2
+
+	// NetworkTorV2 identifies a Tor v2 onion service address.  These are
+	// deprecated and are not relayed.
+	NetworkTorV2 NetworkID = 3
+
+	// NetworkTorV3 identifies a Tor v3 onion service address.
+	NetworkTorV3 NetworkID = 4
+
+	// NetworkI2P identifies an I2P address.
+	NetworkI2P NetworkID = 5
+
+	// NetworkCJDNS identifies a CJDNS address.
+	NetworkCJDNS NetworkID = 6
+)
+
+// MaxNetAddressV2Size is the maximum size of the address field of a
+// NetAddressV2 on the wire.
+const MaxNetAddressV2Size = 512
+
+// networkAddrSizes maps the known network ids to the size of their
+// addresses.
+var networkAddrSizes = map[NetworkID]int{
+	NetworkIPv4:  4,
+	NetworkIPv6:  16,
+	NetworkTorV2: 10,
+	NetworkTorV3: 32,
+	NetworkI2P:   32,
+	NetworkCJDNS: 16,
+}
+
+// Map of network ids back to their constant names for pretty printing.
+var networkIDStrings = map[NetworkID]string{
+	NetworkIPv4:  "ipv4",
+	NetworkIPv6:  "ipv6",
+	NetworkTorV2: "torv2",
+	NetworkTorV3: "torv3",
+	NetworkI2P:   "i2p",
+	NetworkCJDNS: "cjdns",
+}
+
+// String returns the NetworkID in human-readable form.
+func (n NetworkID) String() string {
+	if s, ok := networkIDStrings[n]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(n))
+}
+
+const (
+	// torV3Version is the version byte of Tor v3 onion service addresses.
+	torV3Version = 0x03
+
+	// onionSuffix is the suffix of Tor onion service host names.
+	onionSuffix = ".onion"
+
+	// i2pSuffix is the suffix of I2P host names.
+	i2pSuffix = ".b32.i2p"
+)
+
+// onionCatPrefix is the IPv6 prefix used to encode Tor v2 addresses in
+// legacy addr messages.
+var onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// base32Lower is the lowercase, unpadded base32 encoding used by Tor and
+// I2P host names.
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").
+	WithPadding(base32.NoPadding)
+
+// NetAddressV2 defines information about a peer on the network as carried by
+// the addrv2 message (BIP0155).  Unlike NetAddress it is able to represent
+// addresses of networks other than IPv4 and IPv6, such as Tor v3, I2P and
+// CJDNS.
+type NetAddressV2 struct {
+	// Last time the address was seen.  This is encoded as a uint32 on the
+	// wire and therefore is limited to 2106.
+	Timestamp time.Time
+
+	// Bitfield which identifies the services supported by the address.
+	Services ServiceFlag
+
+	// NetworkID identifies the network of the address.
+	NetworkID NetworkID
+
+	// Addr is the network specific encoding of the address, e.g. the four
+	// bytes of an IPv4 address or the 32 byte public key of a Tor v3
+	// onion service.
+	Addr []byte
+
+	// Port the peer is using.  This is encoded in big endian on the wire
+	// which differs from most everything else.
+	Port uint16
+}
+
+// HasService returns whether the specified service is supported by the address.
+func (na *NetAddressV2) HasService(service ServiceFlag) bool {
+	return na.Services&service == service
+}
+
+// AddService adds service as a supported service by the peer generating the
+// message.
+func (na *NetAddressV2) AddService(service ServiceFlag) {
+	na.Services |= service
+}
+
+// IP returns the IP address of IPv4, IPv6 and CJDNS addresses and nil for
+// all other networks.
+func (na *NetAddressV2) IP() net.IP {
+	switch na.NetworkID {
+	case NetworkIPv4, NetworkIPv6, NetworkCJDNS:
+		return net.IP(na.Addr).To16()
+	}
+	return nil
+}
+
+// Host returns the host part of the address: the IP address for IPv4, IPv6
+// and CJDNS addresses, and the .onion or .b32.i2p host name for Tor and I2P
+// addresses.
+func (na *NetAddressV2) Host() string {
+	switch na.NetworkID {
+	case NetworkIPv4, NetworkIPv6, NetworkCJDNS:
+		return net.IP(na.Addr).String()
+
+	case NetworkTorV2:
+		return base32Lower.EncodeToString(na.Addr) + onionSuffix
+
+	case NetworkTorV3:
+		checksum := torV3Checksum(na.Addr)
+		data := make([]byte, 0, len(na.Addr)+3)
+		data = append(data, na.Addr...)
+		data = append(data, checksum[:2]...)
+		data = append(data, torV3Version)
+		return base32Lower.EncodeToString(data) + onionSuffix
+
+	case NetworkI2P:
+		return base32Lower.EncodeToString(na.Addr) + i2pSuffix
+	}
+
+	return fmt.Sprintf("[%v:%x]", na.NetworkID, na.Addr)
+}
+
+// String returns the address in the form host:port.
+func (na *NetAddressV2) String() string {
+	return net.JoinHostPort(na.Host(), fmt.Sprintf("%d", na.Port))
+}
+
+// IsLegacy returns whether the address can be represented by a legacy
+// NetAddress and therefore be relayed in addr messages.
+func (na *NetAddressV2) IsLegacy() bool {
+	switch na.NetworkID {
+	case NetworkIPv4, NetworkIPv6, NetworkTorV2:
+		return true
+	}
+	return false
+}
+
+// ToLegacy converts the address to a legacy NetAddress.  Tor v2 addresses are
+// encoded in the OnionCat IPv6 range.  It returns nil for addresses that have
+// no legacy representation.
+func (na *NetAddressV2) ToLegacy() *NetAddress {
+	var ip net.IP
+	switch na.NetworkID {
+	case NetworkIPv4, NetworkIPv6:
+		ip = net.IP(na.Addr).To16()
+
+	case NetworkTorV2:
+		ip = make(net.IP, 0, net.IPv6len)
+		ip = append(ip, onionCatPrefix...)
+		ip = append(ip, na.Addr...)
+
+	default:
+		return nil
+	}
+
+	return &NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		IP:        ip,
+		Port:      na.Port,
+	}
+}
+
+// torV3Checksum returns the checksum of a Tor v3 onion service public key as
+// defined by the Tor rendezvous specification.
+func torV3Checksum(pubKey []byte) [32]byte {
+	data := make([]byte, 0, 15+len(pubKey)+1)
+	data = append(data, ".onion checksum"...)
+	data = append(data, pubKey...)
+	data = append(data, torV3Version)
+	return sha3.Sum256(data)
+}
+
+// NewNetAddressV2IPPort returns a new NetAddressV2 using the provided IP,
+// port, and supported services with defaults for the remaining fields.
+func NewNetAddressV2IPPort(ip net.IP, port uint16, services ServiceFlag) *NetAddressV2 {
+	return NewNetAddressV2FromLegacy(NewNetAddressIPPort(ip, port, services))
+}
+
+// NewNetAddressV2FromLegacy converts a legacy NetAddress to a NetAddressV2.
+// Addresses in the OnionCat IPv6 range are converted to Tor v2 addresses.
+func NewNetAddressV2FromLegacy(na *NetAddress) *NetAddressV2 {
+	nav2 := &NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      na.Port,
+	}
+
+	switch ip := na.IP; {
+	case ip.To4() != nil:
+		nav2.NetworkID = NetworkIPv4
+		nav2.Addr = append([]byte(nil), ip.To4()...)
+
+	case len(ip) == net.IPv6len && bytes.Equal(ip[:6], onionCatPrefix):
+		nav2.NetworkID = NetworkTorV2
+		nav2.Addr = append([]byte(nil), ip[6:]...)
+
+	default:
+		nav2.NetworkID = NetworkIPv6
+		nav2.Addr = make([]byte, net.IPv6len)
+		copy(nav2.Addr, ip.To16())
+	}
+
+	return nav2
+}
+
+// NewNetAddressV2Host returns a new NetAddressV2 for the provided host, which
+// must either be an IP address, a Tor v2 or v3 .onion host name, or an I2P
+// .b32.i2p host name.  IP addresses are never interpreted as CJDNS addresses
+// since those can't be told apart from IPv6 addresses by their host.
+func NewNetAddressV2Host(host string, port uint16,
+	services ServiceFlag) (*NetAddressV2, error) {
+
+	if ip := net.ParseIP(host); ip != nil {
+		return NewNetAddressV2IPPort(ip, port, services), nil
+	}
+
+	var netID NetworkID
+	var addr []byte
+	lowerHost := strings.ToLower(host)
+	switch {
+	case strings.HasSuffix(lowerHost, onionSuffix):
+		data, err := base32Lower.DecodeString(
+			strings.TrimSuffix(lowerHost, onionSuffix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid onion address %s: %v",
+				host, err)
+		}
+
+		switch len(data) {
+		case networkAddrSizes[NetworkTorV2]:
+			netID, addr = NetworkTorV2, data
+
+		case networkAddrSizes[NetworkTorV3] + 3:
+			pubKey := data[:32]
+			checksum := torV3Checksum(pubKey)
+			if data[34] != torV3Version ||
+				data[32] != checksum[0] || data[33] != checksum[1] {
+
+				return nil, fmt.Errorf("invalid onion address "+
+					"%s: bad checksum or version", host)
+			}
+			netID, addr = NetworkTorV3, pubKey
+
+		default:
+			return nil, fmt.Errorf("invalid onion address %s: "+
+				"unexpected length %d", host, len(data))
+		}
+
+	case strings.HasSuffix(lowerHost, i2pSuffix):
+		data, err := base32Lower.DecodeString(
+			strings.TrimSuffix(lowerHost, i2pSuffix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid i2p address %s: %v",
+				host, err)
+		}
+		if len(data) != networkAddrSizes[NetworkI2P] {
+			return nil, fmt.Errorf("invalid i2p address %s: "+
+				"unexpected length %d", host, len(data))
+		}
+		netID, addr = NetworkI2P, data
+
+	default:
+		return nil, fmt.Errorf("unsupported host %s", host)
+	}
+
+	return &NetAddressV2{
+		Timestamp: time.Unix(time.Now().Unix(), 0),
+		Services:  services,
+		NetworkID: netID,
+		Addr:      addr,
+		Port:      port,
+	}, nil
+}
+
+// maxNetAddressV2Payload returns the max payload size for a bitcoin
+// NetAddressV2.
+func maxNetAddressV2Payload() uint32 {
+	// Timestamp 4 bytes + services varint + network id 1 byte + address
+	// varint size + address + port 2 bytes.
+	return 4 + MaxVarIntPayload + 1 + MaxVarIntPayload +
+		MaxNetAddressV2Size + 2
+}
+
+// readNetAddressV2 reads an encoded NetAddressV2 from r.  It returns false
+// for the known flag when the address belongs to a network that is unknown
+// or not supported so the caller can skip it as BIP0155 requires.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) (bool, error) {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return false, err
+	}
+
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return false, err
+	}
+	na.Services = ServiceFlag(services)
+
+	netID, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return false, err
+	}
+	na.NetworkID = NetworkID(netID)
+
+	addr, err := ReadVarBytes(r, pver, MaxNetAddressV2Size, "address")
+	if err != nil {
+		return false, err
+	}
+	na.Addr = addr
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	na.Port, err = binarySerializer.Uint16(r, bigEndian)
+	if err != nil {
+		return false, err
+	}
+
+	// Addresses of unknown networks must be ignored, while those of known
+	// networks with an invalid length must be rejected.
+	size, ok := networkAddrSizes[na.NetworkID]
+	if !ok {
+		return false, nil
+	}
+	if len(addr) != size {
+		str := fmt.Sprintf("invalid %v address length %d, want %d",
+			na.NetworkID, len(addr), size)
+		return false, messageError("readNetAddressV2", str)
+	}
+
+	return true, nil
+}
+
+// writeNetAddressV2 serializes a NetAddressV2 to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	if len(na.Addr) > MaxNetAddressV2Size {
+		str := fmt.Sprintf("address is too long [len %d, max %d]",
+			len(na.Addr), MaxNetAddressV2Size)
+		return messageError("writeNetAddressV2", str)
+	}
+
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+
+	if err := WriteVarInt(w, pver, uint64(na.Services)); err != nil {
+		return err
+	}
+
+	if err := binarySerializer.PutUint8(w, uint8(na.NetworkID)); err != nil {
+		return err
+	}
+
+	if err := WriteVarBytes(w, pver, na.Addr); err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
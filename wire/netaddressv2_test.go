@@ -0,0 +1,273 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if
+// there is an error.  This is only provided for the hard-coded constants so
+// errors in the source code can be detected.  It will only (and must only)
+// be called with hard-coded values.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// TestNetAddressV2Host tests the conversion of NetAddressV2 to and from host
+// strings for all supported networks.
+func TestNetAddressV2Host(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		host   string
+		netID  NetworkID
+		addr   []byte
+		legacy bool
+	}{
+		{
+			host:   "127.0.0.1",
+			netID:  NetworkIPv4,
+			addr:   []byte{127, 0, 0, 1},
+			legacy: true,
+		},
+		{
+			host:   "2001:db8::1",
+			netID:  NetworkIPv6,
+			addr:   hexToBytes("20010db8000000000000000000000001"),
+			legacy: true,
+		},
+		{
+			host:   "6hzph5hv6337r6p2.onion",
+			netID:  NetworkTorV2,
+			addr:   hexToBytes("f1f2f3f4f5f6f7f8f9fa"),
+			legacy: true,
+		},
+		{
+			host:  "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion",
+			netID: NetworkTorV3,
+			addr: hexToBytes("79bcc625184b05194975c28b66b66b04" +
+				"69f7f6556fb1ac3189a79b40dda32f1f"),
+		},
+		{
+			host:  "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+			netID: NetworkI2P,
+			addr: hexToBytes("a2894dabaec08c0051a481a6dac88b64" +
+				"f98232ae42d4b6fd2fa81952dfe36a87"),
+		},
+	}
+
+	for _, test := range tests {
+		na, err := NewNetAddressV2Host(test.host, 8333, SFNodeNetwork)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.host, err)
+			continue
+		}
+		if na.NetworkID != test.netID {
+			t.Errorf("%s: mismatched network -- got %v, want %v",
+				test.host, na.NetworkID, test.netID)
+		}
+		if !bytes.Equal(na.Addr, test.addr) {
+			t.Errorf("%s: mismatched address -- got %x, want %x",
+				test.host, na.Addr, test.addr)
+		}
+		if host := na.Host(); host != test.host {
+			t.Errorf("%s: mismatched host -- got %v, want %v",
+				test.host, host, test.host)
+		}
+		if na.IsLegacy() != test.legacy {
+			t.Errorf("%s: mismatched legacy -- got %v, want %v",
+				test.host, na.IsLegacy(), test.legacy)
+		}
+
+		// Legacy addresses must survive a round trip through the
+		// legacy representation.
+		legacy := na.ToLegacy()
+		if (legacy != nil) != test.legacy {
+			t.Errorf("%s: unexpected legacy address %v", test.host,
+				legacy)
+			continue
+		}
+		if legacy == nil {
+			continue
+		}
+		if got := NewNetAddressV2FromLegacy(legacy); !reflect.DeepEqual(got, na) {
+			t.Errorf("%s: mismatched legacy round trip -- got %v, "+
+				"want %v", test.host, spew.Sdump(got), spew.Sdump(na))
+		}
+	}
+
+	// Ensure malformed host names are rejected.
+	invalid := []string{
+		"example.com",
+		"zzzz.onion",
+		// Tor v3 address with a corrupted checksum.
+		"pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscrya.onion",
+		"ukeu3k5oycgaauneqgtnvselmt4yemvo.b32.i2p",
+	}
+	for _, host := range invalid {
+		if _, err := NewNetAddressV2Host(host, 8333, 0); err == nil {
+			t.Errorf("%s: expected error", host)
+		}
+	}
+}
+
+// TestNetAddressV2Wire tests the NetAddressV2 wire encode and decode.
+func TestNetAddressV2Wire(t *testing.T) {
+	t.Parallel()
+
+	pver := ProtocolVersion
+	timestamp := time.Unix(0x495fab29, 0) // 2009-01-03 12:15:05 -0600 CST
+
+	tests := []struct {
+		in    NetAddressV2 // NetAddressV2 to encode
+		buf   []byte       // Wire encoding
+		known bool         // Whether the network is known
+	}{
+		{
+			NetAddressV2{
+				Timestamp: timestamp,
+				Services:  SFNodeNetwork | SFNodeWitness,
+				NetworkID: NetworkIPv4,
+				Addr:      []byte{127, 0, 0, 1},
+				Port:      8333,
+			},
+			[]byte{
+				0x29, 0xab, 0x5f, 0x49, // Timestamp
+				0x09,                   // Services varint
+				0x01,                   // Network id
+				0x04,                   // Address length
+				0x7f, 0x00, 0x00, 0x01, // 127.0.0.1
+				0x20, 0x8d, // Port 8333 in big-endian
+			},
+			true,
+		},
+		{
+			NetAddressV2{
+				Timestamp: timestamp,
+				NetworkID: NetworkTorV3,
+				Addr: hexToBytes("79bcc625184b05194975c28b66b66b04" +
+					"69f7f6556fb1ac3189a79b40dda32f1f"),
+				Port: 8333,
+			},
+			append(append([]byte{
+				0x29, 0xab, 0x5f, 0x49, // Timestamp
+				0x00, // Services varint
+				0x04, // Network id
+				0x20, // Address length
+			}, hexToBytes("79bcc625184b05194975c28b66b66b04"+
+				"69f7f6556fb1ac3189a79b40dda32f1f")...),
+				0x20, 0x8d, // Port 8333 in big-endian
+			),
+			true,
+		},
+		{
+			NetAddressV2{
+				Timestamp: timestamp,
+				NetworkID: 0xaa,
+				Addr:      []byte{0x01, 0x02, 0x03},
+				Port:      1,
+			},
+			[]byte{
+				0x29, 0xab, 0x5f, 0x49, // Timestamp
+				0x00,             // Services varint
+				0xaa,             // Unknown network id
+				0x03,             // Address length
+				0x01, 0x02, 0x03, // Address
+				0x00, 0x01, // Port 1 in big-endian
+			},
+			false,
+		},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := writeNetAddressV2(&buf, pver, &test.in)
+		if err != nil {
+			t.Errorf("writeNetAddressV2 #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("writeNetAddressV2 #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		var na NetAddressV2
+		known, err := readNetAddressV2(bytes.NewReader(test.buf), pver, &na)
+		if err != nil {
+			t.Errorf("readNetAddressV2 #%d error %v", i, err)
+			continue
+		}
+		if known != test.known {
+			t.Errorf("readNetAddressV2 #%d mismatched known -- got "+
+				"%v, want %v", i, known, test.known)
+		}
+		if !reflect.DeepEqual(na, test.in) {
+			t.Errorf("readNetAddressV2 #%d\n got: %s want: %s", i,
+				spew.Sdump(na), spew.Sdump(test.in))
+		}
+	}
+}
+
+// TestNetAddressV2WireErrors performs negative tests against the NetAddressV2
+// wire decode to confirm error paths work correctly.
+func TestNetAddressV2WireErrors(t *testing.T) {
+	t.Parallel()
+
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	tests := []struct {
+		buf []byte // Wire encoding
+		err error  // Expected read error
+	}{
+		// Short read of the timestamp.
+		{[]byte{0x29, 0xab}, io.ErrUnexpectedEOF},
+		// Missing port.
+		{[]byte{0x29, 0xab, 0x5f, 0x49, 0x00, 0x01, 0x04, 0x7f,
+			0x00, 0x00, 0x01}, io.EOF},
+		// IPv4 address with an invalid length.
+		{[]byte{0x29, 0xab, 0x5f, 0x49, 0x00, 0x01, 0x05, 0x7f,
+			0x00, 0x00, 0x01, 0x01, 0x20, 0x8d}, wireErr},
+		// Address exceeding the maximum size.
+		{[]byte{0x29, 0xab, 0x5f, 0x49, 0x00, 0x01, 0xfd, 0x01,
+			0x02}, wireErr},
+	}
+
+	for i, test := range tests {
+		var na NetAddressV2
+		_, err := readNetAddressV2(bytes.NewReader(test.buf), pver, &na)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+			t.Errorf("readNetAddressV2 #%d wrong error got: %v, "+
+				"want: %v", i, err, test.err)
+			continue
+		}
+		if _, ok := err.(*MessageError); !ok && err != test.err {
+			t.Errorf("readNetAddressV2 #%d wrong error got: %v, "+
+				"want: %v", i, err, test.err)
+		}
+	}
+
+	// Ensure writing an address exceeding the maximum size fails.
+	na := NetAddressV2{Addr: make([]byte, MaxNetAddressV2Size+1)}
+	err := writeNetAddressV2(ioutil.Discard, pver, &na)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("writeNetAddressV2: wrong error got: %v, want: %T",
+			err, wireErr)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// v2MessageIDs lists the commands of the messages which are encoded with a
+// single byte message id in the contents of v2 transport packets (BIP0324),
+// indexed by their message id.  Message id 0 means the message is encoded with
+// its command.
+var v2MessageIDs = [...]string{
+	1:  CmdAddr,
+	2:  CmdBlock,
+	3:  CmdBlockTxn,
+	4:  CmdCmpctBlock,
+	5:  CmdFeeFilter,
+	6:  CmdFilterAdd,
+	7:  CmdFilterClear,
+	8:  CmdFilterLoad,
+	9:  CmdGetBlocks,
+	10: CmdGetBlockTxn,
+	11: CmdGetData,
+	12: CmdGetHeaders,
+	13: CmdHeaders,
+	14: CmdInv,
+	15: CmdMemPool,
+	16: CmdMerkleBlock,
+	17: CmdNotFound,
+	18: CmdPing,
+	19: CmdPong,
+	20: CmdSendCmpct,
+	21: CmdTx,
+	22: CmdGetCFilters,
+	23: CmdCFilter,
+	24: CmdGetCFHeaders,
+	25: CmdCFHeaders,
+	26: CmdGetCFCheckpt,
+	27: CmdCFCheckpt,
+	28: CmdAddrV2,
+}
+
+// v2MessageIDsByCommand maps the commands of the messages with a message id
+// to their message id.
+var v2MessageIDsByCommand = func() map[string]byte {
+	ids := make(map[string]byte, len(v2MessageIDs))
+	for id, cmd := range v2MessageIDs {
+		if cmd != "" {
+			ids[cmd] = byte(id)
+		}
+	}
+	return ids
+}()
+
+// EncodeV2Message returns the contents of the v2 transport packet (BIP0324)
+// which carries the passed message.  The contents start with the message id
+// of the message, or a zero byte followed by the command of the message
+// padded to CommandSize bytes when it has none, followed by the payload of the
+// message.
+func EncodeV2Message(msg Message, pver uint32, enc MessageEncoding) ([]byte, error) {
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	var buf bytes.Buffer
+	if id, ok := v2MessageIDsByCommand[cmd]; ok {
+		buf.WriteByte(id)
+	} else {
+		var command [1 + CommandSize]byte
+		copy(command[1:], cmd)
+		buf.Write(command[:])
+	}
+	headerLen := buf.Len()
+
+	if err := msg.BtcEncode(&buf, pver, enc); err != nil {
+		return nil, err
+	}
+
+	// Enforce maximum overall message payload.
+	lenp := buf.Len() - headerLen
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeV2Message parses the message carried by the passed contents of a v2
+// transport packet (BIP0324) as encoded by EncodeV2Message.  It returns the
+// message along with its payload.  A MessageError wrapping ErrUnknownMessage
+// is returned for messages with an unknown message id or command, which
+// callers are expected to ignore.
+func DecodeV2Message(contents []byte, pver uint32, enc MessageEncoding) (Message, []byte, error) {
+	if len(contents) == 0 {
+		return nil, nil, messageError("DecodeV2Message", "empty contents")
+	}
+
+	var command string
+	var payload []byte
+	switch id := contents[0]; {
+	case id == 0:
+		if len(contents) < 1+CommandSize {
+			str := fmt.Sprintf("contents of %d bytes are too short "+
+				"for a command", len(contents))
+			return nil, nil, messageError("DecodeV2Message", str)
+		}
+		command = strings.TrimRight(string(contents[1:1+CommandSize]),
+			"\x00")
+		payload = contents[1+CommandSize:]
+
+		// Check for malformed commands.
+		if !utf8.ValidString(command) {
+			str := fmt.Sprintf("invalid command %v", []byte(command))
+			return nil, nil, messageError("DecodeV2Message", str)
+		}
+
+	case int(id) < len(v2MessageIDs) && v2MessageIDs[id] != "":
+		command = v2MessageIDs[id]
+		payload = contents[1:]
+
+	default:
+		return nil, nil, &MessageError{
+			Func:        "DecodeV2Message",
+			Description: fmt.Sprintf("unknown message id %d", id),
+			Err:         ErrUnknownMessage,
+		}
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, nil, &MessageError{
+			Func:        "DecodeV2Message",
+			Description: err.Error(),
+			Err:         ErrUnknownMessage,
+		}
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl {
+		str := fmt.Sprintf("payload exceeds max length - contents "+
+			"hold %v bytes, but max payload size for messages of "+
+			"type [%v] is %v.", len(payload), command, mpl)
+		return nil, nil, messageError("DecodeV2Message", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	err = msg.BtcDecode(bytes.NewBuffer(payload), pver, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msg, payload, nil
+}
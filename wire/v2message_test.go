@@ -0,0 +1,92 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestV2Message tests the v2 transport encoding of messages with and without
+// a message id.
+func TestV2Message(t *testing.T) {
+	pver := ProtocolVersion
+
+	tests := []struct {
+		msg    Message
+		prefix []byte
+	}{
+		{NewMsgPing(123123), []byte{18}},
+		{NewMsgAddrV2(), []byte{28}},
+		{NewMsgMemPool(), []byte{15}},
+		{
+			NewMsgVerAck(),
+			[]byte{0, 'v', 'e', 'r', 'a', 'c', 'k', 0, 0, 0, 0, 0, 0},
+		},
+		{
+			NewMsgSendAddrV2(),
+			[]byte{0, 's', 'e', 'n', 'd', 'a', 'd', 'd', 'r', 'v', '2',
+				0, 0},
+		},
+	}
+
+	for i, test := range tests {
+		contents, err := EncodeV2Message(test.msg, pver, LatestEncoding)
+		if err != nil {
+			t.Errorf("EncodeV2Message #%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !bytes.HasPrefix(contents, test.prefix) {
+			t.Errorf("EncodeV2Message #%d: contents %x do not start "+
+				"with %x", i, contents, test.prefix)
+			continue
+		}
+
+		msg, payload, err := DecodeV2Message(contents, pver,
+			LatestEncoding)
+		if err != nil {
+			t.Errorf("DecodeV2Message #%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Errorf("DecodeV2Message #%d: got %v, want %v", i, msg,
+				test.msg)
+		}
+		if !bytes.Equal(payload, contents[len(test.prefix):]) {
+			t.Errorf("DecodeV2Message #%d: wrong payload %x", i, payload)
+		}
+	}
+
+	// Unknown message ids and commands must be ignorable.
+	unknown := [][]byte{
+		{29},
+		{0xff},
+		{0, 'b', 'o', 'g', 'u', 's', 0, 0, 0, 0, 0, 0, 0},
+	}
+	for i, contents := range unknown {
+		_, _, err := DecodeV2Message(contents, pver, LatestEncoding)
+		if !errors.Is(err, ErrUnknownMessage) {
+			t.Errorf("DecodeV2Message unknown #%d: wrong error - got "+
+				"%v, want %v", i, err, ErrUnknownMessage)
+		}
+	}
+
+	// Truncated contents and payloads exceeding the maximum payload of the
+	// message are rejected.
+	invalid := [][]byte{
+		{},
+		{0, 'v', 'e', 'r'},
+		{19, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for i, contents := range invalid {
+		_, _, err := DecodeV2Message(contents, pver, LatestEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("DecodeV2Message invalid #%d: wrong error - got "+
+				"%v <%T>, want %T", i, err, err, &MessageError{})
+		}
+	}
+}